@@ -0,0 +1,396 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Access schedules restrict the clients at set times of the week, in the
+// local time of the server: during a schedule the clients of its group (or
+// every client) are blocked by more sources of the sinkhole, or paused. A
+// paused client only gets the names of the local zones, the others are
+// refused. A client can also be paused by hand for a while.
+
+// scheduleDays are the days of a schedule, in the order of time.Weekday
+var scheduleDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+const (
+	maxScheduleName = 100
+	// defaultPauseMinutes and maxPauseMinutes bound a pause by hand
+	defaultPauseMinutes = 30
+	maxPauseMinutes     = 7 * 24 * 60
+)
+
+// AccessSchedule restricts clients at set times of the week. To before From
+// runs past midnight, into the next day.
+type AccessSchedule struct {
+	Name  string   `json:"name"`
+	Group string   `json:"group,omitempty"` // empty for every client
+	Days  []string `json:"days,omitempty"`  // sun to sat, empty for every day
+	From  string   `json:"from"`            // HH:MM
+	To    string   `json:"to"`              // HH:MM
+	// Blocklists are the sources of the sinkhole blocking the clients
+	// during the schedule, on top of their own
+	Blocklists []string `json:"blocklists,omitempty"`
+	// Pause refuses the names out of the local zones
+	Pause   bool `json:"pause,omitempty"`
+	Enabled bool `json:"enabled"`
+}
+
+// DBAccessSchedule is an access schedule saved in the database
+type DBAccessSchedule struct {
+	ID int64 `json:"id"`
+	AccessSchedule
+	Active bool `json:"active"` // the schedule applies now
+}
+
+// compiledSchedule is an enabled schedule ready to be checked at query time
+type compiledSchedule struct {
+	name       string
+	group      string
+	days       [7]bool
+	from, to   int // minutes in the day
+	blocklists []string
+	pause      bool
+}
+
+var (
+	accessSchedules atomic.Pointer[[]compiledSchedule]
+	// clientPauses holds the end of the pause of the clients paused by
+	// hand, by address
+	clientPauses atomic.Pointer[map[string]time.Time]
+)
+
+// parseClock parses an HH:MM time into minutes
+func parseClock(v string) (int, error) {
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", v)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// normalizeAccessSchedule checks a schedule and trims it
+func normalizeAccessSchedule(s AccessSchedule) (AccessSchedule, error) {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return s, fmt.Errorf("name is required")
+	}
+	if utf8.RuneCountInString(s.Name) > maxScheduleName {
+		return s, fmt.Errorf("name is longer than %d characters", maxScheduleName)
+	}
+	if s.Group != "" && clientGroup(s.Group) == nil {
+		return s, fmt.Errorf("unknown group %q, groups are defined in clients.groups", s.Group)
+	}
+	var days []string
+	for _, d := range s.Days {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if !slices.Contains(scheduleDays, d) {
+			return s, fmt.Errorf("unknown day %q, expected one of %s", d, strings.Join(scheduleDays, ", "))
+		}
+		if !slices.Contains(days, d) {
+			days = append(days, d)
+		}
+	}
+	slices.SortFunc(days, func(a, b string) int { return slices.Index(scheduleDays, a) - slices.Index(scheduleDays, b) })
+	s.Days = days
+	from, err := parseClock(s.From)
+	if err != nil {
+		return s, fmt.Errorf("from: %v", err)
+	}
+	to, err := parseClock(s.To)
+	if err != nil {
+		return s, fmt.Errorf("to: %v", err)
+	}
+	if from == to {
+		return s, fmt.Errorf("from and to cannot be the same time")
+	}
+	s.From, s.To = fmt.Sprintf("%02d:%02d", from/60, from%60), fmt.Sprintf("%02d:%02d", to/60, to%60)
+	sources := sinkholeSources()
+	for _, source := range s.Blocklists {
+		if !slices.Contains(sources, source) {
+			return s, fmt.Errorf("unknown blocklist %q", source)
+		}
+	}
+	if len(s.Blocklists) == 0 && !s.Pause {
+		return s, fmt.Errorf("a schedule blocks blocklists or pauses the clients")
+	}
+	return s, nil
+}
+
+func compileSchedule(s AccessSchedule) (compiledSchedule, error) {
+	c := compiledSchedule{name: s.Name, group: s.Group, blocklists: s.Blocklists, pause: s.Pause}
+	var err error
+	if c.from, err = parseClock(s.From); err != nil {
+		return c, err
+	}
+	if c.to, err = parseClock(s.To); err != nil {
+		return c, err
+	}
+	for i, d := range scheduleDays {
+		c.days[i] = len(s.Days) == 0 || slices.Contains(s.Days, d)
+	}
+	return c, nil
+}
+
+// activeAt reports whether the schedule applies at t
+func (c *compiledSchedule) activeAt(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := int(t.Weekday())
+	if c.from < c.to {
+		return c.days[day] && minute >= c.from && minute < c.to
+	}
+	// Past midnight: the end of the window belongs to the day before
+	return (c.days[day] && minute >= c.from) || (c.days[(day+6)%7] && minute < c.to)
+}
+
+// activeSchedules returns the schedules applying at t to the clients of
+// group, "" for the clients without a group
+func activeSchedules(group string, t time.Time) []*compiledSchedule {
+	list := accessSchedules.Load()
+	if list == nil {
+		return nil
+	}
+	var active []*compiledSchedule
+	for i := range *list {
+		c := &(*list)[i]
+		if (c.group == "" || c.group == group) && c.activeAt(t) {
+			active = append(active, c)
+		}
+	}
+	return active
+}
+
+// scheduledBlocklists returns the sources blocking the clients of group at t
+func scheduledBlocklists(group string, t time.Time) []string {
+	var sources []string
+	for _, c := range activeSchedules(group, t) {
+		sources = append(sources, c.blocklists...)
+	}
+	return sources
+}
+
+// clientPausedUntil returns the end of the pause by hand of the client at
+// host, zero when it is not paused at t
+func clientPausedUntil(host string, t time.Time) time.Time {
+	if m := clientPauses.Load(); m != nil {
+		if until, ok := (*m)[host]; ok && until.After(t) {
+			return until
+		}
+	}
+	return time.Time{}
+}
+
+// clientPaused returns why the client at host in group is paused at t, ""
+// when it is not
+func clientPaused(host, group string, t time.Time) string {
+	if !clientPausedUntil(host, t).IsZero() {
+		return "paused"
+	}
+	for _, c := range activeSchedules(group, t) {
+		if c.pause {
+			return c.name
+		}
+	}
+	return ""
+}
+
+// loadSchedulesFromDB applies the access schedules and pauses saved from
+// the web UI
+func loadSchedulesFromDB() {
+	if database == nil {
+		return
+	}
+	list, err := database.ListAccessSchedules()
+	if err != nil {
+		slog.Error("failed to load access schedules", "error", err)
+		return
+	}
+	compiled := make([]compiledSchedule, 0, len(list))
+	for _, s := range list {
+		if !s.Enabled {
+			continue
+		}
+		c, err := compileSchedule(s.AccessSchedule)
+		if err != nil {
+			slog.Warn("invalid access schedule, ignored", "schedule", s.Name, "error", err)
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+	accessSchedules.Store(&compiled)
+
+	pauses, err := database.ListClientPauses(time.Now())
+	if err != nil {
+		slog.Error("failed to load client pauses", "error", err)
+		return
+	}
+	clientPauses.Store(&pauses)
+}
+
+// scheduleWithStatus adds whether s applies now
+func scheduleWithStatus(s DBAccessSchedule, now time.Time) DBAccessSchedule {
+	if c, err := compileSchedule(s.AccessSchedule); err == nil && s.Enabled {
+		s.Active = c.activeAt(now)
+	}
+	return s
+}
+
+// handleAPIListSchedules handles GET /api/schedules
+func handleAPIListSchedules(c *gin.Context) {
+	list, err := database.ListAccessSchedules()
+	if err != nil {
+		slog.Error("failed to list access schedules", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list schedules"})
+		return
+	}
+	now := time.Now()
+	out := make([]DBAccessSchedule, 0, len(list))
+	for _, s := range list {
+		out = append(out, scheduleWithStatus(s, now))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// handleAPICreateSchedule handles POST /api/schedules
+func handleAPICreateSchedule(c *gin.Context) {
+	var req AccessSchedule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s, err := normalizeAccessSchedule(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := database.CreateAccessSchedule(s)
+	if err != nil {
+		slog.Error("failed to create access schedule", "name", s.Name, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create schedule"})
+		return
+	}
+	loadSchedulesFromDB()
+	slog.Info("Access schedule created", "id", id, "name", s.Name, "group", s.Group, "from", s.From, "to", s.To)
+	c.JSON(http.StatusCreated, scheduleWithStatus(DBAccessSchedule{ID: id, AccessSchedule: s}, time.Now()))
+}
+
+// handleAPIUpdateSchedule handles PUT /api/schedules/:id
+func handleAPIUpdateSchedule(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid schedule id"})
+		return
+	}
+	var req AccessSchedule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s, err := normalizeAccessSchedule(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.UpdateAccessSchedule(id, s); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+			return
+		}
+		slog.Error("failed to update access schedule", "id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update schedule"})
+		return
+	}
+	loadSchedulesFromDB()
+	slog.Info("Access schedule updated", "id", id, "name", s.Name, "enabled", s.Enabled)
+	c.JSON(http.StatusOK, scheduleWithStatus(DBAccessSchedule{ID: id, AccessSchedule: s}, time.Now()))
+}
+
+// handleAPIDeleteSchedule handles DELETE /api/schedules/:id
+func handleAPIDeleteSchedule(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid schedule id"})
+		return
+	}
+	if err := database.DeleteAccessSchedule(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+			return
+		}
+		slog.Error("failed to delete access schedule", "id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete schedule"})
+		return
+	}
+	loadSchedulesFromDB()
+	slog.Info("Access schedule deleted", "id", id)
+	c.JSON(http.StatusOK, gin.H{"message": "schedule deleted"})
+}
+
+// PauseRequest pauses a client for Minutes, default 30
+type PauseRequest struct {
+	Minutes int `json:"minutes"`
+}
+
+// handleAPIPauseClient handles POST /api/clients/:address/pause
+func handleAPIPauseClient(c *gin.Context) {
+	ip := net.ParseIP(c.Param("address"))
+	if ip == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client address"})
+		return
+	}
+	var req PauseRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Minutes == 0 {
+		req.Minutes = defaultPauseMinutes
+	}
+	if req.Minutes < 0 || req.Minutes > maxPauseMinutes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("minutes must be between 1 and %d", maxPauseMinutes)})
+		return
+	}
+	address := ip.String()
+	until := time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+	if err := database.SetClientPause(address, until); err != nil {
+		slog.Error("failed to pause client", "address", address, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to pause client"})
+		return
+	}
+	loadSchedulesFromDB()
+	slog.Info("Client paused", "address", address, "until", until.Format(time.RFC3339), "user", c.GetString("username"))
+	c.JSON(http.StatusOK, clientInfo(address))
+}
+
+// handleAPIResumeClient handles DELETE /api/clients/:address/pause
+func handleAPIResumeClient(c *gin.Context) {
+	ip := net.ParseIP(c.Param("address"))
+	if ip == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client address"})
+		return
+	}
+	address := ip.String()
+	if err := database.SetClientPause(address, time.Time{}); err != nil {
+		slog.Error("failed to resume client", "address", address, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resume client"})
+		return
+	}
+	loadSchedulesFromDB()
+	slog.Info("Client resumed", "address", address, "user", c.GetString("username"))
+	c.JSON(http.StatusOK, clientInfo(address))
+}
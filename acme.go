@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/acme"
+)
+
+// ACMEConfig configures the built-in ACME client
+type ACMEConfig struct {
+	Enabled         bool     `yaml:"enabled" json:"enabled"`
+	Email           string   `yaml:"email" json:"email,omitempty"`
+	DirectoryURL    string   `yaml:"directory_url" json:"directory_url,omitempty"`
+	Domains         []string `yaml:"domains" json:"domains,omitempty"`
+	RenewBeforeDays int      `yaml:"renew_before_days" json:"renew_before_days,omitempty"`
+	// Challenge is dns-01 (default), answered from the hosted zones, or
+	// http-01, answered by the web server on port 80 of the public names
+	Challenge string `yaml:"challenge" json:"challenge,omitempty"`
+}
+
+const (
+	acmeCertName       = "acme"
+	acmeAccountKeyName = "acme_account_key"
+	acmeCheckInterval  = 12 * time.Hour
+
+	acmeChallengeDNS  = "dns-01"
+	acmeChallengeHTTP = "http-01"
+)
+
+var (
+	acmeConfig ACMEConfig
+
+	// acmeChallenges holds the pending DNS-01 TXT values keyed by lowercase FQDN
+	acmeChallenges   = make(map[string][]string)
+	acmeChallengesMu sync.RWMutex
+
+	// acmeHTTPTokens holds the pending HTTP-01 key authorizations by token
+	acmeHTTPTokens   = make(map[string]string)
+	acmeHTTPTokensMu sync.RWMutex
+
+	acmeStatus struct {
+		sync.Mutex
+		LastAttempt time.Time
+		LastError   string
+	}
+	acmeRenewMu sync.Mutex
+)
+
+// acmeChallengeRRs returns the TXT records answering a pending DNS-01 challenge
+func acmeChallengeRRs(name string) []dns.RR {
+	acmeChallengesMu.RLock()
+	defer acmeChallengesMu.RUnlock()
+
+	values := acmeChallenges[strings.ToLower(name)]
+	rrs := make([]dns.RR, 0, len(values))
+	for _, v := range values {
+		rrs = append(rrs, &dns.TXT{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 0},
+			Txt: []string{v},
+		})
+	}
+	return rrs
+}
+
+func addACMEChallenge(name, value string) {
+	acmeChallengesMu.Lock()
+	defer acmeChallengesMu.Unlock()
+	key := strings.ToLower(dns.Fqdn(name))
+	acmeChallenges[key] = append(acmeChallenges[key], value)
+}
+
+func removeACMEChallenge(name, value string) {
+	acmeChallengesMu.Lock()
+	defer acmeChallengesMu.Unlock()
+	key := strings.ToLower(dns.Fqdn(name))
+	acmeChallenges[key] = slices.DeleteFunc(acmeChallenges[key], func(v string) bool { return v == value })
+	if len(acmeChallenges[key]) == 0 {
+		delete(acmeChallenges, key)
+	}
+}
+
+// handleACMEHTTPChallenge answers a pending HTTP-01 challenge
+func handleACMEHTTPChallenge(c *gin.Context) {
+	acmeHTTPTokensMu.RLock()
+	response, ok := acmeHTTPTokens[c.Param("token")]
+	acmeHTTPTokensMu.RUnlock()
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Data(http.StatusOK, "text/plain", []byte(response))
+}
+
+// startACME loads the stored certificate and keeps it renewed in the background
+func startACME(cfg ACMEConfig) {
+	if cfg.DirectoryURL == "" {
+		cfg.DirectoryURL = acme.LetsEncryptURL
+	}
+	if cfg.RenewBeforeDays <= 0 {
+		cfg.RenewBeforeDays = 30
+	}
+	if cfg.Challenge == "" {
+		cfg.Challenge = acmeChallengeDNS
+	}
+	acmeConfig = cfg
+
+	if database == nil {
+		slog.Warn("ACME requires sqlite mode to store keys and certificates, disabled")
+		return
+	}
+	if len(cfg.Domains) == 0 {
+		slog.Warn("ACME enabled without domains, disabled")
+		return
+	}
+
+	switch cfg.Challenge {
+	case acmeChallengeDNS:
+		zd := zoneStore.Load()
+		for _, d := range cfg.Domains {
+			if zd.FindZone(dns.Fqdn(strings.TrimPrefix(d, "*."))) == "" {
+				slog.Warn("ACME domain is not inside a hosted zone, DNS-01 validation will fail unless it is delegated here", "domain", d)
+			}
+		}
+	case acmeChallengeHTTP:
+		for _, d := range cfg.Domains {
+			if strings.HasPrefix(d, "*.") {
+				slog.Warn("ACME http-01 cannot validate wildcard domains, disabled", "domain", d)
+				acmeConfig.Enabled = false
+				return
+			}
+		}
+	default:
+		slog.Warn("ACME challenge must be dns-01 or http-01, disabled", "challenge", cfg.Challenge)
+		acmeConfig.Enabled = false
+		return
+	}
+
+	if stored, err := database.GetCertificate(acmeCertName); err == nil {
+		if cert, err := parseCertificatePEM([]byte(stored.CertPEM), []byte(stored.KeyPEM)); err == nil {
+			serverCert.Set(cert)
+			slog.Info("Loaded ACME certificate", "domains", cert.Leaf.DNSNames, "not_after", cert.Leaf.NotAfter)
+		} else {
+			slog.Warn("stored ACME certificate is invalid", "error", err)
+		}
+	}
+
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			if err := acmeRenewIfNeeded(ctx, false); err != nil {
+				slog.Error("ACME certificate renewal failed", "error", err)
+			}
+			cancel()
+			time.Sleep(acmeCheckInterval)
+		}
+	}()
+}
+
+// acmeRenewIfNeeded obtains a new certificate when none is loaded, the
+// configured domains changed, or expiry is within RenewBeforeDays
+func acmeRenewIfNeeded(ctx context.Context, force bool) error {
+	acmeRenewMu.Lock()
+	defer acmeRenewMu.Unlock()
+
+	if !force && !acmeNeedsRenewal() {
+		return nil
+	}
+
+	err := acmeObtainCertificate(ctx)
+
+	acmeStatus.Lock()
+	acmeStatus.LastAttempt = time.Now()
+	acmeStatus.LastError = ""
+	if err != nil {
+		acmeStatus.LastError = err.Error()
+	}
+	acmeStatus.Unlock()
+
+	domains := strings.Join(acmeConfig.Domains, ", ")
+	if err != nil {
+		raiseAlert(alertCertificate, "acme renewal", "ACME certificate renewal failing",
+			fmt.Sprintf("The certificate of %s cannot be renewed:\n%v", domains, err))
+	} else {
+		resolveAlert(alertCertificate, "acme renewal", "ACME certificate renewed",
+			fmt.Sprintf("The certificate of %s was renewed.", domains))
+	}
+	return err
+}
+
+func acmeNeedsRenewal() bool {
+	cert := serverCert.Get()
+	if cert == nil || cert.Leaf == nil {
+		return true
+	}
+	have := slices.Clone(cert.Leaf.DNSNames)
+	want := slices.Clone(acmeConfig.Domains)
+	sort.Strings(have)
+	sort.Strings(want)
+	if !slices.Equal(have, want) {
+		return true
+	}
+	renewAt := cert.Leaf.NotAfter.Add(-time.Duration(acmeConfig.RenewBeforeDays) * 24 * time.Hour)
+	return time.Now().After(renewAt)
+}
+
+// acmeObtainCertificate runs a full ACME order using DNS-01 challenges
+// answered from the hosted zones or HTTP-01 ones answered by the web
+// server, then stores and activates the certificate
+func acmeObtainCertificate(ctx context.Context) error {
+	accountKey, err := acmeAccountKey()
+	if err != nil {
+		return fmt.Errorf("account key: %w", err)
+	}
+
+	client := &acme.Client{Key: accountKey, DirectoryURL: acmeConfig.DirectoryURL}
+	account := &acme.Account{}
+	if acmeConfig.Email != "" {
+		account.Contact = []string{"mailto:" + acmeConfig.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("register account: %w", err)
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(acmeConfig.Domains...))
+	if err != nil {
+		return fmt.Errorf("create order: %w", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := acmeAuthorize(ctx, client, authzURL); err != nil {
+			return err
+		}
+	}
+
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return fmt.Errorf("wait order: %w", err)
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: acmeConfig.Domains}, certKey)
+	if err != nil {
+		return err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("finalize order: %w", err)
+	}
+
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(certKey)
+	if err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	cert, err := parseCertificatePEM(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("parse issued certificate: %w", err)
+	}
+	if err := database.SaveCertificate(&DBCertificate{
+		Name:     acmeCertName,
+		CertPEM:  string(certPEM),
+		KeyPEM:   string(keyPEM),
+		NotAfter: cert.Leaf.NotAfter,
+	}); err != nil {
+		return fmt.Errorf("store certificate: %w", err)
+	}
+
+	serverCert.Set(cert)
+	slog.Info("ACME certificate issued", "domains", cert.Leaf.DNSNames, "not_after", cert.Leaf.NotAfter)
+	return nil
+}
+
+// acmeAuthorize completes one authorization with the configured challenge
+func acmeAuthorize(ctx context.Context, client *acme.Client, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == acmeConfig.Challenge {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no %s challenge offered for %s", acmeConfig.Challenge, authz.Identifier.Value)
+	}
+
+	if chal.Type == acmeChallengeHTTP {
+		response, err := client.HTTP01ChallengeResponse(chal.Token)
+		if err != nil {
+			return err
+		}
+		acmeHTTPTokensMu.Lock()
+		acmeHTTPTokens[chal.Token] = response
+		acmeHTTPTokensMu.Unlock()
+		defer func() {
+			acmeHTTPTokensMu.Lock()
+			delete(acmeHTTPTokens, chal.Token)
+			acmeHTTPTokensMu.Unlock()
+		}()
+	} else {
+		value, err := client.DNS01ChallengeRecord(chal.Token)
+		if err != nil {
+			return err
+		}
+		recordName := "_acme-challenge." + authz.Identifier.Value
+		addACMEChallenge(recordName, value)
+		defer removeACMEChallenge(recordName, value)
+	}
+
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("accept challenge for %s: %w", authz.Identifier.Value, err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorization for %s: %w", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+// acmeAccountKey loads the ACME account key from the database, creating it
+// on first use
+func acmeAccountKey() (crypto.Signer, error) {
+	if keyPEM, err := database.GetConfig(acmeAccountKeyName); err == nil {
+		block, _ := pem.Decode([]byte(keyPEM))
+		if block == nil {
+			return nil, fmt.Errorf("invalid stored account key")
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.SetConfig(acmeAccountKeyName, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Certificate API handlers
+
+func handleAPICertificateStatus(c *gin.Context) {
+	acmeStatus.Lock()
+	lastAttempt, lastError := acmeStatus.LastAttempt, acmeStatus.LastError
+	acmeStatus.Unlock()
+
+	status := gin.H{
+		"acme_enabled": acmeConfig.Enabled,
+		"domains":      acmeConfig.Domains,
+		"last_error":   lastError,
+	}
+	if !lastAttempt.IsZero() {
+		status["last_attempt"] = lastAttempt
+	}
+	if cert := serverCert.Get(); cert != nil && cert.Leaf != nil {
+		status["certificate"] = gin.H{
+			"dns_names":  cert.Leaf.DNSNames,
+			"issuer":     cert.Leaf.Issuer.String(),
+			"not_before": cert.Leaf.NotBefore,
+			"not_after":  cert.Leaf.NotAfter,
+		}
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+func handleAPIRenewCertificate(c *gin.Context) {
+	if !acmeConfig.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ACME is not enabled"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
+	defer cancel()
+	if err := acmeRenewIfNeeded(ctx, true); err != nil {
+		slog.Error("ACME certificate renewal failed", "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	handleAPICertificateStatus(c)
+}
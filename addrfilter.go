@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// AddressFilterRule hides one address type from some clients, typically
+// AAAA on networks with broken IPv6
+type AddressFilterRule struct {
+	// Clients lists the networks (addresses or CIDR prefixes) of the rule
+	Clients []string `yaml:"clients" json:"clients"`
+	Type    string   `yaml:"type" json:"type"` // AAAA or A
+}
+
+// addressFilterConfigKey stores the rules set in the web UI, which take
+// precedence over address_filter from the config file
+const addressFilterConfigKey = "address_filter"
+
+type addressFilter struct {
+	clients []*net.IPNet
+	qtype   uint16
+}
+
+// addressFilterSet is the rules in effect, as configured and compiled
+type addressFilterSet struct {
+	rules    []AddressFilterRule
+	compiled []addressFilter
+}
+
+var addressFilters atomic.Pointer[addressFilterSet]
+
+// parseAddressFilterType parses AAAA or A, or "" for no filtering
+func parseAddressFilterType(s string) (uint16, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "":
+		return 0, nil
+	case "AAAA":
+		return dns.TypeAAAA, nil
+	case "A":
+		return dns.TypeA, nil
+	}
+	return 0, fmt.Errorf("address filter must be AAAA or A, not %q", s)
+}
+
+func compileAddressFilters(rules []AddressFilterRule) ([]addressFilter, error) {
+	out := make([]addressFilter, 0, len(rules))
+	for _, rule := range rules {
+		qtype, err := parseAddressFilterType(rule.Type)
+		if err != nil {
+			return nil, err
+		}
+		if qtype == 0 {
+			return nil, fmt.Errorf("address filter rule for %v has no type", rule.Clients)
+		}
+		if len(rule.Clients) == 0 {
+			return nil, fmt.Errorf("address filter rule %s has no clients", rule.Type)
+		}
+		clients, err := parseAllowTransfer(rule.Clients)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, addressFilter{clients: clients, qtype: qtype})
+	}
+	return out, nil
+}
+
+// setAddressFilters replaces the client rules
+func setAddressFilters(rules []AddressFilterRule) error {
+	compiled, err := compileAddressFilters(rules)
+	if err != nil {
+		return err
+	}
+	addressFilters.Store(&addressFilterSet{rules: rules, compiled: compiled})
+	return nil
+}
+
+// loadAddressFiltersFromDB applies the rules saved from the web UI
+func loadAddressFiltersFromDB() {
+	if database == nil {
+		return
+	}
+	v, err := database.GetConfig(addressFilterConfigKey)
+	if err != nil || v == "" {
+		return
+	}
+	var rules []AddressFilterRule
+	if err := json.Unmarshal([]byte(v), &rules); err != nil {
+		slog.Error("invalid address filter rules in database", "error", err)
+		return
+	}
+	if err := setAddressFilters(rules); err != nil {
+		slog.Error("invalid address filter rules in database", "error", err)
+	}
+}
+
+// addressFilterFor returns the address type hidden from the client for
+// name: the first client rule matching addr, else the setting of the zone
+// of name, 0 for none
+func addressFilterFor(addr net.Addr, name string) uint16 {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	}
+	if set := addressFilters.Load(); set != nil && ip != nil {
+		for _, rule := range set.compiled {
+			for _, n := range rule.clients {
+				if n.Contains(ip) {
+					return rule.qtype
+				}
+			}
+		}
+	}
+	return zoneStore.Load().AddressFilter(name)
+}
+
+// withAddressFilter wraps a DNS handler: the filtered address type is
+// removed from the answer when the name also has the other type, so
+// clients fall back to it instead of trying a broken network (the name
+// stays reachable when it only has the filtered type). Signed answers
+// asked with DO are left alone since removing records breaks them.
+func withAddressFilter(next dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		if len(r.Question) != 1 {
+			next(w, r)
+			return
+		}
+		q := r.Question[0]
+		if q.Qtype != dns.TypeA && q.Qtype != dns.TypeAAAA && q.Qtype != dns.TypeANY {
+			next(w, r)
+			return
+		}
+		filtered := addressFilterFor(w.RemoteAddr(), q.Name)
+		if filtered == 0 || (q.Qtype != dns.TypeANY && q.Qtype != filtered) {
+			next(w, r)
+			return
+		}
+		if opt := r.IsEdns0(); opt != nil && opt.Do() {
+			next(w, r)
+			return
+		}
+
+		rec := &dns64Writer{ResponseWriter: w}
+		next(rec, r)
+		resp := rec.msg
+		if resp == nil {
+			return
+		}
+		other := dns.TypeA
+		if filtered == dns.TypeA {
+			other = dns.TypeAAAA
+		}
+		if hasType(resp.Answer, filtered) {
+			keep := hasType(resp.Answer, other)
+			if !keep {
+				otherReq := r.Copy()
+				otherReq.Question[0].Qtype = other
+				otherRec := &dns64Writer{ResponseWriter: w}
+				next(otherRec, otherReq)
+				keep = otherRec.msg != nil && otherRec.msg.Rcode == dns.RcodeSuccess && hasType(otherRec.msg.Answer, other)
+			}
+			if keep {
+				resp.Answer = withoutType(resp.Answer, filtered)
+			}
+		}
+		resp.Extra = withoutType(resp.Extra, filtered)
+		_ = w.WriteMsg(resp)
+	}
+}
+
+func hasType(rrs []dns.RR, qtype uint16) bool {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == qtype {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutType(rrs []dns.RR, qtype uint16) []dns.RR {
+	out := rrs[:0:0]
+	for _, rr := range rrs {
+		if rr.Header().Rrtype != qtype {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+// handleAPIGetAddressFilter handles GET /api/address-filter
+func handleAPIGetAddressFilter(c *gin.Context) {
+	rules := []AddressFilterRule{}
+	if set := addressFilters.Load(); set != nil && set.rules != nil {
+		rules = set.rules
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// handleAPISetAddressFilter handles PUT /api/address-filter
+func handleAPISetAddressFilter(c *gin.Context) {
+	var rules []AddressFilterRule
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range rules {
+		rules[i].Type = strings.ToUpper(strings.TrimSpace(rules[i].Type))
+	}
+	if _, err := compileAddressFilters(rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, _ := json.Marshal(rules)
+	if err := database.SetConfig(addressFilterConfigKey, string(data)); err != nil {
+		slog.Error("failed to save address filter rules", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save address filter rules"})
+		return
+	}
+	_ = setAddressFilters(rules)
+
+	slog.Info("Address filter rules updated", "rules", len(rules), "user", c.GetString("username"))
+	c.JSON(http.StatusOK, rules)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Problems the operators must hear about without watching the logs are
+// emailed to the alert recipients: a failing zone transfer or NOTIFY, a
+// forwarder that stopped answering, a blocklist that cannot be fetched, a
+// certificate close to expiry or that cannot be renewed, and the change of
+// a password. An ongoing problem is emailed again every repeat_hours, and
+// once more when it is resolved.
+
+// Alert events, as listed in alerts.events
+const (
+	alertReplication = "replication"
+	alertForwarder   = "forwarder"
+	alertBlocklist   = "blocklist"
+	alertCertificate = "certificate"
+	alertPassword    = "password"
+)
+
+var alertEvents = []string{alertReplication, alertForwarder, alertBlocklist, alertCertificate, alertPassword}
+
+// defaultAlertRepeat is the default of alerts.repeat_hours
+const defaultAlertRepeat = 24 * time.Hour
+
+// forwarderOutageFailures is the number of failed attempts in a row after
+// which a forwarder is reported down
+const forwarderOutageFailures = 10
+
+// SMTPConfig is the mail server the alerts and zone review reminders are
+// sent through
+type SMTPConfig struct {
+	Address  string `yaml:"address" json:"address,omitempty"` // host:port, STARTTLS when offered
+	Username string `yaml:"username" json:"username,omitempty"`
+	Password string `yaml:"password" json:"-"`
+	From     string `yaml:"from" json:"from,omitempty"`
+}
+
+// AlertsConfig selects the events emailed and their recipients
+type AlertsConfig struct {
+	To          []string `yaml:"to" json:"to,omitempty"`
+	Events      []string `yaml:"events" json:"events,omitempty"`             // default all
+	RepeatHours int      `yaml:"repeat_hours" json:"repeat_hours,omitempty"` // default 24
+}
+
+var (
+	smtpConfig   SMTPConfig
+	alertsConfig AlertsConfig
+	alertRepeat  = defaultAlertRepeat
+
+	// alertsMu guards alertsRaised, the time each ongoing problem was last
+	// emailed, by key
+	alertsMu     sync.Mutex
+	alertsRaised = map[string]time.Time{}
+)
+
+// validSMTP checks the smtp settings
+func validSMTP(cfg SMTPConfig) error {
+	if cfg.Address == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+		return fmt.Errorf("address: %v", err)
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return fmt.Errorf("from: %v", err)
+	}
+	return nil
+}
+
+// validAlerts checks the alerts settings
+func validAlerts(cfg AlertsConfig, smtpCfg SMTPConfig) error {
+	if len(cfg.To) > 0 && smtpCfg.Address == "" {
+		return fmt.Errorf("to needs smtp.address")
+	}
+	if err := validEmailAddresses(cfg.To); err != nil {
+		return fmt.Errorf("to %v", err)
+	}
+	for _, e := range cfg.Events {
+		if !slices.Contains(alertEvents, e) {
+			return fmt.Errorf("unknown event %q, expected one of %s", e, strings.Join(alertEvents, ", "))
+		}
+	}
+	if cfg.RepeatHours < 0 {
+		return fmt.Errorf("repeat_hours cannot be negative")
+	}
+	return nil
+}
+
+// validEmailAddresses checks a list of recipients
+func validEmailAddresses(list []string) error {
+	for _, a := range list {
+		if _, err := mail.ParseAddress(a); err != nil {
+			return fmt.Errorf("%q: %v", a, err)
+		}
+	}
+	return nil
+}
+
+func initAlerts(smtpCfg SMTPConfig, cfg AlertsConfig) {
+	if err := validSMTP(smtpCfg); err != nil {
+		slog.Error("invalid smtp, emails disabled", "error", err)
+		return
+	}
+	smtpConfig = smtpCfg
+	if err := validAlerts(cfg, smtpCfg); err != nil {
+		slog.Error("invalid alerts, alerts disabled", "error", err)
+		return
+	}
+	alertsConfig = cfg
+	if cfg.RepeatHours > 0 {
+		alertRepeat = time.Duration(cfg.RepeatHours) * time.Hour
+	}
+	if len(cfg.To) > 0 {
+		slog.Info("Emailing alerts", "to", cfg.To, "events", alertEnabledEvents())
+	}
+}
+
+// alertEnabledEvents returns the events emailed
+func alertEnabledEvents() []string {
+	if len(alertsConfig.Events) == 0 {
+		return alertEvents
+	}
+	return alertsConfig.Events
+}
+
+func alertEnabled(event string) bool {
+	return len(alertsConfig.To) > 0 && slices.Contains(alertEnabledEvents(), event)
+}
+
+// sendMail emails a plain text message through the smtp server
+func sendMail(to []string, subject, body string) error {
+	if smtpConfig.Address == "" {
+		return fmt.Errorf("no smtp server configured")
+	}
+	from, err := mail.ParseAddress(smtpConfig.From)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if smtpConfig.Username != "" {
+		host, _, _ := net.SplitHostPort(smtpConfig.Address)
+		auth = smtp.PlainAuth("", smtpConfig.Username, smtpConfig.Password, host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", smtpConfig.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.TrimRight(body, "\n"), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+	if instanceName != "" {
+		fmt.Fprintf(&msg, "\r\n-- \r\nSent by %s\r\n", instanceName)
+	}
+	return smtp.SendMail(smtpConfig.Address, auth, from.Address, to, msg.Bytes())
+}
+
+// emailAlert sends an alert in the background
+func emailAlert(event, subject, body string) {
+	to := slices.Clone(alertsConfig.To)
+	go func() {
+		if err := sendMail(to, "[simpledns] "+subject, body); err != nil {
+			slog.Warn("failed to email alert", "event", event, "subject", subject, "error", err)
+		}
+	}()
+}
+
+// raiseAlert emails the problem identified by key, unless it was already
+// emailed within alerts.repeat_hours
+func raiseAlert(event, key, subject, body string) {
+	if !alertEnabled(event) {
+		return
+	}
+	alertsMu.Lock()
+	last, ok := alertsRaised[key]
+	if ok && time.Since(last) < alertRepeat {
+		alertsMu.Unlock()
+		return
+	}
+	alertsRaised[key] = time.Now()
+	alertsMu.Unlock()
+	emailAlert(event, subject, body)
+}
+
+// resolveAlert emails that the problem identified by key is over, when it
+// was raised
+func resolveAlert(event, key, subject, body string) {
+	alertsMu.Lock()
+	_, ok := alertsRaised[key]
+	delete(alertsRaised, key)
+	alertsMu.Unlock()
+	if ok && alertEnabled(event) {
+		emailAlert(event, subject, body)
+	}
+}
+
+// notifyEvent emails an event that is not a problem that lasts, such as a
+// password change: each one is sent
+func notifyEvent(event, subject, body string) {
+	if alertEnabled(event) {
+		emailAlert(event, subject, body)
+	}
+}
+
+// handleAPITestAlert handles POST /api/alerts/test: it emails the alert
+// recipients at once, to check the smtp settings
+func handleAPITestAlert(c *gin.Context) {
+	if len(alertsConfig.To) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no alert recipients configured (alerts.to)"})
+		return
+	}
+	body := fmt.Sprintf("This test alert was requested by %s.\nAlerts are emailed for: %s.", c.GetString("username"), strings.Join(alertEnabledEvents(), ", "))
+	if err := sendMail(alertsConfig.To, "[simpledns] Test alert", body); err != nil {
+		slog.Warn("failed to email test alert", "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sent_to": alertsConfig.To})
+}
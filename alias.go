@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/miekg/dns"
+)
+
+// ALIAS records (also called ANAME) point a name to a host name like a
+// CNAME, but the server answers the A and AAAA queries of the name itself
+// with the addresses of the target, resolved at query time. Unlike a CNAME,
+// an ALIAS can sit at the zone apex next to the SOA, NS and MX records.
+
+// TypeALIAS is the type code PowerDNS uses for ALIAS records, in the
+// private use range
+const TypeALIAS uint16 = 65401
+
+// maxAliasDepth bounds the chain of ALIAS and CNAME records followed to
+// reach the addresses of a target
+const maxAliasDepth = 8
+
+func init() {
+	dns.PrivateHandle("ALIAS", TypeALIAS, func() dns.PrivateRdata { return new(aliasRdata) })
+}
+
+// aliasRdata is the data of an ALIAS record: the target host name
+type aliasRdata struct {
+	Target string
+}
+
+func (a *aliasRdata) String() string { return a.Target }
+
+func (a *aliasRdata) Parse(txt []string) error {
+	if len(txt) != 1 {
+		return fmt.Errorf("ALIAS needs a single target name")
+	}
+	target := dns.Fqdn(txt[0])
+	if _, ok := dns.IsDomainName(target); !ok {
+		return fmt.Errorf("invalid ALIAS target %q", txt[0])
+	}
+	a.Target = target
+	return nil
+}
+
+func (a *aliasRdata) Pack(buf []byte) (int, error) {
+	return dns.PackDomainName(a.Target, buf, 0, nil, false)
+}
+
+func (a *aliasRdata) Unpack(buf []byte) (int, error) {
+	target, off, err := dns.UnpackDomainName(buf, 0)
+	if err != nil {
+		return off, err
+	}
+	a.Target = target
+	return off, nil
+}
+
+func (a *aliasRdata) Copy(dest dns.PrivateRdata) error {
+	d, ok := dest.(*aliasRdata)
+	if !ok {
+		return dns.ErrRdata
+	}
+	d.Target = a.Target
+	return nil
+}
+
+func (a *aliasRdata) Len() int {
+	buf := make([]byte, 256)
+	n, err := a.Pack(buf)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// aliasTarget returns the target of an ALIAS record, "" for other records
+func aliasTarget(rr dns.RR) string {
+	if p, ok := rr.(*dns.PrivateRR); ok {
+		if a, ok := p.Data.(*aliasRdata); ok {
+			return a.Target
+		}
+	}
+	return ""
+}
+
+// withoutAliases drops the ALIAS records of rrs for ANY answers: clients
+// get the flattened addresses instead, the ALIAS itself only when they ask
+// for its type
+func withoutAliases(rrs []dns.RR) []dns.RR {
+	for i, rr := range rrs {
+		if rr.Header().Rrtype == TypeALIAS {
+			out := append([]dns.RR(nil), rrs[:i]...)
+			for _, rr := range rrs[i+1:] {
+				if rr.Header().Rrtype != TypeALIAS {
+					out = append(out, rr)
+				}
+			}
+			return out
+		}
+	}
+	return rrs
+}
+
+// resolveAlias returns the qtype records of the target of alias renamed to
+// its owner, with the TTL capped by the one of the ALIAS. CNAME and ALIAS
+// chains through the local zones are followed in zd, the final target is
+// resolved like any query of a client (local zones, hosts files, cache and
+// forwarders). ok is false when the target could not be resolved.
+func resolveAlias(w dns.ResponseWriter, r *dns.Msg, zd *ZoneData, alias dns.RR) (rrs []dns.RR, ok bool) {
+	qtype := r.Question[0].Qtype
+	target := aliasTarget(alias)
+	for range maxAliasDepth {
+		if res := zd.Resolve(target); serveZone(res.Zone) {
+			if cnames := res.Answers(dns.TypeCNAME); len(cnames) > 0 {
+				target = cnames[0].(*dns.CNAME).Target
+				continue
+			}
+			if aliases := res.Answers(TypeALIAS); len(aliases) > 0 && len(res.Answers(qtype)) == 0 {
+				target = aliasTarget(aliases[0])
+				continue
+			}
+		}
+		req := r.Copy()
+		req.Question[0].Name = target
+		rec := &captureWriter{ResponseWriter: w}
+		handleDNS(rec, req)
+		if rec.msg == nil {
+			return nil, false
+		}
+		switch rec.msg.Rcode {
+		case dns.RcodeSuccess, dns.RcodeNameError:
+		default:
+			return nil, false
+		}
+		for _, rr := range rec.msg.Answer {
+			if rr.Header().Rrtype != qtype {
+				continue
+			}
+			flat := dns.Copy(rr)
+			flat.Header().Name = alias.Header().Name
+			flat.Header().Ttl = min(flat.Header().Ttl, alias.Header().Ttl)
+			rrs = append(rrs, flat)
+		}
+		return rrs, true
+	}
+	slog.Warn("alias chain too long", "name", alias.Header().Name, "target", aliasTarget(alias))
+	return nil, false
+}
+
+// answerAlias answers an A or AAAA query for a name holding an ALIAS with
+// the addresses of its target, SERVFAIL when they could not be resolved
+func answerAlias(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg, zd *ZoneData, alias dns.RR) {
+	name := r.Question[0].Name
+	rrs, ok := resolveAlias(w, r, zd, alias)
+	if !ok {
+		m.Rcode = dns.RcodeServerFailure
+		if err := w.WriteMsg(m); err != nil {
+			slog.Debug("failed to write SERVFAIL", "client", w.RemoteAddr(), "error", err)
+		}
+		slog.Debug("Alias target unresolved, sent SERVFAIL", "name", name, "target", aliasTarget(alias), "client", w.RemoteAddr())
+		return
+	}
+	m.Answer = rrs
+	if err := w.WriteMsg(m); err != nil {
+		slog.Warn("Failed to send reply", "name", name, "client", w.RemoteAddr(), "error", err)
+	} else {
+		slog.Info("Replied with alias addresses", "name", name, "target", aliasTarget(alias), "client", w.RemoteAddr(), "answers", len(rrs))
+	}
+}
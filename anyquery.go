@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/miekg/dns"
+)
+
+// ANY response modes (RFC 8482)
+const (
+	anyModeHINFO = "hinfo" // synthesized HINFO "RFC8482" record
+	anyModeRRset = "rrset" // a single RRset from the name
+	anyModeFull  = "full"  // every record (legacy behaviour)
+)
+
+// anyResponseMode controls how ANY queries over UDP are answered.
+// TCP queries always get the full answer, since they cannot be used
+// for reflection.
+var anyResponseMode = anyModeHINFO
+
+// anyPreference lists the RRset types preferred when answering ANY with a
+// single RRset; the first type present wins
+var anyPreference = []uint16{
+	dns.TypeA, dns.TypeAAAA, dns.TypeCNAME, dns.TypeMX, dns.TypeTXT, dns.TypeNS, dns.TypeSOA,
+}
+
+// minimizeANY reduces an ANY answer according to anyResponseMode
+func minimizeANY(name string, answers []dns.RR) []dns.RR {
+	switch anyResponseMode {
+	case anyModeFull:
+		return answers
+	case anyModeRRset:
+		for _, t := range anyPreference {
+			if rrset := filterRRs(answers, t); len(rrset) > 0 {
+				return rrset
+			}
+		}
+		return filterRRs(answers, answers[0].Header().Rrtype)
+	default:
+		return []dns.RR{&dns.HINFO{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeHINFO, Class: dns.ClassINET, Ttl: 3789},
+			Cpu: "RFC8482",
+			Os:  "",
+		}}
+	}
+}
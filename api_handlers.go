@@ -1,14 +1,20 @@
 package main
 
 import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"log/slog"
 
 	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
 )
 
 // API request/response types
@@ -22,6 +28,19 @@ type CreateZoneRequest struct {
 	Refresh int    `json:"refresh"`
 	Retry   int    `json:"retry"`
 	Expire  int    `json:"expire"`
+	Minimum int    `json:"minimum"`
+	// NSAddress is the glue of an NS name inside the zone, e.g.
+	// "192.168.1.2,fd00::2"
+	NSAddress string `json:"ns_address"`
+	// Type is "primary" (the default), "forward", with the forwarders
+	// of the zone, e.g. "10.0.0.53,10.0.1.53:5353", or "secondary", with
+	// the primaries the zone is transferred from
+	Type       string `json:"type"`
+	Forwarders string `json:"forwarders"`
+	Primaries  string `json:"primaries"`
+	// AddressFilter hides AAAA or A answers for names that have the other
+	// type, "" for none; an update keeps the current value when absent
+	AddressFilter *string `json:"address_filter"`
 }
 
 type CreateRecordRequest struct {
@@ -30,11 +49,25 @@ type CreateRecordRequest struct {
 	Value    string `json:"value" binding:"required"`
 	TTL      int    `json:"ttl"`
 	Priority int    `json:"priority"`
+	RecordSchedule
+	RecordNotes
+	RecordCaching
 }
 
 type CreateForwarderRequest struct {
 	Address  string `json:"address" binding:"required"`
 	Priority int    `json:"priority"`
+	UpstreamOptions
+}
+
+// UpdateForwarderRequest changes the priority and options of a forwarder
+type UpdateForwarderRequest struct {
+	Priority *int `json:"priority"` // unchanged when absent
+	UpstreamOptions
+}
+
+type CreateTokenRequest struct {
+	Name string `json:"name"`
 }
 
 // Zone handlers
@@ -47,15 +80,23 @@ func handleAPICreateZone(c *gin.Context) {
 	}
 
 	zone := &DBZone{
-		Name:    req.Name,
-		Enabled: true,
-		TTL:     req.TTL,
-		NS:      req.NS,
-		Admin:   req.Admin,
-		Serial:  1,
-		Refresh: req.Refresh,
-		Retry:   req.Retry,
-		Expire:  req.Expire,
+		Name:       req.Name,
+		Enabled:    true,
+		TTL:        req.TTL,
+		NS:         req.NS,
+		Admin:      req.Admin,
+		Serial:     initialSerial(),
+		Refresh:    req.Refresh,
+		Retry:      req.Retry,
+		Expire:     req.Expire,
+		Minimum:    req.Minimum,
+		NSAddress:  req.NSAddress,
+		Type:       req.Type,
+		Forwarders: req.Forwarders,
+		Primaries:  req.Primaries,
+	}
+	if req.AddressFilter != nil {
+		zone.AddressFilter = *req.AddressFilter
 	}
 
 	// Set defaults
@@ -80,6 +121,13 @@ func handleAPICreateZone(c *gin.Context) {
 	if zone.Expire == 0 {
 		zone.Expire = 86400
 	}
+	if zone.Minimum == 0 {
+		zone.Minimum = 3600
+	}
+	if err := normalizeZoneSettings(zone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err := database.CreateZone(zone); err != nil {
 		// Check if it's a unique constraint violation (zone already exists)
@@ -97,8 +145,13 @@ func handleAPICreateZone(c *gin.Context) {
 	if err := LoadZonesFromDB(); err != nil {
 		slog.Error("failed to reload zones", "error", err)
 	}
+	// A secondary zone is transferred from its primaries right away
+	if zone.Type == zoneTypeSecondary {
+		scheduleSecondaryZone(zone.ID, time.Time{})
+	}
 
 	slog.Info("Zone created", "name", zone.Name, "id", zone.ID)
+	setETag(c, zone.Version)
 	c.JSON(http.StatusCreated, zone)
 }
 
@@ -119,36 +172,135 @@ func handleAPIGetZone(c *gin.Context) {
 	// Get records for this zone
 	records, _ := database.ListRecordsByZone(id)
 
+	setETag(c, zone.Version)
 	c.JSON(http.StatusOK, gin.H{
 		"zone":    zone,
 		"records": records,
 	})
 }
 
-func handleAPIListZones(c *gin.Context) {
-	zones, err := database.ListZones()
+// WireRR shows one record as converted for serving
+type WireRR struct {
+	RecordID     int64  `json:"record_id,omitempty"` // 0 for the SOA/NS and signed zone material
+	Source       string `json:"source"`              // DB value the RR was built from
+	Presentation string `json:"presentation,omitempty"`
+	Wire         string `json:"wire,omitempty"` // uncompressed wire format, hex
+	WireLength   int    `json:"wire_length,omitempty"`
+	Served       bool   `json:"served"` // present in the live zone data
+	Error        string `json:"error,omitempty"`
+}
+
+// packRRHex returns the uncompressed wire encoding of rr in hex
+func packRRHex(rr dns.RR) (string, int, error) {
+	buf := make([]byte, dns.Len(rr))
+	off, err := dns.PackRR(rr, buf, 0, nil, false)
 	if err != nil {
-		slog.Error("failed to list zones", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list zones"})
+		return "", 0, err
+	}
+	return hex.EncodeToString(buf[:off]), off, nil
+}
+
+func wireRR(rr dns.RR, live []dns.RR) WireRR {
+	w := WireRR{Presentation: rr.String()}
+	var err error
+	if w.Wire, w.WireLength, err = packRRHex(rr); err != nil {
+		w.Error = err.Error()
+	}
+	for _, l := range live {
+		if dns.IsDuplicate(rr, l) {
+			w.Served = true
+			break
+		}
+	}
+	return w
+}
+
+// handleAPIGetZoneWire shows every record of a zone the way handleDNS serves
+// it: the RR built from each DB row (or why it could not be built), its wire
+// encoding, and whether the live zone data actually contains it
+func handleAPIGetZoneWire(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone id"})
+		return
+	}
+
+	zone, err := database.GetZone(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
 		return
 	}
+	records, err := database.ListRecordsByZone(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	zoneName := dns.Fqdn(zone.Name)
+	zd := zoneStore.Load()
+	var live []dns.RR
+	zd.Each(func(name string, rrs []dns.RR) {
+		if zd.FindZone(name) == zoneName {
+			live = append(live, rrs...)
+		}
+	})
+
+	rrs := make([]WireRR, 0, len(records)+2)
+	for _, rr := range zoneApexRRs(*zone) {
+		w := wireRR(rr, live)
+		w.Source = "zone settings"
+		rrs = append(rrs, w)
+	}
+	for _, rr := range loadSignedRRs(id) {
+		w := wireRR(rr, live)
+		w.Source = "signed zone import"
+		rrs = append(rrs, w)
+	}
+	for _, record := range records {
+		source := fmt.Sprintf("%s %d %s %s", record.Name, record.TTL, record.Type, record.Value)
+		rr, err := recordToRR(zoneName, record)
+		if err != nil {
+			rrs = append(rrs, WireRR{RecordID: record.ID, Source: source, Error: err.Error()})
+			continue
+		}
+		w := wireRR(rr, live)
+		w.RecordID = record.ID
+		w.Source = source
+		rrs = append(rrs, w)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"zone":    zoneName,
+		"enabled": zone.Enabled,
+		"loaded":  slices.Contains(zd.ZoneNames(), zoneName),
+		"rrs":     rrs,
+	})
+}
+
+// zoneSorts are the sort keys of GET /api/zones
+var zoneSorts = map[string]string{"name": "z.name", "records": "record_count", "serial": "z.serial", "id": "z.id"}
+
+// recordSorts are the sort keys of GET /api/zones/:id/records
+var recordSorts = map[string]string{"type": "type, name", "name": "name", "value": "value", "ttl": "ttl", "id": "id"}
 
-	// Include record count for each zone
-	type ZoneWithCount struct {
-		DBZone
-		RecordCount int `json:"record_count"`
+// handleAPIListZones handles GET /api/zones?limit=&offset=&sort=&name=&type=
+func handleAPIListZones(c *gin.Context) {
+	q, err := parseListQuery(c, zoneSorts, "name", "records", "serial", "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	result := make([]ZoneWithCount, 0, len(zones))
-	for _, z := range zones {
-		records, _ := database.ListRecordsByZone(z.ID)
-		result = append(result, ZoneWithCount{
-			DBZone:      z,
-			RecordCount: len(records),
-		})
+	zones, total, err := database.ListZonesPage(q)
+	if err != nil {
+		slog.Error("failed to list zones", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list zones"})
+		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	setTotalCount(c, total)
+	c.JSON(http.StatusOK, zones)
 }
 
 func handleAPIUpdateZone(c *gin.Context) {
@@ -166,22 +318,64 @@ func handleAPIUpdateZone(c *gin.Context) {
 	}
 
 	zone := &DBZone{
-		ID:      id,
-		Name:    req.Name,
-		Enabled: true,
-		TTL:     req.TTL,
-		NS:      req.NS,
-		Admin:   req.Admin,
-		Refresh: req.Refresh,
-		Retry:   req.Retry,
-		Expire:  req.Expire,
+		ID:         id,
+		Name:       req.Name,
+		Enabled:    true,
+		TTL:        req.TTL,
+		NS:         req.NS,
+		Admin:      req.Admin,
+		Refresh:    req.Refresh,
+		Retry:      req.Retry,
+		Expire:     req.Expire,
+		Minimum:    req.Minimum,
+		NSAddress:  req.NSAddress,
+		Type:       req.Type,
+		Forwarders: req.Forwarders,
+		Primaries:  req.Primaries,
+	}
+
+	// The zone keeps its type and address filter unless the request sets
+	// them
+	current, err := database.GetZone(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	version, ok := checkIfMatch(c, current.Version)
+	if !ok {
+		return
+	}
+	zone.Version = version
+	if zone.Type == "" {
+		zone.Type = current.Type
+		if zone.Forwarders == "" {
+			zone.Forwarders = current.Forwarders
+		}
+		if zone.Primaries == "" {
+			zone.Primaries = current.Primaries
+		}
+	}
+	if req.AddressFilter != nil {
+		zone.AddressFilter = *req.AddressFilter
+	} else {
+		zone.AddressFilter = current.AddressFilter
 	}
-
 	if req.Enabled != nil {
 		zone.Enabled = *req.Enabled
 	}
+	if zone.Minimum == 0 {
+		zone.Minimum = 3600
+	}
+	if err := normalizeZoneSettings(zone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err := database.UpdateZone(zone); err != nil {
+		if errors.Is(err, errVersionConflict) {
+			zoneConflict(c, id)
+			return
+		}
 		slog.Error("failed to update zone", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update zone"})
 		return
@@ -191,8 +385,13 @@ func handleAPIUpdateZone(c *gin.Context) {
 	if err := LoadZonesFromDB(); err != nil {
 		slog.Error("failed to reload zones", "error", err)
 	}
+	// A secondary zone is transferred from its primaries right away
+	if zone.Type == zoneTypeSecondary {
+		scheduleSecondaryZone(zone.ID, time.Time{})
+	}
 
 	slog.Info("Zone updated", "name", zone.Name, "id", zone.ID)
+	setETag(c, zone.Version)
 	c.JSON(http.StatusOK, zone)
 }
 
@@ -214,6 +413,10 @@ func handleAPIToggleZone(c *gin.Context) {
 	zone.Enabled = !zone.Enabled
 
 	if err := database.UpdateZone(zone); err != nil {
+		if errors.Is(err, errVersionConflict) {
+			zoneConflict(c, id)
+			return
+		}
 		slog.Error("failed to toggle zone", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to toggle zone"})
 		return
@@ -224,6 +427,13 @@ func handleAPIToggleZone(c *gin.Context) {
 		slog.Error("failed to reload zones", "error", err)
 	}
 
+	// Secondaries drop or reload the zone, and the catalog lists it or not
+	notified := []string{zone.Name}
+	if catalogZone != "" {
+		notified = append(notified, catalogZone)
+	}
+	notifySecondaries(notified...)
+
 	slog.Info("Zone toggled", "name", zone.Name, "enabled", zone.Enabled)
 	c.JSON(http.StatusOK, gin.H{"enabled": zone.Enabled})
 }
@@ -242,6 +452,28 @@ func handleAPIDeleteZone(c *gin.Context) {
 		return
 	}
 
+	// A zone with many records is only deleted with the token of a first
+	// attempt, which changes with the zone
+	if zoneDeleteConfirmRecords > 0 {
+		records, err := database.ListRecordsByZone(id)
+		if err != nil {
+			slog.Error("failed to list records", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list records"})
+			return
+		}
+		if n := len(records); n > zoneDeleteConfirmRecords {
+			token := zoneDeleteToken(zone, n)
+			if c.Query("confirm") != token {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":   fmt.Sprintf("zone %s has %d records, delete it again with ?confirm=%s", zone.Name, n, token),
+					"records": n,
+					"confirm": token,
+				})
+				return
+			}
+		}
+	}
+
 	if err := database.DeleteZone(id); err != nil {
 		slog.Error("failed to delete zone", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete zone"})
@@ -259,6 +491,14 @@ func handleAPIDeleteZone(c *gin.Context) {
 
 // Record handlers
 
+// zoneDefaultTTL returns the TTL given to records created without one
+func zoneDefaultTTL(zoneID int64) int {
+	if zone, err := database.GetZone(zoneID); err == nil && zone.TTL > 0 {
+		return zone.TTL
+	}
+	return 3600
+}
+
 func handleAPICreateRecord(c *gin.Context) {
 	zoneIDStr := c.Param("id")
 	zoneID, err := strconv.ParseInt(zoneIDStr, 10, 64)
@@ -268,28 +508,61 @@ func handleAPICreateRecord(c *gin.Context) {
 	}
 
 	// Verify zone exists
-	if _, err := database.GetZone(zoneID); err != nil {
+	zone, err := database.GetZone(zoneID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
 		return
 	}
+	if msg := zoneRecordsError(zone); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
 
 	var req CreateRecordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validRecordSchedule(req.RecordSchedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	notes, err := normalizeRecordNotes(req.RecordNotes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.toASCII(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := systemRecordError(zone.Name, req.Name, req.Type); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
 
 	record := &DBRecord{
-		ZoneID:   zoneID,
-		Name:     req.Name,
-		Type:     req.Type,
-		Value:    req.Value,
-		TTL:      req.TTL,
-		Priority: req.Priority,
+		ZoneID:         zoneID,
+		Name:           req.Name,
+		Type:           req.Type,
+		Value:          req.Value,
+		TTL:            req.TTL,
+		Priority:       req.Priority,
+		RecordSchedule: req.RecordSchedule,
+		RecordNotes:    notes,
+		RecordCaching:  req.RecordCaching,
 	}
 
 	if record.TTL == 0 {
-		record.TTL = 3600
+		record.TTL = zoneDefaultTTL(record.ZoneID)
+	}
+	if err := normalizeSVCBRecord(zone.Name, record); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if stageChange(c, zoneID, DBChange{Action: "create", Name: record.Name, Type: record.Type, Value: record.Value, TTL: record.TTL, Priority: record.Priority, RecordSchedule: record.RecordSchedule, RecordNotes: record.RecordNotes, RecordCaching: record.RecordCaching}) {
+		return
 	}
 
 	if err := database.CreateRecord(record); err != nil {
@@ -304,9 +577,11 @@ func handleAPICreateRecord(c *gin.Context) {
 	}
 
 	slog.Info("Record created", "name", record.Name, "type", record.Type, "id", record.ID)
+	setETag(c, record.Version)
 	c.JSON(http.StatusCreated, record)
 }
 
+// handleAPIListRecords handles GET /api/zones/:id/records?limit=&offset=&sort=&name=&type=&q=
 func handleAPIListRecords(c *gin.Context) {
 	zoneIDStr := c.Param("id")
 	zoneID, err := strconv.ParseInt(zoneIDStr, 10, 64)
@@ -315,16 +590,41 @@ func handleAPIListRecords(c *gin.Context) {
 		return
 	}
 
-	records, err := database.ListRecordsByZone(zoneID)
+	q, err := parseListQuery(c, recordSorts, "type", "name", "value", "ttl", "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	records, total, err := database.ListRecordsPage(zoneID, q)
 	if err != nil {
 		slog.Error("failed to list records", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list records"})
 		return
 	}
 
+	setTotalCount(c, total)
 	c.JSON(http.StatusOK, records)
 }
 
+// handleAPISearchRecords handles GET /api/records/search?q=
+func handleAPISearchRecords(c *gin.Context) {
+	words, tags := parseRecordSearch(c.Query("q"))
+	if len(words) == 0 && len(tags) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+
+	results, err := database.SearchRecords(words, tags, maxRecordSearchResults)
+	if err != nil {
+		slog.Error("failed to search records", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search records"})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
 func handleAPIUpdateRecord(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -338,28 +638,74 @@ func handleAPIUpdateRecord(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "record not found"})
 		return
 	}
+	zone, err := database.GetZone(existing.ZoneID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	if msg := systemRecordError(zone.Name, existing.Name, existing.Type); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	version, ok := checkIfMatch(c, existing.Version)
+	if !ok {
+		return
+	}
 
 	var req CreateRecordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validRecordSchedule(req.RecordSchedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	notes, err := normalizeRecordNotes(req.RecordNotes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.toASCII(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := systemRecordError(zone.Name, req.Name, req.Type); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
 
 	record := &DBRecord{
-		ID:       id,
-		ZoneID:   existing.ZoneID,
-		Name:     req.Name,
-		Type:     req.Type,
-		Value:    req.Value,
-		TTL:      req.TTL,
-		Priority: req.Priority,
+		ID:             id,
+		ZoneID:         existing.ZoneID,
+		Name:           req.Name,
+		Type:           req.Type,
+		Value:          req.Value,
+		TTL:            req.TTL,
+		Priority:       req.Priority,
+		Version:        version,
+		RecordSchedule: req.RecordSchedule,
+		RecordNotes:    notes,
+		RecordCaching:  req.RecordCaching,
 	}
 
 	if record.TTL == 0 {
-		record.TTL = 3600
+		record.TTL = zoneDefaultTTL(record.ZoneID)
+	}
+	if err := normalizeSVCBRecord(zone.Name, record); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if stageChange(c, record.ZoneID, DBChange{Action: "update", RecordID: record.ID, Name: record.Name, Type: record.Type, Value: record.Value, TTL: record.TTL, Priority: record.Priority, RecordSchedule: record.RecordSchedule, RecordNotes: record.RecordNotes, RecordCaching: record.RecordCaching}) {
+		return
 	}
 
 	if err := database.UpdateRecord(record); err != nil {
+		if errors.Is(err, errVersionConflict) {
+			recordConflict(c, record.ID)
+			return
+		}
 		slog.Error("failed to update record", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update record"})
 		return
@@ -371,6 +717,7 @@ func handleAPIUpdateRecord(c *gin.Context) {
 	}
 
 	slog.Info("Record updated", "name", record.Name, "type", record.Type, "id", record.ID)
+	setETag(c, record.Version)
 	c.JSON(http.StatusOK, record)
 }
 
@@ -387,6 +734,19 @@ func handleAPIDeleteRecord(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "record not found"})
 		return
 	}
+	zone, err := database.GetZone(record.ZoneID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	if msg := systemRecordError(zone.Name, record.Name, record.Type); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if stageChange(c, record.ZoneID, DBChange{Action: "delete", RecordID: id, Name: record.Name, Type: record.Type}) {
+		return
+	}
 
 	if err := database.DeleteRecord(id); err != nil {
 		slog.Error("failed to delete record", "error", err)
@@ -420,7 +780,8 @@ func handleAPIDeleteRecordInZone(c *gin.Context) {
 	}
 
 	// Verify zone exists
-	if _, err := database.GetZone(zoneID); err != nil {
+	zone, err := database.GetZone(zoneID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
 		return
 	}
@@ -436,6 +797,14 @@ func handleAPIDeleteRecordInZone(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "record not found in this zone"})
 		return
 	}
+	if msg := systemRecordError(zone.Name, record.Name, record.Type); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if stageChange(c, zoneID, DBChange{Action: "delete", RecordID: recordID, Name: record.Name, Type: record.Type}) {
+		return
+	}
 
 	if err := database.DeleteRecord(recordID); err != nil {
 		slog.Error("failed to delete record", "error", err)
@@ -469,7 +838,8 @@ func handleAPIUpdateRecordInZone(c *gin.Context) {
 	}
 
 	// Verify zone exists
-	if _, err := database.GetZone(zoneID); err != nil {
+	zone, err := database.GetZone(zoneID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
 		return
 	}
@@ -485,28 +855,69 @@ func handleAPIUpdateRecordInZone(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "record not found in this zone"})
 		return
 	}
+	if msg := systemRecordError(zone.Name, existing.Name, existing.Type); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	version, ok := checkIfMatch(c, existing.Version)
+	if !ok {
+		return
+	}
 
 	var req CreateRecordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validRecordSchedule(req.RecordSchedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	notes, err := normalizeRecordNotes(req.RecordNotes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.toASCII(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := systemRecordError(zone.Name, req.Name, req.Type); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
 
 	record := &DBRecord{
-		ID:       recordID,
-		ZoneID:   zoneID,
-		Name:     req.Name,
-		Type:     req.Type,
-		Value:    req.Value,
-		TTL:      req.TTL,
-		Priority: req.Priority,
+		ID:             recordID,
+		ZoneID:         zoneID,
+		Name:           req.Name,
+		Type:           req.Type,
+		Value:          req.Value,
+		TTL:            req.TTL,
+		Priority:       req.Priority,
+		Version:        version,
+		RecordSchedule: req.RecordSchedule,
+		RecordNotes:    notes,
+		RecordCaching:  req.RecordCaching,
 	}
 
 	if record.TTL == 0 {
-		record.TTL = 3600
+		record.TTL = zoneDefaultTTL(record.ZoneID)
+	}
+	if err := normalizeSVCBRecord(zone.Name, record); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if stageChange(c, record.ZoneID, DBChange{Action: "update", RecordID: record.ID, Name: record.Name, Type: record.Type, Value: record.Value, TTL: record.TTL, Priority: record.Priority, RecordSchedule: record.RecordSchedule, RecordNotes: record.RecordNotes, RecordCaching: record.RecordCaching}) {
+		return
 	}
 
 	if err := database.UpdateRecord(record); err != nil {
+		if errors.Is(err, errVersionConflict) {
+			recordConflict(c, record.ID)
+			return
+		}
 		slog.Error("failed to update record", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update record"})
 		return
@@ -518,6 +929,7 @@ func handleAPIUpdateRecordInZone(c *gin.Context) {
 	}
 
 	slog.Info("Record updated", "name", record.Name, "type", record.Type, "zone_id", zoneID, "record_id", recordID)
+	setETag(c, record.Version)
 	c.JSON(http.StatusOK, record)
 }
 
@@ -555,6 +967,7 @@ func handleAPIGetRecordInZone(c *gin.Context) {
 		return
 	}
 
+	setETag(c, record.Version)
 	c.JSON(http.StatusOK, record)
 }
 
@@ -567,15 +980,19 @@ func handleAPICreateForwarder(c *gin.Context) {
 		return
 	}
 
-	// Check if we already have 2 forwarders (maximum allowed)
-	if len(forwarders) >= 2 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Maximum 2 forwarders allowed"})
+	if req.Priority < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "priority cannot be negative"})
+		return
+	}
+	if err := validUpstreamOptions(req.UpstreamOptions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	forwarder := &DBForwarder{
-		Address:  req.Address,
-		Priority: req.Priority,
+		Address:         req.Address,
+		Priority:        req.Priority,
+		UpstreamOptions: req.UpstreamOptions,
 	}
 
 	if err := database.CreateForwarder(forwarder); err != nil {
@@ -634,10 +1051,162 @@ func handleAPIDeleteForwarder(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "forwarder deleted"})
 }
 
+// handleAPIUpdateForwarder handles PUT /api/forwarders/:id
+func handleAPIUpdateForwarder(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid forwarder id"})
+		return
+	}
+	var req UpdateForwarderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validUpstreamOptions(req.UpstreamOptions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := database.ListForwarders()
+	if err != nil {
+		slog.Error("failed to list forwarders", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update forwarder"})
+		return
+	}
+	var forwarder *DBForwarder
+	for i := range list {
+		if list[i].ID == id {
+			forwarder = &list[i]
+		}
+	}
+	if forwarder == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "forwarder not found"})
+		return
+	}
+	if req.Priority != nil {
+		if *req.Priority < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "priority cannot be negative"})
+			return
+		}
+		forwarder.Priority = *req.Priority
+	}
+	forwarder.UpstreamOptions = req.UpstreamOptions
+	if err := database.UpdateForwarder(forwarder); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "forwarder not found"})
+			return
+		}
+		slog.Error("failed to update forwarder", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update forwarder"})
+		return
+	}
+
+	// Reload forwarders into memory
+	if err := LoadForwardersFromDB(); err != nil {
+		slog.Error("failed to reload forwarders", "error", err)
+	}
+
+	slog.Info("Forwarder updated", "id", id, "address", forwarder.Address)
+	c.JSON(http.StatusOK, forwarder)
+}
+
+// ReorderForwardersRequest lists forwarder ids, the first one asked first
+type ReorderForwardersRequest struct {
+	IDs []int64 `json:"ids" binding:"required"`
+}
+
+// handleAPIReorderForwarders handles PUT /api/forwarders/order
+func handleAPIReorderForwarders(c *gin.Context) {
+	var req ReorderForwardersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.ReorderForwarders(req.IDs); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "forwarder not found"})
+			return
+		}
+		slog.Error("failed to reorder forwarders", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reorder forwarders"})
+		return
+	}
+
+	// Reload forwarders into memory
+	if err := LoadForwardersFromDB(); err != nil {
+		slog.Error("failed to reload forwarders", "error", err)
+	}
+
+	slog.Info("Forwarders reordered", "ids", req.IDs)
+	list, err := database.ListForwarders()
+	if err != nil {
+		slog.Error("failed to list forwarders", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list forwarders"})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// API token handlers
+
+func handleAPIListTokens(c *gin.Context) {
+	tokens, err := ListAPITokens(c.GetString("username"))
+	if err != nil {
+		slog.Error("failed to list tokens", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list tokens"})
+		return
+	}
+	if tokens == nil {
+		tokens = []APIToken{}
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func handleAPICreateToken(c *gin.Context) {
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == "" {
+		req.Name = "API Token"
+	}
+
+	token, err := CreateAPIToken(c.GetString("username"), req.Name)
+	if err != nil {
+		slog.Error("failed to create token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+
+	slog.Info("API token created", "name", token.Name, "id", token.ID)
+	c.JSON(http.StatusCreated, token)
+}
+
+func handleAPIDeleteToken(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token id"})
+		return
+	}
+
+	if err := DeleteAPIToken(c.GetString("username"), id); err != nil {
+		slog.Error("failed to delete token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete token"})
+		return
+	}
+
+	slog.Info("API token deleted", "id", id)
+	c.JSON(http.StatusOK, gin.H{"message": "token deleted"})
+}
+
 // registerAPIRoutes registers all CRUD API routes (only in sqlite mode)
 func registerAPIRoutes(router *gin.Engine) {
 	api := router.Group("/api")
-	api.Use(APIAuthMiddleware())
+	api.Use(APIAuthMiddleware(), DemoReadOnlyMiddleware(), AuditMiddleware(), ReadOnlySlaveMiddleware())
 	{
 		// Zones CRUD
 		api.POST("/zones", handleAPICreateZone)
@@ -646,23 +1215,132 @@ func registerAPIRoutes(router *gin.Engine) {
 		api.PUT("/zones/:id", handleAPIUpdateZone)
 		api.PATCH("/zones/:id/toggle", handleAPIToggleZone)
 		api.DELETE("/zones/:id", handleAPIDeleteZone)
+		api.GET("/zones/:id/wire", handleAPIGetZoneWire)
+		api.POST("/zones/:id/validate", handleAPIValidateZone)
+		api.GET("/zones/:id/problems", handleAPIZoneProblems)
+		api.GET("/zones/:id/export", handleAPIExportZone)
+		api.GET("/zones/:id/text", handleAPIGetZoneText)
+		api.PUT("/zones/:id/text", handleAPIPutZoneText)
+
+		// Full backup and restore
+		api.GET("/backup", handleAPIBackup)
+		api.POST("/restore", handleAPIRestore)
+		api.GET("/backups", handleAPIBackupStatus)
+		api.POST("/backups", handleAPIRunBackup)
+		api.GET("/backups/:name", handleAPIDownloadBackupFile)
+
+		// Zone import from cloud providers
+		api.POST("/import/zones", handleAPIImportZone)
+		api.POST("/import/resolver", handleAPIMigrateResolver)
+
+		// Externally signed (pre-signed) zones
+		api.GET("/zones/:id/signed", handleAPISignedZoneStatus)
+		api.POST("/zones/:id/signed", handleAPIImportSignedZone)
+		api.DELETE("/zones/:id/signed", handleAPIDeleteSignedZone)
 
 		// Records CRUD (use :id consistently)
 		api.POST("/zones/:id/records", handleAPICreateRecord)
+		api.POST("/zones/:id/records/bulk", handleAPIBulkCreateRecords)
 		api.GET("/zones/:id/records", handleAPIListRecords)
 		api.GET("/zones/:id/records/:record_id", handleAPIGetRecordInZone)
 		api.PUT("/zones/:id/records/:record_id", handleAPIUpdateRecordInZone)
 		api.DELETE("/zones/:id/records/:record_id", handleAPIDeleteRecordInZone)
+		api.POST("/zones/:id/records/:record_id/refresh", handleAPIRefreshRecord)
+		api.GET("/zones/:id/rrsets", handleAPIListRRSets)
+		api.GET("/zones/:id/rrsets/:name/:type", handleAPIGetRRSet)
+		api.PUT("/zones/:id/rrsets/:name/:type", handleAPIPutRRSet)
+		api.DELETE("/zones/:id/rrsets/:name/:type", handleAPIDeleteRRSet)
+
+		// Secondaries of a zone (NOTIFY and AXFR, with TSIG)
+		api.GET("/zones/:id/secondaries", handleAPIListZoneSecondaries)
+		api.POST("/zones/:id/secondaries", handleAPICreateZoneSecondary)
+		api.DELETE("/zones/:id/secondaries/:secondary_id", handleAPIDeleteZoneSecondary)
+		api.POST("/zones/:id/notify", handleAPINotifyZoneSecondaries)
+		api.GET("/zones/:id/transfer", handleAPIGetZoneTransfer)
+		api.POST("/zones/:id/transfer", handleAPITransferZone)
+
+		// Owner, description and review date of a zone
+		api.GET("/zones/:id/notes", handleAPIGetZoneNotes)
+		api.PUT("/zones/:id/notes", handleAPIPutZoneNotes)
+		api.GET("/zone-reviews", handleAPIListZoneReviews)
+
+		// Client labels and policies
+		api.GET("/clients", handleAPIListClients)
+		api.PUT("/clients/:address", handleAPISetClient)
+		api.POST("/clients/:address/pause", handleAPIPauseClient)
+		api.DELETE("/clients/:address/pause", handleAPIResumeClient)
+		api.GET("/schedules", handleAPIListSchedules)
+		api.POST("/schedules", handleAPICreateSchedule)
+		api.PUT("/schedules/:id", handleAPIUpdateSchedule)
+		api.DELETE("/schedules/:id", handleAPIDeleteSchedule)
+
+		// Deleted zones and records
+		api.GET("/trash", handleAPIListTrash)
+		api.POST("/trash/:id/restore", handleAPIRestoreTrashItem)
+		api.DELETE("/trash/:id", handleAPIDeleteTrashItem)
+
+		// Staged record changes (edits made with ?changeset=<id>)
+		api.POST("/zones/:id/changesets", handleAPICreateChangeset)
+		api.GET("/changesets", handleAPIListChangesets)
+		api.GET("/changesets/:id", handleAPIGetChangeset)
+		api.POST("/changesets/:id/apply", handleAPIApplyChangeset)
+		api.DELETE("/changesets/:id", handleAPIDiscardChangeset)
+		api.DELETE("/changesets/:id/changes/:change_id", handleAPIDeleteChange)
 
 		// Legacy record routes (for backward compatibility)
+		api.GET("/records/search", handleAPISearchRecords)
 		api.PUT("/records/:id", handleAPIUpdateRecord)
 		api.DELETE("/records/:id", handleAPIDeleteRecord)
 
 		// Forwarders CRUD
 		api.POST("/forwarders", handleAPICreateForwarder)
 		api.GET("/forwarders", handleAPIListForwarders)
+		api.PUT("/forwarders", handleAPIReplaceForwarders)
+		api.POST("/forwarders/benchmark", handleAPIBenchmarkForwarders)
+		api.GET("/address-filter", handleAPIGetAddressFilter)
+		api.PUT("/address-filter", handleAPISetAddressFilter)
+		api.PUT("/sinkhole/domains", handleAPISetSinkholeDomains)
+		api.POST("/sinkhole/refresh", handleAPIRefreshSinkhole)
+		api.PUT("/forwarders/order", handleAPIReorderForwarders)
+		api.PUT("/forwarders/:id", handleAPIUpdateForwarder)
 		api.DELETE("/forwarders/:id", handleAPIDeleteForwarder)
 
+		// API tokens
+		api.GET("/tokens", handleAPIListTokens)
+		api.POST("/tokens", handleAPICreateToken)
+		api.DELETE("/tokens/:id", handleAPIDeleteToken)
+
+		// Network profiles
+		api.GET("/profiles", handleAPIListProfiles)
+		api.PUT("/profiles/active", handleAPISelectProfile)
+
+		// TLS certificates (ACME)
+		api.GET("/certificates", handleAPICertificateStatus)
+		api.POST("/certificates/renew", handleAPIRenewCertificate)
+
+		// Email alerts
+		api.POST("/alerts/test", handleAPITestAlert)
+
+		// Live zones vs database consistency check
+		api.POST("/verify", handleAPIVerify)
+
+		// Compliance audit log
+		api.GET("/audit", handleAPIListAudit)
+		api.GET("/audit/export", handleAPIExportAudit)
+		api.GET("/audit/verify", handleAPIVerifyAudit)
+
+		// Replication role (slaves are read-only)
+		api.GET("/replication", handleAPIReplicationStatus)
+		api.POST("/replication/promote", handleAPIPromote)
+		api.POST("/replication/demote", handleAPIDemote)
+
+		// Maintenance mode (zones forwarded upstream)
+		api.GET("/maintenance", handleAPIGetMaintenance)
+		api.PUT("/maintenance", handleAPISetMaintenance)
+
+		// State snapshot, also written on SIGUSR1, for the admin only
+		api.GET("/debug/dump", RequireAdminMiddleware(), handleAPIDebugDump)
+
 		// Replication (token support removed)
 	}
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staticFiles holds the web UI assets, see static/README.md
+//
+//go:embed static
+var staticFiles embed.FS
+
+// webAssetsCDN loads the assets missing from static/vendor from their CDN
+// instead of failing, for a build without scripts/fetch-assets.sh
+var webAssetsCDN bool
+
+// vendorAssets are the files scripts/fetch-assets.sh writes to static/vendor
+var vendorAssets = []string{"alpine.min.js", "chart.umd.min.js", "tailwind.css"}
+
+// vendorCDN is where each vendored asset is loaded from when it has not
+// been embedded and web_assets_cdn is set
+var vendorCDN = map[string]string{
+	"alpine.min.js":    "https://unpkg.com/alpinejs@3.14.1/dist/cdn.min.js",
+	"chart.umd.min.js": "https://cdn.jsdelivr.net/npm/chart.js@4.4.1/dist/chart.umd.min.js",
+	"tailwind.js":      "https://cdn.tailwindcss.com",
+}
+
+// tailwindStub replaces the Tailwind CDN script when the stylesheet is
+// embedded, so the inline tailwind.config of the templates is harmless
+const tailwindStub = "window.tailwind = window.tailwind || {};\n"
+
+// logVendorAssets reports the assets missing from the binary
+func logVendorAssets() {
+	var missing []string
+	for _, name := range vendorAssets {
+		if _, err := fs.Stat(staticFiles, path.Join("static/vendor", name)); err != nil {
+			missing = append(missing, name)
+		}
+	}
+	switch {
+	case len(missing) == 0:
+	case webAssetsCDN:
+		slog.Warn("web UI assets not embedded, loading them from CDNs", "assets", missing)
+	default:
+		slog.Warn("web UI assets not embedded, run scripts/fetch-assets.sh before building", "assets", missing)
+	}
+}
+
+// handleVendorAsset serves an embedded library of the web UI, falling back
+// to its CDN only when web_assets_cdn is set
+func handleVendorAsset(c *gin.Context) {
+	name := path.Base(c.Param("name"))
+	c.Header("Cache-Control", "public, max-age=86400")
+
+	if name == "tailwind.js" {
+		if _, err := fs.Stat(staticFiles, "static/vendor/tailwind.css"); err == nil {
+			c.Data(http.StatusOK, "application/javascript", []byte(tailwindStub))
+			return
+		}
+	} else if data, err := staticFiles.ReadFile(path.Join("static/vendor", name)); err == nil {
+		contentType := "application/javascript"
+		if path.Ext(name) == ".css" {
+			contentType = "text/css; charset=utf-8"
+		}
+		c.Data(http.StatusOK, contentType, data)
+		return
+	}
+
+	if !webAssetsCDN {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if url, ok := vendorCDN[name]; ok {
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+	if name == "tailwind.css" {
+		// Styles come from the Tailwind CDN script instead
+		c.Data(http.StatusOK, "text/css; charset=utf-8", nil)
+		return
+	}
+	c.Status(http.StatusNotFound)
+}
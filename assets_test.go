@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The web UI must work offline: the output of scripts/fetch-assets.sh is
+// committed and embedded
+func TestVendorAssetsEmbedded(t *testing.T) {
+	for _, name := range vendorAssets {
+		info, err := fs.Stat(staticFiles, path.Join("static/vendor", name))
+		if err != nil {
+			t.Errorf("%s is not embedded, run scripts/fetch-assets.sh and commit static/vendor", name)
+			continue
+		}
+		if info.Size() == 0 {
+			t.Errorf("%s is empty", name)
+		}
+	}
+}
+
+func TestHandleVendorAssetWithoutCDN(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := webAssetsCDN
+	webAssetsCDN = false
+	defer func() { webAssetsCDN = saved }()
+
+	router := gin.New()
+	router.GET("/static/vendor/:name", handleVendorAsset)
+	for _, name := range append([]string{"tailwind.js", "missing.js"}, vendorAssets...) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static/vendor/"+name, nil))
+		if w.Code != http.StatusOK && w.Code != http.StatusNotFound {
+			t.Errorf("%s = %d, want the embedded file or a 404", name, w.Code)
+		}
+	}
+}
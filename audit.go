@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// complianceMode records every mutating API call, with request and response
+// bodies, in the hash-chained audit_log table
+var complianceMode bool
+
+// auditBodyLimit caps how much of each body is stored
+const auditBodyLimit = 64 << 10
+
+// auditSecretKeys are field name fragments whose values are redacted
+var auditSecretKeys = []string{"password", "passwd", "secret", "token", "api_key", "private_key", "key_pem", "authorization"}
+
+const auditRedacted = "[REDACTED]"
+
+// auditHash computes the chain hash of an entry from its content and the
+// hash of the previous entry
+func auditHash(e *DBAuditEntry) string {
+	fields, _ := json.Marshal([]any{
+		e.PrevHash, e.CreatedAt.UTC().Format(time.RFC3339Nano), e.Username, e.AuthType, e.ClientIP,
+		e.Method, e.Path, e.Status, e.RequestBody, e.ResponseBody,
+	})
+	sum := sha256.Sum256(fields)
+	return hex.EncodeToString(sum[:])
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range auditSecretKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue replaces secret fields anywhere in a decoded JSON value
+func redactValue(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, inner := range val {
+			if isSecretKey(k) {
+				val[k] = auditRedacted
+			} else {
+				val[k] = redactValue(inner)
+			}
+		}
+	case []any:
+		for i, inner := range val {
+			val[i] = redactValue(inner)
+		}
+	}
+	return v
+}
+
+// redactBody returns body with secrets removed. JSON and form bodies are
+// redacted field by field; anything else is kept only if it is not binary.
+func redactBody(body []byte, contentType string) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var decoded any
+	if json.Unmarshal(body, &decoded) == nil {
+		out, _ := json.Marshal(redactValue(decoded))
+		return truncateAuditBody(string(out))
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for k := range form {
+				if isSecretKey(k) {
+					form[k] = []string{auditRedacted}
+				}
+			}
+			return truncateAuditBody(form.Encode())
+		}
+	}
+	if !strings.HasPrefix(contentType, "text/") {
+		return "[" + strconv.Itoa(len(body)) + " bytes, " + contentType + "]"
+	}
+	return truncateAuditBody(string(body))
+}
+
+func truncateAuditBody(s string) string {
+	if len(s) > auditBodyLimit {
+		return s[:auditBodyLimit] + "...[truncated]"
+	}
+	return s
+}
+
+// auditWriter copies the response body while it is written
+type auditWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	if w.body.Len() < auditBodyLimit+1 {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditWriter) WriteString(s string) (int, error) {
+	if w.body.Len() < auditBodyLimit+1 {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// AuditMiddleware records mutating requests in the audit log when
+// compliance mode is on. It must run after the authentication middleware.
+func AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			c.Next()
+			return
+		}
+		if !complianceMode || database == nil {
+			c.Next()
+			return
+		}
+
+		var reqBody []byte
+		if c.Request.Body != nil {
+			reqBody, _ = io.ReadAll(c.Request.Body)
+			_ = c.Request.Body.Close()
+			c.Request.Body = io.NopCloser(bytes.NewReader(reqBody))
+		}
+		w := &auditWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		c.Next()
+
+		entry := &DBAuditEntry{
+			CreatedAt:    time.Now(),
+			Username:     c.GetString("username"),
+			AuthType:     c.GetString("auth_type"),
+			ClientIP:     c.ClientIP(),
+			Method:       c.Request.Method,
+			Path:         c.Request.URL.RequestURI(),
+			Status:       w.Status(),
+			RequestBody:  redactBody(reqBody, c.ContentType()),
+			ResponseBody: redactBody(w.body.Bytes(), strings.Split(w.Header().Get("Content-Type"), ";")[0]),
+		}
+		if entry.AuthType == "" {
+			entry.AuthType = "session"
+		}
+		if err := database.AppendAuditEntry(entry); err != nil {
+			slog.Error("failed to write audit entry", "method", entry.Method, "path", entry.Path, "error", err)
+		}
+	}
+}
+
+// verifyAuditChain checks every entry's hash and link to its predecessor.
+// It returns the number of entries checked and the id of the first broken
+// entry (0 if the chain is intact).
+func verifyAuditChain() (int, int64, error) {
+	var prev string
+	var afterID int64
+	checked := 0
+	for {
+		entries, err := database.ListAuditEntries(afterID, 1000)
+		if err != nil {
+			return checked, 0, err
+		}
+		if len(entries) == 0 {
+			return checked, 0, nil
+		}
+		for i := range entries {
+			e := &entries[i]
+			if e.PrevHash != prev || auditHash(e) != e.Hash {
+				return checked, e.ID, nil
+			}
+			prev = e.Hash
+			afterID = e.ID
+			checked++
+		}
+	}
+}
+
+// Audit API handlers
+
+func handleAPIListAudit(c *gin.Context) {
+	afterID, _ := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+		return
+	}
+
+	entries, err := database.ListAuditEntries(afterID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if entries == nil {
+		entries = []DBAuditEntry{}
+	}
+	c.JSON(http.StatusOK, gin.H{"compliance_mode": complianceMode, "entries": entries})
+}
+
+// handleAPIExportAudit streams the whole audit log as JSON lines, oldest first
+func handleAPIExportAudit(c *gin.Context) {
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", "attachment; filename=simpledns-audit.jsonl")
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	var afterID int64
+	for {
+		entries, err := database.ListAuditEntries(afterID, 1000)
+		if err != nil {
+			slog.Error("failed to export audit log", "error", err)
+			return
+		}
+		if len(entries) == 0 {
+			return
+		}
+		for i := range entries {
+			if err := enc.Encode(&entries[i]); err != nil {
+				return
+			}
+			afterID = entries[i].ID
+		}
+	}
+}
+
+func handleAPIVerifyAudit(c *gin.Context) {
+	checked, brokenID, err := verifyAuditChain()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result := gin.H{"valid": brokenID == 0, "entries": checked}
+	if brokenID != 0 {
+		result["first_invalid_id"] = brokenID
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"html/template"
 	"log/slog"
+	"math"
 	"net/http"
 	"sync"
 	"time"
@@ -167,7 +168,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Validate session
 		session, valid := GetSession(token)
 		if !valid {
-			c.SetCookie(sessionCookieName, "", -1, "/", "", false, true)
+			setSessionCookie(c, "", -1)
 			c.Redirect(http.StatusFound, "/login?redirect="+c.Request.URL.Path)
 			c.Abort()
 			return
@@ -213,9 +214,29 @@ func handleLogin(c *gin.Context) {
 		redirect = "/"
 	}
 
+	// Throttle brute-force attempts from the same address
+	addr := c.ClientIP()
+	if wait := webSecurity.lockedOut(addr); wait > 0 {
+		retryAfter(c, wait)
+		tmpl := template.Must(template.New("login").Parse(loginHTML))
+		c.Header("Content-Type", "text/html")
+		c.Status(http.StatusTooManyRequests)
+		if err := tmpl.Execute(c.Writer, gin.H{
+			"Redirect": redirect,
+			"Error":    fmt.Sprintf("Too many failed logins, try again in %d min", int(math.Ceil(wait.Minutes()))),
+			"Version":  version,
+		}); err != nil {
+			slog.Error("failed to render login template", "error", err)
+		}
+		return
+	}
+
 	if !ValidateLogin(username, password) {
+		webSecurity.fail(addr, "login "+username)
+		time.Sleep(loginFailureDelay)
 		tmpl := template.Must(template.New("login").Parse(loginHTML))
 		c.Header("Content-Type", "text/html")
+		c.Status(http.StatusUnauthorized)
 		if err := tmpl.Execute(c.Writer, gin.H{
 			"Redirect": redirect,
 			"Error":    "Invalid username or password",
@@ -225,6 +246,7 @@ func handleLogin(c *gin.Context) {
 		}
 		return
 	}
+	webSecurity.succeed(addr)
 
 	// Create session
 	token, err := CreateSession(username)
@@ -242,7 +264,7 @@ func handleLogin(c *gin.Context) {
 	}
 
 	// Set session cookie
-	c.SetCookie(sessionCookieName, token, int(sessionDuration.Seconds()), "/", "", false, true)
+	setSessionCookie(c, token, int(sessionDuration.Seconds()))
 	c.Redirect(http.StatusFound, redirect)
 }
 
@@ -315,7 +337,7 @@ func handleSetup(c *gin.Context) {
 
 	// Create session and redirect to dashboard
 	token, _ := CreateSession("admin")
-	c.SetCookie(sessionCookieName, token, int(sessionDuration.Seconds()), "/", "", false, true)
+	setSessionCookie(c, token, int(sessionDuration.Seconds()))
 	c.Redirect(http.StatusFound, "/")
 }
 
@@ -325,7 +347,7 @@ func handleLogout(c *gin.Context) {
 	if err == nil && token != "" {
 		DeleteSession(token)
 	}
-	c.SetCookie(sessionCookieName, "", -1, "/", "", false, true)
+	setSessionCookie(c, "", -1)
 	c.Redirect(http.StatusFound, "/login")
 }
 
@@ -485,32 +507,37 @@ func ValidateAPIToken(token string) (string, bool) {
 // APIAuthMiddleware checks for API token or session authentication
 func APIAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Check for Bearer token in Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-			token := authHeader[7:]
-			if username, valid := ValidateAPIToken(token); valid {
-				c.Set("username", username)
-				c.Set("auth_type", "api_token")
-				c.Next()
+		// Check for Bearer token in Authorization header, then X-API-Key
+		token, invalid := "", ""
+		if authHeader := c.GetHeader("Authorization"); len(authHeader) > 7 && authHeader[:7] == "Bearer " {
+			token, invalid = authHeader[7:], "Invalid API token"
+		} else if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			token, invalid = apiKey, "Invalid API key"
+		}
+		if token != "" {
+			addr := c.ClientIP()
+			if wait := webSecurity.lockedOut(addr); wait > 0 {
+				retryAfter(c, wait)
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts"})
+				c.Abort()
 				return
 			}
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API token"})
-			c.Abort()
-			return
-		}
-
-		// Check for X-API-Key header
-		apiKey := c.GetHeader("X-API-Key")
-		if apiKey != "" {
-			if username, valid := ValidateAPIToken(apiKey); valid {
-				c.Set("username", username)
-				c.Set("auth_type", "api_token")
-				c.Next()
+			username, valid := ValidateAPIToken(token)
+			if !valid {
+				webSecurity.fail(addr, "api token")
+				c.JSON(http.StatusUnauthorized, gin.H{"error": invalid})
+				c.Abort()
 				return
 			}
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
-			c.Abort()
+			if !webSecurity.allowToken(HashAPIToken(token)) {
+				retryAfter(c, time.Second)
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+				c.Abort()
+				return
+			}
+			c.Set("username", username)
+			c.Set("auth_type", "api_token")
+			c.Next()
 			return
 		}
 
@@ -530,6 +557,24 @@ func APIAuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// adminUsername is the account created by the setup page, which
+// administers the server
+const adminUsername = "admin"
+
+// RequireAdminMiddleware lets only the admin account through, after
+// APIAuthMiddleware: the sessions and API tokens of other users are
+// refused
+func RequireAdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("username") != adminUsername {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // handleAccount handles the account/password management page
 func handleAccount(c *gin.Context) {
 	username, _ := c.Get("username")
@@ -602,6 +647,9 @@ func handleAccount(c *gin.Context) {
 		renderError("Failed to update password: " + err.Error())
 		return
 	}
+	slog.Info("Password changed", "user", usernameStr, "client", c.ClientIP())
+	notifyEvent(alertPassword, "Password of "+usernameStr+" changed",
+		fmt.Sprintf("The password of %s was changed from %s at %s.\nIf this was not you, restore access and revoke the API tokens at once.", usernameStr, c.ClientIP(), time.Now().Format(time.RFC1123)))
 
 	// Refresh tokens list
 	tokens, _ = ListAPITokens(usernameStr)
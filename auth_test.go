@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireAdminMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		username string
+		status   int
+	}{
+		{adminUsername, http.StatusOK},
+		{"viewer", http.StatusForbidden},
+		{"", http.StatusForbidden},
+	} {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			if tc.username != "" {
+				c.Set("username", tc.username)
+			}
+		}, RequireAdminMiddleware())
+		router.GET("/debug/pprof/cmdline", func(c *gin.Context) { c.Status(http.StatusOK) })
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/pprof/cmdline", nil))
+		if w.Code != tc.status {
+			t.Errorf("user %q = %d, want %d", tc.username, w.Code, tc.status)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// backupFormat is bumped when a backup can no longer be restored by older
+// versions
+const backupFormat = 1
+
+// Backup is a full export of the database: zones, records, forwarders,
+// users, API tokens, settings and certificates
+type Backup struct {
+	Format    int                         `json:"format"`
+	Version   string                      `json:"version"` // simpledns version that wrote it
+	CreatedAt time.Time                   `json:"created_at"`
+	Tables    map[string][]map[string]any `json:"tables"`
+}
+
+// BackupConfig configures the scheduled backups
+type BackupConfig struct {
+	Dir string `yaml:"dir" json:"dir,omitempty"`
+	// Format is "json" (default, the GET /api/backup export) or "sqlite", a
+	// snapshot of the database file taken with the SQLite backup API
+	Format        string `yaml:"format" json:"format,omitempty"`
+	IntervalHours int    `yaml:"interval_hours" json:"interval_hours,omitempty"` // default 24
+	Keep          int    `yaml:"keep" json:"keep,omitempty"`                     // backups kept, default 7
+}
+
+// backupPrefix names the backup files, followed by the UTC time to the
+// millisecond (backupStamp), so the names sort by creation time
+const backupPrefix = "simpledns-backup-"
+
+const backupStamp = "20060102-150405.000"
+
+// backupWriteMu serializes the scheduled and the manual backups, so two
+// of them never share a file name
+var backupWriteMu sync.Mutex
+
+// BackupFile is one backup in the backup directory
+type BackupFile struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BackupStatus is the state of the scheduled backups
+type BackupStatus struct {
+	Enabled       bool         `json:"enabled"`
+	Dir           string       `json:"dir,omitempty"`
+	Format        string       `json:"format,omitempty"`
+	IntervalHours int          `json:"interval_hours,omitempty"`
+	Keep          int          `json:"keep,omitempty"`
+	LastRun       *time.Time   `json:"last_run,omitempty"`
+	LastFile      string       `json:"last_file,omitempty"`
+	LastError     string       `json:"last_error,omitempty"`
+	NextRun       *time.Time   `json:"next_run,omitempty"`
+	History       []BackupFile `json:"history"`
+}
+
+// backupSchedule holds the configuration and last result of the scheduled
+// backups
+var backupSchedule struct {
+	sync.Mutex
+	cfg      BackupConfig
+	lastRun  time.Time
+	lastFile string
+	lastErr  string
+	nextRun  time.Time
+}
+
+// newBackup exports the database
+func newBackup() (*Backup, error) {
+	tables, err := database.DumpTables()
+	if err != nil {
+		return nil, err
+	}
+	return &Backup{Format: backupFormat, Version: version, CreatedAt: time.Now().UTC(), Tables: tables}, nil
+}
+
+// parseBackup decodes a backup, keeping integers as integers
+func parseBackup(r io.Reader) (*Backup, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var b Backup
+	if err := dec.Decode(&b); err != nil {
+		return nil, fmt.Errorf("invalid backup: %w", err)
+	}
+	if b.Format == 0 || b.Tables == nil {
+		return nil, fmt.Errorf("invalid backup: not a simpledns backup")
+	}
+	if b.Format > backupFormat {
+		return nil, fmt.Errorf("backup format %d is newer than this version supports (%d)", b.Format, backupFormat)
+	}
+	for _, rows := range b.Tables {
+		for _, row := range rows {
+			for col, v := range row {
+				if n, ok := v.(json.Number); ok {
+					if i, err := n.Int64(); err == nil {
+						row[col] = i
+					} else {
+						row[col], _ = n.Float64()
+					}
+				}
+			}
+		}
+	}
+	return &b, nil
+}
+
+// restoreBackup replaces the database content with b and reloads it
+func restoreBackup(b *Backup) error {
+	if err := database.RestoreTables(b.Tables); err != nil {
+		return err
+	}
+	loadServerRoleFromDB()
+	loadClientsFromDB()
+	loadSchedulesFromDB()
+	return ReloadFromDB()
+}
+
+// writeBackupFile writes a backup to cfg.Dir and removes the oldest ones
+// beyond cfg.Keep
+func writeBackupFile(cfg BackupConfig) (string, error) {
+	backupWriteMu.Lock()
+	defer backupWriteMu.Unlock()
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return "", err
+	}
+	ext := ".json"
+	if cfg.Format == "sqlite" {
+		ext = ".db"
+	}
+	path := filepath.Join(cfg.Dir, backupPrefix+time.Now().UTC().Format(backupStamp)+ext)
+	if _, err := os.Lstat(path); err == nil {
+		return "", fmt.Errorf("backup %s already exists", path)
+	}
+
+	// Write then rename, so a crash never leaves a truncated backup. The
+	// temporary file is created exclusively, never over another backup.
+	tmp, err := os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	switch cfg.Format {
+	case "sqlite":
+		_ = tmp.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		if err := database.Snapshot(ctx, path+".tmp"); err != nil {
+			_ = os.Remove(path + ".tmp")
+			return "", err
+		}
+		if err := os.Chmod(path+".tmp", 0o600); err != nil {
+			_ = os.Remove(path + ".tmp")
+			return "", err
+		}
+	default:
+		err := writeJSONBackup(tmp)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(path + ".tmp")
+			return "", err
+		}
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		_ = os.Remove(path + ".tmp")
+		return "", err
+	}
+
+	files, err := listBackupFiles(cfg.Dir)
+	if err != nil {
+		return path, err
+	}
+	for i := cfg.Keep; i < len(files); i++ {
+		old := filepath.Join(cfg.Dir, files[i].Name)
+		if err := os.Remove(old); err != nil {
+			slog.Warn("failed to remove old backup", "file", old, "error", err)
+		}
+	}
+	return path, nil
+}
+
+// writeJSONBackup writes a backup of the database to f
+func writeJSONBackup(f *os.File) error {
+	b, err := newBackup()
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(f).Encode(b)
+}
+
+// listBackupFiles returns the backups in dir, newest first
+func listBackupFiles(dir string) ([]BackupFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []BackupFile{}, nil
+		}
+		return nil, err
+	}
+	files := []BackupFile{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, backupPrefix) || (!strings.HasSuffix(name, ".json") && !strings.HasSuffix(name, ".db")) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, BackupFile{Name: name, Size: info.Size(), CreatedAt: info.ModTime().UTC()})
+	}
+	// The names sort by creation time
+	sort.Slice(files, func(i, j int) bool { return files[i].Name > files[j].Name })
+	return files, nil
+}
+
+// runScheduledBackup writes one backup and records the result
+func runScheduledBackup() (string, error) {
+	backupSchedule.Lock()
+	cfg := backupSchedule.cfg
+	backupSchedule.Unlock()
+
+	path, err := writeBackupFile(cfg)
+
+	backupSchedule.Lock()
+	defer backupSchedule.Unlock()
+	backupSchedule.lastRun = time.Now()
+	backupSchedule.lastErr = ""
+	if err != nil {
+		backupSchedule.lastErr = err.Error()
+		slog.Error("scheduled backup failed", "dir", cfg.Dir, "error", err)
+		return "", err
+	}
+	backupSchedule.lastFile = filepath.Base(path)
+	slog.Info("Backup written", "file", path)
+	return path, nil
+}
+
+// startBackupSchedule writes a backup every interval. Does nothing when no
+// directory is configured.
+func startBackupSchedule(cfg BackupConfig) {
+	if cfg.Dir == "" {
+		return
+	}
+	switch cfg.Format {
+	case "":
+		cfg.Format = "json"
+	case "json", "sqlite":
+	default:
+		slog.Error("unknown backup format, scheduled backups disabled", "format", cfg.Format)
+		return
+	}
+	if cfg.IntervalHours <= 0 {
+		cfg.IntervalHours = 24
+	}
+	if cfg.Keep <= 0 {
+		cfg.Keep = 7
+	}
+	interval := time.Duration(cfg.IntervalHours) * time.Hour
+
+	backupSchedule.Lock()
+	backupSchedule.cfg = cfg
+	backupSchedule.nextRun = time.Now().Add(interval)
+	backupSchedule.Unlock()
+
+	slog.Info("Scheduled backups enabled", "dir", cfg.Dir, "format", cfg.Format, "interval", interval, "keep", cfg.Keep)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			backupSchedule.Lock()
+			backupSchedule.nextRun = time.Now().Add(interval)
+			backupSchedule.Unlock()
+			_, _ = runScheduledBackup()
+		}
+	}()
+}
+
+// backupStatus returns the schedule, last result and the backups on disk
+func backupStatus() (BackupStatus, error) {
+	backupSchedule.Lock()
+	cfg := backupSchedule.cfg
+	status := BackupStatus{
+		Enabled:       cfg.Dir != "",
+		Dir:           cfg.Dir,
+		Format:        cfg.Format,
+		IntervalHours: cfg.IntervalHours,
+		Keep:          cfg.Keep,
+		LastFile:      backupSchedule.lastFile,
+		LastError:     backupSchedule.lastErr,
+		History:       []BackupFile{},
+	}
+	if !backupSchedule.lastRun.IsZero() {
+		t := backupSchedule.lastRun
+		status.LastRun = &t
+	}
+	if !backupSchedule.nextRun.IsZero() {
+		t := backupSchedule.nextRun
+		status.NextRun = &t
+	}
+	backupSchedule.Unlock()
+
+	if !status.Enabled {
+		return status, nil
+	}
+	files, err := listBackupFiles(cfg.Dir)
+	if err != nil {
+		return status, err
+	}
+	status.History = files
+	return status, nil
+}
+
+// Backup API handlers
+
+// handleAPIBackup downloads a full backup
+func handleAPIBackup(c *gin.Context) {
+	b, err := newBackup()
+	if err != nil {
+		slog.Error("failed to create backup", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create backup"})
+		return
+	}
+	filename := backupPrefix + b.CreatedAt.Format(backupStamp) + ".json"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.JSON(http.StatusOK, b)
+}
+
+// handleAPIRestore replaces everything with an uploaded backup, sent as the
+// request body or as the "file" field of a multipart form
+func handleAPIRestore(c *gin.Context) {
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing backup file"})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer func() { _ = f.Close() }()
+		body = f
+	}
+
+	b, err := parseBackup(io.LimitReader(body, 256<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := restoreBackup(b); err != nil {
+		slog.Error("failed to restore backup", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore backup: " + err.Error()})
+		return
+	}
+
+	counts := make(map[string]int)
+	for table, rows := range b.Tables {
+		counts[table] = len(rows)
+	}
+	slog.Info("Backup restored", "created_at", b.CreatedAt, "version", b.Version, "zones", counts["zones"], "records", counts["records"])
+	c.JSON(http.StatusOK, gin.H{"message": "backup restored", "created_at": b.CreatedAt, "tables": counts})
+}
+
+// handleAPIBackupStatus returns the scheduled backups status and history
+func handleAPIBackupStatus(c *gin.Context) {
+	status, err := backupStatus()
+	if err != nil {
+		slog.Error("failed to list backups", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list backups"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// handleAPIRunBackup writes a scheduled backup now
+func handleAPIRunBackup(c *gin.Context) {
+	if status, _ := backupStatus(); !status.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scheduled backups are not configured (backup.dir)"})
+		return
+	}
+	path, err := runScheduledBackup()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "backup failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "backup written", "file": filepath.Base(path)})
+}
+
+// handleAPIDownloadBackupFile downloads one of the scheduled backups
+func handleAPIDownloadBackupFile(c *gin.Context) {
+	status, err := backupStatus()
+	if err != nil || !status.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "backup not found"})
+		return
+	}
+	name := c.Param("name")
+	for _, f := range status.History {
+		if f.Name == name {
+			c.FileAttachment(filepath.Join(status.Dir, f.Name), f.Name)
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "backup not found"})
+}
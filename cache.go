@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// CacheConfig configures the cache of forwarded answers
+type CacheConfig struct {
+	Enabled     *bool  `yaml:"enabled" json:"enabled,omitempty"`
+	MaxEntries  int    `yaml:"max_entries" json:"max_entries,omitempty"`
+	PersistFile string `yaml:"persist_file" json:"persist_file,omitempty"`
+	// ServeStale answers from expired entries when every forwarder fails
+	// (RFC 8767), for up to MaxStaleSec (default one day) after they
+	// expired, with a TTL of StaleTTLSec (default 30)
+	ServeStale  bool `yaml:"serve_stale" json:"serve_stale,omitempty"`
+	MaxStaleSec int  `yaml:"max_stale_seconds" json:"max_stale_seconds,omitempty"`
+	StaleTTLSec int  `yaml:"stale_ttl_seconds" json:"stale_ttl_seconds,omitempty"`
+}
+
+// cacheKey identifies a cached answer
+type cacheKey struct {
+	Name   string `json:"name"`
+	Qtype  uint16 `json:"qtype"`
+	Qclass uint16 `json:"qclass"`
+	DO     bool   `json:"do,omitempty"`
+}
+
+type cacheEntry struct {
+	msg     *dns.Msg
+	stored  time.Time
+	expires time.Time
+}
+
+// dnsCache caches forwarded responses, positive and negative (RFC 2308),
+// for the lifetime of their TTLs
+type dnsCache struct {
+	mu         sync.RWMutex
+	entries    map[cacheKey]*cacheEntry
+	maxEntries int
+	// staleWindow is how long expired entries are kept to be served
+	// stale, 0 when serve-stale is disabled
+	staleWindow time.Duration
+	staleTTL    uint32
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	stale  atomic.Uint64
+}
+
+// forwardCache is nil when caching is disabled
+var forwardCache *dnsCache
+
+func newDNSCache(maxEntries int) *dnsCache {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return &dnsCache{entries: make(map[cacheKey]*cacheEntry), maxEntries: maxEntries}
+}
+
+func keyForQuestion(r *dns.Msg) cacheKey {
+	q := r.Question[0]
+	k := cacheKey{Name: strings.ToLower(q.Name), Qtype: q.Qtype, Qclass: q.Qclass}
+	if opt := r.IsEdns0(); opt != nil {
+		k.DO = opt.Do()
+	}
+	return k
+}
+
+// Get returns a copy of the cached response for r with TTLs decremented by
+// the time spent in the cache, or nil on a miss
+func (c *dnsCache) Get(r *dns.Msg) *dns.Msg {
+	if c == nil {
+		return nil
+	}
+	k := keyForQuestion(r)
+	c.mu.RLock()
+	e, ok := c.entries[k]
+	c.mu.RUnlock()
+
+	now := time.Now()
+	if !ok || now.After(e.expires) {
+		c.misses.Add(1)
+		return nil
+	}
+	c.hits.Add(1)
+
+	resp := e.msg.Copy()
+	resp.Id = r.Id
+	resp.Question = r.Question
+	ageRRs(resp, uint32(now.Sub(e.stored).Seconds()))
+	return resp
+}
+
+// GetStale returns a copy of the expired response for r when it expired
+// less than the stale window ago, with the stale TTL and an Extended DNS
+// Error "Stale Answer" (RFC 8914), or nil
+func (c *dnsCache) GetStale(r *dns.Msg) *dns.Msg {
+	if c == nil || c.staleWindow == 0 {
+		return nil
+	}
+	c.mu.RLock()
+	e, ok := c.entries[keyForQuestion(r)]
+	c.mu.RUnlock()
+	if !ok || time.Now().After(e.expires.Add(c.staleWindow)) {
+		return nil
+	}
+	c.stale.Add(1)
+
+	resp := e.msg.Copy()
+	resp.Id = r.Id
+	resp.Question = r.Question
+	for _, section := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range section {
+			if h := rr.Header(); h.Rrtype != dns.TypeOPT {
+				h.Ttl = min(h.Ttl, c.staleTTL)
+			}
+		}
+	}
+	if opt := resp.IsEdns0(); opt != nil {
+		opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeStaleAnswer})
+	}
+	return resp
+}
+
+// Set stores a forwarded response. Only NOERROR and NXDOMAIN answers that
+// were not truncated are cached.
+func (c *dnsCache) Set(r, resp *dns.Msg) {
+	if c == nil || resp == nil || resp.Truncated {
+		return
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return
+	}
+	ttl, ok := cacheTTL(resp)
+	if !ok || ttl == 0 {
+		return
+	}
+
+	msg := resp.Copy()
+	// Clients must not keep the SOA of a negative answer longer than we do
+	for _, rr := range msg.Ns {
+		if soa, ok := rr.(*dns.SOA); ok && soa.Hdr.Ttl > ttl {
+			soa.Hdr.Ttl = ttl
+		}
+	}
+
+	now := time.Now()
+	e := &cacheEntry{msg: msg, stored: now, expires: now.Add(time.Duration(ttl) * time.Second)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.maxEntries {
+		c.evictLocked(now)
+	}
+	c.entries[keyForQuestion(r)] = e
+}
+
+// Purge drops the entries for name, of every type, and returns how many
+// there were
+func (c *dnsCache) Purge(name string) int {
+	if c == nil {
+		return 0
+	}
+	name = strings.ToLower(dns.Fqdn(name))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for k := range c.entries {
+		if k.Name == name {
+			delete(c.entries, k)
+			n++
+		}
+	}
+	return n
+}
+
+// evictLocked drops expired entries past the stale window, then arbitrary
+// ones until there is room
+func (c *dnsCache) evictLocked(now time.Time) {
+	for k, e := range c.entries {
+		if now.After(e.expires.Add(c.staleWindow)) {
+			delete(c.entries, k)
+		}
+	}
+	for k := range c.entries {
+		if len(c.entries) < c.maxEntries {
+			break
+		}
+		delete(c.entries, k)
+	}
+}
+
+// Len returns the number of cached entries
+func (c *dnsCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
+
+// Stats returns cache counters for /api/health
+func (c *dnsCache) Stats() map[string]any {
+	if c == nil {
+		return nil
+	}
+	return map[string]any{
+		"entries": c.Len(),
+		"hits":    c.hits.Load(),
+		"misses":  c.misses.Load(),
+		"stale":   c.stale.Load(),
+	}
+}
+
+// cacheTTL returns how long a response may be cached: the smallest TTL in
+// the answer/authority sections, or for negative answers the SOA TTL capped
+// by its MINIMUM field (RFC 2308)
+func cacheTTL(resp *dns.Msg) (uint32, bool) {
+	negative := resp.Rcode == dns.RcodeNameError || len(resp.Answer) == 0
+	if negative {
+		for _, rr := range resp.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				return clampTTL(min(soa.Hdr.Ttl, soa.Minttl)), true
+			}
+		}
+		return 0, false
+	}
+
+	ttl := uint32(0)
+	found := false
+	for _, rr := range append(resp.Answer, resp.Ns...) {
+		if !found || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+			found = true
+		}
+	}
+	return ttl, found
+}
+
+// ageRRs decrements every TTL in msg by elapsed seconds
+func ageRRs(msg *dns.Msg, elapsed uint32) {
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			h := rr.Header()
+			if h.Rrtype == dns.TypeOPT {
+				continue
+			}
+			if h.Ttl > elapsed {
+				h.Ttl -= elapsed
+			} else {
+				h.Ttl = 0
+			}
+		}
+	}
+}
+
+// persistedEntry is the on-disk form of a cache entry
+type persistedEntry struct {
+	Key     cacheKey  `json:"key"`
+	Msg     []byte    `json:"msg"` // wire format
+	Stored  time.Time `json:"stored"`
+	Expires time.Time `json:"expires"`
+}
+
+// Save writes the entries that can still be served, fresh or stale, to
+// path, atomically replacing it
+func (c *dnsCache) Save(path string) error {
+	if c == nil {
+		return nil
+	}
+	now := time.Now()
+
+	c.mu.RLock()
+	out := make([]persistedEntry, 0, len(c.entries))
+	for k, e := range c.entries {
+		if now.After(e.expires.Add(c.staleWindow)) {
+			continue
+		}
+		wire, err := e.msg.Pack()
+		if err != nil {
+			continue
+		}
+		out = append(out, persistedEntry{Key: k, Msg: wire, Stored: e.stored, Expires: e.expires})
+	}
+	c.mu.RUnlock()
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".cache-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load restores entries saved by Save, skipping those that expired (past
+// the stale window) while the server was down. It returns the number of entries restored.
+func (c *dnsCache) Load(path string) (int, error) {
+	if c == nil {
+		return 0, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var in []persistedEntry
+	if err := json.Unmarshal(data, &in); err != nil {
+		return 0, fmt.Errorf("invalid cache file %s: %w", path, err)
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	restored := 0
+	for _, p := range in {
+		if now.After(p.Expires.Add(c.staleWindow)) || len(c.entries) >= c.maxEntries {
+			continue
+		}
+		msg := new(dns.Msg)
+		if err := msg.Unpack(p.Msg); err != nil {
+			continue
+		}
+		c.entries[p.Key] = &cacheEntry{msg: msg, stored: p.Stored, expires: p.Expires}
+		restored++
+	}
+	return restored, nil
+}
+
+// initCache creates the forward cache and restores a persisted one
+func initCache(cfg CacheConfig) {
+	if cfg.Enabled != nil && !*cfg.Enabled {
+		return
+	}
+	forwardCache = newDNSCache(cfg.MaxEntries)
+	if cfg.ServeStale {
+		forwardCache.staleWindow = 24 * time.Hour
+		if cfg.MaxStaleSec > 0 {
+			forwardCache.staleWindow = time.Duration(cfg.MaxStaleSec) * time.Second
+		}
+		forwardCache.staleTTL = 30
+		if cfg.StaleTTLSec > 0 {
+			forwardCache.staleTTL = uint32(cfg.StaleTTLSec)
+		}
+	}
+
+	if cfg.PersistFile != "" {
+		n, err := forwardCache.Load(cfg.PersistFile)
+		switch {
+		case err == nil:
+			slog.Info("Restored DNS cache", "file", cfg.PersistFile, "entries", n)
+		case os.IsNotExist(err):
+		default:
+			slog.Warn("failed to restore DNS cache", "file", cfg.PersistFile, "error", err)
+		}
+	}
+}
+
+// saveCache persists the forward cache on shutdown
+func saveCache(cfg CacheConfig) {
+	if forwardCache == nil || cfg.PersistFile == "" {
+		return
+	}
+	if err := forwardCache.Save(cfg.PersistFile); err != nil {
+		slog.Warn("failed to persist DNS cache", "file", cfg.PersistFile, "error", err)
+		return
+	}
+	slog.Info("Persisted DNS cache", "file", cfg.PersistFile, "entries", forwardCache.Len())
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// catalogZone is the name of the RFC 9432 catalog zone listing every zone
+// served here, "" to disable it. Secondaries (BIND, Knot, ...) configured
+// with it as a catalog add and remove member zones automatically.
+var catalogZone string
+
+// catalogState keeps the catalog serial stable while the member list does
+// not change, and moves it forward when it does
+var catalogState struct {
+	mu      sync.Mutex
+	members string
+	serial  uint32
+}
+
+// catalogSerial returns the serial for the given member list
+func catalogSerial(members []string) uint32 {
+	catalogState.mu.Lock()
+	defer catalogState.mu.Unlock()
+	key := strings.Join(members, " ")
+	if catalogState.serial != 0 && key == catalogState.members {
+		return catalogState.serial
+	}
+	// Start from the clock so a restart does not go backwards
+	next := uint32(time.Now().Unix())
+	if !serialNewer(next, catalogState.serial) {
+		next = catalogState.serial + 1
+	}
+	catalogState.members = key
+	catalogState.serial = next
+	return next
+}
+
+// catalogMemberID returns the stable unique label of a member zone
+func catalogMemberID(zone string) string {
+	sum := sha1.Sum([]byte(strings.ToLower(dns.Fqdn(zone))))
+	return hex.EncodeToString(sum[:])
+}
+
+// addCatalogZone adds the catalog zone, listing the zones already in zd,
+// to the snapshot
+func addCatalogZone(zd *ZoneData) {
+	if catalogZone == "" {
+		return
+	}
+	catalog := dns.Fqdn(strings.ToLower(catalogZone))
+
+	var members []string
+	for _, name := range zd.ZoneNames() {
+		if !strings.EqualFold(name, catalog) {
+			members = append(members, strings.ToLower(name))
+		}
+	}
+	sort.Strings(members)
+
+	zd.AddZone(catalog)
+	// RFC 9432: the SOA and NS are required but never used for resolution
+	zd.AddRR(mustNewRR(fmt.Sprintf("%s 0 IN SOA invalid. invalid. %d 300 60 604800 0", catalog, catalogSerial(members))))
+	zd.AddRR(mustNewRR(fmt.Sprintf("%s 0 IN NS invalid.", catalog)))
+	zd.AddRR(mustNewRR(fmt.Sprintf("version.%s 0 IN TXT \"2\"", catalog)))
+	for _, member := range members {
+		zd.AddRR(mustNewRR(fmt.Sprintf("%s.zones.%s 0 IN PTR %s", catalogMemberID(member), catalog, member)))
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// certExpiryWarning is how long before expiry the certificate is reported
+// in /api/health and the logs
+const certExpiryWarning = 14 * 24 * time.Hour
+
+// certHolder holds the certificate served by the TLS listeners. Listeners
+// fetch it through GetCertificate on every handshake, so replacing it
+// (e.g. after an ACME renewal) takes effect without restarting anything.
+// The fallback (self-signed) certificate is served until one is loaded.
+type certHolder struct {
+	current  atomic.Pointer[tls.Certificate]
+	fallback atomic.Pointer[tls.Certificate]
+}
+
+var serverCert = &certHolder{}
+
+// Set replaces the served certificate
+func (h *certHolder) Set(cert *tls.Certificate) {
+	h.current.Store(cert)
+}
+
+// SetFallback sets the certificate served while none is loaded
+func (h *certHolder) SetFallback(cert *tls.Certificate) {
+	h.fallback.Store(cert)
+}
+
+// Get returns the served certificate, or nil if none is loaded
+func (h *certHolder) Get() *tls.Certificate {
+	return h.current.Load()
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (h *certHolder) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert := h.current.Load()
+	if cert == nil {
+		cert = h.fallback.Load()
+	}
+	if cert == nil {
+		return nil, fmt.Errorf("no certificate loaded")
+	}
+	return cert, nil
+}
+
+// NotAfter returns the expiry of the served certificate (zero if none)
+func (h *certHolder) NotAfter() time.Time {
+	cert := h.current.Load()
+	if cert == nil || cert.Leaf == nil {
+		return time.Time{}
+	}
+	return cert.Leaf.NotAfter
+}
+
+// serverTLSConfig returns a TLS config bound to the served certificate
+func serverTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: serverCert.GetCertificate,
+	}
+}
+
+// parseCertificatePEM builds a tls.Certificate with its Leaf populated
+func parseCertificatePEM(certPEM, keyPEM []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil && len(cert.Certificate) > 0 {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+		cert.Leaf = leaf
+	}
+	return &cert, nil
+}
+
+// loadCertificateFiles loads a PEM certificate/key pair from disk and makes
+// it the served certificate
+func loadCertificateFiles(certFile, keyFile string) error {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := parseCertificatePEM(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	serverCert.Set(cert)
+	slog.Info("Loaded TLS certificate", "file", certFile, "dns_names", cert.Leaf.DNSNames, "not_after", cert.Leaf.NotAfter)
+	return nil
+}
+
+// fileModTime returns the modification time of path (zero if missing)
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// watchCertificates keeps the served certificate fresh without restarting
+// listeners: it reloads the certificate files when they change on disk and
+// picks up certificates stored in the database by another instance (ACME).
+// It also logs a warning once a day while the certificate is close to expiry.
+func watchCertificates(certFile, keyFile string, interval time.Duration) {
+	go func() {
+		certMod, keyMod := fileModTime(certFile), fileModTime(keyFile)
+		var lastWarning time.Time
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if certFile != "" {
+				c, k := fileModTime(certFile), fileModTime(keyFile)
+				if !c.Equal(certMod) || !k.Equal(keyMod) {
+					// On failure (e.g. key not yet rewritten) keep the old
+					// mtimes so the next tick retries
+					if err := loadCertificateFiles(certFile, keyFile); err != nil {
+						slog.Warn("failed to reload TLS certificate, keeping the current one", "file", certFile, "error", err)
+					} else {
+						certMod, keyMod = c, k
+					}
+				}
+			} else if acmeConfig.Enabled && database != nil {
+				if stored, err := database.GetCertificate(acmeCertName); err == nil && stored.NotAfter.After(serverCert.NotAfter()) {
+					if cert, err := parseCertificatePEM([]byte(stored.CertPEM), []byte(stored.KeyPEM)); err == nil {
+						serverCert.Set(cert)
+						slog.Info("Reloaded TLS certificate from database", "not_after", cert.Leaf.NotAfter)
+					}
+				}
+			}
+
+			if notAfter := serverCert.NotAfter(); !notAfter.IsZero() && time.Until(notAfter) < certExpiryWarning && time.Since(lastWarning) > 24*time.Hour {
+				slog.Warn("TLS certificate expires soon", "not_after", notAfter)
+				raiseAlert(alertCertificate, "certificate expiry", "TLS certificate expires soon",
+					fmt.Sprintf("The TLS certificate of the web interface and the DoT/DoQ listeners expires on %s.", notAfter.Local().Format(time.RFC1123)))
+				lastWarning = time.Now()
+			}
+		}
+	}()
+}
+
+// certificateHealth reports the served certificate for /api/health, or nil
+// when no TLS certificate is loaded
+func certificateHealth() gin.H {
+	cert := serverCert.Get()
+	if cert == nil || cert.Leaf == nil {
+		return nil
+	}
+	remaining := time.Until(cert.Leaf.NotAfter)
+	h := gin.H{
+		"dns_names": cert.Leaf.DNSNames,
+		"not_after": cert.Leaf.NotAfter,
+		"days_left": int(remaining.Hours() / 24),
+	}
+	if remaining < certExpiryWarning {
+		h["warning"] = "certificate expires soon"
+	}
+	if remaining <= 0 {
+		h["warning"] = "certificate has expired"
+	}
+	return h
+}
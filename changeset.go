@@ -0,0 +1,331 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChangesetDiff shows one staged change as the record lines it removes and
+// adds, in zone file format
+type ChangesetDiff struct {
+	ChangeID int64  `json:"change_id"`
+	Action   string `json:"action"`
+	Before   string `json:"before,omitempty"`
+	After    string `json:"after,omitempty"`
+	Error    string `json:"error,omitempty"` // the change cannot be applied
+}
+
+// ChangesetView is a changeset with its diff against the live records and
+// the problems the zone would have once it is applied
+type ChangesetView struct {
+	DBChangeset
+	Zone     string          `json:"zone"`
+	Diff     []ChangesetDiff `json:"diff"`
+	Valid    bool            `json:"valid"`
+	Problems []ZoneProblem   `json:"problems"`
+}
+
+// recordLine renders a database record the way it is served, or as typed
+// when it does not parse, with its schedule, notes and cache control as
+// comments
+func recordLine(zoneName string, r DBRecord) string {
+	line := fmt.Sprintf("%s\t%d\tIN\t%s\t%s", r.Name, r.TTL, r.Type, r.Value)
+	if rr, err := recordToRR(zoneName, r); err == nil {
+		line = rr.String()
+	}
+	if r.ActivateAt != nil || r.ExpireAt != nil {
+		activateAt, expireAt := r.columns()
+		line += fmt.Sprintf(" ; active %s..%s", activateAt, expireAt)
+	}
+	if r.Comment != "" {
+		line += " ; " + r.Comment
+	}
+	if len(r.Tags) > 0 {
+		line += " ; tags " + r.tagsColumn()
+	}
+	if r.NoCache {
+		line += " ; no-cache"
+	}
+	return line
+}
+
+// previewChangeset applies the changes of cs to the records of its zone in
+// memory
+func previewChangeset(zone *DBZone, cs *DBChangeset) (*ChangesetView, error) {
+	records, err := database.ListRecordsByZone(zone.ID)
+	if err != nil {
+		return nil, err
+	}
+	view := &ChangesetView{DBChangeset: *cs, Zone: zone.Name, Diff: []ChangesetDiff{}}
+	find := func(id int64) int {
+		for i, r := range records {
+			if r.ID == id {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, ch := range cs.Changes {
+		d := ChangesetDiff{ChangeID: ch.ID, Action: ch.Action}
+		staged := DBRecord{ZoneID: zone.ID, Name: ch.Name, Type: ch.Type, Value: ch.Value, TTL: ch.TTL, Priority: ch.Priority, RecordSchedule: ch.RecordSchedule, RecordNotes: ch.RecordNotes, RecordCaching: ch.RecordCaching}
+		if ch.Action == "create" {
+			d.After = recordLine(zone.Name, staged)
+			records = append(records, staged)
+			view.Diff = append(view.Diff, d)
+			continue
+		}
+		i := find(ch.RecordID)
+		if i < 0 {
+			d.Error = fmt.Sprintf("record %d no longer exists", ch.RecordID)
+			view.Diff = append(view.Diff, d)
+			continue
+		}
+		d.Before = recordLine(zone.Name, records[i])
+		if ch.Action == "update" {
+			staged.ID = ch.RecordID
+			d.After = recordLine(zone.Name, staged)
+			records[i] = staged
+		} else {
+			records = append(records[:i], records[i+1:]...)
+		}
+		view.Diff = append(view.Diff, d)
+	}
+
+	view.Problems = checkZoneRecords(zone, records)
+	view.Valid = !hasErrors(view.Problems)
+	return view, nil
+}
+
+// checkZoneRecords returns the problems zone would have with records
+func checkZoneRecords(zone *DBZone, records []DBRecord) []ZoneProblem {
+	zd := NewZoneData()
+	problems := addDBZoneRecords(zd, *zone, records)
+	problems = append(problems, lintZone(zd, zone.Name, zoneStore.Load())...)
+	if problems == nil {
+		problems = []ZoneProblem{}
+	}
+	return problems
+}
+
+// stageChange handles a record edit made with ?changeset=<id>: the change is
+// added to the changeset instead of going live. It reports whether the
+// request was handled.
+func stageChange(c *gin.Context, zoneID int64, ch DBChange) bool {
+	cs, handled := stagingChangeset(c, zoneID)
+	if cs == nil {
+		return handled
+	}
+	if addStagedChange(c, cs, &ch) {
+		c.JSON(http.StatusAccepted, ch)
+	}
+	return true
+}
+
+// stageChanges is stageChange for the changes of one edit, answered with
+// the staged changes
+func stageChanges(c *gin.Context, zoneID int64, changes []DBChange) bool {
+	cs, handled := stagingChangeset(c, zoneID)
+	if cs == nil {
+		return handled
+	}
+	for i := range changes {
+		if !addStagedChange(c, cs, &changes[i]) {
+			return true
+		}
+	}
+	c.JSON(http.StatusAccepted, changes)
+	return true
+}
+
+// stagingChangeset returns the changeset of ?changeset=<id>, nil when the
+// edit goes live or after answering an error (handled is then true)
+func stagingChangeset(c *gin.Context, zoneID int64) (cs *DBChangeset, handled bool) {
+	v := c.Query("changeset")
+	if v == "" {
+		return nil, false
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid changeset id"})
+		return nil, true
+	}
+	cs, err = database.GetChangeset(id)
+	if err != nil || cs.ZoneID != zoneID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "changeset not found for this zone"})
+		return nil, true
+	}
+	return cs, true
+}
+
+// addStagedChange adds ch to cs, or answers the error and returns false
+func addStagedChange(c *gin.Context, cs *DBChangeset, ch *DBChange) bool {
+	ch.ChangesetID = cs.ID
+	if err := database.AddChange(ch); err != nil {
+		if errors.Is(err, errChangesetConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "changeset is " + cs.Status})
+			return false
+		}
+		slog.Error("failed to stage change", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stage change"})
+		return false
+	}
+	slog.Info("Record change staged", "changeset", cs.ID, "action", ch.Action, "name", ch.Name, "record_id", ch.RecordID)
+	return true
+}
+
+// loadChangeset returns the changeset of the :id parameter, or answers the
+// request with an error
+func loadChangeset(c *gin.Context) (*DBChangeset, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid changeset id"})
+		return nil, false
+	}
+	cs, err := database.GetChangeset(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "changeset not found"})
+		return nil, false
+	}
+	return cs, true
+}
+
+// handleAPICreateChangeset handles POST /api/zones/:id/changesets
+func handleAPICreateChangeset(c *gin.Context) {
+	zoneID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone id"})
+		return
+	}
+	if _, err := database.GetZone(zoneID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+
+	cs := &DBChangeset{ZoneID: zoneID, CreatedBy: c.GetString("username")}
+	if err := database.CreateChangeset(cs); err != nil {
+		slog.Error("failed to create changeset", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create changeset"})
+		return
+	}
+
+	slog.Info("Changeset created", "id", cs.ID, "zone_id", zoneID)
+	c.JSON(http.StatusCreated, cs)
+}
+
+// handleAPIListChangesets handles GET /api/changesets?zone_id=
+func handleAPIListChangesets(c *gin.Context) {
+	var zoneID int64
+	if v := c.Query("zone_id"); v != "" {
+		var err error
+		if zoneID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone id"})
+			return
+		}
+	}
+	changesets, err := database.ListPendingChangesets(zoneID)
+	if err != nil {
+		slog.Error("failed to list changesets", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list changesets"})
+		return
+	}
+	c.JSON(http.StatusOK, changesets)
+}
+
+// handleAPIGetChangeset handles GET /api/changesets/:id
+func handleAPIGetChangeset(c *gin.Context) {
+	cs, ok := loadChangeset(c)
+	if !ok {
+		return
+	}
+	zone, err := database.GetZone(cs.ZoneID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	view, err := previewChangeset(zone, cs)
+	if err != nil {
+		slog.Error("failed to preview changeset", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to preview changeset"})
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+// handleAPIApplyChangeset handles POST /api/changesets/:id/apply
+func handleAPIApplyChangeset(c *gin.Context) {
+	cs, ok := loadChangeset(c)
+	if !ok {
+		return
+	}
+	if len(cs.Changes) == 0 && cs.Status == changesetPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "changeset is empty"})
+		return
+	}
+
+	if err := database.ApplyChangeset(cs); err != nil {
+		if errors.Is(err, errChangesetConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		slog.Error("failed to apply changeset", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply changeset"})
+		return
+	}
+
+	// Reload zones into memory
+	if err := LoadZonesFromDB(); err != nil {
+		slog.Error("failed to reload zones", "error", err)
+	}
+
+	slog.Info("Changeset applied", "id", cs.ID, "zone_id", cs.ZoneID, "changes", len(cs.Changes))
+	c.JSON(http.StatusOK, gin.H{"message": "changeset applied", "changes": len(cs.Changes)})
+}
+
+// handleAPIDiscardChangeset handles DELETE /api/changesets/:id
+func handleAPIDiscardChangeset(c *gin.Context) {
+	cs, ok := loadChangeset(c)
+	if !ok {
+		return
+	}
+	if err := database.DiscardChangeset(cs.ID); err != nil {
+		if errors.Is(err, errChangesetConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "changeset is " + cs.Status})
+			return
+		}
+		slog.Error("failed to discard changeset", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to discard changeset"})
+		return
+	}
+
+	slog.Info("Changeset discarded", "id", cs.ID, "zone_id", cs.ZoneID)
+	c.JSON(http.StatusOK, gin.H{"message": "changeset discarded"})
+}
+
+// handleAPIDeleteChange handles DELETE /api/changesets/:id/changes/:change_id
+func handleAPIDeleteChange(c *gin.Context) {
+	cs, ok := loadChangeset(c)
+	if !ok {
+		return
+	}
+	changeID, err := strconv.ParseInt(c.Param("change_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid change id"})
+		return
+	}
+	if err := database.DeleteChange(cs.ID, changeID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "change not found in a pending changeset"})
+			return
+		}
+		slog.Error("failed to delete change", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete change"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "change removed"})
+}
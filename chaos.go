@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ChaosConfig sets the answers to CHAOS class TXT queries, which operators
+// and monitoring use to ask a server its software and, behind anycast,
+// which node answered
+type ChaosConfig struct {
+	Version  string `yaml:"version" json:"version,omitempty"`   // version.bind and version.server, "simpledns <version>" when empty
+	Hostname string `yaml:"hostname" json:"hostname,omitempty"` // hostname.bind, the host name when empty
+	ID       string `yaml:"id" json:"id,omitempty"`             // id.server (RFC 4892), instance_name when empty
+	// HideVersion and HideIdentity refuse the version names and the
+	// hostname.bind and id.server names
+	HideVersion  bool `yaml:"hide_version" json:"hide_version,omitempty"`
+	HideIdentity bool `yaml:"hide_identity" json:"hide_identity,omitempty"`
+}
+
+// chaosAnswers maps the CHAOS names answered to their TXT value
+var chaosAnswers = map[string]string{}
+
+func initChaos(cfg ChaosConfig) {
+	answers := map[string]string{}
+	if !cfg.HideVersion {
+		if cfg.Version == "" {
+			cfg.Version = "simpledns " + version
+		}
+		answers["version.bind."] = cfg.Version
+		answers["version.server."] = cfg.Version
+	}
+	if !cfg.HideIdentity {
+		if cfg.Hostname == "" {
+			cfg.Hostname, _ = os.Hostname()
+		}
+		if cfg.ID == "" {
+			cfg.ID = instanceName
+		}
+		answers["hostname.bind."] = cfg.Hostname
+		answers["id.server."] = cfg.ID
+	}
+	chaosAnswers = answers
+}
+
+// handleChaos answers a CHAOS class query: TXT for the names of
+// chaosAnswers, no data for their other types and REFUSED for other names
+func handleChaos(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	q := r.Question[0]
+	value, ok := chaosAnswers[strings.ToLower(q.Name)]
+	switch {
+	case !ok:
+		m.Authoritative = false
+		m.Rcode = dns.RcodeRefused
+	case q.Qtype == dns.TypeTXT || q.Qtype == dns.TypeANY:
+		m.Answer = append(m.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS},
+			Txt: []string{value},
+		})
+	}
+	if err := w.WriteMsg(m); err != nil {
+		slog.Debug("failed to write CHAOS response", "client", w.RemoteAddr(), "error", err)
+	}
+}
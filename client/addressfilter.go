@@ -0,0 +1,27 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// AddressFilter returns the rules hiding AAAA or A answers from clients
+func (c *Client) AddressFilter(ctx context.Context) ([]AddressFilterRule, error) {
+	var rules []AddressFilterRule
+	if err := c.do(ctx, http.MethodGet, "/api/address-filter", nil, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// SetAddressFilter replaces the rules hiding AAAA or A answers from clients
+func (c *Client) SetAddressFilter(ctx context.Context, rules []AddressFilterRule) ([]AddressFilterRule, error) {
+	if rules == nil {
+		rules = []AddressFilterRule{}
+	}
+	var out []AddressFilterRule
+	if err := c.do(ctx, http.MethodPut, "/api/address-filter", rules, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,166 @@
+// Package client is a Go client for the SimpleDNS REST API (sqlite mode).
+//
+//	c := client.New("http://localhost:8080", os.Getenv("SIMPLEDNS_TOKEN"))
+//	zones, err := c.ListZones(ctx)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client talks to a SimpleDNS server using an API token
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	userAgent  string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) { c.httpClient = h }
+}
+
+// WithUserAgent sets the User-Agent header sent with requests
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua }
+}
+
+// New returns a client for the server at baseURL (e.g. "http://dns:8080"),
+// authenticating with an API token created on the account page
+func New(baseURL, token string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		userAgent:  "simpledns-go-client",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// APIError is returned when the server answers with an error status
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Confirm is the token to send back to confirm the request, e.g. to
+	// delete a zone holding many records
+	Confirm string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("simpledns: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsNotFound reports whether err is an API error with status 404
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsConflict reports whether err is an API error with status 412: the
+// zone or record was modified since the version the update was based on
+func IsConflict(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusPreconditionFailed
+}
+
+// ConfirmToken returns the token the server asks for to confirm the
+// request that failed with err, "" when err is not such a refusal
+func ConfirmToken(err error) string {
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusConflict {
+		return apiErr.Confirm
+	}
+	return ""
+}
+
+// do sends a request with an optional JSON body and decodes the JSON
+// response into out (if not nil)
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	return c.doIfMatch(ctx, method, path, "", body, out)
+}
+
+// doIfMatch is do with an If-Match header when ifMatch is set
+func (c *Client) doIfMatch(ctx context.Context, method, path, ifMatch string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 400 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		var payload struct {
+			Error   string `json:"error"`
+			Confirm string `json:"confirm"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(data, &payload) == nil && payload.Error != "" {
+			apiErr.Message = payload.Error
+			apiErr.Confirm = payload.Confirm
+		} else {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return apiErr
+	}
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ifMatch returns the If-Match header of an update based on version
+func ifMatch(version int64) string {
+	if version == 0 {
+		return "*"
+	}
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// Health returns the server health report (no authentication needed)
+func (c *Client) Health(ctx context.Context) (map[string]any, error) {
+	var health map[string]any
+	if err := c.do(ctx, http.MethodGet, "/api/health", nil, &health); err != nil {
+		return nil, err
+	}
+	return health, nil
+}
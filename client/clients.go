@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ListClients returns the clients of the server and their query counts
+func (c *Client) ListClients(ctx context.Context) (*ClientsReport, error) {
+	var report ClientsReport
+	if err := c.do(ctx, http.MethodGet, "/api/clients", nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// SetClient sets the label and policy of the client at address; empty
+// settings forget it
+func (c *Client) SetClient(ctx context.Context, address string, settings ClientSettings) (*ClientInfo, error) {
+	var info ClientInfo
+	if err := c.do(ctx, http.MethodPut, "/api/clients/"+url.PathEscape(address), settings, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// PauseClient refuses the names out of the local zones to the client at
+// address for minutes, 30 when zero
+func (c *Client) PauseClient(ctx context.Context, address string, minutes int) (*ClientInfo, error) {
+	var info ClientInfo
+	if err := c.do(ctx, http.MethodPost, "/api/clients/"+url.PathEscape(address)+"/pause", map[string]int{"minutes": minutes}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// ResumeClient ends the pause of the client at address
+func (c *Client) ResumeClient(ctx context.Context, address string) (*ClientInfo, error) {
+	var info ClientInfo
+	if err := c.do(ctx, http.MethodDelete, "/api/clients/"+url.PathEscape(address)+"/pause", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// ListSchedules returns the access schedules
+func (c *Client) ListSchedules(ctx context.Context) ([]AccessSchedule, error) {
+	var schedules []AccessSchedule
+	if err := c.do(ctx, http.MethodGet, "/api/schedules", nil, &schedules); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// CreateSchedule adds an access schedule
+func (c *Client) CreateSchedule(ctx context.Context, s AccessSchedule) (*AccessSchedule, error) {
+	var out AccessSchedule
+	if err := c.do(ctx, http.MethodPost, "/api/schedules", s, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateSchedule replaces the access schedule s.ID
+func (c *Client) UpdateSchedule(ctx context.Context, s AccessSchedule) (*AccessSchedule, error) {
+	var out AccessSchedule
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/schedules/%d", s.ID), s, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteSchedule deletes an access schedule
+func (c *Client) DeleteSchedule(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/schedules/%d", id), nil, nil)
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ListForwarders returns the configured upstream servers
+func (c *Client) ListForwarders(ctx context.Context) ([]Forwarder, error) {
+	var forwarders []Forwarder
+	if err := c.do(ctx, http.MethodGet, "/api/forwarders", nil, &forwarders); err != nil {
+		return nil, err
+	}
+	return forwarders, nil
+}
+
+// CreateForwarder adds an upstream server (host[:port])
+func (c *Client) CreateForwarder(ctx context.Context, address string, priority int) (*Forwarder, error) {
+	in := struct {
+		Address  string `json:"address"`
+		Priority int    `json:"priority"`
+	}{address, priority}
+	var forwarder Forwarder
+	if err := c.do(ctx, http.MethodPost, "/api/forwarders", in, &forwarder); err != nil {
+		return nil, err
+	}
+	return &forwarder, nil
+}
+
+// UpdateForwarder changes the priority and options of an upstream server
+func (c *Client) UpdateForwarder(ctx context.Context, id int64, f Forwarder) (*Forwarder, error) {
+	in := struct {
+		Priority  int `json:"priority"`
+		TimeoutMS int `json:"timeout_ms"`
+		Retries   int `json:"retries"`
+		BackoffMS int `json:"backoff_ms"`
+		Weight    int `json:"weight"`
+	}{f.Priority, f.TimeoutMS, f.Retries, f.BackoffMS, f.Weight}
+	var forwarder Forwarder
+	if err := c.do(ctx, http.MethodPut, "/api/forwarders/"+strconv.FormatInt(id, 10), in, &forwarder); err != nil {
+		return nil, err
+	}
+	return &forwarder, nil
+}
+
+// ReorderForwarders gives the forwarders ids the priorities 0, 1, 2... in
+// order and returns the forwarders
+func (c *Client) ReorderForwarders(ctx context.Context, ids []int64) ([]Forwarder, error) {
+	in := struct {
+		IDs []int64 `json:"ids"`
+	}{ids}
+	var forwarders []Forwarder
+	if err := c.do(ctx, http.MethodPut, "/api/forwarders/order", in, &forwarders); err != nil {
+		return nil, err
+	}
+	return forwarders, nil
+}
+
+// ReplaceForwarders replaces the upstream servers with addresses, the
+// first one asked first. Servers kept keep their options.
+func (c *Client) ReplaceForwarders(ctx context.Context, addresses []string) ([]Forwarder, error) {
+	in := struct {
+		Addresses []string `json:"addresses"`
+	}{addresses}
+	var forwarders []Forwarder
+	if err := c.do(ctx, http.MethodPut, "/api/forwarders", in, &forwarders); err != nil {
+		return nil, err
+	}
+	return forwarders, nil
+}
+
+// BenchmarkForwarders benchmarks the upstream servers and the candidates
+// (host[:port]). Empty names and zero rounds use the server defaults.
+func (c *Client) BenchmarkForwarders(ctx context.Context, candidates, names []string, rounds int) (*BenchmarkResult, error) {
+	in := struct {
+		Candidates []string `json:"candidates,omitempty"`
+		Names      []string `json:"names,omitempty"`
+		Rounds     int      `json:"rounds,omitempty"`
+	}{candidates, names, rounds}
+	var result BenchmarkResult
+	if err := c.do(ctx, http.MethodPost, "/api/forwarders/benchmark", in, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteForwarder removes an upstream server by id
+func (c *Client) DeleteForwarder(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, "/api/forwarders/"+strconv.FormatInt(id, 10), nil, nil)
+}
+
+// DeleteForwarderByAddress removes an upstream server by address
+func (c *Client) DeleteForwarderByAddress(ctx context.Context, address string) error {
+	return c.do(ctx, http.MethodDelete, "/api/forwarders/"+url.PathEscape(address), nil, nil)
+}
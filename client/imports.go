@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// ImportZone creates a zone with the records of a provider or zone file.
+// Records that cannot be imported are returned as skipped.
+func (c *Client) ImportZone(ctx context.Context, in ZoneImport) (*Zone, []SkippedRecord, error) {
+	var out struct {
+		Zone    Zone            `json:"zone"`
+		Skipped []SkippedRecord `json:"skipped"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/import/zones", in, &out); err != nil {
+		return nil, nil, err
+	}
+	return &out.Zone, out.Skipped, nil
+}
+
+// PreviewImport returns the records ImportZone would create, without
+// changing anything
+func (c *Client) PreviewImport(ctx context.Context, in ZoneImport) ([]Record, []SkippedRecord, error) {
+	body := struct {
+		ZoneImport
+		DryRun bool `json:"dry_run"`
+	}{in, true}
+	var out struct {
+		Records []Record        `json:"records"`
+		Skipped []SkippedRecord `json:"skipped"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/import/zones", body, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Records, out.Skipped, nil
+}
+
+// MigrateResolver imports the forwarders and local records of another
+// resolver's configuration. format is resolv, dnsmasq or unbound; with
+// dryRun the plan is returned without changing anything.
+func (c *Client) MigrateResolver(ctx context.Context, format, data string, dryRun bool) (*MigrationPlan, error) {
+	body := struct {
+		Format string `json:"format"`
+		Data   string `json:"data"`
+		DryRun bool   `json:"dry_run"`
+	}{format, data, dryRun}
+	var out MigrationPlan
+	if err := c.do(ctx, http.MethodPost, "/api/import/resolver", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
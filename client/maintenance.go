@@ -0,0 +1,27 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Maintenance returns the maintenance mode of the server
+func (c *Client) Maintenance(ctx context.Context) (*Maintenance, error) {
+	var m Maintenance
+	if err := c.do(ctx, http.MethodGet, "/api/maintenance", nil, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// SetMaintenance replaces the maintenance mode of the server
+func (c *Client) SetMaintenance(ctx context.Context, m Maintenance) (*Maintenance, error) {
+	if m.Zones == nil {
+		m.Zones = []string{}
+	}
+	var out Maintenance
+	if err := c.do(ctx, http.MethodPut, "/api/maintenance", m, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,393 @@
+package client
+
+import "time"
+
+// Zone is a DNS zone and its SOA settings
+type Zone struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Enabled    bool   `json:"enabled"`
+	TTL        int    `json:"ttl"`
+	NS         string `json:"ns"`
+	Admin      string `json:"admin"`
+	Serial     int    `json:"serial"`
+	Refresh    int    `json:"refresh"`
+	Retry      int    `json:"retry"`
+	Expire     int    `json:"expire"`
+	Minimum    int    `json:"minimum"`
+	NSAddress  string `json:"ns_address,omitempty"` // glue of an in-zone NS, comma-separated
+	Type       string `json:"type,omitempty"`       // primary, forward or secondary
+	Forwarders string `json:"forwarders,omitempty"` // of a forward zone, comma-separated
+	Primaries  string `json:"primaries,omitempty"`  // of a secondary zone, comma-separated
+	// AddressFilter is AAAA or A: that type is hidden for names having
+	// the other one
+	AddressFilter string `json:"address_filter,omitempty"`
+	RecordCount   int    `json:"record_count,omitempty"` // only set by ListZones
+	Version       int64  `json:"version"`                // counts the updates
+}
+
+// ZoneInput holds the fields to create or update a zone. Zero values use
+// the server defaults.
+type ZoneInput struct {
+	Name    string `json:"name"`
+	Enabled *bool  `json:"enabled,omitempty"`
+	TTL     int    `json:"ttl,omitempty"`
+	NS      string `json:"ns,omitempty"`
+	Admin   string `json:"admin,omitempty"`
+	Refresh int    `json:"refresh,omitempty"`
+	Retry   int    `json:"retry,omitempty"`
+	Expire  int    `json:"expire,omitempty"`
+	Minimum int    `json:"minimum,omitempty"`
+	// NSAddress lists the addresses of an NS name inside the zone,
+	// comma-separated
+	NSAddress string `json:"ns_address,omitempty"`
+	// Type is primary (the default), forward or secondary; the names of
+	// a forward zone are sent to Forwarders (comma-separated host[:port]),
+	// a secondary zone is transferred from Primaries (IP[:port])
+	Type       string `json:"type,omitempty"`
+	Forwarders string `json:"forwarders,omitempty"`
+	Primaries  string `json:"primaries,omitempty"`
+	// AddressFilter is AAAA, A or "" for none; nil keeps the current value
+	// on update
+	AddressFilter *string `json:"address_filter,omitempty"`
+	// Version is the Zone.Version an update is based on: the server
+	// refuses it if the zone changed since. 0 overwrites unconditionally.
+	Version int64 `json:"-"`
+}
+
+// AddressFilterRule hides the AAAA (or A) answers of names having the
+// other type from the clients of some networks
+type AddressFilterRule struct {
+	Clients []string `json:"clients"` // addresses or CIDR prefixes
+	Type    string   `json:"type"`    // AAAA or A
+}
+
+// Sinkhole is the sinkhole configuration and its hits since the server
+// started. CustomDomains are the domains managed through the API.
+type Sinkhole struct {
+	Enabled       bool           `json:"enabled"`
+	IPv4          string         `json:"ipv4,omitempty"`
+	IPv6          string         `json:"ipv6,omitempty"`
+	Domains       []string       `json:"domains"`
+	CustomDomains []string       `json:"custom_domains"`
+	Lists         []SinkholeList `json:"lists"`
+	Blocked       int            `json:"blocked"`
+	Hits          uint64         `json:"hits"`
+	TopHits       []SinkholeHit  `json:"top_hits"`
+}
+
+// SinkholeList is the last load of one blocklist
+type SinkholeList struct {
+	Source   string    `json:"source"`
+	Domains  int       `json:"domains"`
+	Error    string    `json:"error,omitempty"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// SinkholeHit counts the queries for one blocked domain
+type SinkholeHit struct {
+	Domain string `json:"key"`
+	Count  uint64 `json:"count"`
+}
+
+// Record is a resource record of a zone. Name is relative to the zone
+// ("@" for the apex) unless it ends with a dot.
+type Record struct {
+	ID       int64  `json:"id"`
+	ZoneID   int64  `json:"zone_id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	TTL      int    `json:"ttl"`
+	Priority int    `json:"priority"`
+	Version  int64  `json:"version"` // counts the updates
+	// ActivateAt and ExpireAt bound the window in which the record is
+	// served; the server deletes it once expired
+	ActivateAt *time.Time `json:"activate_at,omitempty"`
+	ExpireAt   *time.Time `json:"expire_at,omitempty"`
+	Comment    string     `json:"comment,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	// NoCache serves the record with a TTL of 0 and keeps the forwarded
+	// answers for its name out of the cache
+	NoCache bool `json:"no_cache,omitempty"`
+}
+
+// RecordRefreshResult is the outcome of RefreshRecord
+type RecordRefreshResult struct {
+	Name   string `json:"name"`
+	Purged int    `json:"purged"` // cached answers dropped
+}
+
+// RecordSearchResult is a record found by SearchRecords, with its zone
+type RecordSearchResult struct {
+	Record
+	Zone string `json:"zone"`
+}
+
+// RecordInput holds the fields to create or update a record
+type RecordInput struct {
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	Value      string     `json:"value"`
+	TTL        int        `json:"ttl,omitempty"`
+	Priority   int        `json:"priority,omitempty"`
+	ActivateAt *time.Time `json:"activate_at,omitempty"`
+	ExpireAt   *time.Time `json:"expire_at,omitempty"`
+	Comment    string     `json:"comment,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	NoCache    bool       `json:"no_cache,omitempty"`
+	// Version is the Record.Version an update is based on: the server
+	// refuses it if the record changed since. 0 overwrites unconditionally.
+	Version int64 `json:"-"`
+}
+
+// RRSet is the set of records of a name and type, served with one TTL
+type RRSet struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl"`
+	Values  []string `json:"values"`
+	Records []Record `json:"records,omitempty"`
+}
+
+// RRSetInput replaces the records of a set: one per value, all with TTL
+// (the one of the current records when 0). No values deletes the set.
+type RRSetInput struct {
+	TTL    int      `json:"ttl,omitempty"`
+	Values []string `json:"values"`
+	// Serial is the Zone.Serial the change is based on: the server refuses
+	// it if the zone changed since. 0 overwrites unconditionally.
+	Serial int64 `json:"-"`
+}
+
+// Forwarder is an upstream DNS server
+type Forwarder struct {
+	ID       int64  `json:"id"`
+	Address  string `json:"address"`
+	Priority int    `json:"priority"`
+	// TimeoutMS, Retries, BackoffMS and Weight tune the queries to the
+	// server; zero uses the server defaults
+	TimeoutMS int `json:"timeout_ms,omitempty"`
+	Retries   int `json:"retries,omitempty"`
+	BackoffMS int `json:"backoff_ms,omitempty"`
+	Weight    int `json:"weight,omitempty"`
+}
+
+// ForwarderBenchmark is the result of one server in a forwarder benchmark,
+// Rank 1 being the best
+type ForwarderBenchmark struct {
+	Rank        int     `json:"rank"`
+	Address     string  `json:"address"`
+	Configured  bool    `json:"configured"`
+	Queries     int     `json:"queries"`
+	Failures    int     `json:"failures"`
+	FailureRate float64 `json:"failure_rate"`
+	LatencyMS   float64 `json:"latency_ms,omitempty"` // median
+	MaxMS       float64 `json:"max_ms,omitempty"`
+	DNSSEC      string  `json:"dnssec"` // "validates", "passes" or "none"
+	EDNS        bool    `json:"edns"`
+	EDNSIssue   string  `json:"edns_issue,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// BenchmarkResult ranks the servers of a forwarder benchmark. Recommended
+// is the fastest set that answered every query with compliant EDNS.
+type BenchmarkResult struct {
+	Names       []string             `json:"names"`
+	Rounds      int                  `json:"rounds"`
+	Results     []ForwarderBenchmark `json:"results"`
+	Recommended []string             `json:"recommended"`
+}
+
+// Token is an API token. Token is only set in the response to CreateToken.
+type Token struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Token      string `json:"token,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+}
+
+// ZoneImport describes a zone to import. Provider is cloudflare (Token
+// required), route53 (Data holds the list-resource-record-sets JSON) or bind
+// (Data holds a zone file).
+type ZoneImport struct {
+	Provider string `json:"provider"`
+	Zone     string `json:"zone"`
+	Token    string `json:"token,omitempty"`
+	Data     string `json:"data,omitempty"`
+}
+
+// SkippedRecord is a provider record that could not be imported
+type SkippedRecord struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// ZoneSerial is the SOA serial a server serves for a zone
+type ZoneSerial struct {
+	Zone   string `json:"zone"`
+	Serial uint32 `json:"serial"`
+}
+
+// ReplicationStatus is the role of a server and the serials it serves
+type ReplicationStatus struct {
+	Role  string       `json:"role"`
+	Zones []ZoneSerial `json:"zones"`
+}
+
+// Maintenance is the maintenance mode of a server: every zone (Enabled) or
+// the listed zones are forwarded upstream instead of answered locally
+type Maintenance struct {
+	Enabled bool       `json:"enabled"`
+	Zones   []string   `json:"zones"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// Secondary is a secondary server of a zone: it is sent a NOTIFY when the
+// zone changes and may transfer it, signing its requests with TSIGKey
+// when set. TSIGSecret is only returned by AddSecondary.
+type Secondary struct {
+	ID            int64  `json:"id,omitempty"`
+	ZoneID        int64  `json:"zone_id,omitempty"`
+	Address       string `json:"address"`
+	TSIGKey       string `json:"tsig_key,omitempty"`
+	TSIGAlgorithm string `json:"tsig_algorithm,omitempty"`
+	TSIGSecret    string `json:"tsig_secret,omitempty"` // base64, generated when empty
+}
+
+// ZoneTransfer is the state of the copy of a secondary zone transferred
+// from its primaries; the zone is no longer served after ExpiresAt
+type ZoneTransfer struct {
+	ZoneID        int64      `json:"zone_id"`
+	Serial        uint32     `json:"serial"`
+	Primaries     []string   `json:"primaries"`
+	RecordCount   int        `json:"record_count"`
+	TransferredAt time.Time  `json:"transferred_at"`
+	CheckedAt     time.Time  `json:"checked_at"`
+	Error         string     `json:"error,omitempty"` // of the last refresh
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	NextRefresh   *time.Time `json:"next_refresh,omitempty"`
+}
+
+// MigrationPlan is what a resolv.conf, dnsmasq.conf or unbound.conf
+// translates to: new forwarders, local records grouped by zone, and the
+// lines with no equivalent
+type MigrationPlan struct {
+	Forwarders   []string               `json:"forwarders"`
+	ForwardZones []MigrationForwardZone `json:"forward_zones"`
+	Zones        []MigrationZone        `json:"zones"`
+	Skipped      []SkippedLine          `json:"skipped"`
+}
+
+// MigrationForwardZone is a domain sent to its own forwarders
+type MigrationForwardZone struct {
+	Name       string   `json:"name"`
+	Forwarders []string `json:"forwarders"`
+}
+
+// MigrationZone holds the records imported in one zone. Exists is set when
+// the zone is already on the server.
+type MigrationZone struct {
+	Name    string   `json:"name"`
+	Exists  bool     `json:"exists"`
+	Records []Record `json:"records"`
+}
+
+// SkippedLine is a configuration line that could not be imported
+type SkippedLine struct {
+	Line   int    `json:"line,omitempty"`
+	Text   string `json:"text"`
+	Reason string `json:"reason"`
+}
+
+// TrashItem is a deleted zone or record, kept until ExpiresAt
+type TrashItem struct {
+	ID       int64  `json:"id"`
+	Kind     string `json:"kind"` // zone or record
+	ZoneID   int64  `json:"zone_id"`
+	ZoneName string `json:"zone_name"`
+	// Name, Type and Value are those of a deleted record, Records the
+	// number of records of a deleted zone
+	Name      string    `json:"name,omitempty"`
+	Type      string    `json:"type,omitempty"`
+	Value     string    `json:"value,omitempty"`
+	Records   int       `json:"records,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ClientSettings are the label and policy of a client. Blocking is ""
+// (the blocking of its group), "all" (every source of the sinkhole),
+// "none" or "lists" (the sources of Blocklists only, "domains" or a list
+// of the sinkhole).
+type ClientSettings struct {
+	Label      string   `json:"label,omitempty"`
+	Group      string   `json:"group,omitempty"`
+	Blocking   string   `json:"blocking,omitempty"`
+	Blocklists []string `json:"blocklists,omitempty"`
+}
+
+// ClientInfo is a client of the server with its query counts since the
+// server started. Name is the label, else the reverse name of the address.
+// PolicyGroup is the group applied: the one assigned, else the group of
+// its network. SafeSearch lists the search engines it restricts. Paused
+// is why the client is paused: "paused" by hand until PausedUntil, or the
+// name of an access schedule.
+type ClientInfo struct {
+	Address  string `json:"address"`
+	Name     string `json:"name,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	ClientSettings
+	PolicyGroup string     `json:"policy_group,omitempty"`
+	SafeSearch  []string   `json:"safe_search,omitempty"`
+	Paused      string     `json:"paused,omitempty"`
+	PausedUntil *time.Time `json:"paused_until,omitempty"`
+	Queries     uint64     `json:"queries"`
+	Blocked     uint64     `json:"blocked"`
+	FirstSeen   *time.Time `json:"first_seen,omitempty"`
+	LastSeen    *time.Time `json:"last_seen,omitempty"`
+	LastName    string     `json:"last_name,omitempty"`
+}
+
+// ClientsReport lists the clients, the busiest first, with the policy
+// groups and blocking sources they can be given
+type ClientsReport struct {
+	Clients      []ClientInfo `json:"clients"`
+	Groups       []string     `json:"groups"`
+	Blocklists   []string     `json:"blocklists"`
+	ResolveNames bool         `json:"resolve_names"`
+	Since        time.Time    `json:"since"`
+}
+
+// AccessSchedule restricts the clients of Group, or every client, from
+// From to To (HH:MM, server time) on Days (sun to sat, empty for every
+// day): the sources of Blocklists block them, or Pause refuses them the
+// names out of the local zones. Active is set when it applies now.
+type AccessSchedule struct {
+	ID         int64    `json:"id,omitempty"`
+	Name       string   `json:"name"`
+	Group      string   `json:"group,omitempty"`
+	Days       []string `json:"days,omitempty"`
+	From       string   `json:"from"`
+	To         string   `json:"to"`
+	Blocklists []string `json:"blocklists,omitempty"`
+	Pause      bool     `json:"pause,omitempty"`
+	Enabled    bool     `json:"enabled"`
+	Active     bool     `json:"active,omitempty"`
+}
+
+// ZoneNotes document a zone: its owner, how to reach them and the day it
+// must be reviewed. Reminder is the last reminder sent about that date.
+type ZoneNotes struct {
+	ZoneID      int64      `json:"zone_id,omitempty"`
+	ZoneName    string     `json:"zone_name,omitempty"`
+	Owner       string     `json:"owner,omitempty"`
+	Contact     string     `json:"contact,omitempty"`
+	Description string     `json:"description,omitempty"`
+	ReviewAt    *time.Time `json:"review_at,omitempty"`
+	Reminder    string     `json:"reminder,omitempty"`    // due or overdue
+	RemindedAt  *time.Time `json:"reminded_at,omitempty"` // of Reminder
+	Review      string     `json:"review,omitempty"`      // due or overdue now, in ListZoneReviews
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ListRecords returns the records of a zone
+func (c *Client) ListRecords(ctx context.Context, zoneID int64) ([]Record, error) {
+	var records []Record
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/zones/%d/records", zoneID), nil, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// GetRecord returns one record of a zone
+func (c *Client) GetRecord(ctx context.Context, zoneID, recordID int64) (*Record, error) {
+	var record Record
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/zones/%d/records/%d", zoneID, recordID), nil, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// CreateRecord adds a record to a zone
+func (c *Client) CreateRecord(ctx context.Context, zoneID int64, in RecordInput) (*Record, error) {
+	var record Record
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/zones/%d/records", zoneID), in, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// CreateRecords adds many records to a zone at once: all of them, or none
+// if one is invalid or the zone would have errors. It returns the records
+// in zone file format; with dryRun they are only checked.
+func (c *Client) CreateRecords(ctx context.Context, zoneID int64, in []RecordInput, dryRun bool) ([]string, error) {
+	body := struct {
+		Records []RecordInput `json:"records"`
+		DryRun  bool          `json:"dry_run"`
+	}{in, dryRun}
+	var out struct {
+		Records []string `json:"records"`
+	}
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/zones/%d/records/bulk", zoneID), body, &out); err != nil {
+		return nil, err
+	}
+	return out.Records, nil
+}
+
+// UpdateRecord replaces a record of a zone; see RecordInput.Version
+func (c *Client) UpdateRecord(ctx context.Context, zoneID, recordID int64, in RecordInput) (*Record, error) {
+	var record Record
+	if err := c.doIfMatch(ctx, http.MethodPut, fmt.Sprintf("/api/zones/%d/records/%d", zoneID, recordID), ifMatch(in.Version), in, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// DeleteRecord removes a record from a zone
+func (c *Client) DeleteRecord(ctx context.Context, zoneID, recordID int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/zones/%d/records/%d", zoneID, recordID), nil, nil)
+}
+
+// RefreshRecord serves a record again as stored and drops the cached
+// answers for its name
+func (c *Client) RefreshRecord(ctx context.Context, zoneID, recordID int64) (*RecordRefreshResult, error) {
+	var result RecordRefreshResult
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/zones/%d/records/%d/refresh", zoneID, recordID), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SearchRecords returns the records of all zones matching every word of q
+// in their zone, name, value, comment or tags; tag:name matches a tag
+func (c *Client) SearchRecords(ctx context.Context, q string) ([]RecordSearchResult, error) {
+	var results []RecordSearchResult
+	if err := c.do(ctx, http.MethodGet, "/api/records/search?q="+url.QueryEscape(q), nil, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ListRRSets returns the record sets of a zone, filtered by name and type
+// when not empty
+func (c *Client) ListRRSets(ctx context.Context, zoneID int64, name, rrType string) ([]RRSet, error) {
+	q := url.Values{}
+	if name != "" {
+		q.Set("name", name)
+	}
+	if rrType != "" {
+		q.Set("type", rrType)
+	}
+	path := fmt.Sprintf("/api/zones/%d/rrsets", zoneID)
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var sets []RRSet
+	if err := c.do(ctx, http.MethodGet, path, nil, &sets); err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
+
+// ReplaceRRSet replaces the records of a name and type; see RRSetInput
+func (c *Client) ReplaceRRSet(ctx context.Context, zoneID int64, name, rrType string, in RRSetInput) (*RRSet, error) {
+	var set RRSet
+	if err := c.doIfMatch(ctx, http.MethodPut, rrsetPath(zoneID, name, rrType), ifMatch(in.Serial), in, &set); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// DeleteRRSet removes all the records of a name and type
+func (c *Client) DeleteRRSet(ctx context.Context, zoneID int64, name, rrType string) error {
+	return c.do(ctx, http.MethodDelete, rrsetPath(zoneID, name, rrType), nil, nil)
+}
+
+func rrsetPath(zoneID int64, name, rrType string) string {
+	return fmt.Sprintf("/api/zones/%d/rrsets/%s/%s", zoneID, url.PathEscape(name), url.PathEscape(rrType))
+}
@@ -0,0 +1,26 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// ReplicationStatus returns the role of the server and the serials of the
+// zones it serves
+func (c *Client) ReplicationStatus(ctx context.Context) (*ReplicationStatus, error) {
+	var status ReplicationStatus
+	if err := c.do(ctx, http.MethodGet, "/api/replication", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Promote makes the server a master
+func (c *Client) Promote(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/api/replication/promote", nil, nil)
+}
+
+// Demote makes the server a read-only slave
+func (c *Client) Demote(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/api/replication/demote", nil, nil)
+}
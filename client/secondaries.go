@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// ListSecondaries returns the secondary servers of a zone
+func (c *Client) ListSecondaries(ctx context.Context, zoneID int64) ([]Secondary, error) {
+	var secondaries []Secondary
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/zones/%d/secondaries", zoneID), nil, &secondaries); err != nil {
+		return nil, err
+	}
+	return secondaries, nil
+}
+
+// AddSecondary adds a secondary server to a zone; the result holds the
+// TSIG secret, generated when in has a key without one
+func (c *Client) AddSecondary(ctx context.Context, zoneID int64, in Secondary) (*Secondary, error) {
+	var s Secondary
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/zones/%d/secondaries", zoneID), in, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// DeleteSecondary removes a secondary server from a zone
+func (c *Client) DeleteSecondary(ctx context.Context, zoneID, secondaryID int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/zones/%d/secondaries/%d", zoneID, secondaryID), nil, nil)
+}
+
+// NotifySecondaries sends a NOTIFY for a zone to its secondaries and
+// returns how many servers were notified
+func (c *Client) NotifySecondaries(ctx context.Context, zoneID int64) (int, error) {
+	var out struct {
+		Notified int `json:"notified"`
+	}
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/zones/%d/notify", zoneID), nil, &out); err != nil {
+		return 0, err
+	}
+	return out.Notified, nil
+}
+
+// GetZoneTransfer returns the state of the copy of a secondary zone
+func (c *Client) GetZoneTransfer(ctx context.Context, zoneID int64) (*ZoneTransfer, error) {
+	var t ZoneTransfer
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/zones/%d/transfer", zoneID), nil, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// TransferZone refreshes a secondary zone from its primaries now
+func (c *Client) TransferZone(ctx context.Context, zoneID int64) (*ZoneTransfer, error) {
+	var t ZoneTransfer
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/zones/%d/transfer", zoneID), nil, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Sinkhole returns the sinkhole status and the most blocked domains
+func (c *Client) Sinkhole(ctx context.Context) (*Sinkhole, error) {
+	var s Sinkhole
+	if err := c.do(ctx, http.MethodGet, "/api/sinkhole", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SetSinkholeDomains replaces the domains blocked through the API
+func (c *Client) SetSinkholeDomains(ctx context.Context, domains []string) (*Sinkhole, error) {
+	if domains == nil {
+		domains = []string{}
+	}
+	var s Sinkhole
+	if err := c.do(ctx, http.MethodPut, "/api/sinkhole/domains", domains, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// RefreshSinkhole reloads the blocklists now
+func (c *Client) RefreshSinkhole(ctx context.Context) (*Sinkhole, error) {
+	var s Sinkhole
+	if err := c.do(ctx, http.MethodPost, "/api/sinkhole/refresh", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
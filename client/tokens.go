@@ -0,0 +1,34 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// ListTokens returns the API tokens of the authenticated user
+func (c *Client) ListTokens(ctx context.Context) ([]Token, error) {
+	var tokens []Token
+	if err := c.do(ctx, http.MethodGet, "/api/tokens", nil, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// CreateToken creates an API token. The returned Token field holds the
+// secret, which cannot be retrieved again.
+func (c *Client) CreateToken(ctx context.Context, name string) (*Token, error) {
+	in := struct {
+		Name string `json:"name"`
+	}{name}
+	var token Token
+	if err := c.do(ctx, http.MethodPost, "/api/tokens", in, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// DeleteToken revokes an API token
+func (c *Client) DeleteToken(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/tokens/%d", id), nil, nil)
+}
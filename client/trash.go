@@ -0,0 +1,31 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// ListTrash returns the deleted zones and records, last deleted first
+func (c *Client) ListTrash(ctx context.Context) ([]TrashItem, error) {
+	var items []TrashItem
+	if err := c.do(ctx, http.MethodGet, "/api/trash", nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// RestoreTrashItem restores a deleted zone or record. A record can only be
+// restored once its zone exists.
+func (c *Client) RestoreTrashItem(ctx context.Context, id int64) (*TrashItem, error) {
+	var item TrashItem
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/trash/%d/restore", id), nil, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// DeleteTrashItem deletes a zone or record from the trash for good
+func (c *Client) DeleteTrashItem(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/trash/%d", id), nil, nil)
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ListZones returns all zones with their record counts
+func (c *Client) ListZones(ctx context.Context) ([]Zone, error) {
+	var zones []Zone
+	if err := c.do(ctx, http.MethodGet, "/api/zones", nil, &zones); err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
+
+// GetZone returns a zone and its records
+func (c *Client) GetZone(ctx context.Context, id int64) (*Zone, []Record, error) {
+	var out struct {
+		Zone    Zone     `json:"zone"`
+		Records []Record `json:"records"`
+	}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/zones/%d", id), nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return &out.Zone, out.Records, nil
+}
+
+// FindZone returns the zone with the given name (with or without the
+// trailing dot)
+func (c *Client) FindZone(ctx context.Context, name string) (*Zone, error) {
+	zones, err := c.ListZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range zones {
+		if sameName(zones[i].Name, name) {
+			return &zones[i], nil
+		}
+	}
+	return nil, &APIError{StatusCode: http.StatusNotFound, Message: "zone not found"}
+}
+
+// CreateZone creates a new zone
+func (c *Client) CreateZone(ctx context.Context, in ZoneInput) (*Zone, error) {
+	var zone Zone
+	if err := c.do(ctx, http.MethodPost, "/api/zones", in, &zone); err != nil {
+		return nil, err
+	}
+	return &zone, nil
+}
+
+// UpdateZone replaces the settings of a zone; see ZoneInput.Version
+func (c *Client) UpdateZone(ctx context.Context, id int64, in ZoneInput) (*Zone, error) {
+	var zone Zone
+	if err := c.doIfMatch(ctx, http.MethodPut, fmt.Sprintf("/api/zones/%d", id), ifMatch(in.Version), in, &zone); err != nil {
+		return nil, err
+	}
+	return &zone, nil
+}
+
+// ToggleZone enables or disables a zone and returns its new state
+func (c *Client) ToggleZone(ctx context.Context, id int64) (bool, error) {
+	var out struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/api/zones/%d/toggle", id), nil, &out); err != nil {
+		return false, err
+	}
+	return out.Enabled, nil
+}
+
+// DeleteZone deletes a zone and its records. The server refuses to delete
+// a zone holding many records without confirmation: see ConfirmToken and
+// DeleteZoneConfirmed.
+func (c *Client) DeleteZone(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/zones/%d", id), nil, nil)
+}
+
+// DeleteZoneConfirmed deletes a zone with the confirmation token of a
+// refused DeleteZone
+func (c *Client) DeleteZoneConfirmed(ctx context.Context, id int64, token string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/zones/%d?confirm=%s", id, url.QueryEscape(token)), nil, nil)
+}
+
+// GetZoneNotes returns the owner, contact, description and review date of
+// a zone
+func (c *Client) GetZoneNotes(ctx context.Context, id int64) (*ZoneNotes, error) {
+	var n ZoneNotes
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/zones/%d/notes", id), nil, &n); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// SetZoneNotes replaces the notes of a zone; empty notes delete them. A
+// new review date resets the reminders.
+func (c *Client) SetZoneNotes(ctx context.Context, id int64, in ZoneNotes) (*ZoneNotes, error) {
+	var n ZoneNotes
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/zones/%d/notes", id), in, &n); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// ListZoneReviews returns the zones with a review date, soonest first
+func (c *Client) ListZoneReviews(ctx context.Context) ([]ZoneNotes, error) {
+	var reviews []ZoneNotes
+	if err := c.do(ctx, http.MethodGet, "/api/zone-reviews", nil, &reviews); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+// sameName compares domain names ignoring case and the trailing dot
+func sameName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
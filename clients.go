@@ -0,0 +1,589 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// The queries are counted per client address, and the clients can be
+// named: by hand (label) or from the PTR record of their address
+// (clients.resolve_names). A client can also get a policy: the blocking
+// sources of the sinkhole it is subject to, and a policy group of the
+// config. A group gathers clients by hand or by network, restricts the
+// names they may ask and sets their default blocking and safe search.
+
+// ClientGroup is a policy of the config shared by the clients assigned to
+// it and the clients of its networks
+type ClientGroup struct {
+	Name string `yaml:"name" json:"name"`
+	// Networks are the addresses and CIDR networks of the clients in the
+	// group when they are not assigned to another one
+	Networks []string `yaml:"networks" json:"networks,omitempty"`
+	// LocalZones allows the names of the local zones (default true)
+	LocalZones *bool `yaml:"local_zones" json:"local_zones,omitempty"`
+	// Forwarding allows the other names, sent to the forwarders or the
+	// recursive resolver, or answered from the hosts files and the
+	// sinkhole (default true)
+	Forwarding *bool `yaml:"forwarding" json:"forwarding,omitempty"`
+	// Blocking applies to the clients without a blocking of their own:
+	// "all" (default), "none" or "lists" with the sources of Blocklists
+	Blocking   string   `yaml:"blocking" json:"blocking,omitempty"`
+	Blocklists []string `yaml:"blocklists" json:"blocklists,omitempty"`
+	// SafeSearch answers the search engines with the hosts enforcing
+	// their safe search: the engines of SafeSearchEngines, default all
+	SafeSearch        bool     `yaml:"safe_search" json:"safe_search,omitempty"`
+	SafeSearchEngines []string `yaml:"safe_search_engines" json:"safe_search_engines,omitempty"`
+	// YouTubeRestrict is the restricted mode of YouTube with safe search:
+	// "strict" (default) or "moderate"
+	YouTubeRestrict string `yaml:"youtube_restrict" json:"youtube_restrict,omitempty"`
+
+	nets []*net.IPNet
+}
+
+func (g *ClientGroup) allowsLocalZones() bool { return g.LocalZones == nil || *g.LocalZones }
+func (g *ClientGroup) allowsForwarding() bool { return g.Forwarding == nil || *g.Forwarding }
+
+// allows reports whether the clients of the group may ask name
+func (g *ClientGroup) allows(name string) bool {
+	if g.allowsLocalZones() && g.allowsForwarding() {
+		return true
+	}
+	if zoneStore.Load().Resolve(name).Zone != "" {
+		return g.allowsLocalZones()
+	}
+	return g.allowsForwarding()
+}
+
+// ClientsConfig names the clients and defines their policy groups
+type ClientsConfig struct {
+	// ResolveNames names the clients from the PTR record of their address
+	ResolveNames bool          `yaml:"resolve_names" json:"resolve_names,omitempty"`
+	Groups       []ClientGroup `yaml:"groups" json:"groups,omitempty"`
+}
+
+// Blocking policies of a client
+const (
+	clientBlockingDefault = ""      // the blocking of the group, else every source
+	clientBlockingAll     = "all"   // every source of the sinkhole
+	clientBlockingNone    = "none"  // no blocking
+	clientBlockingLists   = "lists" // the sources in Blocklists only
+)
+
+// ClientSettings are the label and policy of one client
+type ClientSettings struct {
+	Label    string `json:"label,omitempty"`
+	Group    string `json:"group,omitempty"`
+	Blocking string `json:"blocking,omitempty"` // "" (the group's), "all", "none" or "lists"
+	// Blocklists are the sources of the "lists" policy: "domains" for the
+	// domains of the config and the web UI, or lists of sinkhole.lists
+	Blocklists []string `json:"blocklists,omitempty"`
+}
+
+func (s ClientSettings) empty() bool {
+	return s.Label == "" && s.Group == "" && s.Blocking == clientBlockingDefault
+}
+
+const maxClientLabelLength = 100
+
+// clientNameTTL is how long the reverse name of a client is kept before
+// it is looked up again
+const clientNameTTL = time.Hour
+
+var (
+	clientsConfig ClientsConfig
+	// clientSettings holds the settings saved in the database, by address
+	clientSettings atomic.Pointer[map[string]ClientSettings]
+	clientStats    = newClientTracker(statsTopSize)
+	// clientNames queues the addresses whose reverse name is looked up
+	clientNames chan string
+)
+
+// validClients checks the clients settings of the config, with the lists
+// of the sinkhole the groups can block
+func validClients(cfg ClientsConfig, sinkholeCfg SinkholeConfig) error {
+	seen := make(map[string]bool)
+	for _, g := range cfg.Groups {
+		if strings.TrimSpace(g.Name) == "" {
+			return fmt.Errorf("a group has no name")
+		}
+		if seen[g.Name] {
+			return fmt.Errorf("group %q is defined twice", g.Name)
+		}
+		seen[g.Name] = true
+		if _, err := parseAllowTransfer(g.Networks); err != nil {
+			return fmt.Errorf("group %q: networks: %v", g.Name, err)
+		}
+		if err := validGroupBlocking(g, sinkholeCfg); err != nil {
+			return fmt.Errorf("group %q: %v", g.Name, err)
+		}
+		if err := validGroupSafeSearch(g); err != nil {
+			return fmt.Errorf("group %q: %v", g.Name, err)
+		}
+	}
+	return nil
+}
+
+// validGroupBlocking checks the blocking of a group
+func validGroupBlocking(g ClientGroup, sinkholeCfg SinkholeConfig) error {
+	switch g.Blocking {
+	case clientBlockingDefault, clientBlockingAll, clientBlockingNone:
+		if len(g.Blocklists) > 0 {
+			return fmt.Errorf("blocklists needs blocking: lists")
+		}
+	case clientBlockingLists:
+		if len(g.Blocklists) == 0 {
+			return fmt.Errorf("blocklists cannot be empty with blocking: lists")
+		}
+		for _, source := range g.Blocklists {
+			if source != sinkholeDomainsSource && !slices.Contains(sinkholeCfg.Lists, source) {
+				return fmt.Errorf("unknown blocklist %q, expected %q or a list of sinkhole.lists", source, sinkholeDomainsSource)
+			}
+		}
+	default:
+		return fmt.Errorf("blocking must be all, none or lists")
+	}
+	return nil
+}
+
+func initClients(cfg ClientsConfig, sinkholeCfg SinkholeConfig) {
+	if err := validClients(cfg, sinkholeCfg); err != nil {
+		slog.Error("invalid clients, client groups disabled", "error", err)
+		cfg.Groups = nil
+	}
+	for i := range cfg.Groups {
+		cfg.Groups[i].nets, _ = parseAllowTransfer(cfg.Groups[i].Networks)
+	}
+	clientsConfig = cfg
+	if cfg.ResolveNames {
+		clientNames = make(chan string, 256)
+		go resolveClientNames()
+	}
+}
+
+// clientGroup returns the group of the config named name, nil if none
+func clientGroup(name string) *ClientGroup {
+	for i := range clientsConfig.Groups {
+		if clientsConfig.Groups[i].Name == name {
+			return &clientsConfig.Groups[i]
+		}
+	}
+	return nil
+}
+
+// clientGroupOf returns the group of the client at host: the group it is
+// assigned to, else the first one of the config covering its address
+func clientGroupOf(host string, settings ClientSettings) *ClientGroup {
+	if settings.Group != "" {
+		return clientGroup(settings.Group)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+	for i, g := range clientsConfig.Groups {
+		for _, n := range g.nets {
+			if n.Contains(ip) {
+				return &clientsConfig.Groups[i]
+			}
+		}
+	}
+	return nil
+}
+
+// clientHost returns the address of a client without its port
+func clientHost(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return ""
+}
+
+// clientSettingsFor returns the settings of the client at host
+func clientSettingsFor(host string) ClientSettings {
+	if m := clientSettings.Load(); m != nil {
+		return (*m)[host]
+	}
+	return ClientSettings{}
+}
+
+// loadClientsFromDB applies the client settings saved from the web UI
+func loadClientsFromDB() {
+	if database == nil {
+		return
+	}
+	list, err := database.ListClients()
+	if err != nil {
+		slog.Error("failed to load clients", "error", err)
+		return
+	}
+	m := make(map[string]ClientSettings, len(list))
+	for _, c := range list {
+		m[c.Address] = c.ClientSettings
+	}
+	clientSettings.Store(&m)
+}
+
+// clientPolicyGroup returns the group of the client at addr, nil if none
+func clientPolicyGroup(addr net.Addr) *ClientGroup {
+	host := clientHost(addr)
+	return clientGroupOf(host, clientSettingsFor(host))
+}
+
+// clientBlockingMask returns the sources of s blocking the client at addr:
+// its own blocking, else the one of its group, and the blocklists of the
+// access schedules running
+func clientBlockingMask(addr net.Addr, s *sinkholeState) uint64 {
+	host := clientHost(addr)
+	settings := clientSettingsFor(host)
+	g := clientGroupOf(host, settings)
+	blocking, lists := settings.Blocking, settings.Blocklists
+	if blocking == clientBlockingDefault && g != nil {
+		blocking, lists = g.Blocking, g.Blocklists
+	}
+	var mask uint64
+	switch blocking {
+	case clientBlockingNone:
+	case clientBlockingLists:
+		for _, source := range lists {
+			mask |= s.sourceBit(source)
+		}
+	default:
+		return sinkholeAllSources
+	}
+	for _, source := range scheduledBlocklists(groupName(g), time.Now()) {
+		mask |= s.sourceBit(source)
+	}
+	return mask
+}
+
+// groupName returns the name of g, "" for nil
+func groupName(g *ClientGroup) string {
+	if g == nil {
+		return ""
+	}
+	return g.Name
+}
+
+// withClientPolicy wraps a DNS handler: the names the group of the client
+// does not allow are refused, and the names out of the local zones while
+// the client is paused
+func withClientPolicy(next dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		if len(r.Question) == 1 {
+			name := r.Question[0].Name
+			host := clientHost(w.RemoteAddr())
+			g := clientGroupOf(host, clientSettingsFor(host))
+			if g != nil && !g.allows(name) {
+				refuseQuery(w, r)
+				slog.Debug("Refused by client group", "name", name, "client", w.RemoteAddr(), "group", g.Name)
+				return
+			}
+			if paused := clientPaused(host, groupName(g), time.Now()); paused != "" && zoneStore.Load().Resolve(name).Zone == "" {
+				markQueryBlocked(w)
+				refuseQuery(w, r)
+				slog.Debug("Refused while paused", "name", name, "client", w.RemoteAddr(), "pause", paused)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// refuseQuery answers r with REFUSED
+func refuseQuery(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeRefused)
+	if err := w.WriteMsg(m); err != nil {
+		slog.Debug("failed to write REFUSED", "client", w.RemoteAddr(), "error", err)
+	}
+}
+
+// normalizeClientSettings checks the settings of a client and trims them
+func normalizeClientSettings(s ClientSettings) (ClientSettings, error) {
+	s.Label = strings.TrimSpace(s.Label)
+	if len(s.Label) > maxClientLabelLength {
+		return s, fmt.Errorf("label longer than %d characters", maxClientLabelLength)
+	}
+	if s.Group != "" && clientGroup(s.Group) == nil {
+		return s, fmt.Errorf("unknown group %q, groups are defined in clients.groups", s.Group)
+	}
+	switch s.Blocking {
+	case clientBlockingDefault, clientBlockingAll, clientBlockingNone:
+	case clientBlockingLists:
+		if len(s.Blocklists) == 0 {
+			return s, fmt.Errorf("blocklists cannot be empty with the lists blocking")
+		}
+		sources := sinkholeSources()
+		for _, source := range s.Blocklists {
+			if !slices.Contains(sources, source) {
+				return s, fmt.Errorf("unknown blocklist %q", source)
+			}
+		}
+		return s, nil
+	default:
+		return s, fmt.Errorf("blocking must be empty (the blocking of the group), all, none or lists")
+	}
+	s.Blocklists = nil
+	return s, nil
+}
+
+// clientCounters are the queries of one client since the start
+type clientCounters struct {
+	queries   uint64
+	blocked   uint64
+	firstSeen time.Time
+	lastSeen  time.Time
+	lastName  string
+	// hostname is the reverse name of the address, looked up at resolvedAt
+	hostname   string
+	resolvedAt time.Time
+}
+
+// clientTracker counts the queries by client with bounded memory: when
+// full, the clients idle for an hour are dropped, else the oldest half
+type clientTracker struct {
+	mu      sync.Mutex
+	clients map[string]*clientCounters
+	max     int
+}
+
+func newClientTracker(max int) *clientTracker {
+	return &clientTracker{clients: make(map[string]*clientCounters), max: max}
+}
+
+// Record counts one query of client
+func (t *clientTracker) Record(at time.Time, client, name string, blocked bool) {
+	if client == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := t.clients[client]
+	if c == nil {
+		if len(t.clients) >= t.max {
+			t.evict(at)
+		}
+		c = &clientCounters{firstSeen: at}
+		t.clients[client] = c
+	}
+	c.queries++
+	if blocked {
+		c.blocked++
+	}
+	c.lastSeen = at
+	c.lastName = strings.TrimSuffix(name, ".")
+	if clientNames != nil && at.Sub(c.resolvedAt) >= clientNameTTL {
+		select {
+		case clientNames <- client:
+			c.resolvedAt = at
+		default:
+		}
+	}
+}
+
+func (t *clientTracker) evict(now time.Time) {
+	for k, c := range t.clients {
+		if now.Sub(c.lastSeen) > time.Hour {
+			delete(t.clients, k)
+		}
+	}
+	if len(t.clients) < t.max {
+		return
+	}
+	seen := make([]time.Time, 0, len(t.clients))
+	for _, c := range t.clients {
+		seen = append(seen, c.lastSeen)
+	}
+	slices.SortFunc(seen, func(a, b time.Time) int { return a.Compare(b) })
+	cutoff := seen[len(seen)/2]
+	for k, c := range t.clients {
+		if !c.lastSeen.After(cutoff) {
+			delete(t.clients, k)
+		}
+	}
+}
+
+func (t *clientTracker) setHostname(client, hostname string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c := t.clients[client]; c != nil {
+		c.hostname = hostname
+	}
+}
+
+// resolveClientNames looks up the reverse names of the queued clients
+func resolveClientNames() {
+	for client := range clientNames {
+		clientStats.setHostname(client, lookupClientName(client))
+	}
+}
+
+// lookupClientName returns the PTR target of an address, asked through
+// the DNS handler like the targets of the zone checks
+func lookupClientName(ip string) string {
+	arpa, err := dns.ReverseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	req := new(dns.Msg)
+	req.SetQuestion(arpa, dns.TypePTR)
+	w := &traceWriter{remote: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}}
+	handleDNS(w, req)
+	if w.msg == nil {
+		return ""
+	}
+	for _, rr := range w.msg.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok {
+			return strings.TrimSuffix(ptr.Ptr, ".")
+		}
+	}
+	return ""
+}
+
+// ClientInfo is a client seen since the start or with settings
+type ClientInfo struct {
+	Address string `json:"address"`
+	// Name is the label, else the reverse name of the address
+	Name     string `json:"name,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	ClientSettings
+	// PolicyGroup is the group applied: the one assigned, else the group
+	// of its network
+	PolicyGroup string `json:"policy_group,omitempty"`
+	// SafeSearch lists the search engines restricted by the group
+	SafeSearch []string `json:"safe_search,omitempty"`
+	// Paused is why the client is paused: "paused" by hand until
+	// PausedUntil, or the name of an access schedule
+	Paused      string     `json:"paused,omitempty"`
+	PausedUntil *time.Time `json:"paused_until,omitempty"`
+	Queries     uint64     `json:"queries"`
+	Blocked     uint64     `json:"blocked"`
+	FirstSeen   *time.Time `json:"first_seen,omitempty"`
+	LastSeen    *time.Time `json:"last_seen,omitempty"`
+	LastName    string     `json:"last_name,omitempty"` // last name asked
+}
+
+// ClientsReport lists the clients, the busiest first, with the groups and
+// blocking sources they can be given
+type ClientsReport struct {
+	Clients      []ClientInfo `json:"clients"`
+	Groups       []string     `json:"groups"`
+	Blocklists   []string     `json:"blocklists"`
+	ResolveNames bool         `json:"resolve_names"`
+	Since        time.Time    `json:"since"`
+}
+
+// clientInfo returns what is known of the client at address
+func clientInfo(address string) ClientInfo {
+	info := ClientInfo{Address: address, ClientSettings: clientSettingsFor(address)}
+	g := clientGroupOf(address, info.ClientSettings)
+	if g != nil {
+		info.PolicyGroup = g.Name
+		info.SafeSearch = g.safeSearchEngines()
+	}
+	now := time.Now()
+	info.Paused = clientPaused(address, groupName(g), now)
+	if until := clientPausedUntil(address, now); !until.IsZero() {
+		info.PausedUntil = &until
+	}
+	clientStats.mu.Lock()
+	if c := clientStats.clients[address]; c != nil {
+		first, last := c.firstSeen, c.lastSeen
+		info.Queries, info.Blocked = c.queries, c.blocked
+		info.FirstSeen, info.LastSeen = &first, &last
+		info.LastName, info.Hostname = c.lastName, c.hostname
+	}
+	clientStats.mu.Unlock()
+	info.Name = info.Label
+	if info.Name == "" {
+		info.Name = info.Hostname
+	}
+	return info
+}
+
+func clientsReport() ClientsReport {
+	addresses := make(map[string]bool)
+	clientStats.mu.Lock()
+	for k := range clientStats.clients {
+		addresses[k] = true
+	}
+	clientStats.mu.Unlock()
+	if m := clientSettings.Load(); m != nil {
+		for k := range *m {
+			addresses[k] = true
+		}
+	}
+
+	report := ClientsReport{
+		Clients:      make([]ClientInfo, 0, len(addresses)),
+		Groups:       []string{},
+		Blocklists:   sinkholeSources(),
+		ResolveNames: clientsConfig.ResolveNames,
+		Since:        queryStats.started,
+	}
+	for k := range addresses {
+		report.Clients = append(report.Clients, clientInfo(k))
+	}
+	sort.Slice(report.Clients, func(i, j int) bool {
+		a, b := report.Clients[i], report.Clients[j]
+		if a.Queries != b.Queries {
+			return a.Queries > b.Queries
+		}
+		return a.Address < b.Address
+	})
+	for _, g := range clientsConfig.Groups {
+		report.Groups = append(report.Groups, g.Name)
+	}
+	return report
+}
+
+// handleAPIListClients handles GET /api/clients
+func handleAPIListClients(c *gin.Context) {
+	c.JSON(http.StatusOK, clientsReport())
+}
+
+// handleAPISetClient handles PUT /api/clients/:address: empty settings
+// forget the client
+func handleAPISetClient(c *gin.Context) {
+	ip := net.ParseIP(c.Param("address"))
+	if ip == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client address"})
+		return
+	}
+	var req ClientSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	settings, err := normalizeClientSettings(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	address := ip.String()
+	if err := database.SetClient(DBClient{Address: address, ClientSettings: settings}); err != nil {
+		slog.Error("failed to save client", "address", address, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save client"})
+		return
+	}
+	loadClientsFromDB()
+
+	slog.Info("Client updated", "address", address, "label", settings.Label, "group", settings.Group, "blocking", settings.Blocking)
+	c.JSON(http.StatusOK, clientInfo(address))
+}
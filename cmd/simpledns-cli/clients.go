@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"simpledns/client"
+)
+
+func clientCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "client", Short: "List the clients of the server and set their policies"}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the clients, the busiest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			report, err := c.ListClients(ctx)
+			if err != nil {
+				return err
+			}
+			rows := make([][]any, 0, len(report.Clients))
+			for _, cl := range report.Clients {
+				last := ""
+				if cl.LastSeen != nil {
+					last = cl.LastSeen.Local().Format("2006-01-02 15:04")
+				}
+				paused := cl.Paused
+				if cl.PausedUntil != nil {
+					paused = "until " + cl.PausedUntil.Local().Format("15:04")
+				}
+				rows = append(rows, []any{cl.Address, cl.Name, cl.Queries, cl.Blocked, last, cl.PolicyGroup, clientBlocking(cl.ClientSettings), strings.Join(cl.SafeSearch, ","), paused})
+			}
+			return printTable(report, "ADDRESS\tNAME\tQUERIES\tBLOCKED\tLAST SEEN\tGROUP\tBLOCKING\tSAFE SEARCH\tPAUSED", rows)
+		},
+	})
+
+	cmd.AddCommand(clientSetCommand())
+
+	var minutes int
+	pause := &cobra.Command{
+		Use:   "pause ADDRESS",
+		Short: "Refuse the names out of the local zones to a client for a while",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			info, err := c.PauseClient(ctx, args[0], minutes)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(info)
+			}
+			fmt.Printf("Client %s paused until %s\n", info.Address, info.PausedUntil.Local().Format("2006-01-02 15:04"))
+			return nil
+		},
+	}
+	pause.Flags().IntVar(&minutes, "minutes", 30, "length of the pause")
+	cmd.AddCommand(pause)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "resume ADDRESS",
+		Short: "End the pause of a client",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			info, err := c.ResumeClient(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(info)
+			}
+			if info.Paused != "" {
+				fmt.Printf("Client %s resumed, still paused by schedule %s\n", info.Address, info.Paused)
+			} else {
+				fmt.Printf("Client %s resumed\n", info.Address)
+			}
+			return nil
+		},
+	})
+	return cmd
+}
+
+// clientBlocking describes the blocking policy of a client
+func clientBlocking(s client.ClientSettings) string {
+	switch s.Blocking {
+	case "":
+		return "group"
+	case "lists":
+		return strings.Join(s.Blocklists, ",")
+	}
+	return s.Blocking
+}
+
+func clientSetCommand() *cobra.Command {
+	var in client.ClientSettings
+	set := &cobra.Command{
+		Use:   "set ADDRESS",
+		Short: "Change the name, policy group or blocking of a client",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ip := net.ParseIP(args[0])
+			if ip == nil {
+				return fmt.Errorf("invalid client address %q", args[0])
+			}
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			report, err := c.ListClients(ctx)
+			if err != nil {
+				return err
+			}
+			var settings client.ClientSettings
+			for _, cl := range report.Clients {
+				if cl.Address == ip.String() {
+					settings = cl.ClientSettings
+				}
+			}
+			flags := cmd.Flags()
+			if flags.Changed("label") {
+				settings.Label = in.Label
+			}
+			if flags.Changed("group") {
+				settings.Group = in.Group
+			}
+			if flags.Changed("blocklist") {
+				settings.Blocking, settings.Blocklists = "lists", in.Blocklists
+			}
+			if flags.Changed("blocking") {
+				settings.Blocking = in.Blocking
+			}
+			info, err := c.SetClient(ctx, ip.String(), settings)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(info)
+			}
+			fmt.Printf("Client %s: name %q, group %q, blocking %s\n", info.Address, info.Name, info.PolicyGroup, clientBlocking(info.ClientSettings))
+			return nil
+		},
+	}
+	set.Flags().StringVar(&in.Label, "label", "", "name of the client, empty to use its reverse name")
+	set.Flags().StringVar(&in.Group, "group", "", "policy group of clients.groups, empty for the group of its network")
+	set.Flags().StringVar(&in.Blocking, "blocking", "", "all, none or lists, empty for the blocking of its group")
+	set.Flags().StringSliceVar(&in.Blocklists, "blocklist", nil, "blocking source (\"domains\" or a sinkhole list), implies --blocking lists")
+	return set
+}
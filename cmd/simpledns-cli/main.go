@@ -0,0 +1,97 @@
+// Command simpledns-cli administers a SimpleDNS server through its REST API
+// (sqlite mode), authenticating with an API token.
+//
+//	export SIMPLEDNS_URL=http://dns:8080 SIMPLEDNS_TOKEN=sdns_...
+//	simpledns-cli zone list
+//	simpledns-cli record add example.com www A 192.0.2.10
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"simpledns/client"
+)
+
+var version = "dev" // Set at build time with -ldflags "-X main.version=1.0.0"
+
+var (
+	serverURL  string
+	apiToken   string
+	jsonOutput bool
+	timeout    time.Duration
+)
+
+func main() {
+	root := &cobra.Command{
+		Use:           "simpledns-cli",
+		Short:         "Administer a SimpleDNS server through its API",
+		Version:       version,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	root.PersistentFlags().StringVar(&serverURL, "server", envOr("SIMPLEDNS_URL", "http://localhost:8080"), "server URL (SIMPLEDNS_URL)")
+	root.PersistentFlags().StringVar(&apiToken, "token", os.Getenv("SIMPLEDNS_TOKEN"), "API token (SIMPLEDNS_TOKEN)")
+	root.PersistentFlags().BoolVar(&jsonOutput, "json", false, "print JSON instead of tables")
+	root.PersistentFlags().DurationVar(&timeout, "timeout", 30*time.Second, "request timeout")
+
+	root.AddCommand(zoneCommand(), recordCommand(), tokenCommand(), replicationCommand(), maintenanceCommand(), migrateCommand(), trashCommand(), clientCommand(), scheduleCommand())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := root.ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// newClient returns an API client and a context bounded by --timeout
+func newClient(cmd *cobra.Command) (*client.Client, context.Context, context.CancelFunc, error) {
+	if apiToken == "" {
+		return nil, nil, nil, fmt.Errorf("no API token, set --token or SIMPLEDNS_TOKEN")
+	}
+	ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+	return client.New(serverURL, apiToken, client.WithUserAgent("simpledns-cli/"+version)), ctx, cancel, nil
+}
+
+// printJSON writes v indented to stdout
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printTable writes tab-separated rows aligned under header, or v as JSON
+// with --json
+func printTable(v any, header string, rows [][]any) error {
+	if jsonOutput {
+		return printJSON(v)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, header)
+	for _, row := range rows {
+		for i, cell := range row {
+			if i > 0 {
+				fmt.Fprint(w, "\t")
+			}
+			fmt.Fprint(w, cell)
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
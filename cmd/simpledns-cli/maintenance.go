@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func maintenanceCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "maintenance", Short: "Forward zones upstream while their data is rebuilt"}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show the zones in maintenance",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			m, err := c.Maintenance(ctx)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(m)
+			}
+			switch {
+			case m.Enabled:
+				fmt.Println("All zones are forwarded upstream")
+			case len(m.Zones) > 0:
+				fmt.Printf("Forwarded upstream: %s\n", strings.Join(m.Zones, ", "))
+			default:
+				fmt.Println("Maintenance mode is off")
+			}
+			if m.Since != nil {
+				fmt.Printf("Since: %s\n", m.Since.Local().Format("2006-01-02 15:04:05"))
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "on [zone...]",
+		Short: "Forward the given zones, or every zone, upstream",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			m, err := c.Maintenance(ctx)
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				m.Enabled = true
+			}
+			m.Zones = append(m.Zones, args...)
+			if _, err := c.SetMaintenance(ctx, *m); err != nil {
+				return err
+			}
+			fmt.Println("Maintenance mode on")
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "off [zone...]",
+		Short: "Serve the given zones, or every zone, locally again",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			m, err := c.Maintenance(ctx)
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				m.Enabled, m.Zones = false, nil
+			} else {
+				off := make(map[string]bool, len(args))
+				for _, z := range args {
+					off[strings.TrimSuffix(strings.ToLower(z), ".")+"."] = true
+				}
+				zones := m.Zones[:0]
+				for _, z := range m.Zones {
+					if !off[z] {
+						zones = append(zones, z)
+					}
+				}
+				m.Zones = zones
+			}
+			if _, err := c.SetMaintenance(ctx, *m); err != nil {
+				return err
+			}
+			fmt.Println("Maintenance mode off")
+			return nil
+		},
+	})
+
+	return cmd
+}
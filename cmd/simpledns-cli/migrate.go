@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func migrateCommand() *cobra.Command {
+	var format string
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "migrate FILE",
+		Short: "Import forwarders and local records from resolv.conf, dnsmasq or unbound",
+		Long: `Create the forwarders, forward zones and local records of an existing
+resolv.conf, dnsmasq.conf or unbound.conf. The format is guessed from the file name
+unless --format is given. Lines with no equivalent are listed on stderr.
+FILE - reads the configuration from stdin.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format == "" {
+				base := strings.ToLower(filepath.Base(args[0]))
+				for _, f := range []string{"resolv", "dnsmasq", "unbound"} {
+					if strings.Contains(base, f) {
+						format = f
+					}
+				}
+				if format == "" {
+					return fmt.Errorf("cannot guess the format of %s, set --format", args[0])
+				}
+			}
+			data, err := readInput(args[0])
+			if err != nil {
+				return err
+			}
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			plan, err := c.MigrateResolver(ctx, format, string(data), dryRun)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(plan)
+			}
+			verb := "Created"
+			if dryRun {
+				verb = "Would create"
+			}
+			for _, f := range plan.Forwarders {
+				fmt.Printf("%s forwarder %s\n", verb, f)
+			}
+			for _, z := range plan.ForwardZones {
+				fmt.Printf("%s forward zone %s -> %s\n", verb, z.Name, strings.Join(z.Forwarders, ", "))
+			}
+			for _, z := range plan.Zones {
+				if z.Exists {
+					fmt.Printf("%s %d record(s) in zone %s\n", verb, len(z.Records), z.Name)
+				} else {
+					fmt.Printf("%s zone %s with %d record(s)\n", verb, z.Name, len(z.Records))
+				}
+				for _, r := range z.Records {
+					fmt.Printf("  %s\t%d\t%s\t%s\n", r.Name, r.TTL, r.Type, r.Value)
+				}
+			}
+			for _, s := range plan.Skipped {
+				where := s.Text
+				if s.Line > 0 {
+					where = fmt.Sprintf("line %d (%s)", s.Line, s.Text)
+				}
+				fmt.Fprintf(os.Stderr, "skipped %s: %s\n", where, s.Reason)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "", "resolv, dnsmasq or unbound")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only print what would be created")
+	return cmd
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"simpledns/client"
+)
+
+func recordCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "record", Short: "Manage the records of a zone"}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list ZONE",
+		Short: "List the records of a zone",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			zone, err := c.FindZone(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			records, err := c.ListRecords(ctx, zone.ID)
+			if err != nil {
+				return err
+			}
+			rows := make([][]any, 0, len(records))
+			for _, r := range records {
+				rows = append(rows, []any{r.ID, r.Name, r.TTL, r.Type, r.Value})
+			}
+			return printTable(records, "ID\tNAME\tTTL\tTYPE\tVALUE", rows)
+		},
+	})
+
+	var ttl, priority int
+	var activateAt, expireAt, comment string
+	var tags []string
+	var expireIn time.Duration
+	var noCache bool
+	add := &cobra.Command{
+		Use:   "add ZONE NAME TYPE VALUE",
+		Short: "Add a record (NAME is relative to the zone, @ for the apex)",
+		Args:  cobra.MinimumNArgs(4),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			zone, err := c.FindZone(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			in := client.RecordInput{
+				Name:     args[1],
+				Type:     strings.ToUpper(args[2]),
+				Value:    strings.Join(args[3:], " "),
+				TTL:      ttl,
+				Priority: priority,
+				Comment:  comment,
+				Tags:     tags,
+				NoCache:  noCache,
+			}
+			if in.ActivateAt, err = parseRecordTime("activate-at", activateAt); err != nil {
+				return err
+			}
+			if in.ExpireAt, err = parseRecordTime("expire-at", expireAt); err != nil {
+				return err
+			}
+			if expireIn > 0 {
+				t := time.Now().Add(expireIn)
+				in.ExpireAt = &t
+			}
+			record, err := c.CreateRecord(ctx, zone.ID, in)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(record)
+			}
+			fmt.Printf("Added %s %s %s (id %d)\n", record.Name, record.Type, record.Value, record.ID)
+			return nil
+		},
+	}
+	add.Flags().IntVar(&ttl, "ttl", 0, "TTL in seconds (server default when 0)")
+	add.Flags().IntVar(&priority, "priority", 0, "MX preference, or HTTPS/SVCB priority when the value starts with the target")
+	add.Flags().StringVar(&activateAt, "activate-at", "", "serve the record from this time (RFC 3339)")
+	add.Flags().StringVar(&expireAt, "expire-at", "", "delete the record at this time (RFC 3339)")
+	add.Flags().DurationVar(&expireIn, "expire-in", 0, "delete the record after this duration (e.g. 2h)")
+	add.Flags().StringVar(&comment, "comment", "", "note about the record")
+	add.Flags().StringSliceVar(&tags, "tag", nil, "tag of the record (repeatable)")
+	add.Flags().BoolVar(&noCache, "no-cache", false, "serve with a TTL of 0 and never cache upstream answers for the name")
+	add.MarkFlagsMutuallyExclusive("expire-at", "expire-in")
+	cmd.AddCommand(add)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "sets ZONE [NAME [TYPE]]",
+		Short: "List the record sets of a zone: the values of each name and type",
+		Args:  cobra.RangeArgs(1, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			zone, err := c.FindZone(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			var name, rrType string
+			if len(args) > 1 {
+				name = args[1]
+			}
+			if len(args) > 2 {
+				rrType = strings.ToUpper(args[2])
+			}
+			sets, err := c.ListRRSets(ctx, zone.ID, name, rrType)
+			if err != nil {
+				return err
+			}
+			rows := make([][]any, 0, len(sets))
+			for _, s := range sets {
+				rows = append(rows, []any{s.Name, s.TTL, s.Type, strings.Join(s.Values, ", ")})
+			}
+			return printTable(sets, "NAME\tTTL\tTYPE\tVALUES", rows)
+		},
+	})
+
+	var setTTL int
+	set := &cobra.Command{
+		Use:   "set ZONE NAME TYPE [VALUE...]",
+		Short: "Replace the records of a name and type with one per value (none deletes them)",
+		Long: "Replace the records of a name and type with one record per VALUE, all with the same TTL.\n" +
+			"Quote the values holding spaces, e.g. \"10 mail.example.com.\". Records whose value\n" +
+			"is kept keep their comment, tags and schedule.",
+		Args: cobra.MinimumNArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			zone, err := c.FindZone(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			in := client.RRSetInput{TTL: setTTL, Values: args[3:], Serial: int64(zone.Serial)}
+			if in.Values == nil {
+				in.Values = []string{}
+			}
+			result, err := c.ReplaceRRSet(ctx, zone.ID, args[1], strings.ToUpper(args[2]), in)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(result)
+			}
+			fmt.Printf("Set %s %s to %d value(s)\n", args[1], strings.ToUpper(args[2]), len(result.Values))
+			return nil
+		},
+	}
+	set.Flags().IntVar(&setTTL, "ttl", 0, "TTL of the set in seconds (current one, or the zone default, when 0)")
+	cmd.AddCommand(set)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "search QUERY...",
+		Short: "Search the records of all zones by name, value, comment or tag:NAME",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			results, err := c.SearchRecords(ctx, strings.Join(args, " "))
+			if err != nil {
+				return err
+			}
+			rows := make([][]any, 0, len(results))
+			for _, r := range results {
+				rows = append(rows, []any{r.ID, r.Zone, r.Name, r.Type, r.Value, strings.Join(r.Tags, ","), r.Comment})
+			}
+			return printTable(results, "ID\tZONE\tNAME\tTYPE\tVALUE\tTAGS\tCOMMENT", rows)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm ZONE NAME TYPE [VALUE]",
+		Short: "Remove the records matching a name, type and optional value",
+		Args:  cobra.MinimumNArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			zone, err := c.FindZone(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			records, err := c.ListRecords(ctx, zone.ID)
+			if err != nil {
+				return err
+			}
+			value := strings.Join(args[3:], " ")
+			removed := 0
+			for _, r := range records {
+				if !strings.EqualFold(r.Name, args[1]) || !strings.EqualFold(r.Type, args[2]) || (value != "" && r.Value != value) {
+					continue
+				}
+				if err := c.DeleteRecord(ctx, zone.ID, r.ID); err != nil {
+					return err
+				}
+				removed++
+			}
+			if removed == 0 {
+				return fmt.Errorf("no %s record named %s in %s", strings.ToUpper(args[2]), args[1], zone.Name)
+			}
+			fmt.Printf("Removed %d record(s)\n", removed)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "refresh ZONE NAME [TYPE]",
+		Short: "Serve the records of a name again as stored and drop its cached answers",
+		Args:  cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			zone, err := c.FindZone(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			records, err := c.ListRecords(ctx, zone.ID)
+			if err != nil {
+				return err
+			}
+			for _, r := range records {
+				if !strings.EqualFold(r.Name, args[1]) || (len(args) == 3 && !strings.EqualFold(r.Type, args[2])) {
+					continue
+				}
+				result, err := c.RefreshRecord(ctx, zone.ID, r.ID)
+				if err != nil {
+					return err
+				}
+				if jsonOutput {
+					return printJSON(result)
+				}
+				fmt.Printf("Refreshed %s, %d cached answer(s) dropped\n", result.Name, result.Purged)
+				return nil
+			}
+			return fmt.Errorf("no record named %s in %s", args[1], zone.Name)
+		},
+	})
+
+	return cmd
+}
+
+// parseRecordTime parses the RFC 3339 value of a schedule flag, nil when
+// the flag is not set
+func parseRecordTime(flag, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("--%s: %w", flag, err)
+	}
+	return &t, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func replicationCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "replication", Short: "Inspect and change the replication role"}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show the role and the served zone serials",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			status, err := c.ReplicationStatus(ctx)
+			if err != nil {
+				return err
+			}
+			if !jsonOutput {
+				fmt.Printf("Role: %s\n\n", status.Role)
+			}
+			rows := make([][]any, 0, len(status.Zones))
+			for _, z := range status.Zones {
+				rows = append(rows, []any{z.Zone, z.Serial})
+			}
+			return printTable(status, "ZONE\tSERIAL", rows)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "promote",
+		Short: "Make the server a master",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			if err := c.Promote(ctx); err != nil {
+				return err
+			}
+			fmt.Println("Server promoted to master")
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "demote",
+		Short: "Make the server a read-only slave",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			if err := c.Demote(ctx); err != nil {
+				return err
+			}
+			fmt.Println("Server demoted to slave")
+			return nil
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"simpledns/client"
+)
+
+func scheduleCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "schedule", Short: "Restrict clients at set times of the week"}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the access schedules",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			schedules, err := c.ListSchedules(ctx)
+			if err != nil {
+				return err
+			}
+			rows := make([][]any, 0, len(schedules))
+			for _, s := range schedules {
+				group, days, what, state := s.Group, strings.Join(s.Days, ","), "block "+strings.Join(s.Blocklists, ","), "enabled"
+				if group == "" {
+					group = "*"
+				}
+				if days == "" {
+					days = "every day"
+				}
+				if s.Pause {
+					what = "pause"
+				}
+				switch {
+				case s.Active:
+					state = "active"
+				case !s.Enabled:
+					state = "disabled"
+				}
+				rows = append(rows, []any{s.ID, s.Name, group, days, s.From + "-" + s.To, what, state})
+			}
+			return printTable(schedules, "ID\tNAME\tGROUP\tDAYS\tTIME\tRESTRICTION\tSTATE", rows)
+		},
+	})
+
+	var in client.AccessSchedule
+	var disabled bool
+	add := &cobra.Command{
+		Use:   "add NAME",
+		Short: "Add an access schedule",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			in.Name, in.Enabled = args[0], !disabled
+			s, err := c.CreateSchedule(ctx, in)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(s)
+			}
+			fmt.Printf("Added schedule %d %s\n", s.ID, s.Name)
+			return nil
+		},
+	}
+	add.Flags().StringVar(&in.Group, "group", "", "policy group restricted, empty for every client")
+	add.Flags().StringSliceVar(&in.Days, "days", nil, "days of the week (sun to sat), every day by default")
+	add.Flags().StringVar(&in.From, "from", "", "start time, HH:MM")
+	add.Flags().StringVar(&in.To, "to", "", "end time, HH:MM (before --from to run past midnight)")
+	add.Flags().StringSliceVar(&in.Blocklists, "blocklist", nil, "blocking source (\"domains\" or a sinkhole list) during the schedule")
+	add.Flags().BoolVar(&in.Pause, "pause", false, "refuse the names out of the local zones during the schedule")
+	add.Flags().BoolVar(&disabled, "disabled", false, "add the schedule disabled")
+	_ = add.MarkFlagRequired("from")
+	_ = add.MarkFlagRequired("to")
+	cmd.AddCommand(add)
+
+	for _, enable := range []bool{true, false} {
+		use, short := "enable ID", "Enable an access schedule"
+		if !enable {
+			use, short = "disable ID", "Disable an access schedule"
+		}
+		cmd.AddCommand(&cobra.Command{
+			Use:   use,
+			Short: short,
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				id, err := strconv.ParseInt(args[0], 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid schedule id %q", args[0])
+				}
+				c, ctx, cancel, err := newClient(cmd)
+				if err != nil {
+					return err
+				}
+				defer cancel()
+				schedules, err := c.ListSchedules(ctx)
+				if err != nil {
+					return err
+				}
+				for _, s := range schedules {
+					if s.ID == id {
+						s.Enabled = enable
+						_, err := c.UpdateSchedule(ctx, s)
+						return err
+					}
+				}
+				return fmt.Errorf("schedule %d not found", id)
+			},
+		})
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm ID",
+		Short: "Delete an access schedule",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid schedule id %q", args[0])
+			}
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			return c.DeleteSchedule(ctx, id)
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"simpledns/client"
+)
+
+func zoneSecondaryCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "secondary", Short: "Manage the secondary servers of a zone (NOTIFY, AXFR, TSIG)"}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list ZONE",
+		Short: "List the secondaries of a zone",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			zone, err := c.FindZone(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			secondaries, err := c.ListSecondaries(ctx, zone.ID)
+			if err != nil {
+				return err
+			}
+			rows := make([][]any, 0, len(secondaries))
+			for _, s := range secondaries {
+				rows = append(rows, []any{s.ID, s.Address, s.TSIGKey, s.TSIGAlgorithm})
+			}
+			return printTable(secondaries, "ID\tADDRESS\tTSIG KEY\tALGORITHM", rows)
+		},
+	})
+
+	var in client.Secondary
+	add := &cobra.Command{
+		Use:   "add ZONE ADDRESS",
+		Short: "Add a secondary, with a TSIG key when --tsig-key is set",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			zone, err := c.FindZone(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			in.Address = args[1]
+			s, err := c.AddSecondary(ctx, zone.ID, in)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(s)
+			}
+			fmt.Printf("Added secondary %s to %s (id %d)\n", s.Address, zone.Name, s.ID)
+			if s.TSIGKey != "" {
+				// In named.conf syntax, to paste on the secondary
+				fmt.Printf("key %q {\n    algorithm %s;\n    secret %q;\n};\n",
+					strings.TrimSuffix(s.TSIGKey, "."), strings.TrimSuffix(s.TSIGAlgorithm, "."), s.TSIGSecret)
+			}
+			return nil
+		},
+	}
+	add.Flags().StringVar(&in.TSIGKey, "tsig-key", "", "name of the TSIG key the secondary signs with")
+	add.Flags().StringVar(&in.TSIGAlgorithm, "tsig-algorithm", "hmac-sha256", "TSIG algorithm")
+	add.Flags().StringVar(&in.TSIGSecret, "tsig-secret", "", "base64 TSIG secret (generated when empty)")
+	cmd.AddCommand(add)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm ZONE ADDRESS",
+		Short: "Remove a secondary",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			zone, err := c.FindZone(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			secondaries, err := c.ListSecondaries(ctx, zone.ID)
+			if err != nil {
+				return err
+			}
+			for _, s := range secondaries {
+				host := strings.TrimSuffix(s.Address, ":53")
+				if s.Address != args[1] && host != args[1] && host != "["+args[1]+"]" {
+					continue
+				}
+				if err := c.DeleteSecondary(ctx, zone.ID, s.ID); err != nil {
+					return err
+				}
+				fmt.Printf("Removed secondary %s\n", s.Address)
+				return nil
+			}
+			return fmt.Errorf("no secondary %s in %s", args[1], zone.Name)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "notify ZONE",
+		Short: "Send a NOTIFY for the zone to its secondaries",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			zone, err := c.FindZone(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			n, err := c.NotifySecondaries(ctx, zone.ID)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("NOTIFY sent to %d server(s)\n", n)
+			return nil
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func tokenCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "token", Short: "Manage API tokens"}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List your API tokens",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			tokens, err := c.ListTokens(ctx)
+			if err != nil {
+				return err
+			}
+			rows := make([][]any, 0, len(tokens))
+			for _, t := range tokens {
+				rows = append(rows, []any{t.ID, t.Name, t.CreatedAt, t.LastUsedAt})
+			}
+			return printTable(tokens, "ID\tNAME\tCREATED\tLAST USED", rows)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "create NAME",
+		Short: "Create an API token and print its secret",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			token, err := c.CreateToken(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(token)
+			}
+			// The secret alone on stdout, for scripts
+			fmt.Println(token.Token)
+			return nil
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+func trashCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "trash", Short: "Restore deleted zones and records"}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the deleted zones and records",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			items, err := c.ListTrash(ctx)
+			if err != nil {
+				return err
+			}
+			rows := make([][]any, 0, len(items))
+			for _, it := range items {
+				what := fmt.Sprintf("%d records", it.Records)
+				if it.Kind != "zone" {
+					what = fmt.Sprintf("%s %s %s", it.Name, it.Type, it.Value)
+				}
+				rows = append(rows, []any{it.ID, it.Kind, it.ZoneName, what,
+					it.DeletedAt.Local().Format("2006-01-02 15:04"), it.ExpiresAt.Local().Format("2006-01-02 15:04")})
+			}
+			return printTable(items, "ID\tKIND\tZONE\tCONTENT\tDELETED\tEXPIRES", rows)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "restore ID",
+		Short: "Restore a deleted zone or record",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid trash item id %q", args[0])
+			}
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			item, err := c.RestoreTrashItem(ctx, id)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(item)
+			}
+			if item.Kind == "zone" {
+				fmt.Printf("Restored zone %s\n", item.ZoneName)
+			} else {
+				fmt.Printf("Restored %s %s in %s\n", item.Name, item.Type, item.ZoneName)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm ID",
+		Short: "Delete a zone or record from the trash for good",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid trash item id %q", args[0])
+			}
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			return c.DeleteTrashItem(ctx, id)
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"simpledns/client"
+)
+
+func zoneCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "zone", Short: "Manage zones"}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the zones",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			zones, err := c.ListZones(ctx)
+			if err != nil {
+				return err
+			}
+			rows := make([][]any, 0, len(zones))
+			for _, z := range zones {
+				rows = append(rows, []any{z.ID, z.Name, z.Enabled, z.Serial, z.RecordCount})
+			}
+			return printTable(zones, "ID\tNAME\tENABLED\tSERIAL\tRECORDS", rows)
+		},
+	})
+
+	var in client.ZoneInput
+	var addressFilter string
+	add := &cobra.Command{
+		Use:   "add NAME",
+		Short: "Create a zone",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			in.Name = args[0]
+			if in.Forwarders != "" {
+				in.Type = "forward"
+			}
+			if in.Primaries != "" {
+				in.Type = "secondary"
+			}
+			if addressFilter != "" {
+				in.AddressFilter = &addressFilter
+			}
+			zone, err := c.CreateZone(ctx, in)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(zone)
+			}
+			fmt.Printf("Created zone %s (id %d)\n", zone.Name, zone.ID)
+			return nil
+		},
+	}
+	add.Flags().IntVar(&in.TTL, "ttl", 0, "default TTL")
+	add.Flags().StringVar(&in.NS, "ns", "", "primary name server")
+	add.Flags().StringVar(&in.Admin, "admin", "", "administrator mailbox")
+	add.Flags().StringVar(&in.Forwarders, "forward", "", "create a forward zone sent to these servers (comma-separated)")
+	add.Flags().StringVar(&in.Primaries, "secondary", "", "create a secondary zone transferred from these primaries (comma-separated IP[:port])")
+	add.MarkFlagsMutuallyExclusive("forward", "secondary")
+	add.Flags().StringVar(&addressFilter, "address-filter", "", "hide AAAA (or A) answers for names having the other type")
+	cmd.AddCommand(add)
+
+	var yes bool
+	del := &cobra.Command{
+		Use:   "delete NAME",
+		Short: "Delete a zone and its records",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			zone, err := c.FindZone(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			err = c.DeleteZone(ctx, zone.ID)
+			if token := client.ConfirmToken(err); token != "" {
+				if !yes {
+					return fmt.Errorf("%w (run again with --yes to delete it)", err)
+				}
+				err = c.DeleteZoneConfirmed(ctx, zone.ID, token)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Deleted zone %s\n", zone.Name)
+			return nil
+		},
+	}
+	del.Flags().BoolVar(&yes, "yes", false, "confirm the deletion of a zone holding many records")
+	cmd.AddCommand(del)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "export NAME",
+		Short: "Print a zone in zone file format",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			found, err := c.FindZone(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			zone, records, err := c.GetZone(ctx, found.ID)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(map[string]any{"zone": zone, "records": records})
+			}
+			writeZoneFile(os.Stdout, zone, records)
+			return nil
+		},
+	})
+
+	var now bool
+	transfer := &cobra.Command{
+		Use:   "transfer NAME",
+		Short: "Show the state of a secondary zone, refreshed from its primaries with --now",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			zone, err := c.FindZone(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			var t *client.ZoneTransfer
+			if now {
+				t, err = c.TransferZone(ctx, zone.ID)
+			} else {
+				t, err = c.GetZoneTransfer(ctx, zone.ID)
+			}
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(t)
+			}
+			fmt.Printf("Primaries:   %s\n", strings.Join(t.Primaries, ", "))
+			if t.TransferredAt.IsZero() {
+				fmt.Println("Serial:      not transferred yet")
+			} else {
+				fmt.Printf("Serial:      %d (%d records, transferred %s)\n", t.Serial, t.RecordCount, t.TransferredAt.Local().Format(time.DateTime))
+				fmt.Printf("Last check:  %s\n", t.CheckedAt.Local().Format(time.DateTime))
+			}
+			if t.ExpiresAt != nil {
+				fmt.Printf("Expires:     %s\n", t.ExpiresAt.Local().Format(time.DateTime))
+			}
+			if t.Error != "" {
+				fmt.Printf("Last error:  %s\n", t.Error)
+			}
+			return nil
+		},
+	}
+	transfer.Flags().BoolVar(&now, "now", false, "refresh the zone from its primaries first")
+	cmd.AddCommand(transfer)
+
+	var imp client.ZoneImport
+	var file string
+	var dryRun bool
+	importCmd := &cobra.Command{
+		Use:   "import NAME",
+		Short: "Create a zone from a zone file, Cloudflare or Route 53",
+		Long: `Create a zone from a zone file (--provider bind, the default), a Route 53
+list-resource-record-sets JSON export (--provider route53) or the
+Cloudflare API (--provider cloudflare --cloudflare-token ...).
+--file - reads the data from stdin.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			imp.Zone = args[0]
+			if imp.Provider != "cloudflare" {
+				if file == "" {
+					return fmt.Errorf("--file is required for provider %s", imp.Provider)
+				}
+				data, err := readInput(file)
+				if err != nil {
+					return err
+				}
+				imp.Data = string(data)
+			}
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			var skipped []client.SkippedRecord
+			if dryRun {
+				var records []client.Record
+				records, skipped, err = c.PreviewImport(ctx, imp)
+				if err != nil {
+					return err
+				}
+				if jsonOutput {
+					return printJSON(map[string]any{"records": records, "skipped": skipped})
+				}
+				for _, r := range records {
+					fmt.Printf("%s\t%d\t%s\t%s\n", r.Name, r.TTL, r.Type, r.Value)
+				}
+			} else {
+				var zone *client.Zone
+				zone, skipped, err = c.ImportZone(ctx, imp)
+				if err != nil {
+					return err
+				}
+				if jsonOutput {
+					return printJSON(map[string]any{"zone": zone, "skipped": skipped})
+				}
+				fmt.Printf("Imported zone %s (id %d)\n", zone.Name, zone.ID)
+			}
+			for _, s := range skipped {
+				fmt.Fprintf(os.Stderr, "skipped %s %s: %s\n", s.Name, s.Type, s.Reason)
+			}
+			return nil
+		},
+	}
+	importCmd.Flags().StringVar(&imp.Provider, "provider", "bind", "bind, route53 or cloudflare")
+	importCmd.Flags().StringVar(&file, "file", "", "zone file or Route 53 JSON (- for stdin)")
+	importCmd.Flags().StringVar(&imp.Token, "cloudflare-token", os.Getenv("CLOUDFLARE_API_TOKEN"), "Cloudflare API token (CLOUDFLARE_API_TOKEN)")
+	importCmd.Flags().BoolVar(&dryRun, "dry-run", false, "only print the records that would be created")
+	cmd.AddCommand(importCmd)
+	cmd.AddCommand(zoneSecondaryCommand())
+	cmd.AddCommand(zoneNotesCommand(), zoneReviewsCommand())
+
+	return cmd
+}
+
+func zoneNotesCommand() *cobra.Command {
+	var in client.ZoneNotes
+	var review string
+	notes := &cobra.Command{
+		Use:   "notes NAME",
+		Short: "Show the owner and review date of a zone, or change them with the flags",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			zone, err := c.FindZone(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			n, err := c.GetZoneNotes(ctx, zone.ID)
+			if err != nil {
+				return err
+			}
+			flags := cmd.Flags()
+			if flags.Changed("owner") {
+				n.Owner = in.Owner
+			}
+			if flags.Changed("contact") {
+				n.Contact = in.Contact
+			}
+			if flags.Changed("description") {
+				n.Description = in.Description
+			}
+			if flags.Changed("review") {
+				n.ReviewAt = nil
+				if review != "" {
+					day, err := time.Parse(time.DateOnly, review)
+					if err != nil {
+						return fmt.Errorf("invalid review date %q, expected YYYY-MM-DD", review)
+					}
+					n.ReviewAt = &day
+				}
+			}
+			for _, name := range []string{"owner", "contact", "description", "review"} {
+				if flags.Changed(name) {
+					if n, err = c.SetZoneNotes(ctx, zone.ID, *n); err != nil {
+						return err
+					}
+					break
+				}
+			}
+			if jsonOutput {
+				return printJSON(n)
+			}
+			fmt.Printf("Owner:        %s\n", n.Owner)
+			fmt.Printf("Contact:      %s\n", n.Contact)
+			if n.ReviewAt != nil {
+				fmt.Printf("Review date:  %s\n", n.ReviewAt.Format(time.DateOnly))
+			}
+			if n.RemindedAt != nil {
+				fmt.Printf("Reminder:     %s, sent %s\n", n.Reminder, n.RemindedAt.Local().Format(time.DateTime))
+			}
+			if n.Description != "" {
+				fmt.Printf("\n%s\n", n.Description)
+			}
+			return nil
+		},
+	}
+	notes.Flags().StringVar(&in.Owner, "owner", "", "team or person owning the zone")
+	notes.Flags().StringVar(&in.Contact, "contact", "", "how to reach the owner; an email address gets the reminders")
+	notes.Flags().StringVar(&in.Description, "description", "", "what the zone is for")
+	notes.Flags().StringVar(&review, "review", "", "review date (YYYY-MM-DD, empty to remove)")
+	return notes
+}
+
+func zoneReviewsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reviews",
+		Short: "List the zones with a review date, soonest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, ctx, cancel, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			reviews, err := c.ListZoneReviews(ctx)
+			if err != nil {
+				return err
+			}
+			rows := make([][]any, 0, len(reviews))
+			for _, r := range reviews {
+				rows = append(rows, []any{r.ZoneName, r.ReviewAt.Format(time.DateOnly), r.Review, r.Owner, r.Contact})
+			}
+			return printTable(reviews, "ZONE\tREVIEW\tSTATUS\tOWNER\tCONTACT", rows)
+		},
+	}
+}
+
+// readInput reads a file, or stdin for "-"
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// writeZoneFile prints the zone in RFC 1035 zone file format
+func writeZoneFile(w io.Writer, zone *client.Zone, records []client.Record) {
+	origin := strings.TrimSuffix(zone.Name, ".") + "."
+	fqdn := func(name string) string {
+		if strings.HasSuffix(name, ".") {
+			return name
+		}
+		return name + "."
+	}
+	fmt.Fprintf(w, "$ORIGIN %s\n$TTL %d\n", origin, zone.TTL)
+	fmt.Fprintf(w, "@\t%d\tIN\tSOA\t%s %s %d %d %d %d %d\n", zone.TTL, fqdn(zone.NS),
+		fqdn(strings.Replace(zone.Admin, "@", ".", 1)), zone.Serial, zone.Refresh, zone.Retry, zone.Expire, zone.Minimum)
+	fmt.Fprintf(w, "@\t%d\tIN\tNS\t%s\n", zone.TTL, fqdn(zone.NS))
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%d\tIN\t%s\t%s\n", r.Name, r.TTL, r.Type, r.Value)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// ZoneProblemsReport is what the last periodic check found in one zone
+type ZoneProblemsReport struct {
+	Zone      string        `json:"zone"`
+	CheckedAt *time.Time    `json:"checked_at"` // nil until the zone is checked
+	Problems  []ZoneProblem `json:"problems"`
+}
+
+var (
+	// zoneProblems holds the findings of the last check, by zone apex
+	zoneProblems   map[string][]ZoneProblem
+	zoneProblemsAt time.Time
+	zoneProblemsMu sync.RWMutex
+)
+
+// targetChecker looks up the targets of the records the way clients would,
+// through the DNS handler, and probes the name servers of the zones. The
+// answers are kept for one check so a target shared by many records is
+// only asked once.
+type targetChecker struct {
+	zd      *ZoneData
+	answers map[string]*dns.Msg // by name and type, nil when nobody answered
+	probes  map[string]string   // by address and zone, "" when it answers authoritatively
+}
+
+// query answers name and qtype through the DNS handler: from the local
+// zones, the forwarders or the recursive resolver
+func (tc *targetChecker) query(name string, qtype uint16) *dns.Msg {
+	key := strings.ToLower(name) + " " + dns.TypeToString[qtype]
+	if m, ok := tc.answers[key]; ok {
+		return m
+	}
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(name), qtype)
+	w := &traceWriter{remote: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}}
+	handleDNS(w, req)
+	tc.answers[key] = w.msg
+	return w.msg
+}
+
+// settled reports whether a response says for sure what exists: a failed
+// lookup says nothing about the target
+func settled(m *dns.Msg) bool {
+	return m != nil && (m.Rcode == dns.RcodeSuccess || m.Rcode == dns.RcodeNameError)
+}
+
+// addresses returns the addresses of name, and false when they could not
+// be looked up
+func (tc *targetChecker) addresses(name string) ([]string, bool) {
+	var addrs []string
+	ok := false
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		m := tc.query(name, qtype)
+		if !settled(m) {
+			continue
+		}
+		ok = true
+		for _, rr := range m.Answer {
+			switch rr := rr.(type) {
+			case *dns.A:
+				addrs = append(addrs, rr.A.String())
+			case *dns.AAAA:
+				addrs = append(addrs, rr.AAAA.String())
+			}
+		}
+	}
+	return addrs, ok || len(addrs) > 0
+}
+
+// probe asks addr for the SOA of zone, and returns what is wrong with the
+// answer, "" when it is authoritative
+func (tc *targetChecker) probe(addr, zone string) string {
+	key := addr + " " + zone
+	if problem, ok := tc.probes[key]; ok {
+		return problem
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(zone, dns.TypeSOA)
+	m.RecursionDesired = false
+	c := &dns.Client{Timeout: 3 * time.Second}
+	problem := ""
+	resp, _, err := c.Exchange(m, net.JoinHostPort(addr, "53"))
+	switch {
+	case err != nil:
+		problem = "unreachable"
+	case !resp.Authoritative || resp.Rcode != dns.RcodeSuccess:
+		problem = "lame"
+	}
+	tc.probes[key] = problem
+	return problem
+}
+
+// local reports whether name is in a zone served here: lintZone checks
+// those targets
+func (tc *targetChecker) local(name string) bool {
+	return tc.zd.FindZone(name) != ""
+}
+
+// checkZone looks for the records of the zone at apex pointing to names
+// that do not exist or have no address, and for name servers that cannot
+// be reached or do not serve the zone they are listed for
+func (tc *targetChecker) checkZone(apex string) []ZoneProblem {
+	rrs, _ := tc.zd.ZoneRRs(apex)
+	l := &zoneLinter{zd: tc.zd, apex: apex}
+	for _, rr := range rrs {
+		name := strings.ToLower(rr.Header().Name)
+		switch rr := rr.(type) {
+		case *dns.CNAME:
+			if tc.local(rr.Target) {
+				continue
+			}
+			if m := tc.query(rr.Target, dns.TypeA); m != nil && m.Rcode == dns.RcodeNameError {
+				l.report(severityWarning, name, dns.TypeCNAME, "dangling CNAME: %s does not exist", rr.Target)
+			}
+		case *dns.MX:
+			if rr.Mx == "." || tc.local(rr.Mx) {
+				continue
+			}
+			if addrs, ok := tc.addresses(rr.Mx); ok && len(addrs) == 0 {
+				l.report(severityWarning, name, dns.TypeMX, "MX target %s has no A or AAAA record", rr.Mx)
+			}
+		case *dns.NS:
+			addrs, ok := tc.addresses(rr.Ns)
+			if !ok {
+				continue
+			}
+			if len(addrs) == 0 {
+				if !tc.local(rr.Ns) {
+					l.report(severityWarning, name, dns.TypeNS, "NS target %s has no A or AAAA record", rr.Ns)
+				}
+				continue
+			}
+			var lame, unreachable int
+			for _, addr := range addrs {
+				switch tc.probe(addr, name) {
+				case "lame":
+					lame++
+				case "unreachable":
+					unreachable++
+				}
+			}
+			switch {
+			case unreachable == len(addrs):
+				l.report(severityWarning, name, dns.TypeNS, "name server %s does not answer on any of its addresses (%s)", rr.Ns, strings.Join(addrs, ", "))
+			case lame > 0:
+				l.report(severityWarning, name, dns.TypeNS, "lame delegation: %s does not answer authoritatively for %s", rr.Ns, name)
+			}
+		}
+	}
+	return l.problems
+}
+
+// checkZoneProblems lints every zone served and checks the targets of their
+// records, and keeps the findings for /api/zones/:id/problems
+func checkZoneProblems() {
+	zd := zoneStore.Load()
+	tc := &targetChecker{zd: zd, answers: make(map[string]*dns.Msg), probes: make(map[string]string)}
+	found := make(map[string][]ZoneProblem)
+	count := 0
+	for _, apex := range zd.ZoneNames() {
+		apex = strings.ToLower(apex)
+		if _, ok := zd.ForwardZone(apex); ok {
+			continue
+		}
+		problems := append(lintZone(zd, apex, nil), tc.checkZone(apex)...)
+		if len(problems) > 0 {
+			found[apex] = problems
+			count += len(problems)
+		}
+	}
+	slog.Debug("Zones checked for dangling records", "zones", len(zd.ZoneNames()), "problems", count)
+
+	zoneProblemsMu.Lock()
+	zoneProblems = found
+	zoneProblemsAt = time.Now()
+	zoneProblemsMu.Unlock()
+}
+
+// problemsWarning returns a health warning when the last check found
+// problems in some zones
+func problemsWarning() string {
+	zoneProblemsMu.RLock()
+	defer zoneProblemsMu.RUnlock()
+	if len(zoneProblems) == 0 {
+		return ""
+	}
+	return strconv.Itoa(len(zoneProblems)) + " zone(s) have dangling or lame records (see GET /api/zones/:id/problems)"
+}
+
+// startProblemsChecker runs checkZoneProblems now and then periodically
+func startProblemsChecker(interval time.Duration) {
+	go func() {
+		checkZoneProblems()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			checkZoneProblems()
+		}
+	}()
+}
+
+// handleAPIZoneProblems handles GET /api/zones/:id/problems, the findings of
+// the last periodic check of the zone
+func handleAPIZoneProblems(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone id"})
+		return
+	}
+	zone, err := database.GetZone(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+
+	apex := strings.ToLower(dns.Fqdn(zone.Name))
+	report := ZoneProblemsReport{Zone: apex, Problems: []ZoneProblem{}}
+	zoneProblemsMu.RLock()
+	if !zoneProblemsAt.IsZero() {
+		at := zoneProblemsAt
+		report.CheckedAt = &at
+	}
+	if problems, ok := zoneProblems[apex]; ok {
+		report.Problems = problems
+	}
+	zoneProblemsMu.RUnlock()
+	c.JSON(http.StatusOK, report)
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/miekg/dns"
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
 )
 
 // Database holds the SQLite connection
@@ -28,6 +33,21 @@ type DBZone struct {
 	Refresh int    `json:"refresh"`
 	Retry   int    `json:"retry"`
 	Expire  int    `json:"expire"`
+	Minimum int    `json:"minimum"` // SOA minimum, the negative caching TTL
+	// NSAddress lists the addresses (comma-separated) of an NS name inside
+	// the zone, served as its glue A/AAAA records
+	NSAddress string `json:"ns_address"`
+	// Type is "primary", "forward" or "secondary"; a forward zone has no
+	// records, its names are sent to Forwarders (comma-separated
+	// host[:port]); a secondary zone is transferred from Primaries
+	Type       string `json:"type"`
+	Forwarders string `json:"forwarders,omitempty"`
+	Primaries  string `json:"primaries,omitempty"`
+	// AddressFilter is the address type (AAAA or A) hidden in the answers
+	// when the name has the other type, empty for none
+	AddressFilter string `json:"address_filter,omitempty"`
+	// Version counts the updates of the settings, served as the ETag
+	Version int64 `json:"version"`
 }
 
 // DBRecord represents a DNS record in the database
@@ -39,6 +59,10 @@ type DBRecord struct {
 	Value    string `json:"value"`
 	TTL      int    `json:"ttl"`
 	Priority int    `json:"priority"`
+	Version  int64  `json:"version"` // counts the updates, served as the ETag
+	RecordSchedule
+	RecordNotes
+	RecordCaching
 }
 
 // DBForwarder represents a forwarder in the database
@@ -46,6 +70,13 @@ type DBForwarder struct {
 	ID       int64  `json:"id"`
 	Address  string `json:"address"`
 	Priority int    `json:"priority"`
+	UpstreamOptions
+}
+
+// DBClient is the label and policy set for one client address
+type DBClient struct {
+	Address string `json:"address"`
+	ClientSettings
 }
 
 // DBConfig represents a config entry in the database
@@ -54,6 +85,144 @@ type DBConfig struct {
 	Value string `json:"value"`
 }
 
+// DBCertificate represents a TLS certificate and its private key
+type DBCertificate struct {
+	Name     string    `json:"name"`
+	CertPEM  string    `json:"-"`
+	KeyPEM   string    `json:"-"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// DBSignedRecord is DNSSEC material (and the signed apex SOA/NS) imported
+// from an externally signed zone, served as-is
+type DBSignedRecord struct {
+	ID     int64  `json:"id"`
+	ZoneID int64  `json:"zone_id"`
+	Name   string `json:"name"` // fully qualified owner name
+	Type   string `json:"type"`
+	Value  string `json:"value"` // rdata in presentation format
+	TTL    int    `json:"ttl"`
+}
+
+// DBZoneSecondary is a secondary server of a zone: it is sent a NOTIFY when
+// the zone changes and may transfer it, with a TSIG key when one is set
+type DBZoneSecondary struct {
+	ID            int64  `json:"id"`
+	ZoneID        int64  `json:"zone_id"`
+	Address       string `json:"address"` // host:port the NOTIFY goes to
+	TSIGKey       string `json:"tsig_key,omitempty"`
+	TSIGAlgorithm string `json:"tsig_algorithm,omitempty"`
+	TSIGSecret    string `json:"tsig_secret,omitempty"` // base64
+}
+
+// DBZoneNotes are the notes of a zone with the reminder last sent about
+// its review date: "due" or "overdue", empty when none was
+type DBZoneNotes struct {
+	ZoneID   int64  `json:"zone_id"`
+	ZoneName string `json:"zone_name"`
+	ZoneNotes
+	Reminder   string     `json:"reminder,omitempty"`
+	RemindedAt *time.Time `json:"reminded_at,omitempty"`
+}
+
+// DBSecondaryZone is the copy of a secondary zone transferred from its
+// primary, served read-only
+type DBSecondaryZone struct {
+	ZoneID  int64  `json:"zone_id"`
+	Serial  uint32 `json:"serial"`
+	Records string `json:"-"` // the zone in zone file format, SOA first
+	// TransferredAt is the time of the last transfer, CheckedAt the last
+	// time the primary confirmed the serial; the zone expires when
+	// CheckedAt is older than the SOA expire
+	TransferredAt time.Time `json:"transferred_at"`
+	CheckedAt     time.Time `json:"checked_at"`
+	Error         string    `json:"error,omitempty"` // of the last refresh
+}
+
+// DBTrashItem is a deleted zone or record, kept in the trash until it is
+// restored or its retention ends
+type DBTrashItem struct {
+	ID       int64  `json:"id"`
+	Kind     string `json:"kind"` // "zone" or "record"
+	ZoneID   int64  `json:"zone_id"`
+	ZoneName string `json:"zone_name"`
+	// Name, Type and Value are those of a deleted record, Records the
+	// number of records of a deleted zone
+	Name      string    `json:"name,omitempty"`
+	Type      string    `json:"type,omitempty"`
+	Value     string    `json:"value,omitempty"`
+	Records   int       `json:"records,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// trashedZone is a deleted zone as kept in the trash, with what is deleted
+// along with it
+type trashedZone struct {
+	Zone        DBZone            `json:"zone"`
+	Records     []DBRecord        `json:"records"`
+	Signed      []DBSignedRecord  `json:"signed,omitempty"`
+	Secondaries []DBZoneSecondary `json:"secondaries,omitempty"`
+	Notes       *ZoneNotes        `json:"notes,omitempty"`
+}
+
+// DBAuditEntry is one entry of the compliance audit log. Hash chains the
+// entry to the previous one so any later modification is detectable.
+type DBAuditEntry struct {
+	ID           int64     `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Username     string    `json:"username"`
+	AuthType     string    `json:"auth_type"`
+	ClientIP     string    `json:"client_ip"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	Status       int       `json:"status"`
+	RequestBody  string    `json:"request_body"`
+	ResponseBody string    `json:"response_body"`
+	PrevHash     string    `json:"prev_hash"`
+	Hash         string    `json:"hash"`
+}
+
+// DBChangeset is a set of staged record changes to a zone, applied
+// together or discarded
+type DBChangeset struct {
+	ID        int64      `json:"id"`
+	ZoneID    int64      `json:"zone_id"`
+	Status    string     `json:"status"` // pending, applied or discarded
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	Changes   []DBChange `json:"changes,omitempty"`
+}
+
+// DBChange is one staged record change. RecordID is the record updated or
+// deleted; the record fields are the new content for create and update.
+type DBChange struct {
+	ID          int64  `json:"id"`
+	ChangesetID int64  `json:"changeset_id"`
+	Action      string `json:"action"` // create, update or delete
+	RecordID    int64  `json:"record_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Value       string `json:"value,omitempty"`
+	TTL         int    `json:"ttl,omitempty"`
+	Priority    int    `json:"priority,omitempty"`
+	RecordSchedule
+	RecordNotes
+	RecordCaching
+}
+
+// DBStatsRow is the query counters of one minute or one hour, starting at
+// Time (unix seconds). Rcodes are counted in the order of statsRcodes, then
+// the other rcodes.
+type DBStatsRow struct {
+	Time      int64
+	Total     uint64
+	Local     uint64
+	Forwarded uint64
+	Cached    uint64
+	Rcodes    [7]uint64
+}
+
 var database *Database
 
 // configureSQLite sets up SQLite pragmas for better performance and concurrency
@@ -88,6 +257,11 @@ func InitDatabase(dbPath string) error {
 	db.SetMaxOpenConns(10)   // Maximum open connections
 	db.SetMaxIdleConns(5)    // Maximum idle connections
 	db.SetConnMaxLifetime(0) // No limit on connection lifetime
+	if dbPath == ":memory:" {
+		// Each connection would get its own empty in-memory database
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+	}
 
 	database = &Database{db: db}
 
@@ -113,9 +287,92 @@ func InitDatabase(dbPath string) error {
 func (d *Database) runMigrations() error {
 	// Add priority column to records table if it doesn't exist
 	_, err := d.db.Exec(`ALTER TABLE records ADD COLUMN priority INTEGER DEFAULT 0`)
+	// Ignore "duplicate column name" error as it means the column already exists
 	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
-		// Ignore "duplicate column name" error as it means the column already exists
-		return nil
+		return fmt.Errorf("add records.priority: %w", err)
+	}
+
+	// Add the SOA minimum (negative caching TTL) to zones
+	_, err = d.db.Exec(`ALTER TABLE zones ADD COLUMN minimum INTEGER DEFAULT 3600`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		return fmt.Errorf("add zones.minimum: %w", err)
+	}
+
+	// Add the glue addresses of the apex NS to zones
+	_, err = d.db.Exec(`ALTER TABLE zones ADD COLUMN ns_address TEXT DEFAULT ''`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		return fmt.Errorf("add zones.ns_address: %w", err)
+	}
+
+	// Add forward zones
+	_, err = d.db.Exec(`ALTER TABLE zones ADD COLUMN type TEXT DEFAULT 'primary'`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		return fmt.Errorf("add zones.type: %w", err)
+	}
+	_, err = d.db.Exec(`ALTER TABLE zones ADD COLUMN forwarders TEXT DEFAULT ''`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		return fmt.Errorf("add zones.forwarders: %w", err)
+	}
+
+	// Add the address filter of each zone
+	_, err = d.db.Exec(`ALTER TABLE zones ADD COLUMN address_filter TEXT DEFAULT ''`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		return fmt.Errorf("add zones.address_filter: %w", err)
+	}
+
+	// Add the primaries of secondary zones
+	_, err = d.db.Exec(`ALTER TABLE zones ADD COLUMN primaries TEXT NOT NULL DEFAULT ''`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		return fmt.Errorf("add zones.primaries: %w", err)
+	}
+
+	// Add the activation and expiry of scheduled records, staged ones too
+	for _, table := range []string{"records", "changeset_changes"} {
+		for _, column := range []string{"activate_at", "expire_at"} {
+			_, err = d.db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` TEXT NOT NULL DEFAULT ''`)
+			if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+				return fmt.Errorf("add %s.%s: %w", table, column, err)
+			}
+		}
+	}
+
+	// Add the comment and tags of records, staged ones too
+	for _, table := range []string{"records", "changeset_changes"} {
+		for _, column := range []string{"comment", "tags"} {
+			_, err = d.db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` TEXT NOT NULL DEFAULT ''`)
+			if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+				return fmt.Errorf("add %s.%s: %w", table, column, err)
+			}
+		}
+	}
+
+	// Add the cache control of records, staged ones too
+	for _, table := range []string{"records", "changeset_changes"} {
+		_, err = d.db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN no_cache INTEGER NOT NULL DEFAULT 0`)
+		if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return fmt.Errorf("add %s.no_cache: %w", table, err)
+		}
+	}
+
+	// Add the version of zones and records, checked by If-Match
+	for _, table := range []string{"zones", "records"} {
+		_, err = d.db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN version INTEGER NOT NULL DEFAULT 1`)
+		if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return fmt.Errorf("add %s.version: %w", table, err)
+		}
+	}
+
+	// Add the timeout, retries, backoff and weight of each forwarder
+	for _, column := range []string{"timeout_ms", "retries", "backoff_ms", "weight"} {
+		_, err = d.db.Exec(`ALTER TABLE forwarders ADD COLUMN ` + column + ` INTEGER DEFAULT 0`)
+		if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return fmt.Errorf("add forwarders.%s: %w", column, err)
+		}
+	}
+
+	// Records of the same name and type used to have their own TTLs
+	if err := d.unifyRRSetTTLs(); err != nil {
+		return fmt.Errorf("unify RRset TTLs: %w", err)
 	}
 	return nil
 }
@@ -134,6 +391,13 @@ func (d *Database) createTables() error {
 		refresh INTEGER DEFAULT 3600,
 		retry INTEGER DEFAULT 600,
 		expire INTEGER DEFAULT 86400,
+		minimum INTEGER DEFAULT 3600,
+		ns_address TEXT DEFAULT '',
+		type TEXT DEFAULT 'primary',
+		forwarders TEXT DEFAULT '',
+		address_filter TEXT DEFAULT '',
+		primaries TEXT NOT NULL DEFAULT '',
+		version INTEGER NOT NULL DEFAULT 1,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -146,6 +410,12 @@ func (d *Database) createTables() error {
 		value TEXT NOT NULL,
 		ttl INTEGER DEFAULT 3600,
 		priority INTEGER DEFAULT 0,
+		activate_at TEXT NOT NULL DEFAULT '',
+		expire_at TEXT NOT NULL DEFAULT '',
+		comment TEXT NOT NULL DEFAULT '',
+		tags TEXT NOT NULL DEFAULT '',
+		no_cache INTEGER NOT NULL DEFAULT 0,
+		version INTEGER NOT NULL DEFAULT 1,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (zone_id) REFERENCES zones(id) ON DELETE CASCADE
@@ -155,9 +425,40 @@ func (d *Database) createTables() error {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		address TEXT UNIQUE NOT NULL,
 		priority INTEGER DEFAULT 0,
+		timeout_ms INTEGER DEFAULT 0,
+		retries INTEGER DEFAULT 0,
+		backoff_ms INTEGER DEFAULT 0,
+		weight INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS clients (
+		address TEXT PRIMARY KEY,
+		label TEXT NOT NULL DEFAULT '',
+		group_name TEXT NOT NULL DEFAULT '',
+		blocking TEXT NOT NULL DEFAULT '',
+		blocklists TEXT NOT NULL DEFAULT '',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS access_schedules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		group_name TEXT NOT NULL DEFAULT '',
+		days TEXT NOT NULL DEFAULT '',
+		start_time TEXT NOT NULL,
+		end_time TEXT NOT NULL,
+		blocklists TEXT NOT NULL DEFAULT '',
+		pause INTEGER NOT NULL DEFAULT 0,
+		enabled INTEGER NOT NULL DEFAULT 1,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
+	CREATE TABLE IF NOT EXISTS client_pauses (
+		address TEXT PRIMARY KEY,
+		until TEXT NOT NULL
+	);
+
 	CREATE TABLE IF NOT EXISTS config (
 		key TEXT PRIMARY KEY,
 		value TEXT NOT NULL,
@@ -182,9 +483,155 @@ func (d *Database) createTables() error {
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 	);
 
+	CREATE TABLE IF NOT EXISTS certificates (
+		name TEXT PRIMARY KEY,
+		cert_pem TEXT NOT NULL,
+		key_pem TEXT NOT NULL,
+		not_after DATETIME NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS signed_records (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		zone_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		value TEXT NOT NULL,
+		ttl INTEGER NOT NULL,
+		FOREIGN KEY (zone_id) REFERENCES zones(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS zone_secondaries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		zone_id INTEGER NOT NULL,
+		address TEXT NOT NULL,
+		tsig_key TEXT NOT NULL DEFAULT '',
+		tsig_algorithm TEXT NOT NULL DEFAULT '',
+		tsig_secret TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (zone_id, address),
+		FOREIGN KEY (zone_id) REFERENCES zones(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS zone_notes (
+		zone_id INTEGER PRIMARY KEY,
+		owner TEXT NOT NULL DEFAULT '',
+		contact TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT '',
+		review_at TEXT NOT NULL DEFAULT '',
+		reminder TEXT NOT NULL DEFAULT '',
+		reminded_at TEXT NOT NULL DEFAULT '',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (zone_id) REFERENCES zones(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS secondary_zones (
+		zone_id INTEGER PRIMARY KEY,
+		serial INTEGER NOT NULL DEFAULT 0,
+		records TEXT NOT NULL DEFAULT '',
+		transferred_at TEXT NOT NULL DEFAULT '',
+		checked_at TEXT NOT NULL DEFAULT '',
+		error TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY (zone_id) REFERENCES zones(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TEXT NOT NULL,
+		username TEXT NOT NULL,
+		auth_type TEXT NOT NULL,
+		client_ip TEXT NOT NULL,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		request_body TEXT NOT NULL,
+		response_body TEXT NOT NULL,
+		prev_hash TEXT NOT NULL,
+		hash TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS trash (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		zone_id INTEGER NOT NULL,
+		zone_name TEXT NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		type TEXT NOT NULL DEFAULT '',
+		value TEXT NOT NULL DEFAULT '',
+		records INTEGER NOT NULL DEFAULT 0,
+		data TEXT NOT NULL,
+		deleted_at TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS changesets (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		zone_id INTEGER NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (zone_id) REFERENCES zones(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS changeset_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		changeset_id INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		record_id INTEGER NOT NULL DEFAULT 0,
+		name TEXT NOT NULL DEFAULT '',
+		type TEXT NOT NULL DEFAULT '',
+		value TEXT NOT NULL DEFAULT '',
+		ttl INTEGER NOT NULL DEFAULT 0,
+		priority INTEGER NOT NULL DEFAULT 0,
+		activate_at TEXT NOT NULL DEFAULT '',
+		expire_at TEXT NOT NULL DEFAULT '',
+		comment TEXT NOT NULL DEFAULT '',
+		tags TEXT NOT NULL DEFAULT '',
+		no_cache INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (changeset_id) REFERENCES changesets(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS stats_minutes (
+		time INTEGER PRIMARY KEY,
+		total INTEGER NOT NULL,
+		local INTEGER NOT NULL,
+		forwarded INTEGER NOT NULL,
+		cached INTEGER NOT NULL,
+		rcode_noerror INTEGER NOT NULL,
+		rcode_formerr INTEGER NOT NULL,
+		rcode_servfail INTEGER NOT NULL,
+		rcode_nxdomain INTEGER NOT NULL,
+		rcode_notimp INTEGER NOT NULL,
+		rcode_refused INTEGER NOT NULL,
+		rcode_other INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS stats_hours (
+		time INTEGER PRIMARY KEY,
+		total INTEGER NOT NULL,
+		local INTEGER NOT NULL,
+		forwarded INTEGER NOT NULL,
+		cached INTEGER NOT NULL,
+		rcode_noerror INTEGER NOT NULL,
+		rcode_formerr INTEGER NOT NULL,
+		rcode_servfail INTEGER NOT NULL,
+		rcode_nxdomain INTEGER NOT NULL,
+		rcode_notimp INTEGER NOT NULL,
+		rcode_refused INTEGER NOT NULL,
+		rcode_other INTEGER NOT NULL
+	);
+
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+
 	CREATE INDEX IF NOT EXISTS idx_records_zone_id ON records(zone_id);
 	CREATE INDEX IF NOT EXISTS idx_records_name ON records(name);
+	CREATE INDEX IF NOT EXISTS idx_signed_records_zone_id ON signed_records(zone_id);
 	CREATE INDEX IF NOT EXISTS idx_api_tokens_hash ON api_tokens(token_hash);
+	CREATE INDEX IF NOT EXISTS idx_changeset_changes_changeset_id ON changeset_changes(changeset_id);
 	`
 
 	_, err := d.db.Exec(schema)
@@ -196,6 +643,12 @@ func (d *Database) Close() error {
 	return d.db.Close()
 }
 
+// Ping checks that the database answers
+func (d *Database) Ping(ctx context.Context) error {
+	var one int
+	return d.db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
 // Zone CRUD operations
 
 // CreateZone creates a new zone
@@ -205,16 +658,61 @@ func (d *Database) CreateZone(zone *DBZone) error {
 
 	// Ensure zone name does not have trailing dot
 	zone.Name = strings.TrimSuffix(zone.Name, ".")
+	if zone.Type == "" {
+		zone.Type = zoneTypePrimary
+	}
 
 	result, err := d.db.Exec(`
-		INSERT INTO zones (name, enabled, ttl, ns, admin, serial, refresh, retry, expire)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, zone.Name, zone.Enabled, zone.TTL, zone.NS, zone.Admin, zone.Serial, zone.Refresh, zone.Retry, zone.Expire)
+		INSERT INTO zones (name, enabled, ttl, ns, admin, serial, refresh, retry, expire, minimum, ns_address, type, forwarders, address_filter, primaries)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, zone.Name, zone.Enabled, zone.TTL, zone.NS, zone.Admin, zone.Serial, zone.Refresh, zone.Retry, zone.Expire, zone.Minimum, zone.NSAddress, zone.Type, zone.Forwarders, zone.AddressFilter, zone.Primaries)
 	if err != nil {
 		return err
 	}
 
 	zone.ID, _ = result.LastInsertId()
+	zone.Version = 1
+	return nil
+}
+
+// CreateZoneWithRecords creates a zone and its records in one transaction,
+// so a failed import leaves nothing behind
+func (d *Database) CreateZoneWithRecords(zone *DBZone, records []DBRecord) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	zone.Name = strings.TrimSuffix(zone.Name, ".")
+	if zone.Type == "" {
+		zone.Type = zoneTypePrimary
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.Exec(`
+		INSERT INTO zones (name, enabled, ttl, ns, admin, serial, refresh, retry, expire, minimum, ns_address, type, forwarders, address_filter, primaries)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, zone.Name, zone.Enabled, zone.TTL, zone.NS, zone.Admin, zone.Serial, zone.Refresh, zone.Retry, zone.Expire, zone.Minimum, zone.NSAddress, zone.Type, zone.Forwarders, zone.AddressFilter, zone.Primaries)
+	if err != nil {
+		return err
+	}
+	zoneID, _ := result.LastInsertId()
+
+	for _, r := range records {
+		if _, err := tx.Exec(`
+			INSERT INTO records (zone_id, name, type, value, ttl, priority) VALUES (?, ?, ?, ?, ?, ?)
+		`, zoneID, r.Name, r.Type, r.Value, r.TTL, r.Priority); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	zone.ID = zoneID
 	return nil
 }
 
@@ -225,10 +723,10 @@ func (d *Database) GetZone(id int64) (*DBZone, error) {
 
 	zone := &DBZone{}
 	err := d.db.QueryRow(`
-		SELECT id, name, enabled, ttl, ns, admin, serial, refresh, retry, expire
+		SELECT id, name, enabled, ttl, ns, admin, serial, refresh, retry, expire, minimum, ns_address, type, forwarders, address_filter, primaries, version
 		FROM zones WHERE id = ?
 	`, id).Scan(&zone.ID, &zone.Name, &zone.Enabled, &zone.TTL, &zone.NS, &zone.Admin,
-		&zone.Serial, &zone.Refresh, &zone.Retry, &zone.Expire)
+		&zone.Serial, &zone.Refresh, &zone.Retry, &zone.Expire, &zone.Minimum, &zone.NSAddress, &zone.Type, &zone.Forwarders, &zone.AddressFilter, &zone.Primaries, &zone.Version)
 	if err != nil {
 		return nil, err
 	}
@@ -243,10 +741,10 @@ func (d *Database) GetZoneByName(name string) (*DBZone, error) {
 	name = strings.TrimSuffix(name, ".")
 	zone := &DBZone{}
 	err := d.db.QueryRow(`
-		SELECT id, name, enabled, ttl, ns, admin, serial, refresh, retry, expire
+		SELECT id, name, enabled, ttl, ns, admin, serial, refresh, retry, expire, minimum, ns_address, type, forwarders, address_filter, primaries, version
 		FROM zones WHERE name = ?
 	`, name).Scan(&zone.ID, &zone.Name, &zone.Enabled, &zone.TTL, &zone.NS, &zone.Admin,
-		&zone.Serial, &zone.Refresh, &zone.Retry, &zone.Expire)
+		&zone.Serial, &zone.Refresh, &zone.Retry, &zone.Expire, &zone.Minimum, &zone.NSAddress, &zone.Type, &zone.Forwarders, &zone.AddressFilter, &zone.Primaries, &zone.Version)
 	if err != nil {
 		return nil, err
 	}
@@ -259,7 +757,7 @@ func (d *Database) ListZones() ([]DBZone, error) {
 	defer d.mu.RUnlock()
 
 	rows, err := d.db.Query(`
-		SELECT id, name, enabled, ttl, ns, admin, serial, refresh, retry, expire
+		SELECT id, name, enabled, ttl, ns, admin, serial, refresh, retry, expire, minimum, ns_address, type, forwarders, address_filter, primaries, version
 		FROM zones ORDER BY name
 	`)
 	if err != nil {
@@ -271,7 +769,7 @@ func (d *Database) ListZones() ([]DBZone, error) {
 	for rows.Next() {
 		var z DBZone
 		if err := rows.Scan(&z.ID, &z.Name, &z.Enabled, &z.TTL, &z.NS, &z.Admin,
-			&z.Serial, &z.Refresh, &z.Retry, &z.Expire); err != nil {
+			&z.Serial, &z.Refresh, &z.Retry, &z.Expire, &z.Minimum, &z.NSAddress, &z.Type, &z.Forwarders, &z.AddressFilter, &z.Primaries, &z.Version); err != nil {
 			return nil, err
 		}
 		zones = append(zones, z)
@@ -279,48 +777,164 @@ func (d *Database) ListZones() ([]DBZone, error) {
 	return zones, nil
 }
 
-// UpdateZone updates a zone
+// ZoneWithCount is a zone with the number of its records
+type ZoneWithCount struct {
+	DBZone
+	RecordCount int `json:"record_count"`
+}
+
+// ListZonesPage returns the zones matching q with their record counts,
+// and the number of zones matching the filters
+func (d *Database) ListZonesPage(q ListQuery) ([]ZoneWithCount, int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	where := ` WHERE 1 = 1`
+	var args []any
+	if q.Name != "" {
+		where += ` AND z.name LIKE ? ESCAPE '\'`
+		args = append(args, likePattern(q.Name))
+	}
+	if q.Type != "" {
+		where += ` AND z.type = ?`
+		args = append(args, strings.ToLower(q.Type))
+	}
+
+	var total int
+	if err := d.db.QueryRow(`SELECT COUNT(*) FROM zones z`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	order, pageArgs := q.orderBy("z.id")
+	rows, err := d.db.Query(`
+		SELECT z.id, z.name, z.enabled, z.ttl, z.ns, z.admin, z.serial, z.refresh, z.retry, z.expire, z.minimum, z.ns_address, z.type, z.forwarders, z.address_filter, z.primaries, z.version,
+		COALESCE(c.n, 0) AS record_count
+		FROM zones z LEFT JOIN (SELECT zone_id, COUNT(*) AS n FROM records GROUP BY zone_id) c ON c.zone_id = z.id`+where+order,
+		append(args, pageArgs...)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	zones := []ZoneWithCount{}
+	for rows.Next() {
+		var z ZoneWithCount
+		if err := rows.Scan(&z.ID, &z.Name, &z.Enabled, &z.TTL, &z.NS, &z.Admin,
+			&z.Serial, &z.Refresh, &z.Retry, &z.Expire, &z.Minimum, &z.NSAddress, &z.Type, &z.Forwarders, &z.AddressFilter, &z.Primaries, &z.Version, &z.RecordCount); err != nil {
+			return nil, 0, err
+		}
+		zones = append(zones, z)
+	}
+	return zones, total, rows.Err()
+}
+
+// RecordCounts returns the number of records of each zone in one query
+func (d *Database) RecordCounts() (map[int64]int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	rows, err := d.db.Query(`SELECT zone_id, COUNT(*) FROM records GROUP BY zone_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	counts := make(map[int64]int)
+	for rows.Next() {
+		var id int64
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+	return counts, rows.Err()
+}
+
+// UpdateZone updates a zone. A non-zero Version is the version the zone
+// must still have, errVersionConflict otherwise; it is set to the new one.
 func (d *Database) UpdateZone(zone *DBZone) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
 	zone.Name = strings.TrimSuffix(zone.Name, ".")
-	_, err := d.db.Exec(`
-		UPDATE zones SET name = ?, enabled = ?, ttl = ?, ns = ?, admin = ?, 
-		serial = serial + 1, refresh = ?, retry = ?, expire = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE id = ?
-	`, zone.Name, zone.Enabled, zone.TTL, zone.NS, zone.Admin, zone.Refresh, zone.Retry, zone.Expire, zone.ID)
-	return err
+	result, err := d.db.Exec(`
+		UPDATE zones SET name = ?, enabled = ?, ttl = ?, ns = ?, admin = ?,
+		refresh = ?, retry = ?, expire = ?, minimum = ?, ns_address = ?, type = ?, forwarders = ?, address_filter = ?, primaries = ?,
+		version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND (? = 0 OR version = ?)
+	`, zone.Name, zone.Enabled, zone.TTL, zone.NS, zone.Admin, zone.Refresh, zone.Retry, zone.Expire, zone.Minimum, zone.NSAddress,
+		zone.Type, zone.Forwarders, zone.AddressFilter, zone.Primaries, zone.ID, zone.Version, zone.Version)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errVersionConflict
+	}
+	_ = d.db.QueryRow(`SELECT version FROM zones WHERE id = ?`, zone.ID).Scan(&zone.Version)
+
+	d.bumpSerialLocked(zone.ID)
+	return nil
 }
 
-// DeleteZone deletes a zone and its records
+// bumpSerialLocked advances the serial of a zone after a change, following
+// serialFormat. The caller must hold d.mu.
+func (d *Database) bumpSerialLocked(zoneID int64) {
+	var serial int
+	if err := d.db.QueryRow(`SELECT serial FROM zones WHERE id = ?`, zoneID).Scan(&serial); err != nil {
+		return
+	}
+	_, _ = d.db.Exec(`UPDATE zones SET serial = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, nextSerial(serial), zoneID)
+}
+
+// DeleteZone deletes a zone and its records, moving them to the trash
 func (d *Database) DeleteZone(id int64) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	_, err := d.db.Exec(`DELETE FROM zones WHERE id = ?`, id)
-	return err
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := trashZoneTx(tx, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM zones WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // Record CRUD operations
 
+// errVersionConflict is returned when a zone or record changed since the
+// version the update was based on
+var errVersionConflict = errors.New("modified since it was read")
+
 // CreateRecord creates a new record
 func (d *Database) CreateRecord(record *DBRecord) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
+	activateAt, expireAt := record.columns()
 	result, err := d.db.Exec(`
-		INSERT INTO records (zone_id, name, type, value, ttl, priority)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, record.ZoneID, record.Name, strings.ToUpper(record.Type), record.Value, record.TTL, record.Priority)
+		INSERT INTO records (zone_id, name, type, value, ttl, priority, activate_at, expire_at, comment, tags, no_cache)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, record.ZoneID, record.Name, strings.ToUpper(record.Type), record.Value, record.TTL, record.Priority, activateAt, expireAt, record.Comment, record.tagsColumn(), record.NoCache)
 	if err != nil {
 		return err
 	}
 
 	record.ID, _ = result.LastInsertId()
+	record.Version = 1
+	if err := syncRRSetTTL(d.db, record.ZoneID, record.Name, record.Type, record.TTL); err != nil {
+		return err
+	}
 
 	// Update zone serial
-	_, _ = d.db.Exec(`UPDATE zones SET serial = serial + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, record.ZoneID)
+	d.bumpSerialLocked(record.ZoneID)
 
 	return nil
 }
@@ -331,13 +945,16 @@ func (d *Database) GetRecord(id int64) (*DBRecord, error) {
 	defer d.mu.RUnlock()
 
 	record := &DBRecord{}
+	var activateAt, expireAt, tags string
 	err := d.db.QueryRow(`
-		SELECT id, zone_id, name, type, value, ttl, priority
+		SELECT id, zone_id, name, type, value, ttl, priority, version, activate_at, expire_at, comment, tags, no_cache
 		FROM records WHERE id = ?
-	`, id).Scan(&record.ID, &record.ZoneID, &record.Name, &record.Type, &record.Value, &record.TTL, &record.Priority)
+	`, id).Scan(&record.ID, &record.ZoneID, &record.Name, &record.Type, &record.Value, &record.TTL, &record.Priority, &record.Version, &activateAt, &expireAt, &record.Comment, &tags, &record.NoCache)
 	if err != nil {
 		return nil, err
 	}
+	record.RecordSchedule = parseRecordSchedule(activateAt, expireAt)
+	record.Tags = parseRecordTags(tags)
 	return record, nil
 }
 
@@ -347,7 +964,7 @@ func (d *Database) ListRecordsByZone(zoneID int64) ([]DBRecord, error) {
 	defer d.mu.RUnlock()
 
 	rows, err := d.db.Query(`
-		SELECT id, zone_id, name, type, value, ttl, priority
+		SELECT id, zone_id, name, type, value, ttl, priority, version, activate_at, expire_at, comment, tags, no_cache
 		FROM records WHERE zone_id = ? ORDER BY type, name
 	`, zoneID)
 	if err != nil {
@@ -358,225 +975,2082 @@ func (d *Database) ListRecordsByZone(zoneID int64) ([]DBRecord, error) {
 	var records []DBRecord
 	for rows.Next() {
 		var r DBRecord
-		if err := rows.Scan(&r.ID, &r.ZoneID, &r.Name, &r.Type, &r.Value, &r.TTL, &r.Priority); err != nil {
+		var activateAt, expireAt, tags string
+		if err := rows.Scan(&r.ID, &r.ZoneID, &r.Name, &r.Type, &r.Value, &r.TTL, &r.Priority, &r.Version, &activateAt, &expireAt, &r.Comment, &tags, &r.NoCache); err != nil {
 			return nil, err
 		}
+		r.RecordSchedule = parseRecordSchedule(activateAt, expireAt)
+		r.Tags = parseRecordTags(tags)
 		records = append(records, r)
 	}
 	return records, nil
 }
 
-// UpdateRecord updates a record
+// ListRecordsPage returns the records of a zone matching q, and the
+// number of records matching the filters
+func (d *Database) ListRecordsPage(zoneID int64, q ListQuery) ([]DBRecord, int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	where := ` WHERE zone_id = ?`
+	args := []any{zoneID}
+	if q.Name != "" {
+		where += ` AND name LIKE ? ESCAPE '\'`
+		args = append(args, likePattern(q.Name))
+	}
+	if q.Type != "" {
+		where += ` AND type = ?`
+		args = append(args, q.Type)
+	}
+	if q.Search != "" {
+		where += ` AND (name LIKE ? ESCAPE '\' OR value LIKE ? ESCAPE '\' OR comment LIKE ? ESCAPE '\' OR tags LIKE ? ESCAPE '\')`
+		pattern := likePattern(q.Search)
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+
+	var total int
+	if err := d.db.QueryRow(`SELECT COUNT(*) FROM records`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	order, pageArgs := q.orderBy("id")
+	rows, err := d.db.Query(`
+		SELECT id, zone_id, name, type, value, ttl, priority, version, activate_at, expire_at, comment, tags, no_cache
+		FROM records`+where+order, append(args, pageArgs...)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	records := []DBRecord{}
+	for rows.Next() {
+		var r DBRecord
+		var activateAt, expireAt, tags string
+		if err := rows.Scan(&r.ID, &r.ZoneID, &r.Name, &r.Type, &r.Value, &r.TTL, &r.Priority, &r.Version, &activateAt, &expireAt, &r.Comment, &tags, &r.NoCache); err != nil {
+			return nil, 0, err
+		}
+		r.RecordSchedule = parseRecordSchedule(activateAt, expireAt)
+		r.Tags = parseRecordTags(tags)
+		records = append(records, r)
+	}
+	return records, total, rows.Err()
+}
+
+// UpdateRecord updates a record. A non-zero Version is the version the
+// record must still have, errVersionConflict otherwise; it is set to the
+// new one.
 func (d *Database) UpdateRecord(record *DBRecord) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	_, err := d.db.Exec(`
-		UPDATE records SET name = ?, type = ?, value = ?, ttl = ?, priority = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE id = ?
-	`, record.Name, strings.ToUpper(record.Type), record.Value, record.TTL, record.Priority, record.ID)
+	activateAt, expireAt := record.columns()
+	result, err := d.db.Exec(`
+		UPDATE records SET name = ?, type = ?, value = ?, ttl = ?, priority = ?, activate_at = ?, expire_at = ?, comment = ?, tags = ?, no_cache = ?,
+		version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND (? = 0 OR version = ?)
+	`, record.Name, strings.ToUpper(record.Type), record.Value, record.TTL, record.Priority, activateAt, expireAt, record.Comment, record.tagsColumn(), record.NoCache,
+		record.ID, record.Version, record.Version)
 	if err != nil {
 		return err
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errVersionConflict
+	}
+	_ = d.db.QueryRow(`SELECT version FROM records WHERE id = ?`, record.ID).Scan(&record.Version)
+	if err := syncRRSetTTL(d.db, record.ZoneID, record.Name, record.Type, record.TTL); err != nil {
+		return err
+	}
 
 	// Update zone serial
-	_, _ = d.db.Exec(`UPDATE zones SET serial = serial + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, record.ZoneID)
+	d.bumpSerialLocked(record.ZoneID)
 
 	return err
 }
 
-// DeleteRecord deletes a record
-func (d *Database) DeleteRecord(id int64) error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-
-	// Get zone_id first for serial update
-	var zoneID int64
-	_ = d.db.QueryRow(`SELECT zone_id FROM records WHERE id = ?`, id).Scan(&zoneID)
+// sqlQuerier is a database or a transaction
+type sqlQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
 
-	_, err := d.db.Exec(`DELETE FROM records WHERE id = ?`, id)
+// syncRRSetTTL gives the other records of the RRset (owner name and type)
+// of a record just written its TTL: the records of an RRset share one TTL
+// (RFC 2181 section 5.2), the last one written wins
+func syncRRSetTTL(q sqlQuerier, zoneID int64, name, rrType string, ttl int) error {
+	var zoneName string
+	if err := q.QueryRow(`SELECT name FROM zones WHERE id = ?`, zoneID).Scan(&zoneName); err != nil {
+		return err
+	}
+	rows, err := q.Query(`SELECT id, name FROM records WHERE zone_id = ? AND type = ? AND ttl != ?`, zoneID, strings.ToUpper(rrType), ttl)
 	if err != nil {
 		return err
 	}
-
-	// Update zone serial
-	if zoneID > 0 {
-		_, _ = d.db.Exec(`UPDATE zones SET serial = serial + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, zoneID)
+	owner := strings.ToLower(recordOwner(name, zoneName))
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var other string
+		if err := rows.Scan(&id, &other); err != nil {
+			rows.Close()
+			return err
+		}
+		if strings.ToLower(recordOwner(other, zoneName)) == owner {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	for _, id := range ids {
+		if _, err := q.Exec(`UPDATE records SET ttl = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, ttl, id); err != nil {
+			return err
+		}
 	}
-
 	return nil
 }
 
-// Forwarder CRUD operations
-
+// unifyRRSetTTLs gives the records of each RRset the lowest of their TTLs,
+// for databases written before RRsets had a single TTL. The TTLs change in
+// one transaction, so a failure leaves no RRset half updated.
+func (d *Database) unifyRRSetTTLs() error {
+	rows, err := d.db.Query(`SELECT r.id, r.name, r.type, r.ttl, r.zone_id, z.name FROM records r JOIN zones z ON z.id = r.zone_id`)
+	if err != nil {
+		return err
+	}
+	type member struct {
+		id  int64
+		ttl int
+	}
+	sets := make(map[string][]member)
+	for rows.Next() {
+		var m member
+		var name, rrType, zoneName string
+		var zoneID int64
+		if err := rows.Scan(&m.id, &name, &rrType, &m.ttl, &zoneID, &zoneName); err != nil {
+			rows.Close()
+			return err
+		}
+		key := fmt.Sprintf("%d %s %s", zoneID, strings.ToLower(recordOwner(name, zoneName)), strings.ToUpper(rrType))
+		sets[key] = append(sets[key], m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, members := range sets {
+		lowest := members[0].ttl
+		for _, m := range members[1:] {
+			lowest = min(lowest, m.ttl)
+		}
+		for _, m := range members {
+			if m.ttl == lowest {
+				continue
+			}
+			if _, err := tx.Exec(`UPDATE records SET ttl = ? WHERE id = ?`, lowest, m.id); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteRecord deletes a record
+func (d *Database) DeleteRecord(id int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Get zone_id first for serial update
+	var zoneID int64
+	_ = d.db.QueryRow(`SELECT zone_id FROM records WHERE id = ?`, id).Scan(&zoneID)
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := trashRecordTx(tx, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM records WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Update zone serial
+	if zoneID > 0 {
+		d.bumpSerialLocked(zoneID)
+	}
+
+	return nil
+}
+
+// SearchRecords returns the records of all zones matching every word, in
+// their zone, name, value, comment or tags, and carrying every tag
+func (d *Database) SearchRecords(words, tags []string, limit int) ([]RecordSearchResult, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	query := `
+		SELECT r.id, r.zone_id, r.name, r.type, r.value, r.ttl, r.priority, r.version, r.activate_at, r.expire_at, r.comment, r.tags, r.no_cache, z.name
+		FROM records r JOIN zones z ON z.id = r.zone_id WHERE 1 = 1`
+	var args []any
+	for _, word := range words {
+		query += ` AND (z.name LIKE ? ESCAPE '\' OR r.name LIKE ? ESCAPE '\' OR r.value LIKE ? ESCAPE '\' OR r.comment LIKE ? ESCAPE '\' OR r.tags LIKE ? ESCAPE '\')`
+		pattern := likePattern(word)
+		args = append(args, pattern, pattern, pattern, pattern, pattern)
+	}
+	for _, tag := range tags {
+		query += ` AND (',' || r.tags || ',') LIKE ? ESCAPE '\'`
+		args = append(args, likePattern(","+tag+","))
+	}
+	query += ` ORDER BY z.name, r.type, r.name LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	results := []RecordSearchResult{}
+	for rows.Next() {
+		var r RecordSearchResult
+		var activateAt, expireAt, tags string
+		if err := rows.Scan(&r.ID, &r.ZoneID, &r.Name, &r.Type, &r.Value, &r.TTL, &r.Priority, &r.Version, &activateAt, &expireAt, &r.Comment, &tags, &r.NoCache, &r.Zone); err != nil {
+			return nil, err
+		}
+		r.RecordSchedule = parseRecordSchedule(activateAt, expireAt)
+		r.Tags = parseRecordTags(tags)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// zoneIDsLocked returns the distinct zone ids of a query on records
+func (d *Database) zoneIDsLocked(query string, args ...any) ([]int64, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ActivateScheduledRecords bumps the serial of the zones having records
+// activated after since and up to now, and returns those zones
+func (d *Database) ActivateScheduledRecords(since, now time.Time) ([]int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ids, err := d.zoneIDsLocked(`
+		SELECT DISTINCT zone_id FROM records WHERE activate_at > ? AND activate_at <= ?
+	`, formatRecordTime(&since), formatRecordTime(&now))
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		d.bumpSerialLocked(id)
+	}
+	return ids, nil
+}
+
+// ScheduledRecordZones returns the zones having records activated or
+// expired after since and up to now, without changing them
+func (d *Database) ScheduledRecordZones(since, now time.Time) ([]int64, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	from, to := formatRecordTime(&since), formatRecordTime(&now)
+	return d.zoneIDsLocked(`
+		SELECT DISTINCT zone_id FROM records
+		WHERE (activate_at > ? AND activate_at <= ?) OR (expire_at > ? AND expire_at <= ?)
+	`, from, to, from, to)
+}
+
+// PruneExpiredRecords deletes the records expired at now, bumps the serial
+// of their zones and returns those zones
+func (d *Database) PruneExpiredRecords(now time.Time) ([]int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cutoff := formatRecordTime(&now)
+	ids, err := d.zoneIDsLocked(`
+		SELECT DISTINCT zone_id FROM records WHERE expire_at != '' AND expire_at <= ?
+	`, cutoff)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	if _, err := d.db.Exec(`DELETE FROM records WHERE expire_at != '' AND expire_at <= ?`, cutoff); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		d.bumpSerialLocked(id)
+	}
+	return ids, nil
+}
+
+// Trash
+
+// errTrashConflict is returned when a deleted zone or record cannot be put
+// back as it was
+var errTrashConflict = errors.New("cannot be restored")
+
+// scanRecordRows reads records selected with the columns of GetRecord
+func scanRecordRows(rows *sql.Rows) ([]DBRecord, error) {
+	defer func() { _ = rows.Close() }()
+	var records []DBRecord
+	for rows.Next() {
+		var r DBRecord
+		var activateAt, expireAt, tags string
+		if err := rows.Scan(&r.ID, &r.ZoneID, &r.Name, &r.Type, &r.Value, &r.TTL, &r.Priority, &r.Version, &activateAt, &expireAt, &r.Comment, &tags, &r.NoCache); err != nil {
+			return nil, err
+		}
+		r.RecordSchedule = parseRecordSchedule(activateAt, expireAt)
+		r.Tags = parseRecordTags(tags)
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// trashRecordTx copies a record about to be deleted to the trash; a record
+// that does not exist is left to the caller
+func trashRecordTx(q sqlQuerier, id int64) error {
+	if trashRetention <= 0 {
+		return nil
+	}
+	var zoneName string
+	rows, err := q.Query(`
+		SELECT id, zone_id, name, type, value, ttl, priority, version, activate_at, expire_at, comment, tags, no_cache
+		FROM records WHERE id = ?
+	`, id)
+	if err != nil {
+		return err
+	}
+	records, err := scanRecordRows(rows)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	r := records[0]
+	if err := q.QueryRow(`SELECT name FROM zones WHERE id = ?`, r.ZoneID).Scan(&zoneName); err != nil {
+		return err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = q.Exec(`
+		INSERT INTO trash (kind, zone_id, zone_name, name, type, value, data, deleted_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, trashRecord, r.ZoneID, zoneName, r.Name, r.Type, r.Value, string(data), formatRecordTime(&now))
+	return err
+}
+
+// trashZoneTx copies a zone about to be deleted to the trash, with its
+// records, signed material and secondaries
+func trashZoneTx(q sqlQuerier, id int64) error {
+	if trashRetention <= 0 {
+		return nil
+	}
+	var t trashedZone
+	z := &t.Zone
+	err := q.QueryRow(`
+		SELECT id, name, enabled, ttl, ns, admin, serial, refresh, retry, expire, minimum, ns_address, type, forwarders, address_filter, primaries, version
+		FROM zones WHERE id = ?
+	`, id).Scan(&z.ID, &z.Name, &z.Enabled, &z.TTL, &z.NS, &z.Admin,
+		&z.Serial, &z.Refresh, &z.Retry, &z.Expire, &z.Minimum, &z.NSAddress, &z.Type, &z.Forwarders, &z.AddressFilter, &z.Primaries, &z.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := q.Query(`
+		SELECT id, zone_id, name, type, value, ttl, priority, version, activate_at, expire_at, comment, tags, no_cache
+		FROM records WHERE zone_id = ? ORDER BY id
+	`, id)
+	if err != nil {
+		return err
+	}
+	if t.Records, err = scanRecordRows(rows); err != nil {
+		return err
+	}
+
+	signed, err := q.Query(`SELECT id, zone_id, name, type, value, ttl FROM signed_records WHERE zone_id = ? ORDER BY id`, id)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = signed.Close() }()
+	for signed.Next() {
+		var r DBSignedRecord
+		if err := signed.Scan(&r.ID, &r.ZoneID, &r.Name, &r.Type, &r.Value, &r.TTL); err != nil {
+			return err
+		}
+		t.Signed = append(t.Signed, r)
+	}
+	if err := signed.Err(); err != nil {
+		return err
+	}
+
+	secondaries, err := q.Query(`SELECT id, zone_id, address, tsig_key, tsig_algorithm, tsig_secret FROM zone_secondaries WHERE zone_id = ? ORDER BY id`, id)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = secondaries.Close() }()
+	for secondaries.Next() {
+		var s DBZoneSecondary
+		if err := secondaries.Scan(&s.ID, &s.ZoneID, &s.Address, &s.TSIGKey, &s.TSIGAlgorithm, &s.TSIGSecret); err != nil {
+			return err
+		}
+		t.Secondaries = append(t.Secondaries, s)
+	}
+	if err := secondaries.Err(); err != nil {
+		return err
+	}
+
+	notes, err := zoneNotesTx(q, id)
+	if err != nil {
+		return err
+	}
+	if notes != nil {
+		t.Notes = &notes.ZoneNotes
+	}
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = q.Exec(`
+		INSERT INTO trash (kind, zone_id, zone_name, records, data, deleted_at) VALUES (?, ?, ?, ?, ?, ?)
+	`, trashZone, z.ID, z.Name, len(t.Records), string(data), formatRecordTime(&now))
+	return err
+}
+
+// ListTrash returns the deleted zones and records, the last deleted first
+func (d *Database) ListTrash() ([]DBTrashItem, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	rows, err := d.db.Query(`
+		SELECT id, kind, zone_id, zone_name, name, type, value, records, deleted_at FROM trash ORDER BY id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	items := []DBTrashItem{}
+	for rows.Next() {
+		var item DBTrashItem
+		var deletedAt string
+		if err := rows.Scan(&item.ID, &item.Kind, &item.ZoneID, &item.ZoneName, &item.Name, &item.Type, &item.Value, &item.Records, &deletedAt); err != nil {
+			return nil, err
+		}
+		item.DeletedAt, _ = time.Parse(time.RFC3339, deletedAt)
+		item.ExpiresAt = item.DeletedAt.Add(trashRetention)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// RestoreTrashItem puts a deleted zone or record back and removes it from
+// the trash. A zone keeps its id when it is free, so the records deleted
+// from it before can be restored after it; its serial is bumped so the
+// secondaries transfer it again.
+func (d *Database) RestoreTrashItem(id int64) (*DBTrashItem, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var item DBTrashItem
+	var data, deletedAt string
+	if err := tx.QueryRow(`
+		SELECT id, kind, zone_id, zone_name, name, type, value, records, data, deleted_at FROM trash WHERE id = ?
+	`, id).Scan(&item.ID, &item.Kind, &item.ZoneID, &item.ZoneName, &item.Name, &item.Type, &item.Value, &item.Records, &data, &deletedAt); err != nil {
+		return nil, err
+	}
+	item.DeletedAt, _ = time.Parse(time.RFC3339, deletedAt)
+	item.ExpiresAt = item.DeletedAt.Add(trashRetention)
+
+	switch item.Kind {
+	case trashRecord:
+		var r DBRecord
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return nil, err
+		}
+		var zones int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM zones WHERE id = ?`, r.ZoneID).Scan(&zones); err != nil {
+			return nil, err
+		}
+		if zones == 0 {
+			return nil, fmt.Errorf("%w: zone %s is deleted, restore it first", errTrashConflict, item.ZoneName)
+		}
+		if _, err := applyChangesTx(tx, r.ZoneID, []DBChange{{Action: "create", Name: r.Name, Type: r.Type, Value: r.Value, TTL: r.TTL, Priority: r.Priority,
+			RecordSchedule: r.RecordSchedule, RecordNotes: r.RecordNotes, RecordCaching: r.RecordCaching}}); err != nil {
+			return nil, err
+		}
+	case trashZone:
+		var t trashedZone
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			return nil, err
+		}
+		z := t.Zone
+		var taken, idTaken int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM zones WHERE name = ?`, z.Name).Scan(&taken); err != nil {
+			return nil, err
+		}
+		if taken > 0 {
+			return nil, fmt.Errorf("%w: a zone named %s exists", errTrashConflict, z.Name)
+		}
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM zones WHERE id = ?`, z.ID).Scan(&idTaken); err != nil {
+			return nil, err
+		}
+		zoneID := sql.NullInt64{Int64: z.ID, Valid: idTaken == 0}
+		result, err := tx.Exec(`
+			INSERT INTO zones (id, name, enabled, ttl, ns, admin, serial, refresh, retry, expire, minimum, ns_address, type, forwarders, address_filter, primaries)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, zoneID, z.Name, z.Enabled, z.TTL, z.NS, z.Admin, nextSerial(z.Serial), z.Refresh, z.Retry, z.Expire, z.Minimum, z.NSAddress, z.Type, z.Forwarders, z.AddressFilter, z.Primaries)
+		if err != nil {
+			return nil, err
+		}
+		item.ZoneID, _ = result.LastInsertId()
+		for _, r := range t.Records {
+			activateAt, expireAt := r.columns()
+			if _, err := tx.Exec(`
+				INSERT INTO records (zone_id, name, type, value, ttl, priority, activate_at, expire_at, comment, tags, no_cache) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, item.ZoneID, r.Name, r.Type, r.Value, r.TTL, r.Priority, activateAt, expireAt, r.Comment, r.tagsColumn(), r.NoCache); err != nil {
+				return nil, err
+			}
+		}
+		for _, r := range t.Signed {
+			if _, err := tx.Exec(`
+				INSERT INTO signed_records (zone_id, name, type, value, ttl) VALUES (?, ?, ?, ?, ?)
+			`, item.ZoneID, r.Name, r.Type, r.Value, r.TTL); err != nil {
+				return nil, err
+			}
+		}
+		for _, s := range t.Secondaries {
+			if _, err := tx.Exec(`
+				INSERT INTO zone_secondaries (zone_id, address, tsig_key, tsig_algorithm, tsig_secret) VALUES (?, ?, ?, ?, ?)
+			`, item.ZoneID, s.Address, s.TSIGKey, s.TSIGAlgorithm, s.TSIGSecret); err != nil {
+				return nil, err
+			}
+		}
+		if t.Notes != nil {
+			if _, err := tx.Exec(`
+				INSERT INTO zone_notes (zone_id, owner, contact, description, review_at) VALUES (?, ?, ?, ?, ?)
+			`, item.ZoneID, t.Notes.Owner, t.Notes.Contact, t.Notes.Description, formatRecordTime(t.Notes.ReviewAt)); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown trash item kind %q", item.Kind)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM trash WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return &item, tx.Commit()
+}
+
+// DeleteTrashItem deletes a zone or record from the trash for good
+func (d *Database) DeleteTrashItem(id int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result, err := d.db.Exec(`DELETE FROM trash WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PruneTrash deletes for good what was deleted before cutoff
+func (d *Database) PruneTrash(cutoff time.Time) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result, err := d.db.Exec(`DELETE FROM trash WHERE deleted_at < ?`, formatRecordTime(&cutoff))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Signed zone material
+
+// ReplaceSignedRecords replaces the imported DNSSEC material of a zone in one
+// transaction. When records is not nil, the zone's regular records are
+// replaced too.
+func (d *Database) ReplaceSignedRecords(zoneID int64, signed []DBSignedRecord, records []DBRecord) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(`DELETE FROM signed_records WHERE zone_id = ?`, zoneID); err != nil {
+		return err
+	}
+	for _, r := range signed {
+		if _, err := tx.Exec(`
+			INSERT INTO signed_records (zone_id, name, type, value, ttl) VALUES (?, ?, ?, ?, ?)
+		`, zoneID, r.Name, r.Type, r.Value, r.TTL); err != nil {
+			return err
+		}
+	}
+
+	if records != nil {
+		if _, err := tx.Exec(`DELETE FROM records WHERE zone_id = ?`, zoneID); err != nil {
+			return err
+		}
+		for _, r := range records {
+			if _, err := tx.Exec(`
+				INSERT INTO records (zone_id, name, type, value, ttl, priority) VALUES (?, ?, ?, ?, ?, ?)
+			`, zoneID, r.Name, r.Type, r.Value, r.TTL, r.Priority); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListSignedRecords returns the imported DNSSEC material of a zone
+func (d *Database) ListSignedRecords(zoneID int64) ([]DBSignedRecord, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	rows, err := d.db.Query(`
+		SELECT id, zone_id, name, type, value, ttl FROM signed_records WHERE zone_id = ? ORDER BY id
+	`, zoneID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var records []DBSignedRecord
+	for rows.Next() {
+		var r DBSignedRecord
+		if err := rows.Scan(&r.ID, &r.ZoneID, &r.Name, &r.Type, &r.Value, &r.TTL); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// DeleteSignedRecords removes the imported DNSSEC material of a zone
+func (d *Database) DeleteSignedRecords(zoneID int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, err := d.db.Exec(`DELETE FROM signed_records WHERE zone_id = ?`, zoneID)
+	return err
+}
+
+// Zone secondaries
+
+// CreateZoneSecondary adds a secondary server to a zone
+func (d *Database) CreateZoneSecondary(s *DBZoneSecondary) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result, err := d.db.Exec(`
+		INSERT INTO zone_secondaries (zone_id, address, tsig_key, tsig_algorithm, tsig_secret) VALUES (?, ?, ?, ?, ?)
+	`, s.ZoneID, s.Address, s.TSIGKey, s.TSIGAlgorithm, s.TSIGSecret)
+	if err != nil {
+		return err
+	}
+	s.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// ListZoneSecondaries returns the secondary servers of a zone, or of every
+// zone when zoneID is 0
+func (d *Database) ListZoneSecondaries(zoneID int64) ([]DBZoneSecondary, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	rows, err := d.db.Query(`
+		SELECT id, zone_id, address, tsig_key, tsig_algorithm, tsig_secret FROM zone_secondaries
+		WHERE ? = 0 OR zone_id = ? ORDER BY zone_id, id
+	`, zoneID, zoneID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var secondaries []DBZoneSecondary
+	for rows.Next() {
+		var s DBZoneSecondary
+		if err := rows.Scan(&s.ID, &s.ZoneID, &s.Address, &s.TSIGKey, &s.TSIGAlgorithm, &s.TSIGSecret); err != nil {
+			return nil, err
+		}
+		secondaries = append(secondaries, s)
+	}
+	return secondaries, rows.Err()
+}
+
+// DeleteZoneSecondary removes a secondary server from a zone
+func (d *Database) DeleteZoneSecondary(zoneID, id int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result, err := d.db.Exec(`DELETE FROM zone_secondaries WHERE id = ? AND zone_id = ?`, id, zoneID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Zone notes
+
+// zoneNotesTx returns the notes of a zone, nil when it has none
+func zoneNotesTx(q sqlQuerier, zoneID int64) (*DBZoneNotes, error) {
+	var n DBZoneNotes
+	var reviewAt, remindedAt string
+	err := q.QueryRow(`
+		SELECT n.zone_id, z.name, n.owner, n.contact, n.description, n.review_at, n.reminder, n.reminded_at
+		FROM zone_notes n JOIN zones z ON z.id = n.zone_id WHERE n.zone_id = ?
+	`, zoneID).Scan(&n.ZoneID, &n.ZoneName, &n.Owner, &n.Contact, &n.Description, &reviewAt, &n.Reminder, &remindedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	n.ReviewAt, n.RemindedAt = parseRecordTime(reviewAt), parseRecordTime(remindedAt)
+	return &n, nil
+}
+
+// GetZoneNotes returns the notes of a zone, empty ones when it has none
+func (d *Database) GetZoneNotes(zoneID int64) (*DBZoneNotes, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	n, err := zoneNotesTx(d.db, zoneID)
+	if err != nil || n != nil {
+		return n, err
+	}
+	n = &DBZoneNotes{ZoneID: zoneID}
+	err = d.db.QueryRow(`SELECT name FROM zones WHERE id = ?`, zoneID).Scan(&n.ZoneName)
+	return n, err
+}
+
+// ListZoneNotes returns the notes of every zone that has some, by zone name
+func (d *Database) ListZoneNotes() ([]DBZoneNotes, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	rows, err := d.db.Query(`
+		SELECT n.zone_id, z.name, n.owner, n.contact, n.description, n.review_at, n.reminder, n.reminded_at
+		FROM zone_notes n JOIN zones z ON z.id = n.zone_id ORDER BY z.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	notes := []DBZoneNotes{}
+	for rows.Next() {
+		var n DBZoneNotes
+		var reviewAt, remindedAt string
+		if err := rows.Scan(&n.ZoneID, &n.ZoneName, &n.Owner, &n.Contact, &n.Description, &reviewAt, &n.Reminder, &remindedAt); err != nil {
+			return nil, err
+		}
+		n.ReviewAt, n.RemindedAt = parseRecordTime(reviewAt), parseRecordTime(remindedAt)
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// SetZoneNotes replaces the notes of a zone, deleting them when they are
+// empty. A new review date resets the reminders. The serial is left
+// alone: the notes are not part of the zone.
+func (d *Database) SetZoneNotes(zoneID int64, notes ZoneNotes) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if notes.empty() {
+		_, err := d.db.Exec(`DELETE FROM zone_notes WHERE zone_id = ?`, zoneID)
+		return err
+	}
+	_, err := d.db.Exec(`
+		INSERT INTO zone_notes (zone_id, owner, contact, description, review_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (zone_id) DO UPDATE SET owner = excluded.owner, contact = excluded.contact,
+			description = excluded.description, review_at = excluded.review_at,
+			reminder = CASE WHEN review_at = excluded.review_at THEN reminder ELSE '' END,
+			reminded_at = CASE WHEN review_at = excluded.review_at THEN reminded_at ELSE '' END,
+			updated_at = CURRENT_TIMESTAMP
+	`, zoneID, notes.Owner, notes.Contact, notes.Description, formatRecordTime(notes.ReviewAt))
+	return err
+}
+
+// SetZoneReminder records the reminder sent about the review of a zone
+func (d *Database) SetZoneReminder(zoneID int64, reminder string, at time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, err := d.db.Exec(`UPDATE zone_notes SET reminder = ?, reminded_at = ? WHERE zone_id = ?`, reminder, formatRecordTime(&at), zoneID)
+	return err
+}
+
+// Secondary zones
+
+// GetSecondaryZone returns the transferred copy of a secondary zone,
+// sql.ErrNoRows before the first transfer
+func (d *Database) GetSecondaryZone(zoneID int64) (*DBSecondaryZone, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var z DBSecondaryZone
+	var transferredAt, checkedAt string
+	err := d.db.QueryRow(`
+		SELECT zone_id, serial, records, transferred_at, checked_at, error FROM secondary_zones WHERE zone_id = ?
+	`, zoneID).Scan(&z.ZoneID, &z.Serial, &z.Records, &transferredAt, &checkedAt, &z.Error)
+	if err != nil {
+		return nil, err
+	}
+	z.TransferredAt, _ = time.Parse(time.RFC3339, transferredAt)
+	z.CheckedAt, _ = time.Parse(time.RFC3339, checkedAt)
+	return &z, nil
+}
+
+// SaveSecondaryZone stores the transferred copy of a secondary zone
+func (d *Database) SaveSecondaryZone(z *DBSecondaryZone) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, err := d.db.Exec(`
+		INSERT INTO secondary_zones (zone_id, serial, records, transferred_at, checked_at, error) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(zone_id) DO UPDATE SET serial = excluded.serial, records = excluded.records,
+		transferred_at = excluded.transferred_at, checked_at = excluded.checked_at, error = excluded.error
+	`, z.ZoneID, z.Serial, z.Records, z.TransferredAt.UTC().Format(time.RFC3339), z.CheckedAt.UTC().Format(time.RFC3339), z.Error)
+	return err
+}
+
+// Forwarder CRUD operations
+
 // CreateForwarder creates a new forwarder
 func (d *Database) CreateForwarder(forwarder *DBForwarder) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	// Add default port if missing
-	addr := forwarder.Address
-	if !strings.Contains(addr, ":") {
-		addr = addr + ":53"
+	// Add default port if missing
+	addr := forwarder.Address
+	if !strings.Contains(addr, ":") {
+		addr = addr + ":53"
+	}
+
+	result, err := d.db.Exec(`
+		INSERT INTO forwarders (address, priority, timeout_ms, retries, backoff_ms, weight)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, addr, forwarder.Priority, forwarder.TimeoutMS, forwarder.Retries, forwarder.BackoffMS, forwarder.Weight)
+	if err != nil {
+		return err
+	}
+
+	forwarder.ID, _ = result.LastInsertId()
+	forwarder.Address = addr
+	return nil
+}
+
+// ListForwarders returns all forwarders
+func (d *Database) ListForwarders() ([]DBForwarder, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	rows, err := d.db.Query(`
+		SELECT id, address, priority, timeout_ms, retries, backoff_ms, weight
+		FROM forwarders ORDER BY priority, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var forwarders []DBForwarder
+	for rows.Next() {
+		var f DBForwarder
+		if err := rows.Scan(&f.ID, &f.Address, &f.Priority, &f.TimeoutMS, &f.Retries, &f.BackoffMS, &f.Weight); err != nil {
+			return nil, err
+		}
+		forwarders = append(forwarders, f)
+	}
+	return forwarders, nil
+}
+
+// UpdateForwarder updates the priority and options of a forwarder
+func (d *Database) UpdateForwarder(forwarder *DBForwarder) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result, err := d.db.Exec(`
+		UPDATE forwarders SET priority = ?, timeout_ms = ?, retries = ?, backoff_ms = ?, weight = ? WHERE id = ?
+	`, forwarder.Priority, forwarder.TimeoutMS, forwarder.Retries, forwarder.BackoffMS, forwarder.Weight, forwarder.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ReorderForwarders gives the forwarders ids the priorities 0, 1, 2... in
+// order. It returns sql.ErrNoRows if an id does not exist.
+func (d *Database) ReorderForwarders(ids []int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	for i, id := range ids {
+		result, err := tx.Exec(`UPDATE forwarders SET priority = ? WHERE id = ?`, i, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+	}
+	return tx.Commit()
+}
+
+// ReplaceForwarders replaces all the forwarders with list
+func (d *Database) ReplaceForwarders(list []DBForwarder) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.Exec(`DELETE FROM forwarders`); err != nil {
+		return err
+	}
+	for _, f := range list {
+		if _, err := tx.Exec(`
+			INSERT INTO forwarders (address, priority, timeout_ms, retries, backoff_ms, weight)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, f.Address, f.Priority, f.TimeoutMS, f.Retries, f.BackoffMS, f.Weight); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteForwarder deletes a forwarder by ID
+func (d *Database) DeleteForwarder(id int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, err := d.db.Exec(`DELETE FROM forwarders WHERE id = ?`, id)
+	return err
+}
+
+// DeleteForwarderByAddress deletes a forwarder by address
+func (d *Database) DeleteForwarderByAddress(address string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result, err := d.db.Exec(`DELETE FROM forwarders WHERE address = ?`, address)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("forwarder not found")
+	}
+	return nil
+}
+
+// Client operations
+
+// ListClients returns the clients with a label or a policy, by address
+func (d *Database) ListClients() ([]DBClient, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	rows, err := d.db.Query(`SELECT address, label, group_name, blocking, blocklists FROM clients ORDER BY address`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var clients []DBClient
+	for rows.Next() {
+		var c DBClient
+		var blocklists string
+		if err := rows.Scan(&c.Address, &c.Label, &c.Group, &c.Blocking, &blocklists); err != nil {
+			return nil, err
+		}
+		if blocklists != "" {
+			c.Blocklists = strings.Split(blocklists, "\n")
+		}
+		clients = append(clients, c)
+	}
+	return clients, rows.Err()
+}
+
+// SetClient saves the label and policy of a client, or forgets it when
+// they are all empty
+func (d *Database) SetClient(c DBClient) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if c.empty() {
+		_, err := d.db.Exec(`DELETE FROM clients WHERE address = ?`, c.Address)
+		return err
+	}
+	_, err := d.db.Exec(`
+		INSERT INTO clients (address, label, group_name, blocking, blocklists) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (address) DO UPDATE SET label = excluded.label, group_name = excluded.group_name,
+			blocking = excluded.blocking, blocklists = excluded.blocklists, updated_at = CURRENT_TIMESTAMP
+	`, c.Address, c.Label, c.Group, c.Blocking, strings.Join(c.Blocklists, "\n"))
+	return err
+}
+
+// Access schedule operations
+
+// ListAccessSchedules returns the access schedules, by id
+func (d *Database) ListAccessSchedules() ([]DBAccessSchedule, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	rows, err := d.db.Query(`SELECT id, name, group_name, days, start_time, end_time, blocklists, pause, enabled FROM access_schedules ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var schedules []DBAccessSchedule
+	for rows.Next() {
+		var s DBAccessSchedule
+		var days, blocklists string
+		if err := rows.Scan(&s.ID, &s.Name, &s.Group, &days, &s.From, &s.To, &blocklists, &s.Pause, &s.Enabled); err != nil {
+			return nil, err
+		}
+		if days != "" {
+			s.Days = strings.Split(days, ",")
+		}
+		if blocklists != "" {
+			s.Blocklists = strings.Split(blocklists, "\n")
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// CreateAccessSchedule saves a new access schedule and returns its id
+func (d *Database) CreateAccessSchedule(s AccessSchedule) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result, err := d.db.Exec(`
+		INSERT INTO access_schedules (name, group_name, days, start_time, end_time, blocklists, pause, enabled) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.Name, s.Group, strings.Join(s.Days, ","), s.From, s.To, strings.Join(s.Blocklists, "\n"), s.Pause, s.Enabled)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateAccessSchedule replaces an access schedule. It returns
+// sql.ErrNoRows if it does not exist.
+func (d *Database) UpdateAccessSchedule(id int64, s AccessSchedule) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result, err := d.db.Exec(`
+		UPDATE access_schedules SET name = ?, group_name = ?, days = ?, start_time = ?, end_time = ?, blocklists = ?, pause = ?, enabled = ? WHERE id = ?
+	`, s.Name, s.Group, strings.Join(s.Days, ","), s.From, s.To, strings.Join(s.Blocklists, "\n"), s.Pause, s.Enabled, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteAccessSchedule deletes an access schedule. It returns
+// sql.ErrNoRows if it does not exist.
+func (d *Database) DeleteAccessSchedule(id int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result, err := d.db.Exec(`DELETE FROM access_schedules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListClientPauses returns the end of the pauses by hand still running at
+// now, by client address, and forgets the ended ones
+func (d *Database) ListClientPauses(now time.Time) (map[string]time.Time, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cutoff := formatRecordTime(&now)
+	if _, err := d.db.Exec(`DELETE FROM client_pauses WHERE until <= ?`, cutoff); err != nil {
+		return nil, err
+	}
+	rows, err := d.db.Query(`SELECT address, until FROM client_pauses`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	pauses := make(map[string]time.Time)
+	for rows.Next() {
+		var address, until string
+		if err := rows.Scan(&address, &until); err != nil {
+			return nil, err
+		}
+		if t := parseRecordTime(until); t != nil {
+			pauses[address] = *t
+		}
+	}
+	return pauses, rows.Err()
+}
+
+// SetClientPause pauses a client until a time, or resumes it when until is
+// zero
+func (d *Database) SetClientPause(address string, until time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if until.IsZero() {
+		_, err := d.db.Exec(`DELETE FROM client_pauses WHERE address = ?`, address)
+		return err
+	}
+	_, err := d.db.Exec(`
+		INSERT INTO client_pauses (address, until) VALUES (?, ?)
+		ON CONFLICT (address) DO UPDATE SET until = excluded.until
+	`, address, formatRecordTime(&until))
+	return err
+}
+
+// Config operations
+
+// SetConfig sets a config value
+func (d *Database) SetConfig(key, value string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, err := d.db.Exec(`
+		INSERT INTO config (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = ?, updated_at = CURRENT_TIMESTAMP
+	`, key, value, value)
+	return err
+}
+
+// GetConfig gets a config value
+func (d *Database) GetConfig(key string) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var value string
+	err := d.db.QueryRow(`SELECT value FROM config WHERE key = ?`, key).Scan(&value)
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// Query statistics
+
+// statsColumns are the counter columns of stats_minutes and stats_hours
+const statsColumns = `total, local, forwarded, cached, rcode_noerror, rcode_formerr, rcode_servfail, rcode_nxdomain, rcode_notimp, rcode_refused, rcode_other`
+
+// SaveStatsMinutes stores the counters of some minutes, replacing those
+// already stored for the same minutes
+func (d *Database) SaveStatsMinutes(rows []DBStatsRow) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, r := range rows {
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO stats_minutes (time, `+statsColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.Time, r.Total, r.Local, r.Forwarded, r.Cached,
+			r.Rcodes[0], r.Rcodes[1], r.Rcodes[2], r.Rcodes[3], r.Rcodes[4], r.Rcodes[5], r.Rcodes[6]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RollupStats sums the minutes stored since the start of the hour of since
+// into hourly rows, replacing those of the same hours
+func (d *Database) RollupStats(since time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	from := since.Unix() / 3600 * 3600
+	_, err := d.db.Exec(`
+		INSERT OR REPLACE INTO stats_hours (time, `+statsColumns+`)
+		SELECT time / 3600 * 3600, SUM(total), SUM(local), SUM(forwarded), SUM(cached),
+			SUM(rcode_noerror), SUM(rcode_formerr), SUM(rcode_servfail), SUM(rcode_nxdomain),
+			SUM(rcode_notimp), SUM(rcode_refused), SUM(rcode_other)
+		FROM stats_minutes WHERE time >= ? GROUP BY time / 3600
+	`, from)
+	return err
+}
+
+// PruneStats deletes the minutes older than minutesBefore and the hours
+// older than hoursBefore, and returns how many rows were deleted
+func (d *Database) PruneStats(minutesBefore, hoursBefore time.Time) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var deleted int64
+	for _, prune := range []struct {
+		table  string
+		before time.Time
+	}{{"stats_minutes", minutesBefore}, {"stats_hours", hoursBefore}} {
+		result, err := d.db.Exec(`DELETE FROM `+prune.table+` WHERE time < ?`, prune.before.Unix())
+		if err != nil {
+			return deleted, err
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+	}
+	return deleted, nil
+}
+
+// ListStatsMinutes returns the minutes stored since since, oldest first
+func (d *Database) ListStatsMinutes(since time.Time) ([]DBStatsRow, error) {
+	return d.listStats("stats_minutes", since)
+}
+
+// ListStatsHours returns the hourly rollups since since, oldest first
+func (d *Database) ListStatsHours(since time.Time) ([]DBStatsRow, error) {
+	return d.listStats("stats_hours", since)
+}
+
+func (d *Database) listStats(table string, since time.Time) ([]DBStatsRow, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	rows, err := d.db.Query(`SELECT time, `+statsColumns+` FROM `+table+` WHERE time >= ? ORDER BY time`, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []DBStatsRow
+	for rows.Next() {
+		var r DBStatsRow
+		if err := rows.Scan(&r.Time, &r.Total, &r.Local, &r.Forwarded, &r.Cached,
+			&r.Rcodes[0], &r.Rcodes[1], &r.Rcodes[2], &r.Rcodes[3], &r.Rcodes[4], &r.Rcodes[5], &r.Rcodes[6]); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// Certificate operations
+
+// SaveCertificate stores a certificate, replacing any previous one with the same name
+func (d *Database) SaveCertificate(cert *DBCertificate) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, err := d.db.Exec(`
+		INSERT INTO certificates (name, cert_pem, key_pem, not_after) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET cert_pem = excluded.cert_pem, key_pem = excluded.key_pem,
+		not_after = excluded.not_after, updated_at = CURRENT_TIMESTAMP
+	`, cert.Name, cert.CertPEM, cert.KeyPEM, cert.NotAfter)
+	return err
+}
+
+// GetCertificate retrieves a certificate by name
+func (d *Database) GetCertificate(name string) (*DBCertificate, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	cert := &DBCertificate{}
+	err := d.db.QueryRow(`
+		SELECT name, cert_pem, key_pem, not_after FROM certificates WHERE name = ?
+	`, name).Scan(&cert.Name, &cert.CertPEM, &cert.KeyPEM, &cert.NotAfter)
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// AppendAuditEntry chains entry to the last one and appends it to the audit log
+func (d *Database) AppendAuditEntry(entry *DBAuditEntry) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var prev string
+	err := d.db.QueryRow(`SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1`).Scan(&prev)
+	if err != nil && err != sql.ErrNoRows {
+		return err
 	}
+	entry.PrevHash = prev
+	entry.Hash = auditHash(entry)
 
 	result, err := d.db.Exec(`
-		INSERT INTO forwarders (address, priority)
-		VALUES (?, ?)
-	`, addr, forwarder.Priority)
+		INSERT INTO audit_log (created_at, username, auth_type, client_ip, method, path, status, request_body, response_body, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.CreatedAt.UTC().Format(time.RFC3339Nano), entry.Username, entry.AuthType, entry.ClientIP,
+		entry.Method, entry.Path, entry.Status, entry.RequestBody, entry.ResponseBody, entry.PrevHash, entry.Hash)
 	if err != nil {
 		return err
 	}
+	entry.ID, _ = result.LastInsertId()
+	return nil
+}
 
-	forwarder.ID, _ = result.LastInsertId()
-	forwarder.Address = addr
+// ListAuditEntries returns audit entries with an id greater than afterID,
+// oldest first (limit <= 0 means no limit)
+func (d *Database) ListAuditEntries(afterID int64, limit int) ([]DBAuditEntry, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := d.db.Query(`
+		SELECT id, created_at, username, auth_type, client_ip, method, path, status, request_body, response_body, prev_hash, hash
+		FROM audit_log WHERE id > ? ORDER BY id LIMIT ?
+	`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var entries []DBAuditEntry
+	for rows.Next() {
+		var e DBAuditEntry
+		var createdAt string
+		if err := rows.Scan(&e.ID, &createdAt, &e.Username, &e.AuthType, &e.ClientIP, &e.Method, &e.Path,
+			&e.Status, &e.RequestBody, &e.ResponseBody, &e.PrevHash, &e.Hash); err != nil {
+			return nil, err
+		}
+		e.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Changesets
+
+// Changeset statuses
+const (
+	changesetPending   = "pending"
+	changesetApplied   = "applied"
+	changesetDiscarded = "discarded"
+)
+
+// errChangesetConflict is returned when a changeset can no longer be
+// applied as staged
+var errChangesetConflict = errors.New("changeset conflict")
+
+// CreateChangeset creates an empty pending changeset
+func (d *Database) CreateChangeset(cs *DBChangeset) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cs.Status = changesetPending
+	cs.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	result, err := d.db.Exec(`
+		INSERT INTO changesets (zone_id, status, created_by, created_at) VALUES (?, ?, ?, ?)
+	`, cs.ZoneID, cs.Status, cs.CreatedBy, cs.CreatedAt.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	cs.ID, _ = result.LastInsertId()
 	return nil
 }
 
-// ListForwarders returns all forwarders
-func (d *Database) ListForwarders() ([]DBForwarder, error) {
+// GetChangeset retrieves a changeset and its changes, in staging order
+func (d *Database) GetChangeset(id int64) (*DBChangeset, error) {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
+	cs := &DBChangeset{}
+	var createdAt string
+	err := d.db.QueryRow(`
+		SELECT id, zone_id, status, created_by, created_at FROM changesets WHERE id = ?
+	`, id).Scan(&cs.ID, &cs.ZoneID, &cs.Status, &cs.CreatedBy, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	cs.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+
 	rows, err := d.db.Query(`
-		SELECT id, address, priority
-		FROM forwarders ORDER BY priority, id
-	`)
+		SELECT id, changeset_id, action, record_id, name, type, value, ttl, priority, activate_at, expire_at, comment, tags, no_cache
+		FROM changeset_changes WHERE changeset_id = ? ORDER BY id
+	`, id)
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = rows.Close() }()
 
-	var forwarders []DBForwarder
+	cs.Changes = []DBChange{}
 	for rows.Next() {
-		var f DBForwarder
-		if err := rows.Scan(&f.ID, &f.Address, &f.Priority); err != nil {
+		var ch DBChange
+		var activateAt, expireAt, tags string
+		if err := rows.Scan(&ch.ID, &ch.ChangesetID, &ch.Action, &ch.RecordID, &ch.Name, &ch.Type, &ch.Value, &ch.TTL, &ch.Priority, &activateAt, &expireAt, &ch.Comment, &tags, &ch.NoCache); err != nil {
 			return nil, err
 		}
-		forwarders = append(forwarders, f)
+		ch.RecordSchedule = parseRecordSchedule(activateAt, expireAt)
+		ch.Tags = parseRecordTags(tags)
+		cs.Changes = append(cs.Changes, ch)
 	}
-	return forwarders, nil
+	return cs, rows.Err()
 }
 
-// DeleteForwarder deletes a forwarder by ID
-func (d *Database) DeleteForwarder(id int64) error {
+// ListPendingChangesets returns the pending changesets of a zone, or of
+// every zone when zoneID is 0, without their changes
+func (d *Database) ListPendingChangesets(zoneID int64) ([]DBChangeset, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	rows, err := d.db.Query(`
+		SELECT id, zone_id, status, created_by, created_at FROM changesets
+		WHERE status = ? AND (? = 0 OR zone_id = ?) ORDER BY id
+	`, changesetPending, zoneID, zoneID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	changesets := []DBChangeset{}
+	for rows.Next() {
+		var cs DBChangeset
+		var createdAt string
+		if err := rows.Scan(&cs.ID, &cs.ZoneID, &cs.Status, &cs.CreatedBy, &createdAt); err != nil {
+			return nil, err
+		}
+		cs.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		changesets = append(changesets, cs)
+	}
+	return changesets, rows.Err()
+}
+
+// AddChange stages a change in a pending changeset
+func (d *Database) AddChange(ch *DBChange) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	_, err := d.db.Exec(`DELETE FROM forwarders WHERE id = ?`, id)
-	return err
+	activateAt, expireAt := ch.columns()
+	result, err := d.db.Exec(`
+		INSERT INTO changeset_changes (changeset_id, action, record_id, name, type, value, ttl, priority, activate_at, expire_at, comment, tags, no_cache)
+		SELECT id, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? FROM changesets WHERE id = ? AND status = ?
+	`, ch.Action, ch.RecordID, ch.Name, strings.ToUpper(ch.Type), ch.Value, ch.TTL, ch.Priority, activateAt, expireAt, ch.Comment, ch.tagsColumn(), ch.NoCache, ch.ChangesetID, changesetPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errChangesetConflict
+	}
+	ch.ID, _ = result.LastInsertId()
+	return nil
 }
 
-// DeleteForwarderByAddress deletes a forwarder by address
-func (d *Database) DeleteForwarderByAddress(address string) error {
+// DeleteChange drops a staged change from a pending changeset
+func (d *Database) DeleteChange(changesetID, changeID int64) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	result, err := d.db.Exec(`DELETE FROM forwarders WHERE address = ?`, address)
+	result, err := d.db.Exec(`
+		DELETE FROM changeset_changes WHERE id = ? AND changeset_id IN (SELECT id FROM changesets WHERE id = ? AND status = ?)
+	`, changeID, changesetID, changesetPending)
 	if err != nil {
 		return err
 	}
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return fmt.Errorf("forwarder not found")
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
 	}
 	return nil
 }
 
-// Config operations
+// DiscardChangeset marks a pending changeset discarded
+func (d *Database) DiscardChangeset(id int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-// SetConfig sets a config value
-func (d *Database) SetConfig(key, value string) error {
+	result, err := d.db.Exec(`
+		UPDATE changesets SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?
+	`, changesetDiscarded, id, changesetPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errChangesetConflict
+	}
+	return nil
+}
+
+// ApplyChangeset applies the changes of a pending changeset in one
+// transaction and bumps the zone serial once. Nothing is applied when a
+// changed record no longer exists in the zone.
+func (d *Database) ApplyChangeset(cs *DBChangeset) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	_, err := d.db.Exec(`
-		INSERT INTO config (key, value) VALUES (?, ?)
-		ON CONFLICT(key) DO UPDATE SET value = ?, updated_at = CURRENT_TIMESTAMP
-	`, key, value, value)
-	return err
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.Exec(`
+		UPDATE changesets SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?
+	`, changesetApplied, cs.ID, changesetPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: changeset is not pending", errChangesetConflict)
+	}
+
+	if _, err := applyChangesTx(tx, cs.ZoneID, cs.Changes); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// GetConfig gets a config value
-func (d *Database) GetConfig(key string) (string, error) {
+// ApplyZoneChanges applies record changes to a zone in one transaction,
+// such as the diff of a zone file edit. The zone serial must still be
+// serial (0 skips the check); the new serial is returned.
+func (d *Database) ApplyZoneChanges(zoneID int64, serial int, changes []DBChange) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var current int
+	if err := tx.QueryRow(`SELECT serial FROM zones WHERE id = ?`, zoneID).Scan(&current); err != nil {
+		return 0, err
+	}
+	if serial != 0 && current != serial {
+		return 0, errVersionConflict
+	}
+	next, err := applyChangesTx(tx, zoneID, changes)
+	if err != nil {
+		return 0, err
+	}
+	return next, tx.Commit()
+}
+
+// applyChangesTx applies record changes to a zone and bumps its serial,
+// returning the new one
+func applyChangesTx(tx *sql.Tx, zoneID int64, changes []DBChange) (int, error) {
+	var result sql.Result
+	var err error
+	for _, ch := range changes {
+		activateAt, expireAt := ch.columns()
+		switch ch.Action {
+		case "create":
+			result, err = tx.Exec(`
+				INSERT INTO records (zone_id, name, type, value, ttl, priority, activate_at, expire_at, comment, tags, no_cache) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, zoneID, ch.Name, ch.Type, ch.Value, ch.TTL, ch.Priority, activateAt, expireAt, ch.Comment, ch.tagsColumn(), ch.NoCache)
+		case "update":
+			result, err = tx.Exec(`
+				UPDATE records SET name = ?, type = ?, value = ?, ttl = ?, priority = ?, activate_at = ?, expire_at = ?, comment = ?, tags = ?, no_cache = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP
+				WHERE id = ? AND zone_id = ?
+			`, ch.Name, ch.Type, ch.Value, ch.TTL, ch.Priority, activateAt, expireAt, ch.Comment, ch.tagsColumn(), ch.NoCache, ch.RecordID, zoneID)
+		case "delete":
+			if err = trashRecordTx(tx, ch.RecordID); err != nil {
+				return 0, err
+			}
+			result, err = tx.Exec(`DELETE FROM records WHERE id = ? AND zone_id = ?`, ch.RecordID, zoneID)
+		default:
+			return 0, fmt.Errorf("unknown change action %q", ch.Action)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return 0, fmt.Errorf("%w: record %d no longer exists", errChangesetConflict, ch.RecordID)
+		}
+		if ch.Action != "delete" {
+			if err := syncRRSetTTL(tx, zoneID, ch.Name, ch.Type, ch.TTL); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	var serial int
+	if err := tx.QueryRow(`SELECT serial FROM zones WHERE id = ?`, zoneID).Scan(&serial); err != nil {
+		return 0, err
+	}
+	serial = nextSerial(serial)
+	if _, err := tx.Exec(`UPDATE zones SET serial = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, serial, zoneID); err != nil {
+		return 0, err
+	}
+	return serial, nil
+}
+
+// Backup and restore
+
+// backupTables are the tables saved by a backup, parents before children.
+// The audit log is append-only and stays out of backups.
+var backupTables = []string{"zones", "records", "changesets", "changeset_changes", "trash", "signed_records", "zone_secondaries", "zone_notes", "secondary_zones", "forwarders", "clients", "client_pauses", "access_schedules", "config", "users", "api_tokens", "certificates"}
+
+// tableColumns returns the column names of table
+func tableColumns(tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// DumpTables returns every row of the backup tables, keyed by column name
+func (d *Database) DumpTables() (map[string][]map[string]any, error) {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
-	var value string
-	err := d.db.QueryRow(`SELECT value FROM config WHERE key = ?`, key).Scan(&value)
+	tables := make(map[string][]map[string]any)
+	for _, table := range backupTables {
+		rows, err := d.db.Query(`SELECT * FROM ` + table)
+		if err != nil {
+			return nil, err
+		}
+		columns, err := rows.Columns()
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		dumped := []map[string]any{}
+		for rows.Next() {
+			values := make([]any, len(columns))
+			ptrs := make([]any, len(columns))
+			for i := range values {
+				ptrs[i] = &values[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			row := make(map[string]any, len(columns))
+			for i, col := range columns {
+				switch v := values[i].(type) {
+				case []byte:
+					row[col] = string(v)
+				case time.Time:
+					row[col] = v.UTC().Format("2006-01-02 15:04:05")
+				default:
+					row[col] = v
+				}
+			}
+			dumped = append(dumped, row)
+		}
+		err = rows.Err()
+		_ = rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		tables[table] = dumped
+	}
+	return tables, nil
+}
+
+// Snapshot writes a consistent copy of the live database to path with the
+// SQLite online backup API, which, unlike a file copy, is safe while the
+// server writes
+func (d *Database) Snapshot(ctx context.Context, path string) error {
+	conn, err := d.db.Conn(ctx)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return value, nil
+	defer func() { _ = conn.Close() }()
+
+	return conn.Raw(func(driverConn any) error {
+		src, ok := driverConn.(interface {
+			NewBackup(dstURI string) (*sqlite.Backup, error)
+		})
+		if !ok {
+			return fmt.Errorf("database driver does not support online backups")
+		}
+		backup, err := src.NewBackup(path)
+		if err != nil {
+			return err
+		}
+		if _, err := backup.Step(-1); err != nil {
+			_ = backup.Finish()
+			return err
+		}
+		return backup.Finish()
+	})
+}
+
+// RestoreTables replaces the content of the backup tables in one
+// transaction. Columns unknown to this version are ignored, missing ones
+// take their default.
+func (d *Database) RestoreTables(tables map[string][]map[string]any) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for i := len(backupTables) - 1; i >= 0; i-- {
+		if _, err := tx.Exec(`DELETE FROM ` + backupTables[i]); err != nil {
+			return err
+		}
+	}
+	for _, table := range backupTables {
+		known, err := tableColumns(tx, table)
+		if err != nil {
+			return err
+		}
+		for _, row := range tables[table] {
+			var columns, marks []string
+			var args []any
+			for col, v := range row {
+				if !known[col] {
+					continue
+				}
+				columns = append(columns, `"`+col+`"`)
+				marks = append(marks, "?")
+				args = append(args, v)
+			}
+			if len(columns) == 0 {
+				continue
+			}
+			query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`, table, strings.Join(columns, ", "), strings.Join(marks, ", "))
+			if _, err := tx.Exec(query, args...); err != nil {
+				return fmt.Errorf("%s: %w", table, err)
+			}
+		}
+	}
+	return tx.Commit()
 }
 
 // LoadZonesFromDB loads zones from SQLite into memory for DNS resolution
 func LoadZonesFromDB() error {
+	prev := zoneStore.Load()
+	if err := zoneStore.Rebuild(buildZonesFromDB); err != nil {
+		return err
+	}
+	if err := loadZoneSecondariesFromDB(); err != nil {
+		return fmt.Errorf("zone secondaries: %w", err)
+	}
+	if err := loadSecondaryPrimariesFromDB(); err != nil {
+		return fmt.Errorf("secondary zones: %w", err)
+	}
+	notifyChangedZones(prev, zoneStore.Load())
+	return nil
+}
+
+// buildZonesFromDB builds a new zone snapshot from the database
+func buildZonesFromDB() (*ZoneData, error) {
 	if database == nil {
-		return fmt.Errorf("database not initialized")
+		return nil, fmt.Errorf("database not initialized")
 	}
 
 	dbZones, err := database.ListZones()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Reset zones
-	zones = make(map[string][]dns.RR)
-	loadedZoneNames = nil
+	zd := NewZoneData()
 
 	for _, dbZone := range dbZones {
-		// Skip disabled zones
+		// Disabled zones are not served; they are only marked when their
+		// names get an answer of their own
 		if !dbZone.Enabled {
+			if _, ok := disabledZoneRcode(); ok {
+				zd.AddDisabledZone(dbZone.Name)
+			}
 			continue
 		}
+		addDBZone(zd, dbZone)
+	}
 
-		zoneName := dns.Fqdn(dbZone.Name)
-		loadedZoneNames = append(loadedZoneNames, zoneName)
+	addDynamicZones(zd)
+	addCatalogZone(zd)
+	return zd, nil
+}
 
-		// Create SOA record
-		soaStr := fmt.Sprintf("%s %d IN SOA %s %s %d %d %d %d 3600",
-			zoneName, dbZone.TTL,
-			dns.Fqdn(dbZone.NS),
-			strings.Replace(dbZone.Admin, "@", ".", 1),
-			dbZone.Serial, dbZone.Refresh, dbZone.Retry, dbZone.Expire,
-		)
-		if soaRR, err := dns.NewRR(soaStr); err == nil {
-			zones[zoneName] = append(zones[zoneName], soaRR)
-		}
+// addDBZone adds a database zone and its records to zd. Records that do
+// not parse are left out and returned as problems.
+func addDBZone(zd *ZoneData, dbZone DBZone) []ZoneProblem {
+	// Load records for this zone
+	records, err := database.ListRecordsByZone(dbZone.ID)
+	if err != nil {
+		return []ZoneProblem{{Severity: severityError, Zone: dns.Fqdn(dbZone.Name), Message: "cannot read records: " + err.Error()}}
+	}
+	return addDBZoneRecords(zd, dbZone, records)
+}
 
-		// Create NS record
-		nsStr := fmt.Sprintf("%s %d IN NS %s", zoneName, dbZone.TTL, dns.Fqdn(dbZone.NS))
-		if nsRR, err := dns.NewRR(nsStr); err == nil {
-			zones[zoneName] = append(zones[zoneName], nsRR)
+// addDBZoneRecords adds a database zone with the given records to zd
+func addDBZoneRecords(zd *ZoneData, dbZone DBZone, records []DBRecord) []ZoneProblem {
+	zoneName := dns.Fqdn(dbZone.Name)
+	if qtype, err := parseAddressFilterType(dbZone.AddressFilter); err == nil && qtype != 0 {
+		zd.SetAddressFilter(zoneName, qtype)
+	}
+	if dbZone.Type == zoneTypeForward {
+		upstreams, err := parseZoneForwarders(dbZone.Forwarders)
+		if err != nil {
+			return []ZoneProblem{{Severity: severityError, Zone: zoneName, Message: err.Error()}}
+		}
+		zd.AddForwardZone(zoneName, upstreams)
+		return nil
+	}
+	if dbZone.Type == zoneTypeSecondary {
+		return addSecondaryZoneRecords(zd, dbZone)
+	}
+	zd.AddZone(zoneName)
+
+	// Pre-signed zones serve their imported SOA/NS in place of the
+	// synthesized ones, since the signatures cover them
+	signed := loadSignedRRs(dbZone.ID)
+	for _, rr := range zoneApexRRs(dbZone) {
+		if !hasOwnerType(signed, zoneName, rr.Header().Rrtype) {
+			zd.AddRR(rr)
 		}
+	}
+	for _, rr := range signed {
+		zd.AddRR(rr)
+	}
 
-		// Load records for this zone
-		records, err := database.ListRecordsByZone(dbZone.ID)
+	var problems []ZoneProblem
+	now := time.Now()
+	for _, record := range records {
+		rr, err := recordToRR(zoneName, record)
 		if err != nil {
+			problems = append(problems, ZoneProblem{Severity: severityError, Zone: zoneName, Name: record.Name, Type: record.Type,
+				Message: fmt.Sprintf("invalid record %q: %v", record.Value, err)})
 			continue
 		}
+		// Records whose answers must not be cached are served with TTL 0
+		if record.NoCache {
+			rr.Header().Ttl = 0
+			zd.SetNoCache(rr.Header().Name)
+		}
+		// Scheduled records are only served within their window
+		if record.activeAt(now) {
+			zd.AddRR(rr)
+		}
+	}
+	return problems
+}
 
-		for _, record := range records {
-			// Build record name
-			recordName := record.Name
-			if recordName == "@" {
-				recordName = zoneName
-			} else if !strings.HasSuffix(recordName, ".") {
-				recordName = recordName + "." + zoneName
-			}
+// zoneApexRRs builds the SOA and NS records synthesized from the zone
+// settings, and the glue of an NS name inside the zone
+func zoneApexRRs(dbZone DBZone) []dns.RR {
+	zoneName := dns.Fqdn(dbZone.Name)
+	ttl := clampTTL(uint32(dbZone.TTL))
+	ns := qualifyName(dbZone.NS, zoneName)
+	var rrs []dns.RR
+
+	// Create SOA record
+	minimum := dbZone.Minimum
+	if minimum <= 0 {
+		minimum = 3600
+	}
+	soaStr := fmt.Sprintf("%s %d IN SOA %s %s %d %d %d %d %d",
+		zoneName, ttl, ns, soaMailbox(dbZone.Admin, zoneName),
+		dbZone.Serial, dbZone.Refresh, dbZone.Retry, dbZone.Expire, minimum,
+	)
+	if soaRR, err := dns.NewRR(soaStr); err == nil {
+		rrs = append(rrs, soaRR)
+	}
 
-			rrStr := fmt.Sprintf("%s %d IN %s %s", recordName, record.TTL, record.Type, record.Value)
-			if rr, err := dns.NewRR(rrStr); err == nil {
-				name := dns.Fqdn(rr.Header().Name)
-				zones[name] = append(zones[name], rr)
+	// Create NS record
+	nsStr := fmt.Sprintf("%s %d IN NS %s", zoneName, ttl, ns)
+	if nsRR, err := dns.NewRR(nsStr); err == nil {
+		rrs = append(rrs, nsRR)
+	}
+
+	if dns.IsSubDomain(zoneName, ns) {
+		for _, addr := range strings.Split(dbZone.NSAddress, ",") {
+			if ip := net.ParseIP(strings.TrimSpace(addr)); ip != nil {
+				rrs = append(rrs, addressRR(ns, ip, ttl))
 			}
 		}
 	}
+	return rrs
+}
+
+// qualifyName makes a name from the zone settings fully qualified. Names
+// with a dot are absolute even without the trailing dot, as they have
+// always been; a single label is relative to the zone.
+func qualifyName(name, zoneName string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch {
+	case name == "":
+		return "ns1." + dns.Fqdn(zoneName)
+	case strings.HasSuffix(name, "."):
+		return name
+	case strings.Contains(name, "."):
+		return name + "."
+	default:
+		return name + "." + dns.Fqdn(zoneName)
+	}
+}
+
+// soaMailbox converts the zone admin contact to the SOA RNAME: an email
+// address (john.doe@example.com) becomes john\.doe.example.com., and
+// hostmaster.<zone> is used when it is empty
+func soaMailbox(admin, zoneName string) string {
+	admin = strings.TrimSpace(admin)
+	if admin == "" {
+		return "hostmaster." + dns.Fqdn(zoneName)
+	}
+	if local, domain, ok := strings.Cut(admin, "@"); ok {
+		local = strings.ReplaceAll(strings.ReplaceAll(local, `\.`, "."), ".", `\.`)
+		return local + "." + strings.ToLower(dns.Fqdn(domain))
+	}
+	return qualifyName(admin, zoneName)
+}
 
+// normalizeZoneSettings stores the NS and admin contact the way they are
+// served and checks the glue addresses and the forwarders of a forward zone
+func normalizeZoneSettings(zone *DBZone) error {
+	name, err := idnToASCII(strings.TrimSpace(zone.Name))
+	if err != nil {
+		return err
+	}
+	zone.Name = name
+	switch zone.Type {
+	case "", zoneTypePrimary:
+		zone.Type = zoneTypePrimary
+		zone.Forwarders = ""
+		zone.Primaries = ""
+	case zoneTypeForward:
+		upstreams, err := parseZoneForwarders(zone.Forwarders)
+		if err != nil {
+			return err
+		}
+		zone.Forwarders = strings.Join(upstreams, ",")
+		zone.Primaries = ""
+	case zoneTypeSecondary:
+		primaries, err := parseZonePrimaries(zone.Primaries)
+		if err != nil {
+			return err
+		}
+		zone.Primaries = strings.Join(primaries, ",")
+		zone.Forwarders = ""
+	default:
+		return fmt.Errorf("unknown zone type %q (primary, forward or secondary)", zone.Type)
+	}
+	if _, err := parseAddressFilterType(zone.AddressFilter); err != nil {
+		return err
+	}
+	zone.AddressFilter = strings.ToUpper(strings.TrimSpace(zone.AddressFilter))
+	if zone.NS, err = idnToASCII(qualifyName(zone.NS, zone.Name)); err != nil {
+		return err
+	}
+	if zone.Admin, err = idnToASCII(soaMailbox(zone.Admin, zone.Name)); err != nil {
+		return err
+	}
+	var addrs []string
+	for _, addr := range strings.Split(zone.NSAddress, ",") {
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return fmt.Errorf("invalid NS address %q", addr)
+		}
+		addrs = append(addrs, ip.String())
+	}
+	if len(addrs) > 0 && !dns.IsSubDomain(dns.Fqdn(zone.Name), zone.NS) {
+		return fmt.Errorf("NS addresses are only served for an NS name inside the zone, %s is not", zone.NS)
+	}
+	zone.NSAddress = strings.Join(addrs, ",")
 	return nil
 }
 
+// recordToRR converts a database record of zoneName to the RR served
+func recordToRR(zoneName string, record DBRecord) (dns.RR, error) {
+	rrStr := fmt.Sprintf("%s %d IN %s %s", recordOwner(record.Name, zoneName), clampTTL(uint32(record.TTL)), record.Type, rdataText(record.Type, record.Value))
+	return dns.NewRR(rrStr)
+}
+
+// rrToRecord converts an RR of zoneName to a database record, with the
+// name relative to the zone ("@" for the apex)
+func rrToRecord(zoneName string, rr dns.RR) DBRecord {
+	h := rr.Header()
+	zoneName = dns.Fqdn(zoneName)
+	name := h.Name
+	switch {
+	case strings.EqualFold(name, zoneName):
+		name = "@"
+	case strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(zoneName)):
+		name = name[:len(name)-len(zoneName)-1]
+	}
+	record := DBRecord{Name: name, Type: dns.TypeToString[h.Rrtype], Value: rdataString(rr), TTL: int(h.Ttl)}
+	if mx, ok := rr.(*dns.MX); ok {
+		record.Priority = int(mx.Preference)
+	}
+	if s := svcbData(rr); s != nil {
+		record.Priority = int(s.Priority)
+	}
+	return record
+}
+
 // LoadForwardersFromDB loads forwarders from SQLite into memory
 // If no forwarders are in the database, keeps existing forwarders (from config file)
 func LoadForwardersFromDB() error {
@@ -590,10 +3064,11 @@ func LoadForwardersFromDB() error {
 	}
 
 	// Set forwarders from database (empty if none)
-	forwarders = make([]string, 0, len(dbForwarders))
+	list := make([]ForwarderConfig, 0, len(dbForwarders))
 	for _, f := range dbForwarders {
-		forwarders = append(forwarders, f.Address)
+		list = append(list, ForwarderConfig{Address: f.Address, Priority: f.Priority, UpstreamOptions: f.UpstreamOptions})
 	}
+	setBaseForwarders(setUpstreams(list))
 
 	return nil
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DebugDump is a snapshot of the state of the server, to diagnose a server
+// misbehaving in production without attaching a debugger
+type DebugDump struct {
+	Time       time.Time          `json:"time"`
+	Version    string             `json:"version"`
+	Instance   string             `json:"instance"`
+	Mode       string             `json:"mode"`
+	Uptime     string             `json:"uptime"`
+	Goroutines int                `json:"goroutines"`
+	Memory     DebugMemory        `json:"memory"`
+	Zones      []DebugZone        `json:"zones"`
+	Forwarders []string           `json:"forwarders"`
+	Upstreams  []UpstreamStat     `json:"upstreams"`
+	Forwarding map[string]any     `json:"forwarding"`
+	Cache      map[string]any     `json:"cache,omitempty"`
+	Dnstap     map[string]any     `json:"dnstap,omitempty"`
+	Role       string             `json:"role"`
+	Transfer   []string           `json:"allow_transfer,omitempty"`
+	Git        *GitSyncStatus     `json:"git,omitempty"`
+	Verify     *VerifyResult      `json:"verify,omitempty"`
+	Problems   map[string]int     `json:"problems,omitempty"` // by zone, from the last check
+	Warnings   []string           `json:"warnings,omitempty"`
+	Stats      map[string]float64 `json:"stats"`
+}
+
+// DebugMemory is the memory of the Go runtime, in bytes
+type DebugMemory struct {
+	HeapAlloc uint64 `json:"heap_alloc"`
+	HeapInuse uint64 `json:"heap_inuse"`
+	Sys       uint64 `json:"sys"`
+	NumGC     uint32 `json:"num_gc"`
+}
+
+// DebugZone is one zone served, with its SOA serial (0 for forward zones)
+type DebugZone struct {
+	Zone    string `json:"zone"`
+	Serial  uint32 `json:"serial,omitempty"`
+	Records int    `json:"records"`
+	Forward bool   `json:"forward,omitempty"`
+}
+
+// debugDumpDir is where SIGUSR1 writes the dumps, empty to log them
+var debugDumpDir string
+
+// buildDebugDump gathers the state of every part of the server
+func buildDebugDump() DebugDump {
+	now := time.Now()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	dump := DebugDump{
+		Time:       now,
+		Version:    version,
+		Instance:   instanceName,
+		Mode:       dbMode,
+		Goroutines: runtime.NumGoroutine(),
+		Memory:     DebugMemory{HeapAlloc: mem.HeapAlloc, HeapInuse: mem.HeapInuse, Sys: mem.Sys, NumGC: mem.NumGC},
+		Forwarders: currentForwarders(),
+		Upstreams:  upstreamStatsList(),
+		Forwarding: forwardLimit.Stats(),
+		Cache:      forwardCache.Stats(),
+		Dnstap:     dnstapOut.Stats(),
+		Role:       currentServerRole(),
+		Git:        gitHealth(),
+		Zones:      []DebugZone{},
+	}
+
+	zd := zoneStore.Load()
+	for _, z := range servedSerials(zd) {
+		rrs, _ := zd.ZoneRRs(z.Zone)
+		dump.Zones = append(dump.Zones, DebugZone{Zone: z.Zone, Serial: z.Serial, Records: len(rrs)})
+	}
+	for _, name := range zd.ForwardZoneNames() {
+		dump.Zones = append(dump.Zones, DebugZone{Zone: name, Forward: true})
+	}
+	for _, n := range allowTransfer {
+		dump.Transfer = append(dump.Transfer, n.String())
+	}
+
+	lastVerifyMu.RLock()
+	if lastVerify != nil {
+		v := *lastVerify
+		dump.Verify = &v
+	}
+	lastVerifyMu.RUnlock()
+	zoneProblemsMu.RLock()
+	if len(zoneProblems) > 0 {
+		dump.Problems = make(map[string]int, len(zoneProblems))
+		for zone, problems := range zoneProblems {
+			dump.Problems[zone] = len(problems)
+		}
+	}
+	zoneProblemsMu.RUnlock()
+	for _, warning := range []string{verifyWarning(), problemsWarning(), maintenanceWarning()} {
+		if warning != "" {
+			dump.Warnings = append(dump.Warnings, warning)
+		}
+	}
+
+	report := queryStats.Report(now, 5, 0)
+	queryStats.mu.Lock()
+	dump.Uptime = now.Sub(queryStats.started).Round(time.Second).String()
+	queryStats.mu.Unlock()
+	dump.Stats = map[string]float64{"qps": report.QPS, "queries_5m": float64(report.Total)}
+	return dump
+}
+
+// writeDebugDump writes a dump to a new file of debugDumpDir, or to the log
+// when no directory is set
+func writeDebugDump() {
+	data, err := json.MarshalIndent(buildDebugDump(), "", "  ")
+	if err != nil {
+		slog.Error("failed to build debug dump", "error", err)
+		return
+	}
+	if debugDumpDir == "" {
+		slog.Info("Debug dump", "dump", string(data))
+		return
+	}
+	path := filepath.Join(debugDumpDir, fmt.Sprintf("simpledns-dump-%s.json", time.Now().Format("20060102-150405")))
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		slog.Error("failed to write debug dump", "path", path, "error", err)
+		return
+	}
+	slog.Info("Wrote debug dump", "path", path)
+}
+
+// handleAPIDebugDump handles GET /api/debug/dump, the same snapshot SIGUSR1
+// writes
+func handleAPIDebugDump(c *gin.Context) {
+	c.JSON(http.StatusOK, buildDebugDump())
+}
@@ -0,0 +1,7 @@
+//go:build windows || plan9
+
+package main
+
+// watchDebugSignal does nothing: there is no SIGUSR1 here, the dump is only
+// available from GET /api/debug/dump
+func watchDebugSignal() {}
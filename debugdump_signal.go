@@ -0,0 +1,20 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchDebugSignal writes a debug dump on every SIGUSR1
+func watchDebugSignal() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1)
+	go func() {
+		for range sig {
+			writeDebugDump()
+		}
+	}()
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleAPIDelegations handles GET /api/delegations, the tree of the
+// served zones, forward zones and delegations
+func handleAPIDelegations(c *gin.Context) {
+	c.JSON(http.StatusOK, zoneStore.Load().Cuts())
+}
+
+// DisplayName returns the name of the cut in Unicode
+func (c ZoneCut) DisplayName() string {
+	return idnToUnicode(c.Name)
+}
+
+// Indent is the left padding of the cut in the delegation tree, in pixels
+func (c ZoneCut) Indent() int {
+	return c.Depth * 24
+}
+
+// ZonePath is the records page of a hosted zone
+func (c ZoneCut) ZonePath() string {
+	return "/zones/" + strings.TrimSuffix(c.Name, ".") + "/records"
+}
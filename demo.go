@@ -0,0 +1,160 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// demoMode runs on an in-memory database filled with fixed example data,
+// with every change through the web UI and API refused
+var demoMode bool
+
+// demoPassword is the password of the demo admin account
+const demoPassword = "demo"
+
+// demoZone is one zone of the demo fixtures
+type demoZone struct {
+	zone    DBZone
+	records []DBRecord
+}
+
+// demoZones are the fixtures loaded by -demo. Keep them stable: screenshots
+// and integration tests rely on the exact content.
+var demoZones = []demoZone{
+	{
+		zone: DBZone{Name: "homelab.int", Enabled: true, TTL: 3600, NS: "ns1.homelab.int", Admin: "admin.homelab.int", Serial: 1, Refresh: 3600, Retry: 600, Expire: 86400},
+		records: []DBRecord{
+			{Name: "@", Type: "A", Value: "192.168.1.10", TTL: 3600},
+			{Name: "ns1", Type: "A", Value: "192.168.1.2", TTL: 3600},
+			{Name: "nas", Type: "A", Value: "192.168.1.20", TTL: 3600},
+			{Name: "nas", Type: "AAAA", Value: "fd00::20", TTL: 3600},
+			{Name: "proxmox", Type: "A", Value: "192.168.1.30", TTL: 3600},
+			{Name: "grafana", Type: "CNAME", Value: "proxmox.homelab.int.", TTL: 3600},
+			{Name: "@", Type: "MX", Value: "10 mail.homelab.int.", TTL: 3600, Priority: 10},
+			{Name: "mail", Type: "A", Value: "192.168.1.40", TTL: 3600},
+			{Name: "@", Type: "TXT", Value: "\"v=spf1 mx -all\"", TTL: 3600},
+			{Name: "_ldap._tcp", Type: "SRV", Value: "0 5 389 nas.homelab.int.", TTL: 3600},
+		},
+	},
+	{
+		zone: DBZone{Name: "example.com", Enabled: true, TTL: 3600, NS: "ns1.example.com", Admin: "hostmaster.example.com", Serial: 1, Refresh: 3600, Retry: 600, Expire: 86400},
+		records: []DBRecord{
+			{Name: "@", Type: "A", Value: "203.0.113.10", TTL: 300},
+			{Name: "www", Type: "CNAME", Value: "example.com.", TTL: 300},
+			{Name: "ns1", Type: "A", Value: "203.0.113.2", TTL: 3600},
+			{Name: "lab", Type: "NS", Value: "ns.lab.example.com.", TTL: 3600},
+			{Name: "ns.lab", Type: "A", Value: "203.0.113.53", TTL: 3600},
+		},
+	},
+	{
+		zone: DBZone{Name: "staging.test", Enabled: false, TTL: 600, NS: "ns1.staging.test", Admin: "admin.staging.test", Serial: 1, Refresh: 3600, Retry: 600, Expire: 86400},
+		records: []DBRecord{
+			{Name: "app", Type: "A", Value: "10.0.0.5", TTL: 600},
+		},
+	},
+}
+
+// demoForwarders are the upstreams configured in demo mode
+var demoForwarders = []DBForwarder{
+	{Address: "1.1.1.1:53", Priority: 0},
+	{Address: "9.9.9.9:53", Priority: 1},
+}
+
+// demoTopNames and demoTopClients are the analytics counters in demo mode
+var demoTopNames = []TopEntry{
+	{Key: "nas.homelab.int.", Count: 18240},
+	{Key: "grafana.homelab.int.", Count: 9650},
+	{Key: "www.example.com.", Count: 7310},
+	{Key: "proxmox.homelab.int.", Count: 4120},
+	{Key: "github.com.", Count: 3890},
+	{Key: "api.github.com.", Count: 2750},
+	{Key: "mail.homelab.int.", Count: 1980},
+	{Key: "app.staging.test.", Count: 640},
+}
+
+var demoTopClients = []TopEntry{
+	{Key: "192.168.1.50", Count: 21400},
+	{Key: "192.168.1.51", Count: 14800},
+	{Key: "192.168.1.30", Count: 8930},
+	{Key: "192.168.1.20", Count: 3310},
+	{Key: "fd00::42", Count: 1140},
+}
+
+// seedDemoStats fills the analytics history with a fixed daily pattern
+func seedDemoStats(now time.Time) {
+	queryStats.mu.Lock()
+	defer queryStats.mu.Unlock()
+
+	current := now.Unix() / 60
+	for i := int64(0); i < int64(len(queryStats.buckets)); i++ {
+		minute := current - i
+		// Busier during the day: 60 to 240 queries a minute by hour of day
+		hour := (minute / 60) % 24
+		load := uint64(60 + 15*min(hour, 24-hour) + minute%7)
+		b := queryStats.bucket(minute)
+		b.local = load * 6 / 10
+		b.cached = load * 3 / 10
+		b.forwarded = load - b.local - b.cached
+		b.total = load
+		b.rcodes[3] = load / 20          // NXDOMAIN
+		b.rcodes[2] = uint64(minute % 3) // SERVFAIL
+		b.rcodes[0] = load - b.rcodes[3] - b.rcodes[2]
+	}
+	for _, e := range demoTopNames {
+		queryStats.names.Add(e.Key, e.Count)
+	}
+	for _, e := range demoTopClients {
+		queryStats.clients.Add(e.Key, e.Count)
+	}
+}
+
+// seedDemoData fills a fresh database with the demo fixtures and the admin
+// account
+func seedDemoData() error {
+	for _, dz := range demoZones {
+		zone := dz.zone
+		if err := database.CreateZone(&zone); err != nil {
+			return err
+		}
+		for _, r := range dz.records {
+			record := r
+			record.ZoneID = zone.ID
+			if err := database.CreateRecord(&record); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range demoForwarders {
+		forwarder := f
+		if err := database.CreateForwarder(&forwarder); err != nil {
+			return err
+		}
+	}
+	if err := CreateAdmin(demoPassword); err != nil {
+		return err
+	}
+	seedDemoStats(time.Now())
+
+	slog.Info("Demo data loaded, log in as admin with password \"demo\" (read-only)", "zones", len(demoZones))
+	return nil
+}
+
+// DemoReadOnlyMiddleware refuses every change in demo mode
+func DemoReadOnlyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !demoMode {
+			c.Next()
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			c.JSON(http.StatusForbidden, gin.H{"error": "demo mode is read-only"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DHCPConfig publishes the hostnames of the DHCP leases of an ISC dhcpd or
+// dnsmasq server as records, <hostname>.<zone>
+type DHCPConfig struct {
+	LeaseFile string `yaml:"lease_file" json:"lease_file,omitempty"`
+	Format    string `yaml:"format" json:"format,omitempty"` // dnsmasq or isc, detected when empty
+	Zone      string `yaml:"zone" json:"zone,omitempty"`     // default dhcp.lan
+	// ReverseZones are the in-addr.arpa and ip6.arpa zones getting the
+	// PTR records of the leases inside them
+	ReverseZones []string `yaml:"reverse_zones" json:"reverse_zones,omitempty"`
+	TTL          int      `yaml:"ttl" json:"ttl,omitempty"` // default 60
+}
+
+// Lease file formats
+const (
+	leaseFormatDnsmasq = "dnsmasq"
+	leaseFormatISC     = "isc"
+)
+
+// dhcpRescanInterval is how often the lease file is read even when it did
+// not change, so expired leases are dropped
+const dhcpRescanInterval = time.Minute
+
+// dhcpLease is an address leased to a named client
+type dhcpLease struct {
+	ip      net.IP
+	host    string
+	expires time.Time // zero for an infinite lease
+}
+
+// detectLeaseFormat tells a dhcpd.leases file from a dnsmasq.leases file
+func detectLeaseFormat(data []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "lease ") || strings.HasPrefix(line, "authoring-byte-order") || strings.HasPrefix(line, "server-duid") {
+			return leaseFormatISC
+		}
+		return leaseFormatDnsmasq
+	}
+	return leaseFormatDnsmasq
+}
+
+// parseDnsmasqLeases parses a dnsmasq lease file: one lease per line,
+// "<expiry> <mac or iaid> <address> <hostname> <client id>", where the
+// hostname is * when the client sent none
+func parseDnsmasqLeases(data []byte) []dhcpLease {
+	var leases []dhcpLease
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] == "duid" || fields[3] == "*" {
+			continue
+		}
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		ip := net.ParseIP(fields[2])
+		if ip == nil {
+			continue
+		}
+		lease := dhcpLease{ip: ip, host: fields[3]}
+		if expiry > 0 {
+			lease.expires = time.Unix(expiry, 0)
+		}
+		leases = append(leases, lease)
+	}
+	return leases
+}
+
+// parseISCLeases parses a dhcpd.leases file. dhcpd appends a new block
+// each time a lease changes, so the last block of an address wins; only
+// the active leases are returned.
+func parseISCLeases(data []byte) []dhcpLease {
+	type block struct {
+		lease  dhcpLease
+		active bool
+	}
+	byIP := make(map[string]*block)
+	var order []string
+	var cur *block
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 && !strings.Contains(line[:i], `"`) {
+			line = strings.TrimSpace(line[:i])
+		}
+		switch {
+		case strings.HasPrefix(line, "lease ") && strings.HasSuffix(line, "{"):
+			ip := net.ParseIP(strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "lease "), "{")))
+			if ip == nil {
+				cur = nil
+				continue
+			}
+			cur = &block{lease: dhcpLease{ip: ip}}
+			if _, ok := byIP[ip.String()]; !ok {
+				order = append(order, ip.String())
+			}
+			byIP[ip.String()] = cur
+		case line == "}":
+			cur = nil
+		case cur == nil:
+		case strings.HasPrefix(line, "binding state "):
+			cur.active = strings.TrimSuffix(strings.TrimPrefix(line, "binding state "), ";") == "active"
+		case strings.HasPrefix(line, "client-hostname "):
+			cur.lease.host = strings.Trim(strings.TrimSuffix(strings.TrimPrefix(line, "client-hostname "), ";"), `"`)
+		case strings.HasPrefix(line, "ends "):
+			cur.lease.expires = parseISCTime(strings.TrimSuffix(strings.TrimPrefix(line, "ends "), ";"))
+		}
+	}
+
+	var leases []dhcpLease
+	for _, ip := range order {
+		if b := byIP[ip]; b.active && b.lease.host != "" {
+			leases = append(leases, b.lease)
+		}
+	}
+	return leases
+}
+
+// parseISCTime parses the date of a dhcpd.leases statement: "never",
+// "epoch <seconds>" or "<weekday> <yyyy/mm/dd> <hh:mm:ss>" in UTC. An
+// unreadable date counts as never.
+func parseISCTime(s string) time.Time {
+	fields := strings.Fields(s)
+	switch {
+	case len(fields) == 2 && fields[0] == "epoch":
+		if sec, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			return time.Unix(sec, 0)
+		}
+	case len(fields) == 3:
+		if t, err := time.Parse("2006/01/02 15:04:05", fields[1]+" "+fields[2]); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// readLeases reads the lease file in format, detected when empty
+func readLeases(path, format string) ([]dhcpLease, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		format = detectLeaseFormat(data)
+	}
+	switch format {
+	case leaseFormatDnsmasq:
+		return parseDnsmasqLeases(data), nil
+	case leaseFormatISC:
+		return parseISCLeases(data), nil
+	}
+	return nil, fmt.Errorf("unknown lease file format %q (dnsmasq or isc)", format)
+}
+
+// hostLabel turns the hostname a device chose into a DNS label: the first
+// label, lowercased, or "" when it is not a valid host name
+func hostLabel(host string) string {
+	label := strings.ToLower(strings.SplitN(host, ".", 2)[0])
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return ""
+	}
+	for _, c := range label {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return ""
+		}
+	}
+	return label
+}
+
+// dhcpRecords returns the A and AAAA records of the leases current at now,
+// and their PTR records by reverse zone. A client holding several leases
+// of one family (after moving from Wi-Fi to Ethernet) gets the one that
+// ends last.
+func dhcpRecords(zone string, reverseZones []string, ttl uint32, leases []dhcpLease, now time.Time) ([]dns.RR, map[string][]dns.RR) {
+	type key struct {
+		name  string
+		rtype uint16
+	}
+	latest := make(map[key]dhcpLease)
+	for _, l := range leases {
+		if !l.expires.IsZero() && !l.expires.After(now) {
+			continue
+		}
+		label := hostLabel(l.host)
+		if label == "" {
+			continue
+		}
+		k := key{name: label + "." + zone, rtype: dns.TypeAAAA}
+		if l.ip.To4() != nil {
+			k.rtype = dns.TypeA
+		}
+		if prev, ok := latest[k]; ok && (prev.expires.IsZero() || (!l.expires.IsZero() && l.expires.Before(prev.expires))) {
+			continue
+		}
+		latest[k] = l
+	}
+
+	var rrs []dns.RR
+	ptrs := make(map[string][]dns.RR, len(reverseZones))
+	for k, l := range latest {
+		hdr := dns.RR_Header{Name: k.name, Rrtype: k.rtype, Class: dns.ClassINET, Ttl: ttl}
+		if k.rtype == dns.TypeA {
+			rrs = append(rrs, &dns.A{Hdr: hdr, A: l.ip.To4()})
+		} else {
+			rrs = append(rrs, &dns.AAAA{Hdr: hdr, AAAA: l.ip})
+		}
+		arpa, err := dns.ReverseAddr(l.ip.String())
+		if err != nil {
+			continue
+		}
+		for _, rz := range reverseZones {
+			if dns.IsSubDomain(rz, arpa) {
+				ptrs[rz] = append(ptrs[rz], &dns.PTR{Hdr: dns.RR_Header{Name: arpa, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: ttl}, Ptr: k.name})
+				break
+			}
+		}
+	}
+	sort.Slice(rrs, func(i, j int) bool { return rrs[i].String() < rrs[j].String() })
+	for _, list := range ptrs {
+		sort.Slice(list, func(i, j int) bool { return list[i].String() < list[j].String() })
+	}
+	return rrs, ptrs
+}
+
+// startDHCPLeases publishes the leases of the lease file and follows its
+// changes
+func startDHCPLeases(cfg DHCPConfig) {
+	if cfg.LeaseFile == "" {
+		return
+	}
+	zone := cfg.Zone
+	if zone == "" {
+		zone = "dhcp.lan"
+	}
+	zone = strings.ToLower(dns.Fqdn(zone))
+	reverseZones := make([]string, len(cfg.ReverseZones))
+	for i, rz := range cfg.ReverseZones {
+		reverseZones[i] = strings.ToLower(dns.Fqdn(rz))
+	}
+	ttl := uint32(60)
+	if cfg.TTL > 0 {
+		ttl = uint32(cfg.TTL)
+	}
+	format := strings.ToLower(cfg.Format)
+
+	publish := func() {
+		leases, err := readLeases(cfg.LeaseFile, format)
+		if err != nil {
+			// Keep the records published until the file reads again
+			slog.Warn("failed to read DHCP leases", "file", cfg.LeaseFile, "error", err)
+			return
+		}
+		rrs, ptrs := dhcpRecords(zone, reverseZones, ttl, leases, time.Now())
+		setDynamicRecords("dhcp", zone, rrs)
+		for _, rz := range reverseZones {
+			setDynamicRecords("dhcp:"+rz, rz, ptrs[rz])
+		}
+	}
+
+	slog.Info("Publishing DHCP leases", "file", cfg.LeaseFile, "zone", zone, "reverse_zones", reverseZones)
+	mod := fileModTime(cfg.LeaseFile)
+	publish()
+	go func() {
+		ticker := time.NewTicker(hostsReloadInterval)
+		defer ticker.Stop()
+		lastScan := time.Now()
+		for range ticker.C {
+			if m := fileModTime(cfg.LeaseFile); !m.Equal(mod) || time.Since(lastScan) >= dhcpRescanInterval {
+				mod, lastScan = m, time.Now()
+				publish()
+			}
+		}
+	}()
+}
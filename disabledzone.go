@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// Answers to the queries for the names of a disabled zone
+const (
+	disabledForward  = "forward"  // as if the zone did not exist: forwarders, then NXDOMAIN (default)
+	disabledNXDomain = "nxdomain" // NXDOMAIN, never forwarded
+	disabledRefused  = "refused"  // REFUSED, never forwarded
+)
+
+// disabledZoneResponse sets how queries for a disabled zone are answered
+var disabledZoneResponse = disabledForward
+
+// parseDisabledZoneResponse checks disabled_zone_response, forward when
+// empty
+func parseDisabledZoneResponse(s string) (string, error) {
+	switch s {
+	case "":
+		return disabledForward, nil
+	case disabledForward, disabledNXDomain, disabledRefused:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid disabled_zone_response %q, use forward, nxdomain or refused", s)
+}
+
+// disabledZoneRcode returns the rcode answering a query for a name of a
+// disabled zone, false when the query goes on as if the zone did not exist
+func disabledZoneRcode() (int, bool) {
+	switch disabledZoneResponse {
+	case disabledNXDomain:
+		return dns.RcodeNameError, true
+	case disabledRefused:
+		return dns.RcodeRefused, true
+	}
+	return 0, false
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// DNS64Config configures AAAA synthesis for IPv6-only clients behind NAT64
+// (RFC 6147)
+type DNS64Config struct {
+	Enabled bool   `yaml:"enabled" json:"enabled,omitempty"`
+	Prefix  string `yaml:"prefix" json:"prefix,omitempty"` // NAT64 prefix, default 64:ff9b::/96
+	// Clients lists the networks (addresses or CIDR prefixes) synthesis is
+	// enabled for, every client when empty
+	Clients []string `yaml:"clients" json:"clients,omitempty"`
+}
+
+// dns64 is nil when synthesis is disabled
+var dns64 *dns64Synth
+
+type dns64Synth struct {
+	prefix  *net.IPNet
+	clients []*net.IPNet
+}
+
+// mappedIPv4 is ::ffff:0:0/96: AAAA records in it are ignored (RFC 6147
+// section 5.1.4)
+var mappedIPv4 = &net.IPNet{IP: net.ParseIP("::ffff:0:0"), Mask: net.CIDRMask(96, 128)}
+
+func initDNS64(cfg DNS64Config) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	ipnet, err := parseNAT64Prefix(cfg.Prefix)
+	if err != nil {
+		return err
+	}
+	clients, err := parseAllowTransfer(cfg.Clients)
+	if err != nil {
+		return err
+	}
+	dns64 = &dns64Synth{prefix: ipnet, clients: clients}
+	slog.Info("DNS64 enabled", "prefix", ipnet.String(), "clients", cfg.Clients)
+	return nil
+}
+
+// parseNAT64Prefix parses the prefix, 64:ff9b::/96 when empty
+func parseNAT64Prefix(prefix string) (*net.IPNet, error) {
+	if prefix == "" {
+		prefix = "64:ff9b::/96"
+	}
+	_, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil || ipnet.IP.To4() != nil {
+		return nil, fmt.Errorf("invalid NAT64 prefix %q", prefix)
+	}
+	// RFC 6052 section 2.2
+	switch ones, _ := ipnet.Mask.Size(); ones {
+	case 32, 40, 48, 56, 64, 96:
+	default:
+		return nil, fmt.Errorf("NAT64 prefix %s: length must be 32, 40, 48, 56, 64 or 96", prefix)
+	}
+	return ipnet, nil
+}
+
+// enabledFor reports whether addr gets synthesized answers
+func (s *dns64Synth) enabledFor(addr net.Addr) bool {
+	if s == nil {
+		return false
+	}
+	if len(s.clients) == 0 {
+		return true
+	}
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	}
+	for _, n := range s.clients {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// embed returns the IPv6 address of v4 in the NAT64 prefix, skipping the
+// reserved bits 64-71 (RFC 6052 section 2.2)
+func (s *dns64Synth) embed(v4 net.IP) net.IP {
+	out := make(net.IP, net.IPv6len)
+	copy(out, s.prefix.IP.To16())
+	ones, _ := s.prefix.Mask.Size()
+	pos := ones / 8
+	for _, b := range v4.To4() {
+		if pos == 8 {
+			pos++
+		}
+		out[pos] = b
+		pos++
+	}
+	return out
+}
+
+// dns64Writer captures the response of the wrapped handler
+type dns64Writer struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *dns64Writer) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func (w *dns64Writer) Unwrap() dns.ResponseWriter { return w.ResponseWriter }
+
+// withDNS64 wraps a DNS handler: an AAAA query from an enabled client with
+// no AAAA in the answer is answered with addresses synthesized from the A
+// records of the name
+func withDNS64(next dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeAAAA || !dns64.enabledFor(w.RemoteAddr()) {
+			next(w, r)
+			return
+		}
+		// A validating client asking for unchecked data gets the real answer
+		if opt := r.IsEdns0(); opt != nil && opt.Do() && r.CheckingDisabled {
+			next(w, r)
+			return
+		}
+
+		rec := &dns64Writer{ResponseWriter: w}
+		next(rec, r)
+		resp := rec.msg
+		if resp == nil {
+			return
+		}
+		// Names without the asked type may get NXDOMAIN here: the A query
+		// tells whether the name exists
+		if (resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError) || hasRealAAAA(resp) {
+			_ = w.WriteMsg(resp)
+			return
+		}
+
+		aReq := r.Copy()
+		aReq.Question[0].Qtype = dns.TypeA
+		aRec := &dns64Writer{ResponseWriter: w}
+		next(aRec, aReq)
+		if aRec.msg == nil || aRec.msg.Rcode != dns.RcodeSuccess {
+			_ = w.WriteMsg(resp)
+			return
+		}
+
+		// The negative TTL of the AAAA answer caps the synthesized records,
+		// 600s without a SOA (RFC 6147 section 5.1.7)
+		ttlCap := uint32(600)
+		for _, rr := range resp.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				ttlCap = min(soa.Hdr.Ttl, soa.Minttl)
+			}
+		}
+		var answer []dns.RR
+		synthesized := false
+		for _, rr := range aRec.msg.Answer {
+			switch rr := rr.(type) {
+			case *dns.CNAME, *dns.DNAME:
+				answer = append(answer, rr)
+			case *dns.A:
+				synthesized = true
+				answer = append(answer, &dns.AAAA{
+					Hdr:  dns.RR_Header{Name: rr.Hdr.Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: min(rr.Hdr.Ttl, ttlCap)},
+					AAAA: dns64.embed(rr.A),
+				})
+			}
+		}
+		if !synthesized {
+			_ = w.WriteMsg(resp)
+			return
+		}
+		resp.Rcode = dns.RcodeSuccess
+		resp.Answer = answer
+		resp.Ns = nil
+		resp.Authoritative = false
+		_ = w.WriteMsg(resp)
+	}
+}
+
+// hasRealAAAA reports whether the answer has an AAAA outside ::ffff:0:0/96
+func hasRealAAAA(m *dns.Msg) bool {
+	for _, rr := range m.Answer {
+		if aaaa, ok := rr.(*dns.AAAA); ok && !mappedIPv4.Contains(aaaa.AAAA) {
+			return true
+		}
+	}
+	return false
+}
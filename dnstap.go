@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+// DnstapConfig configures the dnstap export of queries and responses
+type DnstapConfig struct {
+	Socket   string `yaml:"socket" json:"socket,omitempty"`     // unix socket path
+	Address  string `yaml:"address" json:"address,omitempty"`   // or host:port over TCP
+	Identity string `yaml:"identity" json:"identity,omitempty"` // defaults to the hostname
+}
+
+// dnstapSender sends dnstap frames to a collector (dnstap-read, Fluentd,
+// dnszeppelin...). Frames are dropped rather than slowing queries down when
+// the collector falls behind.
+type dnstapSender struct {
+	output   *dnstap.FrameStreamSockOutput
+	identity []byte
+	version  []byte
+	sent     atomic.Uint64
+	dropped  atomic.Uint64
+}
+
+// dnstapOut is nil when dnstap is disabled
+var dnstapOut *dnstapSender
+
+// dnstapLogger routes the connection errors of the output to slog
+type dnstapLogger struct{}
+
+func (dnstapLogger) Printf(format string, v ...any) {
+	slog.Warn("dnstap: " + fmt.Sprintf(format, v...))
+}
+
+// initDnstap starts the dnstap output if a socket or address is configured
+func initDnstap(cfg DnstapConfig) error {
+	var addr net.Addr
+	switch {
+	case cfg.Socket != "":
+		addr = &net.UnixAddr{Name: cfg.Socket, Net: "unix"}
+	case cfg.Address != "":
+		tcpAddr, err := net.ResolveTCPAddr("tcp", cfg.Address)
+		if err != nil {
+			return err
+		}
+		addr = tcpAddr
+	default:
+		return nil
+	}
+
+	output, err := dnstap.NewFrameStreamSockOutput(addr)
+	if err != nil {
+		return err
+	}
+	output.SetTimeout(5 * time.Second)
+	output.SetFlushTimeout(time.Second)
+	output.SetRetryInterval(5 * time.Second)
+	output.SetLogger(dnstapLogger{})
+	go output.RunOutputLoop()
+
+	identity := cfg.Identity
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+	dnstapOut = &dnstapSender{
+		output:   output,
+		identity: []byte(identity),
+		version:  []byte("simpledns " + version),
+	}
+	slog.Info("Sending dnstap", "address", addr.String())
+	return nil
+}
+
+// closeDnstap flushes pending frames on shutdown
+func closeDnstap() {
+	if dnstapOut != nil {
+		dnstapOut.output.Close()
+	}
+}
+
+// Stats returns the counters for the health endpoint (nil when disabled)
+func (d *dnstapSender) Stats() map[string]any {
+	if d == nil {
+		return nil
+	}
+	return map[string]any{
+		"sent":    d.sent.Load(),
+		"dropped": d.dropped.Load(),
+	}
+}
+
+// send queues one message without blocking
+func (d *dnstapSender) send(msg *dnstap.Message) {
+	frame, err := proto.Marshal(&dnstap.Dnstap{
+		Identity: d.identity,
+		Version:  d.version,
+		Type:     dnstap.Dnstap_MESSAGE.Enum(),
+		Message:  msg,
+	})
+	if err != nil {
+		return
+	}
+	select {
+	case d.output.GetOutputChannel() <- frame:
+		d.sent.Add(1)
+	default:
+		d.dropped.Add(1)
+	}
+}
+
+// dnstapMessage builds a message of type typ between the query initiator
+// and the responder (either may be nil)
+func dnstapMessage(typ dnstap.Message_Type, initiator, responder net.Addr, dm *dns.Msg, response bool) *dnstap.Message {
+	now := time.Now()
+	sec, nsec := uint64(now.Unix()), uint32(now.Nanosecond())
+	msg := &dnstap.Message{Type: typ.Enum()}
+
+	var packed []byte
+	if dm != nil {
+		packed, _ = dm.Pack()
+	}
+	if response {
+		msg.ResponseTimeSec, msg.ResponseTimeNsec, msg.ResponseMessage = &sec, &nsec, packed
+	} else {
+		msg.QueryTimeSec, msg.QueryTimeNsec, msg.QueryMessage = &sec, &nsec, packed
+	}
+
+	for i, addr := range []net.Addr{initiator, responder} {
+		var ip net.IP
+		var port int
+		protocol := dnstap.SocketProtocol_UDP
+		switch a := addr.(type) {
+		case *net.UDPAddr:
+			ip, port = a.IP, a.Port
+		case *net.TCPAddr:
+			ip, port, protocol = a.IP, a.Port, dnstap.SocketProtocol_TCP
+		default:
+			continue
+		}
+		family := dnstap.SocketFamily_INET6
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, family = ip4, dnstap.SocketFamily_INET
+		}
+		p := uint32(port)
+		msg.SocketFamily, msg.SocketProtocol = family.Enum(), protocol.Enum()
+		if i == 0 {
+			msg.QueryAddress, msg.QueryPort = ip, &p
+		} else {
+			msg.ResponseAddress, msg.ResponsePort = ip, &p
+		}
+	}
+	return msg
+}
+
+// dnstapWriter sends a CLIENT_RESPONSE for every reply written
+type dnstapWriter struct {
+	dns.ResponseWriter
+}
+
+func (d *dnstapWriter) WriteMsg(m *dns.Msg) error {
+	err := d.ResponseWriter.WriteMsg(m)
+	dnstapOut.send(dnstapMessage(dnstap.Message_CLIENT_RESPONSE, d.RemoteAddr(), d.LocalAddr(), m, true))
+	return err
+}
+
+// withDnstap wraps a DNS handler to send client queries and responses
+func withDnstap(next dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		if dnstapOut == nil {
+			next(w, r)
+			return
+		}
+		dnstapOut.send(dnstapMessage(dnstap.Message_CLIENT_QUERY, w.RemoteAddr(), w.LocalAddr(), r, false))
+		next(&dnstapWriter{ResponseWriter: w}, r)
+	}
+}
+
+// dnstapForward sends a FORWARDER_QUERY or FORWARDER_RESPONSE exchanged
+// with the upstream server at srv (host:port)
+func dnstapForward(srv string, m *dns.Msg, response bool) {
+	if dnstapOut == nil || m == nil {
+		return
+	}
+	var upstream net.Addr
+	if host, port, err := net.SplitHostPort(srv); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			p, _ := strconv.Atoi(port)
+			upstream = &net.UDPAddr{IP: ip, Port: p}
+		}
+	}
+	typ := dnstap.Message_FORWARDER_QUERY
+	if response {
+		typ = dnstap.Message_FORWARDER_RESPONSE
+	}
+	dnstapOut.send(dnstapMessage(typ, nil, upstream, m, response))
+}
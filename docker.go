@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DockerConfig configures the records of running Docker containers
+type DockerConfig struct {
+	Enabled  bool     `yaml:"enabled" json:"enabled,omitempty"`
+	Socket   string   `yaml:"socket" json:"socket,omitempty"`     // default /var/run/docker.sock
+	Zone     string   `yaml:"zone" json:"zone,omitempty"`         // default docker.local
+	Networks []string `yaml:"networks" json:"networks,omitempty"` // networks whose IPs are published, all when empty
+	TTL      int      `yaml:"ttl" json:"ttl,omitempty"`           // default 30
+}
+
+// dockerContainer is the part of GET /containers/json the integration uses
+type dockerContainer struct {
+	Names           []string `json:"Names"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress         string `json:"IPAddress"`
+			GlobalIPv6Address string `json:"GlobalIPv6Address"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// dockerClient talks to the Docker Engine API on its unix socket
+type dockerClient struct {
+	client *http.Client
+}
+
+func newDockerClient(socket string) *dockerClient {
+	return &dockerClient{client: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}}
+}
+
+func (d *dockerClient) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("docker: GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// containers lists the running containers
+func (d *dockerClient) containers(ctx context.Context) ([]dockerContainer, error) {
+	resp, err := d.get(ctx, "/containers/json")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var containers []dockerContainer
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("docker: %w", err)
+	}
+	return containers, nil
+}
+
+// waitEvent blocks until a container starts, stops or changes network
+func (d *dockerClient) waitEvent(ctx context.Context) error {
+	filters, _ := json.Marshal(map[string][]string{
+		"type":  {"container", "network"},
+		"event": {"start", "die", "destroy", "rename", "pause", "unpause", "connect", "disconnect"},
+	})
+	resp, err := d.get(ctx, "/events?filters="+url.QueryEscape(string(filters)))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	scanner := bufio.NewScanner(resp.Body)
+	if scanner.Scan() {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// dockerRecords returns the A and AAAA records of the containers on the
+// selected networks (all when networks is empty)
+func dockerRecords(zone string, ttl uint32, networks []string, containers []dockerContainer) []dns.RR {
+	selected := make(map[string]bool)
+	for _, n := range networks {
+		selected[n] = true
+	}
+	seen := make(map[string]bool)
+	var rrs []dns.RR
+	for _, c := range containers {
+		if len(c.Names) == 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(c.Names[0], "/")) + "." + zone
+		if _, ok := dns.IsDomainName(name); !ok {
+			continue
+		}
+		for network, settings := range c.NetworkSettings.Networks {
+			if len(selected) > 0 && !selected[network] {
+				continue
+			}
+			for _, addr := range []string{settings.IPAddress, settings.GlobalIPv6Address} {
+				ip := net.ParseIP(addr)
+				if ip == nil {
+					continue
+				}
+				var rr dns.RR
+				hdr := dns.RR_Header{Name: name, Class: dns.ClassINET, Ttl: ttl}
+				if ip4 := ip.To4(); ip4 != nil {
+					hdr.Rrtype = dns.TypeA
+					rr = &dns.A{Hdr: hdr, A: ip4}
+				} else {
+					hdr.Rrtype = dns.TypeAAAA
+					rr = &dns.AAAA{Hdr: hdr, AAAA: ip}
+				}
+				if key := rr.String(); !seen[key] {
+					seen[key] = true
+					rrs = append(rrs, rr)
+				}
+			}
+		}
+	}
+	sort.Slice(rrs, func(i, j int) bool { return rrs[i].String() < rrs[j].String() })
+	return rrs
+}
+
+// startDockerDiscovery publishes the running containers and follows the
+// Docker events
+func startDockerDiscovery(cfg DockerConfig) {
+	if !cfg.Enabled {
+		return
+	}
+	socket := cfg.Socket
+	if socket == "" {
+		socket = "/var/run/docker.sock"
+	}
+	zone := cfg.Zone
+	if zone == "" {
+		zone = "docker.local"
+	}
+	zone = strings.ToLower(dns.Fqdn(zone))
+	ttl := uint32(30)
+	if cfg.TTL > 0 {
+		ttl = uint32(cfg.TTL)
+	}
+	client := newDockerClient(socket)
+
+	slog.Info("Publishing Docker containers", "zone", zone, "socket", socket, "networks", cfg.Networks)
+	go func() {
+		for {
+			ctx, cancel := context.WithCancel(context.Background())
+			// Subscribe before listing so no change is missed in between
+			changed := make(chan error, 1)
+			go func() { changed <- client.waitEvent(ctx) }()
+
+			containers, err := client.containers(ctx)
+			if err == nil {
+				setDynamicRecords("docker", zone, dockerRecords(zone, ttl, cfg.Networks, containers))
+				err = <-changed
+			}
+			cancel()
+			if err != nil {
+				slog.Warn("docker discovery failed", "socket", socket, "error", err)
+				time.Sleep(10 * time.Second)
+				continue
+			}
+			// Let a burst of events (compose up) settle
+			time.Sleep(500 * time.Millisecond)
+		}
+	}()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// DNS over QUIC (RFC 9250, experimental): each query comes on its own
+// bidirectional stream, prefixed by its 2-byte length as over TCP, and
+// the answer is written back on the same stream.
+
+const (
+	doqALPN          = "doq"
+	doqIdleTimeout   = 30 * time.Second
+	doqStreamTimeout = 10 * time.Second
+
+	// Application error codes of RFC 9250 section 4.3
+	doqNoError       quic.ApplicationErrorCode = 0x0
+	doqProtocolError quic.ApplicationErrorCode = 0x2
+)
+
+// doqServer serves DNS queries received over QUIC
+type doqServer struct {
+	ln      *quic.Listener
+	handler dns.Handler
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// startDoQ listens for DoQ clients on addr (UDP) with the certificate of
+// the TLS listeners
+func startDoQ(addr string, handler dns.Handler) (*doqServer, error) {
+	tlsConf := serverTLSConfig()
+	tlsConf.MinVersion = tls.VersionTLS13
+	tlsConf.NextProtos = []string{doqALPN}
+	ln, err := quic.ListenAddr(addr, tlsConf, &quic.Config{MaxIdleTimeout: doqIdleTimeout})
+	if err != nil {
+		return nil, err
+	}
+	s := &doqServer{ln: ln, handler: handler}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	go s.serve()
+	return s, nil
+}
+
+// Close stops accepting connections and closes the open ones
+func (s *doqServer) Close() error {
+	s.cancel()
+	return s.ln.Close()
+}
+
+func (s *doqServer) serve() {
+	for {
+		conn, err := s.ln.Accept(s.ctx)
+		if err != nil {
+			if s.ctx.Err() == nil {
+				slog.Error("doq accept failed", "error", err)
+			}
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *doqServer) serveConn(conn *quic.Conn) {
+	for {
+		stream, err := conn.AcceptStream(s.ctx)
+		if err != nil {
+			_ = conn.CloseWithError(doqNoError, "")
+			return
+		}
+		go s.serveStream(conn, stream)
+	}
+}
+
+func (s *doqServer) serveStream(conn *quic.Conn, stream *quic.Stream) {
+	defer func() { _ = stream.Close() }()
+	_ = stream.SetDeadline(time.Now().Add(doqStreamTimeout))
+
+	var length uint16
+	if err := binary.Read(stream, binary.BigEndian, &length); err != nil {
+		slog.Debug("doq read failed", "client", conn.RemoteAddr(), "error", err)
+		return
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(stream, buf); err != nil {
+		slog.Debug("doq read failed", "client", conn.RemoteAddr(), "error", err)
+		return
+	}
+	req := new(dns.Msg)
+	if err := req.Unpack(buf); err != nil {
+		_ = conn.CloseWithError(doqProtocolError, "malformed query")
+		return
+	}
+	// The message ID is always 0 over DoQ
+	if req.Id != 0 {
+		_ = conn.CloseWithError(doqProtocolError, "message id must be 0")
+		return
+	}
+	s.handler.ServeDNS(&doqResponseWriter{conn: conn, stream: stream}, req)
+}
+
+// doqResponseWriter writes the answer to a query on its QUIC stream
+type doqResponseWriter struct {
+	conn   *quic.Conn
+	stream *quic.Stream
+}
+
+func (w *doqResponseWriter) LocalAddr() net.Addr  { return w.conn.LocalAddr() }
+func (w *doqResponseWriter) RemoteAddr() net.Addr { return w.conn.RemoteAddr() }
+
+func (w *doqResponseWriter) WriteMsg(m *dns.Msg) error {
+	m.Id = 0
+	buf, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+func (w *doqResponseWriter) Write(buf []byte) (int, error) {
+	if len(buf) > dns.MaxMsgSize {
+		return 0, errors.New("message too large")
+	}
+	out := make([]byte, 2+len(buf))
+	binary.BigEndian.PutUint16(out, uint16(len(buf)))
+	copy(out[2:], buf)
+	if _, err := w.stream.Write(out); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+func (w *doqResponseWriter) Close() error        { return w.stream.Close() }
+func (w *doqResponseWriter) TsigStatus() error   { return nil }
+func (w *doqResponseWriter) TsigTimersOnly(bool) {}
+func (w *doqResponseWriter) Hijack()             {}
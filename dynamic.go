@@ -0,0 +1,125 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// dynamicZone is a set of records published by an integration (Kubernetes,
+// Docker...) under one zone
+type dynamicZone struct {
+	zone   string // FQDN
+	rrs    []dns.RR
+	key    string // the records in presentation form, to detect changes
+	serial uint32
+}
+
+// dynamicZones holds the records of every integration by source name. They
+// are merged into each zone snapshot, so they survive reloads from the
+// database, the zone files or the KV backend.
+var dynamicZones struct {
+	sync.Mutex
+	sources map[string]*dynamicZone
+}
+
+// setDynamicRecords replaces the records published by source under zone and
+// reloads the zones if they changed
+func setDynamicRecords(source, zone string, rrs []dns.RR) {
+	zone = strings.ToLower(dns.Fqdn(zone))
+	lines := make([]string, len(rrs))
+	for i, rr := range rrs {
+		lines[i] = rr.String()
+	}
+	sort.Strings(lines)
+	key := strings.Join(lines, "\n")
+
+	dynamicZones.Lock()
+	if dynamicZones.sources == nil {
+		dynamicZones.sources = make(map[string]*dynamicZone)
+	}
+	dz := dynamicZones.sources[source]
+	if dz != nil && dz.zone == zone && dz.key == key {
+		dynamicZones.Unlock()
+		return
+	}
+	// Start from the clock so a restart does not go backwards
+	serial := uint32(time.Now().Unix())
+	if dz != nil && !serialNewer(serial, dz.serial) {
+		serial = dz.serial + 1
+	}
+	dynamicZones.sources[source] = &dynamicZone{zone: zone, rrs: rrs, key: key, serial: serial}
+	dynamicZones.Unlock()
+
+	if err := reloadZones(); err != nil {
+		slog.Error("failed to reload zones", "source", source, "error", err)
+		return
+	}
+	slog.Info("Published dynamic records", "source", source, "zone", zone, "records", len(rrs))
+}
+
+// addDynamicZones adds the integration records to the snapshot. A zone
+// that is not served otherwise gets a generated SOA and NS.
+func addDynamicZones(zd *ZoneData) {
+	dynamicZones.Lock()
+	defer dynamicZones.Unlock()
+
+	names := make([]string, 0, len(dynamicZones.sources))
+	for name := range dynamicZones.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	created := make(map[string]bool)
+	for _, name := range names {
+		dz := dynamicZones.sources[name]
+		if zd.FindZone(dz.zone) != dz.zone && !created[dz.zone] {
+			zd.AddZone(dz.zone)
+			zd.AddRR(&dns.SOA{
+				Hdr:     dns.RR_Header{Name: dz.zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 60},
+				Ns:      "ns1." + dz.zone,
+				Mbox:    "hostmaster." + dz.zone,
+				Serial:  dz.serial,
+				Refresh: 3600,
+				Retry:   600,
+				Expire:  86400,
+				Minttl:  60,
+			})
+			zd.AddRR(&dns.NS{Hdr: dns.RR_Header{Name: dz.zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 60}, Ns: "ns1." + dz.zone})
+			created[dz.zone] = true
+		}
+		for _, rr := range dz.rrs {
+			zd.AddRR(rr)
+		}
+	}
+}
+
+// reloadZones rebuilds the live zones from their source
+func reloadZones() error {
+	switch dbMode {
+	case "sqlite":
+		if database == nil {
+			return nil
+		}
+		return LoadZonesFromDB()
+	case "kv":
+		return zoneStore.Rebuild(func() (*ZoneData, error) {
+			zd, _, err := buildZonesFromKVSource()
+			return zd, err
+		})
+	case "git":
+		return zoneStore.Rebuild(func() (*ZoneData, error) {
+			zd, _, err := buildZonesFromGitSource()
+			return zd, err
+		})
+	default:
+		if loadedZonesDir == "" {
+			zoneStore.Replace(buildDefaultZones())
+			return nil
+		}
+		return loadZonesFromDir(loadedZonesDir)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setETag serves the version of a zone or record as its ETag
+func setETag(c *gin.Context, version int64) {
+	c.Header("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+}
+
+// checkIfMatch enforces the If-Match header of an update against the
+// current version, so an edit based on a stale read does not overwrite
+// another one. It returns the version the update must still find, 0 for
+// If-Match: *, and false after answering 428 or 412.
+func checkIfMatch(c *gin.Context, current int64) (int64, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match is required: send the ETag of the last read, or * to overwrite"})
+		return 0, false
+	}
+	if header == "*" {
+		return 0, true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(tag), "W/"), `"`)
+		if v, err := strconv.ParseInt(tag, 10, 64); err == nil && v == current {
+			return current, true
+		}
+	}
+	versionConflict(c, current)
+	return 0, false
+}
+
+// versionConflict answers an update based on a stale version
+func versionConflict(c *gin.Context, current int64) {
+	setETag(c, current)
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": "modified by someone else since it was read, reload and retry", "version": current})
+}
+
+// recordConflict answers an update that lost the race with another one
+func recordConflict(c *gin.Context, id int64) {
+	current, err := database.GetRecord(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "record not found"})
+		return
+	}
+	versionConflict(c, current.Version)
+}
+
+// zoneConflict answers an update that lost the race with another one
+func zoneConflict(c *gin.Context, id int64) {
+	current, err := database.GetZone(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	versionConflict(c, current.Version)
+}
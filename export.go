@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// ZoneExport is the canonical form of a zone, for Git and configuration
+// management: records sorted and normalized, without the ids, versions and
+// serial that change when nothing was edited
+type ZoneExport struct {
+	Name          string             `json:"name" yaml:"name"`
+	Type          string             `json:"type" yaml:"type"`
+	Enabled       bool               `json:"enabled" yaml:"enabled"`
+	TTL           int                `json:"ttl" yaml:"ttl"`
+	SOA           *ZoneExportSOA     `json:"soa,omitempty" yaml:"soa,omitempty"`
+	NSAddress     []string           `json:"ns_address,omitempty" yaml:"ns_address,omitempty"`
+	Forwarders    []string           `json:"forwarders,omitempty" yaml:"forwarders,omitempty"`
+	Primaries     []string           `json:"primaries,omitempty" yaml:"primaries,omitempty"`
+	AddressFilter string             `json:"address_filter,omitempty" yaml:"address_filter,omitempty"`
+	Records       []ZoneExportRecord `json:"records" yaml:"records"`
+}
+
+// ZoneExportSOA is the SOA of an exported zone, without the serial bumped
+// by every change
+type ZoneExportSOA struct {
+	NS      string `json:"ns" yaml:"ns"`
+	Admin   string `json:"admin" yaml:"admin"`
+	Refresh int    `json:"refresh" yaml:"refresh"`
+	Retry   int    `json:"retry" yaml:"retry"`
+	Expire  int    `json:"expire" yaml:"expire"`
+	Minimum int    `json:"minimum" yaml:"minimum"`
+}
+
+// ZoneExportRecord is one record of an exported zone, its name relative to
+// the zone ("@" for the apex) and its value in presentation format
+type ZoneExportRecord struct {
+	Name       string     `json:"name" yaml:"name"`
+	Type       string     `json:"type" yaml:"type"`
+	TTL        int        `json:"ttl" yaml:"ttl"`
+	Value      string     `json:"value" yaml:"value"`
+	ActivateAt *time.Time `json:"activate_at,omitempty" yaml:"activate_at,omitempty"`
+	ExpireAt   *time.Time `json:"expire_at,omitempty" yaml:"expire_at,omitempty"`
+	Comment    string     `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Tags       []string   `json:"tags,omitempty" yaml:"tags,omitempty"`
+	NoCache    bool       `json:"no_cache,omitempty" yaml:"no_cache,omitempty"`
+}
+
+// canonicalRecord normalizes a record the way it is served: lower case
+// name relative to the zone and the rdata as printed by the DNS library.
+// A record that does not parse is kept as stored.
+func canonicalRecord(zoneName string, r DBRecord) DBRecord {
+	rr, err := recordToRR(zoneName, r)
+	if err != nil {
+		return r
+	}
+	canon := rrToRecord(zoneName, rr)
+	canon.Name = strings.ToLower(canon.Name)
+	canon.TTL = r.TTL
+	canon.RecordSchedule = r.RecordSchedule
+	canon.Comment = r.Comment
+	canon.Tags = slices.Sorted(slices.Values(r.Tags))
+	canon.RecordCaching = r.RecordCaching
+	return canon
+}
+
+// sortedList splits a comma-separated setting into its sorted entries
+func sortedList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// canonicalNameLess orders names relative to a zone in DNS canonical order
+// (RFC 4034 section 6.1): the apex first, then by label from the right, so
+// the names of a subdomain stay together
+func canonicalNameLess(a, b string) bool {
+	labels := func(name string) []string {
+		if name == "@" {
+			return nil
+		}
+		l := dns.SplitDomainName(name)
+		slices.Reverse(l)
+		return l
+	}
+	return slices.Compare(labels(a), labels(b)) < 0
+}
+
+// sortCanonical sorts records by name, type and value
+func sortCanonical(records []DBRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Name != b.Name {
+			return canonicalNameLess(a.Name, b.Name)
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Value < b.Value
+	})
+}
+
+// zoneExport builds the canonical form of a zone and its records
+func zoneExport(zone *DBZone, records []DBRecord) ZoneExport {
+	zoneName := dns.Fqdn(zone.Name)
+	out := ZoneExport{
+		Name:          strings.ToLower(zoneName),
+		Type:          zone.Type,
+		Enabled:       zone.Enabled,
+		TTL:           zone.TTL,
+		AddressFilter: zone.AddressFilter,
+		Records:       []ZoneExportRecord{},
+	}
+	if zone.Type == zoneTypeForward {
+		// The order of the forwarders matters, they are asked in turn
+		for _, f := range strings.Split(zone.Forwarders, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				out.Forwarders = append(out.Forwarders, f)
+			}
+		}
+		return out
+	}
+	if zone.Type == zoneTypeSecondary {
+		// The records of a secondary zone belong to its primaries
+		for _, p := range strings.Split(zone.Primaries, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				out.Primaries = append(out.Primaries, p)
+			}
+		}
+		return out
+	}
+
+	out.SOA = &ZoneExportSOA{
+		NS:      qualifyName(zone.NS, zoneName),
+		Admin:   soaMailbox(zone.Admin, zoneName),
+		Refresh: zone.Refresh,
+		Retry:   zone.Retry,
+		Expire:  zone.Expire,
+		Minimum: zone.Minimum,
+	}
+	out.NSAddress = sortedList(zone.NSAddress)
+
+	canon := make([]DBRecord, 0, len(records))
+	for _, r := range records {
+		canon = append(canon, canonicalRecord(zoneName, r))
+	}
+	sortCanonical(canon)
+	for _, r := range canon {
+		out.Records = append(out.Records, ZoneExportRecord{
+			Name:       r.Name,
+			Type:       r.Type,
+			TTL:        r.TTL,
+			Value:      r.Value,
+			ActivateAt: utcTime(r.ActivateAt),
+			ExpireAt:   utcTime(r.ExpireAt),
+			Comment:    r.Comment,
+			Tags:       r.Tags,
+			NoCache:    r.NoCache,
+		})
+	}
+	return out
+}
+
+// utcTime returns t in UTC, so the export does not depend on the time zone
+// of the server
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// zoneExportBind renders a zone as a master file loadable by BIND or
+// NSD: the SOA and apex NS from the zone settings, then the records in
+// canonical order with their schedule and notes as comments
+func zoneExportBind(zone *DBZone, records []DBRecord) string {
+	apex := *zone
+	apex.Name = strings.ToLower(zone.Name)
+	apex.NSAddress = strings.Join(sortedList(zone.NSAddress), ",")
+	zoneName := dns.Fqdn(apex.Name)
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ORIGIN %s\n$TTL %d\n", zoneName, zone.TTL)
+	for _, rr := range zoneApexRRs(apex) {
+		b.WriteString(rr.String())
+		b.WriteByte('\n')
+	}
+	canon := make([]DBRecord, 0, len(records))
+	for _, r := range records {
+		canon = append(canon, canonicalRecord(zoneName, r))
+	}
+	sortCanonical(canon)
+	for _, r := range canon {
+		b.WriteString(recordLine(zoneName, r))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// handleAPIExportZone handles GET /api/zones/:id/export?format=json|yaml|bind,
+// the zone in a stable form meant to be stored in Git and diffed
+func handleAPIExportZone(c *gin.Context) {
+	zoneID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone id"})
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "yaml" && format != "bind" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format, use json, yaml or bind"})
+		return
+	}
+	zone, err := database.GetZone(zoneID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	var records []DBRecord
+	if zoneRecordsError(zone) == "" {
+		if records, err = database.ListRecordsByZone(zoneID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list records"})
+			return
+		}
+	}
+
+	filename := strings.TrimSuffix(strings.ToLower(zone.Name), ".")
+	switch format {
+	case "bind":
+		if msg := zoneRecordsError(zone); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.zone"`)
+		c.Data(http.StatusOK, "text/dns; charset=utf-8", []byte(zoneExportBind(zone, records)))
+	case "yaml":
+		data, err := yaml.Marshal(zoneExport(zone, records))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.yaml"`)
+		c.Data(http.StatusOK, "application/yaml; charset=utf-8", data)
+	default:
+		data, err := json.MarshalIndent(zoneExport(zone, records), "", "  ")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		c.Data(http.StatusOK, "application/json; charset=utf-8", append(data, '\n'))
+	}
+}
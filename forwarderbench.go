@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// The forwarder benchmark asks the configured forwarders and candidate
+// servers the same names, and ranks them by failure rate, then latency. It
+// also checks that they validate DNSSEC and follow the EDNS rules, so the
+// fastest servers are not adopted at the cost of either.
+
+// benchmarkNames are the names asked by default: popular ones, so the
+// answers come from the cache of the servers, some of them signed
+var benchmarkNames = []string{"example.com.", "wikipedia.org.", "github.com.", "cloudflare.com.", "ietf.org."}
+
+// benchmarkCandidates are the public resolvers suggested as candidates
+var benchmarkCandidates = []string{"1.1.1.1:53", "8.8.8.8:53", "9.9.9.9:53", "208.67.222.222:53"}
+
+const (
+	// benchmarkMaxServers bounds the servers benchmarked at once
+	benchmarkMaxServers = 16
+	// benchmarkMaxNames bounds the names asked
+	benchmarkMaxNames = 10
+	// defaultBenchmarkRounds is the number of times each name is asked
+	defaultBenchmarkRounds = 3
+	maxBenchmarkRounds     = 10
+)
+
+// DNSSEC support found by the benchmark
+const (
+	dnssecValidates = "validates" // sets AD on signed answers
+	dnssecPasses    = "passes"    // returns the signatures without validating
+	dnssecNone      = "none"
+)
+
+// BenchmarkForwardersRequest lists the servers to benchmark besides the
+// configured forwarders, and the names to ask (default benchmarkNames)
+type BenchmarkForwardersRequest struct {
+	Candidates []string `json:"candidates"`
+	Names      []string `json:"names"`
+	Rounds     int      `json:"rounds"`
+}
+
+// ForwarderBenchmark is the result of one server, Rank 1 being the best
+type ForwarderBenchmark struct {
+	Rank        int     `json:"rank"`
+	Address     string  `json:"address"`
+	Configured  bool    `json:"configured"`
+	Queries     int     `json:"queries"`
+	Failures    int     `json:"failures"`
+	FailureRate float64 `json:"failure_rate"`         // percent of the queries
+	LatencyMS   float64 `json:"latency_ms,omitempty"` // median of the answers
+	MaxMS       float64 `json:"max_ms,omitempty"`
+	DNSSEC      string  `json:"dnssec"`
+	EDNS        bool    `json:"edns"` // false as well when unknown
+	// EDNSIssue tells why the server does not follow the EDNS rules
+	EDNSIssue string `json:"edns_issue,omitempty"`
+	Error     string `json:"error,omitempty"` // last failure
+}
+
+// healthy reports whether the server can be adopted: it answered every
+// query and follows the EDNS rules
+func (b ForwarderBenchmark) healthy() bool {
+	return b.Failures == 0 && b.EDNS
+}
+
+// BenchmarkForwardersResult ranks the servers benchmarked. Recommended is
+// the fastest healthy set, as many servers as configured (at least 2).
+type BenchmarkForwardersResult struct {
+	Names       []string             `json:"names"`
+	Rounds      int                  `json:"rounds"`
+	Results     []ForwarderBenchmark `json:"results"`
+	Recommended []string             `json:"recommended"`
+}
+
+// benchmarkForwarder asks srv each name rounds times, then checks EDNS
+// versioning
+func benchmarkForwarder(ctx context.Context, srv string, names []string, rounds int) ForwarderBenchmark {
+	b := ForwarderBenchmark{Address: srv, DNSSEC: dnssecNone}
+	client := forwardClient(upstreamOptionsFor(srv).timeout())
+	var rtts []time.Duration
+	for round := range rounds {
+		for _, name := range names {
+			if ctx.Err() != nil {
+				b.Error = ctx.Err().Error()
+				return b
+			}
+			msg := new(dns.Msg)
+			msg.SetQuestion(name, dns.TypeA)
+			msg.SetEdns0(dns.DefaultMsgSize, true)
+			b.Queries++
+			resp, rtt, err := client.ExchangeContext(ctx, msg, srv)
+			if err == nil && resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+				err = fmt.Errorf("%s for %s", dns.RcodeToString[resp.Rcode], name)
+			}
+			if err != nil {
+				b.Failures++
+				b.Error = err.Error()
+				continue
+			}
+			// The first round fills the cache of the server
+			if round > 0 || rounds == 1 {
+				rtts = append(rtts, rtt)
+			}
+			if resp.IsEdns0() == nil {
+				b.EDNSIssue = "no OPT record in the responses"
+			}
+			switch {
+			case resp.AuthenticatedData:
+				b.DNSSEC = dnssecValidates
+			case b.DNSSEC == dnssecNone && hasRRSIG(resp.Answer):
+				b.DNSSEC = dnssecPasses
+			}
+		}
+	}
+	if b.Queries > 0 {
+		b.FailureRate = float64(b.Failures) * 100 / float64(b.Queries)
+	}
+	if len(rtts) > 0 {
+		slices.Sort(rtts)
+		b.LatencyMS = float64(rtts[len(rtts)/2].Microseconds()) / 1000
+		b.MaxMS = float64(rtts[len(rtts)-1].Microseconds()) / 1000
+	}
+	// EDNS is unknown when the server never answered
+	if b.EDNSIssue == "" && b.Failures < b.Queries {
+		b.EDNSIssue = ednsVersionIssue(ctx, client, srv, names[0])
+		b.EDNS = b.EDNSIssue == ""
+	}
+	return b
+}
+
+// ednsVersionIssue sends an EDNS version 1 query, which a server following
+// RFC 6891 answers with BADVERS and its own version 0
+func ednsVersionIssue(ctx context.Context, client sourcePortClient, srv, name string) string {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, dns.TypeA)
+	msg.SetEdns0(dns.DefaultMsgSize, false)
+	msg.IsEdns0().SetVersion(1)
+	resp, _, err := client.ExchangeContext(ctx, msg, srv)
+	switch {
+	case err != nil:
+		return "no response to an EDNS version 1 query"
+	case resp.Rcode != dns.RcodeBadVers:
+		return fmt.Sprintf("EDNS version 1 answered %s instead of BADVERS", dns.RcodeToString[resp.Rcode])
+	case resp.IsEdns0() == nil || resp.IsEdns0().Version() != 0:
+		return "BADVERS without an EDNS version 0 OPT record"
+	}
+	return ""
+}
+
+func hasRRSIG(rrs []dns.RR) bool {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeRRSIG {
+			return true
+		}
+	}
+	return false
+}
+
+// rankBenchmarks sorts results by failure rate, then latency, and numbers
+// them
+func rankBenchmarks(results []ForwarderBenchmark) {
+	slices.SortStableFunc(results, func(a, b ForwarderBenchmark) int {
+		switch {
+		case a.FailureRate != b.FailureRate:
+			if a.FailureRate < b.FailureRate {
+				return -1
+			}
+			return 1
+		case a.EDNS != b.EDNS:
+			if a.EDNS {
+				return -1
+			}
+			return 1
+		case a.LatencyMS < b.LatencyMS:
+			return -1
+		case a.LatencyMS > b.LatencyMS:
+			return 1
+		}
+		return 0
+	})
+	for i := range results {
+		results[i].Rank = i + 1
+	}
+}
+
+// runForwarderBenchmark benchmarks the configured forwarders and the
+// candidates concurrently
+func runForwarderBenchmark(ctx context.Context, candidates, names []string, rounds int) BenchmarkForwardersResult {
+	var servers []string
+	forwarders := currentForwarders()
+	configured := make(map[string]bool)
+	for _, f := range forwarders {
+		configured[f] = true
+		servers = append(servers, f)
+	}
+	for _, c := range candidates {
+		if !slices.Contains(servers, c) {
+			servers = append(servers, c)
+		}
+	}
+	if len(servers) > benchmarkMaxServers {
+		servers = servers[:benchmarkMaxServers]
+	}
+
+	results := make([]ForwarderBenchmark, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = benchmarkForwarder(ctx, srv, names, rounds)
+			results[i].Configured = configured[srv]
+		}()
+	}
+	wg.Wait()
+	rankBenchmarks(results)
+
+	want := max(len(forwarders), 2)
+	recommended := []string{}
+	for _, r := range results {
+		if r.healthy() && len(recommended) < want {
+			recommended = append(recommended, r.Address)
+		}
+	}
+	return BenchmarkForwardersResult{Names: names, Rounds: rounds, Results: results, Recommended: recommended}
+}
+
+// handleAPIBenchmarkForwarders handles POST /api/forwarders/benchmark
+func handleAPIBenchmarkForwarders(c *gin.Context) {
+	var req BenchmarkForwardersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var candidates []string
+	for _, s := range req.Candidates {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		addrs, err := parseZoneForwarders(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		candidates = append(candidates, addrs...)
+	}
+	names := benchmarkNames
+	if len(req.Names) > 0 {
+		if len(req.Names) > benchmarkMaxNames {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d names", benchmarkMaxNames)})
+			return
+		}
+		names = nil
+		for _, n := range req.Names {
+			if _, ok := dns.IsDomainName(n); !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid name %q", n)})
+				return
+			}
+			names = append(names, dns.Fqdn(n))
+		}
+	}
+	rounds := defaultBenchmarkRounds
+	if req.Rounds != 0 {
+		if req.Rounds < 1 || req.Rounds > maxBenchmarkRounds {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("rounds must be between 1 and %d", maxBenchmarkRounds)})
+			return
+		}
+		rounds = req.Rounds
+	}
+	if len(currentForwarders()) == 0 && len(candidates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no forwarder configured and no candidate given"})
+		return
+	}
+
+	result := runForwarderBenchmark(c.Request.Context(), candidates, names, rounds)
+	slog.Info("Forwarders benchmarked", "servers", len(result.Results), "recommended", result.Recommended)
+	c.JSON(http.StatusOK, result)
+}
+
+// ReplaceForwardersRequest lists the addresses of the new forwarders, the
+// first one asked first
+type ReplaceForwardersRequest struct {
+	Addresses []string `json:"addresses" binding:"required"`
+}
+
+// handleAPIReplaceForwarders handles PUT /api/forwarders: the forwarders
+// become the addresses given, with the priorities 0, 1, 2... Forwarders
+// kept keep their options.
+func handleAPIReplaceForwarders(c *gin.Context) {
+	var req ReplaceForwardersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Addresses) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one address is needed"})
+		return
+	}
+	addrs, err := parseZoneForwarders(strings.Join(req.Addresses, ","))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	current, err := database.ListForwarders()
+	if err != nil {
+		slog.Error("failed to list forwarders", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to replace forwarders"})
+		return
+	}
+	list := make([]DBForwarder, 0, len(addrs))
+	for _, addr := range addrs {
+		if slices.ContainsFunc(list, func(f DBForwarder) bool { return f.Address == addr }) {
+			continue
+		}
+		f := DBForwarder{Address: addr, Priority: len(list)}
+		for _, cur := range current {
+			if cur.Address == addr {
+				f.UpstreamOptions = cur.UpstreamOptions
+			}
+		}
+		list = append(list, f)
+	}
+	if err := database.ReplaceForwarders(list); err != nil {
+		slog.Error("failed to replace forwarders", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to replace forwarders"})
+		return
+	}
+
+	// Reload forwarders into memory
+	if err := LoadForwardersFromDB(); err != nil {
+		slog.Error("failed to reload forwarders", "error", err)
+	}
+
+	slog.Info("Forwarders replaced", "addresses", addrs)
+	list, err = database.ListForwarders()
+	if err != nil {
+		slog.Error("failed to list forwarders", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list forwarders"})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
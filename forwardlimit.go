@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// forwardLimiter caps the number of upstream queries in flight. Queries
+// beyond the cap wait in a bounded queue; once the queue is full they are
+// rejected immediately so a burst of cache misses cannot pile up goroutines
+// and sockets toward the upstreams.
+type forwardLimiter struct {
+	slots    chan struct{}
+	maxQueue int64
+
+	queued   atomic.Int64
+	rejected atomic.Uint64
+}
+
+// Defaults for forward_max_inflight and forward_max_queue
+const (
+	defaultForwardMaxInflight = 256
+	defaultForwardMaxQueue    = 1024
+)
+
+var forwardLimit = newForwardLimiter(defaultForwardMaxInflight, defaultForwardMaxQueue)
+
+func newForwardLimiter(maxInflight, maxQueue int) *forwardLimiter {
+	return &forwardLimiter{slots: make(chan struct{}, maxInflight), maxQueue: int64(maxQueue)}
+}
+
+// Acquire takes an in-flight slot, waiting in the queue until ctx expires.
+// It returns false when the queue is full or ctx expired first.
+func (l *forwardLimiter) Acquire(ctx context.Context) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if l.queued.Add(1) > l.maxQueue {
+		l.queued.Add(-1)
+		l.rejected.Add(1)
+		return false
+	}
+	defer l.queued.Add(-1)
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		l.rejected.Add(1)
+		return false
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (l *forwardLimiter) Release() {
+	<-l.slots
+}
+
+// Stats returns limiter counters for /api/health
+func (l *forwardLimiter) Stats() map[string]any {
+	return map[string]any{
+		"in_flight":    len(l.slots),
+		"max_inflight": cap(l.slots),
+		"queued":       l.queued.Load(),
+		"rejected":     l.rejected.Load(),
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ForwardSecurityConfig hardens the forwarded queries against spoofed
+// responses poisoning the cache, and limits what they tell the upstreams
+// about the clients
+type ForwardSecurityConfig struct {
+	// CaseRandomization mixes the case of the name of each forwarded query
+	// (DNS 0x20) and drops the responses that do not echo it exactly
+	CaseRandomization bool `yaml:"case_randomization" json:"case_randomization,omitempty"`
+	// SourcePorts is the range the source port of each forwarded query is
+	// drawn from, e.g. "10000-65000"; the operating system picks an
+	// ephemeral port when empty
+	SourcePorts string `yaml:"source_ports" json:"source_ports,omitempty"`
+	// StripClientData sends the upstreams only the question, the DO bit
+	// and the UDP size of a query: the client subnet (ECS) and the other
+	// EDNS options of the client are not forwarded
+	StripClientData bool `yaml:"strip_client_data" json:"strip_client_data,omitempty"`
+}
+
+var (
+	// forwardCaseRandomization enables DNS 0x20 on forwarded queries
+	forwardCaseRandomization bool
+	// forwardPortMin and forwardPortMax bound the source port of the
+	// forwarded queries, 0 to let the operating system pick it
+	forwardPortMin, forwardPortMax int
+	// forwardStripClientData minimizes the forwarded queries
+	forwardStripClientData bool
+)
+
+func initForwardSecurity(cfg ForwardSecurityConfig) error {
+	forwardCaseRandomization = cfg.CaseRandomization
+	forwardStripClientData = cfg.StripClientData
+	lo, hi, err := parsePortRange(cfg.SourcePorts)
+	if err != nil {
+		return err
+	}
+	forwardPortMin, forwardPortMax = lo, hi
+	return nil
+}
+
+// parsePortRange parses "lo-hi", 0 0 when empty
+func parsePortRange(s string) (int, int, error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	loStr, hiStr, ok := strings.Cut(s, "-")
+	lo, err1 := strconv.Atoi(strings.TrimSpace(loStr))
+	hi, err2 := strconv.Atoi(strings.TrimSpace(hiStr))
+	if !ok || err1 != nil || err2 != nil || lo < 1024 || hi > 65535 || lo > hi {
+		return 0, 0, fmt.Errorf("invalid source_ports %q, expected a range such as 10000-65000 above 1023", s)
+	}
+	return lo, hi, nil
+}
+
+// randomizeCase returns name with the case of each letter picked at random
+func randomizeCase(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			if rand.IntN(2) == 0 {
+				b[i] = c | 0x20
+			} else {
+				b[i] = c &^ 0x20
+			}
+		}
+	}
+	return string(b)
+}
+
+// minimizeQuery strips a forwarded query down to what the upstream needs
+// to answer: the question, the RD and CD bits and an OPT record with the
+// DO bit, without the client subnet (RFC 7871) or the other options
+func minimizeQuery(m *dns.Msg) {
+	opt := m.IsEdns0()
+	m.Answer, m.Ns, m.Extra = nil, nil, nil
+	m.AuthenticatedData = false
+	if opt != nil {
+		m.SetEdns0(opt.UDPSize(), opt.Do())
+	}
+}
+
+// forwardBindAttempts is how many random ports of source_ports a forwarded
+// query tries before letting the system pick one
+const forwardBindAttempts = 4
+
+// sourcePortClient sends forwarded queries over UDP from a random port of
+// source_ports
+type sourcePortClient struct {
+	*dns.Client
+}
+
+// forwardClient returns the client sending one forwarded query, bound to a
+// random port of source_ports when it is set
+func forwardClient(timeout time.Duration) sourcePortClient {
+	return sourcePortClient{&dns.Client{Timeout: timeout}}
+}
+
+// ExchangeContext sends m to srv. Over UDP with source_ports set, a port
+// that cannot be bound (in use by another socket) is replaced by another
+// random one, and after forwardBindAttempts by one the system picks.
+func (c sourcePortClient) ExchangeContext(ctx context.Context, m *dns.Msg, srv string) (*dns.Msg, time.Duration, error) {
+	if forwardPortMax == 0 || (c.Net != "" && c.Net != "udp") {
+		return c.Client.ExchangeContext(ctx, m, srv)
+	}
+	var conn *dns.Conn
+	var err error
+	for attempt := 0; attempt <= forwardBindAttempts; attempt++ {
+		dialer := &net.Dialer{Timeout: c.Timeout}
+		if attempt < forwardBindAttempts {
+			port := forwardPortMin + rand.IntN(forwardPortMax-forwardPortMin+1)
+			dialer.LocalAddr = &net.UDPAddr{Port: port}
+		}
+		client := *c.Client
+		client.Dialer = dialer
+		if conn, err = client.DialContext(ctx, srv); err == nil {
+			break
+		}
+		slog.Debug("failed to bind a forwarding source port", "server", srv, "local", dialer.LocalAddr, "error", err)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = conn.Close() }()
+	return c.ExchangeWithConnContext(ctx, m, conn)
+}
+
+// restoreQuestion gives resp the question of the client, and its case to
+// the records owned by the name sent with its case randomized
+func restoreQuestion(resp *dns.Msg, query *dns.Msg, sent string) {
+	orig := query.Question[0].Name
+	resp.Question = query.Question
+	if orig == sent {
+		return
+	}
+	for _, section := range [][]dns.RR{resp.Answer, resp.Ns} {
+		for _, rr := range section {
+			if h := rr.Header(); h.Name == sent {
+				h.Name = orig
+			}
+		}
+	}
+}
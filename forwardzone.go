@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Zone types: a primary zone is answered from its records, the names of a
+// forward zone are always sent to the forwarders of the zone, a secondary
+// zone is answered from the copy transferred from its primaries
+const (
+	zoneTypePrimary   = "primary"
+	zoneTypeForward   = "forward"
+	zoneTypeSecondary = "secondary"
+)
+
+// zoneRecordsError is the reason the records of zone cannot be changed,
+// empty when they can
+func zoneRecordsError(zone *DBZone) string {
+	switch zone.Type {
+	case zoneTypeForward:
+		return "forward zones have no records"
+	case zoneTypeSecondary:
+		return "secondary zones are read-only, their records come from the primary"
+	}
+	return ""
+}
+
+// parseZoneForwarders parses the comma-separated forwarders of a forward
+// zone (host[:port], default port 53)
+func parseZoneForwarders(s string) ([]string, error) {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		// A bare IPv6 address has colons but no port
+		if ip := net.ParseIP(strings.Trim(p, "[]")); ip != nil {
+			p = net.JoinHostPort(ip.String(), "53")
+		} else if !strings.Contains(p, ":") {
+			p += ":53"
+		}
+		if _, _, err := net.SplitHostPort(p); err != nil {
+			return nil, fmt.Errorf("invalid forwarder %q", p)
+		}
+		out = append(out, p)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("a forward zone needs at least one forwarder")
+	}
+	return out, nil
+}
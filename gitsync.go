@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// GitConfig configures the zones synced from a Git repository (db_type:
+// git). The repository holds YAML zone files (see YAML_FORMAT.md) and BIND
+// master files named <zone>.zone; a commit is only served when all of its
+// zones load and pass the zone checks.
+type GitConfig struct {
+	URL      string `yaml:"url" json:"url,omitempty"`           // https, ssh or local path
+	Branch   string `yaml:"branch" json:"branch,omitempty"`     // default main
+	Path     string `yaml:"path" json:"path,omitempty"`         // directory of the zone files in the repository
+	Checkout string `yaml:"checkout" json:"checkout,omitempty"` // local clone, default git-zones
+	// IntervalSec is how often the repository is pulled, default 60
+	IntervalSec int `yaml:"interval_seconds" json:"interval_seconds,omitempty"`
+	// SSHKey is the private key file of ssh:// and git@ URLs
+	SSHKey string `yaml:"ssh_key" json:"ssh_key,omitempty"`
+}
+
+// gitCommandTimeout bounds one git command
+const gitCommandTimeout = 2 * time.Minute
+
+// GitSyncStatus is the state of the Git sync, shown in /api/health
+type GitSyncStatus struct {
+	URL      string     `json:"url"`
+	Branch   string     `json:"branch"`
+	Commit   string     `json:"commit,omitempty"` // commit served
+	SyncedAt *time.Time `json:"synced_at,omitempty"`
+	// FetchedAt is the last time the branch was fetched
+	FetchedAt *time.Time `json:"fetched_at,omitempty"`
+	// Rejected is the last commit fetched that was not applied, and Error
+	// why, or the last failure to pull
+	Rejected string `json:"rejected,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+var (
+	gitStatus   *GitSyncStatus
+	gitStatusMu sync.RWMutex
+
+	// gitCheckoutMu is held while the checkout changes commit, so the
+	// verification never reads a half-applied tree
+	gitCheckoutMu sync.Mutex
+	gitDir        string // zone files of the checkout
+)
+
+// withGitDefaults fills the unset settings of cfg
+func withGitDefaults(cfg GitConfig) GitConfig {
+	if cfg.Branch == "" {
+		cfg.Branch = "main"
+	}
+	if cfg.Checkout == "" {
+		cfg.Checkout = "git-zones"
+	}
+	if cfg.IntervalSec <= 0 {
+		cfg.IntervalSec = 60
+	}
+	return cfg
+}
+
+// gitZonesDir returns the directory of the zone files in the checkout
+func gitZonesDir(cfg GitConfig) string {
+	return filepath.Join(cfg.Checkout, filepath.FromSlash(cfg.Path))
+}
+
+// git runs a git command in the checkout and returns its trimmed output
+func git(cfg GitConfig, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = cfg.Checkout
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if cfg.SSHKey != "" {
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND=ssh -i "+cfg.SSHKey+" -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new")
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// loadZonesFromBindFile loads a master file into zd. The zone is named by
+// the $ORIGIN of the file, or its name without the .zone extension.
+func loadZonesFromBindFile(zd *ZoneData, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	origin := dns.Fqdn(strings.ToLower(strings.TrimSuffix(filepath.Base(path), ".zone")))
+	zp := dns.NewZoneParser(f, origin, path)
+	zp.SetIncludeAllowed(false)
+	var rrs []dns.RR
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	// The parse error names the file and line
+	if err := zp.Err(); err != nil {
+		return err
+	}
+	// The SOA names the zone when $ORIGIN differs from the file name
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			origin = strings.ToLower(rr.Header().Name)
+			break
+		}
+	}
+	zd.AddZone(origin)
+	for _, rr := range rrs {
+		if !dns.IsSubDomain(origin, rr.Header().Name) {
+			return fmt.Errorf("%s: %s is outside the zone %s", path, rr.Header().Name, origin)
+		}
+		zd.AddRR(rr)
+	}
+	return nil
+}
+
+// loadGitZoneFiles loads the YAML and BIND zone files of dir into zd and
+// returns the error of every file that does not load
+func loadGitZoneFiles(zd *ZoneData, dir string) []error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range entries {
+		base := e.Name()
+		path := filepath.Join(dir, base)
+		switch {
+		case e.IsDir():
+			continue
+		case strings.HasSuffix(base, ".yaml") || strings.HasSuffix(base, ".yml"):
+			err = loadZonesFromYAMLFile(zd, path)
+		case strings.HasSuffix(base, ".zone"):
+			err = loadZonesFromBindFile(zd, path)
+		default:
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// buildZonesFromGitDir loads the zone files of dir and checks every zone:
+// the snapshot is refused as a whole if anything is wrong, so a bad commit
+// never replaces the zones being served
+func buildZonesFromGitDir(dir string) (*ZoneData, error) {
+	zd := NewZoneData()
+	errs := loadGitZoneFiles(zd, dir)
+	for _, apex := range zd.ZoneNames() {
+		for _, p := range lintZone(zd, apex, nil) {
+			if p.Severity == severityError {
+				errs = append(errs, errors.New(p.String()))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	addDynamicZones(zd)
+	addCatalogZone(zd)
+	return zd, nil
+}
+
+// buildZonesFromGitSource rebuilds the zones of the commit being served,
+// for the periodic verification
+func buildZonesFromGitSource() (*ZoneData, string, error) {
+	gitCheckoutMu.Lock()
+	defer gitCheckoutMu.Unlock()
+	if gitDir == "" {
+		return nil, "", fmt.Errorf("no git checkout loaded")
+	}
+	zd, err := buildZonesFromGitDir(gitDir)
+	return zd, gitDir, err
+}
+
+// setGitStatus updates the sync status under its lock
+func setGitStatus(update func(s *GitSyncStatus)) {
+	gitStatusMu.Lock()
+	defer gitStatusMu.Unlock()
+	update(gitStatus)
+}
+
+// gitHealth returns the sync status for /api/health, nil outside git mode
+func gitHealth() *GitSyncStatus {
+	gitStatusMu.RLock()
+	defer gitStatusMu.RUnlock()
+	if gitStatus == nil {
+		return nil
+	}
+	s := *gitStatus
+	return &s
+}
+
+// applyGitCommit serves the zones of the commit checked out
+func applyGitCommit(cfg GitConfig, commit string) error {
+	err := zoneStore.Rebuild(func() (*ZoneData, error) {
+		return buildZonesFromGitDir(gitZonesDir(cfg))
+	})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	setGitStatus(func(s *GitSyncStatus) {
+		s.Commit, s.SyncedAt, s.Rejected, s.Error = commit, &now, "", ""
+	})
+	slog.Info("Synced zones from git", "commit", commit, "zones", len(zoneStore.Load().ZoneNames()))
+	return nil
+}
+
+// pullGit fetches the branch and serves its last commit if it is valid.
+// A commit that does not pass the checks is not served: the checkout goes
+// back to the commit being served.
+func pullGit(cfg GitConfig) {
+	if _, err := git(cfg, "fetch", "--quiet", "origin", cfg.Branch); err != nil {
+		slog.Warn("failed to pull zones from git", "url", cfg.URL, "error", err)
+		setGitStatus(func(s *GitSyncStatus) { s.Error = err.Error() })
+		return
+	}
+	head, err := git(cfg, "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		setGitStatus(func(s *GitSyncStatus) { s.Error = err.Error() })
+		return
+	}
+	now := time.Now()
+	setGitStatus(func(s *GitSyncStatus) { s.FetchedAt = &now })
+	gitStatusMu.RLock()
+	current, rejected := gitStatus.Commit, gitStatus.Rejected
+	gitStatusMu.RUnlock()
+	if head == current {
+		// The remote answers again
+		setGitStatus(func(s *GitSyncStatus) { s.Rejected, s.Error = "", "" })
+		return
+	}
+	if head == rejected {
+		return
+	}
+
+	gitCheckoutMu.Lock()
+	defer gitCheckoutMu.Unlock()
+
+	if _, err = git(cfg, "checkout", "--quiet", "--force", "--detach", head); err == nil {
+		err = applyGitCommit(cfg, head)
+	}
+	if err != nil {
+		slog.Error("git commit rejected, zones not updated", "commit", head, "error", err)
+		setGitStatus(func(s *GitSyncStatus) { s.Rejected, s.Error = head, err.Error() })
+		if current != "" {
+			if _, err := git(cfg, "checkout", "--quiet", "--force", "--detach", current); err != nil {
+				slog.Warn("failed to restore the git checkout", "commit", current, "error", err)
+			}
+		}
+	}
+}
+
+// startGitSync clones the repository if needed, serves the commit checked
+// out and keeps pulling the branch. The zones of an existing checkout are
+// served at once, even when the remote cannot be reached.
+func startGitSync(cfg GitConfig) error {
+	cfg = withGitDefaults(cfg)
+	if cfg.URL == "" {
+		return fmt.Errorf("git.url is required")
+	}
+	gitStatus = &GitSyncStatus{URL: cfg.URL, Branch: cfg.Branch}
+	gitDir = gitZonesDir(cfg)
+
+	if _, err := os.Stat(filepath.Join(cfg.Checkout, ".git")); err != nil {
+		if err := os.MkdirAll(cfg.Checkout, 0o755); err != nil {
+			return err
+		}
+		if _, err := git(cfg, "clone", "--quiet", "--branch", cfg.Branch, "--single-branch", cfg.URL, "."); err != nil {
+			return err
+		}
+	}
+	if head, err := git(cfg, "rev-parse", "HEAD"); err == nil {
+		if err := applyGitCommit(cfg, head); err != nil {
+			slog.Error("zones of the git checkout are invalid", "commit", head, "error", err)
+			setGitStatus(func(s *GitSyncStatus) { s.Rejected, s.Error = head, err.Error() })
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.IntervalSec) * time.Second)
+		defer ticker.Stop()
+		for {
+			pullGit(cfg)
+			<-ticker.C
+		}
+	}()
+	return nil
+}
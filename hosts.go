@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// HostsConfig lists /etc/hosts-style files whose names are answered ahead
+// of the forwarders
+type HostsConfig struct {
+	Files []string `yaml:"files" json:"files,omitempty"`
+	TTL   int      `yaml:"ttl" json:"ttl,omitempty"` // default 60
+}
+
+// hostsTable maps lowercased FQDNs (including the in-addr.arpa and
+// ip6.arpa names of the addresses) to their records
+type hostsTable map[string][]dns.RR
+
+var hosts atomic.Pointer[hostsTable]
+
+// hostsReloadInterval is how often the files are checked for changes
+const hostsReloadInterval = 5 * time.Second
+
+// loadHostsFiles parses the files. A missing or unreadable file is logged
+// and skipped so one bad path does not drop the others.
+func loadHostsFiles(files []string, ttl uint32) hostsTable {
+	table := make(hostsTable)
+	seen := make(map[string]bool)
+	add := func(rr dns.RR) {
+		if key := strings.ToLower(rr.String()); !seen[key] {
+			seen[key] = true
+			name := strings.ToLower(rr.Header().Name)
+			table[name] = append(table[name], rr)
+		}
+	}
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			slog.Warn("failed to read hosts file", "file", path, "error", err)
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if i := strings.IndexByte(line, '#'); i >= 0 {
+				line = line[:i]
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			// Zone identifiers (fe80::1%eth0) mean nothing to remote clients
+			ip := net.ParseIP(strings.SplitN(fields[0], "%", 2)[0])
+			if ip == nil {
+				continue
+			}
+			for i, host := range fields[1:] {
+				name := strings.ToLower(dns.Fqdn(host))
+				if _, ok := dns.IsDomainName(name); !ok {
+					continue
+				}
+				hdr := dns.RR_Header{Name: name, Class: dns.ClassINET, Ttl: ttl}
+				if ip4 := ip.To4(); ip4 != nil {
+					hdr.Rrtype = dns.TypeA
+					add(&dns.A{Hdr: hdr, A: ip4})
+				} else {
+					hdr.Rrtype = dns.TypeAAAA
+					add(&dns.AAAA{Hdr: hdr, AAAA: ip})
+				}
+				// The first name of a line is the canonical one
+				if i == 0 {
+					if arpa, err := dns.ReverseAddr(ip.String()); err == nil {
+						add(&dns.PTR{Hdr: dns.RR_Header{Name: arpa, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: ttl}, Ptr: name})
+					}
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			slog.Warn("failed to read hosts file", "file", path, "error", err)
+		}
+		_ = f.Close()
+	}
+	return table
+}
+
+// lookupHosts returns the records of name for qtype, and whether the name
+// is in the hosts files at all
+func lookupHosts(name string, qtype uint16) ([]dns.RR, bool) {
+	table := hosts.Load()
+	if table == nil {
+		return nil, false
+	}
+	rrs, ok := (*table)[strings.ToLower(name)]
+	if !ok {
+		return nil, false
+	}
+	var answers []dns.RR
+	for _, rr := range rrs {
+		if qtype == dns.TypeANY || rr.Header().Rrtype == qtype {
+			answers = append(answers, rr)
+		}
+	}
+	return answers, true
+}
+
+// startHostsFiles loads the hosts files and reloads them when they change
+func startHostsFiles(cfg HostsConfig) {
+	if len(cfg.Files) == 0 {
+		return
+	}
+	ttl := uint32(60)
+	if cfg.TTL > 0 {
+		ttl = uint32(cfg.TTL)
+	}
+	load := func() {
+		table := loadHostsFiles(cfg.Files, ttl)
+		hosts.Store(&table)
+		slog.Info("Loaded hosts files", "files", cfg.Files, "names", len(table))
+	}
+
+	mods := make([]time.Time, len(cfg.Files))
+	for i, path := range cfg.Files {
+		mods[i] = fileModTime(path)
+	}
+	load()
+	go func() {
+		ticker := time.NewTicker(hostsReloadInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			changed := false
+			for i, path := range cfg.Files {
+				if mod := fileModTime(path); !mod.Equal(mods[i]) {
+					mods[i] = mod
+					changed = true
+				}
+			}
+			if changed {
+				load()
+			}
+		}
+	}()
+}
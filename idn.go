@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// idnToASCII converts the Unicode labels of a domain name to punycode
+// (bücher.example becomes xn--bcher-kva.example). ASCII labels are kept as
+// they are, so "@", "*" and "_service" labels pass through.
+func idnToASCII(name string) (string, error) {
+	if isASCII(name) {
+		return name, nil
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		ascii, err := idna.Lookup.ToASCII(label)
+		if err != nil {
+			return "", fmt.Errorf("invalid international name %q: %v", name, err)
+		}
+		labels[i] = ascii
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// idnToUnicode returns name with its punycode labels in Unicode, for
+// display; labels that are not valid punycode are kept
+func idnToUnicode(name string) string {
+	if !strings.Contains(name, "xn--") && !strings.Contains(name, "XN--") {
+		return name
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(strings.ToLower(label), "xn--") {
+			continue
+		}
+		if u, err := idna.Lookup.ToUnicode(label); err == nil {
+			labels[i] = u
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// idnTargetTypes are the record types whose value ends with a domain name
+var idnTargetTypes = map[string]bool{"CNAME": true, "DNAME": true, "NS": true, "PTR": true, "MX": true, "SRV": true, "ALIAS": true}
+
+// toASCII converts the Unicode name of the record, and the domain name its
+// value ends with for the types in idnTargetTypes, to punycode
+func (r *CreateRecordRequest) toASCII() error {
+	var err error
+	if r.Name, err = idnToASCII(r.Name); err != nil {
+		return err
+	}
+	if !idnTargetTypes[strings.ToUpper(strings.TrimSpace(r.Type))] || isASCII(r.Value) {
+		return nil
+	}
+	fields := strings.Fields(r.Value)
+	if len(fields) == 0 {
+		return nil
+	}
+	if fields[len(fields)-1], err = idnToASCII(fields[len(fields)-1]); err != nil {
+		return err
+	}
+	r.Value = strings.Join(fields, " ")
+	return nil
+}
+
+// DisplayName returns the name of the zone in Unicode
+func (z ZoneInfo) DisplayName() string {
+	return idnToUnicode(z.Name)
+}
+
+// DisplayName returns the name of the record in Unicode
+func (r RecordInfo) DisplayName() string {
+	return idnToUnicode(r.Name)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// cloudflareAPI is the Cloudflare v4 API base URL
+var cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// ZoneImportRequest imports a zone from a cloud provider
+type ZoneImportRequest struct {
+	Provider string `json:"provider" binding:"required"` // cloudflare, route53 or bind
+	Zone     string `json:"zone" binding:"required"`
+	Token    string `json:"token"`   // Cloudflare API token (Zone:Read, DNS:Read)
+	Data     string `json:"data"`    // route53 list-resource-record-sets JSON or zone file
+	DryRun   bool   `json:"dry_run"` // only return the records that would be created
+}
+
+// SkippedRecord is a provider record that cannot be imported
+type SkippedRecord struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// providerRecord is a record in the provider's own representation
+type providerRecord struct {
+	name  string
+	typ   string
+	ttl   int
+	rdata string
+}
+
+// importedRecords converts the provider records to records of zone. The
+// apex SOA and NS are skipped: simpledns synthesizes them from the zone
+// settings.
+func importedRecords(zone string, provided []providerRecord) ([]DBRecord, []SkippedRecord) {
+	zoneName := dns.Fqdn(zone)
+	records := []DBRecord{}
+	skipped := []SkippedRecord{}
+	for _, p := range provided {
+		name := dns.Fqdn(p.name)
+		skip := func(reason string) {
+			skipped = append(skipped, SkippedRecord{Name: name, Type: p.typ, Reason: reason})
+		}
+		if !dns.IsSubDomain(zoneName, name) {
+			skip("outside the zone")
+			continue
+		}
+		if p.typ == "SOA" || (p.typ == "NS" && strings.EqualFold(name, zoneName)) {
+			skip("apex " + p.typ + " is generated from the zone settings")
+			continue
+		}
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", name, p.ttl, p.typ, p.rdata))
+		if err != nil || rr == nil {
+			skip("unsupported record: " + p.rdata)
+			continue
+		}
+		records = append(records, rrToRecord(zoneName, rr))
+	}
+	return records, skipped
+}
+
+// newImportedZone returns an enabled zone with the default settings
+func newImportedZone(zoneName string) *DBZone {
+	return &DBZone{
+		Name:    zoneName,
+		Enabled: true,
+		TTL:     3600,
+		NS:      "ns1." + zoneName,
+		Admin:   "admin." + zoneName,
+		Serial:  initialSerial(),
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minimum: 3600,
+	}
+}
+
+// cloudflareGet decodes the result of a Cloudflare API call
+func cloudflareGet(ctx context.Context, token, path string, result any) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cloudflareAPI+path, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var body struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+		Result     json.RawMessage `json:"result"`
+		ResultInfo struct {
+			TotalPages int `json:"total_pages"`
+		} `json:"result_info"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 32<<20)).Decode(&body); err != nil {
+		return 0, fmt.Errorf("cloudflare: %s", resp.Status)
+	}
+	if !body.Success {
+		msg := resp.Status
+		if len(body.Errors) > 0 {
+			msg = body.Errors[0].Message
+		}
+		return 0, fmt.Errorf("cloudflare: %s", msg)
+	}
+	return body.ResultInfo.TotalPages, json.Unmarshal(body.Result, result)
+}
+
+// cloudflareRecords lists the DNS records of zone through the Cloudflare API
+func cloudflareRecords(ctx context.Context, token, zone string) ([]providerRecord, error) {
+	var zones []struct {
+		ID string `json:"id"`
+	}
+	if _, err := cloudflareGet(ctx, token, "/zones?name="+url.QueryEscape(zone), &zones); err != nil {
+		return nil, err
+	}
+	if len(zones) == 0 {
+		return nil, fmt.Errorf("zone %s not found in the Cloudflare account", zone)
+	}
+
+	var records []providerRecord
+	for page := 1; ; page++ {
+		var result []struct {
+			Name     string `json:"name"`
+			Type     string `json:"type"`
+			Content  string `json:"content"`
+			TTL      int    `json:"ttl"`
+			Priority *int   `json:"priority"`
+		}
+		pages, err := cloudflareGet(ctx, token, fmt.Sprintf("/zones/%s/dns_records?per_page=500&page=%d", zones[0].ID, page), &result)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range result {
+			rdata := r.Content
+			switch r.Type {
+			case "MX", "URI":
+				if r.Priority != nil {
+					rdata = strconv.Itoa(*r.Priority) + " " + rdata
+				}
+			case "SRV":
+				// content is "weight port target", the priority is separate
+				if r.Priority != nil && len(strings.Fields(rdata)) == 3 {
+					rdata = strconv.Itoa(*r.Priority) + " " + rdata
+				}
+			case "TXT", "SPF":
+				if !strings.HasPrefix(rdata, `"`) {
+					rdata = strconv.Quote(rdata)
+				}
+			}
+			ttl := r.TTL
+			if ttl <= 1 {
+				ttl = 300 // 1 is "automatic"
+			}
+			records = append(records, providerRecord{name: r.Name, typ: r.Type, ttl: ttl, rdata: rdata})
+		}
+		if page >= pages {
+			return records, nil
+		}
+	}
+}
+
+// route53Records parses the output of aws route53 list-resource-record-sets
+func route53Records(data string) ([]providerRecord, []SkippedRecord, error) {
+	type recordSet struct {
+		Name            string `json:"Name"`
+		Type            string `json:"Type"`
+		TTL             int    `json:"TTL"`
+		ResourceRecords []struct {
+			Value string `json:"Value"`
+		} `json:"ResourceRecords"`
+		AliasTarget *struct {
+			DNSName string `json:"DNSName"`
+		} `json:"AliasTarget"`
+	}
+	var sets []recordSet
+	var wrapped struct {
+		ResourceRecordSets []recordSet `json:"ResourceRecordSets"`
+	}
+	data = strings.TrimSpace(data)
+	if strings.HasPrefix(data, "[") {
+		if err := json.Unmarshal([]byte(data), &sets); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		if err := json.Unmarshal([]byte(data), &wrapped); err != nil {
+			return nil, nil, err
+		}
+		sets = wrapped.ResourceRecordSets
+	}
+
+	var records []providerRecord
+	var skipped []SkippedRecord
+	for _, s := range sets {
+		// Route 53 escapes * in names as \052
+		name := strings.ReplaceAll(s.Name, `\052`, "*")
+		if s.AliasTarget != nil {
+			skipped = append(skipped, SkippedRecord{Name: dns.Fqdn(name), Type: s.Type, Reason: "alias to " + s.AliasTarget.DNSName + " has no standard equivalent"})
+			continue
+		}
+		for _, rr := range s.ResourceRecords {
+			records = append(records, providerRecord{name: name, typ: s.Type, ttl: s.TTL, rdata: rr.Value})
+		}
+	}
+	return records, skipped, nil
+}
+
+// bindRecords parses a zone file, such as the Cloudflare DNS export
+func bindRecords(data, zone string) ([]providerRecord, error) {
+	var records []providerRecord
+	zp := dns.NewZoneParser(strings.NewReader(data), dns.Fqdn(zone), "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		h := rr.Header()
+		records = append(records, providerRecord{name: h.Name, typ: dns.TypeToString[h.Rrtype], ttl: int(h.Ttl), rdata: rdataString(rr)})
+	}
+	return records, zp.Err()
+}
+
+// Zone import API handler
+
+// handleAPIImportZone creates a zone from the records of a cloud provider,
+// or previews them with dry_run
+func handleAPIImportZone(c *gin.Context) {
+	var req ZoneImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	zoneName, err := idnToASCII(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(req.Zone)), "."))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := dns.IsDomainName(zoneName); !ok || zoneName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone name"})
+		return
+	}
+
+	var provided []providerRecord
+	var skipped []SkippedRecord
+	switch req.Provider {
+	case "cloudflare":
+		if req.Token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "token is required for cloudflare"})
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+		provided, err = cloudflareRecords(ctx, req.Token, zoneName)
+		if err != nil {
+			slog.Warn("cloudflare import failed", "zone", zoneName, "error", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+	case "route53":
+		provided, skipped, err = route53Records(req.Data)
+	case "bind":
+		provided, err = bindRecords(req.Data, zoneName)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "provider must be cloudflare, route53 or bind"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	records, unsupported := importedRecords(zoneName, provided)
+	skipped = append(skipped, unsupported...)
+	if req.DryRun {
+		c.JSON(http.StatusOK, gin.H{"zone": zoneName, "records": records, "skipped": skipped})
+		return
+	}
+
+	zone := newImportedZone(zoneName)
+	if err := database.CreateZoneWithRecords(zone, records); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("zone '%s' already exists", zoneName)})
+			return
+		}
+		slog.Error("failed to import zone", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to import zone"})
+		return
+	}
+
+	// Reload zones into memory
+	if err := LoadZonesFromDB(); err != nil {
+		slog.Error("failed to reload zones", "error", err)
+	}
+
+	slog.Info("Zone imported", "name", zoneName, "provider", req.Provider, "records", len(records), "skipped", len(skipped))
+	c.JSON(http.StatusCreated, gin.H{"zone": zone, "records": len(records), "skipped": skipped})
+}
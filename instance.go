@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/hex"
+	"os"
+
+	"github.com/miekg/dns"
+)
+
+// instanceName tells apart the nodes answering on the same address
+// (anycast); set by instance_name, the host name by default. It is shown
+// in /api/health, tags the metrics and is the NSID of the answers.
+var instanceName, _ = os.Hostname()
+
+// nsidEnabled sends instanceName as the NSID (RFC 5001) of the answers to
+// queries asking for it
+var nsidEnabled bool
+
+// withNSID wraps a DNS handler: an EDNS query carrying an empty NSID
+// option gets the NSID of this node in the reply, including forwarded and
+// cached replies
+func withNSID(next dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		if !nsidEnabled || !wantsNSID(r) {
+			next(w, r)
+			return
+		}
+		next(&nsidWriter{ResponseWriter: w}, r)
+	}
+}
+
+func wantsNSID(r *dns.Msg) bool {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return false
+	}
+	for _, o := range opt.Option {
+		if o.Option() == dns.EDNS0NSID {
+			return true
+		}
+	}
+	return false
+}
+
+type nsidWriter struct {
+	dns.ResponseWriter
+}
+
+// WriteMsg replaces any NSID of the reply, such as the one of the upstream
+// of a forwarded query, with the NSID of this node
+func (w *nsidWriter) WriteMsg(m *dns.Msg) error {
+	if opt := m.IsEdns0(); opt != nil {
+		options := opt.Option[:0]
+		for _, o := range opt.Option {
+			if o.Option() != dns.EDNS0NSID {
+				options = append(options, o)
+			}
+		}
+		opt.Option = append(options, &dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: hex.EncodeToString([]byte(instanceName))})
+	}
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+func (w *nsidWriter) Unwrap() dns.ResponseWriter { return w.ResponseWriter }
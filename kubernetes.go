@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// KubernetesConfig configures the publication of Service and Ingress
+// hostnames, like external-dns but built in. The Kubernetes API is used
+// directly over REST with a service account token.
+type KubernetesConfig struct {
+	Zone string `yaml:"zone" json:"zone,omitempty"` // zone the records are published in, enables the controller
+	// APIServer defaults to the in-cluster address
+	// (KUBERNETES_SERVICE_HOST/PORT)
+	APIServer string `yaml:"api_server" json:"api_server,omitempty"`
+	// TokenFile and CAFile default to the in-cluster service account
+	TokenFile          string `yaml:"token_file" json:"token_file,omitempty"`
+	CAFile             string `yaml:"ca_file" json:"ca_file,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" json:"insecure_skip_verify,omitempty"`
+	// LabelSelector limits the watched resources, e.g. simpledns/publish=true
+	LabelSelector string   `yaml:"label_selector" json:"label_selector,omitempty"`
+	Namespaces    []string `yaml:"namespaces" json:"namespaces,omitempty"` // all when empty
+	TTL           int      `yaml:"ttl" json:"ttl,omitempty"`               // default 60
+}
+
+// kubernetesHostnameAnnotation sets the published name of a Service,
+// relative to the zone or as an FQDN inside it
+const kubernetesHostnameAnnotation = "simpledns/hostname"
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// k8sLoadBalancer is the status.loadBalancer of Services and Ingresses
+type k8sLoadBalancer struct {
+	Ingress []struct {
+		IP       string `json:"ip"`
+		Hostname string `json:"hostname"`
+	} `json:"ingress"`
+}
+
+// k8sList is the part of a Service or Ingress list the controller uses
+type k8sList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []struct {
+		Metadata struct {
+			Name        string            `json:"name"`
+			Namespace   string            `json:"namespace"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Spec struct {
+			ExternalIPs []string `json:"externalIPs"`
+			Rules       []struct {
+				Host string `json:"host"`
+			} `json:"rules"`
+		} `json:"spec"`
+		Status struct {
+			LoadBalancer k8sLoadBalancer `json:"loadBalancer"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// kubernetesClient calls the Kubernetes API
+type kubernetesClient struct {
+	server    string
+	tokenFile string
+	client    *http.Client
+}
+
+func newKubernetesClient(cfg KubernetesConfig) (*kubernetesClient, error) {
+	server := cfg.APIServer
+	if server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" {
+			return nil, fmt.Errorf("not running in a cluster, set kubernetes.api_server")
+		}
+		server = "https://" + net.JoinHostPort(host, port)
+	}
+	tokenFile := cfg.TokenFile
+	if tokenFile == "" {
+		tokenFile = serviceAccountDir + "/token"
+	}
+	caFile := cfg.CAFile
+	if caFile == "" && cfg.APIServer == "" {
+		caFile = serviceAccountDir + "/ca.crt"
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return &kubernetesClient{
+		server:    strings.TrimSuffix(server, "/"),
+		tokenFile: tokenFile,
+		client:    &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment}},
+	}, nil
+}
+
+// get returns the response of a GET on path. The token is read on every
+// call: projected service account tokens are rotated.
+func (k *kubernetesClient) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.server+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token, err := os.ReadFile(k.tokenFile); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("kubernetes: GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// resourcePath returns the list path of a resource in a namespace ("" for
+// all), with the label selector
+func resourcePath(resource, namespace, selector string, extra url.Values) string {
+	path := "/api/v1/"
+	if resource == "ingresses" {
+		path = "/apis/networking.k8s.io/v1/"
+	}
+	if namespace != "" {
+		path += "namespaces/" + url.PathEscape(namespace) + "/"
+	}
+	q := url.Values{}
+	for k, v := range extra {
+		q[k] = v
+	}
+	if selector != "" {
+		q.Set("labelSelector", selector)
+	}
+	path += resource
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	return path
+}
+
+// list returns the Services or Ingresses of a namespace
+func (k *kubernetesClient) list(ctx context.Context, resource, namespace, selector string) (*k8sList, error) {
+	resp, err := k.get(ctx, resourcePath(resource, namespace, selector, nil))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var list k8sList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("kubernetes: %s: %w", resource, err)
+	}
+	return &list, nil
+}
+
+// watch blocks until a resource changes after resourceVersion, or a timeout
+func (k *kubernetesClient) watch(ctx context.Context, resource, namespace, selector, resourceVersion string) error {
+	resp, err := k.get(ctx, resourcePath(resource, namespace, selector, url.Values{
+		"watch":           {"1"},
+		"resourceVersion": {resourceVersion},
+		"timeoutSeconds":  {"300"},
+	}))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var event struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &event) == nil && event.Type != "BOOKMARK" {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// kubernetesRecords converts Services and Ingresses to records in zone
+func kubernetesRecords(zone string, ttl uint32, services, ingresses []*k8sList) []dns.RR {
+	seen := make(map[string]bool)
+	var rrs []dns.RR
+	publish := func(name string, lb k8sLoadBalancer, ips []string) {
+		name = strings.ToLower(name)
+		if !strings.HasSuffix(name, ".") {
+			name = name + "." + zone
+		}
+		if _, ok := dns.IsDomainName(name); !ok || !dns.IsSubDomain(zone, name) || name == zone {
+			return
+		}
+		var values []string
+		for _, ing := range lb.Ingress {
+			if ing.IP != "" {
+				values = append(values, ing.IP)
+			} else if ing.Hostname != "" {
+				values = append(values, dns.Fqdn(ing.Hostname))
+			}
+		}
+		values = append(values, ips...)
+		for _, v := range values {
+			var rr dns.RR
+			hdr := dns.RR_Header{Name: name, Class: dns.ClassINET, Ttl: ttl}
+			if ip := net.ParseIP(v); ip == nil {
+				// A CNAME cannot share its name with other records
+				if len(values) > 1 {
+					continue
+				}
+				hdr.Rrtype = dns.TypeCNAME
+				rr = &dns.CNAME{Hdr: hdr, Target: v}
+			} else if ip4 := ip.To4(); ip4 != nil {
+				hdr.Rrtype = dns.TypeA
+				rr = &dns.A{Hdr: hdr, A: ip4}
+			} else {
+				hdr.Rrtype = dns.TypeAAAA
+				rr = &dns.AAAA{Hdr: hdr, AAAA: ip}
+			}
+			if key := rr.String(); !seen[key] {
+				seen[key] = true
+				rrs = append(rrs, rr)
+			}
+		}
+	}
+
+	for _, list := range services {
+		for _, svc := range list.Items {
+			name := svc.Metadata.Name + "." + svc.Metadata.Namespace
+			if h := svc.Metadata.Annotations[kubernetesHostnameAnnotation]; h != "" {
+				name = h
+			}
+			publish(name, svc.Status.LoadBalancer, svc.Spec.ExternalIPs)
+		}
+	}
+	for _, list := range ingresses {
+		for _, ing := range list.Items {
+			for _, rule := range ing.Spec.Rules {
+				// Ingress hosts are FQDNs, only those inside the zone are published
+				if rule.Host != "" && !strings.HasPrefix(rule.Host, "*") {
+					publish(dns.Fqdn(rule.Host), ing.Status.LoadBalancer, nil)
+				}
+			}
+		}
+	}
+	sort.Slice(rrs, func(i, j int) bool { return rrs[i].String() < rrs[j].String() })
+	return rrs
+}
+
+// startKubernetesController publishes the Services and Ingresses in
+// cfg.Zone and follows their changes
+func startKubernetesController(cfg KubernetesConfig) error {
+	if cfg.Zone == "" {
+		return nil
+	}
+	client, err := newKubernetesClient(cfg)
+	if err != nil {
+		return err
+	}
+	zone := strings.ToLower(dns.Fqdn(cfg.Zone))
+	ttl := uint32(60)
+	if cfg.TTL > 0 {
+		ttl = uint32(cfg.TTL)
+	}
+	namespaces := cfg.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+
+	slog.Info("Publishing Kubernetes Services and Ingresses", "zone", zone, "api_server", client.server, "label_selector", cfg.LabelSelector)
+	go func() {
+		for {
+			ctx, cancel := context.WithCancel(context.Background())
+			err := kubernetesSync(ctx, client, cfg.LabelSelector, namespaces, zone, ttl)
+			cancel()
+			if err != nil {
+				slog.Warn("kubernetes sync failed", "error", err)
+				time.Sleep(10 * time.Second)
+			}
+		}
+	}()
+	return nil
+}
+
+// kubernetesSync lists the resources, publishes them, then waits for any
+// of the lists to change
+func kubernetesSync(ctx context.Context, client *kubernetesClient, selector string, namespaces []string, zone string, ttl uint32) error {
+	type watched struct {
+		resource, namespace, version string
+	}
+	var services, ingresses []*k8sList
+	var watches []watched
+	for _, ns := range namespaces {
+		for _, resource := range []string{"services", "ingresses"} {
+			list, err := client.list(ctx, resource, ns, selector)
+			if err != nil {
+				return err
+			}
+			if resource == "services" {
+				services = append(services, list)
+			} else {
+				ingresses = append(ingresses, list)
+			}
+			watches = append(watches, watched{resource, ns, list.Metadata.ResourceVersion})
+		}
+	}
+	setDynamicRecords("kubernetes", zone, kubernetesRecords(zone, ttl, services, ingresses))
+
+	// The first watch to report a change triggers a new list
+	done := make(chan error, len(watches))
+	for _, w := range watches {
+		go func() {
+			done <- client.watch(ctx, w.resource, w.namespace, selector, w.version)
+		}()
+	}
+	return <-done
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KVConfig configures the etcd or Consul KV zone backend (db_type: kv).
+// Under the prefix, the key <zone> optionally holds a YAML zone (see
+// YAML_FORMAT.md) and every key <zone>/<anything> holds one record as
+// YAML or JSON: {"name": "web", "type": "A", "value": "10.0.0.5", "ttl": 30}.
+type KVConfig struct {
+	Backend  string `yaml:"backend" json:"backend,omitempty"`   // etcd or consul
+	Address  string `yaml:"address" json:"address,omitempty"`   // e.g. http://127.0.0.1:2379 or http://127.0.0.1:8500
+	Prefix   string `yaml:"prefix" json:"prefix,omitempty"`     // default simpledns/zones/
+	Token    string `yaml:"token" json:"-"`                     // Consul ACL token
+	Username string `yaml:"username" json:"username,omitempty"` // etcd authentication
+	Password string `yaml:"password" json:"-"`
+}
+
+// kvWatchTimeout bounds one blocking query or watch, after which the keys
+// are read again
+const kvWatchTimeout = 5 * time.Minute
+
+// kvBackend reads the keys under a prefix
+type kvBackend interface {
+	// fetch returns the keys under the prefix, relative to it, and their
+	// revision. With rev > 0 it first blocks until something changes after
+	// rev, or until kvWatchTimeout.
+	fetch(ctx context.Context, rev uint64) (map[string][]byte, uint64, error)
+	String() string
+}
+
+// kvSource is the KV backend in use and the last keys read from it
+var kvSource struct {
+	sync.Mutex
+	backend kvBackend
+	keys    map[string][]byte
+	rev     uint64
+	// failingSince is when reads started failing, zero while they work
+	failingSince time.Time
+}
+
+// newKVBackend returns the backend described by cfg
+func newKVBackend(cfg KVConfig) (kvBackend, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("kv.address is required")
+	}
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = "simpledns/zones/"
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	address := strings.TrimSuffix(cfg.Address, "/")
+	client := &http.Client{Timeout: kvWatchTimeout + 30*time.Second}
+	switch cfg.Backend {
+	case "consul":
+		return &consulKV{address: address, prefix: prefix, token: cfg.Token, client: client}, nil
+	case "etcd":
+		return &etcdKV{address: address, prefix: prefix, username: cfg.Username, password: cfg.Password, client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown kv backend %q (etcd or consul)", cfg.Backend)
+	}
+}
+
+// buildZonesFromKV builds a zone snapshot from KV keys. A zone with an
+// invalid key is skipped, so one bad entry does not take down the others.
+func buildZonesFromKV(keys map[string][]byte, rev uint64) *ZoneData {
+	zones := make(map[string]*YAMLZoneConfig)
+	zoneOf := func(name string) *YAMLZoneConfig {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		z, ok := zones[name]
+		if !ok {
+			z = &YAMLZoneConfig{}
+			z.ZoneConfig.Name = name
+			z.ZoneConfig.TTL = 300
+			z.SOA.NS = "ns1." + name + "."
+			z.SOA.Admin = "hostmaster." + name + "."
+			// The KV revision as serial lets secondaries notice changes
+			z.SOA.Serial = int(uint32(rev))
+			z.SOA.Refresh, z.SOA.Retry, z.SOA.Expire = 3600, 600, 86400
+			zones[name] = z
+		}
+		return z
+	}
+	invalid := make(map[string]bool)
+
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, key := range names {
+		value := keys[key]
+		zone, rest, isRecord := strings.Cut(key, "/")
+		if zone == "" || len(bytes.TrimSpace(value)) == 0 {
+			continue
+		}
+		z := zoneOf(zone)
+		if !isRecord {
+			records := z.DNSRecords
+			if err := yaml.Unmarshal(value, z); err != nil {
+				slog.Warn("invalid zone in kv, skipping zone", "key", key, "error", err)
+				invalid[z.ZoneConfig.Name] = true
+				continue
+			}
+			// The zone key names the zone, whatever its content says
+			z.ZoneConfig.Name = strings.ToLower(strings.TrimSuffix(zone, "."))
+			z.DNSRecords = append(z.DNSRecords, records...)
+			continue
+		}
+		var record YAMLRecord
+		if err := yaml.Unmarshal(value, &record); err != nil || record.Type == "" {
+			slog.Warn("invalid record in kv, skipping zone", "key", key, "error", err)
+			invalid[z.ZoneConfig.Name] = true
+			continue
+		}
+		if record.Name == "" {
+			record.Name = rest
+		}
+		z.DNSRecords = append(z.DNSRecords, record)
+	}
+
+	zd := NewZoneData()
+	for name, z := range zones {
+		if invalid[name] {
+			continue
+		}
+		if err := addYAMLZone(zd, z); err != nil {
+			slog.Warn("invalid zone in kv, skipping zone", "zone", name, "error", err)
+		}
+	}
+	addDynamicZones(zd)
+	addCatalogZone(zd)
+	return zd
+}
+
+// startKVWatcher loads the zones from the KV backend and keeps them up to
+// date. The first read is waited for (up to a few seconds) so the server
+// does not start empty when the backend is reachable.
+func startKVWatcher(cfg KVConfig) error {
+	backend, err := newKVBackend(cfg)
+	if err != nil {
+		return err
+	}
+	kvSource.Lock()
+	kvSource.backend = backend
+	kvSource.Unlock()
+
+	loaded := make(chan struct{})
+	go func() {
+		var rev uint64
+		first := true
+		for {
+			keys, next, err := backend.fetch(context.Background(), rev)
+			if err != nil {
+				slog.Warn("failed to read zones from kv", "backend", backend, "error", err)
+				kvSource.Lock()
+				if kvSource.failingSince.IsZero() {
+					kvSource.failingSince = time.Now()
+				}
+				kvSource.Unlock()
+				if first {
+					close(loaded)
+					first = false
+				}
+				rev = 0
+				time.Sleep(5 * time.Second)
+				continue
+			}
+			kvSource.Lock()
+			kvSource.failingSince = time.Time{}
+			kvSource.Unlock()
+			if next != rev || rev == 0 {
+				kvSource.Lock()
+				kvSource.keys, kvSource.rev = keys, next
+				kvSource.Unlock()
+				_ = zoneStore.Rebuild(func() (*ZoneData, error) {
+					return buildZonesFromKV(keys, next), nil
+				})
+				slog.Info("Loaded zones from kv", "backend", backend, "keys", len(keys), "revision", next)
+			}
+			if first {
+				close(loaded)
+				first = false
+			}
+			// An index going backwards means the store was reset
+			if next < rev {
+				next = 0
+			}
+			rev = next
+		}
+	}()
+
+	select {
+	case <-loaded:
+	case <-time.After(10 * time.Second):
+		slog.Warn("kv backend not ready, starting without zones", "backend", backend)
+	}
+	return nil
+}
+
+// buildZonesFromKVSource rebuilds the zones from the last keys read
+func buildZonesFromKVSource() (*ZoneData, string, error) {
+	kvSource.Lock()
+	defer kvSource.Unlock()
+	if kvSource.backend == nil || kvSource.keys == nil {
+		return nil, "", fmt.Errorf("no keys read from the kv backend")
+	}
+	return buildZonesFromKV(kvSource.keys, kvSource.rev), kvSource.backend.String(), nil
+}
+
+// consulKV reads keys with Consul blocking queries
+type consulKV struct {
+	address string
+	prefix  string
+	token   string
+	client  *http.Client
+}
+
+func (c *consulKV) String() string { return "consul " + c.address + "/" + c.prefix }
+
+func (c *consulKV) fetch(ctx context.Context, rev uint64) (map[string][]byte, uint64, error) {
+	u := c.address + "/v1/kv/" + c.prefix + "?recurse=true"
+	if rev > 0 {
+		u += fmt.Sprintf("&index=%d&wait=%ds", rev, int(kvWatchTimeout.Seconds()))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	keys := make(map[string][]byte)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// No key under the prefix yet
+		return keys, max(index, 1), nil
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, 0, fmt.Errorf("consul: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	var entries []struct {
+		Key   string `json:"Key"`
+		Value []byte `json:"Value"` // base64 in JSON
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("consul: %w", err)
+	}
+	for _, e := range entries {
+		keys[strings.TrimPrefix(e.Key, c.prefix)] = e.Value
+	}
+	return keys, max(index, 1), nil
+}
+
+// etcdKV reads keys through the etcd v3 JSON gateway (/v3/kv/range and
+// /v3/watch), which needs no gRPC client
+type etcdKV struct {
+	address  string
+	prefix   string
+	username string
+	password string
+	client   *http.Client
+	token    string
+}
+
+func (e *etcdKV) String() string { return "etcd " + e.address + "/" + e.prefix }
+
+// prefixEnd is the range end covering every key starting with prefix
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return []byte{0}
+}
+
+// call posts a JSON request to the gateway, authenticating first if needed
+func (e *etcdKV) call(ctx context.Context, path string, body any) (*http.Response, error) {
+	if e.username != "" && e.token == "" {
+		resp, err := e.post(ctx, "/v3/auth/authenticate", map[string]string{"name": e.username, "password": e.password})
+		if err != nil {
+			return nil, err
+		}
+		var auth struct {
+			Token string `json:"token"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&auth)
+		_ = resp.Body.Close()
+		if err != nil || auth.Token == "" {
+			return nil, fmt.Errorf("etcd: authentication failed")
+		}
+		e.token = auth.Token
+	}
+	resp, err := e.post(ctx, path, body)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		// Expired token, authenticate again next time
+		e.token = ""
+	}
+	return resp, err
+}
+
+func (e *etcdKV) post(ctx context.Context, path string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.address+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.token != "" {
+		req.Header.Set("Authorization", e.token)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		_ = resp.Body.Close()
+		return resp, fmt.Errorf("etcd: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
+
+// watch blocks until a key under the prefix changes after rev
+func (e *etcdKV) watch(ctx context.Context, rev uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, kvWatchTimeout)
+	defer cancel()
+	resp, err := e.call(ctx, "/v3/watch", map[string]any{
+		"create_request": map[string]any{
+			"key":            []byte(e.prefix),
+			"range_end":      prefixEnd(e.prefix),
+			"start_revision": strconv.FormatUint(rev+1, 10),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// The gateway streams one JSON object per watch response; the first
+	// one only confirms the creation
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var msg struct {
+			Result struct {
+				Events   []json.RawMessage `json:"events"`
+				Canceled bool              `json:"canceled"`
+			} `json:"result"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil {
+			continue
+		}
+		if len(msg.Result.Events) > 0 || msg.Result.Canceled {
+			return nil
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil
+	}
+	return scanner.Err()
+}
+
+func (e *etcdKV) fetch(ctx context.Context, rev uint64) (map[string][]byte, uint64, error) {
+	if rev > 0 {
+		if err := e.watch(ctx, rev); err != nil {
+			return nil, 0, err
+		}
+	}
+	resp, err := e.call(ctx, "/v3/kv/range", map[string]any{
+		"key":       []byte(e.prefix),
+		"range_end": prefixEnd(e.prefix),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var result struct {
+		Header struct {
+			Revision string `json:"revision"` // int64 as a JSON string
+		} `json:"header"`
+		Kvs []struct {
+			Key   string `json:"key"`   // base64
+			Value string `json:"value"` // base64
+		} `json:"kvs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, fmt.Errorf("etcd: %w", err)
+	}
+	keys := make(map[string][]byte)
+	for _, kv := range result.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			continue
+		}
+		value, _ := base64.StdEncoding.DecodeString(kv.Value)
+		keys[strings.TrimPrefix(string(key), e.prefix)] = value
+	}
+	revision, _ := strconv.ParseUint(result.Header.Revision, 10, 64)
+	return keys, max(revision, 1), nil
+}
@@ -0,0 +1,582 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// Severities of the zone and configuration checks
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// ZoneProblem is something in a zone that breaks or risks breaking
+// resolution
+type ZoneProblem struct {
+	Severity string `json:"severity"` // error or warning
+	Zone     string `json:"zone"`
+	Name     string `json:"name,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (p ZoneProblem) String() string {
+	where := p.Zone
+	if p.Name != "" {
+		where += " " + p.Name
+	}
+	if p.Type != "" {
+		where += " " + p.Type
+	}
+	if where == "" {
+		return p.Severity + ": " + p.Message
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Severity, where, p.Message)
+}
+
+// zoneLinter collects the problems of one zone
+type zoneLinter struct {
+	zd       *ZoneData
+	others   *ZoneData // the live zones, for targets in other zones
+	apex     string
+	problems []ZoneProblem
+}
+
+func (l *zoneLinter) report(severity, name string, rrtype uint16, format string, args ...any) {
+	l.problems = append(l.problems, ZoneProblem{Severity: severity, Zone: l.apex, Name: name, Type: dns.TypeToString[rrtype], Message: fmt.Sprintf(format, args...)})
+}
+
+// lookup returns the records of a name served locally, and whether the name
+// falls in a local zone at all
+func (l *zoneLinter) lookup(name string) ([]dns.RR, bool) {
+	if l.zd.FindZone(name) != "" {
+		records, _ := l.zd.Lookup(name)
+		return records, true
+	}
+	if l.others != nil && l.others.FindZone(name) != "" {
+		records, _ := l.others.Lookup(name)
+		return records, true
+	}
+	return nil, false
+}
+
+func hasAddress(records []dns.RR) bool {
+	return len(filterRRs(records, dns.TypeA)) > 0 || len(filterRRs(records, dns.TypeAAAA)) > 0
+}
+
+// checkTarget checks the host an MX, SRV or NS record points to, when it is
+// served locally: it must exist, have an address and not be a CNAME
+// (RFC 2181 section 10.3)
+func (l *zoneLinter) checkTarget(name string, rrtype uint16, target string) {
+	records, local := l.lookup(target)
+	if !local {
+		return
+	}
+	switch {
+	case len(filterRRs(records, dns.TypeCNAME)) > 0:
+		l.report(severityError, name, rrtype, "%s target %s is a CNAME", dns.TypeToString[rrtype], target)
+	case len(records) == 0:
+		// Clients asking this server directly never resolve its NS names
+		severity := severityError
+		if rrtype == dns.TypeNS {
+			severity = severityWarning
+		}
+		l.report(severity, name, rrtype, "%s target %s does not exist", dns.TypeToString[rrtype], target)
+	case !hasAddress(records):
+		l.report(severityWarning, name, rrtype, "%s target %s has no A or AAAA record", dns.TypeToString[rrtype], target)
+	}
+}
+
+// lintZone checks the zone at apex in zd: SOA count, CNAME conflicts,
+// dangling targets and missing glue. Targets in other zones are looked up in
+// zd, then in others when not nil.
+func lintZone(zd *ZoneData, apex string, others *ZoneData) []ZoneProblem {
+	apex = strings.ToLower(dns.Fqdn(apex))
+	// Forward zones have no records to check
+	if _, ok := zd.ForwardZone(apex); ok {
+		return nil
+	}
+	l := &zoneLinter{zd: zd, others: others, apex: apex}
+	rrs, ok := zd.ZoneRRs(apex)
+	if !ok {
+		return []ZoneProblem{{Severity: severityError, Zone: apex, Message: "zone is not loaded"}}
+	}
+
+	owners := make(map[string][]dns.RR)
+	var names []string
+	soas := 0
+	for _, rr := range rrs {
+		name := strings.ToLower(rr.Header().Name)
+		if _, ok := owners[name]; !ok {
+			names = append(names, name)
+		}
+		owners[name] = append(owners[name], rr)
+		if rr.Header().Rrtype == dns.TypeSOA {
+			if name == apex {
+				soas++
+			} else {
+				l.report(severityError, name, dns.TypeSOA, "SOA record outside the zone apex")
+			}
+		}
+	}
+	switch {
+	case soas == 0:
+		l.report(severityError, apex, dns.TypeSOA, "zone has no SOA record")
+	case soas > 1:
+		l.report(severityError, apex, dns.TypeSOA, "duplicate SOA: %d records at the apex", soas)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		records := owners[name]
+		if cnames := filterRRs(records, dns.TypeCNAME); len(cnames) > 1 {
+			l.report(severityError, name, dns.TypeCNAME, "%d CNAME records, a name can only have one", len(cnames))
+		} else if len(cnames) == 1 {
+			var types []string
+			for _, rr := range records {
+				switch t := rr.Header().Rrtype; t {
+				case dns.TypeCNAME, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+				default:
+					if !slices.Contains(types, dns.TypeToString[t]) {
+						types = append(types, dns.TypeToString[t])
+					}
+				}
+			}
+			if len(types) > 0 {
+				sort.Strings(types)
+				l.report(severityError, name, dns.TypeCNAME, "CNAME coexists with %s records", strings.Join(types, ", "))
+			}
+		}
+
+		// The records of an RRset share one TTL (RFC 2181 section 5.2)
+		for _, rrtype := range ownerTypes(records) {
+			rrset := filterRRs(records, rrtype)
+			lowest, highest := rrset[0].Header().Ttl, rrset[0].Header().Ttl
+			for _, rr := range rrset[1:] {
+				lowest, highest = min(lowest, rr.Header().Ttl), max(highest, rr.Header().Ttl)
+			}
+			if rrtype != dns.TypeRRSIG && lowest != highest {
+				l.report(severityWarning, name, rrtype, "%s records with different TTLs (%d to %d)", dns.TypeToString[rrtype], lowest, highest)
+			}
+		}
+
+		if aliases := filterRRs(records, TypeALIAS); len(aliases) > 1 {
+			l.report(severityError, name, TypeALIAS, "%d ALIAS records, a name can only have one", len(aliases))
+		} else if len(aliases) == 1 && hasAddress(records) {
+			l.report(severityWarning, name, TypeALIAS, "ALIAS coexists with A or AAAA records, they are answered instead")
+		}
+
+		for _, rr := range records {
+			switch rr := rr.(type) {
+			case *dns.PrivateRR:
+				if target := aliasTarget(rr); target != "" {
+					if records, local := l.lookup(target); local && len(records) == 0 {
+						l.report(severityError, name, TypeALIAS, "dangling ALIAS: %s does not exist", target)
+					}
+				}
+			case *dns.CNAME:
+				if target, local := l.lookup(rr.Target); local && len(target) == 0 {
+					l.report(severityError, name, dns.TypeCNAME, "dangling CNAME: %s does not exist", rr.Target)
+				}
+			case *dns.MX:
+				l.checkTarget(name, dns.TypeMX, rr.Mx)
+			case *dns.SVCB, *dns.HTTPS:
+				l.checkServiceBinding(name, rr)
+			case *dns.SRV:
+				if rr.Target != "." {
+					l.checkTarget(name, dns.TypeSRV, rr.Target)
+				}
+			case *dns.NS:
+				// A delegation to a name server inside the child zone needs
+				// glue, the child cannot be reached otherwise
+				if name != apex && dns.IsSubDomain(name, strings.ToLower(rr.Ns)) {
+					if glue, _ := zd.Lookup(rr.Ns); !hasAddress(glue) {
+						l.report(severityError, name, dns.TypeNS, "missing glue: no A or AAAA record for %s", rr.Ns)
+					}
+				} else {
+					l.checkTarget(name, dns.TypeNS, rr.Ns)
+				}
+			}
+		}
+	}
+	return l.problems
+}
+
+// handleAPIValidateZone lints a zone as stored in the database, including
+// records that do not parse
+func handleAPIValidateZone(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone id"})
+		return
+	}
+	zone, err := database.GetZone(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+
+	zd := NewZoneData()
+	problems := addDBZone(zd, *zone)
+	problems = append(problems, lintZone(zd, zone.Name, zoneStore.Load())...)
+	if problems == nil {
+		problems = []ZoneProblem{}
+	}
+	c.JSON(http.StatusOK, gin.H{"zone": dns.Fqdn(zone.Name), "valid": !hasErrors(problems), "problems": problems})
+}
+
+// hasErrors reports whether problems has errors, not only warnings
+func hasErrors(problems []ZoneProblem) bool {
+	for _, p := range problems {
+		if p.Severity == severityError {
+			return true
+		}
+	}
+	return false
+}
+
+// checkZones loads the zones of the configured source without serving them
+// and lints every zone
+func checkZones(zonesDir, dbPath string, kvCfg KVConfig, gitCfg GitConfig) []ZoneProblem {
+	var problems []ZoneProblem
+	zd := NewZoneData()
+	switch dbMode {
+	case "sqlite":
+		if _, err := os.Stat(dbPath); err != nil {
+			return []ZoneProblem{{Severity: severityError, Zone: dbPath, Message: err.Error()}}
+		}
+		if err := InitDatabase(dbPath); err != nil {
+			return []ZoneProblem{{Severity: severityError, Zone: dbPath, Message: err.Error()}}
+		}
+		zones, err := database.ListZones()
+		if err != nil {
+			return []ZoneProblem{{Severity: severityError, Zone: dbPath, Message: err.Error()}}
+		}
+		for _, z := range zones {
+			if z.Enabled {
+				problems = append(problems, addDBZone(zd, z)...)
+			}
+		}
+	case "kv":
+		backend, err := newKVBackend(kvCfg)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			var keys map[string][]byte
+			var rev uint64
+			keys, rev, err = backend.fetch(ctx, 0)
+			cancel()
+			zd = buildZonesFromKV(keys, rev)
+		}
+		if err != nil {
+			return []ZoneProblem{{Severity: severityError, Zone: kvCfg.Address, Message: err.Error()}}
+		}
+	case "git":
+		// The files of the checkout as they are, without pulling: run in
+		// the repository by CI with git.checkout: .
+		for _, err := range loadGitZoneFiles(zd, gitZonesDir(withGitDefaults(gitCfg))) {
+			problems = append(problems, ZoneProblem{Severity: severityError, Message: err.Error()})
+		}
+	default:
+		entries, err := os.ReadDir(zonesDir)
+		if err != nil {
+			return []ZoneProblem{{Severity: severityError, Zone: zonesDir, Message: err.Error()}}
+		}
+		// Every file is checked, one bad file does not hide the others
+		for _, e := range entries {
+			base := e.Name()
+			if e.IsDir() || !(strings.HasSuffix(base, ".yaml") || strings.HasSuffix(base, ".yml")) {
+				continue
+			}
+			// The error names the file
+			if err := loadZonesFromYAMLFile(zd, filepath.Join(zonesDir, base)); err != nil {
+				problems = append(problems, ZoneProblem{Severity: severityError, Message: err.Error()})
+			}
+		}
+	}
+	for _, apex := range zd.ZoneNames() {
+		problems = append(problems, lintZone(zd, apex, nil)...)
+	}
+	return problems
+}
+
+// checkConfig reports unknown keys and invalid values in the config file
+func checkConfig(path string) []ZoneProblem {
+	problem := func(severity, format string, args ...any) ZoneProblem {
+		return ZoneProblem{Severity: severity, Zone: path, Message: fmt.Sprintf(format, args...)}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []ZoneProblem{problem(severityError, "%v", err)}
+	}
+	var cfg AppConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return []ZoneProblem{problem(severityError, "%v", err)}
+	}
+
+	var problems []ZoneProblem
+	// Unknown keys are ignored when loading: they are usually typos
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var strict AppConfig
+	if err := dec.Decode(&strict); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			for _, msg := range typeErr.Errors {
+				problems = append(problems, problem(severityWarning, "%s", msg))
+			}
+		} else {
+			problems = append(problems, problem(severityWarning, "%v", err))
+		}
+	}
+
+	switch cfg.DBType {
+	case "", "files", "sqlite", "kv", "git":
+	default:
+		problems = append(problems, problem(severityError, "db_type must be files, sqlite, kv or git, not %q", cfg.DBType))
+	}
+	if cfg.DBType == "kv" {
+		if _, err := newKVBackend(cfg.KV); err != nil {
+			problems = append(problems, problem(severityError, "kv: %v", err))
+		}
+	}
+	if cfg.DBType == "git" {
+		if cfg.Git.URL == "" {
+			problems = append(problems, problem(severityError, "git.url is required with db_type: git"))
+		}
+		if cfg.Git.IntervalSec < 0 {
+			problems = append(problems, problem(severityError, "git.interval_seconds cannot be negative"))
+		}
+	}
+	switch cfg.AnyResponse {
+	case "", anyModeHINFO, anyModeRRset, anyModeFull:
+	default:
+		problems = append(problems, problem(severityError, "unknown any_response %q", cfg.AnyResponse))
+	}
+	switch cfg.SerialFormat {
+	case "", serialIncrement, serialDate:
+	default:
+		problems = append(problems, problem(severityError, "unknown serial_format %q", cfg.SerialFormat))
+	}
+	if cfg.MinTTL > 0 && cfg.MaxTTL > 0 && cfg.MinTTL > cfg.MaxTTL {
+		problems = append(problems, problem(severityError, "min_ttl (%d) is above max_ttl (%d)", cfg.MinTTL, cfg.MaxTTL))
+	}
+	if _, err := parseAllowTransfer(cfg.AllowTransfer); err != nil {
+		problems = append(problems, problem(severityError, "allow_transfer: %v", err))
+	}
+	if _, err := parseDisabledZoneResponse(cfg.DisabledZoneResp); err != nil {
+		problems = append(problems, problem(severityError, "%v", err))
+	}
+	if _, _, err := parsePortRange(cfg.ForwardSecurity.SourcePorts); err != nil {
+		problems = append(problems, problem(severityError, "forward_security: %v", err))
+	}
+	for _, f := range cfg.Forwarders {
+		host := f.Address
+		if h, _, err := net.SplitHostPort(f.Address); err == nil {
+			host = h
+		}
+		if net.ParseIP(host) == nil {
+			problems = append(problems, problem(severityWarning, "forwarder %q is not an IP address", f.Address))
+		}
+		if err := validUpstreamOptions(f.UpstreamOptions); err != nil {
+			problems = append(problems, problem(severityError, "forwarder %q: %v", f.Address, err))
+		}
+		if f.Priority < 0 {
+			problems = append(problems, problem(severityError, "forwarder %q: priority cannot be negative", f.Address))
+		}
+	}
+	if cfg.Recursion.RootHints != "" {
+		if _, err := loadRootHints(cfg.Recursion.RootHints); err != nil {
+			problems = append(problems, problem(severityError, "recursion: %v", err))
+		}
+	}
+	if _, err := parseRootSources(cfg.Recursion.LocalRootSources); err != nil {
+		problems = append(problems, problem(severityError, "recursion: %v", err))
+	}
+	if cfg.Stats.RawRetentionHours < 0 || cfg.Stats.RollupRetentionDays < 0 {
+		problems = append(problems, problem(severityError, "stats: retention cannot be negative"))
+	}
+	if cfg.Recursion.Enabled && len(cfg.Forwarders) > 0 {
+		problems = append(problems, problem(severityWarning, "recursion is enabled, the forwarders are not used"))
+	}
+	if (cfg.DoTPort > 0 || cfg.DoQPort > 0 || cfg.WebTLSPort > 0) && cfg.TLSCertFile == "" && !cfg.ACME.Enabled {
+		problems = append(problems, problem(severityWarning, "no tls_cert_file or acme, the TLS listeners serve a self-signed certificate"))
+	}
+	if cfg.WebHTTPSRedirect && cfg.WebTLSPort == 0 {
+		problems = append(problems, problem(severityError, "web_https_redirect needs web_tls_port"))
+	}
+	if cfg.ACME.Enabled {
+		switch cfg.ACME.Challenge {
+		case "", acmeChallengeDNS:
+		case acmeChallengeHTTP:
+			for _, d := range cfg.ACME.Domains {
+				if strings.HasPrefix(d, "*.") {
+					problems = append(problems, problem(severityError, "acme: http-01 cannot validate the wildcard %s", d))
+				}
+			}
+			if cfg.WebPort != 80 {
+				problems = append(problems, problem(severityWarning, "acme: http-01 needs port 80 of the domains forwarded to web_port"))
+			}
+		default:
+			problems = append(problems, problem(severityError, "acme: challenge must be dns-01 or http-01"))
+		}
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		problems = append(problems, problem(severityError, "tls_cert_file and tls_key_file must be set together"))
+	} else if cfg.TLSCertFile != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil {
+			problems = append(problems, problem(severityError, "TLS certificate: %v", err))
+		}
+	}
+	if cfg.DNS64.Enabled {
+		if _, err := parseNAT64Prefix(cfg.DNS64.Prefix); err != nil {
+			problems = append(problems, problem(severityError, "dns64: %v", err))
+		}
+		if _, err := parseAllowTransfer(cfg.DNS64.Clients); err != nil {
+			problems = append(problems, problem(severityError, "dns64 clients: %v", err))
+		}
+	}
+	if _, err := compileSearchDomains(cfg.SearchDomains); err != nil {
+		problems = append(problems, problem(severityError, "search_domains: %v", err))
+	}
+	if _, err := compileAddressFilters(cfg.AddressFilter); err != nil {
+		problems = append(problems, problem(severityError, "address_filter: %v", err))
+	}
+	if err := validZoneReminders(cfg.ZoneReminders); err != nil {
+		problems = append(problems, problem(severityError, "zone_reminders: %v", err))
+	}
+	if err := validSMTP(cfg.SMTP); err != nil {
+		problems = append(problems, problem(severityError, "smtp: %v", err))
+	}
+	if err := validAlerts(cfg.Alerts, cfg.SMTP); err != nil {
+		problems = append(problems, problem(severityError, "alerts: %v", err))
+	}
+	if len(cfg.ZoneReminders.EmailTo) > 0 && cfg.SMTP.Address == "" {
+		problems = append(problems, problem(severityWarning, "zone_reminders.email_to needs smtp.address"))
+	}
+	if cfg.Sinkhole.Enabled {
+		if _, err := newSinkholeState(cfg.Sinkhole, nil, nil, nil); err != nil {
+			problems = append(problems, problem(severityError, "sinkhole: %v", err))
+		}
+		for _, l := range cfg.Sinkhole.Lists {
+			if strings.HasPrefix(l, "http://") || strings.HasPrefix(l, "https://") {
+				continue
+			}
+			if _, err := os.Stat(l); err != nil {
+				problems = append(problems, problem(severityWarning, "sinkhole list: %v", err))
+			}
+		}
+	}
+	if err := validClients(cfg.Clients, cfg.Sinkhole); err != nil {
+		problems = append(problems, problem(severityError, "clients: %v", err))
+	}
+	if err := validRebinding(cfg.RebindingProtection); err != nil {
+		problems = append(problems, problem(severityError, "rebinding_protection: %v", err))
+	}
+	if err := validateWebSecurity(cfg.WebSecurity); err != nil {
+		problems = append(problems, problem(severityError, "web_security: %v", err))
+	}
+	if cfg.WebSecurity.LoginMaxFailures < 0 {
+		problems = append(problems, problem(severityWarning, "web_security: login lockout disabled, the login form can be brute-forced"))
+	}
+	if cfg.Pprof.Address != "" {
+		if _, _, err := net.SplitHostPort(cfg.Pprof.Address); err != nil {
+			problems = append(problems, problem(severityError, "pprof.address: %v", err))
+		} else if !loopbackAddress(cfg.Pprof.Address) {
+			problems = append(problems, problem(severityWarning, "pprof.address %s is reachable from the network without authentication", cfg.Pprof.Address))
+		}
+	}
+	if cfg.Pprof.Enabled && cfg.DBType != "sqlite" {
+		problems = append(problems, problem(severityWarning, "pprof.enabled needs sqlite mode for the authentication, use pprof.address"))
+	}
+	if cfg.Readiness.MaxSyncLagSec < 0 {
+		problems = append(problems, problem(severityError, "readiness.max_sync_lag_seconds cannot be negative"))
+	}
+	if cfg.ShutdownDrainSec < 0 {
+		problems = append(problems, problem(severityError, "shutdown_drain_seconds cannot be negative"))
+	}
+	if cfg.DebugDumpDir != "" {
+		if _, err := os.Stat(cfg.DebugDumpDir); err != nil {
+			problems = append(problems, problem(severityWarning, "debug_dump_dir: %v", err))
+		}
+	}
+	for _, f := range cfg.Hosts.Files {
+		if _, err := os.Stat(f); err != nil {
+			problems = append(problems, problem(severityWarning, "hosts: %v", err))
+		}
+	}
+	if cfg.DHCP.LeaseFile != "" {
+		if _, err := os.Stat(cfg.DHCP.LeaseFile); err != nil {
+			problems = append(problems, problem(severityWarning, "dhcp.lease_file: %v", err))
+		}
+		switch strings.ToLower(cfg.DHCP.Format) {
+		case "", leaseFormatDnsmasq, leaseFormatISC:
+		default:
+			problems = append(problems, problem(severityError, "dhcp.format must be dnsmasq or isc, not %q", cfg.DHCP.Format))
+		}
+		for _, rz := range cfg.DHCP.ReverseZones {
+			rz = strings.ToLower(dns.Fqdn(rz))
+			if !dns.IsSubDomain("in-addr.arpa.", rz) && !dns.IsSubDomain("ip6.arpa.", rz) {
+				problems = append(problems, problem(severityError, "dhcp.reverse_zones: %s is not an in-addr.arpa or ip6.arpa zone", rz))
+			}
+		}
+	}
+	if cfg.VPN.WireGuardConfig != "" {
+		if _, err := os.Stat(cfg.VPN.WireGuardConfig); err != nil {
+			problems = append(problems, problem(severityWarning, "vpn.wireguard_config: %v", err))
+		}
+	}
+	if cfg.VPN.Tailscale {
+		command := cfg.VPN.TailscaleCommand
+		if command == "" {
+			command = defaultTailscaleCommand
+		}
+		if parts := strings.Fields(command); len(parts) == 0 {
+			problems = append(problems, problem(severityError, "vpn.tailscale_command is empty"))
+		} else if _, err := exec.LookPath(parts[0]); err != nil {
+			problems = append(problems, problem(severityWarning, "vpn.tailscale: %v", err))
+		}
+	}
+	if cfg.MDNS.Enabled && cfg.MDNS.Interface != "" {
+		if _, err := net.InterfaceByName(cfg.MDNS.Interface); err != nil {
+			problems = append(problems, problem(severityError, "mdns interface %s: %v", cfg.MDNS.Interface, err))
+		}
+	}
+	return problems
+}
+
+// runChecks prints the problems found by -check-config and -check-zones and
+// returns the exit status: 1 when there is an error
+func runChecks(w io.Writer, problems []ZoneProblem) int {
+	errorsFound := 0
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+		if p.Severity == severityError {
+			errorsFound++
+		}
+	}
+	if errorsFound > 0 {
+		fmt.Fprintf(w, "%d error(s), %d warning(s)\n", errorsFound, len(problems)-errorsFound)
+		return 1
+	}
+	fmt.Fprintf(w, "OK, %d warning(s)\n", len(problems))
+	return 0
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// queryFeedSize is the number of recent queries kept in memory
+const queryFeedSize = 1000
+
+// queryFeedKeepalive is how often an idle stream sends a comment so
+// proxies do not close it
+const queryFeedKeepalive = 15 * time.Second
+
+// QueryEvent is a query answered by the server, as shown in the live feed
+type QueryEvent struct {
+	ID         uint64    `json:"id"`
+	Time       time.Time `json:"time"`
+	Client     string    `json:"client"`
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Rcode      string    `json:"rcode"`
+	Source     string    `json:"source"`
+	DurationMS float64   `json:"duration_ms"`
+}
+
+// QueryFeed is a ring buffer of the latest queries, with subscribers
+// notified of each new one
+type QueryFeed struct {
+	mu     sync.Mutex
+	events []QueryEvent
+	next   int
+	lastID uint64
+	subs   map[chan QueryEvent]struct{}
+}
+
+// NewQueryFeed returns a feed keeping the last size queries
+func NewQueryFeed(size int) *QueryFeed {
+	return &QueryFeed{
+		events: make([]QueryEvent, 0, size),
+		subs:   make(map[chan QueryEvent]struct{}),
+	}
+}
+
+var queryFeed = NewQueryFeed(queryFeedSize)
+
+// Add stores a query and sends it to the subscribers; slow subscribers
+// miss events rather than slowing down DNS
+func (f *QueryFeed) Add(e QueryEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lastID++
+	e.ID = f.lastID
+	if len(f.events) < cap(f.events) {
+		f.events = append(f.events, e)
+	} else {
+		f.events[f.next] = e
+		f.next = (f.next + 1) % len(f.events)
+	}
+	for ch := range f.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Recent returns the stored queries newer than afterID, oldest first
+func (f *QueryFeed) Recent(afterID uint64) []QueryEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := make([]QueryEvent, 0, len(f.events))
+	for i := range f.events {
+		e := f.events[(f.next+i)%len(f.events)]
+		if e.ID > afterID {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Subscribe returns a channel receiving the new queries, and the function
+// to call when done
+func (f *QueryFeed) Subscribe() (<-chan QueryEvent, func()) {
+	ch := make(chan QueryEvent, 256)
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+	return ch, func() {
+		f.mu.Lock()
+		delete(f.subs, ch)
+		f.mu.Unlock()
+	}
+}
+
+// queryEventFilter selects the queries of the feed from
+// ?client=&name=&type=&rcode=
+type queryEventFilter struct {
+	client, name, qtype, rcode string
+}
+
+func parseQueryEventFilter(c *gin.Context) queryEventFilter {
+	return queryEventFilter{
+		client: strings.TrimSpace(c.Query("client")),
+		name:   strings.ToLower(strings.TrimSpace(c.Query("name"))),
+		qtype:  strings.ToUpper(strings.TrimSpace(c.Query("type"))),
+		rcode:  strings.ToUpper(strings.TrimSpace(c.Query("rcode"))),
+	}
+}
+
+func (q queryEventFilter) match(e QueryEvent) bool {
+	return (q.client == "" || strings.HasPrefix(e.Client, q.client)) &&
+		(q.name == "" || strings.Contains(e.Name, q.name)) &&
+		(q.qtype == "" || e.Type == q.qtype) &&
+		(q.rcode == "" || e.Rcode == q.rcode)
+}
+
+// recordQueryEvent adds an answered query to the live feed
+func recordQueryEvent(at time.Time, client string, r *dns.Msg, rcode int, source string, took time.Duration) {
+	e := QueryEvent{
+		Time:       at,
+		Client:     client,
+		Rcode:      dns.RcodeToString[rcode],
+		Source:     source,
+		DurationMS: float64(took.Microseconds()) / 1000,
+	}
+	if len(r.Question) > 0 {
+		e.Name = strings.ToLower(r.Question[0].Name)
+		e.Type = dns.TypeToString[r.Question[0].Qtype]
+	}
+	queryFeed.Add(e)
+}
+
+// handleAPIRecentQueries handles GET /api/queries/recent, the stored
+// queries matching the filters, newest first (?limit=100)
+func handleAPIRecentQueries(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > queryFeedSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", queryFeedSize)})
+		return
+	}
+	filter := parseQueryEventFilter(c)
+	events := queryFeed.Recent(0)
+	out := make([]QueryEvent, 0, limit)
+	for i := len(events) - 1; i >= 0 && len(out) < limit; i-- {
+		if filter.match(events[i]) {
+			out = append(out, events[i])
+		}
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// handleAPIQueryStream handles GET /api/queries/stream, a Server-Sent
+// Events stream of the queries matching the filters. It starts with the
+// stored queries after Last-Event-ID (or the last ?backlog=50 ones).
+func handleAPIQueryStream(c *gin.Context) {
+	backlog, err := strconv.Atoi(c.DefaultQuery("backlog", "50"))
+	if err != nil || backlog < 0 || backlog > queryFeedSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("backlog must be between 0 and %d", queryFeedSize)})
+		return
+	}
+	filter := parseQueryEventFilter(c)
+	var after uint64
+	resume := false
+	if id, err := strconv.ParseUint(c.GetHeader("Last-Event-ID"), 10, 64); err == nil {
+		after, resume = id, true
+	}
+
+	ch, unsubscribe := queryFeed.Subscribe()
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	var sent uint64
+	send := func(e QueryEvent) {
+		if e.ID <= sent || !filter.match(e) {
+			return
+		}
+		sent = e.ID
+		data, _ := json.Marshal(e)
+		fmt.Fprintf(c.Writer, "id: %d\nevent: query\ndata: %s\n\n", e.ID, data)
+	}
+
+	var stored []QueryEvent
+	for _, e := range queryFeed.Recent(after) {
+		if filter.match(e) {
+			stored = append(stored, e)
+		}
+	}
+	if !resume && len(stored) > backlog {
+		stored = stored[len(stored)-backlog:]
+	}
+	for _, e := range stored {
+		send(e)
+	}
+	c.Writer.Flush()
+
+	keepalive := time.NewTicker(queryFeedKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case e := <-ch:
+			send(e)
+			// Send the queries arriving together in one write
+			for len(ch) > 0 {
+				send(<-ch)
+			}
+			c.Writer.Flush()
+		case <-keepalive.C:
+			fmt.Fprint(c.Writer, ": keepalive\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// defaultRootSources serve the root zone by AXFR (RFC 8806 appendix A):
+// lax.xfr.dns.icann.org and iad.xfr.dns.icann.org
+var defaultRootSources = []string{"192.0.32.132:53", "192.0.47.132:53"}
+
+// loadRootHints reads the addresses of the root servers from a root hints
+// file (named.root): the A records of the names of the root NS records
+func loadRootHints(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	servers := make(map[string]bool)
+	var addrs []*dns.A
+	zp := dns.NewZoneParser(f, ".", path)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch rr := rr.(type) {
+		case *dns.NS:
+			if rr.Hdr.Name == "." {
+				servers[strings.ToLower(rr.Ns)] = true
+			}
+		case *dns.A:
+			addrs = append(addrs, rr)
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, fmt.Errorf("invalid root hints %s: %w", path, err)
+	}
+	var hints []string
+	for _, a := range addrs {
+		if servers[strings.ToLower(a.Hdr.Name)] {
+			hints = append(hints, a.A.String())
+		}
+	}
+	if len(hints) == 0 {
+		return nil, fmt.Errorf("no root server address in %s", path)
+	}
+	return hints, nil
+}
+
+// parseRootSources returns the servers the root zone is transferred from,
+// with port 53 by default
+func parseRootSources(sources []string) ([]string, error) {
+	if len(sources) == 0 {
+		return defaultRootSources, nil
+	}
+	out := make([]string, 0, len(sources))
+	for _, s := range sources {
+		s = strings.TrimSpace(s)
+		if ip := net.ParseIP(strings.Trim(s, "[]")); ip != nil {
+			s = net.JoinHostPort(ip.String(), "53")
+		}
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			return nil, fmt.Errorf("invalid local_root_sources entry %q", s)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// transferRoot fetches the root zone from the first source that sends a
+// complete copy
+func transferRoot(sources []string) (*ZoneData, *dns.SOA, error) {
+	var lastErr error
+	for _, src := range sources {
+		m := new(dns.Msg)
+		m.SetAxfr(".")
+		t := &dns.Transfer{DialTimeout: 5 * time.Second, ReadTimeout: 30 * time.Second}
+		env, err := t.In(m, src)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		zd := NewZoneData()
+		zd.AddZone(".")
+		var soa *dns.SOA
+		for e := range env {
+			if e.Error != nil {
+				err = e.Error
+				break
+			}
+			for _, rr := range e.RR {
+				if s, ok := rr.(*dns.SOA); ok {
+					if soa != nil {
+						continue // the closing SOA
+					}
+					soa = s
+				}
+				zd.AddRR(rr)
+			}
+		}
+		if err == nil && soa == nil {
+			err = fmt.Errorf("no SOA in the transfer")
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", src, err)
+			continue
+		}
+		return zd, soa, nil
+	}
+	return nil, nil, lastErr
+}
+
+// rootSerial asks the sources for the serial of the root zone
+func rootSerial(sources []string) (uint32, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(".", dns.TypeSOA)
+	c := &dns.Client{Timeout: 5 * time.Second}
+	var lastErr error
+	for _, src := range sources {
+		resp, _, err := c.Exchange(m, src)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, rr := range resp.Answer {
+			if soa, ok := rr.(*dns.SOA); ok {
+				return soa.Serial, nil
+			}
+		}
+		lastErr = fmt.Errorf("%s sent no SOA", src)
+	}
+	return 0, lastErr
+}
+
+// keepLocalRoot transfers the root zone and refreshes it as its SOA says
+// until the process exits. A copy that could not be refreshed for the
+// expire time of the zone is dropped, and the root servers are asked again.
+func (r *iterativeResolver) keepLocalRoot(sources []string) {
+	var serial uint32
+	refreshed := time.Now()
+	refresh, retry, expire := time.Hour, 5*time.Minute, 7*24*time.Hour
+	for {
+		wait := refresh
+		current, err := rootSerial(sources)
+		if err == nil && (r.localRoot.Load() == nil || serialNewer(current, serial)) {
+			var zd *ZoneData
+			var soa *dns.SOA
+			if zd, soa, err = transferRoot(sources); err == nil {
+				r.localRoot.Store(zd)
+				serial = soa.Serial
+				refresh = time.Duration(soa.Refresh) * time.Second
+				retry = time.Duration(soa.Retry) * time.Second
+				expire = time.Duration(soa.Expire) * time.Second
+				wait = refresh
+				slog.Info("Loaded a local copy of the root zone", "serial", serial, "records", zd.RecordCount())
+			}
+		}
+		if err == nil {
+			refreshed = time.Now()
+		} else {
+			slog.Warn("failed to refresh the local root zone", "error", err)
+			wait = retry
+			if r.localRoot.Load() != nil && time.Since(refreshed) > expire {
+				r.localRoot.Store(nil)
+				slog.Warn("Local root zone expired, asking the root servers")
+			}
+		}
+		time.Sleep(max(wait, time.Minute))
+	}
+}
+
+// rootAnswer answers a query to the root servers from the local copy of
+// the root zone, nil when there is none
+func (r *iterativeResolver) rootAnswer(qname string, qtype uint16, do bool) *dns.Msg {
+	zd := r.localRoot.Load()
+	if zd == nil {
+		return nil
+	}
+	res := zd.Resolve(qname)
+	m := new(dns.Msg)
+	m.SetQuestion(qname, qtype)
+	m.Response = true
+	apex, _ := zd.Lookup(".")
+	switch {
+	case len(res.Delegation) > 0 && !(qtype == dns.TypeDS && strings.EqualFold(res.Delegation[0].Header().Name, qname)):
+		m.Ns = res.Delegation
+		if do {
+			cutRRs, _ := zd.Lookup(res.Delegation[0].Header().Name)
+			ds := filterRRs(cutRRs, dns.TypeDS)
+			m.Ns = append(append(m.Ns, ds...), signaturesFor(cutRRs, ds)...)
+		}
+		m.Extra = zd.Glue(res.Delegation)
+	case res.Exists:
+		m.Authoritative = true
+		m.Answer = filterRRs(res.Records, qtype)
+		if do {
+			m.Answer = append(m.Answer, signaturesFor(res.Records, m.Answer)...)
+		}
+		if len(m.Answer) == 0 {
+			m.Ns = filterRRs(apex, dns.TypeSOA)
+		}
+	default:
+		m.Authoritative = true
+		m.Rcode = dns.RcodeNameError
+		m.Ns = filterRRs(apex, dns.TypeSOA)
+	}
+	return m
+}
+
+// exchangeRoot answers from the local root zone when zone is the root
+// and there is one, or asks servers
+func (st *resolution) exchangeRoot(ctx context.Context, zone string, servers []string, qname string, qtype uint16, usable func(*dns.Msg) bool) (*dns.Msg, error) {
+	if zone == "." {
+		if resp := st.r.rootAnswer(qname, qtype, st.do); resp != nil {
+			return resp, nil
+		}
+	}
+	return st.exchange(ctx, servers, qname, qtype, usable)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// LogConfig selects the log format and destination
+type LogConfig struct {
+	Level         string // debug, info, warn, error
+	Format        string // text (default) or json
+	Output        string // stderr (default), file or syslog
+	File          string // path for the file output
+	MaxSizeMB     int    // rotate the file past this size (default 100)
+	MaxBackups    int    // rotated files kept (default 5)
+	SyslogAddress string // remote syslog host:port over UDP, local syslog when empty
+}
+
+// logOutput is closed on shutdown (nil for stderr)
+var logOutput io.Closer
+
+// parseLogLevel maps a level name to a slog level, info by default
+func parseLogLevel(name string) slog.Level {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// setupLogging installs the default slog logger described by cfg. On error
+// the current logger is kept.
+func setupLogging(cfg LogConfig) error {
+	opts := &slog.HandlerOptions{Level: parseLogLevel(cfg.Level)}
+	newHandler := func(w io.Writer) slog.Handler {
+		if cfg.Format == "json" {
+			return slog.NewJSONHandler(w, opts)
+		}
+		return slog.NewTextHandler(w, opts)
+	}
+
+	switch cfg.Format {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("unknown log_format %q", cfg.Format)
+	}
+
+	var handler slog.Handler
+	var closer io.Closer
+	switch cfg.Output {
+	case "", "stderr":
+		handler = newHandler(os.Stderr)
+	case "file":
+		if cfg.File == "" {
+			return fmt.Errorf("log_output file needs log_file")
+		}
+		maxSize := int64(cfg.MaxSizeMB) << 20
+		if maxSize <= 0 {
+			maxSize = 100 << 20
+		}
+		maxBackups := cfg.MaxBackups
+		if maxBackups <= 0 {
+			maxBackups = 5
+		}
+		f, err := openRotatingFile(cfg.File, maxSize, maxBackups)
+		if err != nil {
+			return err
+		}
+		handler, closer = newHandler(f), f
+	case "syslog":
+		// syslog adds its own timestamp
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		}
+		h, c, err := newSyslogHandler(cfg.SyslogAddress, newHandler)
+		if err != nil {
+			return err
+		}
+		handler, closer = h, c
+	default:
+		return fmt.Errorf("unknown log_output %q", cfg.Output)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	closeLogging()
+	logOutput = closer
+	return nil
+}
+
+// closeLogging closes the log file or syslog connection
+func closeLogging() {
+	if logOutput != nil {
+		_ = logOutput.Close()
+		logOutput = nil
+	}
+}
+
+// leveledHandler formats records with an inner handler into a buffer and
+// passes each line, with its level, to emit. Used for destinations that
+// take one message per record with a severity (syslog).
+type leveledHandler struct {
+	slog.Handler
+	mu   *sync.Mutex
+	buf  *bytes.Buffer
+	emit func(level slog.Level, line string) error
+}
+
+func newLeveledHandler(newHandler func(io.Writer) slog.Handler, emit func(slog.Level, string) error) *leveledHandler {
+	buf := &bytes.Buffer{}
+	return &leveledHandler{Handler: newHandler(buf), mu: &sync.Mutex{}, buf: buf, emit: emit}
+}
+
+func (h *leveledHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf.Reset()
+	if err := h.Handler.Handle(ctx, r); err != nil {
+		return err
+	}
+	return h.emit(r.Level, strings.TrimSuffix(h.buf.String(), "\n"))
+}
+
+func (h *leveledHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &leveledHandler{Handler: h.Handler.WithAttrs(attrs), mu: h.mu, buf: h.buf, emit: h.emit}
+}
+
+func (h *leveledHandler) WithGroup(name string) slog.Handler {
+	return &leveledHandler{Handler: h.Handler.WithGroup(name), mu: h.mu, buf: h.buf, emit: h.emit}
+}
+
+// rotatingFile is a log file rotated by size: app.log is renamed app.log.1,
+// app.log.1 becomes app.log.2, and so on up to maxBackups
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) rotate() error {
+	_ = r.f.Close()
+	_ = os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxBackups))
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	_ = os.Rename(r.path, r.path+".1")
+	return r.open()
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
@@ -0,0 +1,35 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"io"
+	"log/slog"
+	"log/syslog"
+)
+
+// newSyslogHandler logs to the local syslog daemon, or to address (UDP)
+// when set, mapping slog levels to syslog severities
+func newSyslogHandler(address string, newHandler func(io.Writer) slog.Handler) (slog.Handler, io.Closer, error) {
+	network := ""
+	if address != "" {
+		network = "udp"
+	}
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, "simpledns")
+	if err != nil {
+		return nil, nil, err
+	}
+	h := newLeveledHandler(newHandler, func(level slog.Level, line string) error {
+		switch {
+		case level >= slog.LevelError:
+			return w.Err(line)
+		case level >= slog.LevelWarn:
+			return w.Warning(line)
+		case level >= slog.LevelInfo:
+			return w.Info(line)
+		default:
+			return w.Debug(line)
+		}
+	})
+	return h, w, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
@@ -15,6 +16,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -23,13 +25,9 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-var zones map[string][]dns.RR
-var forwarders []string
 var forwardTimeout time.Duration = 2 * time.Second
-var loadedZoneNames []string
-var dbMode string = "files" // "files" or "sqlite"
+var dbMode string = "files" // "files", "sqlite", "kv" or "git"
 var dnsPort int = 53
-var serverRole string = "master"
 var version = "dev" // Set at build time with -ldflags "-X main.version=1.0.0"
 
 // flag types that track whether they were set on the command line
@@ -64,6 +62,13 @@ type YAMLZoneConfig struct {
 		Name   string `yaml:"name"`
 		Origin string `yaml:"origin"`
 		TTL    int    `yaml:"ttl"`
+		// Type is "primary" (the default) or "forward": the names of a
+		// forward zone are sent to its forwarders and never answered locally
+		Type       string   `yaml:"type"`
+		Forwarders []string `yaml:"forwarders"`
+		// AddressFilter (AAAA or A) hides that type for names having the
+		// other one
+		AddressFilter string `yaml:"address_filter"`
 	} `yaml:"zone_config"`
 	SOA struct {
 		NS      string `yaml:"ns"`
@@ -73,32 +78,165 @@ type YAMLZoneConfig struct {
 		Retry   int    `yaml:"retry"`
 		Expire  int    `yaml:"expire"`
 	} `yaml:"soa"`
-	DNSRecords []struct {
-		Name  string `yaml:"name"`
-		Type  string `yaml:"type"`
-		Value string `yaml:"value"`
-		TTL   int    `yaml:"ttl"`
-	} `yaml:"dns_records"`
+	DNSRecords []YAMLRecord `yaml:"dns_records"`
+}
+
+// YAMLRecord is one record of a YAML zone
+type YAMLRecord struct {
+	Name  string `yaml:"name" json:"name"`
+	Type  string `yaml:"type" json:"type"`
+	Value string `yaml:"value" json:"value"`
+	TTL   int    `yaml:"ttl" json:"ttl,omitempty"`
 }
 
 // debug can be enabled via the CLI flag `-debug`
 
 type AppConfig struct {
-	DBType            string   `yaml:"db_type" json:"db_type,omitempty"`
-	DBPath            string   `yaml:"db_path" json:"db_path,omitempty"`
-	ZonesDir          string   `yaml:"zones_dir" json:"zones_dir,omitempty"`
-	Forwarders        []string `yaml:"forwarders" json:"forwarders,omitempty"`
-	ForwardTimeoutSec int      `yaml:"forward_timeout_seconds" json:"forward_timeout_seconds,omitempty"`
-	Addr              string   `yaml:"addr" json:"addr,omitempty"`
-	WebEnabled        bool     `yaml:"web_enabled" json:"web_enabled,omitempty"`
-	WebPort           int      `yaml:"web_port" json:"web_port,omitempty"`
-	DNSPort           int      `yaml:"dns_port" json:"dns_port,omitempty"`
-	ServerRole        string   `yaml:"server_role" json:"server_role,omitempty"`
+	DBType              string            `yaml:"db_type" json:"db_type,omitempty"`
+	DBPath              string            `yaml:"db_path" json:"db_path,omitempty"`
+	ZonesDir            string            `yaml:"zones_dir" json:"zones_dir,omitempty"`
+	Forwarders          []ForwarderConfig `yaml:"forwarders" json:"forwarders,omitempty"`
+	ForwardTimeoutSec   int               `yaml:"forward_timeout_seconds" json:"forward_timeout_seconds,omitempty"`
+	ForwardMaxInflight  int               `yaml:"forward_max_inflight" json:"forward_max_inflight,omitempty"`
+	ForwardMaxQueue     int               `yaml:"forward_max_queue" json:"forward_max_queue,omitempty"`
+	Addr                string            `yaml:"addr" json:"addr,omitempty"`
+	WebEnabled          bool              `yaml:"web_enabled" json:"web_enabled,omitempty"`
+	WebPort             int               `yaml:"web_port" json:"web_port,omitempty"`
+	WebTLSPort          int               `yaml:"web_tls_port" json:"web_tls_port,omitempty"`
+	TLSCertFile         string            `yaml:"tls_cert_file" json:"tls_cert_file,omitempty"`
+	TLSKeyFile          string            `yaml:"tls_key_file" json:"tls_key_file,omitempty"`
+	WebHTTPSRedirect    bool              `yaml:"web_https_redirect" json:"web_https_redirect,omitempty"`
+	WebSecureCookie     bool              `yaml:"web_secure_cookie" json:"web_secure_cookie,omitempty"`
+	WebAssetsCDN        bool              `yaml:"web_assets_cdn" json:"web_assets_cdn,omitempty"`
+	DNSPort             int               `yaml:"dns_port" json:"dns_port,omitempty"`
+	DoTPort             int               `yaml:"dot_port" json:"dot_port,omitempty"`
+	DoQPort             int               `yaml:"doq_port" json:"doq_port,omitempty"` // experimental
+	ServerRole          string            `yaml:"server_role" json:"server_role,omitempty"`
+	AnyResponse         string            `yaml:"any_response" json:"any_response,omitempty"`
+	ComplianceMode      bool              `yaml:"compliance_mode" json:"compliance_mode,omitempty"`
+	VerifyIntervalSec   int               `yaml:"verify_interval_seconds" json:"verify_interval_seconds,omitempty"`
+	ProblemsIntervalSec int               `yaml:"problems_interval_seconds" json:"problems_interval_seconds,omitempty"`
+	SerialFormat        string            `yaml:"serial_format" json:"serial_format,omitempty"`
+	MinTTL              int               `yaml:"min_ttl" json:"min_ttl,omitempty"`
+	MaxTTL              int               `yaml:"max_ttl" json:"max_ttl,omitempty"`
+	LogLevel            string            `yaml:"log_level" json:"log_level,omitempty"`
+	LogFormat           string            `yaml:"log_format" json:"log_format,omitempty"`
+	LogOutput           string            `yaml:"log_output" json:"log_output,omitempty"`
+	LogFile             string            `yaml:"log_file" json:"log_file,omitempty"`
+	LogMaxSizeMB        int               `yaml:"log_max_size_mb" json:"log_max_size_mb,omitempty"`
+	LogMaxBackups       int               `yaml:"log_max_backups" json:"log_max_backups,omitempty"`
+	LogSyslogAddress    string            `yaml:"log_syslog_address" json:"log_syslog_address,omitempty"`
+	ReusePort           bool              `yaml:"reuse_port" json:"reuse_port,omitempty"`
+	ShutdownDrainSec    int               `yaml:"shutdown_drain_seconds" json:"shutdown_drain_seconds,omitempty"`
+	DebugDumpDir        string            `yaml:"debug_dump_dir" json:"debug_dump_dir,omitempty"` // SIGUSR1 dumps, logged when empty
+	CatalogZone         string            `yaml:"catalog_zone" json:"catalog_zone,omitempty"`
+	AllowTransfer       []string          `yaml:"allow_transfer" json:"allow_transfer,omitempty"`
+	InstanceName        string            `yaml:"instance_name" json:"instance_name,omitempty"`
+	NSID                bool              `yaml:"nsid" json:"nsid,omitempty"`
+	DisabledZoneResp    string            `yaml:"disabled_zone_response" json:"disabled_zone_response,omitempty"`
+	// Records above which deleting a zone needs a confirmation token
+	// (default 20, negative never asks)
+	ZoneDeleteConfirmRecords int `yaml:"zone_delete_confirm_records" json:"zone_delete_confirm_records,omitempty"`
+	// Days deleted zones and records stay in the trash (default 30,
+	// negative deletes them for good at once)
+	TrashRetentionDays int `yaml:"trash_retention_days" json:"trash_retention_days,omitempty"`
+
+	// Network profiles (roaming/laptop mode)
+	Profiles                []NetworkProfile `yaml:"profiles" json:"profiles,omitempty"`
+	Profile                 string           `yaml:"profile" json:"profile,omitempty"`
+	ProfileCheckIntervalSec int              `yaml:"profile_check_interval_seconds" json:"profile_check_interval_seconds,omitempty"`
+	SSIDCommand             *string          `yaml:"ssid_command" json:"ssid_command,omitempty"`
+
+	// Built-in ACME client (certificates for the TLS listeners)
+	ACME ACMEConfig `yaml:"acme" json:"acme,omitempty"`
+
+	// Cache of forwarded answers
+	Cache CacheConfig `yaml:"cache" json:"cache,omitempty"`
+
+	// Protections of the forwarded queries against spoofed responses
+	ForwardSecurity ForwardSecurityConfig `yaml:"forward_security" json:"forward_security,omitempty"`
+	// DNS rebinding protection of the forwarded answers
+	RebindingProtection RebindingConfig `yaml:"rebinding_protection" json:"rebinding_protection,omitempty"`
+
+	// Built-in recursive resolver, in place of the forwarders
+	Recursion RecursionConfig `yaml:"recursion" json:"recursion,omitempty"`
+
+	// dnstap export of queries and responses
+	Dnstap DnstapConfig `yaml:"dnstap" json:"dnstap,omitempty"`
+
+	// Retention of the query statistics in the database (sqlite mode)
+	Stats StatsConfig `yaml:"stats" json:"stats,omitempty"`
+
+	// Metrics push to InfluxDB or Graphite
+	Metrics MetricsConfig `yaml:"metrics" json:"metrics,omitempty"`
+
+	// Scheduled backups (sqlite mode)
+	Backup BackupConfig `yaml:"backup" json:"backup,omitempty"`
+
+	// etcd or Consul zone backend (db_type: kv)
+	KV KVConfig `yaml:"kv" json:"kv,omitempty"`
+
+	// Checks of the /readyz probe
+	Readiness ReadinessConfig `yaml:"readiness" json:"readiness,omitempty"`
+
+	// Go profiler, on the web port or its own listener
+	Pprof PprofConfig `yaml:"pprof" json:"pprof,omitempty"`
+
+	// Zones pulled from a Git repository (db_type: git)
+	Git GitConfig `yaml:"git" json:"git,omitempty"`
+
+	// Services and Ingresses published from a Kubernetes cluster
+	Kubernetes KubernetesConfig `yaml:"kubernetes" json:"kubernetes,omitempty"`
+
+	// Records of the running Docker containers
+	Docker DockerConfig `yaml:"docker" json:"docker,omitempty"`
+
+	// Records of the leases of a DHCP server
+	DHCP DHCPConfig `yaml:"dhcp" json:"dhcp,omitempty"`
+
+	// Records of the Tailscale nodes and WireGuard peers
+	VPN VPNConfig `yaml:"vpn" json:"vpn,omitempty"`
+
+	// .local names resolved over mDNS/LLMNR for unicast clients
+	MDNS MDNSConfig `yaml:"mdns" json:"mdns,omitempty"`
+
+	// AAAA synthesis for IPv6-only clients behind NAT64
+	DNS64 DNS64Config `yaml:"dns64" json:"dns64,omitempty"`
+
+	// A or AAAA answers hidden from clients with a broken network
+	AddressFilter []AddressFilterRule `yaml:"address_filter" json:"address_filter,omitempty"`
+
+	// /etc/hosts-style files answered ahead of the forwarders
+	Hosts HostsConfig `yaml:"hosts" json:"hosts,omitempty"`
+
+	// Suffixes tried for the single-label names of some clients
+	SearchDomains []SearchDomainRule `yaml:"search_domains" json:"search_domains,omitempty"`
+
+	// Blocked domains answered with the address of a block page
+	Sinkhole SinkholeConfig `yaml:"sinkhole" json:"sinkhole,omitempty"`
+
+	// Client names and policy groups
+	Clients ClientsConfig `yaml:"clients" json:"clients,omitempty"`
+
+	// Login throttling, API rate limits, CORS and security headers
+	WebSecurity WebSecurityConfig `yaml:"web_security" json:"web_security,omitempty"`
+
+	// Answers to CHAOS class queries (version.bind, hostname.bind, id.server)
+	Chaos ChaosConfig `yaml:"chaos" json:"chaos,omitempty"`
+
+	// Reminders of the zone review dates, by webhook and email (sqlite mode)
+	ZoneReminders ZoneRemindersConfig `yaml:"zone_reminders" json:"zone_reminders,omitempty"`
+
+	// Mail server of the alerts and reminders, and the alerts emailed
+	SMTP   SMTPConfig   `yaml:"smtp" json:"smtp,omitempty"`
+	Alerts AlertsConfig `yaml:"alerts" json:"alerts,omitempty"`
 }
 
 type ForwarderDisplay struct {
+	ID      int64 // sqlite mode only
 	Address string
 	Display string
+	Stat    UpstreamStat
 }
 
 func loadAppConfig(path string) (*AppConfig, error) {
@@ -133,22 +271,6 @@ func parseForwarders(s string) []string {
 	return out
 }
 
-func forwardQuery(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
-	c := &dns.Client{Timeout: forwardTimeout}
-	for _, srv := range forwarders {
-		resp, _, err := c.ExchangeContext(ctx, msg, srv)
-		if err != nil {
-			slog.Debug("forward to %s failed", "server", srv, "error", err)
-			continue
-		}
-		if resp == nil {
-			continue
-		}
-		return resp, nil
-	}
-	return nil, fmt.Errorf("no upstream answered")
-}
-
 func mustNewRR(s string) dns.RR {
 	rr, err := dns.NewRR(s)
 	if err != nil {
@@ -157,8 +279,8 @@ func mustNewRR(s string) dns.RR {
 	return rr
 }
 
-// loadZonesFromYAMLFile loads a single YAML zone file
-func loadZonesFromYAMLFile(path string) error {
+// loadZonesFromYAMLFile loads a single YAML zone file into zd
+func loadZonesFromYAMLFile(zd *ZoneData, path string) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return err
@@ -167,31 +289,67 @@ func loadZonesFromYAMLFile(path string) error {
 	if err := yaml.Unmarshal(data, &zoneConfig); err != nil {
 		return fmt.Errorf("invalid YAML zone file %s: %w", path, err)
 	}
+	if err := addYAMLZone(zd, &zoneConfig); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
 
-	if zones == nil {
-		zones = make(map[string][]dns.RR)
+// addYAMLZone adds a YAML zone to zd, as a forward zone or with its records
+func addYAMLZone(zd *ZoneData, zoneConfig *YAMLZoneConfig) error {
+	filter, err := parseAddressFilterType(zoneConfig.ZoneConfig.AddressFilter)
+	if err != nil {
+		return err
+	}
+	if filter != 0 {
+		zd.SetAddressFilter(zoneConfig.ZoneConfig.Name, filter)
+	}
+	switch zoneConfig.ZoneConfig.Type {
+	case "", zoneTypePrimary:
+	case zoneTypeForward:
+		upstreams, err := parseZoneForwarders(strings.Join(zoneConfig.ZoneConfig.Forwarders, ","))
+		if err != nil {
+			return err
+		}
+		zd.AddForwardZone(zoneConfig.ZoneConfig.Name, upstreams)
+		return nil
+	default:
+		return fmt.Errorf("unknown zone type %q (primary or forward)", zoneConfig.ZoneConfig.Type)
+	}
+	zoneName, rrs, err := yamlZoneRRs(zoneConfig)
+	if err != nil {
+		return err
 	}
+	zd.AddZone(zoneName)
+	for _, rr := range rrs {
+		zd.AddRR(rr)
+	}
+	return nil
+}
 
+// yamlZoneRRs converts a YAML zone to its records, SOA and NS first
+func yamlZoneRRs(zoneConfig *YAMLZoneConfig) (string, []dns.RR, error) {
 	zoneName := dns.Fqdn(zoneConfig.ZoneConfig.Name)
-	loadedZoneNames = append(loadedZoneNames, zoneName)
 
-	// Convert SOA record
+	// Convert SOA and NS records
 	soaStr := fmt.Sprintf("%s 3600 IN SOA %s %s %d %d %d %d 3600",
 		zoneName,
 		zoneConfig.SOA.NS,
-		strings.Replace(zoneConfig.SOA.Admin, "@", ".", 1),
+		soaMailbox(zoneConfig.SOA.Admin, zoneName),
 		zoneConfig.SOA.Serial,
 		zoneConfig.SOA.Refresh,
 		zoneConfig.SOA.Retry,
 		zoneConfig.SOA.Expire,
 	)
-	soaRR := mustNewRR(soaStr)
-	zones[zoneName] = append(zones[zoneName], soaRR)
-
-	// Convert NS record
 	nsStr := fmt.Sprintf("%s 3600 IN NS %s", zoneName, zoneConfig.SOA.NS)
-	nsRR := mustNewRR(nsStr)
-	zones[zoneName] = append(zones[zoneName], nsRR)
+	var rrs []dns.RR
+	for _, s := range []string{soaStr, nsStr} {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid RR %q: %w", s, err)
+		}
+		rrs = append(rrs, rr)
+	}
 
 	// Convert DNS records
 	for _, record := range zoneConfig.DNSRecords {
@@ -200,34 +358,24 @@ func loadZonesFromYAMLFile(path string) error {
 			ttl = zoneConfig.ZoneConfig.TTL
 		}
 
-		// Build record name (relative to zone origin)
-		recordName := record.Name
-		if recordName == "@" {
-			recordName = zoneName
-		} else if !strings.HasSuffix(recordName, ".") {
-			recordName = recordName + "." + zoneName
-		}
-
-		rrStr := fmt.Sprintf("%s %d IN %s %s", recordName, ttl, record.Type, record.Value)
+		rrStr := fmt.Sprintf("%s %d IN %s %s", recordOwner(record.Name, zoneName), clampTTL(uint32(ttl)), record.Type, rdataText(record.Type, record.Value))
 		rr, err := dns.NewRR(rrStr)
 		if err != nil {
-			return fmt.Errorf("invalid RR in %s: %q: %w", path, rrStr, err)
+			return "", nil, fmt.Errorf("invalid RR %q: %w", rrStr, err)
 		}
-		name := dns.Fqdn(rr.Header().Name)
-		zones[name] = append(zones[name], rr)
+		rrs = append(rrs, rr)
 	}
 
-	return nil
+	return zoneName, rrs, nil
 }
 
-func loadZonesFromDir(dir string) error {
+// buildZonesFromDir loads every YAML zone file in dir into a new snapshot
+func buildZonesFromDir(dir string) (*ZoneData, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return err
-	}
-	if zones == nil {
-		zones = make(map[string][]dns.RR)
+		return nil, err
 	}
+	zd := NewZoneData()
 	for _, e := range entries {
 		if e.IsDir() {
 			continue
@@ -237,13 +385,22 @@ func loadZonesFromDir(dir string) error {
 
 		// Only load YAML files (.yaml or .yml)
 		if strings.HasSuffix(base, ".yaml") || strings.HasSuffix(base, ".yml") {
-			if err := loadZonesFromYAMLFile(path); err != nil {
-				return fmt.Errorf("parse YAML %s: %w", path, err)
+			if err := loadZonesFromYAMLFile(zd, path); err != nil {
+				return nil, fmt.Errorf("parse YAML %s: %w", path, err)
 			}
 		}
 		// Ignore other file types
 	}
-	return nil
+	addDynamicZones(zd)
+	addCatalogZone(zd)
+	return zd, nil
+}
+
+// loadZonesFromDir replaces the live zones with the YAML files in dir
+func loadZonesFromDir(dir string) error {
+	return zoneStore.Rebuild(func() (*ZoneData, error) {
+		return buildZonesFromDir(dir)
+	})
 }
 
 func initZones(confDir string) {
@@ -251,6 +408,7 @@ func initZones(confDir string) {
 	if confDir != "" {
 		if info, err := os.Stat(confDir); err == nil && info.IsDir() {
 			if err := loadZonesFromDir(confDir); err == nil {
+				loadedZonesDir = confDir
 				slog.Info("Loaded zones from directory", "path", confDir)
 				return
 			} else {
@@ -260,14 +418,17 @@ func initZones(confDir string) {
 	}
 
 	// Fallback defaults
-	zones = map[string][]dns.RR{
-		"example.local.": {
-			mustNewRR("example.local. 3600 IN A 127.0.0.1"),
-		},
-		"www.example.local.": {
-			mustNewRR("www.example.local. 3600 IN CNAME example.local."),
-		},
-	}
+	zoneStore.Replace(buildDefaultZones())
+}
+
+// buildDefaultZones returns the example records served when no zones
+// directory is loaded
+func buildDefaultZones() *ZoneData {
+	zd := NewZoneData()
+	zd.AddRR(mustNewRR("example.local. 3600 IN A 127.0.0.1"))
+	zd.AddRR(mustNewRR("www.example.local. 3600 IN CNAME example.local."))
+	addDynamicZones(zd)
+	return zd
 }
 
 // ZoneInfo represents zone information for the web interface
@@ -276,6 +437,15 @@ type ZoneInfo struct {
 	Name    string       `json:"name"`
 	Enabled bool         `json:"enabled"`
 	Records []RecordInfo `json:"records"`
+	// RecordCount is the number of records of the zone; in sqlite mode
+	// Records is only loaded for the zone shown
+	RecordCount int `json:"record_count"`
+	// Forwarders is set for a forward zone, Primaries for a secondary zone
+	Forwarders []string `json:"forwarders,omitempty"`
+	Primaries  []string `json:"primaries,omitempty"`
+	// Owner and Review (due or overdue) come from the zone notes
+	Owner  string `json:"owner,omitempty"`
+	Review string `json:"review,omitempty"`
 }
 
 // RecordInfo represents a DNS record for the web interface
@@ -286,6 +456,12 @@ type RecordInfo struct {
 	Value    string `json:"value"`
 	TTL      uint32 `json:"ttl"`
 	Priority int    `json:"priority"`
+	Version  int64  `json:"version,omitempty"`
+	RecordSchedule
+	RecordNotes
+	RecordCaching
+	// SetContinued is set on a row of the same RRset as the row before it
+	SetContinued bool `json:"-"`
 }
 
 // getZonesInfo returns structured information about loaded zones
@@ -298,9 +474,10 @@ func getZonesInfo() []ZoneInfo {
 	// In files mode, build from in-memory zones
 	zoneMap := make(map[string]*ZoneInfo)
 
-	for name, rrList := range zones {
+	zd := zoneStore.Load()
+	zd.Each(func(name string, rrList []dns.RR) {
 		for _, rr := range rrList {
-			zoneName := findZoneForRecord(name)
+			zoneName := zd.FindZone(name)
 			if zoneName == "" {
 				zoneName = name
 			}
@@ -317,41 +494,57 @@ func getZonesInfo() []ZoneInfo {
 			}
 			zoneMap[zoneName].Records = append(zoneMap[zoneName].Records, record)
 		}
-	}
+	})
 
 	result := make([]ZoneInfo, 0, len(zoneMap))
 	for _, zi := range zoneMap {
+		zi.RecordCount = len(zi.Records)
 		result = append(result, *zi)
 	}
+	for _, name := range zd.ForwardZoneNames() {
+		upstreams, _ := zd.ForwardZone(name)
+		result = append(result, ZoneInfo{Name: strings.TrimSuffix(name, "."), Enabled: true, Records: []RecordInfo{}, Forwarders: upstreams})
+	}
 	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
 	return result
 }
 
-// getZonesInfoFromDB returns zone info from SQLite database with IDs
+// getZonesInfoFromDB returns zone info from SQLite database with IDs and
+// record counts, without the records
 func getZonesInfoFromDB() []ZoneInfo {
 	dbZones, err := database.ListZones()
 	if err != nil {
 		return nil
 	}
+	counts, err := database.RecordCounts()
+	if err != nil {
+		slog.Error("failed to count records", "error", err)
+	}
+	notes := make(map[int64]ZoneNotes)
+	if list, err := database.ListZoneNotes(); err != nil {
+		slog.Error("failed to list zone notes", "error", err)
+	} else {
+		for _, n := range list {
+			notes[n.ZoneID] = n.ZoneNotes
+		}
+	}
+	now := time.Now()
 
 	result := make([]ZoneInfo, 0, len(dbZones))
 	for _, dbZone := range dbZones {
 		zi := ZoneInfo{
-			ID:      dbZone.ID,
-			Name:    strings.TrimSuffix(dbZone.Name, "."),
-			Enabled: dbZone.Enabled,
-		}
-
-		records, _ := database.ListRecordsByZone(dbZone.ID)
-		for _, r := range records {
-			zi.Records = append(zi.Records, RecordInfo{
-				ID:       r.ID,
-				Name:     r.Name,
-				Type:     r.Type,
-				Value:    r.Value,
-				TTL:      uint32(r.TTL),
-				Priority: r.Priority,
-			})
+			ID:          dbZone.ID,
+			Name:        strings.TrimSuffix(dbZone.Name, "."),
+			Enabled:     dbZone.Enabled,
+			RecordCount: counts[dbZone.ID],
+			Owner:       notes[dbZone.ID].Owner,
+			Review:      reviewStage(notes[dbZone.ID], now),
+		}
+		switch dbZone.Type {
+		case zoneTypeForward:
+			zi.Forwarders = strings.Split(dbZone.Forwarders, ",")
+		case zoneTypeSecondary:
+			zi.Primaries = strings.Split(dbZone.Primaries, ",")
 		}
 
 		result = append(result, zi)
@@ -360,14 +553,71 @@ func getZonesInfoFromDB() []ZoneInfo {
 	return result
 }
 
-// findZoneForRecord finds the zone name for a given record
-func findZoneForRecord(recordName string) string {
-	for _, zoneName := range loadedZoneNames {
-		if strings.HasSuffix(recordName, zoneName) || recordName == zoneName {
-			return zoneName
+// servedRecordInfos returns the records served for a zone whose records
+// are not stored in the database, sorted by type and name
+func servedRecordInfos(zoneName string) []RecordInfo {
+	zone := dns.Fqdn(zoneName)
+	zd := zoneStore.Load()
+	var infos []RecordInfo
+	zd.Each(func(name string, rrList []dns.RR) {
+		if !strings.EqualFold(zd.FindZone(name), zone) {
+			return
+		}
+		for _, rr := range rrList {
+			infos = append(infos, RecordInfo{
+				Name:  rr.Header().Name,
+				Type:  dns.TypeToString[rr.Header().Rrtype],
+				TTL:   rr.Header().Ttl,
+				Value: strings.TrimPrefix(rr.String(), rr.Header().String()),
+			})
+		}
+	})
+	sort.SliceStable(infos, func(i, j int) bool {
+		if infos[i].Type != infos[j].Type {
+			return infos[i].Type < infos[j].Type
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// pageRecordInfos filters and pages the records of a zone loaded from
+// files, returning the number of records matching the filters
+func pageRecordInfos(records []RecordInfo, q ListQuery) ([]RecordInfo, int) {
+	search := strings.ToLower(q.Search)
+	var matched []RecordInfo
+	for _, r := range records {
+		if q.Type != "" && r.Type != q.Type {
+			continue
 		}
+		if search != "" && !strings.Contains(strings.ToLower(r.Name+" "+r.Value), search) {
+			continue
+		}
+		matched = append(matched, r)
+	}
+	start := min(q.Offset, len(matched))
+	end := min(start+q.Limit, len(matched))
+	return matched[start:end], len(matched)
+}
+
+// recordInfos converts database records for the web interface
+func recordInfos(records []DBRecord) []RecordInfo {
+	infos := make([]RecordInfo, 0, len(records))
+	for _, r := range records {
+		infos = append(infos, RecordInfo{
+			ID:             r.ID,
+			Name:           r.Name,
+			Type:           r.Type,
+			Value:          r.Value,
+			TTL:            uint32(r.TTL),
+			Priority:       r.Priority,
+			Version:        r.Version,
+			RecordSchedule: r.RecordSchedule,
+			RecordNotes:    r.RecordNotes,
+			RecordCaching:  r.RecordCaching,
+		})
 	}
-	return ""
+	return infos
 }
 
 // Web handlers
@@ -376,7 +626,7 @@ func handleWebIndex(c *gin.Context) {
 	zones := getZonesInfo()
 	totalRecords := 0
 	for _, z := range zones {
-		totalRecords += len(z.Records)
+		totalRecords += z.RecordCount
 	}
 	data := struct {
 		Zones           []ZoneInfo
@@ -390,18 +640,20 @@ func handleWebIndex(c *gin.Context) {
 		PageTitle       string
 		ShowSetupButton bool
 		Version         string
+		Cuts            []ZoneCut
 	}{
 		Zones:           zones,
 		ZoneCount:       len(zones),
 		RecordCount:     totalRecords,
 		Mode:            dbMode,
 		EditMode:        dbMode == "sqlite",
-		Forwarders:      forwarders,
+		Forwarders:      currentForwarders(),
 		DNSPort:         dnsPort,
 		CurrentPath:     "/zones",
 		PageTitle:       "Zones",
 		ShowSetupButton: true,
 		Version:         version,
+		Cuts:            zoneStore.Load().Cuts(),
 	}
 	c.Header("Content-Type", "text/html; charset=utf-8")
 	if err := tmpl.Execute(c.Writer, data); err != nil {
@@ -428,21 +680,73 @@ func handleWebZoneRecords(c *gin.Context) {
 		return
 	}
 
+	defaultTTL := 3600
+	if database != nil {
+		defaultTTL = zoneDefaultTTL(zone.ID)
+	}
+
+	// Show one page of the records, filtered by type and text
+	q := ListQuery{
+		Limit:  recordsPageSize,
+		Sort:   "type, name",
+		Type:   strings.ToUpper(strings.TrimSpace(c.Query("type"))),
+		Search: strings.TrimSpace(c.Query("q")),
+	}
+	page, _ := strconv.Atoi(c.Query("page"))
+	page = max(page, 1)
+	q.Offset = (page - 1) * recordsPageSize
+	var total int
+	if len(zone.Primaries) > 0 {
+		// The copy of a secondary zone is shown as served, read-only
+		zone.Records, total = pageRecordInfos(servedRecordInfos(zone.Name), q)
+	} else if database != nil {
+		records, n, err := database.ListRecordsPage(zone.ID, q)
+		if err != nil {
+			slog.Error("failed to list records", "error", err)
+		}
+		zone.Records, total = recordInfos(records), n
+	} else {
+		zone.Records, total = pageRecordInfos(zone.Records, q)
+	}
+	for i := 1; i < len(zone.Records); i++ {
+		prev, r := zone.Records[i-1], &zone.Records[i]
+		r.SetContinued = strings.EqualFold(prev.Name, r.Name) && strings.EqualFold(prev.Type, r.Type)
+	}
+	pages := max((total+recordsPageSize-1)/recordsPageSize, 1)
+
 	tmpl := template.Must(template.New("zone_records").Parse(sidebarHTML + zoneRecordsHTML))
 	data := struct {
 		Zone        *ZoneInfo
 		AllZones    []ZoneInfo
+		DefaultTTL  int
 		Mode        string
 		EditMode    bool
 		CurrentPath string
 		Version     string
+		RecordTypes []string
+		TypeFilter  string
+		Query       string
+		Total       int
+		Page        int
+		Pages       int
+		PrevPage    int
+		NextPage    int
 	}{
 		Zone:        zone,
 		AllZones:    zones,
+		DefaultTTL:  defaultTTL,
 		Mode:        dbMode,
-		EditMode:    dbMode == "sqlite",
+		EditMode:    dbMode == "sqlite" && len(zone.Primaries) == 0,
 		CurrentPath: "/zones",
 		Version:     version,
+		RecordTypes: []string{"A", "AAAA", "CNAME", "ALIAS", "MX", "TXT", "NS", "PTR", "HTTPS", "SVCB"},
+		TypeFilter:  q.Type,
+		Query:       q.Search,
+		Total:       total,
+		Page:        page,
+		Pages:       pages,
+		PrevPage:    page - 1,
+		NextPage:    page + 1,
 	}
 	c.Header("Content-Type", "text/html; charset=utf-8")
 	if err := tmpl.Execute(c.Writer, data); err != nil {
@@ -469,9 +773,18 @@ func handleWebZoneSettings(c *gin.Context) {
 		return
 	}
 
+	// SOA and TTL settings are editable in sqlite mode
+	var soa *DBZone
+	if database != nil {
+		soa, _ = database.GetZone(zone.ID)
+	}
+
 	tmpl := template.Must(template.New("zone_settings").Parse(sidebarHTML + zoneSettingsHTML))
 	data := struct {
 		Zone        *ZoneInfo
+		ApexRecords []string
+		SOA         *DBZone
+		ReviewDays  int
 		AllZones    []ZoneInfo
 		Mode        string
 		EditMode    bool
@@ -479,6 +792,9 @@ func handleWebZoneSettings(c *gin.Context) {
 		Version     string
 	}{
 		Zone:        zone,
+		ApexRecords: servedApexRecords(dns.Fqdn(zoneName)),
+		SOA:         soa,
+		ReviewDays:  zoneReviewDays,
 		AllZones:    zones,
 		Mode:        dbMode,
 		EditMode:    dbMode == "sqlite",
@@ -492,12 +808,83 @@ func handleWebZoneSettings(c *gin.Context) {
 	}
 }
 
+// handleWebZoneText renders the zone file editor of a zone (sqlite mode)
+func handleWebZoneText(c *gin.Context) {
+	zoneName := c.Param("zone")
+
+	zones := getZonesInfo()
+	var zone *ZoneInfo
+	for i := range zones {
+		if zones[i].Name == zoneName {
+			zone = &zones[i]
+			break
+		}
+	}
+
+	if zone == nil || dbMode != "sqlite" || len(zone.Forwarders) > 0 || len(zone.Primaries) > 0 {
+		c.String(http.StatusNotFound, "Zone not found")
+		return
+	}
+
+	tmpl := template.Must(template.New("zone_text").Parse(sidebarHTML + zoneTextHTML))
+	data := struct {
+		Zone        *ZoneInfo
+		AllZones    []ZoneInfo
+		Mode        string
+		EditMode    bool
+		CurrentPath string
+		Version     string
+	}{
+		Zone:        zone,
+		AllZones:    zones,
+		Mode:        dbMode,
+		EditMode:    true,
+		CurrentPath: "/zones",
+		Version:     version,
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(c.Writer, data); err != nil {
+		slog.Error("failed to render template", "error", err)
+		c.String(http.StatusInternalServerError, "Internal Server Error")
+	}
+}
+
+// servedApexRecords returns the SOA and NS of a live zone and the
+// addresses of its name servers inside the zone, in zone file format
+func servedApexRecords(zoneName string) []string {
+	zd := zoneStore.Load()
+	rrs, _ := zd.Lookup(zoneName)
+	var lines []string
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			lines = append(lines, rr.String())
+		}
+	}
+	for _, rr := range rrs {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		lines = append(lines, rr.String())
+		if !dns.IsSubDomain(zoneName, ns.Ns) {
+			continue
+		}
+		glue, _ := zd.Lookup(ns.Ns)
+		for _, g := range glue {
+			if t := g.Header().Rrtype; t == dns.TypeA || t == dns.TypeAAAA {
+				lines = append(lines, g.String())
+			}
+		}
+	}
+	return lines
+}
+
 func handleWebSettings(c *gin.Context) {
 	tmpl := template.Must(template.New("settings").Parse(headerHTML + sidebarHTML + globalSettingsHTML))
 	zones := getZonesInfo()
 	totalRecords := 0
 	for _, z := range zones {
-		totalRecords += len(z.Records)
+		totalRecords += z.RecordCount
 	}
 	data := struct {
 		Mode            string
@@ -514,9 +901,9 @@ func handleWebSettings(c *gin.Context) {
 	}{
 		Mode:            dbMode,
 		EditMode:        dbMode == "sqlite",
-		Forwarders:      forwarders,
+		Forwarders:      currentForwarders(),
 		DNSPort:         dnsPort,
-		ServerRole:      serverRole,
+		ServerRole:      currentServerRole(),
 		ZoneCount:       len(zones),
 		RecordCount:     totalRecords,
 		Version:         version,
@@ -534,7 +921,17 @@ func handleWebSettings(c *gin.Context) {
 func handleWebForwarders(c *gin.Context) {
 	tmpl := template.Must(template.New("forwarders").Parse(headerHTML + sidebarHTML + forwardersHTML))
 
+	ids := make(map[string]int64)
+	if database != nil {
+		dbForwarders, _ := database.ListForwarders()
+		for _, f := range dbForwarders {
+			ids[f.Address] = f.ID
+		}
+	}
+	stats := upstreamStatsList()
+
 	// Prepare forwarders for display
+	forwarders := currentForwarders()
 	forwarderDisplays := make([]ForwarderDisplay, 0, len(forwarders))
 	for _, f := range forwarders {
 		display := f
@@ -542,8 +939,10 @@ func handleWebForwarders(c *gin.Context) {
 			display = strings.TrimSuffix(f, ":53")
 		}
 		forwarderDisplays = append(forwarderDisplays, ForwarderDisplay{
+			ID:      ids[f],
 			Address: f,
 			Display: display,
+			Stat:    upstreamStatFor(stats, f),
 		})
 	}
 
@@ -552,6 +951,9 @@ func handleWebForwarders(c *gin.Context) {
 		EditMode          bool
 		Forwarders        []string
 		ForwarderDisplays []ForwarderDisplay
+		Upstreams         []UpstreamStat
+		DefaultTimeoutMS  int64
+		Candidates        string
 		CurrentPath       string
 		PageTitle         string
 		ShowSetupButton   bool
@@ -561,6 +963,9 @@ func handleWebForwarders(c *gin.Context) {
 		EditMode:          dbMode == "sqlite",
 		Forwarders:        forwarders,
 		ForwarderDisplays: forwarderDisplays,
+		Upstreams:         stats,
+		DefaultTimeoutMS:  forwardTimeout.Milliseconds(),
+		Candidates:        strings.Join(benchmarkCandidates, ", "),
 		CurrentPath:       "/forwarders",
 		PageTitle:         "Forwarders",
 		ShowSetupButton:   true,
@@ -573,6 +978,152 @@ func handleWebForwarders(c *gin.Context) {
 	}
 }
 
+func handleWebAnalytics(c *gin.Context) {
+	tmpl := template.Must(template.New("analytics").Parse(headerHTML + sidebarHTML + analyticsHTML))
+	data := struct {
+		Mode            string
+		EditMode        bool
+		CurrentPath     string
+		PageTitle       string
+		ShowSetupButton bool
+		Version         string
+	}{
+		Mode:            dbMode,
+		EditMode:        dbMode == "sqlite",
+		CurrentPath:     "/analytics",
+		PageTitle:       "Analytics",
+		ShowSetupButton: true,
+		Version:         version,
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(c.Writer, data); err != nil {
+		slog.Error("failed to render template", "error", err)
+		c.String(http.StatusInternalServerError, "Internal Server Error")
+	}
+}
+
+func handleWebImport(c *gin.Context) {
+	tmpl := template.Must(template.New("import").Parse(headerHTML + sidebarHTML + importHTML))
+	data := struct {
+		Mode            string
+		EditMode        bool
+		CurrentPath     string
+		PageTitle       string
+		ShowSetupButton bool
+		Version         string
+	}{
+		Mode:            dbMode,
+		EditMode:        dbMode == "sqlite",
+		CurrentPath:     "/zones",
+		PageTitle:       "Import Zone",
+		ShowSetupButton: true,
+		Version:         version,
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(c.Writer, data); err != nil {
+		slog.Error("failed to render template", "error", err)
+		c.String(http.StatusInternalServerError, "Internal Server Error")
+	}
+}
+
+func handleWebQueryTool(c *gin.Context) {
+	tmpl := template.Must(template.New("query").Parse(headerHTML + sidebarHTML + queryToolHTML))
+	data := struct {
+		Mode            string
+		EditMode        bool
+		CurrentPath     string
+		PageTitle       string
+		ShowSetupButton bool
+		Version         string
+	}{
+		Mode:            dbMode,
+		EditMode:        dbMode == "sqlite",
+		CurrentPath:     "/query",
+		PageTitle:       "Query Tool",
+		ShowSetupButton: true,
+		Version:         version,
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(c.Writer, data); err != nil {
+		slog.Error("failed to render template", "error", err)
+		c.String(http.StatusInternalServerError, "Internal Server Error")
+	}
+}
+
+func handleWebSinkhole(c *gin.Context) {
+	tmpl := template.Must(template.New("sinkhole").Parse(headerHTML + sidebarHTML + sinkholeHTML))
+	data := struct {
+		Mode            string
+		EditMode        bool
+		CurrentPath     string
+		PageTitle       string
+		ShowSetupButton bool
+		Version         string
+	}{
+		Mode:            dbMode,
+		EditMode:        dbMode == "sqlite",
+		CurrentPath:     "/sinkhole",
+		PageTitle:       "Sinkhole",
+		ShowSetupButton: true,
+		Version:         version,
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(c.Writer, data); err != nil {
+		slog.Error("failed to render template", "error", err)
+		c.String(http.StatusInternalServerError, "Internal Server Error")
+	}
+}
+
+func handleWebTrash(c *gin.Context) {
+	tmpl := template.Must(template.New("trash").Parse(headerHTML + sidebarHTML + trashHTML))
+	data := struct {
+		Mode            string
+		EditMode        bool
+		CurrentPath     string
+		PageTitle       string
+		ShowSetupButton bool
+		Version         string
+		RetentionDays   int
+	}{
+		Mode:            dbMode,
+		EditMode:        dbMode == "sqlite",
+		CurrentPath:     "/trash",
+		PageTitle:       "Trash",
+		ShowSetupButton: true,
+		Version:         version,
+		RetentionDays:   int(trashRetention / (24 * time.Hour)),
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(c.Writer, data); err != nil {
+		slog.Error("failed to render template", "error", err)
+		c.String(http.StatusInternalServerError, "Internal Server Error")
+	}
+}
+
+func handleWebClients(c *gin.Context) {
+	tmpl := template.Must(template.New("clients").Parse(headerHTML + sidebarHTML + clientsHTML))
+	data := struct {
+		Mode            string
+		EditMode        bool
+		CurrentPath     string
+		PageTitle       string
+		ShowSetupButton bool
+		Version         string
+	}{
+		Mode:            dbMode,
+		EditMode:        dbMode == "sqlite",
+		CurrentPath:     "/clients",
+		PageTitle:       "Clients",
+		ShowSetupButton: true,
+		Version:         version,
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(c.Writer, data); err != nil {
+		slog.Error("failed to render template", "error", err)
+		c.String(http.StatusInternalServerError, "Internal Server Error")
+	}
+}
+
 func handleWebReplication(c *gin.Context) {
 	tmpl := template.Must(template.New("replication").Parse(headerHTML + sidebarHTML + replicationHTML))
 	data := struct {
@@ -586,7 +1137,7 @@ func handleWebReplication(c *gin.Context) {
 	}{
 		Mode:            dbMode,
 		EditMode:        dbMode == "sqlite",
-		ServerRole:      serverRole,
+		ServerRole:      currentServerRole(),
 		CurrentPath:     "/replication",
 		PageTitle:       "Replication",
 		ShowSetupButton: true,
@@ -604,12 +1155,44 @@ func handleAPIZones(c *gin.Context) {
 }
 
 func handleAPIHealth(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
+	health := gin.H{
 		"status":     "ok",
+		"instance":   instanceName,
 		"mode":       dbMode,
-		"zones":      len(loadedZoneNames),
-		"forwarders": len(forwarders),
-	})
+		"zones":      len(zoneStore.Load().ZoneNames()),
+		"forwarders": len(currentForwarders()),
+	}
+	if stats := forwardCache.Stats(); stats != nil {
+		health["cache"] = stats
+	}
+	health["forwarding"] = forwardLimit.Stats()
+	health["upstreams"] = upstreamStatsList()
+	if stats := dnstapOut.Stats(); stats != nil {
+		health["dnstap"] = stats
+	}
+	if status := gitHealth(); status != nil {
+		health["git"] = status
+	}
+	var warnings []any
+	if tlsInfo := certificateHealth(); tlsInfo != nil {
+		health["tls"] = tlsInfo
+		if warning, ok := tlsInfo["warning"]; ok {
+			warnings = append(warnings, warning)
+		}
+	}
+	if warning := verifyWarning(); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	if warning := problemsWarning(); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	if warning := maintenanceWarning(); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	if len(warnings) > 0 {
+		health["warnings"] = warnings
+	}
+	c.JSON(http.StatusOK, health)
 }
 
 // handleConfigModalJS serves the config modal JavaScript
@@ -650,14 +1233,24 @@ func getOutboundIP() string {
 	return localAddr.IP.String()
 }
 
-// startWebServer starts the web interface server using Gin
-func startWebServer(port int) *http.Server {
+// startWebServer starts the web interface server using Gin, plus an HTTPS
+// listener when tlsPort is set
+func startWebServer(port, tlsPort int) []*http.Server {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
 	router.Use(gin.Recovery())
+	// Browsers sent here by a blocked name get the block page
+	router.Use(SinkholePageMiddleware())
+	// The lockout is per client address, forwarded only by trusted proxies
+	if err := router.SetTrustedProxies(webSecurity.cfg.TrustedProxies); err != nil {
+		slog.Error("invalid trusted proxies", "error", err)
+	}
+	router.Use(SecurityHeadersMiddleware())
 
 	// Static files (no auth required)
 	router.GET("/static/config-modal.js", handleConfigModalJS)
+	router.GET("/static/vendor/:name", handleVendorAsset)
+	logVendorAssets()
 
 	// Public routes (no auth required)
 	router.GET("/login", handleLogin)
@@ -666,17 +1259,26 @@ func startWebServer(port int) *http.Server {
 	router.POST("/setup", handleSetup)
 	router.GET("/logout", handleLogout)
 	router.GET("/api/health", handleAPIHealth)
+	router.GET("/healthz", handleHealthz)
+	router.GET("/readyz", handleReadyz)
+	router.GET(acmeHTTPChallengePath+":token", handleACMEHTTPChallenge)
 
 	// Protected routes (auth required)
 	protected := router.Group("/")
-	protected.Use(AuthMiddleware())
+	protected.Use(AuthMiddleware(), DemoReadOnlyMiddleware(), AuditMiddleware())
 	{
 		protected.GET("/zones", handleWebIndex)
+		protected.GET("/import", handleWebImport)
 		// Serve overview at root
 		protected.GET("/", handleWebSettings)
 		protected.GET("/infos", handleWebSettings)
 		protected.GET("/forwarders", handleWebForwarders)
 		protected.GET("/replication", handleWebReplication)
+		protected.GET("/analytics", handleWebAnalytics)
+		protected.GET("/query", handleWebQueryTool)
+		protected.GET("/sinkhole", handleWebSinkhole)
+		protected.GET("/trash", handleWebTrash)
+		protected.GET("/clients", handleWebClients)
 		protected.GET("/account", handleAccount)
 		protected.POST("/account", handleAccount)
 		protected.POST("/account/tokens", handleCreateAPIToken)
@@ -684,12 +1286,20 @@ func startWebServer(port int) *http.Server {
 		protected.GET("/account/tokens", handleListAPITokens)
 		protected.GET("/zones/:zone/records", handleWebZoneRecords)
 		protected.GET("/zones/:zone/settings", handleWebZoneSettings)
+		protected.GET("/zones/:zone/text", handleWebZoneText)
 		protected.GET("/api/server-info", handleAPIServerInfo)
+		protected.GET("/api/stats", handleAPIStats)
+		protected.GET("/api/queries/recent", handleAPIRecentQueries)
+		protected.GET("/api/queries/stream", handleAPIQueryStream)
+		protected.GET("/api/resolve", handleAPIResolve)
+		protected.GET("/api/delegations", handleAPIDelegations)
+		protected.GET("/api/sinkhole", handleAPISinkhole)
 	}
 
 	// Register CRUD routes only in sqlite mode, otherwise just read-only zones
 	if dbMode == "sqlite" {
 		registerAPIRoutes(router)
+		registerPprofRoutes(router)
 	} else {
 		router.GET("/api/zones", handleAPIZones)
 	}
@@ -698,26 +1308,80 @@ func startWebServer(port int) *http.Server {
 		Addr:    fmt.Sprintf(":%d", port),
 		Handler: router,
 	}
+	if tlsPort > 0 && webHTTPSRedirect {
+		server.Handler = httpsRedirect(router, tlsPort)
+	}
 
 	go func() {
 		slog.Info("Starting web server", "addr", server.Addr, "mode", dbMode)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := serveWeb(server, false); err != nil && err != http.ErrServerClosed {
 			slog.Error("failed to start web server", "error", err)
 		}
 	}()
 
-	return server
+	servers := []*http.Server{server}
+	if tlsPort > 0 {
+		tlsServer := &http.Server{
+			Addr:      fmt.Sprintf(":%d", tlsPort),
+			Handler:   router,
+			TLSConfig: serverTLSConfig(),
+		}
+		go func() {
+			slog.Info("Starting HTTPS web server", "addr", tlsServer.Addr)
+			if err := serveWeb(tlsServer, true); err != nil && err != http.ErrServerClosed {
+				slog.Error("failed to start HTTPS web server", "error", err)
+			}
+		}()
+		servers = append(servers, tlsServer)
+	}
+
+	return servers
 }
 
 func handleDNS(w dns.ResponseWriter, r *dns.Msg) {
 	m := new(dns.Msg)
 	m.SetReply(r)
 	m.Authoritative = true
-	// Indicate recursion is available if we have forwarders configured
-	if len(forwarders) > 0 {
+	// Echo EDNS0 (and the DO bit) so pre-signed zones can return signatures
+	dnssecOK := false
+	if opt := r.IsEdns0(); opt != nil {
+		dnssecOK = opt.Do()
+		m.SetEdns0(dns.DefaultMsgSize, dnssecOK)
+	}
+	// Indicate recursion is available if we have forwarders configured or
+	// resolve recursively
+	forwarders := currentForwarders()
+	if len(forwarders) > 0 || recursor != nil {
 		m.RecursionAvailable = true
 	}
 
+	// Only standard queries are served (IQUERY is obsolete, STATUS was
+	// never defined and UPDATE is not supported), and the NOTIFYs of the
+	// primaries of secondary zones
+	if r.Opcode == dns.OpcodeNotify && database != nil {
+		handleNotify(w, r, m)
+		return
+	}
+	if r.Opcode != dns.OpcodeQuery {
+		m.Authoritative = false
+		m.Rcode = dns.RcodeNotImplemented
+		if err := w.WriteMsg(m); err != nil {
+			slog.Debug("failed to write NOTIMP", "client", w.RemoteAddr(), "error", err)
+		}
+		slog.Debug("Unsupported opcode, sent NOTIMP", "client", w.RemoteAddr(), "opcode", dns.OpcodeToString[r.Opcode])
+		return
+	}
+	// No server answers several questions at once (RFC 9619)
+	if len(r.Question) > 1 {
+		m.Authoritative = false
+		m.Rcode = dns.RcodeFormatError
+		if err := w.WriteMsg(m); err != nil {
+			slog.Debug("failed to write FORMERR", "client", w.RemoteAddr(), "error", err)
+		}
+		slog.Debug("Several questions in a query, sent FORMERR", "client", w.RemoteAddr(), "questions", len(r.Question))
+		return
+	}
+
 	if len(r.Question) == 0 {
 		slog.Debug("Received empty query", "client", w.RemoteAddr())
 		if err := w.WriteMsg(m); err != nil {
@@ -731,51 +1395,214 @@ func handleDNS(w dns.ResponseWriter, r *dns.Msg) {
 	qtype := q.Qtype
 	t := dns.TypeToString[qtype]
 
-	// Check if this query matches a loaded zone (log INFO for local, DEBUG for forwarded)
-	isLocalZone := false
-	for _, zoneName := range loadedZoneNames {
-		if strings.HasSuffix(name, zoneName) || name == zoneName {
-			isLocalZone = true
-			break
+	// CHAOS queries ask the server itself (version.bind); zones are only
+	// served in class IN
+	switch q.Qclass {
+	case dns.ClassINET, dns.ClassANY:
+	case dns.ClassCHAOS:
+		handleChaos(w, r, m)
+		return
+	default:
+		m.Authoritative = false
+		m.Rcode = dns.RcodeRefused
+		if err := w.WriteMsg(m); err != nil {
+			slog.Debug("failed to write REFUSED", "client", w.RemoteAddr(), "error", err)
 		}
+		return
+	}
+
+	// Take one snapshot of the zones for the whole query
+	zd := zoneStore.Load()
+
+	// Zone transfers (TCP only) are answered from the same snapshot
+	if qtype == dns.TypeAXFR || qtype == dns.TypeIXFR {
+		handleTransfer(w, r, zd)
+		return
 	}
 
+	// Find the enclosing zone and any delegation in one tree walk
+	res := zd.Resolve(name)
+
+	// Check if this query matches a loaded zone (log INFO for local, DEBUG for forwarded)
+	isLocalZone := res.Zone != ""
+
 	if isLocalZone {
 		slog.Info("Received query", "client", w.RemoteAddr(), "name", name, "type", t)
 	} else {
 		slog.Debug("Received query", "client", w.RemoteAddr(), "name", name, "type", t)
 	}
 
-	answers := []dns.RR{}
-	if rrlist, ok := zones[name]; ok {
-		for _, rr := range rrlist {
-			if qtype == dns.TypeANY || rr.Header().Rrtype == qtype {
-				answers = append(answers, rr)
+	// Names of a disabled zone are not served, and not forwarded either
+	// unless disabled_zone_response is forward
+	if res.Disabled != "" && serveLocalZones() {
+		if rcode, ok := disabledZoneRcode(); ok {
+			m.Authoritative = false
+			m.Rcode = rcode
+			if err := w.WriteMsg(m); err != nil {
+				slog.Debug("failed to write disabled zone response", "client", w.RemoteAddr(), "error", err)
+			}
+			slog.Debug("Query for a disabled zone", "name", name, "zone", res.Disabled, "client", w.RemoteAddr(), "rcode", dns.RcodeToString[rcode])
+			return
+		}
+	}
+
+	// Names at or below a delegated zone cut get a referral with glue
+	if len(res.Delegation) > 0 && serveZone(res.Zone) {
+		cut := res.Delegation[0].Header().Name
+		cutRRs, _ := zd.Lookup(cut)
+		// The DS records of the cut belong to the parent zone, which
+		// answers for them itself
+		if qtype == dns.TypeDS && strings.EqualFold(cut, name) {
+			m.Answer = filterRRs(cutRRs, dns.TypeDS)
+			if dnssecOK {
+				m.Answer = append(m.Answer, signaturesFor(cutRRs, m.Answer)...)
+			}
+			if len(m.Answer) == 0 {
+				apex, _ := zd.Lookup(res.Zone)
+				m.Ns = filterRRs(apex, dns.TypeSOA)
+			}
+			if err := w.WriteMsg(m); err != nil {
+				slog.Debug("failed to write DS response", "client", w.RemoteAddr(), "error", err)
+			}
+			return
+		}
+		m.Authoritative = false
+		m.Ns = append(m.Ns, res.Delegation...)
+		// Validating resolvers get the DS of the cut with the referral
+		if dnssecOK {
+			ds := filterRRs(cutRRs, dns.TypeDS)
+			m.Ns = append(m.Ns, ds...)
+			m.Ns = append(m.Ns, signaturesFor(cutRRs, ds)...)
+		}
+		m.Extra = append(m.Extra, zd.Glue(res.Delegation)...)
+		if err := w.WriteMsg(m); err != nil {
+			slog.Warn("Failed to send referral", "name", name, "client", w.RemoteAddr(), "error", err)
+		} else {
+			slog.Info("Sent referral", "name", name, "client", w.RemoteAddr(), "zone_cut", res.Delegation[0].Header().Name)
+		}
+		return
+	}
+
+	// Names of a forward zone only get the answer of its forwarders
+	if len(res.Forward) > 0 && serveLocalZones() {
+		if !forwardTo(w, r, m, res.Forward) {
+			m.Rcode = dns.RcodeServerFailure
+			if err := w.WriteMsg(m); err != nil {
+				slog.Debug("failed to write SERVFAIL", "client", w.RemoteAddr(), "error", err)
 			}
-			// If asked for A but we have a CNAME, include the CNAME
-			if qtype == dns.TypeA && rr.Header().Rrtype == dns.TypeCNAME {
-				answers = append(answers, rr)
+			slog.Debug("Forward zone unreachable, sent SERVFAIL", "name", name, "client", w.RemoteAddr())
+		}
+		return
+	}
+
+	var answers []dns.RR
+	// Pending ACME DNS-01 challenges are answered ahead of zone data
+	if qtype == dns.TypeTXT {
+		answers = acmeChallengeRRs(name)
+	}
+	// Forward-only network profiles skip local zones entirely, and zones in
+	// maintenance go to the forwarders. The answer sets are compiled with
+	// the snapshot (an A query also gets the CNAME) and shared: appending
+	// to them copies.
+	if serveZone(res.Zone) {
+		switch compiled := res.Answers(qtype); {
+		case qtype == dns.TypeANY:
+			answers = append(answers, withoutAliases(res.Records)...)
+		case len(answers) == 0:
+			answers = compiled
+		default:
+			answers = append(answers, compiled...)
+		}
+		// Names holding an ALIAS answer with the addresses of its target
+		if len(answers) == 0 && (qtype == dns.TypeA || qtype == dns.TypeAAAA) {
+			if aliases := res.Answers(TypeALIAS); len(aliases) > 0 {
+				answerAlias(w, r, m, zd, aliases[0])
+				return
 			}
 		}
 	}
 
+	// DNSSEC-aware clients get the signatures of the RRsets answered
+	if dnssecOK && qtype != dns.TypeRRSIG && qtype != dns.TypeANY && len(answers) > 0 {
+		answers = append(answers, signaturesFor(res.Records, answers)...)
+	}
+
+	// RFC 8482: don't dump every record in reply to ANY over UDP
+	if qtype == dns.TypeANY && len(answers) > 0 {
+		if _, isTCP := w.RemoteAddr().(*net.TCPAddr); !isTCP {
+			answers = minimizeANY(name, answers)
+		}
+	}
+
 	if len(answers) == 0 {
-		// Try forwarding if configured
-		if len(forwarders) > 0 {
-			ctx, cancel := context.WithTimeout(context.Background(), forwardTimeout)
-			defer cancel()
-			if resp, err := forwardQuery(ctx, r); err == nil && resp != nil {
-				slog.Debug("Forwarded query", "name", name, "client", w.RemoteAddr())
-				// preserve original ID
-				resp.Id = r.Id
-				if err := w.WriteMsg(resp); err != nil {
-					slog.Debug("failed to write forwarded response", "client", w.RemoteAddr(), "error", err)
+		// Browsers ask every name for HTTPS records: local names without
+		// them get an empty answer instead of going upstream
+		if (qtype == dns.TypeHTTPS || qtype == dns.TypeSVCB) && res.Exists && serveZone(res.Zone) {
+			apex, _ := zd.Lookup(res.Zone)
+			m.Ns = filterRRs(apex, dns.TypeSOA)
+			if err := w.WriteMsg(m); err != nil {
+				slog.Debug("failed to write NODATA", "client", w.RemoteAddr(), "error", err)
+			}
+			return
+		}
+		// Names of the hosts files override the forwarders, including
+		// their missing types (NODATA)
+		if hostsRRs, ok := lookupHosts(name, qtype); ok {
+			m.Authoritative = false
+			m.Answer = append(m.Answer, hostsRRs...)
+			if err := w.WriteMsg(m); err != nil {
+				slog.Debug("failed to write hosts response", "client", w.RemoteAddr(), "error", err)
+				return
+			}
+			slog.Debug("Answered from hosts files", "name", name, "client", w.RemoteAddr(), "answers", len(hostsRRs))
+			return
+		}
+		// Blocked names get the address of the block page
+		if !isLocalZone {
+			if blockedRRs, ok := lookupSinkhole(name, qtype, w.RemoteAddr()); ok {
+				markQueryBlocked(w)
+				m.Authoritative = false
+				m.Answer = append(m.Answer, blockedRRs...)
+				if err := w.WriteMsg(m); err != nil {
+					slog.Debug("failed to write sinkhole response", "client", w.RemoteAddr(), "error", err)
+					return
 				}
+				slog.Debug("Answered from sinkhole", "name", name, "client", w.RemoteAddr())
 				return
-			} else {
-				slog.Debug("forwarding failed", "name", name, "error", err)
 			}
 		}
+		// Search engines answer the clients of safe search groups with
+		// their filtered results
+		if !isLocalZone {
+			if g := clientPolicyGroup(w.RemoteAddr()); g != nil && g.SafeSearch {
+				if target := safeSearchTarget(g, name); target != "" {
+					answerSafeSearch(w, r, m, target)
+					return
+				}
+			}
+		}
+		// .local names live on the LAN, they are never forwarded upstream
+		if !isLocalZone && mdnsBridge.handles(name) {
+			setQuerySource(w, sourceForwarded)
+			handleMDNSQuery(w, r, m)
+			return
+		}
+		// Single-label names are looked up under the search suffixes of
+		// the client before going upstream
+		if !isLocalZone && answerSearchDomains(w, r, m, zd) {
+			return
+		}
+		// Names expanded with a search suffix are only answered here
+		expanded := searchExpansion(w)
+		// The recursive resolver takes the place of the forwarders
+		if recursor != nil && !expanded {
+			recurseTo(w, r, m)
+			return
+		}
+		// Try forwarding if configured
+		if len(forwarders) > 0 && !expanded && forwardTo(w, r, m, forwarders) {
+			return
+		}
 
 		m.Rcode = dns.RcodeNameError // NXDOMAIN
 		if err := w.WriteMsg(m); err != nil {
@@ -786,7 +1613,11 @@ func handleDNS(w dns.ResponseWriter, r *dns.Msg) {
 		return
 	}
 
-	m.Answer = append(m.Answer, answers...)
+	m.Answer = answers
+	// The addresses of service targets go with SVCB and HTTPS answers
+	if qtype == dns.TypeHTTPS || qtype == dns.TypeSVCB {
+		m.Extra = append(m.Extra, svcbAdditionals(zd, answers)...)
+	}
 	if err := w.WriteMsg(m); err != nil {
 		slog.Warn("Failed to send reply", "name", name, "client", w.RemoteAddr(), "error", err)
 	} else {
@@ -794,13 +1625,71 @@ func handleDNS(w dns.ResponseWriter, r *dns.Msg) {
 	}
 }
 
+// forwardTo answers r from the cache or from the first of servers that
+// answers, or from an expired cache entry when none does (serve-stale). It
+// reports false when no server answered and nothing was sent;
+// m is the reply sent as SERVFAIL when the forwarding queue is full.
+func forwardTo(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg, servers []string) bool {
+	name := r.Question[0].Name
+	if resp := forwardCache.Get(r); resp != nil {
+		setQuerySource(w, sourceCached)
+		slog.Debug("Answered from cache", "name", name, "client", w.RemoteAddr())
+		if err := w.WriteMsg(resp); err != nil {
+			slog.Debug("failed to write cached response", "client", w.RemoteAddr(), "error", err)
+		}
+		return true
+	}
+	setQuerySource(w, sourceForwarded)
+	ctx, cancel := context.WithTimeout(context.Background(), forwardBudget(servers))
+	defer cancel()
+	if !forwardLimit.Acquire(ctx) {
+		m.Rcode = dns.RcodeServerFailure
+		if err := w.WriteMsg(m); err != nil {
+			slog.Debug("failed to write SERVFAIL", "client", w.RemoteAddr(), "error", err)
+		}
+		slog.Debug("Too many forwarded queries in flight, sent SERVFAIL", "name", name, "client", w.RemoteAddr())
+		return true
+	}
+	defer forwardLimit.Release()
+	resp, err := forwardQuery(ctx, r, servers)
+	if err != nil || resp == nil {
+		slog.Debug("forwarding failed", "name", name, "error", err)
+		// An upstream outage does not take down names already resolved
+		if stale := forwardCache.GetStale(r); stale != nil {
+			setQuerySource(w, sourceCached)
+			slog.Info("Answered from stale cache", "name", name, "client", w.RemoteAddr())
+			if err := w.WriteMsg(stale); err != nil {
+				slog.Debug("failed to write stale response", "client", w.RemoteAddr(), "error", err)
+			}
+			return true
+		}
+		return false
+	}
+	slog.Debug("Forwarded query", "name", name, "client", w.RemoteAddr())
+	clampMsgTTLs(resp)
+	stripRebinding(name, resp)
+	if cacheable(name) {
+		forwardCache.Set(r, resp)
+	}
+	// preserve original ID
+	resp.Id = r.Id
+	if err := w.WriteMsg(resp); err != nil {
+		slog.Debug("failed to write forwarded response", "client", w.RemoteAddr(), "error", err)
+	}
+	return true
+}
+
 func main() {
 	// Use flag types that record whether they were set so flags can override config file
 	var zonesDirFlag stringFlag
 	var forwardersFlag stringFlag
+	var forwarders []string
 	var configFileFlag stringFlag
-	var logLevelFlag string
+	var logLevelFlag stringFlag
 	var dnsPortFlag intFlag
+	var profileFlag stringFlag
+	var demoFlag bool
+	var checkConfigFlag, checkZonesFlag bool
 
 	// register flags with defaults
 	configFileFlag.value = "config.yaml"
@@ -810,41 +1699,71 @@ func main() {
 	flag.Var(&zonesDirFlag, "zones-dir", "directory containing zone files (YAML format)")
 	flag.Var(&forwardersFlag, "forwarders", "comma-separated upstream DNS servers (host[:port], default port 53)")
 	flag.Var(&dnsPortFlag, "port", "DNS server port (default 53)")
-	flag.StringVar(&logLevelFlag, "log-level", "info", "log level (debug, info, warn, error)")
+	flag.Var(&profileFlag, "profile", "network profile to use (\"auto\" to detect from the attached network)")
+	flag.Var(&logLevelFlag, "log-level", "log level (debug, info, warn, error), overrides log_level")
+	flag.BoolVar(&demoFlag, "demo", false, "run on an in-memory database with read-only demo data")
+	flag.BoolVar(&checkConfigFlag, "check-config", false, "validate the configuration file and exit")
+	flag.BoolVar(&checkZonesFlag, "check-zones", false, "load and lint every zone without serving them, then exit")
 	flag.Parse()
 
-	// Configure slog based on log level
-	var logLevel slog.Level
-	switch strings.ToLower(logLevelFlag) {
-	case "debug":
-		logLevel = slog.LevelDebug
-	case "info":
-		logLevel = slog.LevelInfo
-	case "warn", "warning":
-		logLevel = slog.LevelWarn
-	case "error":
-		logLevel = slog.LevelError
-	default:
-		logLevel = slog.LevelInfo
-	}
-
-	// Create handler with the configured level
-	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})
-	slog.SetDefault(slog.New(handler))
-
-	slog.Info("Starting simple DNS server")
-	slog.Info("SimpleDNS version", "version", version)
+	// Log to stderr until the config file selects the log output
+	logCfg := LogConfig{Level: logLevelFlag.value}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: parseLogLevel(logCfg.Level)})))
 
 	// DNS server config (defaults)
 	// dnsPort is global, default 53
 	// Web server config (defaults)
 	webEnabled := false
 	webPort := 8080
+	webTLSPort := 0
+	var tlsCertFile, tlsKeyFile string
+	// DNS over TLS and QUIC listeners, disabled when 0
+	dotPort, doqPort := 0, 0
 	dbPath := "simpledns.db"
+	var acmeCfg ACMEConfig
+	var cacheCfg CacheConfig
+	var dnstapCfg DnstapConfig
+	var metricsCfg MetricsConfig
+	var backupCfg BackupConfig
+	var remindersCfg ZoneRemindersConfig
+	var statsCfg StatsConfig
+	var kvCfg KVConfig
+	var gitCfg GitConfig
+	var kubernetesCfg KubernetesConfig
+	var dockerCfg DockerConfig
+	var dhcpCfg DHCPConfig
+	var vpnCfg VPNConfig
+	var mdnsCfg MDNSConfig
+	var dns64Cfg DNS64Config
+	var addressFilterCfg []AddressFilterRule
+	var hostsCfg HostsConfig
+	var searchDomainsCfg []SearchDomainRule
+	var sinkholeCfg SinkholeConfig
+	var webSecurityCfg WebSecurityConfig
+	var chaosCfg ChaosConfig
+	var forwardSecurityCfg ForwardSecurityConfig
+	var recursionCfg RecursionConfig
+	var networkProfiles []NetworkProfile
+	profileCheckInterval := 30 * time.Second
+	verifyInterval := 10 * time.Minute
+	problemsInterval := time.Hour
 
 	// Load optional app config file if present
 	if cfgApp, err := loadAppConfig(configFileFlag.value); err == nil {
-		// Set db_type mode (files or sqlite)
+		if !logLevelFlag.set && cfgApp.LogLevel != "" {
+			logCfg.Level = cfgApp.LogLevel
+		}
+		logCfg.Format = cfgApp.LogFormat
+		logCfg.Output = cfgApp.LogOutput
+		logCfg.File = cfgApp.LogFile
+		logCfg.MaxSizeMB = cfgApp.LogMaxSizeMB
+		logCfg.MaxBackups = cfgApp.LogMaxBackups
+		logCfg.SyslogAddress = cfgApp.LogSyslogAddress
+		if err := setupLogging(logCfg); err != nil {
+			slog.Error("invalid logging configuration, logging to stderr", "error", err)
+		}
+
+		// Set db_type mode (files, sqlite, kv or git)
 		if cfgApp.DBType != "" {
 			dbMode = cfgApp.DBType
 		}
@@ -856,35 +1775,164 @@ func main() {
 			zonesDirFlag.value = cfgApp.ZonesDir
 		}
 		if !forwardersFlag.set && cfgApp.Forwarders != nil && dbMode != "sqlite" {
-			parsed := make([]string, 0, len(cfgApp.Forwarders))
-			for _, p := range cfgApp.Forwarders {
-				if p == "" {
+			parsed := make([]ForwarderConfig, 0, len(cfgApp.Forwarders))
+			for _, f := range cfgApp.Forwarders {
+				if f.Address == "" {
 					continue
 				}
-				if !strings.Contains(p, ":") {
-					p = p + ":53"
+				if !strings.Contains(f.Address, ":") {
+					f.Address += ":53"
 				}
-				parsed = append(parsed, p)
+				parsed = append(parsed, f)
 			}
-			forwarders = parsed
+			forwarders = setUpstreams(parsed)
 		}
 		if cfgApp.ForwardTimeoutSec > 0 {
 			forwardTimeout = time.Duration(cfgApp.ForwardTimeoutSec) * time.Second
 		}
+		if cfgApp.ForwardMaxInflight > 0 || cfgApp.ForwardMaxQueue != 0 {
+			maxInflight, maxQueue := defaultForwardMaxInflight, defaultForwardMaxQueue
+			if cfgApp.ForwardMaxInflight > 0 {
+				maxInflight = cfgApp.ForwardMaxInflight
+			}
+			if cfgApp.ForwardMaxQueue > 0 {
+				maxQueue = cfgApp.ForwardMaxQueue
+			} else if cfgApp.ForwardMaxQueue < 0 {
+				maxQueue = 0 // no queue: fail as soon as all slots are busy
+			}
+			forwardLimit = newForwardLimiter(maxInflight, maxQueue)
+		}
 		// Web server config
 		webEnabled = cfgApp.WebEnabled
 		if cfgApp.WebPort > 0 {
 			webPort = cfgApp.WebPort
 		}
+		if cfgApp.WebTLSPort > 0 {
+			webTLSPort = cfgApp.WebTLSPort
+		}
+		tlsCertFile, tlsKeyFile = cfgApp.TLSCertFile, cfgApp.TLSKeyFile
+		webHTTPSRedirect, webSecureCookie = cfgApp.WebHTTPSRedirect, cfgApp.WebSecureCookie
+		webAssetsCDN = cfgApp.WebAssetsCDN
+		dotPort, doqPort = cfgApp.DoTPort, cfgApp.DoQPort
+		acmeCfg = cfgApp.ACME
+		cacheCfg = cfgApp.Cache
+		dnstapCfg = cfgApp.Dnstap
+		metricsCfg = cfgApp.Metrics
+		backupCfg = cfgApp.Backup
+		remindersCfg = cfgApp.ZoneReminders
+		initZoneReminders(remindersCfg)
+		initAlerts(cfgApp.SMTP, cfgApp.Alerts)
+		statsCfg = cfgApp.Stats
+		kvCfg = cfgApp.KV
+		gitCfg = cfgApp.Git
+		kubernetesCfg = cfgApp.Kubernetes
+		dockerCfg = cfgApp.Docker
+		dhcpCfg = cfgApp.DHCP
+		vpnCfg = cfgApp.VPN
+		mdnsCfg = cfgApp.MDNS
+		dns64Cfg = cfgApp.DNS64
+		addressFilterCfg = cfgApp.AddressFilter
+		hostsCfg = cfgApp.Hosts
+		searchDomainsCfg = cfgApp.SearchDomains
+		sinkholeCfg = cfgApp.Sinkhole
+		webSecurityCfg = cfgApp.WebSecurity
+		chaosCfg = cfgApp.Chaos
+		forwardSecurityCfg = cfgApp.ForwardSecurity
+		recursionCfg = cfgApp.Recursion
 		if cfgApp.DNSPort > 0 {
 			dnsPort = cfgApp.DNSPort
 		}
 		if cfgApp.ServerRole != "" {
-			serverRole = cfgApp.ServerRole
+			setServerRole(cfgApp.ServerRole)
+		}
+		if cfgApp.InstanceName != "" {
+			instanceName = cfgApp.InstanceName
+		}
+		nsidEnabled = cfgApp.NSID
+		switch cfgApp.AnyResponse {
+		case "":
+		case anyModeHINFO, anyModeRRset, anyModeFull:
+			anyResponseMode = cfgApp.AnyResponse
+		default:
+			slog.Warn("unknown any_response mode, using hinfo", "any_response", cfgApp.AnyResponse)
+		}
+		complianceMode = cfgApp.ComplianceMode
+		if cfgApp.VerifyIntervalSec > 0 {
+			verifyInterval = time.Duration(cfgApp.VerifyIntervalSec) * time.Second
+		} else if cfgApp.VerifyIntervalSec < 0 {
+			verifyInterval = 0
+		}
+		debugDumpDir = cfgApp.DebugDumpDir
+		reusePort = cfgApp.ReusePort
+		if cfgApp.ShutdownDrainSec > 0 {
+			shutdownDrain = time.Duration(cfgApp.ShutdownDrainSec) * time.Second
+		}
+		pprofCfg = cfgApp.Pprof
+		initReadiness(cfgApp.Readiness)
+		if cfgApp.ProblemsIntervalSec > 0 {
+			problemsInterval = time.Duration(cfgApp.ProblemsIntervalSec) * time.Second
+		} else if cfgApp.ProblemsIntervalSec < 0 {
+			problemsInterval = 0
 		}
+		switch cfgApp.SerialFormat {
+		case "":
+		case serialIncrement, serialDate:
+			serialFormat = cfgApp.SerialFormat
+		default:
+			slog.Warn("unknown serial_format, using increment", "serial_format", cfgApp.SerialFormat)
+		}
+		if cfgApp.MinTTL > 0 {
+			ttlMin = uint32(cfgApp.MinTTL)
+		}
+		if cfgApp.MaxTTL > 0 {
+			ttlMax = uint32(cfgApp.MaxTTL)
+		}
+		if ttlMax > 0 && ttlMin > ttlMax {
+			slog.Warn("min_ttl is above max_ttl, ignoring min_ttl", "min_ttl", ttlMin, "max_ttl", ttlMax)
+			ttlMin = 0
+		}
+		catalogZone = cfgApp.CatalogZone
+		if nets, err := parseAllowTransfer(cfgApp.AllowTransfer); err != nil {
+			slog.Error("invalid allow_transfer, zone transfers disabled", "error", err)
+		} else {
+			allowTransfer = nets
+		}
+		if mode, err := parseDisabledZoneResponse(cfgApp.DisabledZoneResp); err != nil {
+			slog.Warn("unknown disabled_zone_response, using forward", "error", err)
+		} else {
+			disabledZoneResponse = mode
+		}
+		initZoneDeleteConfirm(cfgApp.ZoneDeleteConfirmRecords)
+		initTrash(cfgApp.TrashRetentionDays)
+		initClients(cfgApp.Clients, cfgApp.Sinkhole)
+		initRebinding(cfgApp.RebindingProtection)
+		networkProfiles = cfgApp.Profiles
+		if cfgApp.Profile != "" {
+			profileSelection = cfgApp.Profile
+		}
+		if cfgApp.ProfileCheckIntervalSec > 0 {
+			profileCheckInterval = time.Duration(cfgApp.ProfileCheckIntervalSec) * time.Second
+		}
+		if cfgApp.SSIDCommand != nil {
+			ssidCommand = *cfgApp.SSIDCommand
+		}
+	}
 
+	// Validation only: report the problems and exit, 1 on errors
+	if checkConfigFlag || checkZonesFlag {
+		var problems []ZoneProblem
+		if checkConfigFlag {
+			problems = append(problems, checkConfig(configFileFlag.value)...)
+		}
+		if checkZonesFlag {
+			problems = append(problems, checkZones(zonesDirFlag.value, dbPath, kvCfg, gitCfg)...)
+		}
+		os.Exit(runChecks(os.Stdout, problems))
 	}
 
+	slog.Info("Starting simple DNS server")
+	slog.Info("SimpleDNS version", "version", version)
+
 	// CLI flags override config
 	if forwardersFlag.set {
 		forwarders = parseForwarders(forwardersFlag.value)
@@ -893,9 +1941,37 @@ func main() {
 		dnsPort = dnsPortFlag.value
 	}
 
+	if profileFlag.set {
+		profileSelection = profileFlag.value
+	}
+
+	// Demo mode: fixed data in memory, web UI on, nothing written to disk
+	if demoFlag {
+		demoMode = true
+		dbMode = "sqlite"
+		dbPath = ":memory:"
+		webEnabled = true
+	}
+
 	if forwarders == nil {
 		forwarders = []string{}
 	}
+	setBaseForwarders(forwarders)
+	initCache(cacheCfg)
+	if err := initForwardSecurity(forwardSecurityCfg); err != nil {
+		slog.Error("invalid forward_security, using the ports of the system", "error", err)
+	}
+	if err := initRecursion(recursionCfg); err != nil {
+		slog.Error("recursive resolver disabled", "error", err)
+	}
+	if err := initDnstap(dnstapCfg); err != nil {
+		slog.Error("failed to start dnstap", "error", err)
+	}
+	startMetricsPush(metricsCfg)
+
+	if err := setAddressFilters(addressFilterCfg); err != nil {
+		slog.Error("address filter disabled", "error", err)
+	}
 
 	// Initialize based on db_type mode
 	if dbMode == "sqlite" {
@@ -904,16 +1980,123 @@ func main() {
 			slog.Error("failed to initialize database", "error", err)
 			os.Exit(1)
 		}
+		if demoMode {
+			if err := seedDemoData(); err != nil {
+				slog.Error("failed to load demo data", "error", err)
+				os.Exit(1)
+			}
+		}
+		loadServerRoleFromDB()
+		loadAddressFiltersFromDB()
+		loadClientsFromDB()
+		loadSchedulesFromDB()
+		loadMaintenanceFromDB()
 		// Load zones and forwarders from database
 		if err := ReloadFromDB(); err != nil {
 			slog.Warn("failed to load from database", "error", err)
 		}
+		startRecordScheduler()
+		startTrashPruner()
+		if !demoMode {
+			startZoneReminders(remindersCfg)
+		}
+		startSecondaryZones()
+		if !demoMode {
+			startBackupSchedule(backupCfg)
+		}
+		if err := initStatsRetention(statsCfg); err != nil {
+			slog.Error("invalid stats retention, using the defaults", "error", err)
+		}
+		startStatsHistory()
+	} else if dbMode == "kv" {
+		slog.Info("Running in kv mode", "backend", kvCfg.Backend, "address", kvCfg.Address)
+		if err := startKVWatcher(kvCfg); err != nil {
+			slog.Error("failed to start kv backend", "error", err)
+			os.Exit(1)
+		}
+		if complianceMode {
+			slog.Warn("compliance_mode requires sqlite mode, audit log disabled")
+		}
+	} else if dbMode == "git" {
+		slog.Info("Running in git mode", "url", gitCfg.URL, "branch", withGitDefaults(gitCfg).Branch)
+		if err := startGitSync(gitCfg); err != nil {
+			slog.Error("failed to start git sync", "error", err)
+			os.Exit(1)
+		}
+		if complianceMode {
+			slog.Warn("compliance_mode requires sqlite mode, audit log disabled")
+		}
 	} else {
 		slog.Info("Running in files mode", "zones_dir", zonesDirFlag.value)
 		initZones(zonesDirFlag.value)
+		if complianceMode {
+			slog.Warn("compliance_mode requires sqlite mode, audit log disabled")
+		}
+	}
+
+	// Integrations publishing records in their own zones
+	if err := startKubernetesController(kubernetesCfg); err != nil {
+		slog.Error("failed to start the Kubernetes controller", "error", err)
+	}
+	startDockerDiscovery(dockerCfg)
+	startDHCPLeases(dhcpCfg)
+	startVPNPeers(vpnCfg)
+	if err := initMDNS(mdnsCfg); err != nil {
+		slog.Error("failed to start the mDNS bridge", "error", err)
+	}
+	startHostsFiles(hostsCfg)
+	if err := initSearchDomains(searchDomainsCfg); err != nil {
+		slog.Error("search domains disabled", "error", err)
+	}
+	sinkholePage, err := startSinkhole(sinkholeCfg)
+	if err != nil {
+		slog.Error("sinkhole disabled", "error", err)
+	}
+	if err := initDNS64(dns64Cfg); err != nil {
+		slog.Error("DNS64 disabled", "error", err)
+	}
+	initChaos(chaosCfg)
+
+	// Periodically check the live zones against the DB or zone files
+	if verifyInterval > 0 {
+		startZoneVerifier(verifyInterval)
+	}
+	// Periodically look for dangling targets and lame name servers
+	if problemsInterval > 0 {
+		startProblemsChecker(problemsInterval)
+	}
+
+	// Select the network profile (roaming/laptop mode)
+	if len(networkProfiles) > 0 {
+		initProfiles(networkProfiles, profileSelection)
+		startProfileWatcher(profileCheckInterval)
+	}
+
+	// TLS material: certificate files or ACME (DNS-01 against our zones or
+	// HTTP-01 on the web server), both hot-reloaded into the running listeners
+	if tlsCertFile != "" {
+		if acmeCfg.Enabled {
+			slog.Warn("tls_cert_file is set, ignoring ACME configuration")
+			acmeCfg.Enabled = false
+		}
+		if err := loadCertificateFiles(tlsCertFile, tlsKeyFile); err != nil {
+			slog.Error("failed to load TLS certificate", "file", tlsCertFile, "error", err)
+		}
+	}
+	if acmeCfg.Enabled {
+		startACME(acmeCfg)
+	}
+	if tlsCertFile != "" || acmeCfg.Enabled {
+		watchCertificates(tlsCertFile, tlsKeyFile, 30*time.Second)
+	}
+	// Without a certificate file, TLS listeners start with a self-signed
+	// one, replaced once ACME issues the real one
+	if tlsCertFile == "" && ((webEnabled && webTLSPort > 0) || dotPort > 0 || doqPort > 0) {
+		startSelfSignedCertificate(selfSignedNames(acmeCfg.Domains))
 	}
 
 	// Always log the effective configuration and loaded zone names at startup
+	loadedZoneNames := zoneStore.Load().ZoneNames()
 	uniq := make(map[string]struct{}, len(loadedZoneNames))
 	for _, z := range loadedZoneNames {
 		if z == "" {
@@ -933,15 +2116,21 @@ func main() {
 		slog.Info("No zones loaded - use API to add zones")
 	}
 
-	dns.HandleFunc(".", handleDNS)
+	dns.HandleFunc(".", withDnstap(withStats(withClientPolicy(withNSID(withAddressFilter(withDNS64(handleDNS)))))))
 
-	udpServer := &dns.Server{Addr: fmt.Sprintf(":%d", dnsPort), Net: "udp"}
-	tcpServer := &dns.Server{Addr: fmt.Sprintf(":%d", dnsPort), Net: "tcp"}
+	listening := func() { dnsListeners.Add(1) }
+	udpServer := &dns.Server{Addr: fmt.Sprintf(":%d", dnsPort), Net: "udp", ReusePort: reusePort, NotifyStartedFunc: listening, TsigProvider: tsigKeyring{}}
+	tcpServer := &dns.Server{Addr: fmt.Sprintf(":%d", dnsPort), Net: "tcp", ReusePort: reusePort, NotifyStartedFunc: listening, TsigProvider: tsigKeyring{}}
 
 	// Start web server if enabled
-	var webServer *http.Server
+	var webServers []*http.Server
 	if webEnabled {
-		webServer = startWebServer(webPort)
+		if err := validateWebSecurity(webSecurityCfg); err != nil {
+			slog.Error("invalid web_security settings, using the defaults", "error", err)
+		} else {
+			webSecurity = newWebGuard(webSecurityCfg)
+		}
+		webServers = startWebServer(webPort, webTLSPort)
 	}
 
 	// Run servers in goroutines
@@ -961,21 +2150,73 @@ func main() {
 		}
 	}()
 
+	// Encrypted DNS, with the certificate of the HTTPS listener
+	var dotServer *dns.Server
+	if dotPort > 0 {
+		dotServer = &dns.Server{Addr: fmt.Sprintf(":%d", dotPort), Net: "tcp-tls", TLSConfig: serverTLSConfig(), ReusePort: reusePort}
+		go func() {
+			slog.Info("Starting DNS-over-TLS server", "addr", dotServer.Addr)
+			if err := dotServer.ListenAndServe(); err != nil {
+				slog.Error("failed to start DNS-over-TLS server", "error", err)
+			}
+		}()
+	}
+	var doq *doqServer
+	if doqPort > 0 {
+		addr := fmt.Sprintf(":%d", doqPort)
+		slog.Info("Starting DNS-over-QUIC server (experimental)", "addr", addr)
+		var err error
+		if doq, err = startDoQ(addr, dns.DefaultServeMux); err != nil {
+			slog.Error("failed to start DNS-over-QUIC server", "error", err)
+		}
+	}
+
+	watchDebugSignal()
+	pprofServer := startPprofServer()
+
 	// Wait for signal to shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 
 	slog.Info("Shutting down servers...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shuttingDown.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownDrain)
 	defer cancel()
-	_ = udpServer.ShutdownContext(ctx)
-	_ = tcpServer.ShutdownContext(ctx)
-	if webServer != nil {
-		_ = webServer.Shutdown(ctx)
+	// The DNS servers stop reading together, then answer the queries in
+	// flight; with reuse_port the new process already takes the others
+	dnsServers := []*dns.Server{udpServer, tcpServer}
+	if dotServer != nil {
+		dnsServers = append(dnsServers, dotServer)
+	}
+	var drained sync.WaitGroup
+	for _, s := range dnsServers {
+		drained.Add(1)
+		go func() {
+			defer drained.Done()
+			if err := s.ShutdownContext(ctx); errors.Is(err, context.DeadlineExceeded) {
+				slog.Warn("queries still in flight at shutdown", "net", s.Net, "drain", shutdownDrain)
+			}
+		}()
+	}
+	drained.Wait()
+	if doq != nil {
+		_ = doq.Close()
+	}
+	for _, s := range webServers {
+		_ = s.Shutdown(ctx)
+	}
+	if pprofServer != nil {
+		_ = pprofServer.Shutdown(ctx)
+	}
+	if sinkholePage != nil {
+		_ = sinkholePage.Shutdown(ctx)
 	}
+	saveCache(cacheCfg)
+	closeDnstap()
 	if database != nil {
 		_ = database.Close()
 	}
 	slog.Info("Servers stopped")
+	closeLogging()
 }
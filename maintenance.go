@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// MaintenanceState is the maintenance mode: the local answers of every
+// zone (Enabled) or of some zones are withdrawn and their queries go to
+// the forwarders, so zone data can be rebuilt without clients losing
+// resolution
+type MaintenanceState struct {
+	Enabled bool       `json:"enabled"`
+	Zones   []string   `json:"zones"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// maintenanceConfigKey stores the maintenance mode, so it survives a restart
+const maintenanceConfigKey = "maintenance"
+
+// maintenanceSet is the maintenance mode in effect, with its zones indexed
+type maintenanceSet struct {
+	state MaintenanceState
+	zones map[string]bool
+}
+
+var maintenance atomic.Pointer[maintenanceSet]
+
+// normalizeMaintenance lowercases, qualifies and sorts the zones of s,
+// dropping duplicates
+func normalizeMaintenance(s MaintenanceState) MaintenanceState {
+	seen := make(map[string]bool, len(s.Zones))
+	zones := make([]string, 0, len(s.Zones))
+	for _, z := range s.Zones {
+		z = dns.Fqdn(strings.ToLower(strings.TrimSpace(z)))
+		if z == "." || seen[z] {
+			continue
+		}
+		seen[z] = true
+		zones = append(zones, z)
+	}
+	sort.Strings(zones)
+	s.Zones = zones
+	return s
+}
+
+// setMaintenance replaces the maintenance mode
+func setMaintenance(s MaintenanceState) {
+	s = normalizeMaintenance(s)
+	set := &maintenanceSet{state: s, zones: make(map[string]bool, len(s.Zones))}
+	for _, z := range s.Zones {
+		set.zones[z] = true
+	}
+	maintenance.Store(set)
+}
+
+// currentMaintenance returns the maintenance mode in effect
+func currentMaintenance() MaintenanceState {
+	if set := maintenance.Load(); set != nil {
+		return set.state
+	}
+	return MaintenanceState{Zones: []string{}}
+}
+
+// inMaintenance reports whether the local answers of zone are withdrawn
+func inMaintenance(zone string) bool {
+	set := maintenance.Load()
+	if set == nil {
+		return false
+	}
+	return set.state.Enabled || set.zones[strings.ToLower(zone)]
+}
+
+// serveZone reports whether zone is answered from local data right now:
+// neither a forward-only network profile nor the maintenance mode applies
+func serveZone(zone string) bool {
+	return serveLocalZones() && !inMaintenance(zone)
+}
+
+// maintenanceWarning is the /api/health warning while zones are withdrawn
+func maintenanceWarning() string {
+	s := currentMaintenance()
+	switch {
+	case s.Enabled:
+		return "maintenance mode: all zones are forwarded upstream (see /api/maintenance)"
+	case len(s.Zones) > 0:
+		return "maintenance mode: " + strings.Join(s.Zones, ", ") + " forwarded upstream (see /api/maintenance)"
+	}
+	return ""
+}
+
+// loadMaintenanceFromDB applies the maintenance mode saved before a restart
+func loadMaintenanceFromDB() {
+	if database == nil {
+		return
+	}
+	v, err := database.GetConfig(maintenanceConfigKey)
+	if err != nil || v == "" {
+		return
+	}
+	var s MaintenanceState
+	if err := json.Unmarshal([]byte(v), &s); err != nil {
+		slog.Error("invalid maintenance mode in database", "error", err)
+		return
+	}
+	setMaintenance(s)
+	if s.Enabled || len(s.Zones) > 0 {
+		slog.Warn("maintenance mode is on, local answers are forwarded upstream", "all", s.Enabled, "zones", s.Zones)
+	}
+}
+
+// handleAPIGetMaintenance handles GET /api/maintenance
+func handleAPIGetMaintenance(c *gin.Context) {
+	c.JSON(http.StatusOK, currentMaintenance())
+}
+
+// handleAPISetMaintenance handles PUT /api/maintenance
+func handleAPISetMaintenance(c *gin.Context) {
+	var s MaintenanceState
+	if err := c.ShouldBindJSON(&s); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s = normalizeMaintenance(s)
+	s.Since = nil
+	if s.Enabled || len(s.Zones) > 0 {
+		// Keep the start of a maintenance that goes on
+		if prev := currentMaintenance(); prev.Since != nil {
+			s.Since = prev.Since
+		} else {
+			now := time.Now().UTC()
+			s.Since = &now
+		}
+	}
+
+	data, _ := json.Marshal(s)
+	if err := database.SetConfig(maintenanceConfigKey, string(data)); err != nil {
+		slog.Error("failed to save maintenance mode", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save maintenance mode"})
+		return
+	}
+	setMaintenance(s)
+
+	slog.Info("Maintenance mode changed", "all", s.Enabled, "zones", s.Zones, "user", c.GetString("username"))
+	c.JSON(http.StatusOK, currentMaintenance())
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// MDNSConfig configures the mDNS/LLMNR bridge: unicast queries for .local
+// names are resolved with multicast on the LAN, so devices that only speak
+// unicast DNS can reach printers, Chromecasts and other mDNS hosts
+type MDNSConfig struct {
+	Enabled   bool   `yaml:"enabled" json:"enabled,omitempty"`
+	LLMNR     bool   `yaml:"llmnr" json:"llmnr,omitempty"`           // also resolve single-label names with LLMNR (Windows hosts)
+	Interface string `yaml:"interface" json:"interface,omitempty"`   // multicast interface, the default route when empty
+	TimeoutMS int    `yaml:"timeout_ms" json:"timeout_ms,omitempty"` // default 1000
+	// Advertise publishes records over mDNS, e.g. {name: nas.local, type: A,
+	// value: 192.168.1.20}
+	Advertise []YAMLRecord `yaml:"advertise" json:"advertise,omitempty"`
+}
+
+var (
+	mdnsGroup  = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+	llmnrGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 252), Port: 5355}
+)
+
+// mdnsCacheFlush is the cache-flush bit mDNS sets in the record class
+const mdnsCacheFlush = 1 << 15
+
+// mdnsBridge is nil when the bridge is disabled
+var mdnsBridge *mdnsResolver
+
+type mdnsResolver struct {
+	iface   *net.Interface
+	timeout time.Duration
+	llmnr   bool
+}
+
+// initMDNS enables the bridge and starts advertising the configured records
+func initMDNS(cfg MDNSConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	var iface *net.Interface
+	if cfg.Interface != "" {
+		var err error
+		if iface, err = net.InterfaceByName(cfg.Interface); err != nil {
+			return err
+		}
+	}
+	timeout := time.Second
+	if cfg.TimeoutMS > 0 {
+		timeout = time.Duration(cfg.TimeoutMS) * time.Millisecond
+	}
+	mdnsBridge = &mdnsResolver{iface: iface, timeout: timeout, llmnr: cfg.LLMNR}
+	slog.Info("mDNS bridge enabled", "llmnr", cfg.LLMNR, "interface", cfg.Interface)
+
+	if len(cfg.Advertise) > 0 {
+		var rrs []dns.RR
+		for _, r := range cfg.Advertise {
+			ttl := r.TTL
+			if ttl == 0 {
+				ttl = 120
+			}
+			rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(r.Name), ttl, r.Type, r.Value))
+			if err != nil {
+				return fmt.Errorf("invalid mdns record %s: %w", r.Name, err)
+			}
+			rrs = append(rrs, rr)
+		}
+		if err := startMDNSResponder(iface, rrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handles reports whether name is resolved by the bridge: .local names,
+// and single-label names with LLMNR
+func (m *mdnsResolver) handles(name string) bool {
+	if m == nil {
+		return false
+	}
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".local.") || (m.llmnr && dns.CountLabel(name) == 1)
+}
+
+// resolve asks the LAN. Answers come from a one-shot query (RFC 6762
+// section 5.1), so responders reply by unicast to our port.
+func (m *mdnsResolver) resolve(ctx context.Context, q dns.Question) ([]dns.RR, error) {
+	group := mdnsGroup
+	if !strings.HasSuffix(strings.ToLower(q.Name), ".local.") {
+		group = llmnrGroup
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	query := new(dns.Msg)
+	query.SetQuestion(q.Name, q.Qtype)
+	query.RecursionDesired = false
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(packed, group); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(m.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetReadDeadline(deadline)
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// Timeout: nobody answered
+			return nil, nil
+		}
+		resp := new(dns.Msg)
+		if resp.Unpack(buf[:n]) != nil || !resp.Response {
+			continue
+		}
+		var answers []dns.RR
+		for _, rr := range resp.Answer {
+			h := rr.Header()
+			h.Class &^= mdnsCacheFlush
+			if strings.EqualFold(h.Name, q.Name) && (h.Rrtype == q.Qtype || h.Rrtype == dns.TypeCNAME || q.Qtype == dns.TypeANY) {
+				// mDNS records are for the link, keep them short-lived
+				h.Ttl = min(h.Ttl, 10)
+				answers = append(answers, rr)
+			}
+		}
+		if len(answers) > 0 {
+			return answers, nil
+		}
+	}
+}
+
+// handleMDNSQuery answers a unicast query through the bridge
+func handleMDNSQuery(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	q := r.Question[0]
+	ctx, cancel := context.WithTimeout(context.Background(), mdnsBridge.timeout)
+	defer cancel()
+	answers, err := mdnsBridge.resolve(ctx, q)
+	if err != nil {
+		slog.Debug("mdns resolution failed", "name", q.Name, "error", err)
+	}
+	m.Authoritative = false
+	m.RecursionAvailable = true
+	if len(answers) == 0 {
+		m.Rcode = dns.RcodeNameError
+	}
+	m.Answer = append(m.Answer, answers...)
+	if err := w.WriteMsg(m); err != nil {
+		slog.Debug("failed to write mdns response", "client", w.RemoteAddr(), "error", err)
+		return
+	}
+	slog.Debug("Answered over mDNS", "name", q.Name, "client", w.RemoteAddr(), "answers", len(answers))
+}
+
+// startMDNSResponder answers mDNS queries for rrs on the LAN and announces
+// them at startup
+func startMDNSResponder(iface *net.Interface, rrs []dns.RR) error {
+	conn, err := net.ListenMulticastUDP("udp4", iface, mdnsGroup)
+	if err != nil {
+		return fmt.Errorf("mdns responder: %w", err)
+	}
+
+	// Records we own are unique: set cache-flush in multicast answers
+	announce := func(answers []dns.RR, to *net.UDPAddr, id uint16, question []dns.Question, unicast bool) {
+		resp := new(dns.Msg)
+		resp.Id = id
+		resp.Response = true
+		resp.Authoritative = true
+		resp.Question = question
+		for _, rr := range answers {
+			rr = dns.Copy(rr)
+			if !unicast {
+				rr.Header().Class |= mdnsCacheFlush
+			}
+			resp.Answer = append(resp.Answer, rr)
+		}
+		if packed, err := resp.Pack(); err == nil {
+			_, _ = conn.WriteToUDP(packed, to)
+		}
+	}
+	announce(rrs, mdnsGroup, 0, nil, false)
+	slog.Info("Advertising records over mDNS", "records", len(rrs))
+
+	go func() {
+		buf := make([]byte, 9000)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				slog.Warn("mdns responder stopped", "error", err)
+				return
+			}
+			query := new(dns.Msg)
+			if query.Unpack(buf[:n]) != nil || query.Response {
+				continue
+			}
+			var answers []dns.RR
+			unicast := from.Port != mdnsGroup.Port // legacy one-shot query
+			for _, q := range query.Question {
+				if q.Qclass&mdnsCacheFlush != 0 {
+					unicast = true // QU bit
+				}
+				for _, rr := range rrs {
+					h := rr.Header()
+					if strings.EqualFold(h.Name, q.Name) && (q.Qtype == h.Rrtype || q.Qtype == dns.TypeANY) {
+						answers = append(answers, rr)
+					}
+				}
+			}
+			if len(answers) == 0 {
+				continue
+			}
+			if from.Port != mdnsGroup.Port {
+				// Legacy unicast responses echo the id and the question
+				announce(answers, from, query.Id, query.Question, true)
+			} else if unicast {
+				announce(answers, from, 0, nil, true)
+			} else {
+				announce(answers, mdnsGroup, 0, nil, false)
+			}
+		}
+	}()
+	return nil
+}
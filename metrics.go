@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricsConfig configures the push of metrics to InfluxDB or Graphite
+type MetricsConfig struct {
+	// Format is "influx" (line protocol over HTTP) or "graphite" (plaintext
+	// protocol over TCP)
+	Format string `yaml:"format" json:"format,omitempty"`
+	// Address is the InfluxDB write URL, e.g.
+	// http://influx:8086/api/v2/write?org=home&bucket=dns&precision=s, or
+	// the Graphite host:port (usually 2003)
+	Address     string `yaml:"address" json:"address,omitempty"`
+	Token       string `yaml:"token" json:"-"`                 // InfluxDB v2 API token
+	Prefix      string `yaml:"prefix" json:"prefix,omitempty"` // measurement/path prefix, default "simpledns"
+	IntervalSec int    `yaml:"interval_seconds" json:"interval_seconds,omitempty"`
+}
+
+// metric is one named value
+type metric struct {
+	name  string // dotted path, e.g. cache.hits
+	value float64
+}
+
+// collectMetrics gathers the query, cache, forwarding and replication
+// counters, sorted by name
+func collectMetrics() []metric {
+	var metrics []metric
+	add := func(prefix string, values map[string]any) {
+		for key, v := range values {
+			var f float64
+			switch n := v.(type) {
+			case int:
+				f = float64(n)
+			case int64:
+				f = float64(n)
+			case uint64:
+				f = float64(n)
+			case float64:
+				f = n
+			default:
+				continue
+			}
+			metrics = append(metrics, metric{name: prefix + "." + key, value: f})
+		}
+	}
+
+	queries := make(map[string]any)
+	for k, v := range queryStats.Totals() {
+		queries[k] = v
+	}
+	add("queries", queries)
+	add("cache", forwardCache.Stats())
+	add("forwarding", forwardLimit.Stats())
+	add("dnstap", dnstapOut.Stats())
+	add("rebinding", map[string]any{"stripped": rebindingStripped.Load()})
+
+	zd := zoneStore.Load()
+	master := 0
+	if currentServerRole() == roleMaster {
+		master = 1
+	}
+	add("zones", map[string]any{"loaded": len(zd.ZoneNames()), "records": zd.RecordCount()})
+	add("replication", map[string]any{"master": master})
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+	return metrics
+}
+
+// influxLine formats the metrics as one InfluxDB line protocol point
+func influxLine(measurement, host string, metrics []metric, at time.Time) string {
+	fields := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		fields = append(fields, strings.ReplaceAll(m.name, ".", "_")+"="+strconv.FormatFloat(m.value, 'f', -1, 64))
+	}
+	host = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(host)
+	return fmt.Sprintf("%s,host=%s %s %d\n", measurement, host, strings.Join(fields, ","), at.Unix())
+}
+
+// graphiteLines formats the metrics in the Graphite plaintext protocol
+func graphiteLines(prefix, host string, metrics []metric, at time.Time) string {
+	host = strings.ReplaceAll(host, ".", "_")
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "%s.%s.%s %s %d\n", prefix, host, m.name, strconv.FormatFloat(m.value, 'f', -1, 64), at.Unix())
+	}
+	return b.String()
+}
+
+// pushMetrics sends one sample of the metrics
+func pushMetrics(ctx context.Context, cfg MetricsConfig, host string) error {
+	now := time.Now()
+	metrics := collectMetrics()
+
+	switch cfg.Format {
+	case "influx":
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Address, strings.NewReader(influxLine(cfg.Prefix, host, metrics, now)))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if cfg.Token != "" {
+			req.Header.Set("Authorization", "Token "+cfg.Token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode >= 300 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return fmt.Errorf("influx write: %s: %s", resp.Status, bytes.TrimSpace(body))
+		}
+		return nil
+	case "graphite":
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", cfg.Address)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = conn.Close() }()
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		_, err = io.WriteString(conn, graphiteLines(cfg.Prefix, host, metrics, now))
+		return err
+	default:
+		return fmt.Errorf("unknown metrics format %q", cfg.Format)
+	}
+}
+
+// startMetricsPush pushes the metrics every interval until the process
+// exits. Does nothing when no address is configured.
+func startMetricsPush(cfg MetricsConfig) {
+	if cfg.Address == "" {
+		return
+	}
+	if cfg.Format != "influx" && cfg.Format != "graphite" {
+		slog.Error("unknown metrics format, metrics push disabled", "format", cfg.Format)
+		return
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "simpledns"
+	}
+	interval := time.Minute
+	if cfg.IntervalSec > 0 {
+		interval = time.Duration(cfg.IntervalSec) * time.Second
+	}
+	slog.Info("Pushing metrics", "format", cfg.Format, "interval", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := pushMetrics(ctx, cfg, instanceName); err != nil {
+				slog.Warn("failed to push metrics", "format", cfg.Format, "error", err)
+			}
+			cancel()
+		}
+	}()
+}
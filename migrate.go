@@ -0,0 +1,620 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// MigrationRequest imports the forwarders and local data of another
+// resolver's configuration
+type MigrationRequest struct {
+	Format string `json:"format" binding:"required"` // resolv, dnsmasq or unbound
+	Data   string `json:"data" binding:"required"`
+	DryRun bool   `json:"dry_run"` // only return the plan
+}
+
+// MigrationPlan is what a resolver configuration translates to
+type MigrationPlan struct {
+	Forwarders   []string               `json:"forwarders"` // new forwarders
+	ForwardZones []MigrationForwardZone `json:"forward_zones"`
+	Zones        []MigrationZone        `json:"zones"`
+	Skipped      []SkippedLine          `json:"skipped"`
+}
+
+// MigrationForwardZone is a domain sent to its own forwarders (conditional
+// forwarding)
+type MigrationForwardZone struct {
+	Name       string   `json:"name"`
+	Forwarders []string `json:"forwarders"`
+}
+
+// MigrationZone holds the local records of one zone. Exists is set when the
+// records are added to a zone already in the database.
+type MigrationZone struct {
+	Name    string     `json:"name"`
+	Exists  bool       `json:"exists"`
+	Records []DBRecord `json:"records"`
+}
+
+// SkippedLine is a configuration line with no simpledns equivalent
+type SkippedLine struct {
+	Line   int    `json:"line,omitempty"`
+	Text   string `json:"text"`
+	Reason string `json:"reason"`
+}
+
+// resolverConfig is the part of a resolver configuration simpledns can take
+// over
+type resolverConfig struct {
+	forwarders   []string
+	forwardZones []MigrationForwardZone
+	records      []migratedRR
+	domains      []string // names that should be zones of their own
+	skipped      []SkippedLine
+}
+
+// migratedRR is a local record and the line it comes from
+type migratedRR struct {
+	rr   dns.RR
+	line int
+	text string
+}
+
+func (rc *resolverConfig) skip(line int, text, reason string) {
+	rc.skipped = append(rc.skipped, SkippedLine{Line: line, Text: strings.TrimSpace(text), Reason: reason})
+}
+
+// addForwardZone adds a forwarder to the forward zone of domain
+func (rc *resolverConfig) addForwardZone(domain, addr string) {
+	name := strings.TrimSuffix(strings.ToLower(domain), ".")
+	for i, z := range rc.forwardZones {
+		if z.Name == name {
+			if !slices.Contains(z.Forwarders, addr) {
+				rc.forwardZones[i].Forwarders = append(z.Forwarders, addr)
+			}
+			return
+		}
+	}
+	rc.forwardZones = append(rc.forwardZones, MigrationForwardZone{Name: name, Forwarders: []string{addr}})
+}
+
+// addRR parses a record in presentation format
+func (rc *resolverConfig) addRR(line int, text, s string) {
+	rr, err := dns.NewRR(s)
+	if err != nil || rr == nil {
+		rc.skip(line, text, "invalid record")
+		return
+	}
+	rc.records = append(rc.records, migratedRR{rr: rr, line: line, text: strings.TrimSpace(text)})
+}
+
+// addressRR returns the A or AAAA record of name for ip
+func addressRR(name string, ip net.IP, ttl uint32) dns.RR {
+	hdr := dns.RR_Header{Name: dns.Fqdn(strings.ToLower(name)), Class: dns.ClassINET, Ttl: ttl}
+	if ip4 := ip.To4(); ip4 != nil {
+		hdr.Rrtype = dns.TypeA
+		return &dns.A{Hdr: hdr, A: ip4}
+	}
+	hdr.Rrtype = dns.TypeAAAA
+	return &dns.AAAA{Hdr: hdr, AAAA: ip}
+}
+
+// forwarderAddress returns host:port for a server address written as
+// host, host#port (dnsmasq) or host@port (unbound)
+func forwarderAddress(s string, sep byte) (string, bool) {
+	host, port := s, "53"
+	if i := strings.IndexByte(s, sep); i >= 0 {
+		host, port = s[:i], s[i+1:]
+	}
+	if net.ParseIP(host) == nil {
+		return "", false
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", false
+	}
+	return net.JoinHostPort(host, port), true
+}
+
+// parseResolvConf reads the nameservers of a resolv.conf
+func parseResolvConf(data string) *resolverConfig {
+	rc := &resolverConfig{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		fields := strings.Fields(strings.SplitN(strings.SplitN(line, "#", 2)[0], ";", 2)[0])
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		ip := net.ParseIP(fields[1])
+		switch {
+		case ip == nil:
+			rc.skip(n, line, "invalid nameserver address")
+		case ip.IsLoopback():
+			rc.skip(n, line, "points at a local resolver")
+		default:
+			rc.forwarders = append(rc.forwarders, net.JoinHostPort(ip.String(), "53"))
+		}
+	}
+	return rc
+}
+
+// parseDnsmasqConf reads upstream servers and local records of a
+// dnsmasq.conf
+func parseDnsmasqConf(data string) *resolverConfig {
+	rc := &resolverConfig{}
+	ttl := uint32(0) // dnsmasq answers local data with TTL 0 by default
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(trimmed, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		args := strings.Split(value, ",")
+		for i := range args {
+			args[i] = strings.TrimSpace(args[i])
+		}
+
+		switch key {
+		case "local-ttl":
+			if v, err := strconv.ParseUint(value, 10, 32); err == nil {
+				ttl = uint32(v)
+			}
+		case "server":
+			// server=/corp.lan/other.lan/10.0.0.53#5353 forwards the domains
+			if strings.HasPrefix(value, "/") {
+				parts := strings.Split(value[1:], "/")
+				addr, ok := forwarderAddress(parts[len(parts)-1], '#')
+				switch {
+				case parts[len(parts)-1] == "":
+					rc.skip(n, line, "local-only domains are not supported")
+				case !ok:
+					rc.skip(n, line, "invalid server address")
+				default:
+					for _, d := range parts[:len(parts)-1] {
+						if d != "" {
+							rc.addForwardZone(d, addr)
+						}
+					}
+				}
+				continue
+			}
+			if addr, ok := forwarderAddress(value, '#'); ok {
+				rc.forwarders = append(rc.forwarders, addr)
+			} else {
+				rc.skip(n, line, "invalid server address")
+			}
+		case "address":
+			// address=/example.lan/other.lan/192.168.1.10 answers the domains
+			// and everything below them; simpledns has no wildcards, so only
+			// the domains themselves are answered
+			parts := strings.Split(strings.Trim(value, "/"), "/")
+			ip := net.ParseIP(parts[len(parts)-1])
+			if !strings.HasPrefix(value, "/") || len(parts) < 2 || ip == nil || ip.IsUnspecified() {
+				rc.skip(n, line, "blocking is not supported")
+				continue
+			}
+			for _, domain := range parts[:len(parts)-1] {
+				if _, ok := dns.IsDomainName(domain); !ok || domain == "" || domain == "#" {
+					rc.skip(n, line, "invalid domain "+domain)
+					continue
+				}
+				rc.domains = append(rc.domains, dns.Fqdn(strings.ToLower(domain)))
+				rc.records = append(rc.records, migratedRR{rr: addressRR(domain, ip, ttl), line: n, text: trimmed})
+			}
+		case "host-record":
+			// host-record=name[,name...],ipv4[,ipv6][,ttl]
+			recordTTL := ttl
+			var names []string
+			var ips []net.IP
+			for i, arg := range args {
+				if ip := net.ParseIP(arg); ip != nil {
+					ips = append(ips, ip)
+				} else if v, err := strconv.ParseUint(arg, 10, 32); err == nil && i == len(args)-1 {
+					recordTTL = uint32(v)
+				} else {
+					names = append(names, arg)
+				}
+			}
+			if len(names) == 0 || len(ips) == 0 {
+				rc.skip(n, line, "invalid host-record")
+				continue
+			}
+			for _, name := range names {
+				for _, ip := range ips {
+					rc.records = append(rc.records, migratedRR{rr: addressRR(name, ip, recordTTL), line: n, text: trimmed})
+				}
+			}
+		case "cname":
+			// cname=alias[,alias...],target[,ttl]
+			if len(args) < 2 {
+				rc.skip(n, line, "invalid cname")
+				continue
+			}
+			recordTTL := ttl
+			if v, err := strconv.ParseUint(args[len(args)-1], 10, 32); err == nil {
+				recordTTL = uint32(v)
+				args = args[:len(args)-1]
+			}
+			target := args[len(args)-1]
+			for _, alias := range args[:len(args)-1] {
+				rc.addRR(n, line, fmt.Sprintf("%s %d IN CNAME %s", dns.Fqdn(alias), recordTTL, dns.Fqdn(target)))
+			}
+		case "mx-host":
+			// mx-host=domain[,target[,preference]]
+			target, pref := args[0], "1"
+			if len(args) > 1 {
+				target = args[1]
+			}
+			if len(args) > 2 {
+				pref = args[2]
+			}
+			rc.addRR(n, line, fmt.Sprintf("%s %d IN MX %s %s", dns.Fqdn(args[0]), ttl, pref, dns.Fqdn(target)))
+		case "txt-record":
+			// txt-record=name,"text"[,"text"...]
+			if len(args) < 2 {
+				rc.skip(n, line, "invalid txt-record")
+				continue
+			}
+			name, text, _ := strings.Cut(value, ",")
+			rc.addRR(n, line, fmt.Sprintf("%s %d IN TXT %s", dns.Fqdn(strings.TrimSpace(name)), ttl, strings.ReplaceAll(text, `","`, `" "`)))
+		case "srv-host":
+			// srv-host=_service._proto.name,target,port,priority,weight
+			if len(args) < 2 {
+				rc.skip(n, line, "SRV records without a target are not supported")
+				continue
+			}
+			port, priority, weight := "0", "0", "0"
+			for i, v := range []*string{&port, &priority, &weight} {
+				if len(args) > i+2 {
+					*v = args[i+2]
+				}
+			}
+			rc.addRR(n, line, fmt.Sprintf("%s %d IN SRV %s %s %s %s", dns.Fqdn(args[0]), ttl, priority, weight, port, dns.Fqdn(args[1])))
+		case "ptr-record":
+			if len(args) < 2 {
+				rc.skip(n, line, "invalid ptr-record")
+				continue
+			}
+			rc.addRR(n, line, fmt.Sprintf("%s %d IN PTR %s", dns.Fqdn(args[0]), ttl, dns.Fqdn(args[1])))
+		case "addn-hosts":
+			rc.skip(n, line, "list the file under hosts.files in the configuration")
+		case "conf-file", "conf-dir", "servers-file", "resolv-file":
+			rc.skip(n, line, "included files are not read, import them separately")
+		}
+	}
+	return rc
+}
+
+// parseUnboundConf reads forward zones and local data of an unbound.conf
+func parseUnboundConf(data string) *resolverConfig {
+	rc := &resolverConfig{}
+	var clause, zoneName string
+	var zoneAddrs []string
+	var zoneLine int
+	var zoneTLS bool
+	endForwardZone := func() {
+		switch {
+		case clause != "forward-zone" || len(zoneAddrs) == 0:
+		case zoneTLS:
+			rc.skip(zoneLine, "forward-zone: "+zoneName, "DNS-over-TLS forwarders are not supported")
+		case zoneName != ".":
+			for _, a := range zoneAddrs {
+				rc.addForwardZone(zoneName, a)
+			}
+		default:
+			rc.forwarders = append(rc.forwarders, zoneAddrs...)
+		}
+		zoneName, zoneAddrs, zoneTLS = "", nil, false
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(stripUnboundComment(line))
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		unquoted := value
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			unquoted = strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`)
+		}
+
+		if value == "" {
+			// Clause header: server:, forward-zone:, stub-zone:...
+			endForwardZone()
+			clause = key
+			if clause == "forward-zone" {
+				zoneLine = n
+			} else if clause == "stub-zone" {
+				rc.skip(n, line, "stub zones are not supported")
+			}
+			continue
+		}
+
+		switch key {
+		case "name":
+			if clause == "forward-zone" {
+				zoneName = dns.Fqdn(strings.ToLower(unquoted))
+			}
+		case "forward-addr":
+			if clause != "forward-zone" {
+				continue
+			}
+			addr, _, _ := strings.Cut(unquoted, "#") // TLS auth name
+			if a, ok := forwarderAddress(addr, '@'); ok {
+				zoneAddrs = append(zoneAddrs, a)
+			} else {
+				rc.skip(n, line, "invalid forwarder address")
+			}
+		case "forward-host":
+			rc.skip(n, line, "forwarders must be IP addresses")
+		case "forward-tls-upstream":
+			zoneTLS = unquoted == "yes"
+		case "local-zone":
+			// local-zone: "name" type
+			fields := strings.Fields(value)
+			if len(fields) < 2 {
+				continue
+			}
+			name := dns.Fqdn(strings.ToLower(strings.Trim(fields[0], `"`)))
+			switch fields[1] {
+			case "static", "transparent", "typetransparent", "redirect":
+				rc.domains = append(rc.domains, name)
+			default:
+				rc.skip(n, line, "blocking is not supported")
+			}
+		case "local-data":
+			rc.addRR(n, line, unquoted)
+		case "local-data-ptr":
+			// local-data-ptr: "192.168.1.10 nas.lab"
+			fields := strings.Fields(unquoted)
+			if len(fields) < 2 {
+				rc.skip(n, line, "invalid local-data-ptr")
+				continue
+			}
+			arpa, err := dns.ReverseAddr(fields[0])
+			if err != nil {
+				rc.skip(n, line, "invalid address")
+				continue
+			}
+			ttl := "3600"
+			if len(fields) > 2 {
+				ttl, fields[1] = fields[1], fields[2]
+			}
+			rc.addRR(n, line, fmt.Sprintf("%s %s IN PTR %s", arpa, ttl, dns.Fqdn(fields[1])))
+		}
+	}
+	endForwardZone()
+	return rc
+}
+
+// stripUnboundComment removes a comment: '#' at the start of the line or
+// after a space, outside quotes (1.1.1.1@853#cloudflare-dns.com is a value)
+func stripUnboundComment(line string) string {
+	quoted := false
+	for i, r := range line {
+		switch {
+		case r == '"' && (i == 0 || line[i-1] != '\\'):
+			quoted = !quoted
+		case r == '#' && !quoted && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// migrationZoneFor returns the zone a record belongs to: the longest
+// matching existing or declared zone, else the parent of the name
+func migrationZoneFor(name string, zones []string) string {
+	best := ""
+	for _, z := range zones {
+		if dns.IsSubDomain(z, name) && len(z) > len(best) {
+			best = z
+		}
+	}
+	if best != "" {
+		return best
+	}
+	labels := dns.SplitDomainName(name)
+	if len(labels) < 2 {
+		return ""
+	}
+	return dns.Fqdn(strings.Join(labels[1:], "."))
+}
+
+// planMigration turns a parsed configuration into forwarders and zones to
+// create, given the forwarders and zones already in the database
+func planMigration(rc *resolverConfig, existingForwarders, existingZones []string) *MigrationPlan {
+	plan := &MigrationPlan{Forwarders: []string{}, ForwardZones: []MigrationForwardZone{}, Zones: []MigrationZone{}, Skipped: rc.skipped}
+	for _, f := range rc.forwarders {
+		if slices.Contains(existingForwarders, f) || slices.Contains(plan.Forwarders, f) {
+			continue
+		}
+		plan.Forwarders = append(plan.Forwarders, f)
+	}
+	for _, z := range rc.forwardZones {
+		if slices.ContainsFunc(existingZones, func(e string) bool { return strings.EqualFold(strings.TrimSuffix(e, "."), z.Name) }) {
+			plan.Skipped = append(plan.Skipped, SkippedLine{Text: z.Name, Reason: "zone already exists"})
+			continue
+		}
+		plan.ForwardZones = append(plan.ForwardZones, z)
+	}
+
+	known := make([]string, 0, len(existingZones)+len(rc.domains))
+	for _, z := range existingZones {
+		known = append(known, dns.Fqdn(strings.ToLower(z)))
+	}
+	known = append(known, rc.domains...)
+	byName := make(map[string]int)
+	for _, m := range rc.records {
+		zone := migrationZoneFor(m.rr.Header().Name, known)
+		if zone == "" {
+			plan.Skipped = append(plan.Skipped, SkippedLine{Line: m.line, Text: m.text, Reason: "single-label names need a zone"})
+			continue
+		}
+		if !slices.Contains(known, zone) {
+			known = append(known, zone)
+		}
+		i, ok := byName[zone]
+		if !ok {
+			i = len(plan.Zones)
+			byName[zone] = i
+			plan.Zones = append(plan.Zones, MigrationZone{
+				Name:   strings.TrimSuffix(zone, "."),
+				Exists: slices.ContainsFunc(existingZones, func(z string) bool { return dns.Fqdn(strings.ToLower(z)) == zone }),
+			})
+		}
+		plan.Zones[i].Records = append(plan.Zones[i].Records, rrToRecord(zone, m.rr))
+	}
+	return plan
+}
+
+// dropExistingRecords removes from the plan the records already in their
+// zone, so importing the same configuration twice changes nothing
+func dropExistingRecords(plan *MigrationPlan, zoneIDs map[string]int64) error {
+	for i, z := range plan.Zones {
+		if !z.Exists {
+			continue
+		}
+		existing, err := database.ListRecordsByZone(zoneIDs[z.Name])
+		if err != nil {
+			return err
+		}
+		kept := []DBRecord{}
+		for _, r := range z.Records {
+			if slices.ContainsFunc(existing, func(e DBRecord) bool {
+				return strings.EqualFold(e.Name, r.Name) && strings.EqualFold(e.Type, r.Type) && e.Value == r.Value
+			}) {
+				continue
+			}
+			kept = append(kept, r)
+		}
+		plan.Zones[i].Records = kept
+	}
+	return nil
+}
+
+// handleAPIMigrateResolver handles POST /api/import/resolver
+func handleAPIMigrateResolver(c *gin.Context) {
+	var req MigrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var rc *resolverConfig
+	switch req.Format {
+	case "resolv":
+		rc = parseResolvConf(req.Data)
+	case "dnsmasq":
+		rc = parseDnsmasqConf(req.Data)
+	case "unbound":
+		rc = parseUnboundConf(req.Data)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be resolv, dnsmasq or unbound"})
+		return
+	}
+
+	dbForwarders, err := database.ListForwarders()
+	if err != nil {
+		slog.Error("failed to list forwarders", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list forwarders"})
+		return
+	}
+	dbZones, err := database.ListZones()
+	if err != nil {
+		slog.Error("failed to list zones", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list zones"})
+		return
+	}
+	var forwarderAddrs, zoneNames []string
+	for _, f := range dbForwarders {
+		forwarderAddrs = append(forwarderAddrs, f.Address)
+	}
+	zoneIDs := make(map[string]int64)
+	for _, z := range dbZones {
+		zoneNames = append(zoneNames, z.Name)
+		zoneIDs[strings.ToLower(strings.TrimSuffix(z.Name, "."))] = z.ID
+	}
+
+	plan := planMigration(rc, forwarderAddrs, zoneNames)
+	if err := dropExistingRecords(plan, zoneIDs); err != nil {
+		slog.Error("failed to list records", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list records"})
+		return
+	}
+	if req.DryRun {
+		c.JSON(http.StatusOK, plan)
+		return
+	}
+
+	for i, addr := range plan.Forwarders {
+		if err := database.CreateForwarder(&DBForwarder{Address: addr, Priority: len(forwarderAddrs) + i}); err != nil {
+			slog.Error("failed to create forwarder", "address", addr, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create forwarder " + addr})
+			return
+		}
+	}
+	for _, z := range plan.ForwardZones {
+		zone := newImportedZone(z.Name)
+		zone.Type = zoneTypeForward
+		zone.Forwarders = strings.Join(z.Forwarders, ",")
+		if err := database.CreateZone(zone); err != nil {
+			slog.Error("failed to create zone", "zone", z.Name, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create zone " + z.Name})
+			return
+		}
+	}
+	for _, z := range plan.Zones {
+		if !z.Exists {
+			zone := newImportedZone(z.Name)
+			for i := range z.Records {
+				if z.Records[i].TTL == 0 {
+					z.Records[i].TTL = zone.TTL
+				}
+			}
+			if err := database.CreateZoneWithRecords(zone, z.Records); err != nil {
+				slog.Error("failed to create zone", "zone", z.Name, "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create zone " + z.Name})
+				return
+			}
+			continue
+		}
+		zoneID := zoneIDs[z.Name]
+		for _, r := range z.Records {
+			r.ZoneID = zoneID
+			if r.TTL == 0 {
+				r.TTL = zoneDefaultTTL(zoneID)
+			}
+			if err := database.CreateRecord(&r); err != nil {
+				slog.Error("failed to create record", "zone", z.Name, "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create record in " + z.Name})
+				return
+			}
+		}
+	}
+
+	// Reload forwarders and zones into memory
+	if err := LoadForwardersFromDB(); err != nil {
+		slog.Error("failed to reload forwarders", "error", err)
+	}
+	if err := LoadZonesFromDB(); err != nil {
+		slog.Error("failed to reload zones", "error", err)
+	}
+
+	slog.Info("Resolver configuration imported", "format", req.Format, "forwarders", len(plan.Forwarders), "forward_zones", len(plan.ForwardZones), "zones", len(plan.Zones), "skipped", len(plan.Skipped))
+	c.JSON(http.StatusCreated, plan)
+}
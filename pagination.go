@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxListLimit caps the page size of the list APIs
+const maxListLimit = 1000
+
+// recordsPageSize is the number of records shown per page in the web UI
+const recordsPageSize = 200
+
+// ListQuery is the page, order and filters of a list API, read from
+// ?limit=&offset=&sort=&name=&type=&q=. The sort key is one of those of
+// the list, with "-" first for descending.
+type ListQuery struct {
+	Limit  int // 0 returns everything
+	Offset int
+	Sort   string // SQL columns of the sort key, comma separated
+	Desc   bool
+	Name   string // substring of the name
+	Type   string // exact type
+	Search string // substring of any text column
+}
+
+// parseListQuery reads a ListQuery; sorts maps the accepted sort keys to
+// their SQL column, the first key listed in order being the default
+func parseListQuery(c *gin.Context, sorts map[string]string, order ...string) (ListQuery, error) {
+	q := ListQuery{
+		Name:   strings.TrimSpace(c.Query("name")),
+		Type:   strings.ToUpper(strings.TrimSpace(c.Query("type"))),
+		Search: strings.TrimSpace(c.Query("q")),
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxListLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+		}
+		q.Limit = limit
+	}
+	if v := c.Query("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return q, fmt.Errorf("offset must be a positive number")
+		}
+		q.Offset = offset
+	}
+	key := strings.TrimSpace(c.Query("sort"))
+	key, q.Desc = strings.CutPrefix(key, "-")
+	if key == "" {
+		key = order[0]
+	}
+	column, ok := sorts[key]
+	if !ok {
+		return q, fmt.Errorf("sort must be one of %s", strings.Join(order, ", "))
+	}
+	q.Sort = column
+	return q, nil
+}
+
+// orderBy returns the ORDER BY and LIMIT clauses of q, then is a unique
+// column keeping the order stable across pages
+func (q ListQuery) orderBy(then string) (string, []any) {
+	dir := "ASC"
+	if q.Desc {
+		dir = "DESC"
+	}
+	clause := " ORDER BY "
+	for _, column := range strings.Split(q.Sort, ",") {
+		clause += strings.TrimSpace(column) + " " + dir + ", "
+	}
+	clause += then + " " + dir
+	if q.Limit <= 0 {
+		if q.Offset == 0 {
+			return clause, nil
+		}
+		return clause + " LIMIT -1 OFFSET ?", []any{q.Offset}
+	}
+	return clause + " LIMIT ? OFFSET ?", []any{q.Limit, q.Offset}
+}
+
+// likePattern matches s anywhere in a LIKE ... ESCAPE '\' clause
+func likePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
+
+// setTotalCount reports the number of items matching the filters, for
+// paging through the list
+func setTotalCount(c *gin.Context, total int) {
+	c.Header("X-Total-Count", strconv.Itoa(total))
+}
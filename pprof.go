@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PprofConfig exposes the Go profiler (CPU, heap, goroutines, mutexes...),
+// to profile handleDNS under load with go tool pprof
+type PprofConfig struct {
+	// Enabled serves /debug/pprof/ on the web port to the admin account,
+	// with a session or an API token (sqlite mode)
+	Enabled bool `yaml:"enabled" json:"enabled,omitempty"`
+	// Address starts a separate listener without authentication, meant for
+	// the loopback (127.0.0.1:6060)
+	Address string `yaml:"address" json:"address,omitempty"`
+}
+
+var pprofCfg PprofConfig
+
+// pprofMux routes the profiler pages, the way net/http/pprof registers them
+// on the default mux
+func pprofMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// registerPprofRoutes serves the profiler on the web port to the admin,
+// when enabled: the command line and the CPU profiles and traces are not
+// for every API token
+func registerPprofRoutes(router *gin.Engine) {
+	if !pprofCfg.Enabled {
+		return
+	}
+	mux := pprofMux()
+	debug := router.Group("/debug/pprof")
+	debug.Use(APIAuthMiddleware(), RequireAdminMiddleware())
+	debug.Any("/*path", gin.WrapH(mux))
+	slog.Info("Profiler enabled", "path", "/debug/pprof/")
+}
+
+// startPprofServer serves the profiler on its own address, when set
+func startPprofServer() *http.Server {
+	if pprofCfg.Address == "" {
+		return nil
+	}
+	if !loopbackAddress(pprofCfg.Address) {
+		slog.Warn("profiler listening beyond the loopback without authentication", "address", pprofCfg.Address)
+	}
+	server := &http.Server{
+		Addr:              pprofCfg.Address,
+		Handler:           pprofMux(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		slog.Info("Starting profiler", "addr", server.Addr)
+		if err := serveWeb(server, false); err != nil && err != http.ErrServerClosed {
+			slog.Error("failed to start profiler", "error", err)
+		}
+	}()
+	return server
+}
+
+// loopbackAddress reports whether addr only listens on the loopback
+func loopbackAddress(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return host == "localhost" || (ip != nil && ip.IsLoopback())
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Answer sets are compiled when a snapshot is published, so the DNS handler
+// answers the usual queries without filtering or copying records: the
+// slices are shared by every query and clipped, so appending to them (the
+// signatures of a DNSSEC answer) copies instead of writing over the next
+// query's answer.
+
+// compileAnswers fills the answer sets of every node: the records of each
+// type, with the CNAME of the name added to the A answers like handleDNS
+// always did
+func (z *ZoneData) compileAnswers() {
+	var walk func(n *zoneNode)
+	walk = func(n *zoneNode) {
+		n.answers = nil
+		if len(n.rrs) > 0 {
+			n.answers = make(map[uint16][]dns.RR)
+			for _, rr := range n.rrs {
+				rrtype := rr.Header().Rrtype
+				n.answers[rrtype] = append(n.answers[rrtype], rr)
+				if rrtype == dns.TypeCNAME {
+					n.answers[dns.TypeA] = append(n.answers[dns.TypeA], rr)
+				}
+			}
+			for rrtype, rrs := range n.answers {
+				n.answers[rrtype] = slices.Clip(rrs)
+			}
+		}
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	walk(&z.root)
+}
+
+// Answers returns the records answering qtype at the name: the records of
+// the type, and the CNAME for A queries. The slice is shared, it must not
+// be modified.
+func (res LookupResult) Answers(qtype uint16) []dns.RR {
+	if res.answers != nil {
+		return res.answers[qtype]
+	}
+	// Snapshot not published through the store
+	var out []dns.RR
+	for _, rr := range res.Records {
+		if rrtype := rr.Header().Rrtype; rrtype == qtype || (qtype == dns.TypeA && rrtype == dns.TypeCNAME) {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+// nameLabels holds the lowercase labels of a name from the root down in a
+// fixed buffer, so walking the tree for a query does not allocate: the
+// children of a node are looked up with the label bytes directly. The
+// buffer holds the escaped labels of any valid name (255 bytes on the
+// wire, up to four characters per byte once escaped).
+type nameLabels struct {
+	buf   [1024]byte
+	start [128]uint16
+	end   [128]uint16
+	n     int
+}
+
+// split fills l with the labels of name. Plain ASCII names are split in
+// place; names with escapes or other bytes go through treeLabels. It
+// reports false, with no labels, when the labels of name do not fit: such
+// a name is longer than any name of the tree and must not be matched by
+// one of its ancestors.
+func (l *nameLabels) split(name string) bool {
+	l.n = 0
+	if l.splitASCII(name) {
+		return true
+	}
+	l.n = 0
+	pos := 0
+	for _, label := range treeLabels(name) {
+		if l.n == len(l.start) || pos+len(label) > len(l.buf) {
+			l.n = 0
+			return false
+		}
+		l.start[l.n] = uint16(pos)
+		pos += copy(l.buf[pos:], label)
+		l.end[l.n] = uint16(pos)
+		l.n++
+	}
+	return true
+}
+
+// splitASCII splits a name made of non-empty ASCII labels without
+// escapes, and reports false for any other name
+func (l *nameLabels) splitASCII(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) >= len(l.buf) {
+		return false
+	}
+	if name == "" {
+		return true
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 0x80 || c == '\\':
+			return false
+		case 'A' <= c && c <= 'Z':
+			c += 'a' - 'A'
+		}
+		l.buf[i] = c
+	}
+	// Labels from the right, the root side first
+	end := len(name)
+	for i := len(name) - 1; i >= -1; i-- {
+		if i >= 0 && name[i] != '.' {
+			continue
+		}
+		if i+1 == end || l.n == len(l.start) {
+			return false // empty label, or more than a name can hold
+		}
+		l.start[l.n], l.end[l.n] = uint16(i+1), uint16(end)
+		l.n++
+		end = i
+	}
+	return true
+}
+
+// label returns the i-th label from the root
+func (l *nameLabels) label(i int) []byte {
+	return l.buf[l.start[i]:l.end[i]]
+}
+
+// childLabel returns the child of n for a label, without allocating
+func (n *zoneNode) childLabel(label []byte) *zoneNode {
+	if n.children == nil {
+		return nil
+	}
+	return n.children[string(label)]
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// testZone returns a published snapshot of example.com with an apex A
+// record and a host
+func testZone(t testing.TB) *ZoneStore {
+	t.Helper()
+	z := NewZoneData()
+	z.AddZone("example.com.")
+	for _, s := range []string{
+		"example.com. 300 IN SOA ns.example.com. admin.example.com. 1 3600 600 86400 300",
+		"example.com. 300 IN NS ns.example.com.",
+		"example.com. 300 IN A 192.0.2.1",
+		"www.example.com. 300 IN A 192.0.2.2",
+	} {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		z.AddRR(rr)
+	}
+	store := NewZoneStore()
+	store.Replace(z)
+	return store
+}
+
+// quietLogs drops the query logs of handleDNS for the rest of the test
+func quietLogs(t testing.TB) {
+	saved := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { slog.SetDefault(saved) })
+}
+
+// testWriter records the response of handleDNS
+type testWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *testWriter) WriteMsg(m *dns.Msg) error { w.msg = m; return nil }
+func (w *testWriter) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5353}
+}
+func (w *testWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+}
+
+func TestResolveEscapedLongName(t *testing.T) {
+	zd := testZone(t).Load()
+	label := strings.Repeat(`\255`, 63)
+
+	// Two escaped labels of 63 bytes are a valid name below example.com,
+	// missing from the zone: it is not the apex
+	name := label + "." + label + ".example.com."
+	if _, ok := dns.IsDomainName(name); !ok {
+		t.Fatalf("%s is not a valid name", name)
+	}
+	res := zd.Resolve(name)
+	if res.Zone != "example.com." || res.Exists || len(res.Records) > 0 {
+		t.Errorf("Resolve(%s) = zone %q, exists %v, %d records, want a missing name of example.com.", name, res.Zone, res.Exists, len(res.Records))
+	}
+	if n := zd.find(name); n != nil {
+		t.Errorf("find(%s) found a node", name)
+	}
+
+	// Labels longer than any name do not fit: no node, never an ancestor
+	name = strings.Repeat(label+".", 5) + "example.com."
+	var labels nameLabels
+	if labels.split(name) {
+		t.Fatalf("split(%s) reported the labels fit", name)
+	}
+	if res := zd.Resolve(name); res.Zone != "" || res.Exists || len(res.Records) > 0 {
+		t.Errorf("Resolve(%s) = zone %q, exists %v, %d records, want no match", name, res.Zone, res.Exists, len(res.Records))
+	}
+	if n := zd.find(name); n != nil {
+		t.Errorf("find(%s) found a node", name)
+	}
+	if zone := zd.FindZone(name); zone != "" {
+		t.Errorf("FindZone(%s) = %q, want no zone", name, zone)
+	}
+}
+
+func TestHandleDNSEscapedLongName(t *testing.T) {
+	saved := zoneStore
+	zoneStore = testZone(t)
+	defer func() { zoneStore = saved }()
+	quietLogs(t)
+
+	label := strings.Repeat(`\255`, 63)
+	r := new(dns.Msg)
+	r.SetQuestion(label+"."+label+".example.com.", dns.TypeA)
+	w := &testWriter{}
+	handleDNS(w, r)
+	if w.msg == nil {
+		t.Fatal("no response")
+	}
+	if w.msg.Rcode != dns.RcodeNameError || len(w.msg.Answer) > 0 {
+		t.Errorf("got %s with %d answers, want NXDOMAIN", dns.RcodeToString[w.msg.Rcode], len(w.msg.Answer))
+	}
+}
+
+func BenchmarkResolve(b *testing.B) {
+	zd := testZone(b).Load()
+	b.ReportAllocs()
+	for b.Loop() {
+		res := zd.Resolve("www.example.com.")
+		if len(res.Answers(dns.TypeA)) != 1 {
+			b.Fatal("no answer")
+		}
+	}
+}
+
+func BenchmarkHandleDNS(b *testing.B) {
+	saved := zoneStore
+	zoneStore = testZone(b)
+	defer func() { zoneStore = saved }()
+	quietLogs(b)
+
+	r := new(dns.Msg)
+	r.SetQuestion("www.example.com.", dns.TypeA)
+	w := &testWriter{}
+	b.ReportAllocs()
+	for b.Loop() {
+		handleDNS(w, r)
+		if len(w.msg.Answer) != 1 {
+			b.Fatal("no answer")
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// signatureExpiryWarning is how long before the earliest RRSIG expires a
+// pre-signed zone is reported as needing a re-import
+const signatureExpiryWarning = 7 * 24 * time.Hour
+
+// isDNSSECType reports whether t is DNSSEC material kept as imported
+func isDNSSECType(t uint16) bool {
+	switch t {
+	case dns.TypeRRSIG, dns.TypeDNSKEY, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeNSEC3PARAM,
+		dns.TypeDS, dns.TypeCDS, dns.TypeCDNSKEY:
+		return true
+	}
+	return false
+}
+
+// rdataString returns the rdata of rr in presentation format
+func rdataString(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+// loadSignedRRs returns the imported DNSSEC material of a zone as RRs
+func loadSignedRRs(zoneID int64) []dns.RR {
+	records, err := database.ListSignedRecords(zoneID)
+	if err != nil {
+		slog.Error("failed to load signed records", "zone_id", zoneID, "error", err)
+		return nil
+	}
+	rrs := make([]dns.RR, 0, len(records))
+	for _, r := range records {
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", r.Name, r.TTL, r.Type, r.Value))
+		if err != nil {
+			slog.Warn("invalid signed record", "zone_id", zoneID, "name", r.Name, "type", r.Type, "error", err)
+			continue
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
+
+// hasOwnerType reports whether rrs holds a record of type t owned by name
+func hasOwnerType(rrs []dns.RR, name string, t uint16) bool {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == t && strings.EqualFold(rr.Header().Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// signaturesFor returns the RRSIGs in rrs covering the types present in answers
+func signaturesFor(rrs, answers []dns.RR) []dns.RR {
+	covered := make(map[uint16]bool)
+	for _, a := range answers {
+		covered[a.Header().Rrtype] = true
+	}
+	var sigs []dns.RR
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok && covered[sig.TypeCovered] {
+			sigs = append(sigs, rr)
+		}
+	}
+	return sigs
+}
+
+// serialNewer compares SOA serials with RFC 1982 arithmetic
+func serialNewer(next, current uint32) bool {
+	return int32(next-current) > 0
+}
+
+// signedSOA returns the imported SOA of a zone, or nil if it is not pre-signed
+func signedSOA(zoneName string, rrs []dns.RR) *dns.SOA {
+	for _, rr := range rrs {
+		if soa, ok := rr.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, zoneName) {
+			return soa
+		}
+	}
+	return nil
+}
+
+// signedZoneStatus summarizes the imported DNSSEC material of a zone
+func signedZoneStatus(zone *DBZone) gin.H {
+	zoneName := dns.Fqdn(zone.Name)
+	rrs := loadSignedRRs(zone.ID)
+	status := gin.H{"zone": zoneName, "signed": len(rrs) > 0}
+	if len(rrs) == 0 {
+		return status
+	}
+
+	counts := make(map[string]int)
+	var earliest time.Time
+	for _, rr := range rrs {
+		counts[dns.TypeToString[rr.Header().Rrtype]]++
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			exp := time.Unix(int64(sig.Expiration), 0)
+			if earliest.IsZero() || exp.Before(earliest) {
+				earliest = exp
+			}
+		}
+	}
+	status["records"] = counts
+
+	var warnings []string
+	if soa := signedSOA(zoneName, rrs); soa != nil {
+		status["serial"] = soa.Serial
+	}
+	if !earliest.IsZero() {
+		status["signature_expiration"] = earliest
+		if time.Until(earliest) <= 0 {
+			warnings = append(warnings, "signatures have expired, re-sign and re-import the zone")
+		} else if time.Until(earliest) < signatureExpiryWarning {
+			warnings = append(warnings, "signatures expire soon, re-sign and re-import the zone")
+		}
+	}
+	if len(warnings) > 0 {
+		status["warnings"] = warnings
+	}
+	return status
+}
+
+// Signed zone API handlers
+
+type SignedZoneImportRequest struct {
+	Zone           string `json:"zone" binding:"required"` // signed zone file, e.g. dnssec-signzone output
+	ReplaceRecords bool   `json:"replace_records"`         // also replace the zone's records with the signed data
+	Force          bool   `json:"force"`                   // accept a serial that is not newer
+}
+
+// handleAPIImportSignedZone imports an externally signed zone file. DNSSEC
+// records and the apex SOA/NS are stored as-is and served in place of the
+// synthesized ones; a re-import only replaces them if its SOA serial is newer.
+func handleAPIImportSignedZone(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone id"})
+		return
+	}
+
+	zone, err := database.GetZone(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+
+	var req SignedZoneImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	zoneName := dns.Fqdn(zone.Name)
+	var parsed []dns.RR
+	zp := dns.NewZoneParser(strings.NewReader(req.Zone), zoneName, "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		if !dns.IsSubDomain(zoneName, rr.Header().Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("record %s is outside zone %s", rr.Header().Name, zoneName)})
+			return
+		}
+		parsed = append(parsed, rr)
+	}
+	if err := zp.Err(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	soa := signedSOA(zoneName, parsed)
+	if soa == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "signed zone has no SOA record at the apex"})
+		return
+	}
+	if !hasOwnerType(parsed, zoneName, dns.TypeDNSKEY) || len(filterRRs(parsed, dns.TypeRRSIG)) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "zone is not signed (no DNSKEY or RRSIG records)"})
+		return
+	}
+	if current := signedSOA(zoneName, loadSignedRRs(id)); current != nil && !req.Force && !serialNewer(soa.Serial, current.Serial) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("serial %d is not newer than the imported serial %d", soa.Serial, current.Serial)})
+		return
+	}
+
+	var signed []DBSignedRecord
+	var records []DBRecord
+	if req.ReplaceRecords {
+		records = []DBRecord{}
+	}
+	for _, rr := range parsed {
+		h := rr.Header()
+		apex := strings.EqualFold(h.Name, zoneName)
+		if isDNSSECType(h.Rrtype) || (apex && (h.Rrtype == dns.TypeSOA || h.Rrtype == dns.TypeNS)) {
+			signed = append(signed, DBSignedRecord{
+				ZoneID: id, Name: strings.ToLower(h.Name), Type: dns.TypeToString[h.Rrtype], Value: rdataString(rr), TTL: int(h.Ttl),
+			})
+			continue
+		}
+		if req.ReplaceRecords {
+			record := rrToRecord(zoneName, rr)
+			record.ZoneID = id
+			records = append(records, record)
+		}
+	}
+
+	if err := database.ReplaceSignedRecords(id, signed, records); err != nil {
+		slog.Error("failed to import signed zone", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to import signed zone"})
+		return
+	}
+
+	// Reload zones into memory
+	if err := LoadZonesFromDB(); err != nil {
+		slog.Error("failed to reload zones", "error", err)
+	}
+
+	slog.Info("Signed zone imported", "name", zoneName, "serial", soa.Serial, "dnssec_records", len(signed), "replaced_records", req.ReplaceRecords)
+	c.JSON(http.StatusOK, signedZoneStatus(zone))
+}
+
+func handleAPISignedZoneStatus(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone id"})
+		return
+	}
+
+	zone, err := database.GetZone(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	c.JSON(http.StatusOK, signedZoneStatus(zone))
+}
+
+func handleAPIDeleteSignedZone(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone id"})
+		return
+	}
+
+	zone, err := database.GetZone(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+
+	if err := database.DeleteSignedRecords(id); err != nil {
+		slog.Error("failed to delete signed records", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete signed records"})
+		return
+	}
+
+	// Reload zones into memory
+	if err := LoadZonesFromDB(); err != nil {
+		slog.Error("failed to reload zones", "error", err)
+	}
+
+	slog.Info("Signed zone material removed", "name", zone.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "signed zone material removed"})
+}
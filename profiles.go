@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NetworkProfile describes how the server behaves on a given network
+// (e.g. "home": serve local zones and forward to the router, "work":
+// forward-only to the corporate resolvers).
+type NetworkProfile struct {
+	Name            string   `yaml:"name" json:"name"`
+	Forwarders      []string `yaml:"forwarders" json:"forwarders,omitempty"`
+	ServeLocalZones *bool    `yaml:"serve_local_zones" json:"serve_local_zones,omitempty"`
+	Match           struct {
+		GatewayMACs []string `yaml:"gateway_macs" json:"gateway_macs,omitempty"`
+		SSIDs       []string `yaml:"ssids" json:"ssids,omitempty"`
+	} `yaml:"match" json:"match"`
+}
+
+// servesLocalZones reports whether local zones are answered under this profile
+func (p *NetworkProfile) servesLocalZones() bool {
+	return p.ServeLocalZones == nil || *p.ServeLocalZones
+}
+
+// NetworkInfo is what was detected about the currently attached network
+type NetworkInfo struct {
+	GatewayIP  string `json:"gateway_ip,omitempty"`
+	GatewayMAC string `json:"gateway_mac,omitempty"`
+	SSID       string `json:"ssid,omitempty"`
+}
+
+const profileAuto = "auto"
+
+var (
+	profiles         []NetworkProfile
+	profileSelection = profileAuto // "auto" or a profile name
+	activeProfile    *NetworkProfile
+	detectedNetwork  NetworkInfo
+	profilesMu       sync.RWMutex
+
+	// ssidCommand is run to find the current Wi-Fi SSID (first line of stdout)
+	ssidCommand = "iwgetid -r"
+	// baseForwarders holds the forwarders from config/DB, used when the
+	// active profile does not define its own
+	baseForwarders []string
+	// activeForwarders is the forwarders list in use, read by the query
+	// path while the profile watcher switches it
+	activeForwarders atomic.Pointer[[]string]
+)
+
+// currentProfile returns the active network profile, or nil if none applies
+func currentProfile() *NetworkProfile {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	return activeProfile
+}
+
+// serveLocalZones reports whether local zones should be answered right now
+func serveLocalZones() bool {
+	if p := currentProfile(); p != nil {
+		return p.servesLocalZones()
+	}
+	return true
+}
+
+// setBaseForwarders records the configured forwarders and applies them unless
+// the active profile overrides them
+func setBaseForwarders(list []string) {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	baseForwarders = list
+	applyProfileForwarders()
+}
+
+// applyProfileForwarders publishes the forwarders list of the active
+// profile, falling back to the configured forwarders. profilesMu must be
+// held for writing, so the list published matches the profile state.
+func applyProfileForwarders() {
+	list := baseForwarders
+	if activeProfile != nil && len(activeProfile.Forwarders) > 0 {
+		list = activeProfile.Forwarders
+	}
+	activeForwarders.Store(&list)
+}
+
+// currentForwarders returns the forwarders list in use
+func currentForwarders() []string {
+	if list := activeForwarders.Load(); list != nil {
+		return *list
+	}
+	return nil
+}
+
+// initProfiles normalizes the configured profiles and selects the initial one
+func initProfiles(list []NetworkProfile, selection string) {
+	for i := range list {
+		list[i].Forwarders = parseForwarders(strings.Join(list[i].Forwarders, ","))
+		for j, mac := range list[i].Match.GatewayMACs {
+			list[i].Match.GatewayMACs[j] = strings.ToLower(mac)
+		}
+	}
+
+	profilesMu.Lock()
+	profiles = list
+	if selection != "" {
+		profileSelection = selection
+	}
+	profilesMu.Unlock()
+
+	refreshProfile()
+}
+
+// refreshProfile re-detects the network (in auto mode) and switches profile
+// if needed
+func refreshProfile() {
+	profilesMu.RLock()
+	selection := profileSelection
+	list := profiles
+	profilesMu.RUnlock()
+
+	if len(list) == 0 {
+		return
+	}
+
+	var next *NetworkProfile
+	info := detectNetwork()
+	if selection == profileAuto {
+		next = matchProfile(list, info)
+	} else {
+		for i := range list {
+			if list[i].Name == selection {
+				next = &list[i]
+				break
+			}
+		}
+	}
+
+	profilesMu.Lock()
+	detectedNetwork = info
+	changed := (activeProfile == nil) != (next == nil) || (next != nil && activeProfile.Name != next.Name)
+	activeProfile = next
+	if changed {
+		applyProfileForwarders()
+	}
+	profilesMu.Unlock()
+
+	if changed {
+		if next != nil {
+			slog.Info("Switched network profile", "profile", next.Name, "selection", selection, "gateway_mac", info.GatewayMAC, "ssid", info.SSID)
+		} else {
+			slog.Info("No network profile matched, using default configuration", "gateway_mac", info.GatewayMAC, "ssid", info.SSID)
+		}
+	}
+}
+
+// matchProfile returns the first profile whose match rules fit the network.
+// A profile without match rules is used as a fallback.
+func matchProfile(list []NetworkProfile, info NetworkInfo) *NetworkProfile {
+	var fallback *NetworkProfile
+	for i := range list {
+		p := &list[i]
+		if len(p.Match.GatewayMACs) == 0 && len(p.Match.SSIDs) == 0 {
+			if fallback == nil {
+				fallback = p
+			}
+			continue
+		}
+		for _, mac := range p.Match.GatewayMACs {
+			if info.GatewayMAC != "" && mac == info.GatewayMAC {
+				return p
+			}
+		}
+		for _, ssid := range p.Match.SSIDs {
+			if info.SSID != "" && ssid == info.SSID {
+				return p
+			}
+		}
+	}
+	return fallback
+}
+
+// detectNetwork gathers the default gateway and its MAC address (Linux
+// /proc) and the current SSID (via ssidCommand)
+func detectNetwork() NetworkInfo {
+	var info NetworkInfo
+	info.GatewayIP = defaultGatewayIP()
+	if info.GatewayIP != "" {
+		info.GatewayMAC = arpLookup(info.GatewayIP)
+	}
+	info.SSID = currentSSID()
+	return info
+}
+
+// defaultGatewayIP reads the IPv4 default route from /proc/net/route
+func defaultGatewayIP() string {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		var gw uint32
+		if _, err := fmt.Sscanf(fields[2], "%X", &gw); err != nil || gw == 0 {
+			continue
+		}
+		// /proc/net/route stores addresses in little-endian hex
+		return fmt.Sprintf("%d.%d.%d.%d", byte(gw), byte(gw>>8), byte(gw>>16), byte(gw>>24))
+	}
+	return ""
+}
+
+// arpLookup finds the MAC address for an IP in /proc/net/arp
+func arpLookup(ip string) string {
+	f, err := os.Open("/proc/net/arp")
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 4 && fields[0] == ip {
+			return strings.ToLower(fields[3])
+		}
+	}
+	return ""
+}
+
+// currentSSID runs ssidCommand and returns the first line of its output
+func currentSSID() string {
+	if ssidCommand == "" {
+		return ""
+	}
+	parts := strings.Fields(ssidCommand)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, parts[0], parts[1:]...).Output()
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(line)
+}
+
+// startProfileWatcher periodically re-detects the network in auto mode
+func startProfileWatcher(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			profilesMu.RLock()
+			auto := profileSelection == profileAuto && len(profiles) > 0
+			profilesMu.RUnlock()
+			if auto {
+				refreshProfile()
+			}
+		}
+	}()
+}
+
+// Profile API handlers
+
+type SelectProfileRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func handleAPIListProfiles(c *gin.Context) {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+
+	active := ""
+	if activeProfile != nil {
+		active = activeProfile.Name
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"profiles":  profiles,
+		"selection": profileSelection,
+		"active":    active,
+		"network":   detectedNetwork,
+	})
+}
+
+func handleAPISelectProfile(c *gin.Context) {
+	var req SelectProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profilesMu.Lock()
+	found := req.Name == profileAuto
+	for _, p := range profiles {
+		if p.Name == req.Name {
+			found = true
+			break
+		}
+	}
+	if found {
+		profileSelection = req.Name
+	}
+	profilesMu.Unlock()
+
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("profile '%s' not found", req.Name)})
+		return
+	}
+
+	refreshProfile()
+	slog.Info("Network profile selected", "selection", req.Name)
+	handleAPIListProfiles(c)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReadinessConfig tunes the checks of /readyz
+type ReadinessConfig struct {
+	// MaxSyncLagSec is how long the zone source (git, kv) may fail to be
+	// read before the server is not ready, default 300
+	MaxSyncLagSec int `yaml:"max_sync_lag_seconds" json:"max_sync_lag_seconds,omitempty"`
+}
+
+var (
+	maxSyncLag = 5 * time.Minute
+
+	// dnsListeners counts the DNS listeners bound (UDP, TCP)
+	dnsListeners atomic.Int32
+	// shuttingDown is set on SIGTERM, so the load balancers stop sending
+	// queries while the ones in flight are answered
+	shuttingDown atomic.Bool
+)
+
+// ReadinessCheck is the result of one check of /readyz
+type ReadinessCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// initReadiness applies the readiness settings
+func initReadiness(cfg ReadinessConfig) {
+	if cfg.MaxSyncLagSec > 0 {
+		maxSyncLag = time.Duration(cfg.MaxSyncLagSec) * time.Second
+	}
+}
+
+// syncLagCheck reports whether the zone source has been read recently, for
+// the sources pulled from elsewhere
+func syncLagCheck(now time.Time) (ReadinessCheck, bool) {
+	switch dbMode {
+	case "git":
+		status := gitHealth()
+		if status == nil {
+			return ReadinessCheck{Detail: "git sync not started"}, true
+		}
+		last := status.SyncedAt
+		if status.FetchedAt != nil {
+			last = status.FetchedAt
+		}
+		if last == nil {
+			return ReadinessCheck{Detail: "git repository never synced: " + status.Error}, true
+		}
+		if lag := now.Sub(*last); lag > maxSyncLag {
+			return ReadinessCheck{Detail: fmt.Sprintf("git repository not fetched for %s: %s", lag.Round(time.Second), status.Error)}, true
+		}
+		return ReadinessCheck{OK: true, Detail: "commit " + status.Commit}, true
+	case "kv":
+		kvSource.Lock()
+		failingSince := kvSource.failingSince
+		kvSource.Unlock()
+		if !failingSince.IsZero() && now.Sub(failingSince) > maxSyncLag {
+			return ReadinessCheck{Detail: fmt.Sprintf("kv backend unreachable for %s", now.Sub(failingSince).Round(time.Second))}, true
+		}
+		return ReadinessCheck{OK: true}, true
+	}
+	return ReadinessCheck{}, false
+}
+
+// readinessChecks runs the checks of /readyz
+func readinessChecks(ctx context.Context) map[string]ReadinessCheck {
+	checks := make(map[string]ReadinessCheck)
+	if shuttingDown.Load() {
+		checks["shutdown"] = ReadinessCheck{Detail: "shutting down"}
+	}
+
+	if zoneStore.Loaded() {
+		checks["zones"] = ReadinessCheck{OK: true, Detail: fmt.Sprintf("%d zones", len(zoneStore.Load().ZoneNames()))}
+	} else {
+		checks["zones"] = ReadinessCheck{Detail: "zones not loaded"}
+	}
+
+	if n := dnsListeners.Load(); n > 0 {
+		checks["listeners"] = ReadinessCheck{OK: true, Detail: fmt.Sprintf("%d DNS listeners", n)}
+	} else {
+		checks["listeners"] = ReadinessCheck{Detail: "no DNS listener bound"}
+	}
+
+	if dbMode == "sqlite" {
+		if database == nil {
+			checks["database"] = ReadinessCheck{Detail: "database not open"}
+		} else if err := database.Ping(ctx); err != nil {
+			checks["database"] = ReadinessCheck{Detail: err.Error()}
+		} else {
+			checks["database"] = ReadinessCheck{OK: true}
+		}
+	}
+
+	if check, ok := syncLagCheck(time.Now()); ok {
+		checks["sync"] = check
+	}
+	return checks
+}
+
+// handleHealthz handles GET /healthz, the liveness probe: the process
+// answers
+func handleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// handleReadyz handles GET /readyz, the readiness probe: 503 until the zones
+// are loaded and a DNS listener is bound, when the database or the zone
+// source fails, and while shutting down
+func handleReadyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+	checks := readinessChecks(ctx)
+	status, code := "ready", http.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			status, code = "not ready", http.StatusServiceUnavailable
+			break
+		}
+	}
+	c.JSON(code, gin.H{"status": status, "checks": checks})
+}
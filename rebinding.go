@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+// DNS rebinding protection: a page of a malicious site can reach the
+// devices of the LAN through the browser when its name resolves to a
+// private address. The private addresses answered by the forwarders and
+// the recursive resolver are dropped, except for the names of the local
+// and forward zones and the allowed domains (split DNS services such as
+// plex.direct).
+
+// RebindingConfig configures the DNS rebinding protection
+type RebindingConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled,omitempty"`
+	// AllowedDomains may resolve to private addresses, with their
+	// subdomains
+	AllowedDomains []string `yaml:"allowed_domains" json:"allowed_domains,omitempty"`
+}
+
+// rebindingNetworks are the ranges not answered from upstream, on top of
+// the private, loopback, link-local and unspecified addresses
+var rebindingNetworks = []*net.IPNet{
+	{IP: net.IPv4(0, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)},     // this network
+	{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}, // carrier-grade NAT
+}
+
+var (
+	rebindingEnabled bool
+	// rebindingAllowed are the allowed domains as lowercased FQDNs
+	rebindingAllowed  []string
+	rebindingStripped atomic.Uint64
+)
+
+// validRebinding checks the rebinding_protection settings
+func validRebinding(cfg RebindingConfig) error {
+	for _, d := range cfg.AllowedDomains {
+		if _, ok := dns.IsDomainName(d); !ok || strings.TrimSpace(d) == "" {
+			return fmt.Errorf("invalid allowed domain %q", d)
+		}
+	}
+	return nil
+}
+
+func initRebinding(cfg RebindingConfig) {
+	if err := validRebinding(cfg); err != nil {
+		slog.Error("invalid rebinding_protection, allowed domains ignored", "error", err)
+		cfg.AllowedDomains = nil
+	}
+	rebindingEnabled = cfg.Enabled
+	rebindingAllowed = nil
+	for _, d := range cfg.AllowedDomains {
+		rebindingAllowed = append(rebindingAllowed, strings.ToLower(dns.Fqdn(strings.TrimSpace(d))))
+	}
+	if cfg.Enabled {
+		slog.Info("DNS rebinding protection enabled", "allowed_domains", cfg.AllowedDomains)
+	}
+}
+
+// rebindingAddress reports whether ip must not be answered from upstream
+func rebindingAddress(ip net.IP) bool {
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, n := range rebindingNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// rebindingAllowedName reports whether name may resolve to private
+// addresses: an allowed domain or a name of the local and forward zones
+func rebindingAllowedName(name string) bool {
+	name = strings.ToLower(name)
+	for _, d := range rebindingAllowed {
+		if dns.IsSubDomain(d, name) {
+			return true
+		}
+	}
+	res := zoneStore.Load().Resolve(name)
+	return res.Zone != "" || len(res.Forward) > 0
+}
+
+// stripRebinding drops the private addresses of an upstream response to
+// the query of name
+func stripRebinding(name string, msg *dns.Msg) {
+	if !rebindingEnabled || rebindingAllowedName(name) {
+		return
+	}
+	stripped := 0
+	keep := func(rrs []dns.RR) []dns.RR {
+		out := make([]dns.RR, 0, len(rrs))
+		for _, rr := range rrs {
+			var ip net.IP
+			switch v := rr.(type) {
+			case *dns.A:
+				ip = v.A
+			case *dns.AAAA:
+				ip = v.AAAA
+			}
+			if ip != nil && rebindingAddress(ip) {
+				stripped++
+				continue
+			}
+			out = append(out, rr)
+		}
+		return out
+	}
+	msg.Answer = keep(msg.Answer)
+	msg.Extra = keep(msg.Extra)
+	if stripped > 0 {
+		rebindingStripped.Add(uint64(stripped))
+		slog.Warn("possible DNS rebinding, private addresses dropped from upstream answer", "name", name, "addresses", stripped)
+	}
+}
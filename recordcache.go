@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// RecordCaching is the cache control of a record
+type RecordCaching struct {
+	// NoCache serves the records of the name with a TTL of 0, so clients
+	// and downstream resolvers ask again every time, and keeps the
+	// answers forwarded upstream for the name out of the cache
+	NoCache bool `json:"no_cache,omitempty"`
+}
+
+// cacheable reports whether the forwarded answers for name may be cached
+func cacheable(name string) bool {
+	return !zoneStore.Load().NoCache(name)
+}
+
+// RecordRefreshResult is the outcome of a forced refresh of a record
+type RecordRefreshResult struct {
+	Name   string `json:"name"`
+	Purged int    `json:"purged"` // cache entries dropped
+}
+
+// handleAPIRefreshRecord handles POST /api/zones/:id/records/:record_id/refresh:
+// the zones are served again from the database and the cached answers for
+// the name of the record are dropped, so the next query gets the record as
+// stored
+func handleAPIRefreshRecord(c *gin.Context) {
+	zoneID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone id"})
+		return
+	}
+	recordID, err := strconv.ParseInt(c.Param("record_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record id"})
+		return
+	}
+	zone, err := database.GetZone(zoneID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	record, err := database.GetRecord(recordID)
+	if err != nil || record.ZoneID != zoneID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "record not found in this zone"})
+		return
+	}
+
+	if err := LoadZonesFromDB(); err != nil {
+		slog.Error("failed to reload zones", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reload zones"})
+		return
+	}
+	name := recordOwner(record.Name, dns.Fqdn(zone.Name))
+	result := RecordRefreshResult{Name: name, Purged: forwardCache.Purge(name)}
+
+	slog.Info("Record refreshed", "name", name, "type", record.Type, "purged", result.Purged, "user", c.GetString("username"))
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// maxBulkRecords is the number of records one bulk import may create
+const maxBulkRecords = 10000
+
+// bulkCSVColumns are the columns a CSV import may have; the first line
+// names the columns used, in any order
+var bulkCSVColumns = []string{"name", "type", "value", "ttl", "priority", "comment", "tags", "activate_at", "expire_at"}
+
+// BulkRecordsRequest creates many records of a zone at once, given as
+// records or as CSV or JSON text in data
+type BulkRecordsRequest struct {
+	Records []CreateRecordRequest `json:"records"`
+	Format  string                `json:"format"` // csv or json, for data
+	Data    string                `json:"data"`
+	DryRun  bool                  `json:"dry_run"`
+}
+
+// BulkRecordError is a record of a bulk import that cannot be created. Row
+// is the line of a CSV file, or the position of the record from 1.
+type BulkRecordError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// bulkRow is a record of a bulk import with its position
+type bulkRow struct {
+	CreateRecordRequest
+	row int
+}
+
+// parseBulkCSV reads records from CSV text whose first line names the
+// columns, e.g. "name,type,value,ttl"
+func parseBulkCSV(data string) ([]bulkRow, []BulkRecordError) {
+	r := csv.NewReader(strings.NewReader(data))
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+	r.FieldsPerRecord = -1 // trailing empty columns may be left out
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, []BulkRecordError{csvError(err)}
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		known := false
+		for _, c := range bulkCSVColumns {
+			known = known || c == name
+		}
+		if !known {
+			return nil, []BulkRecordError{{Row: 1, Error: fmt.Sprintf("unknown column %q, the first line must name the columns among %s", name, strings.Join(bulkCSVColumns, ", "))}}
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"name", "type", "value"} {
+		if _, ok := columns[name]; !ok {
+			return nil, []BulkRecordError{{Row: 1, Error: fmt.Sprintf("missing column %q", name)}}
+		}
+	}
+
+	var rows []bulkRow
+	var errs []BulkRecordError
+	for {
+		fields, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, csvError(err))
+			break
+		}
+		line, _ := r.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(fields) {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+		row := bulkRow{row: line}
+		row.Name, row.Type, row.Value = field("name"), field("type"), field("value")
+		row.Comment = field("comment")
+		if tags := field("tags"); tags != "" {
+			row.Tags = strings.Split(tags, ",")
+		}
+		if err := parseBulkFields(&row, field); err != nil {
+			errs = append(errs, BulkRecordError{Row: line, Error: err.Error()})
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, errs
+}
+
+// parseBulkFields sets the numbers and times of a CSV row
+func parseBulkFields(row *bulkRow, field func(string) string) error {
+	var err error
+	if v := field("ttl"); v != "" {
+		if row.TTL, err = strconv.Atoi(v); err != nil || row.TTL < 0 {
+			return fmt.Errorf("invalid ttl %q", v)
+		}
+	}
+	if v := field("priority"); v != "" {
+		if row.Priority, err = strconv.Atoi(v); err != nil || row.Priority < 0 || row.Priority > 65535 {
+			return fmt.Errorf("invalid priority %q", v)
+		}
+	}
+	for _, t := range []struct {
+		name string
+		dst  **time.Time
+	}{{"activate_at", &row.ActivateAt}, {"expire_at", &row.ExpireAt}} {
+		v := field(t.name)
+		if v == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q, use RFC 3339", t.name, v)
+		}
+		*t.dst = &at
+	}
+	return nil
+}
+
+func csvError(err error) BulkRecordError {
+	var pe *csv.ParseError
+	if errors.As(err, &pe) {
+		return BulkRecordError{Row: pe.Line, Error: pe.Err.Error()}
+	}
+	return BulkRecordError{Error: err.Error()}
+}
+
+// parseBulkJSON reads records from a JSON array, such as the output of
+// GET /api/zones/:id/records; fields other than those of a record are
+// ignored
+func parseBulkJSON(data string) ([]bulkRow, []BulkRecordError) {
+	var records []CreateRecordRequest
+	if err := json.Unmarshal([]byte(data), &records); err != nil {
+		return nil, []BulkRecordError{{Error: "invalid JSON, expected an array of records"}}
+	}
+	return bulkRows(records), nil
+}
+
+func bulkRows(records []CreateRecordRequest) []bulkRow {
+	rows := make([]bulkRow, len(records))
+	for i, r := range records {
+		rows[i] = bulkRow{CreateRecordRequest: r, row: i + 1}
+	}
+	return rows
+}
+
+// checkBulkRow returns the record a row creates in zone
+func checkBulkRow(zone *DBZone, row bulkRow) (DBRecord, error) {
+	if err := row.toASCII(); err != nil {
+		return DBRecord{}, err
+	}
+	record := DBRecord{
+		ZoneID:         zone.ID,
+		Name:           strings.TrimSpace(row.Name),
+		Type:           strings.ToUpper(strings.TrimSpace(row.Type)),
+		Value:          strings.TrimSpace(row.Value),
+		TTL:            row.TTL,
+		Priority:       row.Priority,
+		RecordSchedule: row.RecordSchedule,
+	}
+	if record.Name == "" || record.Type == "" || record.Value == "" {
+		return record, fmt.Errorf("name, type and value are required")
+	}
+	if msg := systemRecordError(zone.Name, record.Name, record.Type); msg != "" {
+		return record, errors.New(msg)
+	}
+	if record.TTL == 0 {
+		record.TTL = zone.TTL
+	}
+	if record.TTL <= 0 {
+		record.TTL = 3600
+	}
+	if err := validRecordSchedule(record.RecordSchedule); err != nil {
+		return record, err
+	}
+	notes, err := normalizeRecordNotes(row.RecordNotes)
+	if err != nil {
+		return record, err
+	}
+	record.RecordNotes = notes
+	if err := normalizeSVCBRecord(zone.Name, &record); err != nil {
+		return record, err
+	}
+	if _, err := recordToRR(dns.Fqdn(zone.Name), record); err != nil {
+		return record, fmt.Errorf("invalid %s record %q: %v", record.Type, record.Value, err)
+	}
+	return record, nil
+}
+
+// handleAPIBulkCreateRecords handles POST /api/zones/:id/records/bulk. All
+// the records are created, or none: any invalid row, or an error the zone
+// would have once they are added, refuses the import. With dry_run the
+// records are only checked.
+func handleAPIBulkCreateRecords(c *gin.Context) {
+	zone, existing, ok := loadPrimaryZone(c)
+	if !ok {
+		return
+	}
+	var req BulkRecordsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rows []bulkRow
+	var rowErrors []BulkRecordError
+	switch {
+	case req.Data == "":
+		rows = bulkRows(req.Records)
+	case req.Format == "csv":
+		rows, rowErrors = parseBulkCSV(req.Data)
+	case req.Format == "json":
+		rows, rowErrors = parseBulkJSON(req.Data)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+	if len(rows) == 0 && len(rowErrors) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no records to import"})
+		return
+	}
+	if len(rows) > maxBulkRecords {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("at most %d records can be imported at once", maxBulkRecords)})
+		return
+	}
+
+	records := make([]DBRecord, 0, len(rows))
+	changes := make([]DBChange, 0, len(rows))
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		record, err := checkBulkRow(zone, row)
+		if err != nil {
+			rowErrors = append(rowErrors, BulkRecordError{Row: row.row, Error: err.Error()})
+			continue
+		}
+		records = append(records, record)
+		lines = append(lines, recordLine(zone.Name, record))
+		changes = append(changes, DBChange{Action: "create", Name: record.Name, Type: record.Type, Value: record.Value, TTL: record.TTL, Priority: record.Priority, RecordSchedule: record.RecordSchedule, RecordNotes: record.RecordNotes, RecordCaching: record.RecordCaching})
+	}
+	if rowErrors == nil {
+		rowErrors = []BulkRecordError{}
+	}
+	sort.SliceStable(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+
+	problems := checkZoneRecords(zone, append(existing, records...))
+	valid := len(rowErrors) == 0 && !hasErrors(problems)
+	result := gin.H{"records": lines, "errors": rowErrors, "problems": problems, "valid": valid}
+	switch {
+	case len(rowErrors) > 0:
+		result["error"] = "some records are invalid"
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	case !valid:
+		result["error"] = "the zone would have errors"
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	case req.DryRun:
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	serial, err := database.ApplyZoneChanges(zone.ID, 0, changes)
+	if err != nil {
+		slog.Error("failed to import records", "zone", zone.Name, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to import records"})
+		return
+	}
+
+	// Reload zones into memory
+	if err := LoadZonesFromDB(); err != nil {
+		slog.Error("failed to reload zones", "error", err)
+	}
+
+	slog.Info("Records imported", "zone", zone.Name, "records", len(changes), "serial", serial)
+	result["serial"] = serial
+	c.JSON(http.StatusCreated, result)
+}
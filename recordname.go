@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxTXTString is the longest character-string of a TXT record
+const maxTXTString = 255
+
+// recordOwner returns the absolute owner name of a record of zoneName.
+// "@" or "" is the apex and a name ending with a dot is absolute. Other
+// names are relative to the zone, unless they already end with the zone
+// name (_ldap._tcp.example.com in example.com). Labels keep their case
+// (_Acme-Challenge) since names are compared ignoring it.
+func recordOwner(name, zoneName string) string {
+	name = strings.TrimSpace(name)
+	zoneName = dns.Fqdn(zoneName)
+	switch {
+	case name == "" || name == "@":
+		return zoneName
+	case strings.HasSuffix(name, "."):
+		return name
+	case strings.EqualFold(name+".", zoneName),
+		strings.HasSuffix(strings.ToLower(name+"."), "."+strings.ToLower(zoneName)):
+		return name + "."
+	}
+	return name + "." + zoneName
+}
+
+// rdataText returns the value of a record as zone file rdata. A TXT or SPF
+// value that is not already quoted becomes one string, split every 255
+// bytes, so that its spaces and semicolons (v=DMARC1; p=none) are kept
+// instead of starting new strings or a comment.
+func rdataText(rrType, value string) string {
+	value = strings.TrimSpace(value)
+	switch strings.ToUpper(rrType) {
+	case "TXT", "SPF":
+	default:
+		return value
+	}
+	if value == "" || strings.HasPrefix(value, `"`) {
+		return value
+	}
+	var parts []string
+	for len(value) > 0 {
+		n := min(len(value), maxTXTString)
+		parts = append(parts, `"`+escapeTXT(value[:n])+`"`)
+		value = value[n:]
+	}
+	return strings.Join(parts, " ")
+}
+
+// escapeTXT escapes the quotes and backslashes of a TXT string
+func escapeTXT(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxRecordComment is the length limit of a record comment, in characters
+const maxRecordComment = 500
+
+// maxRecordSearchResults caps the records returned by a search
+const maxRecordSearchResults = 500
+
+// RecordNotes annotates a record for the operators; it is never served
+type RecordNotes struct {
+	Comment string   `json:"comment,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// tagsColumn returns the tags as stored in the database, comma separated
+func (n RecordNotes) tagsColumn() string {
+	return strings.Join(n.Tags, ",")
+}
+
+func parseRecordTags(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// normalizeRecordNotes trims the comment and lowercases and deduplicates
+// the tags, which are made of letters, digits, '-', '_', '.', ':' and '/'
+func normalizeRecordNotes(n RecordNotes) (RecordNotes, error) {
+	out := RecordNotes{Comment: strings.TrimSpace(n.Comment)}
+	if utf8.RuneCountInString(out.Comment) > maxRecordComment {
+		return out, fmt.Errorf("comment is longer than %d characters", maxRecordComment)
+	}
+	if strings.ContainsAny(out.Comment, "\r\n") {
+		return out, fmt.Errorf("comment must fit on one line")
+	}
+	seen := make(map[string]bool)
+	for _, tag := range n.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if !validRecordTag(tag) {
+			return out, fmt.Errorf("invalid tag %q", tag)
+		}
+		seen[tag] = true
+		out.Tags = append(out.Tags, tag)
+	}
+	return out, nil
+}
+
+func validRecordTag(tag string) bool {
+	if len(tag) > 64 {
+		return false
+	}
+	for _, r := range tag {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':', r == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RecordSearchResult is a record matched by a search, with its zone
+type RecordSearchResult struct {
+	DBRecord
+	Zone string `json:"zone"`
+}
+
+// parseRecordSearch splits a search into its words and the tags given as
+// tag:name; every word and tag must match
+func parseRecordSearch(q string) (words, tags []string) {
+	for _, field := range strings.Fields(strings.ToLower(q)) {
+		if tag, ok := strings.CutPrefix(field, "tag:"); ok {
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+			continue
+		}
+		words = append(words, field)
+	}
+	return words, tags
+}
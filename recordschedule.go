@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// recordScheduleInterval is how often scheduled records are activated and
+// expired ones pruned
+const recordScheduleInterval = 30 * time.Second
+
+// RecordSchedule is the optional window in which a record is served. A
+// record is served from ActivateAt and deleted once ExpireAt is reached;
+// nil means no bound.
+type RecordSchedule struct {
+	ActivateAt *time.Time `json:"activate_at,omitempty"`
+	ExpireAt   *time.Time `json:"expire_at,omitempty"`
+}
+
+// activeAt reports whether the record is served at t
+func (s RecordSchedule) activeAt(t time.Time) bool {
+	if s.ActivateAt != nil && t.Before(*s.ActivateAt) {
+		return false
+	}
+	return s.ExpireAt == nil || t.Before(*s.ExpireAt)
+}
+
+// columns returns the schedule as stored in the database
+func (s RecordSchedule) columns() (string, string) {
+	return formatRecordTime(s.ActivateAt), formatRecordTime(s.ExpireAt)
+}
+
+// formatRecordTime stores t as UTC RFC 3339 with a second precision, so
+// the columns compare as strings; nil is stored as ""
+func formatRecordTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Truncate(time.Second).Format(time.RFC3339)
+}
+
+// parseRecordTime reads a time stored by formatRecordTime, nil for ""
+func parseRecordTime(v string) *time.Time {
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func parseRecordSchedule(activateAt, expireAt string) RecordSchedule {
+	return RecordSchedule{ActivateAt: parseRecordTime(activateAt), ExpireAt: parseRecordTime(expireAt)}
+}
+
+// validRecordSchedule checks the window of a new or updated record
+func validRecordSchedule(s RecordSchedule) error {
+	if s.ExpireAt == nil {
+		return nil
+	}
+	if !s.ExpireAt.After(time.Now()) {
+		return fmt.Errorf("expire_at is in the past")
+	}
+	if s.ActivateAt != nil && !s.ExpireAt.After(*s.ActivateAt) {
+		return fmt.Errorf("expire_at must be after activate_at")
+	}
+	return nil
+}
+
+// startRecordScheduler serves records when they activate and deletes the
+// expired ones, bumping the serial of their zones so secondaries follow.
+// On a slave nothing is written to the database: the zones whose records
+// activate or expire are only reloaded, so the records are served or
+// dropped on time, and the expired ones are deleted on the master.
+func startRecordScheduler() {
+	go func() {
+		since := time.Now()
+		ticker := time.NewTicker(recordScheduleInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			changed, err := scheduleRecords(since, now)
+			since = now
+			if err != nil {
+				slog.Error("failed to update scheduled records", "error", err)
+			}
+			if len(changed) == 0 {
+				continue
+			}
+			slog.Info("Scheduled records changed", "zones", len(changed))
+			if err := LoadZonesFromDB(); err != nil {
+				slog.Error("failed to reload zones", "error", err)
+			}
+		}
+	}()
+}
+
+// scheduleRecords returns the zones whose records changed between since
+// and now, activating and pruning them on a master
+func scheduleRecords(since, now time.Time) ([]int64, error) {
+	if currentServerRole() == roleSlave {
+		return database.ScheduledRecordZones(since, now)
+	}
+	activated, err := database.ActivateScheduledRecords(since, now)
+	if err != nil {
+		return nil, err
+	}
+	pruned, err := database.PruneExpiredRecords(now)
+	return append(activated, pruned...), err
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// RecursionConfig configures the built-in recursive resolver, which
+// resolves the names not served locally by walking down from the root
+// servers instead of asking forwarders
+type RecursionConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled,omitempty"`
+	// QnameMinimization sends each server only the labels it needs to
+	// refer to the next one (RFC 9156), true when unset
+	QnameMinimization *bool `yaml:"qname_minimization" json:"qname_minimization,omitempty"`
+	TimeoutMS         int   `yaml:"timeout_ms" json:"timeout_ms,omitempty"` // per server, default 1500
+	// RootHints is a root hints file (named.root) replacing the built-in
+	// addresses of the root servers
+	RootHints string `yaml:"root_hints" json:"root_hints,omitempty"`
+	// LocalRoot keeps a copy of the root zone, transferred from
+	// LocalRootSources, and answers the queries to the root servers from
+	// it (RFC 8806)
+	LocalRoot        bool     `yaml:"local_root" json:"local_root,omitempty"`
+	LocalRootSources []string `yaml:"local_root_sources" json:"local_root_sources,omitempty"`
+}
+
+// Limits of one recursive resolution
+const (
+	maxRecursionQueries = 64 // queries sent to servers
+	maxCNAMEChain       = 8
+	maxGluelessDepth    = 4 // nested lookups of name server addresses
+	recursionBudget     = 10 * time.Second
+	maxDelegationTTL    = 24 * time.Hour
+	maxCachedCuts       = 10000
+)
+
+// rootHints are the built-in addresses of the root servers (named.root)
+var rootHints = []string{
+	"198.41.0.4", "170.247.170.2", "192.33.4.12", "199.7.91.13", "192.203.230.10", "192.5.5.241", "192.112.36.4",
+	"198.97.190.53", "192.36.148.17", "192.58.128.30", "193.0.14.129", "199.7.83.42", "202.12.27.33",
+}
+
+// recursor is nil when recursion is disabled
+var recursor *iterativeResolver
+
+// iterativeResolver resolves names from the root down, caching the zone
+// cuts it learns so later queries start from the closest one
+type iterativeResolver struct {
+	qnameMin bool
+	timeout  time.Duration
+	hints    []string
+	// localRoot is the copy of the root zone, nil without local_root or
+	// while it is not transferred
+	localRoot atomic.Pointer[ZoneData]
+
+	mu   sync.Mutex
+	cuts map[string]delegation
+}
+
+// delegation is the servers of a zone cut
+type delegation struct {
+	servers []string // host:port
+	expires time.Time
+}
+
+func initRecursion(cfg RecursionConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	r := &iterativeResolver{
+		qnameMin: cfg.QnameMinimization == nil || *cfg.QnameMinimization,
+		timeout:  1500 * time.Millisecond,
+		hints:    rootHints,
+		cuts:     make(map[string]delegation),
+	}
+	if cfg.TimeoutMS > 0 {
+		r.timeout = time.Duration(cfg.TimeoutMS) * time.Millisecond
+	}
+	if cfg.RootHints != "" {
+		hints, err := loadRootHints(cfg.RootHints)
+		if err != nil {
+			return err
+		}
+		r.hints = hints
+	}
+	var sources []string
+	if cfg.LocalRoot {
+		var err error
+		if sources, err = parseRootSources(cfg.LocalRootSources); err != nil {
+			return err
+		}
+	}
+	recursor = r
+	slog.Info("Recursive resolver enabled", "qname_minimization", r.qnameMin, "root_hints", len(r.hints), "local_root", cfg.LocalRoot)
+	go r.prime()
+	if cfg.LocalRoot {
+		go r.keepLocalRoot(sources)
+	}
+	return nil
+}
+
+// prime asks the root hints for the current root servers (RFC 8109)
+func (r *iterativeResolver) prime() {
+	ctx, cancel := context.WithTimeout(context.Background(), recursionBudget)
+	defer cancel()
+	st := &resolution{r: r}
+	resp, err := st.exchange(ctx, r.hintServers(), ".", dns.TypeNS, func(m *dns.Msg) bool {
+		return len(filterRRs(m.Answer, dns.TypeNS)) > 0
+	})
+	if err != nil {
+		slog.Warn("failed to prime the root servers, using the root hints", "error", err)
+		return
+	}
+	if servers, ttl := glueServers(".", filterRRs(resp.Answer, dns.TypeNS), resp.Extra); len(servers) > 0 {
+		r.store(".", servers, ttl)
+		slog.Debug("Primed the root servers", "servers", len(servers))
+	}
+}
+
+func (r *iterativeResolver) hintServers() []string {
+	servers := make([]string, len(r.hints))
+	for i, ip := range r.hints {
+		servers[i] = net.JoinHostPort(ip, "53")
+	}
+	return servers
+}
+
+// closest returns the closest zone cut known at or above name and its
+// servers, the root hints at worst
+func (r *iterativeResolver) closest(name string) (string, []string) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		zone := dns.Fqdn(strings.ToLower(name[off:]))
+		if d, ok := r.cuts[zone]; ok && now.Before(d.expires) {
+			return zone, d.servers
+		}
+	}
+	if d, ok := r.cuts["."]; ok && now.Before(d.expires) {
+		return ".", d.servers
+	}
+	return ".", r.hintServers()
+}
+
+// store caches the servers of a zone cut
+func (r *iterativeResolver) store(zone string, servers []string, ttl uint32) {
+	now := time.Now()
+	expires := now.Add(min(time.Duration(ttl)*time.Second, maxDelegationTTL))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cuts) >= maxCachedCuts {
+		for k, d := range r.cuts {
+			if now.After(d.expires) {
+				delete(r.cuts, k)
+			}
+		}
+		for k := range r.cuts {
+			if len(r.cuts) < maxCachedCuts {
+				break
+			}
+			delete(r.cuts, k)
+		}
+	}
+	r.cuts[strings.ToLower(zone)] = delegation{servers: servers, expires: expires}
+}
+
+// Resolve answers q from the authoritative servers, following CNAMEs. The
+// returned message holds the rcode, the answer (CNAME chain included) and
+// the authority records of the last response. Each response only keeps
+// the records of the zone of the server that sent it, so a CNAME target
+// outside it is resolved again.
+func (r *iterativeResolver) Resolve(ctx context.Context, q dns.Question, do bool) (*dns.Msg, error) {
+	st := &resolution{r: r, do: do}
+	var chain []dns.RR
+	name := q.Name
+	for range maxCNAMEChain + 1 {
+		resp, err := st.lookup(ctx, name, q.Qtype, 0)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Rcode == dns.RcodeSuccess && q.Qtype != dns.TypeCNAME {
+			if target := cnameTarget(resp.Answer, name, q.Qtype); target != "" {
+				chain = append(chain, resp.Answer...)
+				name = target
+				continue
+			}
+		}
+		resp.Answer = append(chain, resp.Answer...)
+		return resp, nil
+	}
+	return nil, fmt.Errorf("CNAME chain of %s longer than %d", q.Name, maxCNAMEChain)
+}
+
+// cnameTarget follows the CNAMEs of answer from name and returns the name
+// left to resolve, "" when answer already holds qtype records for it or
+// has no CNAME
+func cnameTarget(answer []dns.RR, name string, qtype uint16) string {
+	cur := name
+	for range maxCNAMEChain {
+		next := ""
+		for _, rr := range answer {
+			h := rr.Header()
+			if !strings.EqualFold(h.Name, cur) {
+				continue
+			}
+			if h.Rrtype == qtype {
+				return ""
+			}
+			if cname, ok := rr.(*dns.CNAME); ok {
+				next = cname.Target
+			}
+		}
+		if next == "" {
+			break
+		}
+		cur = next
+	}
+	if strings.EqualFold(cur, name) {
+		return ""
+	}
+	return cur
+}
+
+// resolution is the state of one client query: the budget of queries
+// sent to servers is shared by the CNAMEs and the name server lookups
+type resolution struct {
+	r       *iterativeResolver
+	do      bool
+	queries int
+}
+
+var errRecursionLimit = errors.New("too many queries to resolve the name")
+
+// lookup resolves name and qtype without following CNAMEs, from the
+// closest zone cut known, caching the cuts on the way down
+func (st *resolution) lookup(ctx context.Context, name string, qtype uint16, depth int) (*dns.Msg, error) {
+	// The DS records of a cut are served by its parent
+	from := name
+	if off, end := dns.NextLabel(name, 0); qtype == dns.TypeDS && !end {
+		from = name[off:]
+	}
+	zone, servers := st.r.closest(from)
+	total := dns.CountLabel(name)
+	labels := dns.CountLabel(zone)
+	minimize := st.r.qnameMin
+	for {
+		// With QNAME minimization, servers are asked for one label below
+		// their zone until the name has no more cuts
+		qname, qt := name, qtype
+		if minimize && labels+1 < total {
+			qname = lastLabels(name, labels+1)
+			qt = dns.TypeA
+		}
+		resp, err := st.exchangeRoot(ctx, zone, servers, qname, qt, func(m *dns.Msg) bool {
+			return usableResponse(m, zone, qname)
+		})
+		if err != nil {
+			if qname != name && !errors.Is(err, errRecursionLimit) && ctx.Err() == nil {
+				// Some servers mishandle minimized names (RFC 9156
+				// section 4): ask them the full name instead
+				minimize = false
+				continue
+			}
+			return nil, err
+		}
+
+		if cut, ns := referral(resp, zone, qname); cut != "" {
+			next, ttl := glueServers(zone, ns, resp.Extra)
+			if len(next) == 0 {
+				if next, ttl, err = st.resolveServers(ctx, ns, depth); err != nil {
+					return nil, err
+				}
+			}
+			st.r.store(cut, next, ttl)
+			zone, servers, labels = cut, next, dns.CountLabel(cut)
+			continue
+		}
+		if qname == name || resp.Rcode == dns.RcodeNameError {
+			// A name without the minimized ancestor does not exist either
+			// (RFC 8020)
+			keepBailiwick(resp, zone)
+			return resp, nil
+		}
+		// No cut at qname: go one label deeper with the same servers
+		labels++
+	}
+}
+
+// keepBailiwick drops the records of resp owned by names outside zone,
+// over which its servers have no authority: the CNAME targets elsewhere
+// are resolved from their own servers instead of being cached
+func keepBailiwick(resp *dns.Msg, zone string) {
+	keep := func(rrs []dns.RR) []dns.RR {
+		out := make([]dns.RR, 0, len(rrs))
+		for _, rr := range rrs {
+			if rr.Header().Rrtype == dns.TypeOPT || dns.IsSubDomain(zone, rr.Header().Name) {
+				out = append(out, rr)
+			} else {
+				slog.Debug("dropped an out-of-bailiwick record", "zone", zone, "record", rr.String())
+			}
+		}
+		return out
+	}
+	resp.Answer = keep(resp.Answer)
+	resp.Ns = keep(resp.Ns)
+	resp.Extra = keep(resp.Extra)
+}
+
+// lastLabels returns the last n labels of name
+func lastLabels(name string, n int) string {
+	idx := dns.Split(name)
+	if n >= len(idx) {
+		return name
+	}
+	return name[idx[len(idx)-n]:]
+}
+
+// usableResponse reports whether resp from a server of zone is an answer
+// or a referral closer to qname; other responses (SERVFAIL, REFUSED, lame
+// or upward referrals) make the next server asked
+func usableResponse(resp *dns.Msg, zone, qname string) bool {
+	switch resp.Rcode {
+	case dns.RcodeSuccess, dns.RcodeNameError:
+	default:
+		return false
+	}
+	if resp.Authoritative {
+		return true
+	}
+	cut, _ := referral(resp, zone, qname)
+	return cut != ""
+}
+
+// referral returns the zone cut and its NS records when resp refers from
+// zone to a cut closer to qname
+func referral(resp *dns.Msg, zone, qname string) (string, []dns.RR) {
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) > 0 {
+		return "", nil
+	}
+	ns := filterRRs(resp.Ns, dns.TypeNS)
+	if len(ns) == 0 {
+		return "", nil
+	}
+	cut := ns[0].Header().Name
+	if strings.EqualFold(cut, zone) || !dns.IsSubDomain(zone, cut) || !dns.IsSubDomain(cut, qname) {
+		return "", nil
+	}
+	return cut, ns
+}
+
+// glueServers returns the addresses of the name servers given in extra by
+// a server of zone, and the TTL of the delegation. Only glue within zone
+// is trusted, so a server cannot redirect the names of other zones.
+func glueServers(zone string, ns []dns.RR, extra []dns.RR) ([]string, uint32) {
+	var servers []string
+	ttl := uint32(maxDelegationTTL / time.Second)
+	for _, rr := range ns {
+		ttl = min(ttl, rr.Header().Ttl)
+		target := rr.(*dns.NS).Ns
+		for _, g := range extra {
+			if a, ok := g.(*dns.A); ok && strings.EqualFold(a.Hdr.Name, target) && dns.IsSubDomain(zone, target) {
+				servers = append(servers, net.JoinHostPort(a.A.String(), "53"))
+			}
+		}
+	}
+	return servers, ttl
+}
+
+// resolveServers looks up the IPv4 addresses of name servers given
+// without glue, stopping at the first one that resolves
+func (st *resolution) resolveServers(ctx context.Context, ns []dns.RR, depth int) ([]string, uint32, error) {
+	if depth >= maxGluelessDepth {
+		return nil, 0, fmt.Errorf("name servers nested more than %d levels without glue", maxGluelessDepth)
+	}
+	var lastErr error = errors.New("no address for the name servers")
+	for _, rr := range ns {
+		target := rr.(*dns.NS).Ns
+		resp, err := st.lookup(ctx, target, dns.TypeA, depth+1)
+		if err != nil {
+			if errors.Is(err, errRecursionLimit) || ctx.Err() != nil {
+				return nil, 0, err
+			}
+			lastErr = err
+			continue
+		}
+		var servers []string
+		ttl := rr.Header().Ttl
+		for _, a := range filterRRs(resp.Answer, dns.TypeA) {
+			servers = append(servers, net.JoinHostPort(a.(*dns.A).A.String(), "53"))
+			ttl = min(ttl, a.Header().Ttl)
+		}
+		if len(servers) > 0 {
+			return servers, ttl, nil
+		}
+	}
+	return nil, 0, lastErr
+}
+
+// exchange asks servers in random order until one gives a usable
+// response, retrying over TCP when a response is truncated
+func (st *resolution) exchange(ctx context.Context, servers []string, qname string, qtype uint16, usable func(*dns.Msg) bool) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, qtype)
+	m.RecursionDesired = false
+	m.SetEdns0(1232, st.do)
+
+	var lastErr error = fmt.Errorf("no server answered for %s", qname)
+	for _, i := range rand.Perm(len(servers)) {
+		if st.queries >= maxRecursionQueries {
+			return nil, errRecursionLimit
+		}
+		st.queries++
+		srv := servers[i]
+		c := forwardClient(st.r.timeout)
+		m.Id = dns.Id()
+		dnstapForward(srv, m, false)
+		resp, _, err := c.ExchangeContext(ctx, m, srv)
+		if err == nil && resp.Truncated {
+			c.Net = "tcp"
+			resp, _, err = c.ExchangeContext(ctx, m, srv)
+		}
+		dnstapForward(srv, resp, true)
+		switch {
+		case err != nil:
+			lastErr = err
+		case !usable(resp):
+			lastErr = fmt.Errorf("%s answered %s for %s", srv, dns.RcodeToString[resp.Rcode], qname)
+		default:
+			return resp, nil
+		}
+		slog.Debug("recursive query failed", "server", srv, "name", qname, "error", lastErr)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, lastErr
+}
+
+// recurseTo answers r with the recursive resolver, from the cache when it
+// can, or from an expired cache entry when resolution fails (serve-stale);
+// m is the reply sent, SERVFAIL when the name cannot be resolved
+func recurseTo(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	q := r.Question[0]
+	if resp := forwardCache.Get(r); resp != nil {
+		setQuerySource(w, sourceCached)
+		slog.Debug("Answered from cache", "name", q.Name, "client", w.RemoteAddr())
+		if err := w.WriteMsg(resp); err != nil {
+			slog.Debug("failed to write cached response", "client", w.RemoteAddr(), "error", err)
+		}
+		return
+	}
+	setQuerySource(w, sourceForwarded)
+	ctx, cancel := context.WithTimeout(context.Background(), recursionBudget)
+	defer cancel()
+	if !forwardLimit.Acquire(ctx) {
+		m.Rcode = dns.RcodeServerFailure
+		if err := w.WriteMsg(m); err != nil {
+			slog.Debug("failed to write SERVFAIL", "client", w.RemoteAddr(), "error", err)
+		}
+		slog.Debug("Too many recursive queries in flight, sent SERVFAIL", "name", q.Name, "client", w.RemoteAddr())
+		return
+	}
+	defer forwardLimit.Release()
+
+	do := false
+	if opt := r.IsEdns0(); opt != nil {
+		do = opt.Do()
+	}
+	resp, err := recursor.Resolve(ctx, q, do)
+	if err != nil {
+		slog.Debug("recursion failed", "name", q.Name, "error", err)
+		if stale := forwardCache.GetStale(r); stale != nil {
+			setQuerySource(w, sourceCached)
+			slog.Info("Answered from stale cache", "name", q.Name, "client", w.RemoteAddr())
+			if err := w.WriteMsg(stale); err != nil {
+				slog.Debug("failed to write stale response", "client", w.RemoteAddr(), "error", err)
+			}
+			return
+		}
+		m.Rcode = dns.RcodeServerFailure
+		if err := w.WriteMsg(m); err != nil {
+			slog.Debug("failed to write SERVFAIL", "client", w.RemoteAddr(), "error", err)
+		}
+		return
+	}
+
+	m.Authoritative = false
+	m.Rcode = resp.Rcode
+	m.Answer = resp.Answer
+	m.Ns = filterRRs(resp.Ns, dns.TypeSOA)
+	if do {
+		m.Ns = resp.Ns
+	}
+	clampMsgTTLs(m)
+	stripRebinding(q.Name, m)
+	if cacheable(q.Name) {
+		forwardCache.Set(r, m)
+	}
+	slog.Debug("Resolved recursively", "name", q.Name, "client", w.RemoteAddr(), "rcode", dns.RcodeToString[m.Rcode])
+	if err := w.WriteMsg(m); err != nil {
+		slog.Debug("failed to write recursive response", "client", w.RemoteAddr(), "error", err)
+	}
+}
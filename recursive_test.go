@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestKeepBailiwick(t *testing.T) {
+	resp := new(dns.Msg)
+	for _, s := range []string{
+		"www.example.com. 300 IN CNAME cdn.example.net.",
+		"cdn.example.net. 300 IN A 192.0.2.66",
+	} {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Answer = append(resp.Answer, rr)
+	}
+	soa, _ := dns.NewRR("example.net. 300 IN SOA ns.example.net. admin.example.net. 1 3600 600 86400 300")
+	resp.Ns = append(resp.Ns, soa)
+	resp.SetEdns0(dns.DefaultMsgSize, false)
+
+	keepBailiwick(resp, "example.com.")
+	if len(resp.Answer) != 1 || resp.Answer[0].Header().Rrtype != dns.TypeCNAME {
+		t.Fatalf("answer = %v, want the CNAME only", resp.Answer)
+	}
+	if len(resp.Ns) != 0 {
+		t.Errorf("authority = %v, want nothing from example.net.", resp.Ns)
+	}
+	if resp.IsEdns0() == nil {
+		t.Error("the OPT record was dropped")
+	}
+	// The target is resolved again from its own servers
+	if target := cnameTarget(resp.Answer, "www.example.com.", dns.TypeA); target != "cdn.example.net." {
+		t.Errorf("cnameTarget = %q, want cdn.example.net.", target)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// ResolveTrace explains how the server answers a query: what the zones
+// hold for the name and where the final message came from
+type ResolveTrace struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Client string `json:"client"`
+	Subnet string `json:"subnet,omitempty"`
+
+	Zone        string   `json:"zone,omitempty"` // enclosing local zone
+	Delegation  []string `json:"delegation,omitempty"`
+	ZoneRecords []string `json:"zone_records"` // every record at the name
+	Hosts       []string `json:"hosts,omitempty"`
+	ServesLocal bool     `json:"serves_local"`          // false under a forward-only profile or in maintenance
+	Maintenance bool     `json:"maintenance,omitempty"` // the zone is in maintenance
+	MDNS        bool     `json:"mdns,omitempty"`
+	DNS64       bool     `json:"dns64,omitempty"`
+	// Sinkhole is the blocked domain covering the name
+	Sinkhole string `json:"sinkhole,omitempty"`
+	// AddressFilter is the address type hidden from the client (A or AAAA)
+	AddressFilter string   `json:"address_filter,omitempty"`
+	Forwarders    []string `json:"forwarders,omitempty"`
+	ForwardZone   bool     `json:"forward_zone,omitempty"` // forwarders of a forward zone
+
+	Source     string   `json:"source"` // local, forwarded or cached
+	Rcode      string   `json:"rcode"`
+	Flags      []string `json:"flags"`
+	Answer     []string `json:"answer"`
+	Authority  []string `json:"authority"`
+	Additional []string `json:"additional"`
+	Message    string   `json:"message"`
+	DurationMS float64  `json:"duration_ms"`
+}
+
+// traceWriter is the ResponseWriter of a traced query
+type traceWriter struct {
+	remote net.Addr
+	msg    *dns.Msg
+}
+
+func (w *traceWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: dnsPort}
+}
+func (w *traceWriter) RemoteAddr() net.Addr        { return w.remote }
+func (w *traceWriter) WriteMsg(m *dns.Msg) error   { w.msg = m; return nil }
+func (w *traceWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *traceWriter) Close() error                { return nil }
+func (w *traceWriter) TsigStatus() error           { return nil }
+func (w *traceWriter) TsigTimersOnly(bool)         {}
+func (w *traceWriter) Hijack()                     {}
+
+func rrStrings(rrs []dns.RR) []string {
+	out := make([]string, 0, len(rrs))
+	for _, rr := range rrs {
+		if _, ok := rr.(*dns.OPT); ok {
+			continue
+		}
+		out = append(out, rr.String())
+	}
+	return out
+}
+
+// handleAPIResolve runs a query through the DNS handler and explains the
+// answer (?name=www.example.com&type=A&client=192.168.1.10&subnet=...&tcp=1).
+// Queries that are not answered locally are really forwarded.
+func handleAPIResolve(c *gin.Context) {
+	name, err := idnToASCII(strings.TrimSpace(c.Query("name")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := dns.IsDomainName(name); !ok || name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid name"})
+		return
+	}
+	name = dns.Fqdn(name)
+	qtype, ok := dns.StringToType[strings.ToUpper(c.DefaultQuery("type", "A"))]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown record type"})
+		return
+	}
+
+	clientIP := net.ParseIP(c.ClientIP())
+	if v := c.Query("client"); v != "" {
+		if clientIP = net.ParseIP(v); clientIP == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client address"})
+			return
+		}
+	}
+	var remote net.Addr = &net.UDPAddr{IP: clientIP, Port: 53}
+	if c.Query("tcp") == "1" {
+		remote = &net.TCPAddr{IP: clientIP, Port: 53}
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion(name, qtype)
+	req.SetEdns0(dns.DefaultMsgSize, c.Query("dnssec") == "1")
+	subnet := c.Query("subnet")
+	if subnet != "" {
+		_, ipnet, err := net.ParseCIDR(subnet)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client subnet"})
+			return
+		}
+		ones, _ := ipnet.Mask.Size()
+		ecs := &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, SourceNetmask: uint8(ones), Address: ipnet.IP, Family: 1}
+		if ipnet.IP.To4() == nil {
+			ecs.Family = 2
+		}
+		req.IsEdns0().Option = append(req.IsEdns0().Option, ecs)
+		subnet = ipnet.String()
+	}
+
+	zd := zoneStore.Load()
+	res := zd.Resolve(name)
+	trace := ResolveTrace{
+		Name:        name,
+		Type:        dns.TypeToString[qtype],
+		Client:      clientIP.String(),
+		Subnet:      subnet,
+		Zone:        res.Zone,
+		Delegation:  rrStrings(res.Delegation),
+		ZoneRecords: rrStrings(res.Records),
+		ServesLocal: serveZone(res.Zone),
+		Maintenance: res.Zone != "" && inMaintenance(res.Zone),
+		MDNS:        mdnsBridge.handles(name),
+		DNS64:       qtype == dns.TypeAAAA && dns64.enabledFor(remote),
+	}
+	if filter := addressFilterFor(remote, name); filter != 0 {
+		trace.AddressFilter = dns.TypeToString[filter]
+	}
+	if rrs, ok := lookupHosts(name, dns.TypeANY); ok {
+		trace.Hosts = rrStrings(rrs)
+	}
+	if res.Zone == "" {
+		trace.Sinkhole = strings.TrimSuffix(sinkholedName(name), ".")
+	}
+	if len(res.Forward) > 0 {
+		trace.ForwardZone = true
+		trace.Forwarders = append(trace.Forwarders, res.Forward...)
+	} else {
+		trace.Forwarders = append(trace.Forwarders, currentForwarders()...)
+	}
+
+	// The stats writer only records where the answer came from
+	w := &traceWriter{remote: remote}
+	sw := &statsWriter{ResponseWriter: w, source: sourceLocal}
+	start := time.Now()
+	withAddressFilter(withDNS64(handleDNS))(sw, req)
+	trace.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+	trace.Source = sw.source
+
+	resp := w.msg
+	if resp == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "no response"})
+		return
+	}
+	trace.Rcode = dns.RcodeToString[resp.Rcode]
+	// In dig order
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"qr", resp.Response}, {"aa", resp.Authoritative}, {"tc", resp.Truncated}, {"rd", resp.RecursionDesired},
+		{"ra", resp.RecursionAvailable}, {"ad", resp.AuthenticatedData}, {"cd", resp.CheckingDisabled},
+	} {
+		if f.set {
+			trace.Flags = append(trace.Flags, f.name)
+		}
+	}
+	trace.Answer = rrStrings(resp.Answer)
+	trace.Authority = rrStrings(resp.Ns)
+	trace.Additional = rrStrings(resp.Extra)
+	trace.Message = resp.String()
+	c.JSON(http.StatusOK, trace)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// reusePort binds the DNS and web ports with SO_REUSEPORT (reuse_port), so
+// a new process can start on them while the old one still serves: an
+// upgrade starts the new version, then stops the old one, which drains
+// the queries it is answering
+var reusePort bool
+
+// shutdownDrain bounds how long a stopping server waits for the queries
+// and requests in flight (shutdown_drain_seconds)
+var shutdownDrain = 5 * time.Second
+
+// listenWeb opens the TCP listener of a web server, with SO_REUSEPORT when
+// reuse_port is set
+func listenWeb(addr string) (net.Listener, error) {
+	lc := net.ListenConfig{}
+	if reusePort {
+		lc.Control = reusePortControl
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// serveWeb runs server on its own listener, over TLS when tls is set, and
+// returns when the server stops
+func serveWeb(server *http.Server, tls bool) error {
+	ln, err := listenWeb(server.Addr)
+	if err != nil {
+		return err
+	}
+	if tls {
+		return server.ServeTLS(ln, "", "")
+	}
+	return server.Serve(ln)
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+func reusePortControl(string, string, syscall.RawConn) error {
+	return errors.New("reuse_port is not supported on this platform")
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// Server roles
+const (
+	roleMaster = "master"
+	roleSlave  = "slave"
+)
+
+// serverRoleConfigKey stores a role set at runtime (promotion/demotion),
+// which takes precedence over server_role from the config file
+const serverRoleConfigKey = "server_role"
+
+var (
+	serverRole   = roleMaster
+	serverRoleMu sync.RWMutex
+)
+
+func currentServerRole() string {
+	serverRoleMu.RLock()
+	defer serverRoleMu.RUnlock()
+	return serverRole
+}
+
+func setServerRole(role string) {
+	serverRoleMu.Lock()
+	defer serverRoleMu.Unlock()
+	serverRole = role
+}
+
+// loadServerRoleFromDB applies a role persisted by a previous promotion
+func loadServerRoleFromDB() {
+	if database == nil {
+		return
+	}
+	if role, err := database.GetConfig(serverRoleConfigKey); err == nil && role != "" && role != currentServerRole() {
+		slog.Info("Using server role set at runtime", "role", role, "config_role", currentServerRole())
+		setServerRole(role)
+	}
+}
+
+// readOnlyPrefixes are the API routes holding replicated data, which a
+// slave must not change locally
+var readOnlyPrefixes = []string{"/api/zones", "/api/records", "/api/changesets", "/api/forwarders", "/api/clients", "/api/schedules", "/api/trash", "/api/restore", "/api/import"}
+
+// slaveAllowedRoutes are the changes under readOnlyPrefixes a slave still
+// accepts: validation only reads the zone, the benchmark only queries the
+// forwarders
+var slaveAllowedRoutes = map[string]bool{
+	"POST /api/zones/:id/validate":   true,
+	"POST /api/forwarders/benchmark": true,
+}
+
+// slaveReadOnly reports whether a slave refuses the request method on the
+// API route
+func slaveReadOnly(method, route string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return false
+	}
+	if slaveAllowedRoutes[method+" "+route] {
+		return false
+	}
+	for _, prefix := range readOnlyPrefixes {
+		if strings.HasPrefix(route, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadOnlySlaveMiddleware rejects changes to zones, records and forwarders
+// while the server is a slave, so it cannot silently diverge from its master
+func ReadOnlySlaveMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if currentServerRole() == roleSlave && slaveReadOnly(c.Request.Method, c.FullPath()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "this server is a read-only slave, make changes on the master"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Replication role API handlers
+
+func handleAPIPromote(c *gin.Context) {
+	changeServerRole(c, roleMaster)
+}
+
+func handleAPIDemote(c *gin.Context) {
+	changeServerRole(c, roleSlave)
+}
+
+func changeServerRole(c *gin.Context, role string) {
+	previous := currentServerRole()
+	if previous == role {
+		c.JSON(http.StatusConflict, gin.H{"error": "server is already " + role})
+		return
+	}
+
+	if err := database.SetConfig(serverRoleConfigKey, role); err != nil {
+		slog.Error("failed to save server role", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save server role"})
+		return
+	}
+	setServerRole(role)
+
+	slog.Info("Server role changed", "role", role, "previous", previous, "user", c.GetString("username"))
+	c.JSON(http.StatusOK, gin.H{"role": role, "previous": previous})
+}
+
+// ZoneSerial is the SOA serial a server currently serves for a zone
+type ZoneSerial struct {
+	Zone   string `json:"zone"`
+	Serial uint32 `json:"serial"`
+}
+
+// servedSerials returns the SOA serial of every zone served, sorted by zone
+func servedSerials(zd *ZoneData) []ZoneSerial {
+	zones := make([]ZoneSerial, 0)
+	for _, name := range zd.ZoneNames() {
+		if serial, ok := zoneSerial(zd, name); ok {
+			zones = append(zones, ZoneSerial{Zone: name, Serial: serial})
+		}
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].Zone < zones[j].Zone })
+	return zones
+}
+
+// zoneSerial returns the serial of the SOA of zone in zd
+func zoneSerial(zd *ZoneData, zone string) (uint32, bool) {
+	rrs, _ := zd.Lookup(zone)
+	for _, rr := range rrs {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial, true
+		}
+	}
+	return 0, false
+}
+
+// handleAPIReplicationStatus returns the role and the served serials, to
+// compare a slave with its master
+func handleAPIReplicationStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"role": currentServerRole(), "zones": servedSerials(zoneStore.Load())})
+}
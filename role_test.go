@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slaveLocalRoutes are the changes a slave makes to its own state rather
+// than to replicated data, outside readOnlyPrefixes
+var slaveLocalRoutes = map[string]bool{
+	"POST /api/backups":              true,
+	"PUT /api/address-filter":        true,
+	"PUT /api/sinkhole/domains":      true,
+	"POST /api/sinkhole/refresh":     true,
+	"POST /api/tokens":               true,
+	"DELETE /api/tokens/:id":         true,
+	"PUT /api/profiles/active":       true,
+	"POST /api/certificates/renew":   true,
+	"POST /api/alerts/test":          true,
+	"POST /api/verify":               true,
+	"POST /api/replication/promote":  true,
+	"POST /api/replication/demote":   true,
+	"PUT /api/maintenance":           true,
+	"POST /api/zones/:id/validate":   true,
+	"POST /api/forwarders/benchmark": true,
+}
+
+// Every change of the API is either refused on a slave or listed as local,
+// so a new route cannot let a slave diverge from its master unnoticed
+func TestSlaveReadOnlyCoversAPIRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	registerAPIRoutes(router)
+	for _, route := range router.Routes() {
+		switch route.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			continue
+		}
+		key := route.Method + " " + route.Path
+		readOnly := slaveReadOnly(route.Method, route.Path)
+		if readOnly == slaveLocalRoutes[key] {
+			t.Errorf("%s: read-only on a slave %v, listed as local %v", key, readOnly, slaveLocalRoutes[key])
+		}
+	}
+}
+
+func TestReadOnlySlaveMiddlewareRefusesTrash(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setServerRole(roleSlave)
+	defer setServerRole(roleMaster)
+
+	router := gin.New()
+	router.Use(ReadOnlySlaveMiddleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.POST("/api/trash/:id/restore", ok)
+	router.DELETE("/api/trash/:id", ok)
+	router.POST("/api/zones/:id/validate", ok)
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodPost, "/api/trash/1/restore", http.StatusForbidden},
+		{http.MethodDelete, "/api/trash/1", http.StatusForbidden},
+		{http.MethodPost, "/api/zones/1/validate", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.status {
+			t.Errorf("%s %s on a slave = %d, want %d", tc.method, tc.path, w.Code, tc.status)
+		}
+	}
+}
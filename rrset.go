@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// DNS answers whole RRsets: all the records of an owner name and type,
+// served with one TTL. The records stay stored one per row, and the RRset
+// API reads and replaces them together.
+
+// RRSet is the set of records of a name and type
+type RRSet struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	TTL    int      `json:"ttl"`
+	Values []string `json:"values"`
+	// Records are the stored records of the set, with their notes and
+	// schedules
+	Records []DBRecord `json:"records,omitempty"`
+}
+
+// RRSetRequest replaces the records of an RRset: one record per value,
+// all with the TTL (the one of the current records when 0)
+type RRSetRequest struct {
+	TTL    int      `json:"ttl"`
+	Values []string `json:"values"`
+}
+
+// ownerTypes returns the types of records in the order they first appear
+func ownerTypes(records []dns.RR) []uint16 {
+	var types []uint16
+	for _, rr := range records {
+		if t := rr.Header().Rrtype; !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// rrsetKey identifies the RRset of a record of zoneName
+func rrsetKey(zoneName, name, rrType string) string {
+	return strings.ToLower(recordOwner(name, zoneName)) + " " + strings.ToUpper(rrType)
+}
+
+// groupRRSets groups records by owner name and type, in the order their
+// sets first appear. The TTL of a set is the lowest of its records.
+func groupRRSets(zoneName string, records []DBRecord) []RRSet {
+	var sets []RRSet
+	index := make(map[string]int)
+	for _, r := range records {
+		key := rrsetKey(zoneName, r.Name, r.Type)
+		i, ok := index[key]
+		if !ok {
+			i = len(sets)
+			index[key] = i
+			sets = append(sets, RRSet{Name: r.Name, Type: strings.ToUpper(r.Type), TTL: r.TTL})
+		}
+		sets[i].TTL = min(sets[i].TTL, r.TTL)
+		sets[i].Values = append(sets[i].Values, r.Value)
+		sets[i].Records = append(sets[i].Records, r)
+	}
+	return sets
+}
+
+// rrsetRecords returns the records of zone in the RRset of name and type
+func rrsetRecords(zoneName string, records []DBRecord, name, rrType string) []DBRecord {
+	key := rrsetKey(zoneName, name, rrType)
+	var out []DBRecord
+	for _, r := range records {
+		if rrsetKey(zoneName, r.Name, r.Type) == key {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// rrsetChanges returns the changes replacing the records of an RRset with
+// one record per value: records whose value is kept stay (with their
+// notes and schedule), only their TTL changes
+func rrsetChanges(zone *DBZone, current []DBRecord, name, rrType string, req RRSetRequest) ([]DBChange, error) {
+	ttl := req.TTL
+	if ttl == 0 {
+		ttl = zoneDefaultTTL(zone.ID)
+		if len(current) > 0 {
+			ttl = groupRRSets(zone.Name, current)[0].TTL
+		}
+	}
+	if ttl < 0 {
+		return nil, errors.New("invalid TTL")
+	}
+	// New records keep the spelling of the name of the current ones
+	if len(current) > 0 {
+		name = current[0].Name
+	}
+
+	var changes []DBChange
+	kept := make([]bool, len(current))
+	seen := make(map[string]bool)
+	for _, value := range req.Values {
+		record := DBRecord{ZoneID: zone.ID, Name: name, Type: rrType, Value: strings.TrimSpace(value), TTL: ttl}
+		if record.Value == "" {
+			return nil, errors.New("empty value")
+		}
+		if err := normalizeSVCBRecord(zone.Name, &record); err != nil {
+			return nil, err
+		}
+		rr, err := recordToRR(dns.Fqdn(zone.Name), record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s record %q: %v", rrType, record.Value, err)
+		}
+		rdata := rdataString(rr)
+		if seen[rdata] {
+			continue
+		}
+		seen[rdata] = true
+		match := -1
+		for i, r := range current {
+			if kept[i] {
+				continue
+			}
+			if existing, err := recordToRR(dns.Fqdn(zone.Name), r); err == nil && rdataString(existing) == rdata {
+				match = i
+				break
+			}
+		}
+		if match < 0 {
+			changes = append(changes, DBChange{Action: "create", Name: record.Name, Type: rrType, Value: record.Value, TTL: ttl, Priority: record.Priority})
+			continue
+		}
+		kept[match] = true
+		if r := current[match]; r.TTL != ttl {
+			changes = append(changes, DBChange{Action: "update", RecordID: r.ID, Name: r.Name, Type: r.Type, Value: r.Value, TTL: ttl, Priority: r.Priority,
+				RecordSchedule: r.RecordSchedule, RecordNotes: r.RecordNotes, RecordCaching: r.RecordCaching})
+		}
+	}
+	for i, r := range current {
+		if !kept[i] {
+			changes = append(changes, DBChange{Action: "delete", RecordID: r.ID, Name: r.Name, Type: r.Type})
+		}
+	}
+	return changes, nil
+}
+
+// applyChangesToRecords returns records once changes are applied, to check
+// the zone before they go live
+func applyChangesToRecords(records []DBRecord, changes []DBChange) []DBRecord {
+	out := append([]DBRecord(nil), records...)
+	for _, ch := range changes {
+		switch ch.Action {
+		case "create":
+			out = append(out, DBRecord{Name: ch.Name, Type: ch.Type, Value: ch.Value, TTL: ch.TTL, Priority: ch.Priority})
+		case "update", "delete":
+			for i := range out {
+				if out[i].ID != ch.RecordID {
+					continue
+				}
+				if ch.Action == "delete" {
+					out = append(out[:i], out[i+1:]...)
+				} else {
+					out[i].TTL = ch.TTL
+				}
+				break
+			}
+		}
+	}
+	return out
+}
+
+// handleAPIListRRSets handles GET /api/zones/:id/rrsets?name=&type=
+func handleAPIListRRSets(c *gin.Context) {
+	zone, records, ok := loadPrimaryZone(c)
+	if !ok {
+		return
+	}
+	name := strings.TrimSpace(c.Query("name"))
+	rrType := strings.ToUpper(strings.TrimSpace(c.Query("type")))
+	sets := []RRSet{}
+	for _, set := range groupRRSets(zone.Name, records) {
+		if name != "" && !strings.EqualFold(recordOwner(set.Name, zone.Name), recordOwner(name, zone.Name)) {
+			continue
+		}
+		if rrType != "" && set.Type != rrType {
+			continue
+		}
+		sets = append(sets, set)
+	}
+	setETag(c, int64(zone.Serial))
+	c.JSON(http.StatusOK, sets)
+}
+
+// handleAPIGetRRSet handles GET /api/zones/:id/rrsets/:name/:type. The ETag
+// is the serial of the zone, sent back with If-Match to replace the set.
+func handleAPIGetRRSet(c *gin.Context) {
+	zone, records, ok := loadPrimaryZone(c)
+	if !ok {
+		return
+	}
+	current := rrsetRecords(zone.Name, records, c.Param("name"), c.Param("type"))
+	if len(current) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "record set not found"})
+		return
+	}
+	setETag(c, int64(zone.Serial))
+	c.JSON(http.StatusOK, groupRRSets(zone.Name, current)[0])
+}
+
+// handleAPIPutRRSet handles PUT /api/zones/:id/rrsets/:name/:type: the
+// records of the set become one per value, with one TTL. No values
+// deletes the set. The zone must not change since the If-Match serial.
+func handleAPIPutRRSet(c *gin.Context) {
+	zone, records, ok := loadPrimaryZone(c)
+	if !ok {
+		return
+	}
+	expected, ok := checkIfMatch(c, int64(zone.Serial))
+	if !ok {
+		return
+	}
+	var req RRSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name, err := idnToASCII(strings.TrimSpace(c.Param("name")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rrType := strings.ToUpper(strings.TrimSpace(c.Param("type")))
+	if _, known := dns.StringToType[rrType]; !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record type " + c.Param("type")})
+		return
+	}
+	if msg := systemRecordError(zone.Name, name, rrType); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	current := rrsetRecords(zone.Name, records, name, rrType)
+	changes, err := rrsetChanges(zone, current, name, rrType, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	replaceRRSet(c, zone, records, name, rrType, int(expected), changes)
+}
+
+// handleAPIDeleteRRSet handles DELETE /api/zones/:id/rrsets/:name/:type
+func handleAPIDeleteRRSet(c *gin.Context) {
+	zone, records, ok := loadPrimaryZone(c)
+	if !ok {
+		return
+	}
+	if msg := systemRecordError(zone.Name, c.Param("name"), c.Param("type")); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	current := rrsetRecords(zone.Name, records, c.Param("name"), c.Param("type"))
+	if len(current) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "record set not found"})
+		return
+	}
+	changes, _ := rrsetChanges(zone, current, c.Param("name"), strings.ToUpper(c.Param("type")), RRSetRequest{})
+	replaceRRSet(c, zone, records, c.Param("name"), strings.ToUpper(c.Param("type")), 0, changes)
+}
+
+// replaceRRSet stages or applies the changes of an RRset and answers with
+// the set as stored afterwards
+func replaceRRSet(c *gin.Context, zone *DBZone, records []DBRecord, name, rrType string, serial int, changes []DBChange) {
+	if stageChanges(c, zone.ID, changes) {
+		return
+	}
+	if len(changes) > 0 {
+		if problems := checkZoneRecords(zone, applyChangesToRecords(records, changes)); hasErrors(problems) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "the zone would have errors", "problems": problems})
+			return
+		}
+		next, err := database.ApplyZoneChanges(zone.ID, serial, changes)
+		if err != nil {
+			if errors.Is(err, errVersionConflict) {
+				if current, err := database.GetZone(zone.ID); err == nil {
+					versionConflict(c, int64(current.Serial))
+					return
+				}
+			}
+			if errors.Is(err, errChangesetConflict) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			slog.Error("failed to replace record set", "zone", zone.Name, "name", name, "type", rrType, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to replace record set"})
+			return
+		}
+		zone.Serial = next
+		if err := LoadZonesFromDB(); err != nil {
+			slog.Error("failed to reload zones", "error", err)
+		}
+		slog.Info("Record set replaced", "zone", zone.Name, "name", name, "type", rrType, "changes", len(changes))
+	}
+
+	setETag(c, int64(zone.Serial))
+	records, err := database.ListRecordsByZone(zone.ID)
+	if err != nil {
+		slog.Error("failed to list records", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list records"})
+		return
+	}
+	set := RRSet{Name: name, Type: rrType, Values: []string{}}
+	if current := rrsetRecords(zone.Name, records, name, rrType); len(current) > 0 {
+		set = groupRRSets(zone.Name, current)[0]
+	}
+	c.JSON(http.StatusOK, set)
+}
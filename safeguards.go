@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// The SOA and the apex NS of a zone are generated from its settings, so the
+// record endpoints refuse to create, change or delete them. Deleting a zone
+// holding many records needs a confirmation token, so that a script or a
+// wrong id does not wipe it at once.
+
+// defaultZoneDeleteConfirmRecords is the default of
+// zone_delete_confirm_records
+const defaultZoneDeleteConfirmRecords = 20
+
+// zoneDeleteConfirmRecords is the number of records above which deleting a
+// zone needs a confirmation token, 0 when it never does
+var zoneDeleteConfirmRecords = defaultZoneDeleteConfirmRecords
+
+func initZoneDeleteConfirm(records int) {
+	switch {
+	case records > 0:
+		zoneDeleteConfirmRecords = records
+	case records < 0:
+		zoneDeleteConfirmRecords = 0
+	}
+}
+
+// systemRecordError is the reason a record of zoneName with this name and
+// type cannot go through the record endpoints, empty when it can
+func systemRecordError(zoneName, name, rrType string) string {
+	rrType = strings.ToUpper(strings.TrimSpace(rrType))
+	switch {
+	case rrType == "SOA":
+		return "the SOA is managed in the zone settings"
+	case rrType == "NS" && strings.EqualFold(recordOwner(name, zoneName), dns.Fqdn(zoneName)):
+		return "the apex NS is managed in the zone settings"
+	}
+	return ""
+}
+
+// zoneDeleteToken returns the token confirming the deletion of zone while
+// it holds records records. It is derived from the zone serial, so it
+// expires as soon as the zone changes.
+func zoneDeleteToken(zone *DBZone, records int) string {
+	sum := sha256.Sum256(fmt.Appendf(nil, "delete %d %s %d %d", zone.ID, strings.ToLower(zone.Name), zone.Serial, records))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// The clients of a group with safe_search cannot turn off the filtering of
+// explicit results by the search engines: the names of the engines are
+// answered with a CNAME to the host each engine provides to enforce it,
+// resolved like any name. YouTube has two levels of restricted mode.
+
+// safeSearchTTL is the TTL of the CNAME to a safe search host
+const safeSearchTTL = 300
+
+// Search engines of clients.groups.safe_search_engines
+const (
+	engineGoogle     = "google"
+	engineBing       = "bing"
+	engineDuckDuckGo = "duckduckgo"
+	engineYouTube    = "youtube"
+)
+
+var safeSearchEngineNames = []string{engineGoogle, engineBing, engineDuckDuckGo, engineYouTube}
+
+// Restricted modes of YouTube, in youtube_restrict
+const (
+	youTubeStrict   = "strict"
+	youTubeModerate = "moderate"
+)
+
+// safeSearchHosts are the hosts enforcing the safe search of each engine;
+// YouTube has one per restricted mode
+var safeSearchHosts = map[string]string{
+	engineGoogle:                    "forcesafesearch.google.com.",
+	engineBing:                      "strict.bing.com.",
+	engineDuckDuckGo:                "safe.duckduckgo.com.",
+	engineYouTube + youTubeStrict:   "restrict.youtube.com.",
+	engineYouTube + youTubeModerate: "restrictmoderate.youtube.com.",
+}
+
+// safeSearchNames maps the names of the search engines, other than the
+// Google domains, to their engine
+var safeSearchNames = map[string]string{
+	"www.bing.com.":             engineBing,
+	"bing.com.":                 engineBing,
+	"duckduckgo.com.":           engineDuckDuckGo,
+	"www.duckduckgo.com.":       engineDuckDuckGo,
+	"start.duckduckgo.com.":     engineDuckDuckGo,
+	"html.duckduckgo.com.":      engineDuckDuckGo,
+	"www.youtube.com.":          engineYouTube,
+	"m.youtube.com.":            engineYouTube,
+	"youtubei.googleapis.com.":  engineYouTube,
+	"youtube.googleapis.com.":   engineYouTube,
+	"www.youtube-nocookie.com.": engineYouTube,
+}
+
+// validGroupSafeSearch checks the safe search settings of a group
+func validGroupSafeSearch(g ClientGroup) error {
+	for _, e := range g.SafeSearchEngines {
+		if !slices.Contains(safeSearchEngineNames, e) {
+			return fmt.Errorf("unknown safe search engine %q, expected one of %s", e, strings.Join(safeSearchEngineNames, ", "))
+		}
+	}
+	switch g.YouTubeRestrict {
+	case "", youTubeStrict, youTubeModerate:
+	default:
+		return fmt.Errorf("youtube_restrict must be strict or moderate")
+	}
+	if !g.SafeSearch && (len(g.SafeSearchEngines) > 0 || g.YouTubeRestrict != "") {
+		return fmt.Errorf("safe_search_engines and youtube_restrict need safe_search: true")
+	}
+	return nil
+}
+
+// safeSearchEngines returns the search engines restricted for the clients
+// of the group, none without safe search
+func (g *ClientGroup) safeSearchEngines() []string {
+	switch {
+	case !g.SafeSearch:
+		return nil
+	case len(g.SafeSearchEngines) == 0:
+		return safeSearchEngineNames
+	}
+	return g.SafeSearchEngines
+}
+
+// safeSearchEngine returns the search engine of name, "" when name is not
+// a search engine
+func safeSearchEngine(name string) string {
+	name = strings.ToLower(dns.Fqdn(name))
+	if engine, ok := safeSearchNames[name]; ok {
+		return engine
+	}
+	// google.com, www.google.fr, google.co.uk...
+	labels := dns.SplitDomainName(strings.TrimPrefix(name, "www."))
+	if len(labels) >= 2 && len(labels) <= 3 && labels[0] == "google" && labels[1] != "googleapis" {
+		return engineGoogle
+	}
+	return ""
+}
+
+// safeSearchTarget returns the safe search host answered for name to the
+// clients of g, "" when name is not a search engine restricted by g
+func safeSearchTarget(g *ClientGroup, name string) string {
+	engine := safeSearchEngine(name)
+	if engine == "" || !slices.Contains(g.safeSearchEngines(), engine) {
+		return ""
+	}
+	if engine == engineYouTube {
+		if g.YouTubeRestrict == youTubeModerate {
+			return safeSearchHosts[engine+youTubeModerate]
+		}
+		return safeSearchHosts[engine+youTubeStrict]
+	}
+	return safeSearchHosts[engine]
+}
+
+// answerSafeSearch answers a query for a search engine with a CNAME to its
+// safe search host, followed by the records of the host
+func answerSafeSearch(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg, target string) {
+	name := r.Question[0].Name
+	req := r.Copy()
+	req.Question[0].Name = target
+	rec := &captureWriter{ResponseWriter: w}
+	handleDNS(rec, req)
+	if rec.msg == nil {
+		m.Rcode = dns.RcodeServerFailure
+		if err := w.WriteMsg(m); err != nil {
+			slog.Debug("failed to write SERVFAIL", "client", w.RemoteAddr(), "error", err)
+		}
+		return
+	}
+	m.Authoritative = false
+	m.Rcode = rec.msg.Rcode
+	m.Answer = append(m.Answer, &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: safeSearchTTL},
+		Target: target,
+	})
+	m.Answer = append(m.Answer, rec.msg.Answer...)
+	if err := w.WriteMsg(m); err != nil {
+		slog.Debug("failed to write safe search response", "client", w.RemoteAddr(), "error", err)
+		return
+	}
+	slog.Debug("Answered with safe search", "name", name, "target", target, "client", w.RemoteAddr())
+}
@@ -0,0 +1,34 @@
+#!/bin/sh
+# Downloads the JavaScript libraries of the web UI and builds its Tailwind
+# stylesheet into static/vendor, embedded in the binary so the UI works
+# without Internet access. Run from the repository root and commit the
+# result after bumping a version.
+set -eu
+
+ALPINE_VERSION=3.14.1
+CHARTJS_VERSION=4.4.1
+TAILWIND_VERSION=3.4.10
+
+out=static/vendor
+mkdir -p "$out"
+
+curl -fsSL -o "$out/alpine.min.js" "https://cdn.jsdelivr.net/npm/alpinejs@${ALPINE_VERSION}/dist/cdn.min.js"
+curl -fsSL -o "$out/chart.umd.min.js" "https://cdn.jsdelivr.net/npm/chart.js@${CHARTJS_VERSION}/dist/chart.umd.min.js"
+
+# The stylesheet only contains the classes used by the templates
+case "$(uname -s)-$(uname -m)" in
+Linux-x86_64) platform=linux-x64 ;;
+Linux-aarch64) platform=linux-arm64 ;;
+Darwin-x86_64) platform=macos-x64 ;;
+Darwin-arm64) platform=macos-arm64 ;;
+*) echo "no Tailwind CLI for $(uname -s)-$(uname -m)" >&2; exit 1 ;;
+esac
+tailwind=$(mktemp)
+input=$(mktemp)
+trap 'rm -f "$tailwind" "$input"' EXIT
+curl -fsSL -o "$tailwind" "https://github.com/tailwindlabs/tailwindcss/releases/download/v${TAILWIND_VERSION}/tailwindcss-${platform}"
+chmod +x "$tailwind"
+printf '@tailwind base;\n@tailwind components;\n@tailwind utilities;\n' >"$input"
+"$tailwind" --config static/tailwind.config.js --input "$input" --output "$out/tailwind.css" --minify
+
+ls -l "$out"
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// SearchDomainRule expands the single-label names asked by some clients
+// with search suffixes, like the search list of resolv.conf
+type SearchDomainRule struct {
+	// Suffixes are tried in order, e.g. corp.local then lan
+	Suffixes []string `yaml:"suffixes" json:"suffixes"`
+	// Clients lists the networks (addresses or CIDR prefixes) of the rule,
+	// every client when empty
+	Clients []string `yaml:"clients" json:"clients,omitempty"`
+}
+
+type searchDomainRule struct {
+	suffixes []string // lowercase and qualified
+	clients  []*net.IPNet
+}
+
+// searchDomains holds the compiled rules, the first one matching the
+// client applies
+var searchDomains []searchDomainRule
+
+// searchCNAMETTL is the TTL of the CNAME to an expanded name answered
+// without records (NODATA)
+const searchCNAMETTL = 60
+
+func compileSearchDomains(rules []SearchDomainRule) ([]searchDomainRule, error) {
+	out := make([]searchDomainRule, 0, len(rules))
+	for _, rule := range rules {
+		if len(rule.Suffixes) == 0 {
+			return nil, fmt.Errorf("search domain rule for %v has no suffixes", rule.Clients)
+		}
+		var suffixes []string
+		for _, s := range rule.Suffixes {
+			suffix, err := idnToASCII(strings.Trim(strings.TrimSpace(s), "."))
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := dns.IsDomainName(suffix); !ok || suffix == "" {
+				return nil, fmt.Errorf("invalid search suffix %q", s)
+			}
+			suffixes = append(suffixes, strings.ToLower(dns.Fqdn(suffix)))
+		}
+		clients, err := parseAllowTransfer(rule.Clients)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, searchDomainRule{suffixes: suffixes, clients: clients})
+	}
+	return out, nil
+}
+
+func initSearchDomains(rules []SearchDomainRule) error {
+	compiled, err := compileSearchDomains(rules)
+	if err != nil {
+		return err
+	}
+	searchDomains = compiled
+	if len(compiled) > 0 {
+		slog.Info("Search domains enabled", "rules", len(compiled))
+	}
+	return nil
+}
+
+// searchSuffixesFor returns the suffixes of the first rule matching addr
+func searchSuffixesFor(addr net.Addr) []string {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	}
+	for _, rule := range searchDomains {
+		if len(rule.clients) == 0 {
+			return rule.suffixes
+		}
+		for _, n := range rule.clients {
+			if ip != nil && n.Contains(ip) {
+				return rule.suffixes
+			}
+		}
+	}
+	return nil
+}
+
+// captureWriter captures the answer of a query handled internally (the
+// expansion of a search domain, the target of an ALIAS)
+type captureWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *captureWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func (w *captureWriter) Unwrap() dns.ResponseWriter { return w.ResponseWriter }
+
+// searchWriter captures the answer of a name expanded with a search
+// suffix, which handleDNS never sends to the forwarders
+type searchWriter struct {
+	captureWriter
+}
+
+// searchExpansion reports whether w answers a name expanded with a search
+// suffix
+func searchExpansion(w dns.ResponseWriter) bool {
+	switch w := w.(type) {
+	case *searchWriter:
+		return true
+	case interface{ Unwrap() dns.ResponseWriter }:
+		return searchExpansion(w.Unwrap())
+	}
+	return false
+}
+
+// answerSearchDomains answers a single-label name missing from the local
+// data with the first of its expansions under the search suffixes of the
+// client that exists: a CNAME to the expanded name, followed by its
+// answer. Only suffixes served here (local zones, forward zones, hosts
+// files) are tried, and the expanded names never go to the forwarders or
+// the recursive resolver: those missing locally are NXDOMAIN. It reports
+// false when no expansion exists and nothing was sent.
+func answerSearchDomains(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg, zd *ZoneData) bool {
+	q := r.Question[0]
+	if dns.CountLabel(q.Name) != 1 {
+		return false
+	}
+	for _, suffix := range searchSuffixesFor(w.RemoteAddr()) {
+		target := strings.ToLower(q.Name) + suffix
+		res := zd.Resolve(target)
+		if _, inHosts := lookupHosts(target, q.Qtype); res.Zone == "" && len(res.Forward) == 0 && !inHosts {
+			continue
+		}
+		req := r.Copy()
+		req.Question[0].Name = target
+		rec := &searchWriter{captureWriter{ResponseWriter: w}}
+		handleDNS(rec, req)
+		if rec.msg == nil || rec.msg.Rcode != dns.RcodeSuccess {
+			continue
+		}
+		ttl := uint32(searchCNAMETTL)
+		for i, rr := range rec.msg.Answer {
+			if i == 0 || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+			}
+		}
+		m.Authoritative = false
+		m.Answer = append([]dns.RR{&dns.CNAME{
+			Hdr:    dns.RR_Header{Name: q.Name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: ttl},
+			Target: target,
+		}}, rec.msg.Answer...)
+		if err := w.WriteMsg(m); err != nil {
+			slog.Debug("failed to write search domain response", "client", w.RemoteAddr(), "error", err)
+		}
+		slog.Debug("Answered a single-label name with a search suffix", "name", q.Name, "target", target, "client", w.RemoteAddr())
+		return true
+	}
+	return false
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// tsigAlgorithms are the TSIG algorithms accepted, by their short name
+var tsigAlgorithms = map[string]string{
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha224": dns.HmacSHA224,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+// tsigKey is a TSIG key shared with secondaries
+type tsigKey struct {
+	algorithm string // canonical name, e.g. hmac-sha256.
+	secret    []byte
+}
+
+// secondaryIndex holds the secondaries of the zones and their TSIG keys
+type secondaryIndex struct {
+	byZone map[string][]DBZoneSecondary // by zone name, lowercase and qualified
+	keys   map[string]tsigKey           // by key name, lowercase and qualified
+}
+
+var zoneSecondaries atomic.Pointer[secondaryIndex]
+
+// loadZoneSecondariesFromDB indexes the secondaries of the zones
+func loadZoneSecondariesFromDB() error {
+	if database == nil {
+		return nil
+	}
+	zones, err := database.ListZones()
+	if err != nil {
+		return err
+	}
+	secondaries, err := database.ListZoneSecondaries(0)
+	if err != nil {
+		return err
+	}
+	names := make(map[int64]string, len(zones))
+	for _, z := range zones {
+		names[z.ID] = strings.ToLower(dns.Fqdn(z.Name))
+	}
+	idx := &secondaryIndex{byZone: make(map[string][]DBZoneSecondary), keys: make(map[string]tsigKey)}
+	for _, s := range secondaries {
+		name, ok := names[s.ZoneID]
+		if !ok {
+			continue
+		}
+		idx.byZone[name] = append(idx.byZone[name], s)
+		if s.TSIGKey == "" {
+			continue
+		}
+		secret, err := base64.StdEncoding.DecodeString(s.TSIGSecret)
+		if err != nil {
+			slog.Error("invalid TSIG secret in database", "key", s.TSIGKey, "error", err)
+			continue
+		}
+		idx.keys[s.TSIGKey] = tsigKey{algorithm: s.TSIGAlgorithm, secret: secret}
+	}
+	zoneSecondaries.Store(idx)
+	return nil
+}
+
+// secondariesOf returns the secondaries of zone
+func secondariesOf(zone string) []DBZoneSecondary {
+	idx := zoneSecondaries.Load()
+	if idx == nil {
+		return nil
+	}
+	return idx.byZone[strings.ToLower(dns.Fqdn(zone))]
+}
+
+// zoneSecondaryAt returns the secondary of zone at the address of addr
+func zoneSecondaryAt(zone string, addr net.Addr) (DBZoneSecondary, bool) {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		return DBZoneSecondary{}, false
+	}
+	for _, s := range secondariesOf(zone) {
+		host, _, err := net.SplitHostPort(s.Address)
+		if err == nil && net.ParseIP(host).Equal(ip) {
+			return s, true
+		}
+	}
+	return DBZoneSecondary{}, false
+}
+
+// tsigKeyring signs and verifies TSIG messages with the keys of the zone
+// secondaries as they are when the message is handled
+type tsigKeyring struct{}
+
+func (tsigKeyring) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	idx := zoneSecondaries.Load()
+	if idx == nil {
+		return nil, dns.ErrSecret
+	}
+	key, ok := idx.keys[strings.ToLower(t.Hdr.Name)]
+	if !ok {
+		return nil, dns.ErrSecret
+	}
+	if !strings.EqualFold(t.Algorithm, key.algorithm) {
+		return nil, dns.ErrKeyAlg
+	}
+	var h hash.Hash
+	switch key.algorithm {
+	case dns.HmacSHA1:
+		h = hmac.New(sha1.New, key.secret)
+	case dns.HmacSHA224:
+		h = hmac.New(sha256.New224, key.secret)
+	case dns.HmacSHA256:
+		h = hmac.New(sha256.New, key.secret)
+	case dns.HmacSHA384:
+		h = hmac.New(sha512.New384, key.secret)
+	case dns.HmacSHA512:
+		h = hmac.New(sha512.New, key.secret)
+	default:
+		return nil, dns.ErrKeyAlg
+	}
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+func (k tsigKeyring) Verify(msg []byte, t *dns.TSIG) error {
+	mac, err := k.Generate(msg, t)
+	if err != nil {
+		return err
+	}
+	got, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(mac, got) {
+		return dns.ErrSig
+	}
+	return nil
+}
+
+// notifyTarget is a server sent a NOTIFY, signed when key is set
+type notifyTarget struct {
+	addr      string
+	key       string
+	algorithm string
+}
+
+// notifyTargets returns the servers to notify of a change of zone: the
+// single addresses of allow_transfer and the secondaries of the zone
+func notifyTargets(zone string) []notifyTarget {
+	var targets []notifyTarget
+	seen := make(map[string]bool)
+	for _, s := range secondariesOf(zone) {
+		seen[s.Address] = true
+		targets = append(targets, notifyTarget{addr: s.Address, key: s.TSIGKey, algorithm: s.TSIGAlgorithm})
+	}
+	for _, n := range allowTransfer {
+		if ones, bits := n.Mask.Size(); ones == bits {
+			addr := net.JoinHostPort(n.IP.String(), "53")
+			if !seen[addr] {
+				targets = append(targets, notifyTarget{addr: addr})
+			}
+		}
+	}
+	return targets
+}
+
+// notifyChangedZones notifies the secondaries of the zones whose serial
+// differs between two snapshots
+func notifyChangedZones(prev, next *ZoneData) {
+	idx := zoneSecondaries.Load()
+	if prev == nil || idx == nil {
+		return
+	}
+	var changed []string
+	for zone := range idx.byZone {
+		before, ok := zoneSerial(prev, zone)
+		if !ok {
+			continue
+		}
+		if after, ok := zoneSerial(next, zone); ok && after != before {
+			changed = append(changed, zone)
+		}
+	}
+	notifySecondaries(changed...)
+}
+
+// normalizeZoneSecondary checks a secondary to add, qualifies its address
+// and key name and generates its secret when the key is new
+func normalizeZoneSecondary(s *DBZoneSecondary, existing []DBZoneSecondary) error {
+	addr := strings.TrimSpace(s.Address)
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = strings.Trim(addr, "[]"), "53"
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.New("the address must be an IP address, with an optional port")
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return errors.New("invalid port")
+	}
+	s.Address = net.JoinHostPort(ip.String(), port)
+
+	s.TSIGKey = strings.ToLower(strings.TrimSpace(s.TSIGKey))
+	if s.TSIGKey == "" {
+		s.TSIGAlgorithm, s.TSIGSecret = "", ""
+		return nil
+	}
+	if _, ok := dns.IsDomainName(s.TSIGKey); !ok {
+		return errors.New("invalid TSIG key name")
+	}
+	s.TSIGKey = dns.Fqdn(s.TSIGKey)
+	algorithm := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(s.TSIGAlgorithm), "."))
+	if algorithm == "" {
+		algorithm = "hmac-sha256"
+	}
+	canonical, ok := tsigAlgorithms[algorithm]
+	if !ok {
+		return errors.New("unknown TSIG algorithm (hmac-sha1, hmac-sha224, hmac-sha256, hmac-sha384 or hmac-sha512)")
+	}
+	s.TSIGAlgorithm = canonical
+	s.TSIGSecret = strings.TrimSpace(s.TSIGSecret)
+	if s.TSIGSecret != "" {
+		if secret, err := base64.StdEncoding.DecodeString(s.TSIGSecret); err != nil || len(secret) == 0 {
+			return errors.New("the TSIG secret must be base64")
+		}
+	}
+
+	// A key name has one secret, whichever zones use it
+	for _, e := range existing {
+		if e.TSIGKey != s.TSIGKey {
+			continue
+		}
+		if (s.TSIGSecret != "" && s.TSIGSecret != e.TSIGSecret) || s.TSIGAlgorithm != e.TSIGAlgorithm {
+			return errors.New("TSIG key " + s.TSIGKey + " already exists with another secret or algorithm")
+		}
+		s.TSIGSecret = e.TSIGSecret
+		return nil
+	}
+	if s.TSIGSecret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		s.TSIGSecret = base64.StdEncoding.EncodeToString(secret)
+	}
+	return nil
+}
+
+// secondaryZone returns the zone of the :id parameter, which must be
+// primary
+func secondaryZone(c *gin.Context) (*DBZone, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone id"})
+		return nil, false
+	}
+	zone, err := database.GetZone(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return nil, false
+	}
+	if zone.Type == zoneTypeForward {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a forward zone has no secondaries"})
+		return nil, false
+	}
+	return zone, true
+}
+
+// handleAPIListZoneSecondaries handles GET /api/zones/:id/secondaries. The
+// TSIG secrets are only returned when a secondary is added.
+func handleAPIListZoneSecondaries(c *gin.Context) {
+	zone, ok := secondaryZone(c)
+	if !ok {
+		return
+	}
+	secondaries, err := database.ListZoneSecondaries(zone.ID)
+	if err != nil {
+		slog.Error("failed to list zone secondaries", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list secondaries"})
+		return
+	}
+	for i := range secondaries {
+		secondaries[i].TSIGSecret = ""
+	}
+	if secondaries == nil {
+		secondaries = []DBZoneSecondary{}
+	}
+	c.JSON(http.StatusOK, secondaries)
+}
+
+// handleAPICreateZoneSecondary handles POST /api/zones/:id/secondaries
+func handleAPICreateZoneSecondary(c *gin.Context) {
+	zone, ok := secondaryZone(c)
+	if !ok {
+		return
+	}
+	var s DBZoneSecondary
+	if err := c.ShouldBindJSON(&s); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	existing, err := database.ListZoneSecondaries(0)
+	if err != nil {
+		slog.Error("failed to list zone secondaries", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add secondary"})
+		return
+	}
+	if err := normalizeZoneSecondary(&s, existing); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, e := range existing {
+		if e.ZoneID == zone.ID && e.Address == s.Address {
+			c.JSON(http.StatusConflict, gin.H{"error": "secondary already exists"})
+			return
+		}
+	}
+	s.ZoneID = zone.ID
+	if err := database.CreateZoneSecondary(&s); err != nil {
+		slog.Error("failed to add zone secondary", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add secondary"})
+		return
+	}
+	if err := loadZoneSecondariesFromDB(); err != nil {
+		slog.Error("failed to reload zone secondaries", "error", err)
+	}
+
+	// The new secondary fetches the zone right away
+	notifySecondaries(zone.Name)
+	slog.Info("Zone secondary added", "zone", zone.Name, "address", s.Address, "tsig_key", s.TSIGKey, "user", c.GetString("username"))
+	c.JSON(http.StatusCreated, s)
+}
+
+// handleAPIDeleteZoneSecondary handles DELETE /api/zones/:id/secondaries/:secondary_id
+func handleAPIDeleteZoneSecondary(c *gin.Context) {
+	zone, ok := secondaryZone(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("secondary_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid secondary id"})
+		return
+	}
+	if err := database.DeleteZoneSecondary(zone.ID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "secondary not found"})
+			return
+		}
+		slog.Error("failed to delete zone secondary", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete secondary"})
+		return
+	}
+	if err := loadZoneSecondariesFromDB(); err != nil {
+		slog.Error("failed to reload zone secondaries", "error", err)
+	}
+	slog.Info("Zone secondary removed", "zone", zone.Name, "id", id, "user", c.GetString("username"))
+	c.JSON(http.StatusOK, gin.H{"message": "secondary removed"})
+}
+
+// handleAPINotifyZoneSecondaries handles POST /api/zones/:id/notify
+func handleAPINotifyZoneSecondaries(c *gin.Context) {
+	zone, ok := secondaryZone(c)
+	if !ok {
+		return
+	}
+	targets := notifyTargets(zone.Name)
+	notifySecondaries(zone.Name)
+	c.JSON(http.StatusOK, gin.H{"notified": len(targets)})
+}
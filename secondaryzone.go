@@ -0,0 +1,592 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// secondaryCheckInterval is how often the secondary zones due for a
+// refresh are looked for
+const secondaryCheckInterval = 10 * time.Second
+
+// secondaryQueryTimeout bounds the SOA query and the transfer of a zone
+const secondaryQueryTimeout = 10 * time.Second
+
+var (
+	// secondaryDue holds the time of the next refresh of each secondary
+	// zone, by zone id; a zone missing from it is refreshed right away
+	secondaryDue   = map[int64]time.Time{}
+	secondaryDueMu sync.Mutex
+	// secondaryKick wakes the refresh loop up before its next tick
+	secondaryKick = make(chan struct{}, 1)
+	// secondaryPrimaries holds the primaries of the secondary zones, by
+	// zone name, lowercase and qualified, to accept their NOTIFYs
+	secondaryPrimaries atomic.Pointer[map[string][]string]
+)
+
+// parseZonePrimaries parses the comma-separated primaries of a secondary
+// zone (IP[:port], default port 53)
+func parseZonePrimaries(s string) ([]string, error) {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if ip := net.ParseIP(strings.Trim(p, "[]")); ip != nil {
+			p = net.JoinHostPort(ip.String(), "53")
+		}
+		host, _, err := net.SplitHostPort(p)
+		if err != nil || net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid primary %q, use IP[:port]", p)
+		}
+		out = append(out, p)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("a secondary zone needs at least one primary")
+	}
+	return out, nil
+}
+
+// loadSecondaryPrimariesFromDB indexes the primaries of the secondary zones
+func loadSecondaryPrimariesFromDB() error {
+	if database == nil {
+		return nil
+	}
+	zones, err := database.ListZones()
+	if err != nil {
+		return err
+	}
+	idx := make(map[string][]string)
+	for _, z := range zones {
+		if z.Type != zoneTypeSecondary {
+			continue
+		}
+		primaries, err := parseZonePrimaries(z.Primaries)
+		if err != nil {
+			continue
+		}
+		idx[strings.ToLower(dns.Fqdn(z.Name))] = primaries
+	}
+	secondaryPrimaries.Store(&idx)
+	return nil
+}
+
+// isZonePrimary reports whether addr is a primary of the secondary zone
+func isZonePrimary(zone string, addr net.Addr) bool {
+	idx := secondaryPrimaries.Load()
+	if idx == nil {
+		return false
+	}
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		return false
+	}
+	for _, p := range (*idx)[strings.ToLower(dns.Fqdn(zone))] {
+		host, _, _ := net.SplitHostPort(p)
+		if pip := net.ParseIP(host); pip != nil && pip.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleNotify answers a NOTIFY (RFC 1996) sent by a primary of a
+// secondary zone and refreshes the zone right away. Other NOTIFYs are
+// refused.
+func handleNotify(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	zone := ""
+	if len(r.Question) == 1 && r.Question[0].Qtype == dns.TypeSOA {
+		zone = r.Question[0].Name
+	}
+	if zone == "" || !isZonePrimary(zone, w.RemoteAddr()) {
+		m.Authoritative = false
+		m.Rcode = dns.RcodeRefused
+		if err := w.WriteMsg(m); err != nil {
+			slog.Debug("failed to write REFUSED", "client", w.RemoteAddr(), "error", err)
+		}
+		slog.Debug("Refused NOTIFY", "client", w.RemoteAddr(), "zone", zone)
+		return
+	}
+	if err := w.WriteMsg(m); err != nil {
+		slog.Debug("failed to answer NOTIFY", "client", w.RemoteAddr(), "error", err)
+	}
+	slog.Info("Received NOTIFY", "zone", zone, "primary", w.RemoteAddr())
+	if z, err := database.GetZoneByName(zone); err == nil {
+		scheduleSecondaryZone(z.ID, time.Time{})
+	}
+}
+
+// scheduleSecondaryZone sets the next refresh of a secondary zone; a zero
+// time refreshes it on the next pass of the loop, started right away
+func scheduleSecondaryZone(zoneID int64, at time.Time) {
+	secondaryDueMu.Lock()
+	if at.IsZero() {
+		delete(secondaryDue, zoneID)
+	} else {
+		secondaryDue[zoneID] = at
+	}
+	secondaryDueMu.Unlock()
+	if at.IsZero() {
+		select {
+		case secondaryKick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// nextSecondaryRefresh returns the time of the next refresh of a secondary
+// zone, zero when it is due
+func nextSecondaryRefresh(zoneID int64) time.Time {
+	secondaryDueMu.Lock()
+	defer secondaryDueMu.Unlock()
+	return secondaryDue[zoneID]
+}
+
+// startSecondaryZones refreshes the secondary zones from their primaries,
+// at the refresh interval of their SOA, or its retry interval after a
+// failure. Slaves do not transfer: they serve the copy replicated from
+// the master.
+func startSecondaryZones() {
+	go func() {
+		ticker := time.NewTicker(secondaryCheckInterval)
+		defer ticker.Stop()
+		for {
+			refreshDueSecondaryZones()
+			select {
+			case <-ticker.C:
+			case <-secondaryKick:
+			}
+		}
+	}()
+}
+
+// refreshDueSecondaryZones refreshes the secondary zones whose refresh is
+// due and reloads the zones when one of them changed
+func refreshDueSecondaryZones() {
+	if database == nil || currentServerRole() == roleSlave {
+		return
+	}
+	zones, err := database.ListZones()
+	if err != nil {
+		slog.Error("failed to list secondary zones", "error", err)
+		return
+	}
+	now := time.Now()
+	reload := false
+	for i := range zones {
+		zone := &zones[i]
+		if zone.Type != zoneTypeSecondary || !zone.Enabled {
+			continue
+		}
+		if due := nextSecondaryRefresh(zone.ID); !due.IsZero() && now.Before(due) {
+			continue
+		}
+		changed, err := refreshSecondaryZone(zone)
+		if err != nil {
+			slog.Error("failed to save secondary zone", "zone", zone.Name, "error", err)
+			continue
+		}
+		reload = reload || changed
+	}
+	if reload {
+		if err := LoadZonesFromDB(); err != nil {
+			slog.Error("failed to reload zones", "error", err)
+		}
+	}
+}
+
+// refreshSecondaryZone checks the serial of a secondary zone on its
+// primaries, transfers the zone when it changed and schedules the next
+// refresh. It reports whether the zone must be reloaded: it was
+// transferred, or the primaries did not answer and it may have expired.
+func refreshSecondaryZone(zone *DBZone) (bool, error) {
+	stored, err := database.GetSecondaryZone(zone.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		stored = &DBSecondaryZone{ZoneID: zone.ID}
+	} else if err != nil {
+		return false, err
+	}
+	current, _ := parseSecondaryRecords(zone.Name, stored.Records)
+
+	now := time.Now()
+	rrs, err := transferFromPrimaries(zone, current)
+	alertKey := "transfer " + zone.Name
+	if err != nil {
+		stored.Error = err.Error()
+		slog.Warn("failed to refresh secondary zone", "zone", zone.Name, "error", err)
+		raiseAlert(alertReplication, alertKey, "Zone transfer of "+zone.Name+" failing",
+			fmt.Sprintf("The secondary zone %s cannot be refreshed from its primaries (%s):\n%v\n\nThe zone is served until it expires.", zone.Name, zone.Primaries, err))
+	} else {
+		stored.Error = ""
+		stored.CheckedAt = now
+		resolveAlert(alertReplication, alertKey, "Zone transfer of "+zone.Name+" working again",
+			fmt.Sprintf("The secondary zone %s was refreshed from its primaries again.", zone.Name))
+		if rrs != nil {
+			stored.Records = formatSecondaryRecords(rrs)
+			stored.Serial = rrs[0].(*dns.SOA).Serial
+			stored.TransferredAt = now
+			current = rrs
+			slog.Info("Secondary zone transferred", "zone", zone.Name, "serial", stored.Serial, "records", len(rrs))
+		}
+	}
+
+	// The SOA of the copy sets the timers, the zone settings until the
+	// first transfer
+	refresh, retry := zone.Refresh, zone.Retry
+	soa := secondarySOA(current)
+	if soa != nil {
+		refresh, retry = int(soa.Refresh), int(soa.Retry)
+	}
+	wait := refresh
+	if err != nil {
+		wait = retry
+	}
+	next := now.Add(time.Duration(max(wait, 1)) * time.Second)
+	// A failing zone is checked again when it expires, to stop serving it
+	if soa != nil {
+		if expiry := secondaryZoneExpiry(stored, soa); expiry.After(now) && expiry.Before(next) {
+			next = expiry
+		}
+	}
+	scheduleSecondaryZone(zone.ID, next)
+
+	if err := database.SaveSecondaryZone(stored); err != nil {
+		return false, err
+	}
+	return rrs != nil || err != nil, nil
+}
+
+// transferFromPrimaries asks the primaries of a zone in turn for its
+// serial and transfers the zone when it is newer than the current copy
+// (IXFR, then AXFR). It returns the new zone, SOA first, or nil when the
+// copy is up to date.
+func transferFromPrimaries(zone *DBZone, current []dns.RR) ([]dns.RR, error) {
+	primaries, err := parseZonePrimaries(zone.Primaries)
+	if err != nil {
+		return nil, err
+	}
+	zoneName := dns.Fqdn(zone.Name)
+	var errs []error
+	for _, primary := range primaries {
+		serial, err := primarySerial(zoneName, primary)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", primary, err))
+			continue
+		}
+		soa := secondarySOA(current)
+		if soa != nil && !serialNewer(serial, soa.Serial) {
+			return nil, nil
+		}
+		var rrs []dns.RR
+		if soa != nil {
+			rrs, err = ixfrFromPrimary(zoneName, primary, current)
+		}
+		if soa == nil || err != nil {
+			rrs, err = axfrFromPrimary(zoneName, primary)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", primary, err))
+			continue
+		}
+		return rrs, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+// primarySerial queries the serial of a zone on a primary, which must
+// answer authoritatively
+func primarySerial(zoneName, primary string) (uint32, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(zoneName, dns.TypeSOA)
+	m.RecursionDesired = false
+	c := &dns.Client{Timeout: secondaryQueryTimeout}
+	resp, _, err := c.Exchange(m, primary)
+	if err == nil && resp.Truncated {
+		c.Net = "tcp"
+		resp, _, err = c.Exchange(m, primary)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if resp.Rcode != dns.RcodeSuccess || !resp.Authoritative {
+		return 0, fmt.Errorf("not authoritative for the zone (%s)", dns.RcodeToString[resp.Rcode])
+	}
+	for _, rr := range resp.Answer {
+		if soa, ok := rr.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, zoneName) {
+			return soa.Serial, nil
+		}
+	}
+	return 0, fmt.Errorf("no SOA in the answer")
+}
+
+// receiveTransfer runs a zone transfer request and returns all the
+// records received
+func receiveTransfer(m *dns.Msg, primary string) ([]dns.RR, error) {
+	t := &dns.Transfer{DialTimeout: secondaryQueryTimeout, ReadTimeout: secondaryQueryTimeout}
+	ch, err := t.In(m, primary)
+	if err != nil {
+		return nil, err
+	}
+	var rrs []dns.RR
+	for env := range ch {
+		if env.Error != nil {
+			return nil, env.Error
+		}
+		rrs = append(rrs, env.RR...)
+	}
+	return rrs, nil
+}
+
+// axfrFromPrimary transfers a whole zone, SOA first
+func axfrFromPrimary(zoneName, primary string) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	m.SetAxfr(zoneName)
+	rrs, err := receiveTransfer(m, primary)
+	if err != nil {
+		return nil, err
+	}
+	if len(rrs) < 2 || secondarySOA(rrs) == nil || rrs[len(rrs)-1].Header().Rrtype != dns.TypeSOA {
+		return nil, fmt.Errorf("incomplete zone transfer")
+	}
+	return rrs[:len(rrs)-1], nil
+}
+
+// ixfrFromPrimary transfers the changes of a zone since the current copy
+// (RFC 1995) and applies them. A primary without the history of the zone
+// sends it whole, as for an AXFR.
+func ixfrFromPrimary(zoneName, primary string, current []dns.RR) ([]dns.RR, error) {
+	soa := secondarySOA(current)
+	m := new(dns.Msg)
+	m.SetIxfr(zoneName, soa.Serial, soa.Ns, soa.Mbox)
+	rrs, err := receiveTransfer(m, primary)
+	if err != nil {
+		return nil, err
+	}
+	latest := secondarySOA(rrs)
+	if latest == nil {
+		return nil, fmt.Errorf("incomplete zone transfer")
+	}
+	// A lone SOA means the primary has nothing newer to send
+	if len(rrs) == 1 || rrs[len(rrs)-1].Header().Rrtype != dns.TypeSOA {
+		return nil, fmt.Errorf("incomplete zone transfer")
+	}
+	first, ok := rrs[1].(*dns.SOA)
+	if !ok || first.Serial != soa.Serial || len(rrs) == 2 {
+		// A whole zone
+		return rrs[:len(rrs)-1], nil
+	}
+
+	// Sequences of deletions, starting with the old SOA, then additions,
+	// starting with the new SOA
+	records := make(map[string]dns.RR, len(current))
+	var order []string
+	for _, rr := range current[1:] {
+		key := transferRRKey(rr)
+		records[key] = rr
+		order = append(order, key)
+	}
+	adding := true
+	for _, rr := range rrs[1 : len(rrs)-1] {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			adding = !adding
+			continue
+		}
+		key := transferRRKey(rr)
+		if !adding {
+			delete(records, key)
+			continue
+		}
+		if _, ok := records[key]; !ok {
+			order = append(order, key)
+		}
+		records[key] = rr
+	}
+	out := []dns.RR{latest}
+	for _, key := range order {
+		if rr, ok := records[key]; ok {
+			out = append(out, rr)
+			delete(records, key)
+		}
+	}
+	return out, nil
+}
+
+// transferRRKey identifies a record by its name, type and data, whatever
+// its TTL, as the deletions of an IXFR do
+func transferRRKey(rr dns.RR) string {
+	rr = dns.Copy(rr)
+	rr.Header().Ttl = 0
+	rr.Header().Name = strings.ToLower(rr.Header().Name)
+	return rr.String()
+}
+
+// secondarySOA returns the SOA heading the records of a zone, nil if
+// there is none
+func secondarySOA(rrs []dns.RR) *dns.SOA {
+	if len(rrs) == 0 {
+		return nil
+	}
+	soa, _ := rrs[0].(*dns.SOA)
+	return soa
+}
+
+// formatSecondaryRecords writes the records of a zone in zone file format
+func formatSecondaryRecords(rrs []dns.RR) string {
+	var b strings.Builder
+	for _, rr := range rrs {
+		b.WriteString(rr.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// parseSecondaryRecords parses the stored copy of a secondary zone
+func parseSecondaryRecords(zoneName, text string) ([]dns.RR, error) {
+	zp := dns.NewZoneParser(strings.NewReader(text), dns.Fqdn(zoneName), "")
+	var rrs []dns.RR
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	return rrs, zp.Err()
+}
+
+// secondaryZoneExpiry returns the time a copy expires, the SOA expire
+// after the primary last confirmed it
+func secondaryZoneExpiry(stored *DBSecondaryZone, soa *dns.SOA) time.Time {
+	return stored.CheckedAt.Add(time.Duration(soa.Expire) * time.Second)
+}
+
+// addSecondaryZoneRecords serves the copy of a secondary zone. A zone
+// never transferred, or not confirmed by a primary within the expire
+// interval of its SOA, is not served.
+func addSecondaryZoneRecords(zd *ZoneData, dbZone DBZone) []ZoneProblem {
+	zoneName := dns.Fqdn(dbZone.Name)
+	stored, err := database.GetSecondaryZone(dbZone.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return []ZoneProblem{{Severity: severityWarning, Zone: zoneName, Message: "not transferred from its primaries yet"}}
+	} else if err != nil {
+		return []ZoneProblem{{Severity: severityError, Zone: zoneName, Message: "cannot read the secondary zone: " + err.Error()}}
+	}
+	rrs, err := parseSecondaryRecords(zoneName, stored.Records)
+	soa := secondarySOA(rrs)
+	if err != nil || soa == nil {
+		return []ZoneProblem{{Severity: severityWarning, Zone: zoneName, Message: "not transferred from its primaries yet"}}
+	}
+	if time.Now().After(secondaryZoneExpiry(stored, soa)) {
+		return []ZoneProblem{{Severity: severityError, Zone: zoneName, Message: "expired, the primaries did not answer since " + stored.CheckedAt.Format(time.RFC3339)}}
+	}
+	zd.AddZone(zoneName)
+	for _, rr := range rrs {
+		zd.AddRR(rr)
+	}
+	return nil
+}
+
+// SecondaryZoneStatus is the state of the copy of a secondary zone
+type SecondaryZoneStatus struct {
+	DBSecondaryZone
+	Primaries   []string   `json:"primaries"`
+	RecordCount int        `json:"record_count"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	NextRefresh *time.Time `json:"next_refresh,omitempty"`
+}
+
+// secondaryZoneStatus returns the state of the copy of a secondary zone
+func secondaryZoneStatus(zone *DBZone) (*SecondaryZoneStatus, error) {
+	status := &SecondaryZoneStatus{DBSecondaryZone: DBSecondaryZone{ZoneID: zone.ID}}
+	status.Primaries, _ = parseZonePrimaries(zone.Primaries)
+	stored, err := database.GetSecondaryZone(zone.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return status, nil
+	} else if err != nil {
+		return nil, err
+	}
+	status.DBSecondaryZone = *stored
+	rrs, _ := parseSecondaryRecords(zone.Name, stored.Records)
+	status.RecordCount = len(rrs)
+	if soa := secondarySOA(rrs); soa != nil {
+		expires := secondaryZoneExpiry(stored, soa)
+		status.ExpiresAt = &expires
+	}
+	if next := nextSecondaryRefresh(zone.ID); !next.IsZero() {
+		status.NextRefresh = &next
+	}
+	return status, nil
+}
+
+// transferZone returns the secondary zone of the request, answering an
+// error if there is none
+func transferZone(c *gin.Context) (*DBZone, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone id"})
+		return nil, false
+	}
+	zone, err := database.GetZone(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return nil, false
+	}
+	if zone.Type != zoneTypeSecondary {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "not a secondary zone"})
+		return nil, false
+	}
+	return zone, true
+}
+
+// handleAPIGetZoneTransfer handles GET /api/zones/:id/transfer, the state
+// of the copy of a secondary zone
+func handleAPIGetZoneTransfer(c *gin.Context) {
+	zone, ok := transferZone(c)
+	if !ok {
+		return
+	}
+	status, err := secondaryZoneStatus(zone)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read the secondary zone"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// handleAPITransferZone handles POST /api/zones/:id/transfer: the
+// secondary zone is refreshed from its primaries now
+func handleAPITransferZone(c *gin.Context) {
+	zone, ok := transferZone(c)
+	if !ok {
+		return
+	}
+	if _, err := refreshSecondaryZone(zone); err != nil {
+		slog.Error("failed to save secondary zone", "zone", zone.Name, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save the secondary zone"})
+		return
+	}
+	if err := LoadZonesFromDB(); err != nil {
+		slog.Error("failed to reload zones", "error", err)
+	}
+	status, err := secondaryZoneStatus(zone)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read the secondary zone"})
+		return
+	}
+	slog.Info("Secondary zone refreshed", "zone", zone.Name, "serial", status.Serial, "user", c.GetString("username"))
+	c.JSON(http.StatusOK, status)
+}
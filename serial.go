@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// SOA serial formats
+const (
+	serialIncrement = "increment" // 1, 2, 3, ...
+	serialDate      = "date"      // YYYYMMDDnn (RFC 1912)
+)
+
+// serialFormat selects how zone serials are bumped on every change
+var serialFormat = serialIncrement
+
+// dateSerialBase returns YYYYMMDD00 for t
+func dateSerialBase(t time.Time) int {
+	base, _ := strconv.Atoi(t.UTC().Format("20060102"))
+	return base * 100
+}
+
+// initialSerial returns the serial of a new zone
+func initialSerial() int {
+	if serialFormat == serialDate {
+		return dateSerialBase(time.Now())
+	}
+	return 1
+}
+
+// nextSerial returns the serial following current. Date serials never go
+// backwards: after 99 changes in a day they continue into the next day's
+// range, and switching from increment jumps straight to today's date.
+func nextSerial(current int) int {
+	next := current + 1
+	if serialFormat == serialDate {
+		next = max(next, dateSerialBase(time.Now()))
+	}
+	return next
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// SinkholeConfig answers blocked names with the address of the server,
+// whose HTTP listeners then show a page explaining the block
+type SinkholeConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// IPv4 and IPv6 are the addresses answered for blocked names; IPv4
+	// defaults to the outbound address of the server, without IPv6 AAAA
+	// queries get an empty answer
+	IPv4 string `yaml:"ipv4" json:"ipv4,omitempty"`
+	IPv6 string `yaml:"ipv6" json:"ipv6,omitempty"`
+	TTL  int    `yaml:"ttl" json:"ttl,omitempty"` // default 60
+	// Domains are blocked with all their subdomains
+	Domains []string `yaml:"domains" json:"domains,omitempty"`
+	// Lists are files or http(s) URLs in hosts, plain domain or adblock
+	// (||domain^) format
+	Lists        []string `yaml:"lists" json:"lists,omitempty"`
+	RefreshHours int      `yaml:"refresh_hours" json:"refresh_hours,omitempty"` // default 24
+	// PagePort starts a plain HTTP listener serving only the block page,
+	// usually 80 when the web interface runs on another port
+	PagePort int `yaml:"page_port" json:"page_port,omitempty"`
+}
+
+// sinkholeDomainsConfigKey stores the domains added in the web UI, on top
+// of the domains and lists of the config file
+const sinkholeDomainsConfigKey = "sinkhole_domains"
+
+const (
+	sinkholeTopHits     = 1000
+	sinkholeListTimeout = 30 * time.Second
+)
+
+// SinkholeList is the last load of one blocklist
+type SinkholeList struct {
+	Source   string    `json:"source"`
+	Domains  int       `json:"domains"`
+	Error    string    `json:"error,omitempty"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// sinkholeState is the sinkhole in effect. names holds the lowercased
+// FQDNs blocked, from the config, the web UI and the lists, each with the
+// bits of the sources blocking it (see sourceBit) so a client can be
+// blocked by some sources only.
+type sinkholeState struct {
+	cfg        SinkholeConfig
+	ipv4, ipv6 net.IP
+	ttl        uint32
+	custom     []string
+	listNames  map[string][]string // by list
+	lists      []SinkholeList
+	names      map[string]uint64
+}
+
+// sinkholeDomainsSource names the domains of the config file and the web
+// UI among the blocking sources, next to the lists
+const sinkholeDomainsSource = "domains"
+
+// sinkholeAllSources is the mask of a client blocked by every source
+const sinkholeAllSources = ^uint64(0)
+
+// sourceBit returns the bit of a blocking source: the domains, or a list
+// of the config (the lists past the 62nd share the last bit). It returns
+// 0 for an unknown source.
+func (s *sinkholeState) sourceBit(source string) uint64 {
+	if source == sinkholeDomainsSource {
+		return 1
+	}
+	for i, list := range s.cfg.Lists {
+		if list == source {
+			return 1 << (min(i, 62) + 1)
+		}
+	}
+	return 0
+}
+
+// sinkholeSources returns the blocking sources a client can be limited to,
+// none when the sinkhole is disabled
+func sinkholeSources() []string {
+	s := sinkhole.Load()
+	if s == nil {
+		return []string{}
+	}
+	return append([]string{sinkholeDomainsSource}, s.cfg.Lists...)
+}
+
+var (
+	sinkhole atomic.Pointer[sinkholeState]
+	// sinkholeMu serializes the updates of the state
+	sinkholeMu sync.Mutex
+
+	sinkholeHitsMu sync.Mutex
+	sinkholeHits   = newTopCounter(sinkholeTopHits)
+	sinkholeTotal  atomic.Uint64
+)
+
+// normalizeSinkholeDomain returns domain as a lowercased FQDN, or an error
+// when it is not a domain name
+func normalizeSinkholeDomain(domain string) (string, error) {
+	name := strings.ToLower(dns.Fqdn(strings.TrimSpace(domain)))
+	if _, ok := dns.IsDomainName(name); !ok || name == "." {
+		return "", fmt.Errorf("invalid domain %q", domain)
+	}
+	return name, nil
+}
+
+// parseBlocklist reads the domains of a list. Lines are hosts entries
+// (0.0.0.0 ads.example.com), plain domains or adblock rules (||domain^);
+// comments, single-label names and adblock rules with options are skipped.
+func parseBlocklist(r io.Reader) ([]string, error) {
+	var domains []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '!' || line[0] == '[' {
+			continue
+		}
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		var names []string
+		if rule, ok := strings.CutPrefix(line, "||"); ok {
+			name, rest, _ := strings.Cut(rule, "^")
+			if strings.TrimSpace(rest) != "" {
+				continue
+			}
+			names = []string{name}
+		} else {
+			fields := strings.Fields(line)
+			if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+				names = fields[1:]
+			} else if len(fields) == 1 {
+				names = fields
+			}
+		}
+		for _, name := range names {
+			if !strings.Contains(strings.Trim(name, "."), ".") {
+				continue
+			}
+			if fqdn, err := normalizeSinkholeDomain(name); err == nil {
+				domains = append(domains, fqdn)
+			}
+		}
+	}
+	return domains, scanner.Err()
+}
+
+// fetchBlocklist reads a list from a file or an http(s) URL
+func fetchBlocklist(source string) ([]string, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		client := &http.Client{Timeout: sinkholeListTimeout}
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("HTTP %s", resp.Status)
+		}
+		return parseBlocklist(resp.Body)
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return parseBlocklist(f)
+}
+
+// loadBlocklists fetches every list. A list that fails keeps the domains
+// of its previous load so a network error does not unblock them.
+func loadBlocklists(sources []string, previous *sinkholeState) (map[string][]string, []SinkholeList) {
+	names := make(map[string][]string, len(sources))
+	lists := make([]SinkholeList, 0, len(sources))
+	for _, source := range sources {
+		list := SinkholeList{Source: source, LoadedAt: time.Now().UTC()}
+		domains, err := fetchBlocklist(source)
+		alertKey := "blocklist " + source
+		if err != nil {
+			slog.Warn("failed to load blocklist", "list", source, "error", err)
+			raiseAlert(alertBlocklist, alertKey, "Blocklist update failing",
+				fmt.Sprintf("The blocklist %s cannot be loaded:\n%v\n\nThe domains of its previous load stay blocked.", source, err))
+			list.Error = err.Error()
+			if previous != nil {
+				domains = previous.listNames[source]
+				for _, l := range previous.lists {
+					if l.Source == source && l.Error == "" {
+						list.LoadedAt = l.LoadedAt
+					}
+				}
+			}
+		} else {
+			resolveAlert(alertBlocklist, alertKey, "Blocklist updated again",
+				fmt.Sprintf("The blocklist %s was loaded again (%d domains).", source, len(domains)))
+		}
+		list.Domains = len(domains)
+		names[source] = domains
+		lists = append(lists, list)
+	}
+	return names, lists
+}
+
+func newSinkholeState(cfg SinkholeConfig, custom []string, listNames map[string][]string, lists []SinkholeList) (*sinkholeState, error) {
+	s := &sinkholeState{cfg: cfg, ttl: 60, custom: custom, listNames: listNames, lists: lists}
+	if cfg.TTL > 0 {
+		s.ttl = uint32(cfg.TTL)
+	}
+	if cfg.IPv4 != "" {
+		if s.ipv4 = net.ParseIP(cfg.IPv4).To4(); s.ipv4 == nil {
+			return nil, fmt.Errorf("ipv4 %q is not an IPv4 address", cfg.IPv4)
+		}
+	}
+	if cfg.IPv6 != "" {
+		if s.ipv6 = net.ParseIP(cfg.IPv6); s.ipv6 == nil || s.ipv6.To4() != nil {
+			return nil, fmt.Errorf("ipv6 %q is not an IPv6 address", cfg.IPv6)
+		}
+	}
+	if s.ipv4 == nil && s.ipv6 == nil {
+		s.ipv4 = net.ParseIP(getOutboundIP()).To4()
+	}
+
+	s.names = make(map[string]uint64, len(cfg.Domains)+len(custom))
+	for _, group := range [][]string{cfg.Domains, custom} {
+		for _, d := range group {
+			name, err := normalizeSinkholeDomain(d)
+			if err != nil {
+				return nil, err
+			}
+			s.names[name] |= s.sourceBit(sinkholeDomainsSource)
+		}
+	}
+	for source, domains := range listNames {
+		bit := s.sourceBit(source)
+		for _, name := range domains {
+			s.names[name] |= bit
+		}
+	}
+	return s, nil
+}
+
+// match returns the domain covering name blocked by one of the sources of
+// mask, "" if it is not blocked
+func (s *sinkholeState) match(name string, mask uint64) string {
+	name = strings.ToLower(dns.Fqdn(name))
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if s.names[name[off:]]&mask != 0 {
+			return name[off:]
+		}
+	}
+	return ""
+}
+
+// loadSinkholeDomainsFromDB returns the domains added in the web UI
+func loadSinkholeDomainsFromDB() []string {
+	if database == nil {
+		return nil
+	}
+	v, err := database.GetConfig(sinkholeDomainsConfigKey)
+	if err != nil || v == "" {
+		return nil
+	}
+	var domains []string
+	if err := json.Unmarshal([]byte(v), &domains); err != nil {
+		slog.Error("invalid sinkhole domains in database", "error", err)
+		return nil
+	}
+	return domains
+}
+
+// refreshSinkhole reloads the lists and rebuilds the state
+func refreshSinkhole() {
+	sinkholeMu.Lock()
+	defer sinkholeMu.Unlock()
+	current := sinkhole.Load()
+	if current == nil {
+		return
+	}
+	listNames, lists := loadBlocklists(current.cfg.Lists, current)
+	s, err := newSinkholeState(current.cfg, current.custom, listNames, lists)
+	if err != nil {
+		slog.Error("failed to refresh the sinkhole", "error", err)
+		return
+	}
+	sinkhole.Store(s)
+	slog.Info("Sinkhole lists loaded", "lists", len(lists), "blocked", len(s.names))
+}
+
+// startSinkhole loads the blocked domains, refreshes the lists
+// periodically and starts the block page listener when page_port is set
+func startSinkhole(cfg SinkholeConfig) (*http.Server, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	s, err := newSinkholeState(cfg, loadSinkholeDomainsFromDB(), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	sinkhole.Store(s)
+	slog.Info("Sinkhole enabled", "ipv4", s.ipv4, "ipv6", s.ipv6, "domains", len(s.names), "lists", len(cfg.Lists))
+
+	if len(cfg.Lists) > 0 {
+		interval := 24 * time.Hour
+		if cfg.RefreshHours > 0 {
+			interval = time.Duration(cfg.RefreshHours) * time.Hour
+		}
+		go func() {
+			refreshSinkhole()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				refreshSinkhole()
+			}
+		}()
+	}
+
+	if cfg.PagePort <= 0 {
+		return nil, nil
+	}
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.PagePort),
+		Handler:           http.HandlerFunc(serveBlockPage),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		slog.Info("Starting sinkhole block page server", "addr", server.Addr)
+		if err := serveWeb(server, false); err != nil && err != http.ErrServerClosed {
+			slog.Error("failed to start sinkhole block page server", "error", err)
+		}
+	}()
+	return server, nil
+}
+
+// lookupSinkhole returns the answer for a blocked name and whether the name
+// is blocked for the client: the sinkhole address for A and AAAA, nothing
+// for other types
+func lookupSinkhole(name string, qtype uint16, client net.Addr) ([]dns.RR, bool) {
+	s := sinkhole.Load()
+	if s == nil {
+		return nil, false
+	}
+	domain := s.match(name, clientBlockingMask(client, s))
+	if domain == "" {
+		return nil, false
+	}
+	sinkholeTotal.Add(1)
+	sinkholeHitsMu.Lock()
+	sinkholeHits.Add(strings.TrimSuffix(domain, "."), 1)
+	sinkholeHitsMu.Unlock()
+
+	var answers []dns.RR
+	if s.ipv4 != nil && (qtype == dns.TypeA || qtype == dns.TypeANY) {
+		answers = append(answers, &dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: s.ttl}, A: s.ipv4})
+	}
+	if s.ipv6 != nil && (qtype == dns.TypeAAAA || qtype == dns.TypeANY) {
+		answers = append(answers, &dns.AAAA{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: s.ttl}, AAAA: s.ipv6})
+	}
+	return answers, true
+}
+
+// sinkholedName returns the blocked domain covering name without counting
+// a hit, "" when it is not blocked
+func sinkholedName(name string) string {
+	s := sinkhole.Load()
+	if s == nil {
+		return ""
+	}
+	return s.match(name, sinkholeAllSources)
+}
+
+// sinkholedHost returns the blocked domain covering the host of an HTTP
+// request, "" when it is not blocked
+func sinkholedHost(hostport string) string {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	if host == "" || net.ParseIP(host) != nil {
+		return ""
+	}
+	return sinkholedName(host)
+}
+
+// serveBlockPage writes the page explaining why the site is blocked
+func serveBlockPage(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	data := struct {
+		Host   string
+		Domain string
+	}{
+		Host:   host,
+		Domain: strings.TrimSuffix(sinkholedHost(r.Host), "."),
+	}
+	tmpl := template.Must(template.New("blocked").Parse(sinkholePageHTML))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusForbidden)
+	if err := tmpl.Execute(w, data); err != nil {
+		slog.Error("failed to render template", "error", err)
+	}
+}
+
+// SinkholePageMiddleware serves the block page instead of the web interface
+// to browsers sent here by a blocked name
+func SinkholePageMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if sinkholedHost(c.Request.Host) != "" {
+			serveBlockPage(c.Writer, c.Request)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// SinkholeStatus is the sinkhole configuration and its hits since start
+type SinkholeStatus struct {
+	Enabled bool   `json:"enabled"`
+	IPv4    string `json:"ipv4,omitempty"`
+	IPv6    string `json:"ipv6,omitempty"`
+	// Domains come from the config file, CustomDomains from the web UI
+	Domains       []string       `json:"domains"`
+	CustomDomains []string       `json:"custom_domains"`
+	Lists         []SinkholeList `json:"lists"`
+	Blocked       int            `json:"blocked"` // distinct domains blocked
+	Hits          uint64         `json:"hits"`
+	TopHits       []TopEntry     `json:"top_hits"`
+}
+
+func sinkholeStatus(top int) SinkholeStatus {
+	status := SinkholeStatus{Domains: []string{}, CustomDomains: []string{}, Lists: []SinkholeList{}}
+	s := sinkhole.Load()
+	if s == nil {
+		status.TopHits = []TopEntry{}
+		return status
+	}
+	status.Enabled = true
+	if s.ipv4 != nil {
+		status.IPv4 = s.ipv4.String()
+	}
+	if s.ipv6 != nil {
+		status.IPv6 = s.ipv6.String()
+	}
+	if s.cfg.Domains != nil {
+		status.Domains = s.cfg.Domains
+	}
+	if s.custom != nil {
+		status.CustomDomains = s.custom
+	}
+	status.Lists = append(status.Lists, s.lists...)
+	if len(s.lists) == 0 {
+		for _, source := range s.cfg.Lists {
+			status.Lists = append(status.Lists, SinkholeList{Source: source})
+		}
+	}
+	status.Blocked = len(s.names)
+	status.Hits = sinkholeTotal.Load()
+	sinkholeHitsMu.Lock()
+	status.TopHits = sinkholeHits.Top(top)
+	sinkholeHitsMu.Unlock()
+	return status
+}
+
+// handleAPISinkhole handles GET /api/sinkhole (?top=20)
+func handleAPISinkhole(c *gin.Context) {
+	top, err := strconv.Atoi(c.DefaultQuery("top", "20"))
+	if err != nil || top <= 0 || top > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid top"})
+		return
+	}
+	c.JSON(http.StatusOK, sinkholeStatus(top))
+}
+
+// handleAPISetSinkholeDomains handles PUT /api/sinkhole/domains
+func handleAPISetSinkholeDomains(c *gin.Context) {
+	var domains []string
+	if err := c.ShouldBindJSON(&domains); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	seen := make(map[string]bool)
+	custom := []string{}
+	for _, d := range domains {
+		name, err := normalizeSinkholeDomain(d)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if name = strings.TrimSuffix(name, "."); !seen[name] {
+			seen[name] = true
+			custom = append(custom, name)
+		}
+	}
+	sort.Strings(custom)
+
+	data, _ := json.Marshal(custom)
+	if err := database.SetConfig(sinkholeDomainsConfigKey, string(data)); err != nil {
+		slog.Error("failed to save sinkhole domains", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save sinkhole domains"})
+		return
+	}
+	sinkholeMu.Lock()
+	if current := sinkhole.Load(); current != nil {
+		if s, err := newSinkholeState(current.cfg, custom, current.listNames, current.lists); err == nil {
+			sinkhole.Store(s)
+		}
+	}
+	sinkholeMu.Unlock()
+
+	slog.Info("Sinkhole domains updated", "domains", len(custom), "user", c.GetString("username"))
+	c.JSON(http.StatusOK, sinkholeStatus(20))
+}
+
+// handleAPIRefreshSinkhole handles POST /api/sinkhole/refresh
+func handleAPIRefreshSinkhole(c *gin.Context) {
+	if sinkhole.Load() == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "sinkhole is not enabled"})
+		return
+	}
+	refreshSinkhole()
+	c.JSON(http.StatusOK, sinkholeStatus(20))
+}
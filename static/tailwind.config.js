@@ -0,0 +1,26 @@
+// Tailwind configuration used by scripts/fetch-assets.sh to build
+// static/vendor/tailwind.css; keep it in line with tailwind.config in
+// headHTML (templates.go), used when the stylesheet is not embedded.
+module.exports = {
+    content: ['./*.go'],
+    darkMode: 'class',
+    theme: {
+        extend: {
+            colors: {
+                brand: {
+                    50: '#eff6ff',
+                    100: '#dbeafe',
+                    200: '#bfdbfe',
+                    300: '#93c5fd',
+                    400: '#60a5fa',
+                    500: '#3b82f6',
+                    600: '#2563eb',
+                    700: '#1d4ed8',
+                    800: '#1e40af',
+                    900: '#1e3a8a',
+                    950: '#172554',
+                },
+            }
+        }
+    }
+}
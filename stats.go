@@ -0,0 +1,332 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// Query sources, for the local vs forwarded ratio
+const (
+	sourceLocal     = "local"
+	sourceForwarded = "forwarded"
+	sourceCached    = "cached"
+)
+
+// statsWindow is how far back the per-minute history goes
+const statsWindow = 24 * time.Hour
+
+// statsTopSize bounds the name and client counters
+const statsTopSize = 4096
+
+// statsRcodes are the rcodes counted individually, the others are "OTHER"
+var statsRcodes = []int{dns.RcodeSuccess, dns.RcodeFormatError, dns.RcodeServerFailure, dns.RcodeNameError, dns.RcodeNotImplemented, dns.RcodeRefused}
+
+// statsBucket aggregates the queries of one minute
+type statsBucket struct {
+	minute    int64 // unix time / 60
+	total     uint64
+	local     uint64
+	forwarded uint64
+	cached    uint64
+	rcodes    [7]uint64 // statsRcodes, then other
+}
+
+// topCounter counts keys with bounded memory. When full, every count is
+// halved and the keys left at zero are dropped, so one-off names (random
+// subdomains) do not push out the busy ones.
+type topCounter struct {
+	counts map[string]uint64
+	max    int
+}
+
+func newTopCounter(max int) *topCounter {
+	return &topCounter{counts: make(map[string]uint64), max: max}
+}
+
+func (t *topCounter) Add(key string, n uint64) {
+	if _, ok := t.counts[key]; !ok && len(t.counts) >= t.max {
+		for k, v := range t.counts {
+			if v /= 2; v == 0 {
+				delete(t.counts, k)
+			} else {
+				t.counts[k] = v
+			}
+		}
+	}
+	t.counts[key] += n
+}
+
+// TopEntry is a key and its count
+type TopEntry struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+}
+
+// Top returns the n keys with the highest counts
+func (t *topCounter) Top(n int) []TopEntry {
+	entries := make([]TopEntry, 0, len(t.counts))
+	for k, v := range t.counts {
+		entries = append(entries, TopEntry{Key: k, Count: v})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// QueryStats aggregates answered queries in a ring of per-minute buckets
+// plus top name and client counters, so the analytics page never needs the
+// raw query log
+type QueryStats struct {
+	mu      sync.Mutex
+	buckets []statsBucket
+	names   *topCounter
+	clients *topCounter
+	totals  statsBucket // since start
+	started time.Time
+}
+
+// NewQueryStats returns an empty stats store
+func NewQueryStats() *QueryStats {
+	return &QueryStats{
+		buckets: make([]statsBucket, int(statsWindow/time.Minute)),
+		names:   newTopCounter(statsTopSize),
+		clients: newTopCounter(statsTopSize),
+		started: time.Now(),
+	}
+}
+
+var queryStats = NewQueryStats()
+
+// bucket returns the bucket of minute, resetting it if it holds an older one
+func (s *QueryStats) bucket(minute int64) *statsBucket {
+	b := &s.buckets[minute%int64(len(s.buckets))]
+	if b.minute != minute {
+		*b = statsBucket{minute: minute}
+	}
+	return b
+}
+
+// Record counts one answered query
+func (s *QueryStats) Record(at time.Time, client, name string, rcode int, source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slot := len(statsRcodes)
+	for i, rc := range statsRcodes {
+		if rc == rcode {
+			slot = i
+			break
+		}
+	}
+	for _, b := range []*statsBucket{s.bucket(at.Unix() / 60), &s.totals} {
+		b.total++
+		switch source {
+		case sourceForwarded:
+			b.forwarded++
+		case sourceCached:
+			b.cached++
+		default:
+			b.local++
+		}
+		b.rcodes[slot]++
+	}
+
+	if name != "" {
+		s.names.Add(strings.ToLower(dns.Fqdn(name)), 1)
+	}
+	if client != "" {
+		s.clients.Add(client, 1)
+	}
+}
+
+// Totals returns the query counters since start, by source and rcode
+func (s *QueryStats) Totals() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	totals := map[string]uint64{
+		"total":         s.totals.total,
+		sourceLocal:     s.totals.local,
+		sourceForwarded: s.totals.forwarded,
+		sourceCached:    s.totals.cached,
+	}
+	for i, n := range s.totals.rcodes {
+		name := "other"
+		if i < len(statsRcodes) {
+			name = strings.ToLower(dns.RcodeToString[statsRcodes[i]])
+		}
+		totals["rcode_"+name] = n
+	}
+	return totals
+}
+
+// StatsPoint is the query count of one minute
+type StatsPoint struct {
+	Time      int64  `json:"time"`
+	Total     uint64 `json:"total"`
+	Local     uint64 `json:"local"`
+	Forwarded uint64 `json:"forwarded"`
+	Cached    uint64 `json:"cached"`
+}
+
+// StatsReport is the analytics summary over a time window
+type StatsReport struct {
+	Minutes    int               `json:"minutes"`
+	Total      uint64            `json:"total"`
+	QPS        float64           `json:"qps"` // over the last complete minute
+	Series     []StatsPoint      `json:"series"`
+	Sources    map[string]uint64 `json:"sources"`
+	Rcodes     map[string]uint64 `json:"rcodes"`
+	TopNames   []TopEntry        `json:"top_names"`
+	TopClients []TopEntry        `json:"top_clients"`
+	Since      time.Time         `json:"since"`
+}
+
+// Report summarizes the last minutes (at most the 24h window)
+func (s *QueryStats) Report(now time.Time, minutes, top int) StatsReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	minutes = max(1, min(minutes, len(s.buckets)))
+	report := StatsReport{
+		Minutes:    minutes,
+		Sources:    map[string]uint64{sourceLocal: 0, sourceForwarded: 0, sourceCached: 0},
+		Rcodes:     make(map[string]uint64),
+		TopNames:   s.names.Top(top),
+		TopClients: s.clients.Top(top),
+		Since:      s.started,
+	}
+
+	current := now.Unix() / 60
+	for minute := current - int64(minutes) + 1; minute <= current; minute++ {
+		point := StatsPoint{Time: minute * 60}
+		if b := &s.buckets[minute%int64(len(s.buckets))]; b.minute == minute {
+			point.Total, point.Local, point.Forwarded, point.Cached = b.total, b.local, b.forwarded, b.cached
+			for i, n := range b.rcodes {
+				if n == 0 {
+					continue
+				}
+				name := "OTHER"
+				if i < len(statsRcodes) {
+					name = dns.RcodeToString[statsRcodes[i]]
+				}
+				report.Rcodes[name] += n
+			}
+			if minute == current-1 {
+				report.QPS = float64(b.total) / 60
+			}
+		}
+		report.Total += point.Total
+		report.Sources[sourceLocal] += point.Local
+		report.Sources[sourceForwarded] += point.Forwarded
+		report.Sources[sourceCached] += point.Cached
+		report.Series = append(report.Series, point)
+	}
+	return report
+}
+
+// statsWriter records the rcode of the first reply written, the source set
+// by the handler and whether the name was blocked
+type statsWriter struct {
+	dns.ResponseWriter
+	rcode   int
+	written bool
+	source  string
+	blocked bool
+}
+
+func (s *statsWriter) WriteMsg(m *dns.Msg) error {
+	if !s.written {
+		s.rcode = m.Rcode
+		s.written = true
+	}
+	return s.ResponseWriter.WriteMsg(m)
+}
+
+// setQuerySource marks where the answer to the current query came from
+func setQuerySource(w dns.ResponseWriter, source string) {
+	switch w := w.(type) {
+	case *statsWriter:
+		w.source = source
+	case interface{ Unwrap() dns.ResponseWriter }:
+		setQuerySource(w.Unwrap(), source)
+	}
+}
+
+// markQueryBlocked marks the current query as answered by the sinkhole
+func markQueryBlocked(w dns.ResponseWriter) {
+	switch w := w.(type) {
+	case *statsWriter:
+		w.blocked = true
+	case interface{ Unwrap() dns.ResponseWriter }:
+		markQueryBlocked(w.Unwrap())
+	}
+}
+
+// withStats wraps a DNS handler to feed queryStats and the live query feed
+func withStats(next dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		sw := &statsWriter{ResponseWriter: w, source: sourceLocal}
+		start := time.Now()
+		next(sw, r)
+		if !sw.written {
+			return
+		}
+		name := ""
+		if len(r.Question) > 0 {
+			name = r.Question[0].Name
+		}
+		client := clientHost(w.RemoteAddr())
+		now := time.Now()
+		queryStats.Record(now, client, name, sw.rcode, sw.source)
+		clientStats.Record(now, client, name, sw.blocked)
+		recordQueryEvent(now, client, r, sw.rcode, sw.source, now.Sub(start))
+	}
+}
+
+// handleAPIStats returns the analytics summary (?minutes=60&top=10), or
+// with ?hours=720 the hourly rollups kept in the database (sqlite mode)
+func handleAPIStats(c *gin.Context) {
+	minutes, err := strconv.Atoi(c.DefaultQuery("minutes", "60"))
+	if err != nil || minutes <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid minutes"})
+		return
+	}
+	top, err := strconv.Atoi(c.DefaultQuery("top", "10"))
+	if err != nil || top <= 0 || top > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid top"})
+		return
+	}
+	if v := c.Query("hours"); v != "" {
+		hours, err := strconv.Atoi(v)
+		if err != nil || hours <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid hours"})
+			return
+		}
+		if database == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "statistics history requires sqlite mode"})
+			return
+		}
+		report, err := historyReport(time.Now(), hours, top)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+		return
+	}
+	c.JSON(http.StatusOK, queryStats.Report(time.Now(), minutes, top))
+}
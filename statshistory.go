@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// StatsConfig sets how long the query statistics are kept in the database
+// (sqlite mode): per-minute counters, then hourly rollups
+type StatsConfig struct {
+	RawRetentionHours   int `yaml:"raw_retention_hours" json:"raw_retention_hours,omitempty"`     // default 24
+	RollupRetentionDays int `yaml:"rollup_retention_days" json:"rollup_retention_days,omitempty"` // default 30
+}
+
+// statsFlushInterval is how often the counters are written to the database,
+// rolled up and pruned
+const statsFlushInterval = time.Minute
+
+var (
+	statsRawRetention    = 24 * time.Hour
+	statsRollupRetention = 30 * 24 * time.Hour
+)
+
+// initStatsRetention checks the retention settings
+func initStatsRetention(cfg StatsConfig) error {
+	if cfg.RawRetentionHours < 0 || cfg.RollupRetentionDays < 0 {
+		return fmt.Errorf("stats retention cannot be negative")
+	}
+	if cfg.RawRetentionHours > 0 {
+		statsRawRetention = time.Duration(cfg.RawRetentionHours) * time.Hour
+	}
+	if cfg.RollupRetentionDays > 0 {
+		statsRollupRetention = time.Duration(cfg.RollupRetentionDays) * 24 * time.Hour
+	}
+	return nil
+}
+
+// statsRow returns the database row of a bucket
+func statsRow(b *statsBucket, at int64) DBStatsRow {
+	return DBStatsRow{Time: at, Total: b.total, Local: b.local, Forwarded: b.forwarded, Cached: b.cached, Rcodes: b.rcodes}
+}
+
+// minuteRows returns the minutes after from and before to that had queries
+func (s *QueryStats) minuteRows(from, to int64) []DBStatsRow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows []DBStatsRow
+	for minute := max(from+1, to-int64(len(s.buckets))); minute < to; minute++ {
+		if b := &s.buckets[minute%int64(len(s.buckets))]; b.minute == minute && b.total > 0 {
+			rows = append(rows, statsRow(b, minute*60))
+		}
+	}
+	return rows
+}
+
+// restore puts back minutes read from the database into the ring, so a
+// restart does not empty the analytics
+func (s *QueryStats) restore(rows []DBStatsRow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range rows {
+		b := s.bucket(r.Time / 60)
+		b.total += r.Total
+		b.local += r.Local
+		b.forwarded += r.Forwarded
+		b.cached += r.Cached
+		for i, n := range r.Rcodes {
+			b.rcodes[i] += n
+		}
+	}
+}
+
+// flushStats writes the minutes completed since the last flush, rolls them
+// up into hours and deletes what is past the retention. The minutes of the
+// previous hour are kept until it is rolled up.
+func flushStats(last int64, now time.Time) int64 {
+	current := now.Unix() / 60
+	rows := queryStats.minuteRows(last, current)
+	if len(rows) > 0 {
+		if err := database.SaveStatsMinutes(rows); err != nil {
+			slog.Warn("failed to save query statistics", "error", err)
+			return last
+		}
+		if err := database.RollupStats(time.Unix(rows[0].Time, 0)); err != nil {
+			slog.Warn("failed to roll up query statistics", "error", err)
+		}
+	}
+	rawCutoff := now.Add(-statsRawRetention)
+	if previousHour := now.Truncate(time.Hour).Add(-time.Hour); previousHour.Before(rawCutoff) {
+		rawCutoff = previousHour
+	}
+	pruned, err := database.PruneStats(rawCutoff, now.Add(-statsRollupRetention))
+	if err != nil {
+		slog.Warn("failed to prune query statistics", "error", err)
+	} else if pruned > 0 {
+		slog.Debug("Pruned query statistics", "rows", pruned)
+	}
+	return current - 1
+}
+
+// startStatsHistory reloads the last day of statistics and keeps writing
+// them to the database until the process exits
+func startStatsHistory() {
+	now := time.Now()
+	rows, err := database.ListStatsMinutes(now.Add(-statsWindow))
+	if err != nil {
+		slog.Warn("failed to load query statistics", "error", err)
+	}
+	queryStats.restore(rows)
+	go func() {
+		last := now.Unix()/60 - 1
+		ticker := time.NewTicker(statsFlushInterval)
+		defer ticker.Stop()
+		for {
+			last = flushStats(last, time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+// historyReport summarizes the hourly rollups of the last hours. The top
+// names and clients are only kept in memory, since the start.
+func historyReport(now time.Time, hours, top int) (StatsReport, error) {
+	hours = max(1, min(hours, int(statsRollupRetention/time.Hour)))
+	rows, err := database.ListStatsHours(now.Truncate(time.Hour).Add(-time.Duration(hours-1) * time.Hour))
+	if err != nil {
+		return StatsReport{}, err
+	}
+
+	queryStats.mu.Lock()
+	report := StatsReport{
+		Minutes:    hours * 60,
+		Sources:    map[string]uint64{sourceLocal: 0, sourceForwarded: 0, sourceCached: 0},
+		Rcodes:     make(map[string]uint64),
+		TopNames:   queryStats.names.Top(top),
+		TopClients: queryStats.clients.Top(top),
+		Since:      queryStats.started,
+	}
+	if b := &queryStats.buckets[(now.Unix()/60-1)%int64(len(queryStats.buckets))]; b.minute == now.Unix()/60-1 {
+		report.QPS = float64(b.total) / 60
+	}
+	queryStats.mu.Unlock()
+
+	byHour := make(map[int64]DBStatsRow, len(rows))
+	for _, r := range rows {
+		byHour[r.Time] = r
+	}
+	current := now.Unix() / 3600 * 3600
+	for at := current - int64(hours-1)*3600; at <= current; at += 3600 {
+		r := byHour[at]
+		report.Series = append(report.Series, StatsPoint{Time: at, Total: r.Total, Local: r.Local, Forwarded: r.Forwarded, Cached: r.Cached})
+		report.Total += r.Total
+		report.Sources[sourceLocal] += r.Local
+		report.Sources[sourceForwarded] += r.Forwarded
+		report.Sources[sourceCached] += r.Cached
+		for i, n := range r.Rcodes {
+			if n == 0 {
+				continue
+			}
+			name := "OTHER"
+			if i < len(statsRcodes) {
+				name = dns.RcodeToString[statsRcodes[i]]
+			}
+			report.Rcodes[name] += n
+		}
+	}
+	return report, nil
+}
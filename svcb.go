@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// SVCB and HTTPS records (RFC 9460) tell clients how to reach a service:
+// the priority (0 for alias mode), the target host ("." for the owner name)
+// and parameters such as alpn=h2,h3, port=8443 or ipv4hint=192.0.2.1. The
+// value of the record is its full rdata; the priority may also be given in
+// the priority field of the record, like the preference of an MX.
+
+// isSVCBType reports whether records of rrType hold service binding rdata
+func isSVCBType(rrType string) bool {
+	switch strings.ToUpper(strings.TrimSpace(rrType)) {
+	case "SVCB", "HTTPS":
+		return true
+	}
+	return false
+}
+
+// svcbData returns the service binding rdata of an SVCB or HTTPS record,
+// nil for other records
+func svcbData(rr dns.RR) *dns.SVCB {
+	switch rr := rr.(type) {
+	case *dns.SVCB:
+		return rr
+	case *dns.HTTPS:
+		return &rr.SVCB
+	}
+	return nil
+}
+
+// normalizeSVCBRecord puts record.Priority in front of the value of an
+// SVCB or HTTPS record given without it, or takes the priority from the
+// value, then checks the record. Other records are left alone.
+func normalizeSVCBRecord(zoneName string, record *DBRecord) error {
+	if !isSVCBType(record.Type) {
+		return nil
+	}
+	value := strings.TrimSpace(record.Value)
+	if value == "" {
+		return fmt.Errorf("%s record needs a target", strings.ToUpper(record.Type))
+	}
+	first, _, _ := strings.Cut(value, " ")
+	if priority, err := strconv.ParseUint(first, 10, 16); err == nil {
+		record.Priority = int(priority)
+	} else {
+		if record.Priority < 0 || record.Priority > 65535 {
+			return fmt.Errorf("invalid %s priority %d", strings.ToUpper(record.Type), record.Priority)
+		}
+		value = strconv.Itoa(record.Priority) + " " + value
+	}
+	record.Value = value
+	rr, err := recordToRR(dns.Fqdn(zoneName), *record)
+	if err != nil {
+		return fmt.Errorf("invalid %s record %q: %v", strings.ToUpper(record.Type), record.Value, err)
+	}
+	return checkSVCB(rr)
+}
+
+// checkSVCB checks the parameters of an SVCB or HTTPS record beyond their
+// syntax: alias mode takes none, mandatory keys must be present and
+// no-default-alpn needs alpn
+func checkSVCB(rr dns.RR) error {
+	s := svcbData(rr)
+	if s == nil {
+		return nil
+	}
+	if s.Priority == 0 {
+		if len(s.Value) > 0 {
+			return fmt.Errorf("priority 0 (alias mode) takes no parameters")
+		}
+		return nil
+	}
+	keys := make(map[dns.SVCBKey]bool)
+	for _, kv := range s.Value {
+		keys[kv.Key()] = true
+	}
+	for _, kv := range s.Value {
+		mandatory, ok := kv.(*dns.SVCBMandatory)
+		if !ok {
+			continue
+		}
+		for _, key := range mandatory.Code {
+			if key == dns.SVCB_MANDATORY {
+				return fmt.Errorf("mandatory cannot list itself")
+			}
+			if !keys[key] {
+				return fmt.Errorf("mandatory key %s is missing", key)
+			}
+		}
+	}
+	if keys[dns.SVCB_NO_DEFAULT_ALPN] && !keys[dns.SVCB_ALPN] {
+		return fmt.Errorf("no-default-alpn needs alpn")
+	}
+	return nil
+}
+
+// svcbAdditionals returns the local addresses of the targets of the SVCB
+// and HTTPS records in answers, so clients connect without another query
+func svcbAdditionals(zd *ZoneData, answers []dns.RR) []dns.RR {
+	var extra []dns.RR
+	seen := make(map[string]bool)
+	for _, rr := range answers {
+		s := svcbData(rr)
+		if s == nil || s.Priority == 0 {
+			continue
+		}
+		target := s.Target
+		if target == "." {
+			target = s.Hdr.Name
+		}
+		target = strings.ToLower(target)
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		records, _ := zd.Lookup(target)
+		extra = append(extra, filterRRs(records, dns.TypeA)...)
+		extra = append(extra, filterRRs(records, dns.TypeAAAA)...)
+	}
+	return extra
+}
+
+// checkServiceBinding reports the invalid parameters of an SVCB or HTTPS
+// record, and a local target that does not exist or has no address
+func (l *zoneLinter) checkServiceBinding(name string, rr dns.RR) {
+	s := svcbData(rr)
+	rrtype := rr.Header().Rrtype
+	if err := checkSVCB(rr); err != nil {
+		l.report(severityError, name, rrtype, "%v", err)
+	}
+	if s.Target == "." {
+		return
+	}
+	records, local := l.lookup(s.Target)
+	switch {
+	case !local:
+	case len(records) == 0:
+		l.report(severityError, name, rrtype, "%s target %s does not exist", dns.TypeToString[rrtype], s.Target)
+	case s.Priority > 0 && !hasAddress(records) && len(filterRRs(records, dns.TypeCNAME)) == 0:
+		l.report(severityWarning, name, rrtype, "%s target %s has no A or AAAA record", dns.TypeToString[rrtype], s.Target)
+	}
+}
@@ -3,12 +3,13 @@ package main
 // HTML templates for web interface using TailAdmin-inspired layout
 // Uses Go template composition to avoid code duplication
 
-// Shared head template with Tailwind config
+// Shared head template with Tailwind config (also in static/tailwind.config.js)
 const headHTML = `
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <script src="https://cdn.tailwindcss.com"></script>
-    <script defer src="https://unpkg.com/alpinejs@3.x.x/dist/cdn.min.js"></script>
+    <link rel="stylesheet" href="/static/vendor/tailwind.css">
+    <script src="/static/vendor/tailwind.js"></script>
+    <script defer src="/static/vendor/alpine.min.js"></script>
     <script src="/static/config-modal.js"></script>
     <script>
         tailwind.config = {
@@ -299,6 +300,38 @@ const sidebarHTML = `{{define "sidebar"}}
                                     <span>Forwarders</span>
                                 </a>
                             </li>
+                            <li>
+                                <a href="/analytics" class="flex items-center gap-3 px-4 py-3 rounded-lg {{if eq .CurrentPath "/analytics"}}bg-brand-600 text-white{{else}}text-gray-300 hover:bg-white/5 hover:text-white{{end}}">
+                                    <svg xmlns="http://www.w3.org/2000/svg" fill="none" viewBox="0 0 24 24" stroke-width="1.5" stroke="currentColor" class="size-6">
+                                        <path stroke-linecap="round" stroke-linejoin="round" d="M3 13.125C3 12.504 3.504 12 4.125 12h2.25c.621 0 1.125.504 1.125 1.125v6.75C7.5 20.496 6.996 21 6.375 21h-2.25A1.125 1.125 0 0 1 3 19.875v-6.75ZM9.75 8.625c0-.621.504-1.125 1.125-1.125h2.25c.621 0 1.125.504 1.125 1.125v11.25c0 .621-.504 1.125-1.125 1.125h-2.25a1.125 1.125 0 0 1-1.125-1.125V8.625ZM16.5 4.125c0-.621.504-1.125 1.125-1.125h2.25C20.496 3 21 3.504 21 4.125v15.75c0 .621-.504 1.125-1.125 1.125h-2.25a1.125 1.125 0 0 1-1.125-1.125V4.125Z" />
+                                    </svg>
+                                    <span>Analytics</span>
+                                </a>
+                            </li>
+                            <li>
+                                <a href="/clients" class="flex items-center gap-3 px-4 py-3 rounded-lg {{if eq .CurrentPath "/clients"}}bg-brand-600 text-white{{else}}text-gray-300 hover:bg-white/5 hover:text-white{{end}}">
+                                    <svg xmlns="http://www.w3.org/2000/svg" fill="none" viewBox="0 0 24 24" stroke-width="1.5" stroke="currentColor" class="size-6">
+                                        <path stroke-linecap="round" stroke-linejoin="round" d="M9 17.25v1.007a3 3 0 0 1-.879 2.122L7.5 21h9l-.621-.621A3 3 0 0 1 15 18.257V17.25m6-12V15a2.25 2.25 0 0 1-2.25 2.25H5.25A2.25 2.25 0 0 1 3 15V5.25m18 0A2.25 2.25 0 0 0 18.75 3H5.25A2.25 2.25 0 0 0 3 5.25m18 0V12a2.25 2.25 0 0 1-2.25 2.25H5.25A2.25 2.25 0 0 1 3 12V5.25" />
+                                    </svg>
+                                    <span>Clients</span>
+                                </a>
+                            </li>
+                            <li>
+                                <a href="/sinkhole" class="flex items-center gap-3 px-4 py-3 rounded-lg {{if eq .CurrentPath "/sinkhole"}}bg-brand-600 text-white{{else}}text-gray-300 hover:bg-white/5 hover:text-white{{end}}">
+                                    <svg xmlns="http://www.w3.org/2000/svg" fill="none" viewBox="0 0 24 24" stroke-width="1.5" stroke="currentColor" class="size-6">
+                                        <path stroke-linecap="round" stroke-linejoin="round" d="M18.364 18.364A9 9 0 0 0 5.636 5.636m12.728 12.728A9 9 0 0 1 5.636 5.636m12.728 12.728L5.636 5.636" />
+                                    </svg>
+                                    <span>Sinkhole</span>
+                                </a>
+                            </li>
+                            <li>
+                                <a href="/query" class="flex items-center gap-3 px-4 py-3 rounded-lg {{if eq .CurrentPath "/query"}}bg-brand-600 text-white{{else}}text-gray-300 hover:bg-white/5 hover:text-white{{end}}">
+                                    <svg xmlns="http://www.w3.org/2000/svg" fill="none" viewBox="0 0 24 24" stroke-width="1.5" stroke="currentColor" class="size-6">
+                                        <path stroke-linecap="round" stroke-linejoin="round" d="m21 21-5.197-5.197m0 0A7.5 7.5 0 1 0 5.196 5.196a7.5 7.5 0 0 0 10.607 10.607Z" />
+                                    </svg>
+                                    <span>Query Tool</span>
+                                </a>
+                            </li>
                             <li>
                                 <a href="/replication" class="flex items-center gap-3 px-4 py-3 rounded-lg {{if eq .CurrentPath "/replication"}}bg-brand-600 text-white{{else}}text-gray-300 hover:bg-white/5 hover:text-white{{end}}">
                                     <svg xmlns="http://www.w3.org/2000/svg" fill="none" viewBox="0 0 24 24" stroke-width="1.5" stroke="currentColor" class="size-6">
@@ -307,6 +340,16 @@ const sidebarHTML = `{{define "sidebar"}}
                                     <span>Replication</span>
                                 </a>
                             </li>
+                            {{if eq .Mode "sqlite"}}
+                            <li>
+                                <a href="/trash" class="flex items-center gap-3 px-4 py-3 rounded-lg {{if eq .CurrentPath "/trash"}}bg-brand-600 text-white{{else}}text-gray-300 hover:bg-white/5 hover:text-white{{end}}">
+                                    <svg xmlns="http://www.w3.org/2000/svg" fill="none" viewBox="0 0 24 24" stroke-width="1.5" stroke="currentColor" class="size-6">
+                                        <path stroke-linecap="round" stroke-linejoin="round" d="m14.74 9-.346 9m-4.788 0L9.26 9m9.968-3.21c.342.052.682.107 1.022.166m-1.022-.165L18.16 19.673a2.25 2.25 0 0 1-2.244 2.077H8.084a2.25 2.25 0 0 1-2.244-2.077L4.772 5.79m14.456 0a48.108 48.108 0 0 0-3.478-.397m-12 .562c.34-.059.68-.114 1.022-.165m0 0a48.11 48.11 0 0 1 3.478-.397m7.5 0v-.916c0-1.18-.91-2.164-2.09-2.201a51.964 51.964 0 0 0-3.32 0c-1.18.037-2.09 1.022-2.09 2.201v.916m7.5 0a48.667 48.667 0 0 0-7.5 0" />
+                                    </svg>
+                                    <span>Trash</span>
+                                </a>
+                            </li>
+                            {{end}}
                         </ul>
                     </div>
                     <div class="mt-6">
@@ -366,17 +409,53 @@ const indexHTML = `<!DOCTYPE html>
 
             <!-- Main Content -->
             <main class="p-4 md:p-6 2xl:p-10">
+                {{if .EditMode}}
+                <!-- Record Search -->
+                <div x-data="{ q: '', results: null, error: '' }" class="mb-6 rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                    <form @submit.prevent="if (!q.trim()) { results = null; return } fetch('/api/records/search?q=' + encodeURIComponent(q)).then(r => r.json().then(d => { if (r.ok) { results = d; error = '' } else { results = null; error = d.error } }))" class="flex gap-2">
+                        <input type="text" x-model="q" placeholder="Search records in all zones: name, value, comment or tag:name"
+                               class="flex-1 px-4 py-2 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500 text-sm">
+                        <button type="submit" class="px-4 py-2 text-sm bg-brand-600 text-white hover:bg-brand-700 rounded-lg">Search</button>
+                    </form>
+                    <p x-show="error" x-text="error" class="mt-3 text-sm text-red-600"></p>
+                    <div x-show="results !== null" x-cloak class="mt-4">
+                        <p x-show="results && results.length === 0" class="text-sm text-gray-500 dark:text-gray-400">No matching records.</p>
+                        <table x-show="results && results.length > 0" class="w-full text-sm">
+                            <tbody class="divide-y divide-gray-100 dark:divide-gray-800">
+                                <template x-for="r in results || []" :key="r.id">
+                                    <tr>
+                                        <td class="py-2 pr-4"><a :href="'/zones/' + r.zone.replace(/\.$/, '') + '/records'" x-text="r.zone.replace(/\.$/, '')" class="text-brand-600 dark:text-brand-400 hover:underline"></a></td>
+                                        <td class="py-2 pr-4 font-mono" x-text="r.name"></td>
+                                        <td class="py-2 pr-4" x-text="r.type"></td>
+                                        <td class="py-2 pr-4 font-mono break-all text-gray-600 dark:text-gray-300" x-text="r.value"></td>
+                                        <td class="py-2 text-xs text-gray-500 dark:text-gray-400">
+                                            <span x-text="r.comment || ''"></span>
+                                            <template x-for="t in r.tags || []"><span class="ml-1 px-1.5 py-0.5 rounded bg-gray-100 dark:bg-white/10" x-text="t"></span></template>
+                                        </td>
+                                    </tr>
+                                </template>
+                            </tbody>
+                        </table>
+                    </div>
+                </div>
+                {{end}}
+
                 <!-- Zones Table -->
                 <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] overflow-hidden">
                     <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800 flex justify-between items-center">
                         <h3 class="text-lg font-semibold">DNS Zones</h3>
                         {{if .EditMode}}
+                        <div class="flex gap-2">
+                        <a href="/import" class="flex items-center gap-2 px-4 py-2 text-sm border border-gray-300 dark:border-gray-700 hover:bg-gray-100 dark:hover:bg-white/[0.05] rounded-lg transition-colors">
+                            Import
+                        </a>
                         <button onclick="showAddZoneModal()" class="flex items-center gap-2 px-4 py-2 text-sm bg-brand-600 text-white hover:bg-brand-700 rounded-lg transition-colors">
                             <svg class="w-4 h-4" fill="none" stroke="currentColor" viewBox="0 0 24 24">
                                 <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M12 4v16m8-8H4"/>
                             </svg>
                             Add Domain
                         </button>
+                        </div>
                         {{end}}
                     </div>
                     {{if .Zones}}
@@ -402,7 +481,13 @@ const indexHTML = `<!DOCTYPE html>
                                 {{range .Zones}}
                                 <tr>
                                     <td class="px-5 py-4 sm:px-6">
-                                        <a href="/zones/{{.Name}}/records" class="font-medium text-gray-800 text-sm dark:text-white/90 hover:text-brand-600 dark:hover:text-brand-400 hover:underline">{{.Name}}</a>
+                                        <a href="/zones/{{.Name}}/{{if .Forwarders}}settings{{else}}records{{end}}" class="font-medium text-gray-800 text-sm dark:text-white/90 hover:text-brand-600 dark:hover:text-brand-400 hover:underline">{{.DisplayName}}</a>
+                                        {{if eq .Review "overdue"}}
+                                        <a href="/zones/{{.Name}}/settings" class="ml-2 px-2 py-0.5 text-xs font-medium rounded-full bg-red-100 text-red-800 dark:bg-red-900/30 dark:text-red-400">review overdue</a>
+                                        {{else if eq .Review "due"}}
+                                        <a href="/zones/{{.Name}}/settings" class="ml-2 px-2 py-0.5 text-xs font-medium rounded-full bg-yellow-100 text-yellow-800 dark:bg-yellow-500/20 dark:text-yellow-300">review due</a>
+                                        {{end}}
+                                        {{if .Owner}}<p class="text-xs text-gray-500 dark:text-gray-400 mt-0.5">{{.Owner}}</p>{{end}}
                                     </td>
                                     <td class="px-5 py-4 sm:px-6">
                                         {{if .Enabled}}
@@ -418,7 +503,13 @@ const indexHTML = `<!DOCTYPE html>
                                         {{end}}
                                     </td>
                                     <td class="px-5 py-4 sm:px-6">
-                                        <span class="text-sm text-gray-600 dark:text-gray-300">{{len .Records}}</span>
+                                        {{if .Forwarders}}
+                                        <span class="text-sm text-gray-600 dark:text-gray-300">Forward to <span class="font-mono text-xs">{{range $i, $f := .Forwarders}}{{if $i}}, {{end}}{{$f}}{{end}}</span></span>
+                                        {{else if .Primaries}}
+                                        <span class="text-sm text-gray-600 dark:text-gray-300">Secondary of <span class="font-mono text-xs">{{range $i, $p := .Primaries}}{{if $i}}, {{end}}{{$p}}{{end}}</span></span>
+                                        {{else}}
+                                        <span class="text-sm text-gray-600 dark:text-gray-300">{{.RecordCount}}</span>
+                                        {{end}}
                                     </td>
                                     <td class="px-5 py-4 sm:px-6">
                                         <div class="flex items-center justify-end gap-2">
@@ -450,6 +541,42 @@ const indexHTML = `<!DOCTYPE html>
                     {{end}}
                 </div>
 
+                {{if .Cuts}}
+                <!-- Delegation Tree -->
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] mt-6">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800">
+                        <h3 class="text-lg font-semibold">Delegation Tree</h3>
+                        <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">Zones served here and the subdomains they delegate with NS records. Queries below a delegation get a referral to its name servers, with the glue addresses.</p>
+                    </div>
+                    <ul class="p-5 space-y-2 text-sm">
+                        {{range .Cuts}}
+                        <li style="padding-left: {{.Indent}}px">
+                            <div class="flex flex-wrap items-center gap-2">
+                                {{if eq .Kind "zone"}}
+                                <span class="px-2 py-0.5 text-xs font-medium rounded-full bg-brand-50 text-brand-600 dark:bg-brand-500/15 dark:text-brand-400">zone</span>
+                                <a href="{{.ZonePath}}" class="font-mono hover:text-brand-600 dark:hover:text-brand-400 hover:underline">{{.DisplayName}}</a>
+                                {{else if eq .Kind "forward"}}
+                                <span class="px-2 py-0.5 text-xs font-medium rounded-full bg-gray-100 text-gray-700 dark:bg-white/5 dark:text-gray-300">forward</span>
+                                <span class="font-mono">{{.DisplayName}}</span>
+                                <span class="text-gray-500 dark:text-gray-400">to {{range $i, $f := .Forwarders}}{{if $i}}, {{end}}{{$f}}{{end}}</span>
+                                {{else}}
+                                <span class="px-2 py-0.5 text-xs font-medium rounded-full bg-yellow-100 text-yellow-800 dark:bg-yellow-500/20 dark:text-yellow-300">delegation</span>
+                                <span class="font-mono">{{.DisplayName}}</span>
+                                {{end}}
+                            </div>
+                            {{if and (ne .Kind "forward") .NS}}
+                            <div class="mt-1 ml-1 font-mono text-xs text-gray-500 dark:text-gray-400">
+                                NS {{range $i, $ns := .NS}}{{if $i}}, {{end}}{{$ns}}{{end}}
+                                {{range .Glue}}<div class="ml-4">{{.}}</div>{{end}}
+                                {{range .MissingGlue}}<div class="ml-4 text-red-600 dark:text-red-400">missing glue for {{.}}</div>{{end}}
+                            </div>
+                            {{end}}
+                        </li>
+                        {{end}}
+                    </ul>
+                </div>
+                {{end}}
+
                 </main>
         </div>
     </div>
@@ -465,6 +592,25 @@ const indexHTML = `<!DOCTYPE html>
                     <input type="text" name="name" required placeholder="example.com" 
                            class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
                 </div>
+                <div class="mb-4">
+                    <label class="block text-sm font-medium mb-2">Type</label>
+                    <select name="type" onchange="document.getElementById('zoneForwarders').classList.toggle('hidden', this.value !== 'forward'); document.getElementById('zonePrimaries').classList.toggle('hidden', this.value !== 'secondary')"
+                            class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-gray-900 focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        <option value="primary">Primary (records served by SimpleDNS)</option>
+                        <option value="forward">Forward (sent to other DNS servers)</option>
+                        <option value="secondary">Secondary (transferred from a primary server)</option>
+                    </select>
+                </div>
+                <div id="zoneForwarders" class="mb-4 hidden">
+                    <label class="block text-sm font-medium mb-2">Forwarders</label>
+                    <input type="text" name="forwarders" placeholder="10.0.0.53, 10.0.1.53:5353"
+                           class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                </div>
+                <div id="zonePrimaries" class="mb-4 hidden">
+                    <label class="block text-sm font-medium mb-2">Primaries</label>
+                    <input type="text" name="primaries" placeholder="192.0.2.53, 198.51.100.53:5353"
+                           class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                </div>
                 <div class="flex gap-3 justify-end">
                     <button type="button" onclick="hideAddZoneModal()" class="px-4 py-2 border border-gray-300 dark:border-gray-800 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">Cancel</button>
                     <button type="submit" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700">Create Zone</button>
@@ -483,6 +629,8 @@ const indexHTML = `<!DOCTYPE html>
             document.getElementById('addZoneModal').classList.add('hidden');
             document.getElementById('addZoneModal').classList.remove('flex');
             document.getElementById('addZoneForm').reset();
+            document.getElementById('zoneForwarders').classList.add('hidden');
+            document.getElementById('zonePrimaries').classList.add('hidden');
         }
         
         async function submitZone(event) {
@@ -492,7 +640,7 @@ const indexHTML = `<!DOCTYPE html>
                 const resp = await fetch('/api/zones', {
                     method: 'POST',
                     headers: {'Content-Type': 'application/json'},
-                    body: JSON.stringify({ name: form.name.value })
+                    body: JSON.stringify({ name: form.name.value, type: form.type.value, forwarders: form.forwarders.value, primaries: form.primaries.value })
                 });
                 if (resp.ok) {
                     window.location.reload();
@@ -516,10 +664,10 @@ const indexHTML = `<!DOCTYPE html>
 const zoneRecordsHTML = `<!DOCTYPE html>
 <html lang="en">
 <head>
-    <title>SimpleDNS - {{.Zone.Name}} Records</title>
+    <title>SimpleDNS - {{.Zone.DisplayName}} Records</title>
 ` + headHTML + `
 </head>
-<body x-data="{ sidebarOpen: false, darkMode: localStorage.getItem('darkMode') === 'true', activeFilter: 'all', searchQuery: '' }" 
+<body x-data="{ sidebarOpen: false, darkMode: localStorage.getItem('darkMode') === 'true' }" 
       x-init="$watch('darkMode', val => { localStorage.setItem('darkMode', val); document.documentElement.classList.toggle('dark', val) }); document.documentElement.classList.toggle('dark', darkMode)"
       class="bg-gray-50 dark:bg-gray-900 text-gray-800 dark:text-white/90 font-sans">
     
@@ -546,7 +694,7 @@ const zoneRecordsHTML = `<!DOCTYPE html>
                                     class="font-medium bg-transparent border border-gray-300 dark:border-gray-700 rounded-lg px-3 py-1.5 pr-8 focus:outline-none focus:ring-2 focus:ring-brand-500 cursor-pointer appearance-none"
                                     style="background-image: url('data:image/svg+xml;charset=UTF-8,%3Csvg xmlns=%22http://www.w3.org/2000/svg%22 fill=%22none%22 viewBox=%220 0 24 24%22 stroke=%22%236b7280%22%3E%3Cpath stroke-linecap=%22round%22 stroke-linejoin=%22round%22 stroke-width=%222%22 d=%22M19 9l-7 7-7-7%22/%3E%3C/svg%3E'); background-repeat: no-repeat; background-position: right 0.5rem center; background-size: 1rem;">
                                 {{range .AllZones}}
-                                <option value="{{.Name}}" {{if eq .Name $.Zone.Name}}selected{{end}}>{{.Name}}</option>
+                                <option value="{{.Name}}" {{if eq .Name $.Zone.Name}}selected{{end}}>{{.DisplayName}}</option>
                                 {{end}}
                             </select>
                         </nav>
@@ -574,14 +722,14 @@ const zoneRecordsHTML = `<!DOCTYPE html>
                 <!-- Zone Header -->
                 <div class="mb-6">
                     <div class="flex items-center gap-3 mb-2">
-                        <h1 class="text-2xl font-bold">{{.Zone.Name}}</h1>
+                        <h1 class="text-2xl font-bold">{{.Zone.DisplayName}}</h1>
                         {{if .Zone.Enabled}}
                         <span class="px-2.5 py-0.5 text-xs font-medium bg-green-100 text-green-800 dark:bg-green-900/30 dark:text-green-400 rounded-full">Active</span>
                         {{else}}
                         <span class="px-2.5 py-0.5 text-xs font-medium bg-red-100 text-red-800 dark:bg-red-900/30 dark:text-red-400 rounded-full">Disabled</span>
                         {{end}}
                     </div>
-                    <p class="text-gray-500 dark:text-gray-400 mb-4">{{len .Zone.Records}} DNS records</p>
+                    <p class="text-gray-500 dark:text-gray-400 mb-4">{{.Zone.RecordCount}} DNS records</p>
                     
                     <!-- Tabs with underline and icon -->
                     <div class="border-b border-gray-200 dark:border-gray-800">
@@ -599,6 +747,14 @@ const zoneRecordsHTML = `<!DOCTYPE html>
                                 </svg>
                                 Settings
                             </a>
+                            {{if and .EditMode (not .Zone.Forwarders)}}
+                            <a href="/zones/{{.Zone.Name}}/text" class="flex items-center gap-2 px-1 pb-3 border-b-2 border-transparent text-gray-500 hover:text-gray-700 dark:text-gray-400 dark:hover:text-gray-300 font-medium text-sm">
+                                <svg class="w-5 h-5" fill="none" stroke="currentColor" viewBox="0 0 24 24">
+                                    <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M10 20l4-16m4 4l4 4-4 4M6 16l-4-4 4-4"/>
+                                </svg>
+                                Zone file
+                            </a>
+                            {{end}}
                         </nav>
                     </div>
                 </div>
@@ -606,34 +762,67 @@ const zoneRecordsHTML = `<!DOCTYPE html>
                 <!-- Filter Buttons -->
                 <div class="flex flex-wrap items-center gap-4 mb-4">
                     <div class="flex flex-wrap gap-2">
-                        <template x-for="filter in ['all', 'A', 'AAAA', 'CNAME', 'MX', 'TXT', 'NS', 'PTR']">
-                            <button @click="activeFilter = filter"
-                                    :class="activeFilter === filter ? 'bg-brand-600 text-white' : 'bg-white dark:bg-white/[0.03] border border-gray-300 dark:border-gray-800 hover:bg-gray-50 dark:hover:bg-white/5'"
-                                    class="px-3 py-1.5 text-sm rounded-lg transition-colors"
-                                    x-text="filter === 'all' ? 'All' : filter">
-                            </button>
-                        </template>
+                        <a href="?q={{.Query}}"
+                           class="px-3 py-1.5 text-sm rounded-lg transition-colors {{if eq .TypeFilter ""}}bg-brand-600 text-white{{else}}bg-white dark:bg-white/[0.03] border border-gray-300 dark:border-gray-800 hover:bg-gray-50 dark:hover:bg-white/5{{end}}">All</a>
+                        {{range .RecordTypes}}
+                        <a href="?type={{.}}&q={{$.Query}}"
+                           class="px-3 py-1.5 text-sm rounded-lg transition-colors {{if eq $.TypeFilter .}}bg-brand-600 text-white{{else}}bg-white dark:bg-white/[0.03] border border-gray-300 dark:border-gray-800 hover:bg-gray-50 dark:hover:bg-white/5{{end}}">{{.}}</a>
+                        {{end}}
                     </div>
-                    <div class="relative flex-1 min-w-[200px] max-w-md">
-                        <input type="text" x-model="searchQuery" placeholder="Search records..."
+                    <form method="GET" class="relative flex-1 min-w-[200px] max-w-md">
+                        {{if .TypeFilter}}<input type="hidden" name="type" value="{{.TypeFilter}}">{{end}}
+                        <input type="text" name="q" value="{{.Query}}" placeholder="Search records..."
                                class="w-full pl-10 pr-4 py-2 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500 text-sm">
                         <svg class="absolute left-3 top-1/2 -translate-y-1/2 w-4 h-4 text-gray-400" fill="none" stroke="currentColor" viewBox="0 0 24 24">
                             <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M21 21l-6-6m2-5a7 7 0 11-14 0 7 7 0 0114 0z"/>
                         </svg>
+                    </form>
+                </div>
+
+                <!-- Problems found by the periodic check -->
+                <div id="problemsPanel" class="hidden mb-4 rounded-2xl border border-amber-300 dark:border-amber-700/60 bg-amber-50 dark:bg-amber-900/10 p-5">
+                    <h3 class="text-lg font-semibold">Problems</h3>
+                    <p id="problemsSummary" class="text-sm text-gray-600 dark:text-gray-400"></p>
+                    <div id="problemsList" class="mt-3 text-sm space-y-1"></div>
+                </div>
+
+                {{if .EditMode}}
+                <!-- Staged changes -->
+                <div id="stagingPanel" class="hidden mb-4 rounded-2xl border border-amber-300 dark:border-amber-700/60 bg-amber-50 dark:bg-amber-900/10 p-5">
+                    <div class="flex flex-wrap items-center justify-between gap-3">
+                        <div>
+                            <h3 class="text-lg font-semibold">Staged changes</h3>
+                            <p id="stagingSummary" class="text-sm text-gray-600 dark:text-gray-400"></p>
+                        </div>
+                        <div class="flex gap-2">
+                            <button onclick="discardChangeset()" class="px-4 py-2 text-sm border border-gray-300 dark:border-gray-700 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">Discard</button>
+                            <button onclick="applyChangeset()" class="px-4 py-2 text-sm bg-brand-600 text-white hover:bg-brand-700 rounded-lg">Apply</button>
+                        </div>
                     </div>
+                    <div id="stagingDiff" class="mt-4 rounded-lg bg-white dark:bg-gray-900 border border-gray-200 dark:border-gray-800 p-3 font-mono text-xs space-y-1 overflow-x-auto"></div>
+                    <div id="stagingProblems" class="mt-3 text-sm space-y-1"></div>
                 </div>
+                {{end}}
 
                 <!-- Records Table -->
                 <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] overflow-hidden">
                     <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800 flex justify-between items-center">
                         <h3 class="text-lg font-semibold">DNS Records</h3>
                         {{if .EditMode}}
+                        <div class="flex items-center gap-2">
+                        <button id="stageButton" onclick="startStaging()" title="Collect edits in a changeset and apply them together" class="px-4 py-2 text-sm border border-gray-300 dark:border-gray-700 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">
+                            Stage changes
+                        </button>
+                        <button onclick="showImportRecordsModal()" title="Add many records from CSV or JSON" class="px-4 py-2 text-sm border border-gray-300 dark:border-gray-700 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">
+                            Import records
+                        </button>
                         <button onclick="showAddRecordModal()" class="flex items-center gap-2 px-4 py-2 text-sm bg-brand-600 text-white hover:bg-brand-700 rounded-lg transition-colors">
                             <svg class="w-4 h-4" fill="none" stroke="currentColor" viewBox="0 0 24 24">
                                 <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M12 4v16m8-8H4"/>
                             </svg>
                             Add Record
                         </button>
+                        </div>
                         {{end}}
                     </div>
                     {{if .Zone.Records}}
@@ -651,30 +840,50 @@ const zoneRecordsHTML = `<!DOCTYPE html>
                             </thead>
                             <tbody class="divide-y divide-gray-100 dark:divide-gray-800">
                                 {{range .Zone.Records}}
-                                <tr x-show="(activeFilter === 'all' || activeFilter === '{{.Type}}') && (searchQuery === '' || '{{.Name}} {{.Value}}'.toLowerCase().includes(searchQuery.toLowerCase()))">
-                                    <td class="px-5 py-4 sm:px-6"><span class="font-mono text-sm" data-field="name">{{.Name}}</span></td>
+                                <tr data-version="{{.Version}}"{{if .SetContinued}} data-set-continued{{end}}>
+                                    <td class="px-5 py-4 sm:px-6"><span class="font-mono text-sm{{if .SetContinued}} invisible{{end}}" data-field="name">{{.DisplayName}}</span>
+                                        {{if .Comment}}<div class="mt-1 text-xs text-gray-500 dark:text-gray-400" data-field="comment">{{.Comment}}</div>{{end}}
+                                        {{if .Tags}}<div class="mt-1 flex flex-wrap gap-1" data-field="tags">{{range .Tags}}<a href="?q={{.}}" class="px-1.5 py-0.5 text-xs rounded bg-gray-100 text-gray-700 dark:bg-white/10 dark:text-gray-300 hover:bg-gray-200 dark:hover:bg-white/20" data-tag="{{.}}">{{.}}</a>{{end}}</div>{{end}}
+                                    </td>
                                     <td class="px-5 py-4 sm:px-6">
-                                        <span class="px-2 py-1 text-xs font-medium rounded
+                                        <span class="px-2 py-1 text-xs font-medium rounded{{if .SetContinued}} invisible{{end}}
                                             {{if eq .Type "A"}}bg-blue-100 text-blue-800 dark:bg-blue-500/20 dark:text-blue-300
                                             {{else if eq .Type "AAAA"}}bg-indigo-100 text-indigo-800 dark:bg-indigo-500/20 dark:text-indigo-300
-                                            {{else if eq .Type "CNAME"}}bg-green-100 text-green-800 dark:bg-green-500/20 dark:text-green-300
+                                            {{else if or (eq .Type "CNAME") (eq .Type "ALIAS")}}bg-green-100 text-green-800 dark:bg-green-500/20 dark:text-green-300
                                             {{else if eq .Type "MX"}}bg-purple-100 text-purple-800 dark:bg-purple-500/20 dark:text-purple-300
                                             {{else if eq .Type "TXT"}}bg-yellow-100 text-yellow-800 dark:bg-yellow-500/20 dark:text-yellow-300
                                             {{else if eq .Type "NS"}}bg-pink-100 text-pink-800 dark:bg-pink-500/20 dark:text-pink-300
                                             {{else if eq .Type "PTR"}}bg-orange-100 text-orange-800 dark:bg-orange-500/20 dark:text-orange-300
                                             {{else}}bg-gray-100 text-gray-800 dark:bg-gray-500/20 dark:text-gray-300{{end}}" data-field="type">{{.Type}}</span>
                                     </td>
-                                    <td class="px-5 py-4 sm:px-6"><span class="font-mono text-sm text-gray-600 dark:text-gray-300 break-all" data-field="value">{{.Value}}</span></td>
-                                    <td class="px-5 py-4 sm:px-6"><span class="text-sm text-gray-500" data-field="priority">{{if eq .Type "MX"}}{{.Priority}}{{else}}-{{end}}</span></td>
-                                    <td class="px-5 py-4 sm:px-6"><span class="text-sm text-gray-500" data-field="ttl">{{.TTL}}</span></td>
+                                    <td class="px-5 py-4 sm:px-6"><span class="font-mono text-sm text-gray-600 dark:text-gray-300 break-all" data-field="value">{{.Value}}</span>
+                                        {{if or .ActivateAt .ExpireAt}}<div class="mt-1 text-xs text-amber-600 dark:text-amber-400" data-field="schedule"
+                                             data-activate="{{if .ActivateAt}}{{.ActivateAt.Format "2006-01-02T15:04:05Z07:00"}}{{end}}" data-expire="{{if .ExpireAt}}{{.ExpireAt.Format "2006-01-02T15:04:05Z07:00"}}{{end}}">
+                                            {{if .ActivateAt}}from {{.ActivateAt.Format "2006-01-02 15:04"}} UTC{{end}}{{if .ExpireAt}} until {{.ExpireAt.Format "2006-01-02 15:04"}} UTC{{end}}
+                                        </div>{{end}}
+                                    </td>
+                                    <td class="px-5 py-4 sm:px-6"><span class="text-sm text-gray-500" data-field="priority">{{if or (eq .Type "MX") (eq .Type "HTTPS") (eq .Type "SVCB")}}{{.Priority}}{{else}}-{{end}}</span></td>
+                                    <td class="px-5 py-4 sm:px-6"><span class="text-sm text-gray-500{{if .SetContinued}} invisible{{end}}" data-field="ttl">{{.TTL}}</span>
+                                        {{if .NoCache}}<div class="mt-1 text-xs text-amber-600 dark:text-amber-400" data-field="no-cache" title="Served with a TTL of 0, upstream answers for the name are not cached">no cache</div>{{end}}
+                                    </td>
                                     {{if $.EditMode}}
                                     <td class="px-5 py-4 sm:px-6">
                                         <div class="flex items-center justify-end gap-2">
+                                            {{if not .SetContinued}}<button onclick="showRRSetModal({{.Name}}, {{.Type}})" class="p-2 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5" title="Edit the record set: all the values of this name and type, with one TTL">
+                                                <svg class="w-4 h-4 text-gray-500" fill="none" stroke="currentColor" viewBox="0 0 24 24">
+                                                    <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M4 6h16M4 12h16M4 18h10"/>
+                                                </svg>
+                                            </button>{{end}}
                                             <button onclick="showEditRecordModal({{.ID}}, this)" class="p-2 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5" title="Edit">
                                                 <svg class="w-4 h-4 text-gray-500" fill="none" stroke="currentColor" viewBox="0 0 24 24">
                                                     <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M11 5H6a2 2 0 00-2 2v11a2 2 0 002 2h11a2 2 0 002-2v-5m-1.414-9.414a2 2 0 112.828 2.828L11.828 15H9v-2.828l8.586-8.586z"/>
                                                 </svg>
                                             </button>
+                                            <button onclick="refreshRecord({{.ID}})" class="p-2 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5" title="Refresh: serve as stored and drop cached answers">
+                                                <svg class="w-4 h-4 text-gray-500" fill="none" stroke="currentColor" viewBox="0 0 24 24">
+                                                    <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M4 4v5h.582m15.356 2A8.001 8.001 0 004.582 9m0 0H9m11 11v-5h-.581m0 0a8.003 8.003 0 01-15.357-2m15.357 2H15"/>
+                                                </svg>
+                                            </button>
                                             <button onclick="deleteRecord({{.ID}}, this)" class="p-2 rounded-lg hover:bg-red-50 dark:hover:bg-red-900/20" title="Delete">
                                                 <svg class="w-4 h-4 text-red-500" fill="none" stroke="currentColor" viewBox="0 0 24 24">
                                                     <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M19 7l-.867 12.142A2 2 0 0116.138 21H7.862a2 2 0 01-1.995-1.858L5 7m5 4v6m4-6v6m1-10V4a1 1 0 00-1-1h-4a1 1 0 00-1 1v3M4 7h16"/>
@@ -688,6 +897,19 @@ const zoneRecordsHTML = `<!DOCTYPE html>
                             </tbody>
                         </table>
                     </div>
+                    {{if gt .Pages 1}}
+                    <div class="px-5 py-3 border-t border-gray-200 dark:border-gray-800 flex items-center justify-between text-sm text-gray-500 dark:text-gray-400">
+                        <span>Page {{.Page}} of {{.Pages}} &middot; {{.Total}} records</span>
+                        <div class="flex gap-2">
+                            {{if gt .Page 1}}<a href="?type={{.TypeFilter}}&q={{.Query}}&page={{.PrevPage}}" class="px-3 py-1.5 border border-gray-300 dark:border-gray-700 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">Previous</a>{{end}}
+                            {{if lt .Page .Pages}}<a href="?type={{.TypeFilter}}&q={{.Query}}&page={{.NextPage}}" class="px-3 py-1.5 border border-gray-300 dark:border-gray-700 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">Next</a>{{end}}
+                        </div>
+                    </div>
+                    {{end}}
+                    {{else if or .TypeFilter .Query}}
+                    <div class="p-10 text-center text-gray-500 dark:text-gray-400">
+                        <p class="text-lg font-medium">No matching records</p>
+                    </div>
                     {{else}}
                     <div class="p-10 text-center text-gray-500 dark:text-gray-400">
                         <p class="text-lg font-medium">No records in this zone</p>
@@ -717,25 +939,87 @@ const zoneRecordsHTML = `<!DOCTYPE html>
                             <option value="A">A</option>
                             <option value="AAAA">AAAA</option>
                             <option value="CNAME">CNAME</option>
+                            <option value="ALIAS">ALIAS</option>
                             <option value="MX">MX</option>
                             <option value="TXT">TXT</option>
                             <option value="NS">NS</option>
                             <option value="PTR">PTR</option>
+                            <option value="HTTPS">HTTPS</option>
+                            <option value="SVCB">SVCB</option>
                         </select>
                     </div>
-                    <div>
+                    <div id="valueFieldAdd">
                         <label class="block text-sm font-medium mb-2">Value</label>
                         <input type="text" name="value" required placeholder="192.168.1.1" 
                                class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
                     </div>
                     <div id="priorityFieldAdd" style="display: none;">
-                        <label class="block text-sm font-medium mb-2">Priority (MX only)</label>
+                        <label class="block text-sm font-medium mb-2">Priority (MX, HTTPS, SVCB)</label>
                         <input type="number" name="priority" value="10" min="0" max="65535"
                                class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
                     </div>
+                    <div id="addSvcbFields" class="space-y-4" style="display: none;">
+                        <div>
+                            <label class="block text-sm font-medium mb-2">Target</label>
+                            <input type="text" id="addSvcbTarget" value="." placeholder=". for the name itself, or a host name"
+                                   class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium mb-2">ALPN</label>
+                            <input type="text" id="addSvcbAlpn" placeholder="h2,h3"
+                                   class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium mb-2">Port</label>
+                            <input type="number" id="addSvcbPort" min="1" max="65535" placeholder="443"
+                                   class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium mb-2">IPv4 hints</label>
+                            <input type="text" id="addSvcbIpv4hint" placeholder="192.0.2.1,192.0.2.2"
+                                   class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium mb-2">IPv6 hints</label>
+                            <input type="text" id="addSvcbIpv6hint" placeholder="2001:db8::1"
+                                   class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium mb-2">Other parameters</label>
+                            <input type="text" id="addSvcbParams" placeholder="ech=... mandatory=alpn"
+                                   class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                    </div>
                     <div>
                         <label class="block text-sm font-medium mb-2">TTL</label>
-                        <input type="number" name="ttl" value="3600" min="60" 
+                        <input type="number" name="ttl" value="{{.DefaultTTL}}" min="60" list="ttlPresets"
+                               class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    </div>
+                    <label class="flex items-start gap-2 text-sm">
+                        <input type="checkbox" name="no_cache" class="mt-0.5 rounded border-gray-300 dark:border-gray-700">
+                        <span>Do not cache<span class="block text-xs text-gray-500 dark:text-gray-400">Served with a TTL of 0, and answers forwarded upstream for this name are never cached.</span></span>
+                    </label>
+                    <div class="grid grid-cols-2 gap-3">
+                        <div>
+                            <label class="block text-sm font-medium mb-2">Active from</label>
+                            <input type="datetime-local" name="activate_at"
+                                   class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium mb-2">Expires at</label>
+                            <input type="datetime-local" name="expire_at"
+                                   class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                    </div>
+                    <p class="text-xs text-gray-500 dark:text-gray-400">Optional: the record is only served in this window and deleted once it expires.</p>
+                    <div>
+                        <label class="block text-sm font-medium mb-2">Comment</label>
+                        <input type="text" name="comment" maxlength="500" placeholder="Optional note for the operators"
+                               class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium mb-2">Tags</label>
+                        <input type="text" name="tags" placeholder="prod, web"
                                class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
                     </div>
                 </div>
@@ -747,12 +1031,71 @@ const zoneRecordsHTML = `<!DOCTYPE html>
         </div>
     </div>
 
+    <!-- Import Records Modal -->
+    <div id="importRecordsModal" class="fixed inset-0 bg-black/50 hidden items-center justify-center z-50">
+        <div class="bg-white dark:bg-gray-900 rounded-2xl p-6 w-full max-w-3xl mx-4 shadow-xl max-h-[90vh] overflow-y-auto">
+            <h2 class="text-xl font-bold mb-1">Import Records</h2>
+            <p class="text-sm text-gray-500 dark:text-gray-400 mb-4">CSV with a first line naming the columns among <span class="font-mono">name, type, value, ttl, priority, comment, tags, activate_at, expire_at</span>, or a JSON array of records. All the records are added, or none.</p>
+            <div class="flex flex-wrap items-center gap-3 mb-3">
+                <select id="importFormat" onchange="importEdited()" class="px-3 py-2 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-gray-900 text-sm">
+                    <option value="csv">CSV</option>
+                    <option value="json">JSON</option>
+                </select>
+                <input type="file" id="importFile" accept=".csv,.json,text/csv,application/json" onchange="loadImportFile(event)" class="text-sm">
+            </div>
+            <textarea id="importData" oninput="importEdited()" rows="10" spellcheck="false" placeholder="name,type,value,ttl&#10;www,A,192.168.1.10,300&#10;mail,MX,mail.example.com.,"
+                      class="w-full px-4 py-3 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] font-mono text-sm whitespace-pre focus:outline-none focus:ring-2 focus:ring-brand-500"></textarea>
+            <p id="importMessage" class="hidden mt-3 text-sm"></p>
+            <ul id="importErrors" class="mt-2 space-y-1 text-sm text-red-600 dark:text-red-400"></ul>
+            <div id="importPreview" class="hidden mt-3 p-3 rounded-lg bg-gray-50 dark:bg-white/[0.03] font-mono text-xs break-all max-h-64 overflow-y-auto"></div>
+            <div class="flex gap-3 justify-end mt-6">
+                <button type="button" onclick="hideImportRecordsModal()" class="px-4 py-2 border border-gray-300 dark:border-gray-800 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">Cancel</button>
+                <button type="button" onclick="submitImport(true)" class="px-4 py-2 border border-gray-300 dark:border-gray-800 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">Preview</button>
+                <button type="button" id="importButton" onclick="submitImport(false)" disabled class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700 disabled:opacity-50">Import</button>
+            </div>
+        </div>
+    </div>
+
+    <datalist id="ttlPresets">
+        <option value="60">1 minute</option>
+        <option value="300">5 minutes</option>
+        <option value="3600">1 hour</option>
+        <option value="86400">1 day</option>
+    </datalist>
+
+    <!-- Record Set Modal -->
+    <div id="rrsetModal" class="fixed inset-0 bg-black/50 hidden items-center justify-center z-50">
+        <div class="bg-white dark:bg-gray-900 rounded-2xl p-6 w-full max-w-md mx-4 shadow-xl">
+            <h2 class="text-xl font-bold mb-1">Edit Record Set</h2>
+            <p class="text-sm text-gray-500 dark:text-gray-400 mb-4"><span class="font-mono" id="rrsetTitle"></span>: all the records of the name and type, served with one TTL.</p>
+            <form id="rrsetForm" onsubmit="submitRRSet(event)">
+                <div class="space-y-4">
+                    <div>
+                        <label class="block text-sm font-medium mb-2">Values (one per line)</label>
+                        <textarea id="rrsetValues" rows="5" class="w-full px-4 py-2.5 font-mono text-sm border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500"></textarea>
+                        <p class="text-xs text-gray-500 dark:text-gray-400 mt-1">Records whose value is kept keep their comment, tags and schedule. No values deletes the set.</p>
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium mb-2">TTL</label>
+                        <input type="number" id="rrsetTTL" min="0" list="ttlPresets"
+                               class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    </div>
+                </div>
+                <div class="flex gap-3 mt-6 justify-end">
+                    <button type="button" onclick="hideRRSetModal()" class="px-4 py-2 border border-gray-300 dark:border-gray-800 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">Cancel</button>
+                    <button type="submit" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700">Save Set</button>
+                </div>
+            </form>
+        </div>
+    </div>
+
     <!-- Edit Record Modal -->
     <div id="editRecordModal" class="fixed inset-0 bg-black/50 hidden items-center justify-center z-50">
         <div class="bg-white dark:bg-gray-900 rounded-2xl p-6 w-full max-w-md mx-4 shadow-xl">
             <h2 class="text-xl font-bold mb-4">Edit DNS Record</h2>
             <form id="editRecordForm" onsubmit="submitEditRecord(event)">
                 <input type="hidden" id="editRecordId">
+                <input type="hidden" id="editRecordVersion">
                 <div class="space-y-4">
                     <div>
                         <label class="block text-sm font-medium mb-2">Name</label>
@@ -765,25 +1108,86 @@ const zoneRecordsHTML = `<!DOCTYPE html>
                             <option value="A">A</option>
                             <option value="AAAA">AAAA</option>
                             <option value="CNAME">CNAME</option>
+                            <option value="ALIAS">ALIAS</option>
                             <option value="MX">MX</option>
                             <option value="TXT">TXT</option>
                             <option value="NS">NS</option>
                             <option value="PTR">PTR</option>
+                            <option value="HTTPS">HTTPS</option>
+                            <option value="SVCB">SVCB</option>
                         </select>
                     </div>
-                    <div>
+                    <div id="valueFieldEdit">
                         <label class="block text-sm font-medium mb-2">Value</label>
                         <input type="text" id="editRecordValue" required 
                                class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
                     </div>
                     <div id="priorityFieldEdit" style="display: none;">
-                        <label class="block text-sm font-medium mb-2">Priority (MX only)</label>
+                        <label class="block text-sm font-medium mb-2">Priority (MX, HTTPS, SVCB)</label>
                         <input type="number" id="editRecordPriority" value="10" min="0" max="65535"
                                class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
                     </div>
+                    <div id="editSvcbFields" class="space-y-4" style="display: none;">
+                        <div>
+                            <label class="block text-sm font-medium mb-2">Target</label>
+                            <input type="text" id="editSvcbTarget" value="." placeholder=". for the name itself, or a host name"
+                                   class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium mb-2">ALPN</label>
+                            <input type="text" id="editSvcbAlpn" placeholder="h2,h3"
+                                   class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium mb-2">Port</label>
+                            <input type="number" id="editSvcbPort" min="1" max="65535" placeholder="443"
+                                   class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium mb-2">IPv4 hints</label>
+                            <input type="text" id="editSvcbIpv4hint" placeholder="192.0.2.1,192.0.2.2"
+                                   class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium mb-2">IPv6 hints</label>
+                            <input type="text" id="editSvcbIpv6hint" placeholder="2001:db8::1"
+                                   class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium mb-2">Other parameters</label>
+                            <input type="text" id="editSvcbParams" placeholder="ech=... mandatory=alpn"
+                                   class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                    </div>
                     <div>
                         <label class="block text-sm font-medium mb-2">TTL</label>
-                        <input type="number" id="editRecordTTL" min="60" 
+                        <input type="number" id="editRecordTTL" min="60" list="ttlPresets"
+                               class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    </div>
+                    <label class="flex items-start gap-2 text-sm">
+                        <input type="checkbox" id="editRecordNoCache" class="mt-0.5 rounded border-gray-300 dark:border-gray-700">
+                        <span>Do not cache<span class="block text-xs text-gray-500 dark:text-gray-400">Served with a TTL of 0, and answers forwarded upstream for this name are never cached.</span></span>
+                    </label>
+                    <div class="grid grid-cols-2 gap-3">
+                        <div>
+                            <label class="block text-sm font-medium mb-2">Active from</label>
+                            <input type="datetime-local" id="editRecordActivateAt"
+                                   class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium mb-2">Expires at</label>
+                            <input type="datetime-local" id="editRecordExpireAt"
+                                   class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium mb-2">Comment</label>
+                        <input type="text" id="editRecordComment" maxlength="500"
+                               class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium mb-2">Tags</label>
+                        <input type="text" id="editRecordTags" placeholder="prod, web"
                                class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-800 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
                     </div>
                 </div>
@@ -798,16 +1202,183 @@ const zoneRecordsHTML = `<!DOCTYPE html>
 
     <script>
         const zoneId = {{.Zone.ID}};
+        // Pending changeset edits are staged in, null when edits go live
+        let changesetId = null;
+
+        function recordsURL(path) {
+            return changesetId ? path + '?changeset=' + changesetId : path;
+        }
+
+        // afterEdit reloads the page, or only the staged changes
+        function afterEdit() {
+            if (changesetId) {
+                hideAddRecordModal();
+                hideEditRecordModal();
+                hideRRSetModal();
+                renderChangeset();
+            } else {
+                window.location.reload();
+            }
+        }
+
+        async function loadChangeset() {
+            const resp = await fetch('/api/changesets?zone_id=' + zoneId);
+            if (!resp.ok) return;
+            const pending = await resp.json();
+            if (pending.length > 0) {
+                changesetId = pending[pending.length - 1].id;
+                renderChangeset();
+            }
+        }
+
+        async function startStaging() {
+            const resp = await fetch('/api/zones/' + zoneId + '/changesets', { method: 'POST' });
+            if (!resp.ok) {
+                const err = await resp.json();
+                alert('Failed to start staging: ' + (err.error || 'Unknown error'));
+                return;
+            }
+            changesetId = (await resp.json()).id;
+            renderChangeset();
+        }
+
+        function diffLine(prefix, text, color) {
+            const div = document.createElement('div');
+            div.className = 'whitespace-pre ' + color;
+            div.textContent = prefix + ' ' + text;
+            return div;
+        }
+
+        async function renderChangeset() {
+            const resp = await fetch('/api/changesets/' + changesetId);
+            const cs = resp.ok ? await resp.json() : null;
+            if (!cs || cs.status !== 'pending') {
+                changesetId = null;
+                document.getElementById('stagingPanel').classList.add('hidden');
+                document.getElementById('stageButton').classList.remove('hidden');
+                return;
+            }
+            document.getElementById('stagingPanel').classList.remove('hidden');
+            document.getElementById('stageButton').classList.add('hidden');
+            cs.changes = cs.changes || [];
+            document.getElementById('stagingSummary').textContent = cs.changes.length === 0
+                ? 'Edits are collected here and go live only when applied.'
+                : cs.changes.length + ' change(s) not live yet';
+
+            const diff = document.getElementById('stagingDiff');
+            diff.replaceChildren();
+            if (cs.diff.length === 0) {
+                diff.appendChild(diffLine(' ', 'No changes staged', 'text-gray-500'));
+            }
+            for (const d of cs.diff) {
+                const entry = document.createElement('div');
+                entry.className = 'flex items-start justify-between gap-3';
+                const lines = document.createElement('div');
+                if (d.before) lines.appendChild(diffLine('-', d.before, 'text-red-600 dark:text-red-400'));
+                if (d.after) lines.appendChild(diffLine('+', d.after, 'text-green-600 dark:text-green-400'));
+                if (d.error) lines.appendChild(diffLine('!', d.error, 'text-amber-600 dark:text-amber-400'));
+                const drop = document.createElement('button');
+                drop.className = 'text-gray-400 hover:text-red-500';
+                drop.title = 'Remove this change';
+                drop.textContent = '\u2715';
+                drop.onclick = () => dropChange(d.change_id);
+                entry.append(lines, drop);
+                diff.appendChild(entry);
+            }
+
+            const problems = document.getElementById('stagingProblems');
+            problems.replaceChildren();
+            for (const p of cs.problems) {
+                const div = document.createElement('div');
+                div.className = p.severity === 'error' ? 'text-red-600 dark:text-red-400' : 'text-amber-600 dark:text-amber-400';
+                div.textContent = p.severity + ': ' + (p.name ? p.name + ' ' : '') + (p.type ? p.type + ': ' : '') + p.message;
+                problems.appendChild(div);
+            }
+        }
+
+        async function dropChange(id) {
+            await fetch('/api/changesets/' + changesetId + '/changes/' + id, { method: 'DELETE' });
+            renderChangeset();
+        }
+
+        async function applyChangeset() {
+            if (!confirm('Apply the staged changes?')) return;
+            const resp = await fetch('/api/changesets/' + changesetId + '/apply', { method: 'POST' });
+            if (resp.ok) {
+                window.location.reload();
+            } else {
+                const err = await resp.json();
+                alert('Failed to apply changes: ' + (err.error || 'Unknown error'));
+            }
+        }
+
+        async function discardChangeset() {
+            if (!confirm('Discard the staged changes?')) return;
+            const resp = await fetch('/api/changesets/' + changesetId, { method: 'DELETE' });
+            if (resp.ok) {
+                renderChangeset();
+            } else {
+                const err = await resp.json();
+                alert('Failed to discard changes: ' + (err.error || 'Unknown error'));
+            }
+        }
         
         // Toggle priority field visibility based on record type
         function togglePriorityField(selectElement, fieldId) {
             const priorityField = document.getElementById(fieldId);
-            if (selectElement.value === 'MX') {
+            if (['MX', 'HTTPS', 'SVCB'].includes(selectElement.value)) {
                 priorityField.style.display = 'block';
             } else {
                 priorityField.style.display = 'none';
             }
         }
+
+        // HTTPS and SVCB values are composed from the target and parameter
+        // fields instead of the value field
+        // priorityValue keeps a priority of 0 (HTTPS alias mode), 10 when empty
+        function priorityValue(value) {
+            const priority = parseInt(value);
+            return isNaN(priority) ? 10 : priority;
+        }
+        function isSvcbType(type) {
+            return type === 'HTTPS' || type === 'SVCB';
+        }
+        function toggleSvcbFields(type, prefix, valueInput) {
+            const svcb = isSvcbType(type);
+            document.getElementById(prefix + 'SvcbFields').style.display = svcb ? 'block' : 'none';
+            document.getElementById(prefix === 'add' ? 'valueFieldAdd' : 'valueFieldEdit').style.display = svcb ? 'none' : 'block';
+            valueInput.required = !svcb;
+        }
+        function svcbValue(prefix) {
+            const get = id => document.getElementById(prefix + 'Svcb' + id).value.trim();
+            const parts = [get('Target') || '.'];
+            for (const [key, id] of [['alpn', 'Alpn'], ['port', 'Port'], ['ipv4hint', 'Ipv4hint'], ['ipv6hint', 'Ipv6hint']]) {
+                if (get(id)) parts.push(key + '=' + get(id));
+            }
+            if (get('Params')) parts.push(get('Params'));
+            return parts.join(' ');
+        }
+        // fillSvcbFields splits a stored value (priority, target, parameters)
+        // into the fields and returns its priority
+        function fillSvcbFields(prefix, value) {
+            const fields = value.trim().split(/\s+/);
+            const priority = /^\d+$/.test(fields[0]) ? parseInt(fields.shift()) : null;
+            const set = (id, v) => document.getElementById(prefix + 'Svcb' + id).value = v || '';
+            set('Target', fields.shift() || '.');
+            const known = {alpn: 'Alpn', port: 'Port', ipv4hint: 'Ipv4hint', ipv6hint: 'Ipv6hint'};
+            Object.values(known).forEach(id => set(id, ''));
+            const other = [];
+            for (const field of fields) {
+                const [key, ...rest] = field.split('=');
+                if (known[key]) {
+                    set(known[key], rest.join('=').replace(/^"|"$/g, ''));
+                } else {
+                    other.push(field);
+                }
+            }
+            set('Params', other.join(' '));
+            return priority;
+        }
         
         // Add event listeners for type selects
         document.addEventListener('DOMContentLoaded', function() {
@@ -815,28 +1386,189 @@ const zoneRecordsHTML = `<!DOCTYPE html>
             if (addTypeSelect) {
                 addTypeSelect.addEventListener('change', function() {
                     togglePriorityField(this, 'priorityFieldAdd');
+                    toggleSvcbFields(this.value, 'add', document.querySelector('#addRecordForm input[name="value"]'));
                 });
             }
             const editTypeSelect = document.getElementById('editRecordType');
             if (editTypeSelect) {
                 editTypeSelect.addEventListener('change', function() {
                     togglePriorityField(this, 'priorityFieldEdit');
+                    toggleSvcbFields(this.value, 'edit', document.getElementById('editRecordValue'));
                 });
             }
+            {{if .EditMode}}loadChangeset();{{end}}
+            loadProblems();
         });
+
+        // loadProblems shows the dangling records and lame name servers
+        // found by the last periodic check of the zone
+        async function loadProblems() {
+            const resp = await fetch('/api/zones/' + zoneId + '/problems');
+            const report = resp.ok ? await resp.json() : null;
+            if (!report || report.problems.length === 0) return;
+            document.getElementById('problemsSummary').textContent = report.problems.length + ' problem(s) found at ' + new Date(report.checked_at).toLocaleString();
+            const list = document.getElementById('problemsList');
+            list.replaceChildren();
+            for (const p of report.problems) {
+                const div = document.createElement('div');
+                div.className = p.severity === 'error' ? 'text-red-600 dark:text-red-400' : 'text-amber-600 dark:text-amber-400';
+                div.textContent = p.severity + ': ' + (p.name ? p.name + ' ' : '') + (p.type ? p.type + ': ' : '') + p.message;
+                list.appendChild(div);
+            }
+            document.getElementById('problemsPanel').classList.remove('hidden');
+        }
         
+        // datetime-local inputs hold local times, the API takes RFC 3339
+        function scheduleTime(value) {
+            return value ? new Date(value).toISOString() : undefined;
+        }
+        function localInputTime(iso) {
+            if (!iso) return '';
+            const d = new Date(iso);
+            return new Date(d.getTime() - d.getTimezoneOffset() * 60000).toISOString().slice(0, 16);
+        }
+        function recordTags(value) {
+            return value.split(/[,\s]+/).filter(t => t);
+        }
+
         function showAddRecordModal() {
             document.getElementById('addRecordModal').classList.remove('hidden');
             document.getElementById('addRecordModal').classList.add('flex');
             document.getElementById('priorityFieldAdd').style.display = 'none';
         }
+        function showImportRecordsModal() {
+            document.getElementById('importRecordsModal').classList.remove('hidden');
+            document.getElementById('importRecordsModal').classList.add('flex');
+        }
+        function hideImportRecordsModal() {
+            document.getElementById('importRecordsModal').classList.add('hidden');
+            document.getElementById('importRecordsModal').classList.remove('flex');
+            document.getElementById('importData').value = '';
+            document.getElementById('importFile').value = '';
+            importEdited();
+        }
+        // importEdited clears the preview, which must be redone before importing
+        function importEdited() {
+            document.getElementById('importButton').disabled = true;
+            document.getElementById('importMessage').classList.add('hidden');
+            document.getElementById('importErrors').replaceChildren();
+            document.getElementById('importPreview').classList.add('hidden');
+        }
+        function loadImportFile(event) {
+            const file = event.target.files[0];
+            if (!file) return;
+            if (file.name.toLowerCase().endsWith('.json')) {
+                document.getElementById('importFormat').value = 'json';
+            } else if (file.name.toLowerCase().endsWith('.csv')) {
+                document.getElementById('importFormat').value = 'csv';
+            }
+            const reader = new FileReader();
+            reader.onload = () => {
+                document.getElementById('importData').value = reader.result;
+                importEdited();
+            };
+            reader.readAsText(file);
+        }
+        async function submitImport(dryRun) {
+            importEdited();
+            const message = document.getElementById('importMessage');
+            const show = (text, ok) => {
+                message.textContent = text;
+                message.className = 'mt-3 text-sm ' + (ok ? 'text-green-600 dark:text-green-400' : 'text-red-600 dark:text-red-400');
+            };
+            try {
+                const resp = await fetch('/api/zones/' + zoneId + '/records/bulk', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify({
+                        format: document.getElementById('importFormat').value,
+                        data: document.getElementById('importData').value,
+                        dry_run: dryRun
+                    })
+                });
+                const result = await resp.json();
+                const errors = document.getElementById('importErrors');
+                for (const e of result.errors || []) {
+                    const li = document.createElement('li');
+                    li.textContent = (e.row ? 'Row ' + e.row + ': ' : '') + e.error;
+                    errors.appendChild(li);
+                }
+                for (const p of (result.problems || []).filter(p => p.severity === 'error')) {
+                    const li = document.createElement('li');
+                    li.textContent = (p.name || p.zone) + (p.type ? ' ' + p.type : '') + ': ' + p.message;
+                    errors.appendChild(li);
+                }
+                if (!resp.ok) {
+                    show(result.error || 'Import failed', false);
+                    return;
+                }
+                if (!dryRun) {
+                    window.location.reload();
+                    return;
+                }
+                const preview = document.getElementById('importPreview');
+                preview.replaceChildren(...result.records.map(line => {
+                    const div = document.createElement('div');
+                    div.textContent = '+ ' + line;
+                    return div;
+                }));
+                preview.classList.remove('hidden');
+                show(result.records.length + ' record(s) will be added.', true);
+                document.getElementById('importButton').disabled = false;
+            } catch(e) {
+                show('Error: ' + e.message, false);
+            }
+        }
         function hideAddRecordModal() {
             document.getElementById('addRecordModal').classList.add('hidden');
             document.getElementById('addRecordModal').classList.remove('flex');
             document.getElementById('addRecordForm').reset();
             document.getElementById('priorityFieldAdd').style.display = 'none';
+            toggleSvcbFields('', 'add', document.querySelector('#addRecordForm input[name="value"]'));
         }
         
+        // The record set modal replaces all the records of a name and type;
+        // the zone serial read with the set guards against concurrent edits
+        let rrsetEdit = null;
+        async function showRRSetModal(name, type) {
+            const path = '/api/zones/' + zoneId + '/rrsets/' + encodeURIComponent(name) + '/' + encodeURIComponent(type);
+            const resp = await fetch(path);
+            const set = await resp.json();
+            if (!resp.ok) {
+                alert('Failed to load record set: ' + (set.error || 'Unknown error'));
+                return;
+            }
+            rrsetEdit = {path: path, etag: resp.headers.get('ETag') || '*'};
+            document.getElementById('rrsetTitle').textContent = name + ' ' + type;
+            document.getElementById('rrsetValues').value = set.values.join('\n');
+            document.getElementById('rrsetTTL').value = set.ttl;
+            document.getElementById('rrsetModal').classList.remove('hidden');
+            document.getElementById('rrsetModal').classList.add('flex');
+        }
+        function hideRRSetModal() {
+            document.getElementById('rrsetModal').classList.add('hidden');
+            document.getElementById('rrsetModal').classList.remove('flex');
+        }
+        async function submitRRSet(event) {
+            event.preventDefault();
+            const data = {
+                ttl: parseInt(document.getElementById('rrsetTTL').value) || 0,
+                values: document.getElementById('rrsetValues').value.split('\n').map(v => v.trim()).filter(v => v)
+            };
+            const resp = await fetch(recordsURL(rrsetEdit.path), {
+                method: 'PUT',
+                headers: {'Content-Type': 'application/json', 'If-Match': rrsetEdit.etag},
+                body: JSON.stringify(data)
+            });
+            if (resp.ok) {
+                afterEdit();
+                return;
+            }
+            const err = await resp.json();
+            const problems = (err.problems || []).filter(p => p.severity === 'error').map(p => '\n- ' + p.name + ' ' + p.type + ': ' + p.message).join('');
+            alert('Failed to save record set: ' + (err.error || 'Unknown error') + problems);
+        }
+
         async function submitRecord(event) {
             event.preventDefault();
             const form = event.target;
@@ -844,18 +1576,23 @@ const zoneRecordsHTML = `<!DOCTYPE html>
                 zone_id: zoneId,
                 name: form.name.value,
                 type: form.type.value,
-                value: form.value.value,
+                value: isSvcbType(form.type.value) ? svcbValue('add') : form.value.value,
                 ttl: parseInt(form.ttl.value) || 3600,
-                priority: form.type.value === 'MX' ? (parseInt(form.priority.value) || 10) : 0
+                priority: ['MX', 'HTTPS', 'SVCB'].includes(form.type.value) ? priorityValue(form.priority.value) : 0,
+                activate_at: scheduleTime(form.activate_at.value),
+                expire_at: scheduleTime(form.expire_at.value),
+                comment: form.comment.value,
+                tags: recordTags(form.tags.value),
+                no_cache: form.no_cache.checked
             };
             try {
-                const resp = await fetch('/api/zones/' + zoneId + '/records', {
+                const resp = await fetch(recordsURL('/api/zones/' + zoneId + '/records'), {
                     method: 'POST',
                     headers: {'Content-Type': 'application/json'},
                     body: JSON.stringify(data)
                 });
                 if (resp.ok) {
-                    window.location.reload();
+                    afterEdit();
                 } else {
                     const err = await resp.json();
                     alert('Failed to add record: ' + (err.error || 'Unknown error'));
@@ -868,6 +1605,7 @@ const zoneRecordsHTML = `<!DOCTYPE html>
         function showEditRecordModal(id, btn) {
             const row = btn.closest('tr');
             document.getElementById('editRecordId').value = id;
+            document.getElementById('editRecordVersion').value = row.dataset.version;
             document.getElementById('editRecordName').value = row.querySelector('[data-field="name"]').textContent.trim();
             const recordType = row.querySelector('[data-field="type"]').textContent.trim();
             document.getElementById('editRecordType').value = recordType;
@@ -875,7 +1613,19 @@ const zoneRecordsHTML = `<!DOCTYPE html>
             document.getElementById('editRecordTTL').value = row.querySelector('[data-field="ttl"]').textContent.trim();
             const priorityText = row.querySelector('[data-field="priority"]').textContent.trim();
             document.getElementById('editRecordPriority').value = priorityText === '-' ? 10 : parseInt(priorityText) || 10;
-            document.getElementById('priorityFieldEdit').style.display = recordType === 'MX' ? 'block' : 'none';
+            document.getElementById('priorityFieldEdit').style.display = ['MX', 'HTTPS', 'SVCB'].includes(recordType) ? 'block' : 'none';
+            toggleSvcbFields(recordType, 'edit', document.getElementById('editRecordValue'));
+            if (isSvcbType(recordType)) {
+                const priority = fillSvcbFields('edit', document.getElementById('editRecordValue').value);
+                if (priority !== null) document.getElementById('editRecordPriority').value = priority;
+            }
+            const schedule = row.querySelector('[data-field="schedule"]');
+            document.getElementById('editRecordActivateAt').value = schedule ? localInputTime(schedule.dataset.activate) : '';
+            document.getElementById('editRecordExpireAt').value = schedule ? localInputTime(schedule.dataset.expire) : '';
+            const comment = row.querySelector('[data-field="comment"]');
+            document.getElementById('editRecordComment').value = comment ? comment.textContent.trim() : '';
+            document.getElementById('editRecordTags').value = Array.from(row.querySelectorAll('[data-tag]')).map(el => el.dataset.tag).join(', ');
+            document.getElementById('editRecordNoCache').checked = !!row.querySelector('[data-field="no-cache"]');
             document.getElementById('editRecordModal').classList.remove('hidden');
             document.getElementById('editRecordModal').classList.add('flex');
         }
@@ -893,18 +1643,27 @@ const zoneRecordsHTML = `<!DOCTYPE html>
             const data = {
                 name: document.getElementById('editRecordName').value,
                 type: recordType,
-                value: document.getElementById('editRecordValue').value,
+                value: isSvcbType(recordType) ? svcbValue('edit') : document.getElementById('editRecordValue').value,
                 ttl: parseInt(document.getElementById('editRecordTTL').value) || 3600,
-                priority: recordType === 'MX' ? (parseInt(document.getElementById('editRecordPriority').value) || 10) : 0
+                priority: ['MX', 'HTTPS', 'SVCB'].includes(recordType) ? priorityValue(document.getElementById('editRecordPriority').value) : 0,
+                activate_at: scheduleTime(document.getElementById('editRecordActivateAt').value),
+                expire_at: scheduleTime(document.getElementById('editRecordExpireAt').value),
+                comment: document.getElementById('editRecordComment').value,
+                tags: recordTags(document.getElementById('editRecordTags').value),
+                no_cache: document.getElementById('editRecordNoCache').checked
             };
             try {
-                const resp = await fetch('/api/records/' + id, {
+                const resp = await fetch(recordsURL('/api/records/' + id), {
                     method: 'PUT',
-                    headers: {'Content-Type': 'application/json'},
+                    headers: {'Content-Type': 'application/json', 'If-Match': '"' + document.getElementById('editRecordVersion').value + '"'},
                     body: JSON.stringify(data)
                 });
                 if (resp.ok) {
-                    window.location.reload();
+                    afterEdit();
+                } else if (resp.status === 412) {
+                    if (confirm('This record was changed by someone else since the page was loaded. Reload to see the changes? Your edit is not saved.')) {
+                        window.location.reload();
+                    }
                 } else {
                     const err = await resp.json();
                     alert('Failed to update record: ' + (err.error || 'Unknown error'));
@@ -914,22 +1673,39 @@ const zoneRecordsHTML = `<!DOCTYPE html>
             }
         }
         
-        async function deleteRecord(id, btn) {
-            if (!confirm('Delete this record?')) return;
+        // Refreshing acts on the live record, even while changes are staged
+        async function refreshRecord(id) {
             try {
-                const resp = await fetch('/api/records/' + id, { method: 'DELETE' });
+                const resp = await fetch('/api/zones/' + zoneId + '/records/' + id + '/refresh', { method: 'POST' });
+                const result = await resp.json();
                 if (resp.ok) {
-                    btn.closest('tr').remove();
+                    alert('Refreshed ' + result.name + ': ' + result.purged + ' cached answer(s) dropped');
                 } else {
-                    alert('Failed to delete record');
+                    alert('Failed to refresh record: ' + (result.error || 'Unknown error'));
                 }
             } catch(e) {
                 alert('Error: ' + e.message);
             }
         }
-    </script>
-` + configModalHTML + `
-</body>
+
+        async function deleteRecord(id, btn) {
+            if (!confirm('Delete this record?')) return;
+            try {
+                const resp = await fetch(recordsURL('/api/records/' + id), { method: 'DELETE' });
+                if (resp.ok && changesetId) {
+                    renderChangeset();
+                } else if (resp.ok) {
+                    btn.closest('tr').remove();
+                } else {
+                    alert('Failed to delete record');
+                }
+            } catch(e) {
+                alert('Error: ' + e.message);
+            }
+        }
+    </script>
+` + configModalHTML + `
+</body>
 </html>
 `
 
@@ -937,7 +1713,7 @@ const zoneRecordsHTML = `<!DOCTYPE html>
 const zoneSettingsHTML = `<!DOCTYPE html>
 <html lang="en">
 <head>
-    <title>SimpleDNS - {{.Zone.Name}} Settings</title>
+    <title>SimpleDNS - {{.Zone.DisplayName}} Settings</title>
 ` + headHTML + `
 </head>
 <body x-data="{ sidebarOpen: false, darkMode: localStorage.getItem('darkMode') === 'true' }" 
@@ -967,7 +1743,7 @@ const zoneSettingsHTML = `<!DOCTYPE html>
                                     class="font-medium bg-transparent border border-gray-300 dark:border-gray-700 rounded-lg px-3 py-1.5 pr-8 focus:outline-none focus:ring-2 focus:ring-brand-500 cursor-pointer appearance-none"
                                     style="background-image: url('data:image/svg+xml;charset=UTF-8,%3Csvg xmlns=%22http://www.w3.org/2000/svg%22 fill=%22none%22 viewBox=%220 0 24 24%22 stroke=%22%236b7280%22%3E%3Cpath stroke-linecap=%22round%22 stroke-linejoin=%22round%22 stroke-width=%222%22 d=%22M19 9l-7 7-7-7%22/%3E%3C/svg%3E'); background-repeat: no-repeat; background-position: right 0.5rem center; background-size: 1rem;">
                                 {{range .AllZones}}
-                                <option value="{{.Name}}" {{if eq .Name $.Zone.Name}}selected{{end}}>{{.Name}}</option>
+                                <option value="{{.Name}}" {{if eq .Name $.Zone.Name}}selected{{end}}>{{.DisplayName}}</option>
                                 {{end}}
                             </select>
                         </nav>
@@ -994,14 +1770,14 @@ const zoneSettingsHTML = `<!DOCTYPE html>
             <main class="p-4 md:p-6 2xl:p-10">
                 <div class="mb-6">
                     <div class="flex items-center gap-3 mb-2">
-                        <h1 class="text-2xl font-bold">{{.Zone.Name}}</h1>
+                        <h1 class="text-2xl font-bold">{{.Zone.DisplayName}}</h1>
                         {{if .Zone.Enabled}}
                         <span class="px-2.5 py-0.5 text-xs font-medium bg-green-100 text-green-800 dark:bg-green-900/30 dark:text-green-400 rounded-full">Active</span>
                         {{else}}
                         <span class="px-2.5 py-0.5 text-xs font-medium bg-red-100 text-red-800 dark:bg-red-900/30 dark:text-red-400 rounded-full">Disabled</span>
                         {{end}}
                     </div>
-                    <p class="text-gray-500 dark:text-gray-400 mb-4">{{len .Zone.Records}} DNS records</p>
+                    <p class="text-gray-500 dark:text-gray-400 mb-4">{{.Zone.RecordCount}} DNS records</p>
                     
                     <!-- Tabs with underline and icon -->
                     <div class="border-b border-gray-200 dark:border-gray-800">
@@ -1019,6 +1795,14 @@ const zoneSettingsHTML = `<!DOCTYPE html>
                                 </svg>
                                 Settings
                             </a>
+                            {{if and .EditMode (not .Zone.Forwarders)}}
+                            <a href="/zones/{{.Zone.Name}}/text" class="flex items-center gap-2 px-1 pb-3 border-b-2 border-transparent text-gray-500 hover:text-gray-700 dark:text-gray-400 dark:hover:text-gray-300 font-medium text-sm">
+                                <svg class="w-5 h-5" fill="none" stroke="currentColor" viewBox="0 0 24 24">
+                                    <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M10 20l4-16m4 4l4 4-4 4M6 16l-4-4 4-4"/>
+                                </svg>
+                                Zone file
+                            </a>
+                            {{end}}
                         </nav>
                     </div>
                 </div>
@@ -1032,11 +1816,11 @@ const zoneSettingsHTML = `<!DOCTYPE html>
                         <div class="grid grid-cols-1 md:grid-cols-2 gap-6">
                             <div>
                                 <label class="block text-sm font-medium text-gray-500 dark:text-gray-400 mb-1">Zone Name</label>
-                                <p class="text-lg font-mono">{{.Zone.Name}}</p>
+                                <p class="text-lg font-mono">{{.Zone.DisplayName}}{{if ne .Zone.DisplayName .Zone.Name}} <span class="text-sm text-gray-500 dark:text-gray-400">({{.Zone.Name}})</span>{{end}}</p>
                             </div>
                             <div>
                                 <label class="block text-sm font-medium text-gray-500 dark:text-gray-400 mb-1">Records Count</label>
-                                <p class="text-lg">{{len .Zone.Records}}</p>
+                                <p class="text-lg">{{.Zone.RecordCount}}</p>
                             </div>
                             <div>
                                 <label class="block text-sm font-medium text-gray-500 dark:text-gray-400 mb-1">Zone ID</label>
@@ -1058,6 +1842,554 @@ const zoneSettingsHTML = `<!DOCTYPE html>
                     </div>
                 </div>
 
+                {{if and .EditMode .SOA}}
+                <!-- Notes -->
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] mb-6" x-data="zoneNotes()" x-init="load()">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800 flex items-center justify-between">
+                        <div>
+                            <h3 class="text-lg font-semibold">Owner &amp; review</h3>
+                            <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">Who is responsible for this zone and when it must be reviewed. Reminders are sent {{.ReviewDays}} days before the review date, to the contact when it is an email address.</p>
+                        </div>
+                        <span x-show="review() === 'overdue'" class="px-2.5 py-0.5 text-xs font-medium bg-red-100 text-red-800 dark:bg-red-900/30 dark:text-red-400 rounded-full" x-cloak>Review overdue</span>
+                        <span x-show="review() === 'due'" class="px-2.5 py-0.5 text-xs font-medium bg-yellow-100 text-yellow-800 dark:bg-yellow-900/30 dark:text-yellow-400 rounded-full" x-cloak>Review due</span>
+                    </div>
+                    <form @submit.prevent="save()" class="p-5 grid grid-cols-1 md:grid-cols-3 gap-4">
+                        <div>
+                            <label class="block text-sm font-medium mb-2">Owner</label>
+                            <input type="text" x-model="notes.owner" maxlength="100" placeholder="Team or person" class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium mb-2">Contact</label>
+                            <input type="text" x-model="notes.contact" maxlength="200" placeholder="team@example.com" class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium mb-2">Review date</label>
+                            <input type="date" x-model="reviewDate" class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        </div>
+                        <div class="md:col-span-3">
+                            <label class="block text-sm font-medium mb-2">Description</label>
+                            <textarea x-model="notes.description" rows="3" maxlength="2000" class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500"></textarea>
+                        </div>
+                        <div class="md:col-span-3 flex items-center gap-4">
+                            <button type="submit" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700">Save</button>
+                            <span x-show="notes.reminded_at" class="text-sm text-gray-500 dark:text-gray-400" x-text="'Reminder sent ' + new Date(notes.reminded_at).toLocaleString()" x-cloak></span>
+                            <span x-show="saved" class="text-sm text-green-600 dark:text-green-400" x-cloak>Saved</span>
+                        </div>
+                    </form>
+                </div>
+
+                <script>
+                    function zoneNotes() {
+                        return {
+                            notes: {},
+                            reviewDate: '',
+                            saved: false,
+                            review() {
+                                if (!this.reviewDate) return '';
+                                const at = new Date(this.reviewDate + 'T00:00:00Z');
+                                const now = new Date();
+                                if (now >= at) return 'overdue';
+                                return now >= at.getTime() - {{.ReviewDays}} * 86400000 ? 'due' : '';
+                            },
+                            async load() {
+                                const resp = await fetch('/api/zones/' + {{.SOA.ID}} + '/notes');
+                                if (!resp.ok) return;
+                                this.notes = await resp.json();
+                                this.reviewDate = this.notes.review_at ? this.notes.review_at.slice(0, 10) : '';
+                            },
+                            async save() {
+                                const body = {
+                                    owner: this.notes.owner || '',
+                                    contact: this.notes.contact || '',
+                                    description: this.notes.description || ''
+                                };
+                                if (this.reviewDate) body.review_at = this.reviewDate + 'T00:00:00Z';
+                                const resp = await fetch('/api/zones/' + {{.SOA.ID}} + '/notes', {
+                                    method: 'PUT',
+                                    headers: {'Content-Type': 'application/json'},
+                                    body: JSON.stringify(body)
+                                });
+                                if (!resp.ok) {
+                                    const err = await resp.json();
+                                    alert('Error: ' + (err.error || 'failed to save the notes'));
+                                    return;
+                                }
+                                this.notes = await resp.json();
+                                this.saved = true;
+                                setTimeout(() => this.saved = false, 2000);
+                            }
+                        };
+                    }
+                </script>
+                {{end}}
+
+                {{if .ApexRecords}}
+                <!-- Served apex records -->
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] mb-6">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800">
+                        <h3 class="text-lg font-semibold">Served SOA &amp; NS</h3>
+                        <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">The apex records as the server answers them, with the glue of a name server inside the zone.</p>
+                    </div>
+                    <div class="p-5 overflow-x-auto">
+                        <pre class="font-mono text-sm text-gray-700 dark:text-gray-300">{{range .ApexRecords}}{{.}}
+{{end}}</pre>
+                    </div>
+                </div>
+                {{end}}
+
+                {{if and .EditMode .SOA}}
+                <!-- Address filter -->
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] mb-6">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800">
+                        <h3 class="text-lg font-semibold">IPv4 / IPv6 answers</h3>
+                        <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">Hide the IPv6 (or IPv4) addresses of names that also have the other kind, so clients on a network where it is broken connect right away. Names with only one kind are answered as usual.</p>
+                    </div>
+                    <form id="addressFilterForm" onsubmit="saveAddressFilter(event)" class="p-5 flex flex-wrap items-end gap-4">
+                        <div>
+                            <label class="block text-sm font-medium mb-2">Filter</label>
+                            <select name="address_filter" class="px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                                <option value="" {{if eq .SOA.AddressFilter ""}}selected{{end}}>None</option>
+                                <option value="AAAA" {{if eq .SOA.AddressFilter "AAAA"}}selected{{end}}>Hide AAAA (IPv6)</option>
+                                <option value="A" {{if eq .SOA.AddressFilter "A"}}selected{{end}}>Hide A (IPv4)</option>
+                            </select>
+                        </div>
+                        <button type="submit" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700">Save</button>
+                    </form>
+                </div>
+
+                <script>
+                    async function saveAddressFilter(event) {
+                        event.preventDefault();
+                        const body = {
+                            name: {{.SOA.Name}},
+                            enabled: {{.SOA.Enabled}},
+                            type: {{.SOA.Type}},
+                            forwarders: {{.SOA.Forwarders}},
+                            primaries: {{.SOA.Primaries}},
+                            ns: {{.SOA.NS}},
+                            ns_address: {{.SOA.NSAddress}},
+                            admin: {{.SOA.Admin}},
+                            ttl: {{.SOA.TTL}},
+                            minimum: {{.SOA.Minimum}},
+                            refresh: {{.SOA.Refresh}},
+                            retry: {{.SOA.Retry}},
+                            expire: {{.SOA.Expire}},
+                            address_filter: event.target.address_filter.value
+                        };
+                        try {
+                            const resp = await fetch('/api/zones/' + {{.SOA.ID}}, {
+                                method: 'PUT',
+                                headers: {'Content-Type': 'application/json', 'If-Match': zoneETag},
+                                body: JSON.stringify(body)
+                            });
+                            if (resp.ok) {
+                                window.location.reload();
+                            } else if (resp.status === 412) {
+                                staleEdit();
+                            } else {
+                                const err = await resp.json();
+                                alert('Failed to save the filter: ' + (err.error || 'Unknown error'));
+                            }
+                        } catch(e) {
+                            alert('Error: ' + e.message);
+                        }
+                    }
+                </script>
+                {{end}}
+
+                {{if and .EditMode .SOA (ne .SOA.Type "forward")}}
+                <!-- Maintenance -->
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] mb-6" x-data="zoneMaintenance()" x-init="load()">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800 flex items-center justify-between">
+                        <div>
+                            <h3 class="text-lg font-semibold">Maintenance</h3>
+                            <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">Stop answering for this zone and send its queries to the forwarders while its records are being rebuilt.</p>
+                        </div>
+                        <span x-show="active()" class="px-2.5 py-0.5 text-xs font-medium bg-yellow-100 text-yellow-800 dark:bg-yellow-900/30 dark:text-yellow-400 rounded-full">On</span>
+                    </div>
+                    <div class="p-5">
+                        <p x-show="state.enabled" class="text-sm text-gray-500 dark:text-gray-400 mb-3">The whole server is in maintenance (see the Overview page).</p>
+                        <button x-show="!state.zones.includes(zone)" @click="save(true)" class="px-3 py-1.5 text-sm border border-gray-300 dark:border-gray-700 hover:bg-gray-100 dark:hover:bg-white/[0.05] rounded-lg">Forward this zone upstream</button>
+                        <button x-show="state.zones.includes(zone)" @click="save(false)" class="px-3 py-1.5 text-sm bg-brand-600 text-white hover:bg-brand-700 rounded-lg">Serve this zone again</button>
+                    </div>
+                </div>
+
+                <script>
+                    function zoneMaintenance() {
+                        let name = {{.Zone.Name}}.toLowerCase();
+                        if (!name.endsWith('.')) name += '.';
+                        return {
+                            zone: name,
+                            state: { enabled: false, zones: [] },
+                            active() { return this.state.enabled || this.state.zones.includes(this.zone); },
+                            async load() {
+                                const resp = await fetch('/api/maintenance');
+                                if (resp.ok) this.state = await resp.json();
+                            },
+                            async save(on) {
+                                const zones = this.state.zones.filter(z => z !== this.zone);
+                                if (on) zones.push(this.zone);
+                                const resp = await fetch('/api/maintenance', {
+                                    method: 'PUT',
+                                    headers: {'Content-Type': 'application/json'},
+                                    body: JSON.stringify({ enabled: this.state.enabled, zones: zones })
+                                });
+                                if (!resp.ok) {
+                                    const err = await resp.json();
+                                    alert('Error: ' + (err.error || 'failed to change the maintenance mode'));
+                                    return;
+                                }
+                                this.state = await resp.json();
+                            }
+                        };
+                    }
+                </script>
+                {{end}}
+
+                {{if and .EditMode .SOA (ne .SOA.Type "forward")}}
+                <!-- Secondaries -->
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] mb-6" x-data="zoneSecondaries()" x-init="load()">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800 flex items-center justify-between">
+                        <div>
+                            <h3 class="text-lg font-semibold">Secondaries</h3>
+                            <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">Servers sent a NOTIFY when the serial of the zone changes and allowed to transfer it (AXFR over TCP). With a TSIG key, the transfer must be signed with it.</p>
+                        </div>
+                        <button x-show="secondaries.length" @click="notify()" class="px-3 py-1.5 text-sm border border-gray-300 dark:border-gray-700 hover:bg-gray-100 dark:hover:bg-white/[0.05] rounded-lg">Send NOTIFY</button>
+                    </div>
+                    <div class="p-5">
+                        <table class="w-full text-sm mb-4" x-show="secondaries.length">
+                            <thead>
+                                <tr class="text-left text-gray-500 dark:text-gray-400">
+                                    <th class="py-2 font-medium">Address</th>
+                                    <th class="py-2 font-medium">TSIG key</th>
+                                    <th class="py-2 font-medium">Algorithm</th>
+                                    <th></th>
+                                </tr>
+                            </thead>
+                            <tbody>
+                                <template x-for="s in secondaries" :key="s.id">
+                                    <tr class="border-t border-gray-100 dark:border-gray-800">
+                                        <td class="py-2 font-mono" x-text="s.address"></td>
+                                        <td class="py-2 font-mono" x-text="s.tsig_key || '-'"></td>
+                                        <td class="py-2 font-mono" x-text="s.tsig_algorithm || '-'"></td>
+                                        <td class="py-2 text-right"><button @click="remove(s)" class="text-red-600 hover:underline">Remove</button></td>
+                                    </tr>
+                                </template>
+                            </tbody>
+                        </table>
+                        <div x-show="created" class="mb-4 p-3 rounded-lg bg-yellow-50 dark:bg-yellow-900/20 text-sm">
+                            <p class="mb-1">Configure the secondary with this key; its secret is not shown again.</p>
+                            <pre class="font-mono text-xs whitespace-pre-wrap break-all" x-text="created"></pre>
+                        </div>
+                        <form @submit.prevent="add()" class="flex flex-wrap items-end gap-3">
+                            <div>
+                                <label class="block text-sm font-medium mb-2">Address</label>
+                                <input type="text" x-model="form.address" required placeholder="192.168.1.53" class="px-3 py-2 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] font-mono text-sm focus:outline-none focus:ring-2 focus:ring-brand-500">
+                            </div>
+                            <div>
+                                <label class="block text-sm font-medium mb-2">TSIG key</label>
+                                <input type="text" x-model="form.tsig_key" placeholder="optional, e.g. transfer-key" class="px-3 py-2 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] font-mono text-sm focus:outline-none focus:ring-2 focus:ring-brand-500">
+                            </div>
+                            <div>
+                                <label class="block text-sm font-medium mb-2">Algorithm</label>
+                                <select x-model="form.tsig_algorithm" class="px-3 py-2 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-gray-900 text-sm">
+                                    <option>hmac-sha256</option>
+                                    <option>hmac-sha512</option>
+                                    <option>hmac-sha384</option>
+                                    <option>hmac-sha224</option>
+                                    <option>hmac-sha1</option>
+                                </select>
+                            </div>
+                            <div>
+                                <label class="block text-sm font-medium mb-2">Secret</label>
+                                <input type="text" x-model="form.tsig_secret" placeholder="generated when empty" class="px-3 py-2 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] font-mono text-sm focus:outline-none focus:ring-2 focus:ring-brand-500">
+                            </div>
+                            <button type="submit" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700">Add</button>
+                        </form>
+                    </div>
+                </div>
+
+                <script>
+                    function zoneSecondaries() {
+                        const url = '/api/zones/' + {{.SOA.ID}};
+                        return {
+                            secondaries: [],
+                            form: { address: '', tsig_key: '', tsig_algorithm: 'hmac-sha256', tsig_secret: '' },
+                            created: '',
+                            async load() {
+                                const resp = await fetch(url + '/secondaries');
+                                if (resp.ok) this.secondaries = await resp.json();
+                            },
+                            async add() {
+                                const resp = await fetch(url + '/secondaries', {
+                                    method: 'POST',
+                                    headers: {'Content-Type': 'application/json'},
+                                    body: JSON.stringify(this.form)
+                                });
+                                const data = await resp.json();
+                                if (!resp.ok) {
+                                    alert('Failed to add the secondary: ' + (data.error || 'Unknown error'));
+                                    return;
+                                }
+                                this.created = data.tsig_key ? 'key "' + data.tsig_key.replace(/\.$/, '') + '" {\n    algorithm ' + data.tsig_algorithm.replace(/\.$/, '') + ';\n    secret "' + data.tsig_secret + '";\n};' : '';
+                                this.form = { address: '', tsig_key: '', tsig_algorithm: 'hmac-sha256', tsig_secret: '' };
+                                await this.load();
+                            },
+                            async remove(s) {
+                                if (!confirm('Remove the secondary ' + s.address + '?')) return;
+                                const resp = await fetch(url + '/secondaries/' + s.id, { method: 'DELETE' });
+                                if (!resp.ok) {
+                                    const err = await resp.json();
+                                    alert('Failed to remove the secondary: ' + (err.error || 'Unknown error'));
+                                    return;
+                                }
+                                await this.load();
+                            },
+                            async notify() {
+                                const resp = await fetch(url + '/notify', { method: 'POST' });
+                                const data = await resp.json();
+                                alert(resp.ok ? 'NOTIFY sent to ' + data.notified + ' server(s)' : 'Error: ' + (data.error || 'Unknown error'));
+                            }
+                        };
+                    }
+                </script>
+                {{end}}
+
+                {{if and .EditMode .SOA (eq .SOA.Type "forward")}}
+                <!-- Forward zone -->
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] mb-6">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800">
+                        <h3 class="text-lg font-semibold">Forwarding</h3>
+                        <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">Queries for this domain and its subdomains are sent to these servers, taking turns, instead of the global forwarders.</p>
+                    </div>
+                    <form id="forwardForm" onsubmit="saveForwarders(event)" class="p-5">
+                        <div class="mb-4">
+                            <label class="block text-sm font-medium mb-2">Forwarders</label>
+                            <input type="text" name="forwarders" value="{{.SOA.Forwarders}}" placeholder="10.0.0.53, 10.0.1.53:5353" class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500 font-mono">
+                        </div>
+                        <div class="flex justify-end">
+                            <button type="submit" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700">Save</button>
+                        </div>
+                    </form>
+                </div>
+
+                <script>
+                    async function saveForwarders(event) {
+                        event.preventDefault();
+                        const body = {
+                            name: {{.SOA.Name}},
+                            enabled: {{.SOA.Enabled}},
+                            type: 'forward',
+                            forwarders: event.target.forwarders.value,
+                            ttl: {{.SOA.TTL}},
+                            minimum: {{.SOA.Minimum}},
+                            refresh: {{.SOA.Refresh}},
+                            retry: {{.SOA.Retry}},
+                            expire: {{.SOA.Expire}}
+                        };
+                        try {
+                            const resp = await fetch('/api/zones/' + {{.SOA.ID}}, {
+                                method: 'PUT',
+                                headers: {'Content-Type': 'application/json', 'If-Match': zoneETag},
+                                body: JSON.stringify(body)
+                            });
+                            if (resp.ok) {
+                                window.location.reload();
+                            } else if (resp.status === 412) {
+                                staleEdit();
+                            } else {
+                                const err = await resp.json();
+                                alert('Failed to save forwarders: ' + (err.error || 'Unknown error'));
+                            }
+                        } catch(e) {
+                            alert('Error: ' + e.message);
+                        }
+                    }
+                </script>
+                {{end}}
+
+                {{if and .EditMode .SOA (eq .SOA.Type "secondary")}}
+                <!-- Secondary zone -->
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] mb-6" x-data="zoneTransfer()" x-init="load()">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800 flex items-center justify-between">
+                        <div>
+                            <h3 class="text-lg font-semibold">Primary servers</h3>
+                            <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">This zone is transferred from these servers (IXFR, then AXFR) at the refresh interval of its SOA, or right away when they send a NOTIFY, and served read-only. It stops being served when no primary answered within the SOA expire.</p>
+                        </div>
+                        <button @click="transfer()" :disabled="busy" class="px-3 py-1.5 text-sm border border-gray-300 dark:border-gray-700 hover:bg-gray-100 dark:hover:bg-white/[0.05] rounded-lg disabled:opacity-50">Transfer now</button>
+                    </div>
+                    <div class="p-5">
+                        <dl class="grid grid-cols-1 md:grid-cols-3 gap-4 mb-4 text-sm">
+                            <div><dt class="text-gray-500 dark:text-gray-400">Serial</dt><dd class="font-mono" x-text="status.transferred_at ? status.serial : 'not transferred yet'"></dd></div>
+                            <div><dt class="text-gray-500 dark:text-gray-400">Records</dt><dd class="font-mono" x-text="status.record_count || 0"></dd></div>
+                            <div><dt class="text-gray-500 dark:text-gray-400">Last transfer</dt><dd x-text="when(status.transferred_at)"></dd></div>
+                            <div><dt class="text-gray-500 dark:text-gray-400">Last check</dt><dd x-text="when(status.checked_at)"></dd></div>
+                            <div><dt class="text-gray-500 dark:text-gray-400">Next refresh</dt><dd x-text="when(status.next_refresh)"></dd></div>
+                            <div><dt class="text-gray-500 dark:text-gray-400">Expires</dt><dd x-text="when(status.expires_at)"></dd></div>
+                        </dl>
+                        <p x-show="status.error" class="mb-4 p-3 rounded-lg bg-red-50 dark:bg-red-900/20 text-sm text-red-700 dark:text-red-400 font-mono break-all" x-text="status.error"></p>
+                        <form id="primariesForm" onsubmit="savePrimaries(event)">
+                            <div class="mb-4">
+                                <label class="block text-sm font-medium mb-2">Primaries</label>
+                                <input type="text" name="primaries" value="{{.SOA.Primaries}}" placeholder="192.0.2.53, 198.51.100.53:5353" class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500 font-mono">
+                            </div>
+                            <div class="flex justify-end">
+                                <button type="submit" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700">Save</button>
+                            </div>
+                        </form>
+                    </div>
+                </div>
+
+                <script>
+                    function zoneTransfer() {
+                        const url = '/api/zones/' + {{.SOA.ID}} + '/transfer';
+                        return {
+                            status: {},
+                            busy: false,
+                            when(t) {
+                                return t && !t.startsWith('0001-') ? new Date(t).toLocaleString() : '-';
+                            },
+                            async load() {
+                                const resp = await fetch(url);
+                                if (resp.ok) this.status = await resp.json();
+                            },
+                            async transfer() {
+                                this.busy = true;
+                                const resp = await fetch(url, { method: 'POST' });
+                                const data = await resp.json();
+                                this.busy = false;
+                                if (!resp.ok) {
+                                    alert('Error: ' + (data.error || 'failed to transfer the zone'));
+                                    return;
+                                }
+                                this.status = data;
+                            }
+                        };
+                    }
+
+                    async function savePrimaries(event) {
+                        event.preventDefault();
+                        const body = {
+                            name: {{.SOA.Name}},
+                            enabled: {{.SOA.Enabled}},
+                            type: 'secondary',
+                            primaries: event.target.primaries.value,
+                            ttl: {{.SOA.TTL}},
+                            minimum: {{.SOA.Minimum}},
+                            refresh: {{.SOA.Refresh}},
+                            retry: {{.SOA.Retry}},
+                            expire: {{.SOA.Expire}}
+                        };
+                        try {
+                            const resp = await fetch('/api/zones/' + {{.SOA.ID}}, {
+                                method: 'PUT',
+                                headers: {'Content-Type': 'application/json', 'If-Match': zoneETag},
+                                body: JSON.stringify(body)
+                            });
+                            if (resp.ok) {
+                                window.location.reload();
+                            } else if (resp.status === 412) {
+                                staleEdit();
+                            } else {
+                                const err = await resp.json();
+                                alert('Failed to save primaries: ' + (err.error || 'Unknown error'));
+                            }
+                        } catch(e) {
+                            alert('Error: ' + e.message);
+                        }
+                    }
+                </script>
+                {{end}}
+
+                {{if and .EditMode .SOA (eq .SOA.Type "primary")}}
+                <!-- SOA and TTLs -->
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] mb-6">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800">
+                        <h3 class="text-lg font-semibold">SOA &amp; TTL</h3>
+                        <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">The default TTL applies to records created without one. The SOA minimum is how long resolvers cache negative answers. Addresses are served as glue when the name server is inside the zone; the admin contact may be an email address.</p>
+                    </div>
+                    <form id="soaForm" onsubmit="saveSOA(event)" class="p-5">
+                        <div class="grid grid-cols-1 md:grid-cols-3 gap-4 mb-4">
+                            <div>
+                                <label class="block text-sm font-medium mb-2">Name server</label>
+                                <input type="text" name="ns" value="{{.SOA.NS}}" placeholder="ns1.{{.SOA.Name}}." class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500 font-mono">
+                            </div>
+                            <div>
+                                <label class="block text-sm font-medium mb-2">Name server addresses (glue)</label>
+                                <input type="text" name="ns_address" value="{{.SOA.NSAddress}}" placeholder="192.168.1.2, fd00::2" class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500 font-mono">
+                            </div>
+                            <div>
+                                <label class="block text-sm font-medium mb-2">Admin contact</label>
+                                <input type="text" name="admin" value="{{.SOA.Admin}}" placeholder="hostmaster@{{.SOA.Name}}" class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500 font-mono">
+                            </div>
+                            <div>
+                                <label class="block text-sm font-medium mb-2">Default TTL (seconds)</label>
+                                <input type="number" name="ttl" min="1" value="{{.SOA.TTL}}" class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                            </div>
+                            <div>
+                                <label class="block text-sm font-medium mb-2">SOA minimum (seconds)</label>
+                                <input type="number" name="minimum" min="1" value="{{.SOA.Minimum}}" class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                            </div>
+                            <div>
+                                <label class="block text-sm font-medium mb-2">Serial</label>
+                                <p class="px-4 py-2.5 font-mono">{{.SOA.Serial}}</p>
+                            </div>
+                            <div>
+                                <label class="block text-sm font-medium mb-2">Refresh</label>
+                                <input type="number" name="refresh" min="1" value="{{.SOA.Refresh}}" class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                            </div>
+                            <div>
+                                <label class="block text-sm font-medium mb-2">Retry</label>
+                                <input type="number" name="retry" min="1" value="{{.SOA.Retry}}" class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                            </div>
+                            <div>
+                                <label class="block text-sm font-medium mb-2">Expire</label>
+                                <input type="number" name="expire" min="1" value="{{.SOA.Expire}}" class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                            </div>
+                        </div>
+                        <div class="flex justify-end">
+                            <button type="submit" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700">Save</button>
+                        </div>
+                    </form>
+                </div>
+
+                <script>
+                    async function saveSOA(event) {
+                        event.preventDefault();
+                        const form = event.target;
+                        const body = {
+                            name: {{.SOA.Name}},
+                            enabled: {{.SOA.Enabled}},
+                            ns: form.ns.value,
+                            ns_address: form.ns_address.value,
+                            admin: form.admin.value,
+                            ttl: parseInt(form.ttl.value),
+                            minimum: parseInt(form.minimum.value),
+                            refresh: parseInt(form.refresh.value),
+                            retry: parseInt(form.retry.value),
+                            expire: parseInt(form.expire.value)
+                        };
+                        try {
+                            const resp = await fetch('/api/zones/' + {{.SOA.ID}}, {
+                                method: 'PUT',
+                                headers: {'Content-Type': 'application/json', 'If-Match': zoneETag},
+                                body: JSON.stringify(body)
+                            });
+                            if (resp.ok) {
+                                window.location.reload();
+                            } else if (resp.status === 412) {
+                                staleEdit();
+                            } else {
+                                const err = await resp.json();
+                                alert('Failed to save zone settings: ' + (err.error || 'Unknown error'));
+                            }
+                        } catch(e) {
+                            alert('Error: ' + e.message);
+                        }
+                    }
+                </script>
+                {{end}}
+
                 {{if .EditMode}}
                 <!-- Danger Zone -->
                 <div class="rounded-2xl border border-red-200 dark:border-red-900/50 bg-red-50 dark:bg-red-900/10">
@@ -1068,7 +2400,7 @@ const zoneSettingsHTML = `<!DOCTYPE html>
                         <div class="flex items-center justify-between">
                             <div>
                                 <h4 class="font-medium text-red-700 dark:text-red-400">Delete this zone</h4>
-                                <p class="text-sm text-red-600/80 dark:text-red-400/80">Once you delete a zone, there is no going back. All records will be permanently deleted.</p>
+                                <p class="text-sm text-red-600/80 dark:text-red-400/80">The zone stops being served at once. It goes to the <a href="/trash" class="underline">trash</a> with its records, from which it can be restored until the retention ends.</p>
                             </div>
                             <button onclick="deleteZone()" class="px-4 py-2 bg-red-600 text-white rounded-lg hover:bg-red-700 transition-colors">
                                 Delete Zone
@@ -1084,13 +2416,36 @@ const zoneSettingsHTML = `<!DOCTYPE html>
     <script>
         const zoneId = {{.Zone.ID}};
         const zoneName = '{{.Zone.Name}}';
+        // The version of the settings shown, sent as If-Match so a save does
+        // not overwrite a change made meanwhile
+        const zoneETag = '"{{if .SOA}}{{.SOA.Version}}{{end}}"';
+        function staleEdit() {
+            if (confirm('This zone was changed by someone else since the page was loaded. Reload to see the changes? Your edit is not saved.')) {
+                window.location.reload();
+            }
+        }
         
         async function deleteZone() {
-            if (!confirm('Are you sure you want to delete zone ' + zoneName + '? This will remove all records and cannot be undone.')) return;
+            if (!confirm('Are you sure you want to delete zone ' + zoneName + '? It stops being served and goes to the trash with all its records.')) return;
             if (!confirm('This is your last chance. Are you really sure?')) return;
             
             try {
-                const resp = await fetch('/api/zones/' + zoneId, { method: 'DELETE' });
+                let resp = await fetch('/api/zones/' + zoneId, { method: 'DELETE' });
+                if (resp.status === 409) {
+                    // Zones with many records need the token of a first attempt
+                    const ask = await resp.json();
+                    if (!ask.confirm) {
+                        alert('Failed to delete zone: ' + (ask.error || 'Unknown error'));
+                        return;
+                    }
+                    const typed = prompt('Zone ' + zoneName + ' has ' + ask.records + ' records. Type the zone name to delete it:');
+                    if (typed === null) return;
+                    if (typed.trim().replace(/\.$/, '') !== zoneName.replace(/\.$/, '')) {
+                        alert('The name does not match, the zone was not deleted.');
+                        return;
+                    }
+                    resp = await fetch('/api/zones/' + zoneId + '?confirm=' + encodeURIComponent(ask.confirm), { method: 'DELETE' });
+                }
                 if (resp.ok) {
                     window.location.href = '/';
                 } else {
@@ -1107,11 +2462,11 @@ const zoneSettingsHTML = `<!DOCTYPE html>
 </html>
 `
 
-// Global Settings page
-const globalSettingsHTML = `<!DOCTYPE html>
+// Zone file editor page
+const zoneTextHTML = `<!DOCTYPE html>
 <html lang="en">
 <head>
-    <title>SimpleDNS - Overview</title>
+    <title>SimpleDNS - {{.Zone.DisplayName}} Zone File</title>
 ` + headHTML + `
 </head>
 <body x-data="{ sidebarOpen: false, darkMode: localStorage.getItem('darkMode') === 'true' }" 
@@ -1127,50 +2482,294 @@ const globalSettingsHTML = `<!DOCTYPE html>
             <div x-show="sidebarOpen" @click="sidebarOpen = false" 
                  class="fixed inset-0 z-40 bg-black/50 lg:hidden" x-cloak></div>
 
-            {{template "header" .}}
-
-            <!-- Main Content -->
-            <main class="p-4 md:p-6 2xl:p-10 space-y-6">
-                <!-- Stats Cards -->
-                <div class="grid grid-cols-1 gap-6 sm:grid-cols-2 lg:grid-cols-2">
-                    <article class="flex items-center gap-5 rounded-2xl border border-gray-200 bg-white p-4 dark:border-gray-800 dark:bg-white/[0.03]">
-                        <div class="inline-flex h-16 w-16 items-center justify-center rounded-xl bg-gray-100 text-gray-800 dark:bg-gray-800 dark:text-white/90">
-                            <svg xmlns="http://www.w3.org/2000/svg" fill="none" viewBox="0 0 24 24" stroke-width="1.5" stroke="currentColor" class="size-6">
-                            <path stroke-linecap="round" stroke-linejoin="round" d="M12 21a9.004 9.004 0 0 0 8.716-6.747M12 21a9.004 9.004 0 0 1-8.716-6.747M12 21c2.485 0 4.5-4.03 4.5-9S14.485 3 12 3m0 18c-2.485 0-4.5-4.03-4.5-9S9.515 3 12 3m0 0a8.997 8.997 0 0 1 7.843 4.582M12 3a8.997 8.997 0 0 0-7.843 4.582m15.686 0A11.953 11.953 0 0 1 12 10.5c-2.998 0-5.74-1.1-7.843-2.918m15.686 0A8.959 8.959 0 0 1 21 12c0 .778-.099 1.533-.284 2.253m0 0A17.919 17.919 0 0 1 12 16.5c-3.162 0-6.133-.815-8.716-2.247m0 0A9.015 9.015 0 0 1 3 12c0-1.605.42-3.113 1.157-4.418" />
+            <!-- Header -->
+            <header class="sticky top-0 z-30 flex w-full bg-white dark:bg-gray-900 border-b border-gray-200 dark:border-gray-800">
+                <div class="flex flex-grow items-center justify-between px-4 py-4 md:px-6">
+                    <div class="flex items-center gap-4">
+                        <button @click="sidebarOpen = !sidebarOpen" class="lg:hidden p-2 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">
+                            <svg class="w-6 h-6" fill="none" stroke="currentColor" viewBox="0 0 24 24">
+                                <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M4 6h16M4 12h16M4 18h16"/>
                             </svg>
-                        </div>
-                        <div>
-                            <h3 class="text-2xl font-semibold text-gray-800 dark:text-white/90">
-                                {{.ZoneCount}}
-                            </h3>
-                            <p class="flex items-center gap-3 text-gray-500 dark:text-gray-400">
-                                Total Zones
-                            </p>
-                        </div>
-                    </article>
-                    <article class="flex items-center gap-5 rounded-2xl border border-gray-200 bg-white p-4 dark:border-gray-800 dark:bg-white/[0.03]">
-                        <div class="inline-flex h-16 w-16 items-center justify-center rounded-xl bg-gray-100 text-gray-800 dark:bg-gray-800 dark:text-white/90">
-                            <svg xmlns="http://www.w3.org/2000/svg" fill="none" viewBox="0 0 24 24" stroke-width="1.5" stroke="currentColor" class="size-6">
-                            <path stroke-linecap="round" stroke-linejoin="round" d="M19.5 14.25v-2.625a3.375 3.375 0 0 0-3.375-3.375h-1.5A1.125 1.125 0 0 1 13.5 7.125v-1.5a3.375 3.375 0 0 0-3.375-3.375H8.25m0 12.75h7.5m-7.5 3H12M10.5 2.25H5.625c-.621 0-1.125.504-1.125 1.125v17.25c0 .621.504 1.125 1.125 1.125h12.75c.621 0 1.125-.504 1.125-1.125V11.25a9 9 0 0 0-9-9Z" />
+                        </button>
+                        <nav class="flex items-center gap-2 text-sm">
+                            <select onchange="if(this.value) window.location.href='/zones/' + this.value + '/text'" 
+                                    class="font-medium bg-transparent border border-gray-300 dark:border-gray-700 rounded-lg px-3 py-1.5 pr-8 focus:outline-none focus:ring-2 focus:ring-brand-500 cursor-pointer appearance-none"
+                                    style="background-image: url('data:image/svg+xml;charset=UTF-8,%3Csvg xmlns=%22http://www.w3.org/2000/svg%22 fill=%22none%22 viewBox=%220 0 24 24%22 stroke=%22%236b7280%22%3E%3Cpath stroke-linecap=%22round%22 stroke-linejoin=%22round%22 stroke-width=%222%22 d=%22M19 9l-7 7-7-7%22/%3E%3C/svg%3E'); background-repeat: no-repeat; background-position: right 0.5rem center; background-size: 1rem;">
+                                {{range .AllZones}}
+                                <option value="{{.Name}}" {{if eq .Name $.Zone.Name}}selected{{end}}>{{.DisplayName}}</option>
+                                {{end}}
+                            </select>
+                        </nav>
+                    </div>
+                    <div class="flex items-center gap-3">
+                        <button @click="darkMode = !darkMode" class="p-2 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">
+                            <svg x-show="!darkMode" class="w-5 h-5" fill="none" stroke="currentColor" viewBox="0 0 24 24">
+                                <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M20.354 15.354A9 9 0 018.646 3.646 9.003 9.003 0 0012 21a9.003 9.003 0 008.354-5.646z"/>
                             </svg>
-                        </div>
-                        <div>
-                            <h3 class="text-2xl font-semibold text-gray-800 dark:text-white/90">
-                                {{.RecordCount}}
-                            </h3>
-                            <p class="flex items-center gap-3 text-gray-500 dark:text-gray-400">
-                                Total Records
-                            </p>
-                        </div>
-                    </article>
+                            <svg x-show="darkMode" class="w-5 h-5" fill="none" stroke="currentColor" viewBox="0 0 24 24" x-cloak>
+                                <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M12 3v1m0 16v1m9-9h-1M4 12H3m15.364 6.364l-.707-.707M6.343 6.343l-.707-.707m12.728 0l-.707.707M6.343 17.657l-.707.707M16 12a4 4 0 11-8 0 4 4 0 018 0z"/>
+                            </svg>
+                        </button>
+                        <a href="/logout" class="p-2 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5 text-gray-500 dark:text-gray-400 hover:text-gray-700 dark:hover:text-white" title="Logout">
+                            <svg class="w-5 h-5" fill="none" stroke="currentColor" viewBox="0 0 24 24">
+                                <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M17 16l4-4m0 0l-4-4m4 4H7m6 4v1a3 3 0 01-3 3H6a3 3 0 01-3-3V7a3 3 0 013-3h4a3 3 0 013 3v1"/>
+                            </svg>
+                        </a>
+                    </div>
                 </div>
+            </header>
 
-                <!-- Server Info Section -->
-                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03]">
-                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800">
-                        <h3 class="text-lg font-semibold">Server informations</h3>
-                    </div>
-                    <div class="p-5">
+            <!-- Main Content -->
+            <main class="p-4 md:p-6 2xl:p-10">
+                <div class="mb-6">
+                    <div class="flex items-center gap-3 mb-2">
+                        <h1 class="text-2xl font-bold">{{.Zone.DisplayName}}</h1>
+                        {{if .Zone.Enabled}}
+                        <span class="px-2.5 py-0.5 text-xs font-medium bg-green-100 text-green-800 dark:bg-green-900/30 dark:text-green-400 rounded-full">Active</span>
+                        {{else}}
+                        <span class="px-2.5 py-0.5 text-xs font-medium bg-red-100 text-red-800 dark:bg-red-900/30 dark:text-red-400 rounded-full">Disabled</span>
+                        {{end}}
+                    </div>
+                    <p class="text-gray-500 dark:text-gray-400 mb-4">{{.Zone.RecordCount}} DNS records</p>
+                    
+                    <!-- Tabs with underline and icon -->
+                    <div class="border-b border-gray-200 dark:border-gray-800">
+                        <nav class="flex gap-6">
+                            <a href="/zones/{{.Zone.Name}}/records" class="flex items-center gap-2 px-1 pb-3 border-b-2 border-transparent text-gray-500 hover:text-gray-700 dark:text-gray-400 dark:hover:text-gray-300 font-medium text-sm">
+                                <svg class="w-5 h-5" fill="none" stroke="currentColor" viewBox="0 0 24 24">
+                                    <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M9 12h6m-6 4h6m2 5H7a2 2 0 01-2-2V5a2 2 0 012-2h5.586a1 1 0 01.707.293l5.414 5.414a1 1 0 01.293.707V19a2 2 0 01-2 2z"/>
+                                </svg>
+                                Records
+                            </a>
+                            <a href="/zones/{{.Zone.Name}}/settings" class="flex items-center gap-2 px-1 pb-3 border-b-2 border-transparent text-gray-500 hover:text-gray-700 dark:text-gray-400 dark:hover:text-gray-300 font-medium text-sm">
+                                <svg class="w-5 h-5" fill="none" stroke="currentColor" viewBox="0 0 24 24">
+                                    <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M10.325 4.317c.426-1.756 2.924-1.756 3.35 0a1.724 1.724 0 002.573 1.066c1.543-.94 3.31.826 2.37 2.37a1.724 1.724 0 001.065 2.572c1.756.426 1.756 2.924 0 3.35a1.724 1.724 0 00-1.066 2.573c.94 1.543-.826 3.31-2.37 2.37a1.724 1.724 0 00-2.572 1.065c-.426 1.756-2.924 1.756-3.35 0a1.724 1.724 0 00-2.573-1.066c-1.543.94-3.31-.826-2.37-2.37a1.724 1.724 0 00-1.065-2.572c-1.756-.426-1.756-2.924 0-3.35a1.724 1.724 0 001.066-2.573c-.94-1.543.826-3.31 2.37-2.37.996.608 2.296.07 2.572-1.065z"/>
+                                    <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M15 12a3 3 0 11-6 0 3 3 0 016 0z"/>
+                                </svg>
+                                Settings
+                            </a>
+                            <a href="/zones/{{.Zone.Name}}/text" class="flex items-center gap-2 px-1 pb-3 border-b-2 border-brand-600 text-brand-600 dark:text-brand-400 font-medium text-sm">
+                                <svg class="w-5 h-5" fill="none" stroke="currentColor" viewBox="0 0 24 24">
+                                    <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M10 20l4-16m4 4l4 4-4 4M6 16l-4-4 4-4"/>
+                                </svg>
+                                Zone file
+                            </a>
+                        </nav>
+                    </div>
+                </div>
+
+                <div x-data="zoneFileEditor()" x-init="load()" class="space-y-6">
+                    <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03]">
+                        <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800 flex flex-wrap items-center justify-between gap-3">
+                            <div>
+                                <h3 class="text-lg font-semibold">Zone File</h3>
+                                <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">The records of the zone in BIND format. The SOA and the apex NS come from the zone settings. A trailing <span class="font-mono">; active FROM..UNTIL ; comment ; tags a,b</span> sets the schedule, comment and tags of a record.</p>
+                            </div>
+                            <div class="flex items-center gap-2">
+                                <button @click="load()" :disabled="busy" class="px-4 py-2 text-sm border border-gray-300 dark:border-gray-700 rounded-lg hover:bg-gray-50 dark:hover:bg-white/5 disabled:opacity-50">Reload</button>
+                                <button @click="submit(true)" :disabled="busy" class="px-4 py-2 text-sm border border-gray-300 dark:border-gray-700 rounded-lg hover:bg-gray-50 dark:hover:bg-white/5 disabled:opacity-50">Preview</button>
+                                <button @click="submit(false)" :disabled="busy" class="px-4 py-2 text-sm bg-brand-600 text-white hover:bg-brand-700 rounded-lg disabled:opacity-50">Apply</button>
+                            </div>
+                        </div>
+                        <div class="p-5">
+                            <textarea x-ref="text" x-model="text" spellcheck="false" rows="24" class="w-full px-4 py-3 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-gray-900 font-mono text-sm whitespace-pre focus:outline-none focus:ring-2 focus:ring-brand-500"></textarea>
+                            <p x-show="message" x-text="message" :class="failed ? 'text-red-600 dark:text-red-400' : 'text-green-600 dark:text-green-400'" class="mt-3 text-sm"></p>
+                            <ul x-show="errors.length" class="mt-3 space-y-1 text-sm">
+                                <template x-for="e in errors">
+                                    <li>
+                                        <button @click="selectLine(e.line)" class="text-left text-red-600 dark:text-red-400 hover:underline">
+                                            <span class="font-mono" x-text="e.line ? 'line ' + e.line + ':' : 'zone:'"></span>
+                                            <span x-text="e.error"></span>
+                                        </button>
+                                    </li>
+                                </template>
+                            </ul>
+                        </div>
+                    </div>
+
+                    <div x-show="diff !== null" class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03]" x-cloak>
+                        <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800">
+                            <h3 class="text-lg font-semibold">Changes</h3>
+                        </div>
+                        <div class="p-5 space-y-1 font-mono text-xs break-all">
+                            <p x-show="diff && diff.length === 0" class="font-sans text-sm text-gray-500 dark:text-gray-400">No change.</p>
+                            <template x-for="d in diff || []">
+                                <div>
+                                    <div x-show="d.before" class="text-red-600 dark:text-red-400" x-text="'- ' + d.before"></div>
+                                    <div x-show="d.after" class="text-green-600 dark:text-green-400" x-text="'+ ' + d.after"></div>
+                                </div>
+                            </template>
+                            <template x-for="p in problems">
+                                <p class="font-sans text-sm" :class="p.severity === 'error' ? 'text-red-600 dark:text-red-400' : 'text-yellow-600 dark:text-yellow-400'" x-text="p.severity + ': ' + (p.name ? p.name + ' ' : '') + (p.type ? p.type + ' ' : '') + p.message"></p>
+                            </template>
+                        </div>
+                    </div>
+                </div>
+            </main>
+        </div>
+    </div>
+
+    <script>
+        function zoneFileEditor() {
+            return {
+                text: '',
+                // The serial of the zone loaded, sent as If-Match so applying
+                // does not overwrite a change made meanwhile
+                etag: '',
+                busy: false,
+                message: '',
+                failed: false,
+                errors: [],
+                diff: null,
+                problems: [],
+                async load() {
+                    this.busy = true;
+                    this.reset();
+                    try {
+                        const resp = await fetch('/api/zones/{{.Zone.ID}}/text');
+                        if (!resp.ok) {
+                            const err = await resp.json();
+                            this.fail(err.error || 'Failed to load the zone file');
+                            return;
+                        }
+                        this.etag = resp.headers.get('ETag') || '';
+                        this.text = await resp.text();
+                    } catch(e) {
+                        this.fail(e.message);
+                    } finally {
+                        this.busy = false;
+                    }
+                },
+                async submit(dryRun) {
+                    if (!dryRun && !confirm('Apply the changes of the zone file?')) return;
+                    this.busy = true;
+                    this.reset();
+                    try {
+                        const resp = await fetch('/api/zones/{{.Zone.ID}}/text' + (dryRun ? '?dry_run=true' : ''), {
+                            method: 'PUT',
+                            headers: {'Content-Type': 'text/plain', 'If-Match': this.etag},
+                            body: this.text
+                        });
+                        const body = await resp.json();
+                        if (resp.status === 412) {
+                            this.fail('The zone was changed by someone else since it was loaded.');
+                            if (confirm('This zone was changed by someone else since it was loaded. Reload it? Your edit is lost.')) this.load();
+                            return;
+                        }
+                        this.errors = body.errors || [];
+                        this.diff = body.diff || null;
+                        this.problems = body.problems || [];
+                        if (!resp.ok) {
+                            this.fail(body.error || 'Failed to apply the zone file');
+                            return;
+                        }
+                        if (dryRun) {
+                            this.message = body.diff.length + ' change(s), not applied yet.';
+                        } else {
+                            this.etag = resp.headers.get('ETag') || this.etag;
+                            this.message = body.diff.length + ' change(s) applied, serial ' + body.serial + '.';
+                        }
+                    } catch(e) {
+                        this.fail(e.message);
+                    } finally {
+                        this.busy = false;
+                    }
+                },
+                reset() {
+                    this.message = '';
+                    this.failed = false;
+                    this.errors = [];
+                    this.diff = null;
+                    this.problems = [];
+                },
+                fail(msg) {
+                    this.message = msg;
+                    this.failed = true;
+                },
+                // selectLine selects a line of the text so the error can be fixed
+                selectLine(n) {
+                    if (!n) return;
+                    const lines = this.text.split('\n');
+                    let start = 0;
+                    for (let i = 0; i < n - 1 && i < lines.length; i++) start += lines[i].length + 1;
+                    const ta = this.$refs.text;
+                    ta.focus();
+                    ta.setSelectionRange(start, start + (lines[n - 1] || '').length);
+                    const lineHeight = ta.scrollHeight / Math.max(lines.length, 1);
+                    ta.scrollTop = Math.max(0, (n - 5) * lineHeight);
+                }
+            };
+        }
+    </script>
+` + configModalHTML + `
+</body>
+</html>
+`
+
+// Global Settings page
+const globalSettingsHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>SimpleDNS - Overview</title>
+` + headHTML + `
+</head>
+<body x-data="{ sidebarOpen: false, darkMode: localStorage.getItem('darkMode') === 'true' }" 
+      x-init="$watch('darkMode', val => { localStorage.setItem('darkMode', val); document.documentElement.classList.toggle('dark', val) }); document.documentElement.classList.toggle('dark', darkMode)"
+      class="bg-gray-50 dark:bg-gray-900 text-gray-800 dark:text-white/90 font-sans">
+    
+    <div class="flex h-screen overflow-hidden">
+        {{template "sidebar" .}}
+
+        <!-- Content Area -->
+        <div class="relative flex flex-1 flex-col overflow-y-auto overflow-x-hidden">
+            
+            <div x-show="sidebarOpen" @click="sidebarOpen = false" 
+                 class="fixed inset-0 z-40 bg-black/50 lg:hidden" x-cloak></div>
+
+            {{template "header" .}}
+
+            <!-- Main Content -->
+            <main class="p-4 md:p-6 2xl:p-10 space-y-6">
+                <!-- Stats Cards -->
+                <div class="grid grid-cols-1 gap-6 sm:grid-cols-2 lg:grid-cols-2">
+                    <article class="flex items-center gap-5 rounded-2xl border border-gray-200 bg-white p-4 dark:border-gray-800 dark:bg-white/[0.03]">
+                        <div class="inline-flex h-16 w-16 items-center justify-center rounded-xl bg-gray-100 text-gray-800 dark:bg-gray-800 dark:text-white/90">
+                            <svg xmlns="http://www.w3.org/2000/svg" fill="none" viewBox="0 0 24 24" stroke-width="1.5" stroke="currentColor" class="size-6">
+                            <path stroke-linecap="round" stroke-linejoin="round" d="M12 21a9.004 9.004 0 0 0 8.716-6.747M12 21a9.004 9.004 0 0 1-8.716-6.747M12 21c2.485 0 4.5-4.03 4.5-9S14.485 3 12 3m0 18c-2.485 0-4.5-4.03-4.5-9S9.515 3 12 3m0 0a8.997 8.997 0 0 1 7.843 4.582M12 3a8.997 8.997 0 0 0-7.843 4.582m15.686 0A11.953 11.953 0 0 1 12 10.5c-2.998 0-5.74-1.1-7.843-2.918m15.686 0A8.959 8.959 0 0 1 21 12c0 .778-.099 1.533-.284 2.253m0 0A17.919 17.919 0 0 1 12 16.5c-3.162 0-6.133-.815-8.716-2.247m0 0A9.015 9.015 0 0 1 3 12c0-1.605.42-3.113 1.157-4.418" />
+                            </svg>
+                        </div>
+                        <div>
+                            <h3 class="text-2xl font-semibold text-gray-800 dark:text-white/90">
+                                {{.ZoneCount}}
+                            </h3>
+                            <p class="flex items-center gap-3 text-gray-500 dark:text-gray-400">
+                                Total Zones
+                            </p>
+                        </div>
+                    </article>
+                    <article class="flex items-center gap-5 rounded-2xl border border-gray-200 bg-white p-4 dark:border-gray-800 dark:bg-white/[0.03]">
+                        <div class="inline-flex h-16 w-16 items-center justify-center rounded-xl bg-gray-100 text-gray-800 dark:bg-gray-800 dark:text-white/90">
+                            <svg xmlns="http://www.w3.org/2000/svg" fill="none" viewBox="0 0 24 24" stroke-width="1.5" stroke="currentColor" class="size-6">
+                            <path stroke-linecap="round" stroke-linejoin="round" d="M19.5 14.25v-2.625a3.375 3.375 0 0 0-3.375-3.375h-1.5A1.125 1.125 0 0 1 13.5 7.125v-1.5a3.375 3.375 0 0 0-3.375-3.375H8.25m0 12.75h7.5m-7.5 3H12M10.5 2.25H5.625c-.621 0-1.125.504-1.125 1.125v17.25c0 .621.504 1.125 1.125 1.125h12.75c.621 0 1.125-.504 1.125-1.125V11.25a9 9 0 0 0-9-9Z" />
+                            </svg>
+                        </div>
+                        <div>
+                            <h3 class="text-2xl font-semibold text-gray-800 dark:text-white/90">
+                                {{.RecordCount}}
+                            </h3>
+                            <p class="flex items-center gap-3 text-gray-500 dark:text-gray-400">
+                                Total Records
+                            </p>
+                        </div>
+                    </article>
+                </div>
+
+                <!-- Server Info Section -->
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03]">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800">
+                        <h3 class="text-lg font-semibold">Server informations</h3>
+                    </div>
+                    <div class="p-5">
                         <div class="grid grid-cols-1 md:grid-cols-4 gap-6">
                             <div>
                                 <label class="block text-sm font-medium text-gray-500 dark:text-gray-400 mb-1">Server Role</label>
@@ -1212,7 +2811,204 @@ const globalSettingsHTML = `<!DOCTYPE html>
                     </div>
                 </div>
 
+                <!-- Live Queries Section -->
+                <div class="mt-6 rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03]" x-data="liveQueries()" x-init="start()">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800 flex flex-wrap items-center justify-between gap-3">
+                        <div>
+                            <h3 class="text-lg font-semibold">Live queries</h3>
+                            <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">
+                                <span x-show="connected" class="inline-flex items-center gap-1"><span class="w-2 h-2 rounded-full bg-green-500"></span>Streaming</span>
+                                <span x-show="!connected" class="inline-flex items-center gap-1"><span class="w-2 h-2 rounded-full bg-gray-400"></span>Reconnecting...</span>
+                                <span x-show="paused && pending > 0" x-text="' - ' + pending + ' new while paused'"></span>
+                            </p>
+                        </div>
+                        <div class="flex flex-wrap items-center gap-2">
+                            <input type="text" x-model="filter" @change="restart()" placeholder="Filter by client or name" class="w-56 px-3 py-1.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500 text-sm">
+                            <select x-model="rcode" @change="restart()" class="px-3 py-1.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500 text-sm">
+                                <option value="">All answers</option>
+                                <option value="NOERROR">NOERROR</option>
+                                <option value="NXDOMAIN">NXDOMAIN</option>
+                                <option value="SERVFAIL">SERVFAIL</option>
+                                <option value="REFUSED">REFUSED</option>
+                            </select>
+                            <button @click="togglePause()" class="px-3 py-1.5 text-sm border border-gray-300 dark:border-gray-700 hover:bg-gray-100 dark:hover:bg-white/[0.05] rounded-lg" x-text="paused ? 'Resume' : 'Pause'"></button>
+                            <button @click="rows = []; pending = 0" class="px-3 py-1.5 text-sm border border-gray-300 dark:border-gray-700 hover:bg-gray-100 dark:hover:bg-white/[0.05] rounded-lg">Clear</button>
+                        </div>
+                    </div>
+                    <div class="max-h-96 overflow-y-auto">
+                        <table class="w-full text-sm">
+                            <thead class="sticky top-0 bg-gray-50 dark:bg-gray-900 text-left text-gray-500 dark:text-gray-400">
+                                <tr>
+                                    <th class="px-5 py-2 font-medium">Time</th>
+                                    <th class="px-5 py-2 font-medium">Client</th>
+                                    <th class="px-5 py-2 font-medium">Name</th>
+                                    <th class="px-5 py-2 font-medium">Type</th>
+                                    <th class="px-5 py-2 font-medium">Answer</th>
+                                    <th class="px-5 py-2 font-medium text-right">Time taken</th>
+                                </tr>
+                            </thead>
+                            <tbody>
+                                <template x-for="q in rows" :key="q.id">
+                                    <tr class="border-t border-gray-100 dark:border-gray-800">
+                                        <td class="px-5 py-1.5 text-gray-500 dark:text-gray-400 whitespace-nowrap" x-text="new Date(q.time).toLocaleTimeString()"></td>
+                                        <td class="px-5 py-1.5 font-mono" x-text="q.client"></td>
+                                        <td class="px-5 py-1.5 font-mono break-all" x-text="q.name"></td>
+                                        <td class="px-5 py-1.5 font-mono" x-text="q.type"></td>
+                                        <td class="px-5 py-1.5">
+                                            <span :class="q.rcode === 'NOERROR' ? 'text-green-600 dark:text-green-400' : 'text-red-600 dark:text-red-400'" x-text="q.rcode"></span>
+                                            <span class="text-gray-500 dark:text-gray-400" x-text="q.source"></span>
+                                        </td>
+                                        <td class="px-5 py-1.5 text-right text-gray-500 dark:text-gray-400 whitespace-nowrap" x-text="q.duration_ms.toFixed(1) + ' ms'"></td>
+                                    </tr>
+                                </template>
+                            </tbody>
+                        </table>
+                        <p x-show="rows.length === 0" class="px-5 py-4 text-sm text-gray-500 dark:text-gray-400">No query yet.</p>
+                    </div>
+                </div>
+
+                {{if .EditMode}}
+                <!-- Backup Section -->
+                <div class="mt-6 rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03]">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800">
+                        <h3 class="text-lg font-semibold">Backup</h3>
+                    </div>
+                    <div class="p-5 flex flex-wrap items-center gap-4">
+                        <a href="/api/backup" class="px-4 py-2 text-sm bg-brand-600 text-white hover:bg-brand-700 rounded-lg transition-colors">Download backup</a>
+                        <label class="px-4 py-2 text-sm border border-gray-300 dark:border-gray-700 hover:bg-gray-100 dark:hover:bg-white/[0.05] rounded-lg cursor-pointer">
+                            Restore from file
+                            <input type="file" accept=".json,application/json" class="hidden" onchange="restoreBackup(this)">
+                        </label>
+                        <p class="text-sm text-gray-500 dark:text-gray-400">Zones, records, forwarders, users, API tokens and settings. Restoring replaces everything.</p>
+                    </div>
+                    <div class="px-5 pb-5" x-data="backups()" x-init="load()">
+                        <template x-if="!status.enabled">
+                            <p class="text-sm text-gray-500 dark:text-gray-400">Scheduled backups are disabled, set <span class="font-mono">backup.dir</span> in the configuration file to enable them.</p>
+                        </template>
+                        <template x-if="status.enabled">
+                            <div>
+                                <div class="flex flex-wrap items-center justify-between gap-4 mb-3">
+                                    <p class="text-sm text-gray-500 dark:text-gray-400">
+                                        Every <span x-text="status.interval_hours"></span>h (<span x-text="status.format"></span>) to <span class="font-mono" x-text="status.dir"></span>, keeping <span x-text="status.keep"></span>.
+                                        <span x-show="status.next_run">Next: <span x-text="formatDate(status.next_run)"></span>.</span>
+                                    </p>
+                                    <button @click="runNow()" :disabled="running" class="px-3 py-1.5 text-sm border border-gray-300 dark:border-gray-700 hover:bg-gray-100 dark:hover:bg-white/[0.05] rounded-lg disabled:opacity-50">
+                                        <span x-text="running ? 'Running...' : 'Back up now'"></span>
+                                    </button>
+                                </div>
+                                <p x-show="status.last_error" class="text-sm text-red-600 dark:text-red-400 mb-3">Last backup failed: <span x-text="status.last_error"></span></p>
+                                <table class="w-full text-sm">
+                                    <template x-for="f in status.history" :key="f.name">
+                                        <tr class="border-b border-gray-100 dark:border-gray-800">
+                                            <td class="py-2"><a :href="'/api/backups/' + encodeURIComponent(f.name)" class="font-mono hover:text-brand-600 hover:underline" x-text="f.name"></a></td>
+                                            <td class="py-2 text-gray-500 dark:text-gray-400" x-text="formatDate(f.created_at)"></td>
+                                            <td class="py-2 text-right text-gray-500 dark:text-gray-400" x-text="(f.size / 1024).toFixed(1) + ' KB'"></td>
+                                        </tr>
+                                    </template>
+                                </table>
+                                <p x-show="status.history.length === 0" class="text-sm text-gray-500 dark:text-gray-400">No backup yet.</p>
+                            </div>
+                        </template>
+                    </div>
+                </div>
+
+                <!-- Maintenance Section -->
+                <div class="mt-6 rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03]" x-data="maintenanceMode()" x-init="load()">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800 flex items-center justify-between">
+                        <div>
+                            <h3 class="text-lg font-semibold">Maintenance mode</h3>
+                            <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">Stop answering from local zones and send every query to the forwarders, while zone data is being rebuilt. Single zones can be put in maintenance from their settings.</p>
+                        </div>
+                        <span x-show="state.enabled" class="px-2.5 py-0.5 text-xs font-medium bg-yellow-100 text-yellow-800 dark:bg-yellow-900/30 dark:text-yellow-400 rounded-full">On</span>
+                    </div>
+                    <div class="p-5">
+                        <p x-show="state.zones.length > 0" class="text-sm mb-3">Zones in maintenance: <span class="font-mono" x-text="state.zones.join(', ')"></span></p>
+                        <p x-show="state.since" class="text-sm text-gray-500 dark:text-gray-400 mb-3">Since <span x-text="new Date(state.since).toLocaleString()"></span></p>
+                        <button x-show="!state.enabled" @click="save(true)" class="px-3 py-1.5 text-sm border border-gray-300 dark:border-gray-700 hover:bg-gray-100 dark:hover:bg-white/[0.05] rounded-lg">Forward all zones upstream</button>
+                        <button x-show="state.enabled" @click="save(false)" class="px-3 py-1.5 text-sm bg-brand-600 text-white hover:bg-brand-700 rounded-lg">Serve local zones again</button>
+                    </div>
+                </div>
+
+                <!-- Address filter Section -->
+                <div class="mt-6 rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03]" x-data="addressFilter()" x-init="load()">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800">
+                        <h3 class="text-lg font-semibold">IPv4 / IPv6 answers by client</h3>
+                        <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">Hide AAAA (or A) answers from clients on networks where IPv6 (or IPv4) is broken, for names that have both kinds. The first matching rule wins over the setting of the zone.</p>
+                    </div>
+                    <div class="p-5">
+                        <template x-for="(rule, i) in rules" :key="i">
+                            <div class="flex flex-wrap items-center gap-3 mb-3">
+                                <input type="text" x-model="rule.clients" placeholder="192.168.1.0/24, 10.0.0.5" class="flex-1 min-w-[16rem] px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500 font-mono text-sm">
+                                <select x-model="rule.type" class="px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500 text-sm">
+                                    <option value="AAAA">Hide AAAA (IPv6)</option>
+                                    <option value="A">Hide A (IPv4)</option>
+                                </select>
+                                <button @click="rules.splice(i, 1)" class="px-3 py-2 text-sm text-red-500 hover:bg-red-50 dark:hover:bg-red-900/20 rounded-lg">Remove</button>
+                            </div>
+                        </template>
+                        <p x-show="rules.length === 0" class="text-sm text-gray-500 dark:text-gray-400 mb-3">No rule: every client gets both kinds of addresses.</p>
+                        <div class="flex gap-3">
+                            <button @click="rules.push({ clients: '', type: 'AAAA' })" class="px-3 py-1.5 text-sm border border-gray-300 dark:border-gray-700 hover:bg-gray-100 dark:hover:bg-white/[0.05] rounded-lg">Add rule</button>
+                            <button @click="save()" class="px-3 py-1.5 text-sm bg-brand-600 text-white hover:bg-brand-700 rounded-lg">Save</button>
+                        </div>
+                    </div>
+                </div>
+                {{end}}
+
                 <script>
+                    function maintenanceMode() {
+                        return {
+                            state: { enabled: false, zones: [] },
+                            async load() {
+                                const resp = await fetch('/api/maintenance');
+                                if (resp.ok) this.state = await resp.json();
+                            },
+                            async save(enabled) {
+                                if (enabled && !confirm('Forward every query upstream? Names only in local zones stop resolving.')) return;
+                                const resp = await fetch('/api/maintenance', {
+                                    method: 'PUT',
+                                    headers: {'Content-Type': 'application/json'},
+                                    body: JSON.stringify({ enabled: enabled, zones: this.state.zones })
+                                });
+                                if (!resp.ok) {
+                                    const err = await resp.json();
+                                    alert('Error: ' + (err.error || 'failed to change the maintenance mode'));
+                                    return;
+                                }
+                                this.state = await resp.json();
+                            }
+                        };
+                    }
+
+                    function addressFilter() {
+                        return {
+                            rules: [],
+                            async load() {
+                                const resp = await fetch('/api/address-filter');
+                                if (!resp.ok) return;
+                                const rules = await resp.json();
+                                this.rules = rules.map(r => ({ clients: r.clients.join(', '), type: r.type }));
+                            },
+                            async save() {
+                                const body = this.rules.map(r => ({
+                                    clients: r.clients.split(',').map(c => c.trim()).filter(c => c),
+                                    type: r.type
+                                }));
+                                const resp = await fetch('/api/address-filter', {
+                                    method: 'PUT',
+                                    headers: {'Content-Type': 'application/json'},
+                                    body: JSON.stringify(body)
+                                });
+                                if (!resp.ok) {
+                                    const err = await resp.json();
+                                    alert('Error: ' + (err.error || 'failed to save the rules'));
+                                    return;
+                                }
+                                this.load();
+                            }
+                        };
+                    }
+
                     // Fetch and display server IP
                     fetch('/api/server-info')
                         .then(r => r.json())
@@ -1223,6 +3019,86 @@ const globalSettingsHTML = `<!DOCTYPE html>
                             document.getElementById('serverIP').textContent = 'Error loading';
                         });
                     
+                    function backups() {
+                        return {
+                            status: { enabled: false, history: [] },
+                            running: false,
+                            formatDate(d) {
+                                return new Date(d).toLocaleString();
+                            },
+                            async load() {
+                                const resp = await fetch('/api/backups');
+                                if (resp.ok) this.status = await resp.json();
+                            },
+                            async runNow() {
+                                this.running = true;
+                                const resp = await fetch('/api/backups', { method: 'POST' });
+                                if (!resp.ok) {
+                                    const body = await resp.json();
+                                    alert('Error: ' + (body.error || 'backup failed'));
+                                }
+                                this.running = false;
+                                this.load();
+                            }
+                        };
+                    }
+
+                    async function restoreBackup(input) {
+                        const file = input.files[0];
+                        input.value = '';
+                        if (!file || !confirm('Replace all zones, records, forwarders, users and settings with ' + file.name + '?')) return;
+                        const form = new FormData();
+                        form.append('file', file);
+                        const resp = await fetch('/api/restore', { method: 'POST', body: form });
+                        const body = await resp.json();
+                        if (!resp.ok) {
+                            alert('Error: ' + (body.error || 'restore failed'));
+                            return;
+                        }
+                        alert('Backup restored');
+                        window.location.reload();
+                    }
+
+                    function liveQueries() {
+                        return {
+                            rows: [],
+                            pending: 0,
+                            paused: false,
+                            connected: false,
+                            filter: '',
+                            rcode: '',
+                            source: null,
+                            start() {
+                                const params = new URLSearchParams({ backlog: '100' });
+                                if (this.rcode) params.set('rcode', this.rcode);
+                                this.source = new EventSource('/api/queries/stream?' + params);
+                                this.source.onopen = () => { this.connected = true; };
+                                this.source.onerror = () => { this.connected = false; };
+                                this.source.addEventListener('query', (e) => this.add(JSON.parse(e.data)));
+                            },
+                            restart() {
+                                if (this.source) this.source.close();
+                                this.rows = [];
+                                this.pending = 0;
+                                this.start();
+                            },
+                            add(q) {
+                                const f = this.filter.trim().toLowerCase();
+                                if (f && !q.client.includes(f) && !q.name.includes(f)) return;
+                                if (this.paused) {
+                                    this.pending++;
+                                    return;
+                                }
+                                this.rows.unshift(q);
+                                if (this.rows.length > 200) this.rows.length = 200;
+                            },
+                            togglePause() {
+                                this.paused = !this.paused;
+                                if (!this.paused) this.pending = 0;
+                            }
+                        };
+                    }
+
                     function copyServerIP() {
                         const ip = document.getElementById('serverIP').textContent;
                         
@@ -1306,45 +3182,60 @@ const forwardersHTML = `<!DOCTYPE html>
                             <h3 class="text-lg font-semibold">DNS Forwarders</h3>
                             <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">Configure upstream DNS servers for queries that don't match any local zone</p>
                         </div>
-                        {{if and .EditMode (lt (len .Forwarders) 2)}}
+                        {{if .EditMode}}
                         <button onclick="showAddForwarderModal()" class="flex items-center gap-2 px-4 py-2 text-sm bg-brand-600 text-white hover:bg-brand-700 rounded-lg transition-colors">
                             <svg class="w-4 h-4" fill="none" stroke="currentColor" viewBox="0 0 24 24">
                                 <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M12 4v16m8-8H4"/>
                             </svg>
                             Add Forwarder
                         </button>
-                        {{else if and .EditMode (ge (len .Forwarders) 2)}}
-                        <div class="flex items-center gap-2 px-4 py-2 text-sm text-gray-500 dark:text-gray-400">
-                            <svg class="w-4 h-4" fill="none" stroke="currentColor" viewBox="0 0 24 24">
-                                <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M12 9v2m0 4h.01m-6.938 4h13.856c1.54 0 2.502-1.667 1.732-2.5L13.732 4c-.77-.833-1.964-.833-2.732 0L3.732 16.5c-.77.833.192 2.5 1.732 2.5z"/>
-                            </svg>
-                            Maximum 2 forwarders allowed
-                        </div>
                         {{end}}
                     </div>
                     <div class="p-5">
                         {{if .Forwarders}}
                         <div class="space-y-3" id="forwarders-list">
                             {{range .ForwarderDisplays}}
-                            <div class="flex items-center justify-between px-4 py-3 bg-gray-50 dark:bg-gray-800/50 rounded-lg" data-forwarder="{{.Address}}">
+                            <div class="flex items-center justify-between px-4 py-3 bg-gray-50 dark:bg-gray-800/50 rounded-lg" data-forwarder="{{.Address}}" data-priority="{{.Stat.Priority}}"{{if and $.EditMode .ID}} data-id="{{.ID}}" draggable="true"{{end}}>
                                 <div class="flex items-center gap-3">
+                                    {{if and $.EditMode .ID}}
+                                    <svg class="w-4 h-4 text-gray-400 cursor-move" fill="none" stroke="currentColor" viewBox="0 0 24 24" aria-label="Drag to reorder">
+                                        <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M4 8h16M4 16h16"/>
+                                    </svg>
+                                    {{end}}
                                     <div class="flex h-10 w-10 items-center justify-center rounded-lg bg-brand-100 dark:bg-brand-900/20">
                                         <svg class="w-5 h-5 text-brand-600 dark:text-brand-400" fill="none" stroke="currentColor" viewBox="0 0 24 24">
                                             <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M5 12h14M12 5l7 7-7 7"/>
                                         </svg>
                                     </div>
-                                    <span class="font-mono text-sm">{{.Display}}</span>
+                                    <div>
+                                        <span class="font-mono text-sm">{{.Display}}</span>
+                                        <p class="text-xs text-gray-500 dark:text-gray-400">
+                                            priority {{.Stat.Priority}}{{if .Stat.Weight}}, weight {{.Stat.Weight}}{{end}} &middot;
+                                            timeout {{if .Stat.TimeoutMS}}{{.Stat.TimeoutMS}}{{else}}{{$.DefaultTimeoutMS}}{{end}} ms{{if .Stat.Retries}}, {{.Stat.Retries}} retr{{if eq .Stat.Retries 1}}y{{else}}ies{{end}}, backoff {{.Stat.BackoffMS}} ms{{end}}
+                                            &middot; {{.Stat.Queries}} queries, {{printf "%.1f" .Stat.ErrorRate}}% errors
+                                        </p>
+                                    </div>
                                 </div>
                                 {{if $.EditMode}}
+                                <div class="flex items-center gap-1">
+                                {{if .ID}}
+                                <button onclick="showOptionsModal({{.ID}}, {{.Address}}, {{.Stat.Priority}}, {{.Stat.Weight}}, {{.Stat.TimeoutMS}}, {{.Stat.Retries}}, {{.Stat.BackoffMS}})" class="p-2 text-gray-500 hover:text-gray-700 hover:bg-gray-100 dark:hover:bg-white/5 rounded-lg transition-colors" title="Priority, timeout and retries">
+                                    <svg class="w-5 h-5" fill="none" stroke="currentColor" viewBox="0 0 24 24">
+                                        <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M12 8v4l3 3m6-3a9 9 0 11-18 0 9 9 0 0118 0z"/>
+                                    </svg>
+                                </button>
+                                {{end}}
                                 <button onclick="deleteForwarder('{{.Address}}', this)" class="p-2 text-red-500 hover:text-red-700 hover:bg-red-50 dark:hover:bg-red-900/20 rounded-lg transition-colors">
                                     <svg class="w-5 h-5" fill="none" stroke="currentColor" viewBox="0 0 24 24">
                                         <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M19 7l-.867 12.142A2 2 0 0116.138 21H7.862a2 2 0 01-1.995-1.858L5 7m5 4v6m4-6v6m1-10V4a1 1 0 00-1-1h-4a1 1 0 00-1 1v3M4 7h16"/>
                                     </svg>
                                 </button>
+                                </div>
                                 {{end}}
                             </div>
                             {{end}}
                         </div>
+                        <p class="text-xs text-gray-500 dark:text-gray-400 mt-3">Servers are asked by priority, lowest first{{if .EditMode}} (drag to reorder){{end}}. Among servers of the same priority, the first one asked rotates between queries in proportion to its weight. A server that fails is retried as configured, then the next one is asked.</p>
                         {{else}}
                         <div class="text-center py-10">
                             <svg class="mx-auto w-12 h-12 mb-4 text-gray-300 dark:text-gray-600" fill="none" stroke="currentColor" viewBox="0 0 24 24">
@@ -1356,25 +3247,183 @@ const forwardersHTML = `<!DOCTYPE html>
                         {{end}}
                     </div>
                 </div>
+
+                <!-- Forwarder benchmark -->
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] mt-6 overflow-hidden" x-data="forwarderBenchmark()">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800 flex justify-between items-center">
+                        <div>
+                            <h3 class="text-lg font-semibold">Test forwarders</h3>
+                            <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">Ask the configured forwarders and candidate servers the same names, ranked by failure rate, then median latency</p>
+                        </div>
+                        <button @click="run()" :disabled="running" class="flex items-center gap-2 px-4 py-2 text-sm bg-brand-600 text-white hover:bg-brand-700 disabled:opacity-50 rounded-lg transition-colors">
+                            <span x-text="running ? 'Testing...' : 'Test forwarders'"></span>
+                        </button>
+                    </div>
+                    <div class="p-5">
+                        <label class="block text-sm font-medium mb-2">Candidates</label>
+                        <input type="text" x-model="candidates" placeholder="1.1.1.1, 9.9.9.9:53" class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] font-mono text-sm focus:outline-none focus:ring-2 focus:ring-brand-500">
+                        <p class="text-xs text-gray-500 dark:text-gray-400 mt-2">Comma-separated servers tested with the forwarders. DNSSEC "validates" when the server sets AD on signed answers, "passes" when it only returns the signatures. EDNS is compliant when the OPT record is echoed and an EDNS version 1 query gets BADVERS.</p>
+                    </div>
+                    <template x-if="result">
+                        <div>
+                            <div class="overflow-x-auto border-t border-gray-200 dark:border-gray-800">
+                                <table class="w-full text-sm">
+                                    <thead class="border-b border-gray-200 dark:border-gray-800 bg-gray-50 dark:bg-white/[0.02]">
+                                        <tr class="text-xs uppercase text-gray-500 dark:text-gray-400">
+                                            <th class="px-5 py-3 text-left font-medium">#</th>
+                                            <th class="px-5 py-3 text-left font-medium">Server</th>
+                                            <th class="px-5 py-3 text-right font-medium">Median</th>
+                                            <th class="px-5 py-3 text-right font-medium">Max</th>
+                                            <th class="px-5 py-3 text-right font-medium">Failures</th>
+                                            <th class="px-5 py-3 text-left font-medium">DNSSEC</th>
+                                            <th class="px-5 py-3 text-left font-medium">EDNS</th>
+                                        </tr>
+                                    </thead>
+                                    <tbody class="divide-y divide-gray-100 dark:divide-gray-800">
+                                        <template x-for="r in result.results" :key="r.address">
+                                            <tr :class="result.recommended.includes(r.address) ? 'bg-green-50 dark:bg-green-900/10' : ''">
+                                                <td class="px-5 py-3" x-text="r.rank"></td>
+                                                <td class="px-5 py-3">
+                                                    <span class="font-mono" x-text="r.address"></span>
+                                                    <span x-show="r.configured" class="ml-2 text-xs px-2 py-0.5 rounded-full bg-brand-100 text-brand-700 dark:bg-brand-900/20 dark:text-brand-400">configured</span>
+                                                    <p x-show="r.error" class="text-xs text-red-600 dark:text-red-400" x-text="r.error"></p>
+                                                </td>
+                                                <td class="px-5 py-3 text-right" x-text="r.latency_ms ? r.latency_ms.toFixed(1) + ' ms' : '-'"></td>
+                                                <td class="px-5 py-3 text-right" x-text="r.max_ms ? r.max_ms.toFixed(1) + ' ms' : '-'"></td>
+                                                <td class="px-5 py-3 text-right" :class="r.failures ? 'text-red-600 dark:text-red-400' : ''" x-text="r.failures + '/' + r.queries"></td>
+                                                <td class="px-5 py-3" x-text="r.dnssec"></td>
+                                                <td class="px-5 py-3">
+                                                    <span x-show="r.edns" class="text-green-600 dark:text-green-400">compliant</span>
+                                                    <span x-show="r.edns_issue" class="text-red-600 dark:text-red-400" :title="r.edns_issue">not compliant</span>
+                                                    <span x-show="!r.edns && !r.edns_issue" class="text-gray-400">-</span>
+                                                </td>
+                                            </tr>
+                                        </template>
+                                    </tbody>
+                                </table>
+                            </div>
+                            <div class="px-5 py-4 border-t border-gray-200 dark:border-gray-800 flex justify-between items-center gap-4">
+                                <p class="text-sm text-gray-500 dark:text-gray-400">
+                                    <template x-if="result.recommended.length">
+                                        <span>Fastest healthy set: <span class="font-mono" x-text="result.recommended.join(', ')"></span></span>
+                                    </template>
+                                    <template x-if="!result.recommended.length">
+                                        <span>No server answered every query with compliant EDNS.</span>
+                                    </template>
+                                </p>
+                                {{if .EditMode}}
+                                <button x-show="result.recommended.length" @click="adopt()" class="px-4 py-2 text-sm bg-brand-600 text-white hover:bg-brand-700 rounded-lg transition-colors whitespace-nowrap">Use these forwarders</button>
+                                {{end}}
+                            </div>
+                        </div>
+                    </template>
+                </div>
+
+                {{if .Upstreams}}
+                <!-- Upstream health -->
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] mt-6 overflow-hidden">
+                    <div class="px-5 py-4 border-b border-gray-200 dark:border-gray-800">
+                        <h3 class="text-lg font-semibold">Upstream health</h3>
+                        <p class="text-sm text-gray-500 dark:text-gray-400 mt-1">Queries sent to each upstream since the server started, forward zones included</p>
+                    </div>
+                    <div class="overflow-x-auto">
+                        <table class="w-full text-sm">
+                            <thead class="border-b border-gray-200 dark:border-gray-800 bg-gray-50 dark:bg-white/[0.02]">
+                                <tr class="text-xs uppercase text-gray-500 dark:text-gray-400">
+                                    <th class="px-5 py-3 text-left font-medium">Upstream</th>
+                                    <th class="px-5 py-3 text-right font-medium">Queries</th>
+                                    <th class="px-5 py-3 text-right font-medium">Errors</th>
+                                    <th class="px-5 py-3 text-right font-medium">Timeouts</th>
+                                    <th class="px-5 py-3 text-right font-medium">Error rate</th>
+                                </tr>
+                            </thead>
+                            <tbody class="divide-y divide-gray-100 dark:divide-gray-800">
+                                {{range .Upstreams}}
+                                <tr>
+                                    <td class="px-5 py-3 font-mono">{{.Address}}</td>
+                                    <td class="px-5 py-3 text-right">{{.Queries}}</td>
+                                    <td class="px-5 py-3 text-right">{{.Errors}}</td>
+                                    <td class="px-5 py-3 text-right">{{.Timeouts}}</td>
+                                    <td class="px-5 py-3 text-right {{if ge .ErrorRate 10.0}}text-red-600 dark:text-red-400{{end}}">{{printf "%.1f" .ErrorRate}}%</td>
+                                </tr>
+                                {{end}}
+                            </tbody>
+                        </table>
+                    </div>
+                </div>
+                {{end}}
             </main>
         </div>
     </div>
 
     {{if .EditMode}}
-    <!-- Add Forwarder Modal -->
-    <div id="addForwarderModal" class="fixed inset-0 bg-black/50 hidden items-center justify-center z-50">
+    <!-- Forwarder Options Modal -->
+    <div id="optionsModal" class="fixed inset-0 bg-black/50 hidden items-center justify-center z-50">
         <div class="bg-white dark:bg-gray-900 rounded-2xl p-6 w-full max-w-md mx-4 shadow-xl">
-            <h2 class="text-xl font-bold mb-4">Add Forwarder</h2>
-            <form id="addForwarderForm" onsubmit="submitForwarder(event)">
-                <div class="mb-4">
-                    <label class="block text-sm font-medium mb-2">DNS Server Address</label>
-                    <input type="text" name="address" required placeholder="8.8.8.8 or 8.8.8.8:53" 
-                           class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
-                    <p class="text-xs text-gray-500 mt-2">IP address or hostname, optionally with port (default: 53)</p>
+            <h2 class="text-xl font-bold mb-1">Forwarder options</h2>
+            <p id="optionsAddress" class="font-mono text-sm text-gray-500 dark:text-gray-400 mb-4"></p>
+            <form id="optionsForm" onsubmit="saveOptions(event)">
+                <div class="grid grid-cols-2 gap-3 mb-4">
+                    <div>
+                        <label class="block text-sm font-medium mb-2">Priority</label>
+                        <input type="number" name="priority" min="0" placeholder="0" class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium mb-2">Weight</label>
+                        <input type="number" name="weight" min="0" max="100" placeholder="1" class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    </div>
                 </div>
-                <div class="flex gap-3 justify-end">
-                    <button type="button" onclick="hideAddForwarderModal()" class="px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">Cancel</button>
-                    <button type="submit" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700">Add Forwarder</button>
+                <div class="grid grid-cols-3 gap-3 mb-4">
+                    <div>
+                        <label class="block text-sm font-medium mb-2">Timeout (ms)</label>
+                        <input type="number" name="timeout_ms" min="0" placeholder="{{.DefaultTimeoutMS}}" class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium mb-2">Retries</label>
+                        <input type="number" name="retries" min="0" max="5" placeholder="0" class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium mb-2">Backoff (ms)</label>
+                        <input type="number" name="backoff_ms" min="0" placeholder="0" class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    </div>
+                </div>
+                <p class="text-xs text-gray-500 mb-4">Empty values use the defaults. The backoff doubles after each retry.</p>
+                <div class="flex gap-3 justify-end">
+                    <button type="button" onclick="hideOptionsModal()" class="px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">Cancel</button>
+                    <button type="submit" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700">Save</button>
+                </div>
+            </form>
+        </div>
+    </div>
+
+    <!-- Add Forwarder Modal -->
+    <div id="addForwarderModal" class="fixed inset-0 bg-black/50 hidden items-center justify-center z-50">
+        <div class="bg-white dark:bg-gray-900 rounded-2xl p-6 w-full max-w-md mx-4 shadow-xl">
+            <h2 class="text-xl font-bold mb-4">Add Forwarder</h2>
+            <form id="addForwarderForm" onsubmit="submitForwarder(event)">
+                <div class="mb-4">
+                    <label class="block text-sm font-medium mb-2">DNS Server Address</label>
+                    <input type="text" name="address" required placeholder="8.8.8.8 or 8.8.8.8:53" 
+                           class="w-full px-4 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    <p class="text-xs text-gray-500 mt-2">IP address or hostname, optionally with port (default: 53)</p>
+                </div>
+                <div class="grid grid-cols-3 gap-3 mb-4">
+                    <div>
+                        <label class="block text-sm font-medium mb-2">Timeout (ms)</label>
+                        <input type="number" name="timeout_ms" min="0" placeholder="{{.DefaultTimeoutMS}}" class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium mb-2">Retries</label>
+                        <input type="number" name="retries" min="0" max="5" placeholder="0" class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium mb-2">Backoff (ms)</label>
+                        <input type="number" name="backoff_ms" min="0" placeholder="0" class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    </div>
+                </div>
+                <div class="flex gap-3 justify-end">
+                    <button type="button" onclick="hideAddForwarderModal()" class="px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">Cancel</button>
+                    <button type="submit" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700">Add Forwarder</button>
                 </div>
             </form>
         </div>
@@ -1397,20 +3446,25 @@ const forwardersHTML = `<!DOCTYPE html>
             event.preventDefault();
             const form = event.target;
             
-            // Check if we already have 2 forwarders (client-side validation)
-            const currentForwarders = document.querySelectorAll('[data-forwarder]');
-            if (currentForwarders.length >= 2) {
-                alert('Maximum 2 forwarders allowed');
-                return;
-            }
-            
+            // A new forwarder is asked with the last ones
+            let priority = 0;
+            document.querySelectorAll('[data-forwarder]').forEach(el => {
+                priority = Math.max(priority, parseInt(el.dataset.priority) || 0);
+            });
+
             let address = form.address.value.trim();
             if (!address.includes(':')) address = address + ':53';
             try {
                 const resp = await fetch('/api/forwarders', {
                     method: 'POST',
                     headers: {'Content-Type': 'application/json'},
-                    body: JSON.stringify({ address: address })
+                    body: JSON.stringify({
+                        address: address,
+                        priority: priority,
+                        timeout_ms: parseInt(form.timeout_ms.value) || 0,
+                        retries: parseInt(form.retries.value) || 0,
+                        backoff_ms: parseInt(form.backoff_ms.value) || 0
+                    })
                 });
                 if (resp.ok) {
                     window.location.reload();
@@ -1423,6 +3477,138 @@ const forwardersHTML = `<!DOCTYPE html>
             }
         }
         
+        // Drag to reorder: the new order gives the forwarders the
+        // priorities 0, 1, 2...
+        let dragged = null;
+        document.querySelectorAll('#forwarders-list [data-id]').forEach(row => {
+            row.addEventListener('dragstart', () => {
+                dragged = row;
+                row.classList.add('opacity-50');
+            });
+            row.addEventListener('dragend', () => {
+                row.classList.remove('opacity-50');
+                dragged = null;
+            });
+            row.addEventListener('dragover', e => {
+                e.preventDefault();
+                if (!dragged || dragged === row) return;
+                const rect = row.getBoundingClientRect();
+                const after = e.clientY > rect.top + rect.height / 2;
+                row.parentNode.insertBefore(dragged, after ? row.nextSibling : row);
+            });
+            row.addEventListener('drop', async e => {
+                e.preventDefault();
+                const ids = Array.from(document.querySelectorAll('#forwarders-list [data-id]')).map(el => parseInt(el.dataset.id));
+                try {
+                    const resp = await fetch('/api/forwarders/order', {
+                        method: 'PUT',
+                        headers: {'Content-Type': 'application/json'},
+                        body: JSON.stringify({ ids: ids })
+                    });
+                    if (resp.ok) {
+                        window.location.reload();
+                    } else {
+                        const err = await resp.json();
+                        alert('Failed to reorder forwarders: ' + (err.error || 'Unknown error'));
+                    }
+                } catch(err) {
+                    alert('Error: ' + err.message);
+                }
+            });
+        });
+
+        function forwarderBenchmark() {
+            return {
+                candidates: {{.Candidates}},
+                running: false,
+                result: null,
+                async run() {
+                    this.running = true;
+                    try {
+                        const resp = await fetch('/api/forwarders/benchmark', {
+                            method: 'POST',
+                            headers: {'Content-Type': 'application/json'},
+                            body: JSON.stringify({ candidates: this.candidates.split(',').map(s => s.trim()).filter(s => s) })
+                        });
+                        const data = await resp.json();
+                        if (!resp.ok) {
+                            alert('Failed to test forwarders: ' + (data.error || 'Unknown error'));
+                            return;
+                        }
+                        this.result = data;
+                    } catch(e) {
+                        alert('Error: ' + e.message);
+                    } finally {
+                        this.running = false;
+                    }
+                },
+                async adopt() {
+                    if (!confirm('Replace the forwarders with ' + this.result.recommended.join(', ') + '?')) return;
+                    try {
+                        const resp = await fetch('/api/forwarders', {
+                            method: 'PUT',
+                            headers: {'Content-Type': 'application/json'},
+                            body: JSON.stringify({ addresses: this.result.recommended })
+                        });
+                        if (resp.ok) {
+                            window.location.reload();
+                        } else {
+                            const err = await resp.json();
+                            alert('Failed to replace forwarders: ' + (err.error || 'Unknown error'));
+                        }
+                    } catch(e) {
+                        alert('Error: ' + e.message);
+                    }
+                }
+            };
+        }
+
+        let optionsId = 0;
+        function showOptionsModal(id, address, priority, weight, timeout, retries, backoff) {
+            optionsId = id;
+            const form = document.getElementById('optionsForm');
+            document.getElementById('optionsAddress').textContent = address;
+            form.priority.value = priority;
+            form.weight.value = weight || '';
+            form.timeout_ms.value = timeout || '';
+            form.retries.value = retries || '';
+            form.backoff_ms.value = backoff || '';
+            document.getElementById('optionsModal').classList.remove('hidden');
+            document.getElementById('optionsModal').classList.add('flex');
+        }
+
+        function hideOptionsModal() {
+            document.getElementById('optionsModal').classList.add('hidden');
+            document.getElementById('optionsModal').classList.remove('flex');
+        }
+
+        async function saveOptions(event) {
+            event.preventDefault();
+            const form = event.target;
+            const body = {
+                priority: parseInt(form.priority.value) || 0,
+                weight: parseInt(form.weight.value) || 0,
+                timeout_ms: parseInt(form.timeout_ms.value) || 0,
+                retries: parseInt(form.retries.value) || 0,
+                backoff_ms: parseInt(form.backoff_ms.value) || 0
+            };
+            try {
+                const resp = await fetch('/api/forwarders/' + optionsId, {
+                    method: 'PUT',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify(body)
+                });
+                if (resp.ok) {
+                    window.location.reload();
+                } else {
+                    const err = await resp.json();
+                    alert('Failed to save options: ' + (err.error || 'Unknown error'));
+                }
+            } catch(e) {
+                alert('Error: ' + e.message);
+            }
+        }
+
         async function deleteForwarder(address, btn) {
             if (!confirm('Remove forwarder ' + address + '?')) return;
             try {
@@ -1482,10 +3668,1178 @@ const replicationHTML = `<!DOCTYPE html>
                         </div>
                     </div>
                 </div>
+
+                {{if .EditMode}}
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-6">
+                    {{if eq .ServerRole "slave"}}
+                    <h4 class="font-semibold mb-1">Read-only slave</h4>
+                    <p class="text-sm text-gray-500 dark:text-gray-400 mb-4">Zones, records and forwarders cannot be changed on this server. Promote it if the master is gone for good.</p>
+                    <button onclick="changeRole('promote')" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700">Promote to master</button>
+                    {{else}}
+                    <h4 class="font-semibold mb-1">Master</h4>
+                    <p class="text-sm text-gray-500 dark:text-gray-400 mb-4">Demoting this server makes its zones, records and forwarders read-only.</p>
+                    <button onclick="changeRole('demote')" class="px-4 py-2 border border-gray-300 dark:border-gray-800 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">Demote to slave</button>
+                    {{end}}
+                </div>
+                {{end}}
+            </main>
+        </div>
+    </div>
+
+    <script>
+        async function changeRole(action) {
+            if (!confirm(action === 'promote' ? 'Promote this server to master?' : 'Demote this server to a read-only slave?')) return;
+
+            try {
+                const resp = await fetch('/api/replication/' + action, { method: 'POST' });
+                if (resp.ok) {
+                    window.location.reload();
+                } else {
+                    const err = await resp.json();
+                    alert('Failed to change role: ' + (err.error || 'Unknown error'));
+                }
+            } catch(e) {
+                alert('Error: ' + e.message);
+            }
+        }
+    </script>
+` + configModalHTML + `
+</body>
+</html>
+`
+
+// Analytics page template
+const analyticsHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>SimpleDNS - Analytics</title>
+` + headHTML + `
+    <script src="/static/vendor/chart.umd.min.js"></script>
+</head>
+<body x-data="{ sidebarOpen: false, darkMode: localStorage.getItem('darkMode') === 'true' }" 
+      x-init="$watch('darkMode', val => { localStorage.setItem('darkMode', val); document.documentElement.classList.toggle('dark', val) }); document.documentElement.classList.toggle('dark', darkMode)"
+      class="bg-gray-50 dark:bg-gray-900 text-gray-800 dark:text-white/90 font-sans">
+    <div class="flex h-screen overflow-hidden">
+        {{template "sidebar" .}}
+
+        <div class="relative flex flex-1 flex-col overflow-y-auto overflow-x-hidden">
+            <div x-show="sidebarOpen" @click="sidebarOpen = false" class="fixed inset-0 z-40 bg-black/50 lg:hidden" x-cloak></div>
+            {{template "header" .}}
+
+            <main class="p-4 md:p-6 2xl:p-10" x-data="analytics()" x-init="load(); setInterval(() => load(), 30000)">
+                <div class="flex justify-end mb-4">
+                    <select x-model="minutes" @change="load()" class="px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-gray-900">
+                        <option value="60">Last hour</option>
+                        <option value="360">Last 6 hours</option>
+                        <option value="1440">Last 24 hours</option>
+                        {{if .EditMode}}
+                        <option value="10080">Last 7 days</option>
+                        <option value="43200">Last 30 days</option>
+                        {{end}}
+                    </select>
+                </div>
+
+                <div class="grid grid-cols-1 md:grid-cols-4 gap-4 mb-6">
+                    <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                        <p class="text-sm text-gray-500 dark:text-gray-400">Queries</p>
+                        <p class="text-2xl font-semibold" x-text="report.total"></p>
+                    </div>
+                    <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                        <p class="text-sm text-gray-500 dark:text-gray-400">QPS (last minute)</p>
+                        <p class="text-2xl font-semibold" x-text="report.qps.toFixed(2)"></p>
+                    </div>
+                    <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                        <p class="text-sm text-gray-500 dark:text-gray-400">Answered locally</p>
+                        <p class="text-2xl font-semibold" x-text="percent(report.sources.local)"></p>
+                    </div>
+                    <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                        <p class="text-sm text-gray-500 dark:text-gray-400">Forwarded / cached</p>
+                        <p class="text-2xl font-semibold" x-text="percent(report.sources.forwarded) + ' / ' + percent(report.sources.cached)"></p>
+                    </div>
+                </div>
+
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5 mb-6">
+                    <h3 class="text-lg font-semibold mb-4" x-text="hourly() ? 'Queries per hour' : 'Queries per minute'"></h3>
+                    <div class="h-64"><canvas id="qpsChart"></canvas></div>
+                </div>
+
+                <div class="grid grid-cols-1 lg:grid-cols-3 gap-6">
+                    <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                        <h3 class="text-lg font-semibold mb-4">Response codes</h3>
+                        <div class="h-56"><canvas id="rcodeChart"></canvas></div>
+                    </div>
+                    <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                        <h3 class="text-lg font-semibold mb-4">Top names</h3>
+                        <table class="w-full text-sm">
+                            <template x-for="e in report.top_names" :key="e.key">
+                                <tr class="border-b border-gray-100 dark:border-gray-800">
+                                    <td class="py-2 font-mono truncate" x-text="e.key"></td>
+                                    <td class="py-2 text-right" x-text="e.count"></td>
+                                </tr>
+                            </template>
+                        </table>
+                    </div>
+                    <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                        <h3 class="text-lg font-semibold mb-4">Top clients</h3>
+                        <table class="w-full text-sm">
+                            <template x-for="e in report.top_clients" :key="e.key">
+                                <tr class="border-b border-gray-100 dark:border-gray-800">
+                                    <td class="py-2 font-mono" x-text="e.key"></td>
+                                    <td class="py-2 text-right" x-text="e.count"></td>
+                                </tr>
+                            </template>
+                        </table>
+                    </div>
+                </div>
+            </main>
+        </div>
+    </div>
+
+    <script>
+        function analytics() {
+            let qpsChart = null, rcodeChart = null;
+            return {
+                minutes: '60',
+                report: { total: 0, qps: 0, sources: { local: 0, forwarded: 0, cached: 0 }, rcodes: {}, top_names: [], top_clients: [], series: [] },
+                percent(n) {
+                    return this.report.total ? Math.round(100 * n / this.report.total) + '%' : '-';
+                },
+                // hourly reports the windows longer than a day, read from
+                // the hourly rollups
+                hourly() {
+                    return Number(this.minutes) > 1440;
+                },
+                async load() {
+                    try {
+                        const query = this.hourly() ? 'hours=' + (this.minutes / 60) : 'minutes=' + this.minutes;
+                        const resp = await fetch('/api/stats?' + query);
+                        if (!resp.ok) return;
+                        this.report = await resp.json();
+                        this.draw();
+                    } catch(e) {
+                        console.error(e);
+                    }
+                },
+                draw() {
+                    const labels = this.report.series.map(p => this.hourly()
+                        ? new Date(p.time * 1000).toLocaleString([], { month: 'short', day: 'numeric', hour: '2-digit' })
+                        : new Date(p.time * 1000).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' }));
+                    const datasets = [
+                        { label: 'Local', data: this.report.series.map(p => p.local), borderColor: '#2563eb', backgroundColor: 'rgba(37,99,235,0.2)', fill: true },
+                        { label: 'Forwarded', data: this.report.series.map(p => p.forwarded), borderColor: '#f59e0b', backgroundColor: 'rgba(245,158,11,0.2)', fill: true },
+                        { label: 'Cached', data: this.report.series.map(p => p.cached), borderColor: '#10b981', backgroundColor: 'rgba(16,185,129,0.2)', fill: true }
+                    ];
+                    if (qpsChart) {
+                        qpsChart.data.labels = labels;
+                        qpsChart.data.datasets.forEach((d, i) => d.data = datasets[i].data);
+                        qpsChart.update('none');
+                    } else {
+                        qpsChart = new Chart(document.getElementById('qpsChart'), {
+                            type: 'line',
+                            data: { labels, datasets },
+                            options: { maintainAspectRatio: false, pointRadius: 0, tension: 0.3, scales: { y: { stacked: true, beginAtZero: true } } }
+                        });
+                    }
+
+                    const rcodes = Object.keys(this.report.rcodes).sort();
+                    const counts = rcodes.map(k => this.report.rcodes[k]);
+                    if (rcodeChart) {
+                        rcodeChart.data.labels = rcodes;
+                        rcodeChart.data.datasets[0].data = counts;
+                        rcodeChart.update('none');
+                    } else {
+                        rcodeChart = new Chart(document.getElementById('rcodeChart'), {
+                            type: 'doughnut',
+                            data: { labels: rcodes, datasets: [{ data: counts, backgroundColor: ['#10b981', '#f59e0b', '#ef4444', '#6366f1', '#8b5cf6', '#64748b', '#94a3b8'] }] },
+                            options: { maintainAspectRatio: false }
+                        });
+                    }
+                }
+            };
+        }
+    </script>
+` + configModalHTML + `
+</body>
+</html>
+`
+
+// Sinkhole page template
+const sinkholeHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>SimpleDNS - Sinkhole</title>
+` + headHTML + `
+</head>
+<body x-data="{ sidebarOpen: false, darkMode: localStorage.getItem('darkMode') === 'true' }" 
+      x-init="$watch('darkMode', val => { localStorage.setItem('darkMode', val); document.documentElement.classList.toggle('dark', val) }); document.documentElement.classList.toggle('dark', darkMode)"
+      class="bg-gray-50 dark:bg-gray-900 text-gray-800 dark:text-white/90 font-sans">
+    <div class="flex h-screen overflow-hidden">
+        {{template "sidebar" .}}
+
+        <div class="relative flex flex-1 flex-col overflow-y-auto overflow-x-hidden">
+            <div x-show="sidebarOpen" @click="sidebarOpen = false" class="fixed inset-0 z-40 bg-black/50 lg:hidden" x-cloak></div>
+            {{template "header" .}}
+
+            <main class="p-4 md:p-6 2xl:p-10" x-data="sinkhole()" x-init="load(); setInterval(() => load(), 30000)">
+                <div x-show="loaded && !status.enabled" x-cloak class="rounded-2xl border border-yellow-200 dark:border-yellow-800 bg-yellow-50 dark:bg-yellow-900/20 p-5 mb-6 text-sm text-yellow-800 dark:text-yellow-300">
+                    The sinkhole is disabled. Set <code>sinkhole.enabled: true</code> in the configuration file to block domains.
+                </div>
+
+                <div class="grid grid-cols-1 md:grid-cols-4 gap-4 mb-6">
+                    <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                        <p class="text-sm text-gray-500 dark:text-gray-400">Blocked domains</p>
+                        <p class="text-2xl font-semibold" x-text="status.blocked"></p>
+                    </div>
+                    <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                        <p class="text-sm text-gray-500 dark:text-gray-400">Hits since start</p>
+                        <p class="text-2xl font-semibold" x-text="status.hits"></p>
+                    </div>
+                    <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                        <p class="text-sm text-gray-500 dark:text-gray-400">Answered IPv4</p>
+                        <p class="text-2xl font-semibold font-mono" x-text="status.ipv4 || '-'"></p>
+                    </div>
+                    <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                        <p class="text-sm text-gray-500 dark:text-gray-400">Answered IPv6</p>
+                        <p class="text-2xl font-semibold font-mono truncate" x-text="status.ipv6 || '-'"></p>
+                    </div>
+                </div>
+
+                <div class="grid grid-cols-1 lg:grid-cols-2 gap-6">
+                    <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                        <h3 class="text-lg font-semibold mb-4">Top blocked domains</h3>
+                        <p x-show="status.top_hits.length === 0" class="text-sm text-gray-500 dark:text-gray-400">No blocked query yet.</p>
+                        <table class="w-full text-sm">
+                            <template x-for="e in status.top_hits" :key="e.key">
+                                <tr class="border-b border-gray-100 dark:border-gray-800">
+                                    <td class="py-2 font-mono truncate" x-text="e.key"></td>
+                                    <td class="py-2 text-right" x-text="e.count"></td>
+                                </tr>
+                            </template>
+                        </table>
+                    </div>
+
+                    <div class="space-y-6">
+                        <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                            <h3 class="text-lg font-semibold mb-1">Blocked domains</h3>
+                            <p class="text-sm text-gray-500 dark:text-gray-400 mb-4">Each domain is blocked with all its subdomains.</p>
+                            <template x-for="d in status.domains" :key="'cfg-' + d">
+                                <div class="flex items-center justify-between py-2 border-b border-gray-100 dark:border-gray-800 text-sm">
+                                    <span class="font-mono" x-text="d"></span>
+                                    <span class="text-xs text-gray-500 dark:text-gray-400">config file</span>
+                                </div>
+                            </template>
+                            <template x-for="d in status.custom_domains" :key="'ui-' + d">
+                                <div class="flex items-center justify-between py-2 border-b border-gray-100 dark:border-gray-800 text-sm">
+                                    <span class="font-mono" x-text="d"></span>
+                                    {{if .EditMode}}
+                                    <button @click="remove(d)" class="text-red-600 hover:text-red-700 text-xs">Remove</button>
+                                    {{end}}
+                                </div>
+                            </template>
+                            {{if .EditMode}}
+                            <form @submit.prevent="add()" class="flex gap-2 mt-4">
+                                <input type="text" x-model="newDomain" placeholder="ads.example.com" class="flex-1 px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-gray-900 font-mono text-sm">
+                                <button type="submit" class="px-4 py-2 bg-brand-600 hover:bg-brand-700 text-white rounded-lg text-sm">Block</button>
+                            </form>
+                            {{end}}
+                            <p x-show="error" x-text="error" class="mt-2 text-sm text-red-600"></p>
+                        </div>
+
+                        <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                            <div class="flex items-center justify-between mb-4">
+                                <h3 class="text-lg font-semibold">Blocklists</h3>
+                                {{if .EditMode}}
+                                <button x-show="status.lists.length > 0" @click="refresh()" :disabled="refreshing" class="px-3 py-1.5 border border-gray-300 dark:border-gray-700 rounded-lg text-sm" x-text="refreshing ? 'Refreshing...' : 'Refresh now'"></button>
+                                {{end}}
+                            </div>
+                            <p x-show="status.lists.length === 0" class="text-sm text-gray-500 dark:text-gray-400">No list configured (sinkhole.lists).</p>
+                            <table class="w-full text-sm">
+                                <template x-for="l in status.lists" :key="l.source">
+                                    <tr class="border-b border-gray-100 dark:border-gray-800">
+                                        <td class="py-2 font-mono break-all" x-text="l.source"></td>
+                                        <td class="py-2 text-right whitespace-nowrap">
+                                            <span x-show="!l.error" x-text="l.domains + ' domains'"></span>
+                                            <span x-show="l.error" class="text-red-600" :title="l.error" x-text="'error (' + l.domains + ' kept)'"></span>
+                                        </td>
+                                    </tr>
+                                </template>
+                            </table>
+                        </div>
+                    </div>
+                </div>
+            </main>
+        </div>
+    </div>
+
+    <script>
+        function sinkhole() {
+            return {
+                loaded: false,
+                status: { enabled: false, blocked: 0, hits: 0, domains: [], custom_domains: [], lists: [], top_hits: [] },
+                newDomain: '',
+                error: '',
+                refreshing: false,
+                async load() {
+                    try {
+                        const resp = await fetch('/api/sinkhole');
+                        if (!resp.ok) return;
+                        this.status = await resp.json();
+                        this.loaded = true;
+                    } catch(e) {
+                        console.error(e);
+                    }
+                },
+                async save(domains) {
+                    this.error = '';
+                    const resp = await fetch('/api/sinkhole/domains', {
+                        method: 'PUT',
+                        headers: { 'Content-Type': 'application/json' },
+                        body: JSON.stringify(domains)
+                    });
+                    const data = await resp.json();
+                    if (!resp.ok) {
+                        this.error = data.error || 'Failed to save';
+                        return false;
+                    }
+                    this.status = data;
+                    return true;
+                },
+                async add() {
+                    const domain = this.newDomain.trim();
+                    if (!domain) return;
+                    if (await this.save(this.status.custom_domains.concat([domain]))) {
+                        this.newDomain = '';
+                    }
+                },
+                async remove(domain) {
+                    await this.save(this.status.custom_domains.filter(d => d !== domain));
+                },
+                async refresh() {
+                    this.refreshing = true;
+                    try {
+                        const resp = await fetch('/api/sinkhole/refresh', { method: 'POST' });
+                        if (resp.ok) this.status = await resp.json();
+                    } finally {
+                        this.refreshing = false;
+                    }
+                }
+            };
+        }
+    </script>
+` + configModalHTML + `
+</body>
+</html>
+`
+
+// Trash page: deleted zones and records, restorable until the retention
+// ends
+const trashHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>SimpleDNS - Trash</title>
+` + headHTML + `
+</head>
+<body x-data="{ sidebarOpen: false, darkMode: localStorage.getItem('darkMode') === 'true' }" 
+      x-init="$watch('darkMode', val => { localStorage.setItem('darkMode', val); document.documentElement.classList.toggle('dark', val) }); document.documentElement.classList.toggle('dark', darkMode)"
+      class="bg-gray-50 dark:bg-gray-900 text-gray-800 dark:text-white/90 font-sans">
+    <div class="flex h-screen overflow-hidden">
+        {{template "sidebar" .}}
+
+        <div class="relative flex flex-1 flex-col overflow-y-auto overflow-x-hidden">
+            <div x-show="sidebarOpen" @click="sidebarOpen = false" class="fixed inset-0 z-40 bg-black/50 lg:hidden" x-cloak></div>
+            {{template "header" .}}
+
+            <main class="p-4 md:p-6 2xl:p-10" x-data="trash()" x-init="load()">
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03]">
+                    <div class="px-5 py-4 sm:px-6 border-b border-gray-200 dark:border-gray-800">
+                        <h3 class="text-lg font-semibold">Deleted zones and records</h3>
+                        <p class="text-sm text-gray-500 dark:text-gray-400">{{if .RetentionDays}}They can be restored for {{.RetentionDays}} days after their deletion, then they are deleted for good.{{else}}The trash is disabled (trash_retention_days), deletions are final.{{end}} A record is restored into its zone, which must exist.</p>
+                    </div>
+                    <p x-show="loaded && items.length === 0" class="px-5 py-4 sm:px-6 text-sm text-gray-500 dark:text-gray-400">The trash is empty.</p>
+                    <p x-show="error" x-text="error" class="px-5 py-4 sm:px-6 text-sm text-red-600"></p>
+                    <div x-show="items.length > 0" class="overflow-x-auto">
+                        <table class="w-full text-sm">
+                            <thead>
+                                <tr class="border-b border-gray-200 dark:border-gray-800 text-left text-gray-500 dark:text-gray-400">
+                                    <th class="px-5 py-3 sm:px-6 font-medium">Deleted</th>
+                                    <th class="px-5 py-3 sm:px-6 font-medium">Zone</th>
+                                    <th class="px-5 py-3 sm:px-6 font-medium">Record</th>
+                                    <th class="px-5 py-3 sm:px-6 font-medium">Expires</th>
+                                    <th class="px-5 py-3 sm:px-6"></th>
+                                </tr>
+                            </thead>
+                            <tbody>
+                                <template x-for="item in items" :key="item.id">
+                                    <tr class="border-b border-gray-100 dark:border-gray-800">
+                                        <td class="px-5 py-3 sm:px-6 whitespace-nowrap" x-text="new Date(item.deleted_at).toLocaleString()"></td>
+                                        <td class="px-5 py-3 sm:px-6 font-mono" x-text="item.zone_name"></td>
+                                        <td class="px-5 py-3 sm:px-6">
+                                            <span x-show="item.kind === 'zone'" class="text-gray-500 dark:text-gray-400" x-text="'whole zone, ' + item.records + ' records'"></span>
+                                            <span x-show="item.kind === 'record'" class="font-mono break-all" x-text="item.name + ' ' + item.type + ' ' + item.value"></span>
+                                        </td>
+                                        <td class="px-5 py-3 sm:px-6 whitespace-nowrap text-gray-500 dark:text-gray-400" x-text="new Date(item.expires_at).toLocaleDateString()"></td>
+                                        <td class="px-5 py-3 sm:px-6">
+                                            {{if .EditMode}}
+                                            <div class="flex items-center justify-end gap-2">
+                                                <button @click="restore(item)" class="px-3 py-1.5 bg-brand-600 hover:bg-brand-700 text-white rounded-lg text-xs">Restore</button>
+                                                <button @click="purge(item)" class="px-3 py-1.5 text-red-600 hover:text-red-700 text-xs">Delete for good</button>
+                                            </div>
+                                            {{end}}
+                                        </td>
+                                    </tr>
+                                </template>
+                            </tbody>
+                        </table>
+                    </div>
+                </div>
+            </main>
+        </div>
+    </div>
+
+    <script>
+        function trash() {
+            return {
+                loaded: false,
+                items: [],
+                error: '',
+                async load() {
+                    const resp = await fetch('/api/trash');
+                    if (!resp.ok) {
+                        this.error = 'Failed to load the trash';
+                        return;
+                    }
+                    this.items = await resp.json();
+                    this.loaded = true;
+                },
+                async restore(item) {
+                    this.error = '';
+                    const resp = await fetch('/api/trash/' + item.id + '/restore', { method: 'POST' });
+                    const data = await resp.json();
+                    if (!resp.ok) {
+                        this.error = 'Failed to restore: ' + (data.error || 'Unknown error');
+                        return;
+                    }
+                    await this.load();
+                },
+                async purge(item) {
+                    const what = item.kind === 'zone' ? 'zone ' + item.zone_name : item.name + ' ' + item.type + ' ' + item.value;
+                    if (!confirm('Delete ' + what + ' for good? It cannot be restored afterwards.')) return;
+                    this.error = '';
+                    const resp = await fetch('/api/trash/' + item.id, { method: 'DELETE' });
+                    if (!resp.ok) {
+                        const data = await resp.json();
+                        this.error = 'Failed to delete: ' + (data.error || 'Unknown error');
+                        return;
+                    }
+                    await this.load();
+                }
+            };
+        }
+    </script>
+` + configModalHTML + `
+</body>
+</html>
+`
+
+// Clients page: query counts per client address, with their names and
+// policies
+const clientsHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>SimpleDNS - Clients</title>
+` + headHTML + `
+</head>
+<body x-data="{ sidebarOpen: false, darkMode: localStorage.getItem('darkMode') === 'true' }" 
+      x-init="$watch('darkMode', val => { localStorage.setItem('darkMode', val); document.documentElement.classList.toggle('dark', val) }); document.documentElement.classList.toggle('dark', darkMode)"
+      class="bg-gray-50 dark:bg-gray-900 text-gray-800 dark:text-white/90 font-sans">
+    <div class="flex h-screen overflow-hidden">
+        {{template "sidebar" .}}
+
+        <div class="relative flex flex-1 flex-col overflow-y-auto overflow-x-hidden">
+            <div x-show="sidebarOpen" @click="sidebarOpen = false" class="fixed inset-0 z-40 bg-black/50 lg:hidden" x-cloak></div>
+            {{template "header" .}}
+
+            <main class="p-4 md:p-6 2xl:p-10" x-data="clients()" x-init="load()">
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03]">
+                    <div class="px-5 py-4 sm:px-6 border-b border-gray-200 dark:border-gray-800 flex justify-between items-center gap-4">
+                        <div>
+                            <h3 class="text-lg font-semibold">Clients</h3>
+                            <p class="text-sm text-gray-500 dark:text-gray-400">Queries by client address since <span x-text="since ? new Date(since).toLocaleString() : ''"></span>, the busiest first.<span x-show="!resolveNames"> Set clients.resolve_names to name them from their PTR record.</span></p>
+                        </div>
+                        <input type="search" x-model="filter" placeholder="Filter" class="px-3 py-2 text-sm border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                    </div>
+                    <p x-show="loaded && items.length === 0" class="px-5 py-4 sm:px-6 text-sm text-gray-500 dark:text-gray-400">No client has queried the server yet.</p>
+                    <p x-show="error" x-text="error" class="px-5 py-4 sm:px-6 text-sm text-red-600"></p>
+                    <div x-show="items.length > 0" class="overflow-x-auto">
+                        <table class="w-full text-sm">
+                            <thead>
+                                <tr class="border-b border-gray-200 dark:border-gray-800 text-left text-gray-500 dark:text-gray-400">
+                                    <th class="px-5 py-3 sm:px-6 font-medium">Device</th>
+                                    <th class="px-5 py-3 sm:px-6 font-medium text-right">Queries</th>
+                                    <th class="px-5 py-3 sm:px-6 font-medium text-right">Blocked</th>
+                                    <th class="px-5 py-3 sm:px-6 font-medium">Last seen</th>
+                                    <th class="px-5 py-3 sm:px-6 font-medium">Policy</th>
+                                    <th class="px-5 py-3 sm:px-6"></th>
+                                </tr>
+                            </thead>
+                            <tbody>
+                                <template x-for="item in shown()" :key="item.address">
+                                    <tr class="border-b border-gray-100 dark:border-gray-800">
+                                        <td class="px-5 py-3 sm:px-6">
+                                            <div x-show="item.name" x-text="item.name" class="font-medium"></div>
+                                            <div class="font-mono text-xs text-gray-500 dark:text-gray-400" x-text="item.address"></div>
+                                        </td>
+                                        <td class="px-5 py-3 sm:px-6 text-right" x-text="item.queries"></td>
+                                        <td class="px-5 py-3 sm:px-6 text-right">
+                                            <span x-text="item.blocked"></span>
+                                            <span x-show="item.queries" class="text-xs text-gray-500 dark:text-gray-400" x-text="'(' + (item.blocked * 100 / item.queries).toFixed(1) + '%)'"></span>
+                                        </td>
+                                        <td class="px-5 py-3 sm:px-6 whitespace-nowrap">
+                                            <div x-text="item.last_seen ? new Date(item.last_seen).toLocaleString() : 'not seen'"></div>
+                                            <div class="font-mono text-xs text-gray-500 dark:text-gray-400 break-all" x-text="item.last_name || ''"></div>
+                                        </td>
+                                        <td class="px-5 py-3 sm:px-6">
+                                            <span x-show="item.policy_group" class="text-xs px-2 py-0.5 rounded-full bg-brand-100 text-brand-700 dark:bg-brand-900/20 dark:text-brand-400" :title="item.group ? 'Assigned group' : 'Group of its network'" x-text="item.policy_group"></span>
+                                            <span class="text-xs text-gray-500 dark:text-gray-400" x-text="blockingText(item)"></span>
+                                            <span x-show="item.safe_search" class="text-xs px-2 py-0.5 rounded-full bg-green-100 text-green-700 dark:bg-green-900/20 dark:text-green-400" :title="(item.safe_search || []).join(', ')">safe search</span>
+                                            <span x-show="item.paused" class="text-xs px-2 py-0.5 rounded-full bg-orange-100 text-orange-700 dark:bg-orange-900/20 dark:text-orange-400" x-text="pauseText(item)"></span>
+                                        </td>
+                                        <td class="px-5 py-3 sm:px-6 text-right whitespace-nowrap">
+                                            {{if .EditMode}}
+                                            <button x-show="item.paused_until" @click="resume(item)" class="px-3 py-1.5 text-brand-600 hover:text-brand-700 text-xs">Resume</button>
+                                            <span x-show="!item.paused_until" x-data="{ open: false }" class="relative">
+                                                <button @click="open = !open" class="px-3 py-1.5 text-orange-600 hover:text-orange-700 text-xs">Pause</button>
+                                                <div x-show="open" x-cloak @click.outside="open = false" class="absolute right-0 z-10 mt-1 w-32 rounded-lg border border-gray-200 dark:border-gray-800 bg-white dark:bg-gray-900 shadow-lg text-left">
+                                                    <template x-for="d in pauseDurations" :key="d.minutes">
+                                                        <button @click="open = false; pause(item, d.minutes)" class="block w-full px-3 py-2 text-xs hover:bg-gray-100 dark:hover:bg-white/5 text-left" x-text="d.label"></button>
+                                                    </template>
+                                                </div>
+                                            </span>
+                                            <button @click="edit(item)" class="px-3 py-1.5 text-brand-600 hover:text-brand-700 text-xs">Edit</button>
+                                            {{end}}
+                                        </td>
+                                    </tr>
+                                </template>
+                            </tbody>
+                        </table>
+                    </div>
+                </div>
+
+                <div class="mt-6 rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03]">
+                    <div class="px-5 py-4 sm:px-6 border-b border-gray-200 dark:border-gray-800 flex justify-between items-center gap-4">
+                        <div>
+                            <h3 class="text-lg font-semibold">Schedules</h3>
+                            <p class="text-sm text-gray-500 dark:text-gray-400">Block more lists or pause the clients of a group at set times, in the time of the server. Paused clients only get the names of the local zones.</p>
+                        </div>
+                        {{if .EditMode}}
+                        <button @click="newSchedule()" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700 text-sm whitespace-nowrap">Add schedule</button>
+                        {{end}}
+                    </div>
+                    <p x-show="loaded && schedules.length === 0" class="px-5 py-4 sm:px-6 text-sm text-gray-500 dark:text-gray-400">No schedule.</p>
+                    <div x-show="schedules.length > 0" class="overflow-x-auto">
+                        <table class="w-full text-sm">
+                            <thead>
+                                <tr class="border-b border-gray-200 dark:border-gray-800 text-left text-gray-500 dark:text-gray-400">
+                                    <th class="px-5 py-3 sm:px-6 font-medium">Name</th>
+                                    <th class="px-5 py-3 sm:px-6 font-medium">Clients</th>
+                                    <th class="px-5 py-3 sm:px-6 font-medium">When</th>
+                                    <th class="px-5 py-3 sm:px-6 font-medium">Restriction</th>
+                                    <th class="px-5 py-3 sm:px-6"></th>
+                                </tr>
+                            </thead>
+                            <tbody>
+                                <template x-for="s in schedules" :key="s.id">
+                                    <tr class="border-b border-gray-100 dark:border-gray-800" :class="s.enabled ? '' : 'opacity-60'">
+                                        <td class="px-5 py-3 sm:px-6">
+                                            <span class="font-medium" x-text="s.name"></span>
+                                            <span x-show="s.active" class="ml-1 text-xs px-2 py-0.5 rounded-full bg-orange-100 text-orange-700 dark:bg-orange-900/20 dark:text-orange-400">active</span>
+                                            <span x-show="!s.enabled" class="ml-1 text-xs text-gray-500 dark:text-gray-400">disabled</span>
+                                        </td>
+                                        <td class="px-5 py-3 sm:px-6" x-text="s.group ? 'group ' + s.group : 'every client'"></td>
+                                        <td class="px-5 py-3 sm:px-6 whitespace-nowrap" x-text="(s.days && s.days.length ? s.days.join(', ') : 'every day') + ', ' + s.from + '–' + s.to"></td>
+                                        <td class="px-5 py-3 sm:px-6" x-text="s.pause ? 'pause' : 'block ' + s.blocklists.map(b => b === 'domains' ? 'blocked domains' : b).join(', ')"></td>
+                                        <td class="px-5 py-3 sm:px-6 text-right whitespace-nowrap">
+                                            {{if .EditMode}}
+                                            <button @click="toggleSchedule(s)" class="px-3 py-1.5 text-brand-600 hover:text-brand-700 text-xs" x-text="s.enabled ? 'Disable' : 'Enable'"></button>
+                                            <button @click="editSchedule(s)" class="px-3 py-1.5 text-brand-600 hover:text-brand-700 text-xs">Edit</button>
+                                            <button @click="deleteSchedule(s)" class="px-3 py-1.5 text-red-600 hover:text-red-700 text-xs">Delete</button>
+                                            {{end}}
+                                        </td>
+                                    </tr>
+                                </template>
+                            </tbody>
+                        </table>
+                    </div>
+                </div>
+
+                {{if .EditMode}}
+                <div x-show="scheduleOpen" x-cloak class="fixed inset-0 bg-black/50 flex items-center justify-center z-50">
+                    <div class="bg-white dark:bg-gray-900 rounded-2xl p-6 w-full max-w-md mx-4 shadow-xl" @click.outside="scheduleOpen = false">
+                        <h2 class="text-xl font-bold mb-4" x-text="scheduleForm.id ? 'Edit schedule' : 'New schedule'"></h2>
+                        <form @submit.prevent="saveSchedule()">
+                            <div class="mb-4">
+                                <label class="block text-sm font-medium mb-2">Name</label>
+                                <input type="text" x-model="scheduleForm.name" required maxlength="100" placeholder="School hours" class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                            </div>
+                            <div class="mb-4">
+                                <label class="block text-sm font-medium mb-2">Clients</label>
+                                <select x-model="scheduleForm.group" class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-gray-900 focus:outline-none focus:ring-2 focus:ring-brand-500">
+                                    <option value="">Every client</option>
+                                    <template x-for="g in groups" :key="g">
+                                        <option :value="g" x-text="'Group ' + g"></option>
+                                    </template>
+                                </select>
+                            </div>
+                            <div class="mb-4">
+                                <label class="block text-sm font-medium mb-2">Days</label>
+                                <div class="flex flex-wrap gap-3">
+                                    <template x-for="d in weekDays" :key="d">
+                                        <label class="flex items-center gap-1 text-sm">
+                                            <input type="checkbox" :value="d" x-model="scheduleForm.days">
+                                            <span x-text="d"></span>
+                                        </label>
+                                    </template>
+                                </div>
+                                <p class="text-xs text-gray-500 mt-2">None checked: every day.</p>
+                            </div>
+                            <div class="mb-4 grid grid-cols-2 gap-3">
+                                <div>
+                                    <label class="block text-sm font-medium mb-2">From</label>
+                                    <input type="time" x-model="scheduleForm.from" required class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                                </div>
+                                <div>
+                                    <label class="block text-sm font-medium mb-2">To</label>
+                                    <input type="time" x-model="scheduleForm.to" required class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                                </div>
+                            </div>
+                            <div class="mb-4">
+                                <label class="block text-sm font-medium mb-2">Restriction</label>
+                                <label class="flex items-center gap-2 text-sm mb-2">
+                                    <input type="checkbox" x-model="scheduleForm.pause">
+                                    <span>Pause: refuse every name out of the local zones</span>
+                                </label>
+                                <div x-show="!scheduleForm.pause" class="space-y-2">
+                                    <template x-for="b in blocklists" :key="b">
+                                        <label class="flex items-center gap-2 text-sm">
+                                            <input type="checkbox" :value="b" x-model="scheduleForm.blocklists">
+                                            <span class="font-mono break-all" x-text="b === 'domains' ? 'Blocked domains (config and web UI)' : b"></span>
+                                        </label>
+                                    </template>
+                                    <p x-show="blocklists.length === 0" class="text-xs text-gray-500">Enable the sinkhole to block lists on a schedule.</p>
+                                </div>
+                            </div>
+                            <div class="flex gap-3 justify-end">
+                                <button type="button" @click="scheduleOpen = false" class="px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">Cancel</button>
+                                <button type="submit" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700">Save</button>
+                            </div>
+                        </form>
+                    </div>
+                </div>
+
+                <div x-show="editing" x-cloak class="fixed inset-0 bg-black/50 flex items-center justify-center z-50">
+                    <div class="bg-white dark:bg-gray-900 rounded-2xl p-6 w-full max-w-md mx-4 shadow-xl" @click.outside="editing = null">
+                        <h2 class="text-xl font-bold mb-1">Client</h2>
+                        <p class="font-mono text-sm text-gray-500 dark:text-gray-400 mb-4" x-text="editing ? editing.address + (editing.hostname ? ' (' + editing.hostname + ')' : '') : ''"></p>
+                        <form @submit.prevent="save()">
+                            <div class="mb-4">
+                                <label class="block text-sm font-medium mb-2">Name</label>
+                                <input type="text" x-model="form.label" maxlength="100" placeholder="Living room TV" class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-white/[0.03] focus:outline-none focus:ring-2 focus:ring-brand-500">
+                            </div>
+                            <div class="mb-4">
+                                <label class="block text-sm font-medium mb-2">Policy group</label>
+                                <select x-model="form.group" class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-gray-900 focus:outline-none focus:ring-2 focus:ring-brand-500">
+                                    <option value="">The group of its network, if any</option>
+                                    <template x-for="g in groups" :key="g">
+                                        <option :value="g" x-text="g"></option>
+                                    </template>
+                                </select>
+                                <p x-show="groups.length === 0" class="text-xs text-gray-500 mt-2">Groups are defined in clients.groups of the config file.</p>
+                            </div>
+                            <div class="mb-4">
+                                <label class="block text-sm font-medium mb-2">Blocking</label>
+                                <select x-model="form.blocking" class="w-full px-3 py-2.5 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-gray-900 focus:outline-none focus:ring-2 focus:ring-brand-500">
+                                    <option value="">The blocking of its group</option>
+                                    <option value="all">Every blocklist</option>
+                                    <option value="none">No blocking</option>
+                                    <option value="lists" :disabled="blocklists.length === 0">Selected blocklists</option>
+                                </select>
+                                <div x-show="form.blocking === 'lists'" class="mt-3 space-y-2">
+                                    <template x-for="b in blocklists" :key="b">
+                                        <label class="flex items-center gap-2 text-sm">
+                                            <input type="checkbox" :value="b" x-model="form.blocklists">
+                                            <span class="font-mono break-all" x-text="b === 'domains' ? 'Blocked domains (config and web UI)' : b"></span>
+                                        </label>
+                                    </template>
+                                </div>
+                            </div>
+                            <div class="flex gap-3 justify-end">
+                                <button type="button" @click="editing = null" class="px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg hover:bg-gray-100 dark:hover:bg-white/5">Cancel</button>
+                                <button type="submit" class="px-4 py-2 bg-brand-600 text-white rounded-lg hover:bg-brand-700">Save</button>
+                            </div>
+                        </form>
+                    </div>
+                </div>
+                {{end}}
+            </main>
+        </div>
+    </div>
+
+    <script>
+        function clients() {
+            return {
+                loaded: false,
+                items: [],
+                groups: [],
+                blocklists: [],
+                resolveNames: false,
+                since: '',
+                filter: '',
+                error: '',
+                editing: null,
+                form: { label: '', group: '', blocking: '', blocklists: [] },
+                schedules: [],
+                scheduleOpen: false,
+                scheduleForm: { id: 0, name: '', group: '', days: [], from: '', to: '', pause: false, blocklists: [], enabled: true },
+                weekDays: ['mon', 'tue', 'wed', 'thu', 'fri', 'sat', 'sun'],
+                pauseDurations: [
+                    { minutes: 15, label: '15 minutes' },
+                    { minutes: 30, label: '30 minutes' },
+                    { minutes: 60, label: '1 hour' },
+                    { minutes: 120, label: '2 hours' },
+                    { minutes: 480, label: '8 hours' }
+                ],
+                async load() {
+                    const [resp, sresp] = await Promise.all([fetch('/api/clients'), fetch('/api/schedules')]);
+                    if (!resp.ok || !sresp.ok) {
+                        this.error = 'Failed to load the clients';
+                        return;
+                    }
+                    const data = await resp.json();
+                    this.items = data.clients;
+                    this.groups = data.groups;
+                    this.blocklists = data.blocklists;
+                    this.resolveNames = data.resolve_names;
+                    this.since = data.since;
+                    this.schedules = await sresp.json();
+                    this.loaded = true;
+                },
+                pauseText(item) {
+                    if (item.paused_until) return 'paused until ' + new Date(item.paused_until).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
+                    return 'paused (' + item.paused + ')';
+                },
+                async pause(item, minutes) {
+                    const resp = await fetch('/api/clients/' + encodeURIComponent(item.address) + '/pause', {
+                        method: 'POST',
+                        headers: {'Content-Type': 'application/json'},
+                        body: JSON.stringify({ minutes })
+                    });
+                    if (!resp.ok) {
+                        const data = await resp.json();
+                        alert('Failed to pause the client: ' + (data.error || 'Unknown error'));
+                        return;
+                    }
+                    await this.load();
+                },
+                async resume(item) {
+                    const resp = await fetch('/api/clients/' + encodeURIComponent(item.address) + '/pause', { method: 'DELETE' });
+                    if (!resp.ok) {
+                        const data = await resp.json();
+                        alert('Failed to resume the client: ' + (data.error || 'Unknown error'));
+                        return;
+                    }
+                    await this.load();
+                },
+                newSchedule() {
+                    this.scheduleForm = { id: 0, name: '', group: '', days: [], from: '09:00', to: '17:00', pause: false, blocklists: [], enabled: true };
+                    this.scheduleOpen = true;
+                },
+                editSchedule(s) {
+                    this.scheduleForm = { id: s.id, name: s.name, group: s.group || '', days: [...(s.days || [])], from: s.from, to: s.to, pause: !!s.pause, blocklists: [...(s.blocklists || [])], enabled: s.enabled };
+                    this.scheduleOpen = true;
+                },
+                scheduleBody(f) {
+                    return { name: f.name, group: f.group, days: f.days, from: f.from, to: f.to, pause: f.pause, blocklists: f.pause ? [] : f.blocklists, enabled: f.enabled };
+                },
+                async putSchedule(id, body) {
+                    const resp = await fetch(id ? '/api/schedules/' + id : '/api/schedules', {
+                        method: id ? 'PUT' : 'POST',
+                        headers: {'Content-Type': 'application/json'},
+                        body: JSON.stringify(body)
+                    });
+                    const data = await resp.json();
+                    if (!resp.ok) {
+                        alert('Failed to save the schedule: ' + (data.error || 'Unknown error'));
+                        return false;
+                    }
+                    await this.load();
+                    return true;
+                },
+                async saveSchedule() {
+                    if (await this.putSchedule(this.scheduleForm.id, this.scheduleBody(this.scheduleForm))) {
+                        this.scheduleOpen = false;
+                    }
+                },
+                async toggleSchedule(s) {
+                    await this.putSchedule(s.id, { ...this.scheduleBody({ ...s, group: s.group || '', days: s.days || [], blocklists: s.blocklists || [] }), enabled: !s.enabled });
+                },
+                async deleteSchedule(s) {
+                    if (!confirm('Delete the schedule ' + s.name + '?')) return;
+                    const resp = await fetch('/api/schedules/' + s.id, { method: 'DELETE' });
+                    if (!resp.ok) {
+                        const data = await resp.json();
+                        alert('Failed to delete the schedule: ' + (data.error || 'Unknown error'));
+                        return;
+                    }
+                    await this.load();
+                },
+                shown() {
+                    const f = this.filter.trim().toLowerCase();
+                    if (!f) return this.items;
+                    return this.items.filter(c => c.address.includes(f) || (c.name || '').toLowerCase().includes(f) || (c.policy_group || '').toLowerCase().includes(f));
+                },
+                blockingText(item) {
+                    if (item.blocking === 'all') return 'every blocklist';
+                    if (item.blocking === 'none') return 'no blocking';
+                    if (item.blocking === 'lists') return item.blocklists.length + ' blocklist' + (item.blocklists.length === 1 ? '' : 's');
+                    return '';
+                },
+                edit(item) {
+                    this.editing = item;
+                    this.form = { label: item.label || '', group: item.group || '', blocking: item.blocking || '', blocklists: [...(item.blocklists || [])] };
+                },
+                async save() {
+                    this.error = '';
+                    const body = { label: this.form.label, group: this.form.group, blocking: this.form.blocking };
+                    if (this.form.blocking === 'lists') body.blocklists = this.form.blocklists;
+                    const resp = await fetch('/api/clients/' + encodeURIComponent(this.editing.address), {
+                        method: 'PUT',
+                        headers: {'Content-Type': 'application/json'},
+                        body: JSON.stringify(body)
+                    });
+                    const data = await resp.json();
+                    if (!resp.ok) {
+                        alert('Failed to save the client: ' + (data.error || 'Unknown error'));
+                        return;
+                    }
+                    this.editing = null;
+                    await this.load();
+                }
+            };
+        }
+    </script>
+` + configModalHTML + `
+</body>
+</html>
+`
+
+// Block page served to browsers sent to the sinkhole, without external
+// assets since the CDNs may be blocked too
+const sinkholePageHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Blocked - {{.Host}}</title>
+    <style>
+        body { margin: 0; min-height: 100vh; display: flex; align-items: center; justify-content: center; background: #f9fafb; color: #1f2937; font-family: system-ui, -apple-system, sans-serif; }
+        .card { max-width: 32rem; margin: 1.5rem; padding: 2rem; background: #fff; border: 1px solid #e5e7eb; border-radius: 1rem; box-shadow: 0 10px 25px rgba(0,0,0,0.05); }
+        h1 { margin: 0 0 1rem; font-size: 1.5rem; }
+        p { line-height: 1.5; color: #4b5563; }
+        code { padding: 0.1rem 0.3rem; background: #f3f4f6; border-radius: 0.25rem; word-break: break-all; }
+        .footer { margin-top: 1.5rem; font-size: 0.85rem; color: #9ca3af; }
+        @media (prefers-color-scheme: dark) {
+            body { background: #111827; color: #f9fafb; }
+            .card { background: #1f2937; border-color: #374151; }
+            p { color: #d1d5db; }
+            code { background: #374151; }
+        }
+    </style>
+</head>
+<body>
+    <div class="card">
+        <h1>🚫 This site is blocked</h1>
+        <p>The DNS server of this network blocks <code>{{.Host}}</code>{{if and .Domain (ne .Domain .Host)}} because it belongs to <code>{{.Domain}}</code>{{end}}.</p>
+        <p>If you think this is a mistake, ask the administrator of the network to remove the domain from the sinkhole.</p>
+        <p class="footer">SimpleDNS sinkhole</p>
+    </div>
+</body>
+</html>
+`
+
+// Zone import wizard template
+const importHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>SimpleDNS - Import Zone</title>
+` + headHTML + `
+</head>
+<body x-data="{ sidebarOpen: false, darkMode: localStorage.getItem('darkMode') === 'true' }" 
+      x-init="$watch('darkMode', val => { localStorage.setItem('darkMode', val); document.documentElement.classList.toggle('dark', val) }); document.documentElement.classList.toggle('dark', darkMode)"
+      class="bg-gray-50 dark:bg-gray-900 text-gray-800 dark:text-white/90 font-sans">
+    <div class="flex h-screen overflow-hidden">
+        {{template "sidebar" .}}
+
+        <div class="relative flex flex-1 flex-col overflow-y-auto overflow-x-hidden">
+            <div x-show="sidebarOpen" @click="sidebarOpen = false" class="fixed inset-0 z-40 bg-black/50 lg:hidden" x-cloak></div>
+            {{template "header" .}}
+
+            <main class="p-4 md:p-6 2xl:p-10" x-data="zoneImport()">
+                <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5 max-w-4xl">
+                    <!-- Step 1: provider and source -->
+                    <div x-show="step === 1">
+                        <h3 class="text-lg font-semibold mb-4">Import a zone</h3>
+                        <div class="grid grid-cols-1 md:grid-cols-3 gap-3 mb-4">
+                            <template x-for="p in providers" :key="p.id">
+                                <button type="button" @click="provider = p.id"
+                                        :class="provider === p.id ? 'border-brand-600 ring-2 ring-brand-600/30' : 'border-gray-300 dark:border-gray-700'"
+                                        class="text-left p-4 border rounded-lg">
+                                    <p class="font-medium" x-text="p.name"></p>
+                                    <p class="text-xs text-gray-500 dark:text-gray-400" x-text="p.help"></p>
+                                </button>
+                            </template>
+                        </div>
+                        <div class="space-y-4">
+                            <div>
+                                <label class="block text-sm font-medium mb-1">Zone name</label>
+                                <input type="text" x-model="zone" placeholder="example.com" class="w-full px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-gray-900">
+                            </div>
+                            <div x-show="provider === 'cloudflare'">
+                                <label class="block text-sm font-medium mb-1">API token</label>
+                                <input type="password" x-model="token" placeholder="Token with Zone:Read and DNS:Read" class="w-full px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-gray-900">
+                                <p class="text-xs text-gray-500 dark:text-gray-400 mt-1">The token is only used for this import and is not stored.</p>
+                            </div>
+                            <div x-show="provider !== 'cloudflare'">
+                                <label class="block text-sm font-medium mb-1" x-text="provider === 'route53' ? 'Output of aws route53 list-resource-record-sets' : 'Zone file'"></label>
+                                <textarea x-model="data" rows="12" class="w-full px-4 py-2 font-mono text-sm border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-gray-900"></textarea>
+                            </div>
+                        </div>
+                        <div class="flex justify-end mt-4">
+                            <button @click="submit(true)" :disabled="loading || !zone" class="px-4 py-2 text-sm bg-brand-600 text-white hover:bg-brand-700 rounded-lg disabled:opacity-50">
+                                <span x-text="loading ? 'Loading...' : 'Preview'"></span>
+                            </button>
+                        </div>
+                    </div>
+
+                    <!-- Step 2: preview -->
+                    <div x-show="step === 2">
+                        <h3 class="text-lg font-semibold mb-1">Preview of <span class="font-mono" x-text="zone"></span></h3>
+                        <p class="text-sm text-gray-500 dark:text-gray-400 mb-4">
+                            <span x-text="preview.records.length"></span> records will be created.
+                            The SOA and apex NS records are generated from the zone settings.
+                        </p>
+                        <div class="overflow-x-auto max-h-96 mb-4">
+                            <table class="w-full text-sm">
+                                <thead class="border-b border-gray-200 dark:border-gray-800">
+                                    <tr class="text-left text-xs uppercase text-gray-500 dark:text-gray-400">
+                                        <th class="py-2">Name</th><th class="py-2">Type</th><th class="py-2">TTL</th><th class="py-2">Value</th>
+                                    </tr>
+                                </thead>
+                                <tbody>
+                                    <template x-for="(r, i) in preview.records" :key="i">
+                                        <tr class="border-b border-gray-100 dark:border-gray-800">
+                                            <td class="py-2 font-mono" x-text="r.name"></td>
+                                            <td class="py-2" x-text="r.type"></td>
+                                            <td class="py-2" x-text="r.ttl"></td>
+                                            <td class="py-2 font-mono break-all" x-text="r.value"></td>
+                                        </tr>
+                                    </template>
+                                </tbody>
+                            </table>
+                        </div>
+                        <div x-show="preview.skipped.length > 0" class="mb-4">
+                            <h4 class="text-sm font-semibold mb-2">Skipped (<span x-text="preview.skipped.length"></span>)</h4>
+                            <ul class="text-sm text-gray-500 dark:text-gray-400 space-y-1">
+                                <template x-for="(s, i) in preview.skipped" :key="i">
+                                    <li><span class="font-mono" x-text="s.name + ' ' + s.type"></span>: <span x-text="s.reason"></span></li>
+                                </template>
+                            </ul>
+                        </div>
+                        <div class="flex justify-between">
+                            <button @click="step = 1" class="px-4 py-2 text-sm border border-gray-300 dark:border-gray-700 rounded-lg">Back</button>
+                            <button @click="submit(false)" :disabled="loading" class="px-4 py-2 text-sm bg-brand-600 text-white hover:bg-brand-700 rounded-lg disabled:opacity-50">
+                                <span x-text="loading ? 'Importing...' : 'Import zone'"></span>
+                            </button>
+                        </div>
+                    </div>
+
+                    <p x-show="error" x-text="error" class="mt-4 text-sm text-red-600 dark:text-red-400"></p>
+                </div>
             </main>
         </div>
     </div>
 
+    <script>
+        function zoneImport() {
+            return {
+                providers: [
+                    { id: 'cloudflare', name: 'Cloudflare', help: 'Pull the records with an API token' },
+                    { id: 'route53', name: 'Route 53', help: 'Paste the list-resource-record-sets JSON' },
+                    { id: 'bind', name: 'Zone file', help: 'Paste a BIND zone file or a Cloudflare export' }
+                ],
+                step: 1,
+                provider: 'cloudflare',
+                zone: '',
+                token: '',
+                data: '',
+                loading: false,
+                error: '',
+                preview: { records: [], skipped: [] },
+                async submit(dryRun) {
+                    this.loading = true;
+                    this.error = '';
+                    try {
+                        const resp = await fetch('/api/import/zones', {
+                            method: 'POST',
+                            headers: { 'Content-Type': 'application/json' },
+                            body: JSON.stringify({ provider: this.provider, zone: this.zone, token: this.token, data: this.data, dry_run: dryRun })
+                        });
+                        const body = await resp.json();
+                        if (!resp.ok) {
+                            this.error = body.error || 'Import failed';
+                            return;
+                        }
+                        if (dryRun) {
+                            this.preview = body;
+                            this.step = 2;
+                        } else {
+                            window.location.href = '/zones/' + encodeURIComponent(body.zone.name) + '/records';
+                        }
+                    } catch(e) {
+                        this.error = e.message;
+                    } finally {
+                        this.loading = false;
+                    }
+                }
+            };
+        }
+    </script>
+` + configModalHTML + `
+</body>
+</html>
+`
+
+// Query tool page template
+const queryToolHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>SimpleDNS - Query Tool</title>
+` + headHTML + `
+</head>
+<body x-data="{ sidebarOpen: false, darkMode: localStorage.getItem('darkMode') === 'true' }" 
+      x-init="$watch('darkMode', val => { localStorage.setItem('darkMode', val); document.documentElement.classList.toggle('dark', val) }); document.documentElement.classList.toggle('dark', darkMode)"
+      class="bg-gray-50 dark:bg-gray-900 text-gray-800 dark:text-white/90 font-sans">
+    <div class="flex h-screen overflow-hidden">
+        {{template "sidebar" .}}
+
+        <div class="relative flex flex-1 flex-col overflow-y-auto overflow-x-hidden">
+            <div x-show="sidebarOpen" @click="sidebarOpen = false" class="fixed inset-0 z-40 bg-black/50 lg:hidden" x-cloak></div>
+            {{template "header" .}}
+
+            <main class="p-4 md:p-6 2xl:p-10 space-y-6" x-data="queryTool()">
+                <form @submit.prevent="run()" class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                    <h3 class="text-lg font-semibold mb-1">Query Tool</h3>
+                    <p class="text-sm text-gray-500 dark:text-gray-400 mb-4">Runs a query through the server as a client would send it. Names that are not answered locally are really forwarded.</p>
+                    <div class="grid grid-cols-1 md:grid-cols-6 gap-3">
+                        <input type="text" x-model="name" placeholder="www.example.com" required class="md:col-span-2 px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-gray-900 font-mono">
+                        <select x-model="type" class="px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-gray-900">
+                            <template x-for="t in types" :key="t"><option :value="t" x-text="t"></option></template>
+                        </select>
+                        <input type="text" x-model="client" placeholder="Client IP (yours)" class="px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-gray-900 font-mono">
+                        <input type="text" x-model="subnet" placeholder="Client subnet (ECS)" class="px-4 py-2 border border-gray-300 dark:border-gray-700 rounded-lg bg-white dark:bg-gray-900 font-mono">
+                        <button type="submit" :disabled="loading" class="px-4 py-2 text-sm bg-brand-600 text-white hover:bg-brand-700 rounded-lg disabled:opacity-50">
+                            <span x-text="loading ? 'Resolving...' : 'Resolve'"></span>
+                        </button>
+                    </div>
+                    <div class="flex gap-4 mt-3 text-sm">
+                        <label class="flex items-center gap-2"><input type="checkbox" x-model="tcp"> TCP</label>
+                        <label class="flex items-center gap-2"><input type="checkbox" x-model="dnssec"> DNSSEC (DO)</label>
+                    </div>
+                    <p x-show="error" x-text="error" class="mt-3 text-sm text-red-600 dark:text-red-400"></p>
+                </form>
+
+                <template x-if="trace">
+                    <div class="grid grid-cols-1 xl:grid-cols-2 gap-6">
+                        <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                            <h4 class="font-semibold mb-3">How it was answered</h4>
+                            <dl class="text-sm space-y-2">
+                                <div class="flex gap-2"><dt class="w-40 text-gray-500 dark:text-gray-400">Result</dt>
+                                    <dd><span class="font-mono" x-text="trace.rcode"></span> from <span class="font-semibold" x-text="trace.source"></span>
+                                        in <span x-text="trace.duration_ms"></span> ms</dd></div>
+                                <div class="flex gap-2"><dt class="w-40 text-gray-500 dark:text-gray-400">Local zone</dt>
+                                    <dd class="font-mono" x-text="trace.zone || 'none'"></dd></div>
+                                <div class="flex gap-2" x-show="trace.maintenance"><dt class="w-40 text-gray-500 dark:text-gray-400">Maintenance</dt>
+                                    <dd>the zone is forwarded upstream</dd></div>
+                                <div class="flex gap-2" x-show="!trace.serves_local && !trace.maintenance"><dt class="w-40 text-gray-500 dark:text-gray-400">Network profile</dt>
+                                    <dd>forward-only, local zones are skipped</dd></div>
+                                <div class="flex gap-2" x-show="trace.delegation && trace.delegation.length"><dt class="w-40 text-gray-500 dark:text-gray-400">Delegated to</dt>
+                                    <dd class="font-mono text-xs"><template x-for="rr in trace.delegation"><div x-text="rr"></div></template></dd></div>
+                                <div class="flex gap-2"><dt class="w-40 text-gray-500 dark:text-gray-400">Records at name</dt>
+                                    <dd class="font-mono text-xs break-all">
+                                        <template x-for="rr in trace.zone_records"><div x-text="rr"></div></template>
+                                        <span x-show="trace.zone_records.length === 0" class="font-sans text-sm">none</span>
+                                    </dd></div>
+                                <div class="flex gap-2" x-show="trace.hosts"><dt class="w-40 text-gray-500 dark:text-gray-400">Hosts files</dt>
+                                    <dd class="font-mono text-xs"><template x-for="rr in trace.hosts || []"><div x-text="rr"></div></template></dd></div>
+                                <div class="flex gap-2" x-show="trace.sinkhole"><dt class="w-40 text-gray-500 dark:text-gray-400">Sinkhole</dt>
+                                    <dd>blocked as part of <span class="font-mono" x-text="trace.sinkhole"></span></dd></div>
+                                <div class="flex gap-2" x-show="trace.mdns"><dt class="w-40 text-gray-500 dark:text-gray-400">mDNS bridge</dt>
+                                    <dd>resolved on the LAN, never forwarded</dd></div>
+                                <div class="flex gap-2" x-show="trace.dns64"><dt class="w-40 text-gray-500 dark:text-gray-400">DNS64</dt>
+                                    <dd>AAAA synthesized when the name has none</dd></div>
+                                <div class="flex gap-2" x-show="trace.address_filter"><dt class="w-40 text-gray-500 dark:text-gray-400">Address filter</dt>
+                                    <dd><span x-text="trace.address_filter"></span> hidden when the name has the other kind of address</dd></div>
+                                <div class="flex gap-2"><dt class="w-40 text-gray-500 dark:text-gray-400" x-text="trace.forward_zone ? 'Forward zone' : 'Forwarders'"></dt>
+                                    <dd class="font-mono text-xs" x-text="trace.forwarders && trace.forwarders.length ? trace.forwarders.join(', ') : 'none'"></dd></div>
+                            </dl>
+                        </div>
+                        <div class="rounded-2xl border border-gray-200 dark:border-gray-800 bg-white dark:bg-white/[0.03] p-5">
+                            <h4 class="font-semibold mb-3">Response</h4>
+                            <pre class="text-xs font-mono whitespace-pre-wrap break-all" x-text="trace.message"></pre>
+                        </div>
+                    </div>
+                </template>
+            </main>
+        </div>
+    </div>
+
+    <script>
+        function queryTool() {
+            return {
+                types: ['A', 'AAAA', 'CNAME', 'MX', 'TXT', 'NS', 'SOA', 'SRV', 'CAA', 'PTR', 'HTTPS', 'SVCB', 'DS', 'DNSKEY', 'ANY'],
+                name: '',
+                type: 'A',
+                client: '',
+                subnet: '',
+                tcp: false,
+                dnssec: false,
+                loading: false,
+                error: '',
+                trace: null,
+                async run() {
+                    this.loading = true;
+                    this.error = '';
+                    const params = new URLSearchParams({ name: this.name, type: this.type });
+                    if (this.client) params.set('client', this.client);
+                    if (this.subnet) params.set('subnet', this.subnet);
+                    if (this.tcp) params.set('tcp', '1');
+                    if (this.dnssec) params.set('dnssec', '1');
+                    try {
+                        const resp = await fetch('/api/resolve?' + params);
+                        const body = await resp.json();
+                        if (!resp.ok) {
+                            this.error = body.error || 'Query failed';
+                            return;
+                        }
+                        this.trace = body;
+                    } catch(e) {
+                        this.error = e.message;
+                    } finally {
+                        this.loading = false;
+                    }
+                }
+            };
+        }
+    </script>
 ` + configModalHTML + `
 </body>
 </html>
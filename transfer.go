@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// allowTransfer lists the networks allowed to transfer zones (AXFR) over
+// TCP. Empty refuses every transfer.
+var allowTransfer []*net.IPNet
+
+// parseAllowTransfer parses IP addresses and CIDR prefixes
+func parseAllowTransfer(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", entry)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// transferAllowed reports whether addr may transfer zones
+func transferAllowed(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range allowTransfer {
+		if n.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// transferChunk is the number of records sent per AXFR message
+const transferChunk = 100
+
+// handleTransfer answers AXFR (and IXFR, with a full transfer as allowed
+// by RFC 1995) for a loaded zone
+func handleTransfer(w dns.ResponseWriter, r *dns.Msg, zd *ZoneData) {
+	q := r.Question[0]
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	rrs, ok := zd.ZoneRRs(q.Name)
+	if !ok || !serveZone(q.Name) {
+		m.Rcode = dns.RcodeNotAuth
+		_ = w.WriteMsg(m)
+		return
+	}
+	// A secondary of the zone with a TSIG key must sign its request; a
+	// signed request that does not verify is refused whoever sends it
+	secondary, isSecondary := zoneSecondaryAt(q.Name, w.RemoteAddr())
+	_, isTCP := w.RemoteAddr().(*net.TCPAddr)
+	tsig := r.IsTsig()
+	switch {
+	case tsig != nil && w.TsigStatus() != nil,
+		isSecondary && secondary.TSIGKey != "" && (tsig == nil || !strings.EqualFold(tsig.Hdr.Name, secondary.TSIGKey)):
+		slog.Warn("Refused zone transfer without a valid TSIG", "zone", q.Name, "client", w.RemoteAddr())
+		m.Rcode = dns.RcodeNotAuth
+		_ = w.WriteMsg(m)
+		return
+	case !(isSecondary && isTCP) && !transferAllowed(w.RemoteAddr()):
+		slog.Warn("Refused zone transfer", "zone", q.Name, "client", w.RemoteAddr())
+		m.Rcode = dns.RcodeRefused
+		_ = w.WriteMsg(m)
+		return
+	}
+
+	if rrs[0].Header().Rrtype != dns.TypeSOA {
+		m.Rcode = dns.RcodeServerFailure
+		_ = w.WriteMsg(m)
+		return
+	}
+
+	// The transfer starts and ends with the SOA
+	rrs = append(rrs, rrs[0])
+	for i := 0; i < len(rrs); i += transferChunk {
+		m.Answer = rrs[i:min(i+transferChunk, len(rrs))]
+		if tsig != nil {
+			m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+		}
+		if err := w.WriteMsg(m); err != nil {
+			slog.Warn("Zone transfer failed", "zone", q.Name, "client", w.RemoteAddr(), "error", err)
+			return
+		}
+		// The next messages are signed over the previous MAC (RFC 8945)
+		w.TsigTimersOnly(true)
+		m = new(dns.Msg)
+		m.SetReply(r)
+	}
+	slog.Info("Sent zone transfer", "zone", q.Name, "client", w.RemoteAddr(), "records", len(rrs)-1)
+}
+
+// notifySecondaries sends a NOTIFY (RFC 1996) for each zone, in the
+// background, to the single addresses of allow_transfer and the
+// secondaries of the zone, so they pick up a change without waiting for
+// the refresh of the zone
+func notifySecondaries(zones ...string) {
+	if len(zones) == 0 {
+		return
+	}
+	go func() {
+		c := &dns.Client{Timeout: 2 * time.Second, TsigProvider: tsigKeyring{}}
+		for _, zone := range zones {
+			for _, target := range notifyTargets(zone) {
+				m := new(dns.Msg)
+				m.SetNotify(dns.Fqdn(zone))
+				if target.key != "" {
+					m.SetTsig(target.key, target.algorithm, 300, time.Now().Unix())
+				}
+				alertKey := "notify " + zone + " " + target.addr
+				if _, _, err := c.Exchange(m, target.addr); err != nil {
+					slog.Warn("failed to send NOTIFY", "zone", zone, "secondary", target.addr, "error", err)
+					raiseAlert(alertReplication, alertKey, "NOTIFY of "+zone+" to "+target.addr+" failing",
+						fmt.Sprintf("The secondary %s did not answer the NOTIFY of %s:\n%v\n\nIt picks up the changes at the next refresh of the zone only.", target.addr, zone, err))
+					continue
+				}
+				resolveAlert(alertReplication, alertKey, "NOTIFY of "+zone+" to "+target.addr+" working again",
+					fmt.Sprintf("The secondary %s answered the NOTIFY of %s again.", target.addr, zone))
+				slog.Debug("Sent NOTIFY", "zone", zone, "secondary", target.addr)
+			}
+		}
+	}()
+}
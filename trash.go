@@ -0,0 +1,127 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deleted zones and records go to the trash, from which they can be
+// restored until the retention ends (trash_retention_days)
+
+const (
+	trashZone   = "zone"
+	trashRecord = "record"
+)
+
+// defaultTrashRetentionDays is the default of trash_retention_days
+const defaultTrashRetentionDays = 30
+
+// trashPruneInterval is how often the items past the retention are deleted
+const trashPruneInterval = time.Hour
+
+// trashRetention is how long deleted zones and records are kept, 0 when
+// they are deleted for good at once
+var trashRetention = defaultTrashRetentionDays * 24 * time.Hour
+
+func initTrash(days int) {
+	switch {
+	case days > 0:
+		trashRetention = time.Duration(days) * 24 * time.Hour
+	case days < 0:
+		trashRetention = 0
+	}
+}
+
+// startTrashPruner deletes for good what is in the trash past the
+// retention. Slaves do not write to the database: the master prunes the
+// replicated trash.
+func startTrashPruner() {
+	go func() {
+		ticker := time.NewTicker(trashPruneInterval)
+		defer ticker.Stop()
+		for {
+			if currentServerRole() != roleSlave {
+				if n, err := database.PruneTrash(time.Now().Add(-trashRetention)); err != nil {
+					slog.Error("failed to prune the trash", "error", err)
+				} else if n > 0 {
+					slog.Info("Trash pruned", "items", n)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// trashItemID parses the :id of a trash route
+func trashItemID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid trash item id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// handleAPIListTrash handles GET /api/trash
+func handleAPIListTrash(c *gin.Context) {
+	items, err := database.ListTrash()
+	if err != nil {
+		slog.Error("failed to list the trash", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list the trash"})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// handleAPIRestoreTrashItem handles POST /api/trash/:id/restore
+func handleAPIRestoreTrashItem(c *gin.Context) {
+	id, ok := trashItemID(c)
+	if !ok {
+		return
+	}
+	item, err := database.RestoreTrashItem(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "trash item not found"})
+		case errors.Is(err, errTrashConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			slog.Error("failed to restore from the trash", "id", id, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore"})
+		}
+		return
+	}
+
+	// Reload zones into memory
+	if err := LoadZonesFromDB(); err != nil {
+		slog.Error("failed to reload zones", "error", err)
+	}
+
+	slog.Info("Restored from the trash", "kind", item.Kind, "zone", item.ZoneName, "name", item.Name, "type", item.Type)
+	c.JSON(http.StatusOK, item)
+}
+
+// handleAPIDeleteTrashItem handles DELETE /api/trash/:id
+func handleAPIDeleteTrashItem(c *gin.Context) {
+	id, ok := trashItemID(c)
+	if !ok {
+		return
+	}
+	if err := database.DeleteTrashItem(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "trash item not found"})
+			return
+		}
+		slog.Error("failed to delete from the trash", "id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted for good"})
+}
@@ -0,0 +1,32 @@
+package main
+
+import "github.com/miekg/dns"
+
+// ttlMin and ttlMax bound the TTLs served, from local zones and forwarded
+// answers alike, against 0-TTL floods and week-long TTLs (0 = no bound)
+var ttlMin, ttlMax uint32
+
+// clampTTL returns ttl within [ttlMin, ttlMax]
+func clampTTL(ttl uint32) uint32 {
+	if ttlMin > 0 && ttl < ttlMin {
+		return ttlMin
+	}
+	if ttlMax > 0 && ttl > ttlMax {
+		return ttlMax
+	}
+	return ttl
+}
+
+// clampMsgTTLs clamps the TTL of every record of msg in place
+func clampMsgTTLs(msg *dns.Msg) {
+	if ttlMin == 0 && ttlMax == 0 {
+		return
+	}
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			if h := rr.Header(); h.Rrtype != dns.TypeOPT {
+				h.Ttl = clampTTL(h.Ttl)
+			}
+		}
+	}
+}
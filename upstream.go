@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// UpstreamOptions tunes the queries sent to one forwarder. Zero values
+// use the defaults: forward_timeout_seconds, no retry and a weight of 1.
+type UpstreamOptions struct {
+	TimeoutMS int `yaml:"timeout_ms" json:"timeout_ms,omitempty"`
+	Retries   int `yaml:"retries" json:"retries,omitempty"`
+	// BackoffMS is the wait before the first retry, doubled after each one
+	BackoffMS int `yaml:"backoff_ms" json:"backoff_ms,omitempty"`
+	// Weight is the share of the queries the forwarder is asked first,
+	// among the forwarders of the same priority
+	Weight int `yaml:"weight" json:"weight,omitempty"`
+}
+
+func (o UpstreamOptions) timeout() time.Duration {
+	if o.TimeoutMS > 0 {
+		return time.Duration(o.TimeoutMS) * time.Millisecond
+	}
+	return forwardTimeout
+}
+
+// validUpstreamOptions checks the options of a forwarder
+func validUpstreamOptions(o UpstreamOptions) error {
+	if o.TimeoutMS < 0 || o.Retries < 0 || o.BackoffMS < 0 {
+		return fmt.Errorf("timeout_ms, retries and backoff_ms cannot be negative")
+	}
+	if o.Retries > 5 {
+		return fmt.Errorf("at most 5 retries")
+	}
+	if o.Weight < 0 || o.Weight > 100 {
+		return fmt.Errorf("weight must be between 0 and 100")
+	}
+	return nil
+}
+
+func (o UpstreamOptions) weight() int {
+	return max(o.Weight, 1)
+}
+
+// budget is the longest time a query to the forwarder can take, retries
+// included
+func (o UpstreamOptions) budget() time.Duration {
+	total := o.timeout()
+	backoff := time.Duration(o.BackoffMS) * time.Millisecond
+	for range o.Retries {
+		total += backoff + o.timeout()
+		backoff *= 2
+	}
+	return total
+}
+
+// ForwarderConfig is a forwarder of the config file: an address, or a
+// mapping with the address and its options. Forwarders with a lower
+// priority are asked first.
+type ForwarderConfig struct {
+	Address         string `yaml:"address" json:"address"`
+	Priority        int    `yaml:"priority" json:"priority"`
+	UpstreamOptions `yaml:",inline"`
+}
+
+func (f *ForwarderConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		f.Address = node.Value
+		return nil
+	}
+	type plain ForwarderConfig
+	return node.Decode((*plain)(f))
+}
+
+// upstreamCounters count the queries sent to one forwarder
+type upstreamCounters struct {
+	queries  atomic.Uint64
+	errors   atomic.Uint64
+	timeouts atomic.Uint64
+	// mismatches are responses dropped for not matching the query sent
+	mismatches atomic.Uint64
+	// failing counts the attempts that failed since the last answer
+	failing atomic.Int64
+}
+
+var (
+	upstreamMu    sync.RWMutex
+	upstreams     = map[string]ForwarderConfig{}
+	upstreamStats = map[string]*upstreamCounters{}
+	// upstreamNext rotates the first forwarder asked
+	upstreamNext atomic.Uint32
+)
+
+// setUpstreams replaces the priorities and options of the forwarders and
+// returns their addresses in the order they are asked
+func setUpstreams(list []ForwarderConfig) []string {
+	m := make(map[string]ForwarderConfig, len(list))
+	for _, f := range list {
+		m[f.Address] = f
+	}
+	upstreamMu.Lock()
+	upstreams = m
+	upstreamMu.Unlock()
+
+	sorted := slices.Clone(list)
+	slices.SortStableFunc(sorted, func(a, b ForwarderConfig) int { return a.Priority - b.Priority })
+	addrs := make([]string, 0, len(sorted))
+	for _, f := range sorted {
+		addrs = append(addrs, f.Address)
+	}
+	return addrs
+}
+
+func upstreamOptionsFor(addr string) UpstreamOptions {
+	upstreamMu.RLock()
+	defer upstreamMu.RUnlock()
+	return upstreams[addr].UpstreamOptions
+}
+
+// upstreamOrder returns servers in the order to ask them: by priority, and
+// within a priority starting from a server picked by weight. Servers without
+// configuration (forward zones, profiles) share priority 0.
+func upstreamOrder(servers []string) []string {
+	upstreamMu.RLock()
+	cfgs := make([]ForwarderConfig, len(servers))
+	for i, srv := range servers {
+		cfgs[i] = upstreams[srv]
+		cfgs[i].Address = srv
+	}
+	upstreamMu.RUnlock()
+	slices.SortStableFunc(cfgs, func(a, b ForwarderConfig) int { return a.Priority - b.Priority })
+
+	n := upstreamNext.Add(1)
+	order := make([]string, 0, len(cfgs))
+	for start := 0; start < len(cfgs); {
+		end := start + 1
+		for end < len(cfgs) && cfgs[end].Priority == cfgs[start].Priority {
+			end++
+		}
+		tier := cfgs[start:end]
+		total := 0
+		for _, f := range tier {
+			total += f.weight()
+		}
+		first, pick := 0, int(n%uint32(total))
+		for i, f := range tier {
+			if pick < f.weight() {
+				first = i
+				break
+			}
+			pick -= f.weight()
+		}
+		for i := range tier {
+			order = append(order, tier[(first+i)%len(tier)].Address)
+		}
+		start = end
+	}
+	return order
+}
+
+func countersFor(addr string) *upstreamCounters {
+	upstreamMu.RLock()
+	c := upstreamStats[addr]
+	upstreamMu.RUnlock()
+	if c != nil {
+		return c
+	}
+	upstreamMu.Lock()
+	defer upstreamMu.Unlock()
+	if c = upstreamStats[addr]; c == nil {
+		c = &upstreamCounters{}
+		upstreamStats[addr] = c
+	}
+	return c
+}
+
+// forwardBudget is the time forwardQuery may spend on servers
+func forwardBudget(servers []string) time.Duration {
+	var total time.Duration
+	for _, srv := range servers {
+		total += upstreamOptionsFor(srv).budget()
+	}
+	return max(total, forwardTimeout)
+}
+
+// forwardQuery sends msg to the servers until one answers, retrying each
+// one as its options say. Servers are asked by priority; among servers of
+// the same priority the first one asked rotates by weight so it does not
+// take all the load.
+func forwardQuery(ctx context.Context, msg *dns.Msg, servers []string) (*dns.Msg, error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no upstream configured")
+	}
+	// Upstreams get an ID of our own, and the name with a random case
+	// with 0x20, so a spoofed response has to guess both
+	out := msg.Copy()
+	if forwardStripClientData {
+		minimizeQuery(out)
+	}
+	if forwardCaseRandomization {
+		out.Question[0].Name = randomizeCase(out.Question[0].Name)
+	}
+	sent := out.Question[0].Name
+	for _, srv := range upstreamOrder(servers) {
+		opts := upstreamOptionsFor(srv)
+		counters := countersFor(srv)
+		backoff := time.Duration(opts.BackoffMS) * time.Millisecond
+		for attempt := 0; attempt <= opts.Retries; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				backoff *= 2
+			}
+			counters.queries.Add(1)
+			out.Id = dns.Id()
+			dnstapForward(srv, out, false)
+			resp, _, err := forwardClient(opts.timeout()).ExchangeContext(ctx, out, srv)
+			dnstapForward(srv, resp, true)
+			if err == nil && resp != nil && forwardCaseRandomization && (len(resp.Question) != 1 || resp.Question[0].Name != sent) {
+				counters.mismatches.Add(1)
+				err = fmt.Errorf("response does not echo the case of the name sent")
+			} else if err == nil && resp != nil {
+				restoreQuestion(resp, msg, sent)
+				if counters.failing.Swap(0) >= forwarderOutageFailures {
+					resolveAlert(alertForwarder, "forwarder "+srv, "Forwarder "+srv+" answering again",
+						fmt.Sprintf("The forwarder %s answers queries again.", srv))
+				}
+				return resp, nil
+			}
+			counters.errors.Add(1)
+			if counters.failing.Add(1) == forwarderOutageFailures {
+				slog.Warn("forwarder is not answering", "server", srv, "attempts", forwarderOutageFailures, "error", err)
+				raiseAlert(alertForwarder, "forwarder "+srv, "Forwarder "+srv+" not answering",
+					fmt.Sprintf("The last %d queries sent to the forwarder %s failed:\n%v\n\nThe other forwarders answer in its place, if any.", forwarderOutageFailures, srv, err))
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				counters.timeouts.Add(1)
+			}
+			slog.Debug("forward failed", "server", srv, "attempt", attempt+1, "error", err)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		}
+	}
+	return nil, fmt.Errorf("no upstream answered")
+}
+
+// UpstreamStat is the error rate of one forwarder since the start
+type UpstreamStat struct {
+	Address   string  `json:"address"`
+	Queries   uint64  `json:"queries"`
+	Errors    uint64  `json:"errors"`
+	Timeouts  uint64  `json:"timeouts"`
+	ErrorRate float64 `json:"error_rate"` // percent of the queries
+	// Mismatches are responses dropped for not echoing the case of the
+	// name sent (case_randomization)
+	Mismatches uint64 `json:"mismatches,omitempty"`
+	Priority   int    `json:"priority"`
+	UpstreamOptions
+}
+
+// upstreamStatsList returns the counters of every forwarder queried or
+// configured, by address
+func upstreamStatsList() []UpstreamStat {
+	upstreamMu.RLock()
+	defer upstreamMu.RUnlock()
+	seen := make(map[string]bool)
+	var list []UpstreamStat
+	add := func(addr string) {
+		if seen[addr] {
+			return
+		}
+		seen[addr] = true
+		s := UpstreamStat{Address: addr, Priority: upstreams[addr].Priority, UpstreamOptions: upstreams[addr].UpstreamOptions}
+		if c := upstreamStats[addr]; c != nil {
+			s.Queries, s.Errors, s.Timeouts, s.Mismatches = c.queries.Load(), c.errors.Load(), c.timeouts.Load(), c.mismatches.Load()
+		}
+		if s.Queries > 0 {
+			s.ErrorRate = float64(s.Errors) * 100 / float64(s.Queries)
+		}
+		list = append(list, s)
+	}
+	for addr := range upstreamStats {
+		add(addr)
+	}
+	for _, addr := range currentForwarders() {
+		add(addr)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+	return list
+}
+
+// upstreamStatFor returns the counters of addr from list
+func upstreamStatFor(list []UpstreamStat, addr string) UpstreamStat {
+	for _, s := range list {
+		if strings.EqualFold(s.Address, addr) {
+			return s
+		}
+	}
+	return UpstreamStat{Address: addr}
+}
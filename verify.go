@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// verifyMaxItems caps the differences listed in a verification report
+const verifyMaxItems = 100
+
+// loadedZonesDir is the directory the live zones were loaded from in files
+// mode ("" when the built-in defaults are served)
+var loadedZonesDir string
+
+// VerifyResult is the outcome of comparing the live zones with their source
+type VerifyResult struct {
+	CheckedAt       time.Time `json:"checked_at"`
+	Source          string    `json:"source"`
+	Consistent      bool      `json:"consistent"`
+	Zones           int       `json:"zones"`
+	Records         int       `json:"records"`
+	MissingZones    []string  `json:"missing_zones,omitempty"`    // in the source, not served
+	UnexpectedZones []string  `json:"unexpected_zones,omitempty"` // served, not in the source
+	MissingRRs      []string  `json:"missing_rrs,omitempty"`
+	UnexpectedRRs   []string  `json:"unexpected_rrs,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+var (
+	lastVerify   *VerifyResult
+	lastVerifyMu sync.RWMutex
+)
+
+// buildZonesFromSource rebuilds the zones from the source of truth into a
+// new snapshot, without publishing it
+func buildZonesFromSource() (*ZoneData, string, error) {
+	if dbMode == "sqlite" {
+		zd, err := buildZonesFromDB()
+		return zd, "sqlite", err
+	}
+	if dbMode == "kv" {
+		return buildZonesFromKVSource()
+	}
+	if dbMode == "git" {
+		return buildZonesFromGitSource()
+	}
+	if loadedZonesDir == "" {
+		return nil, "", fmt.Errorf("no zones directory loaded")
+	}
+	zd, err := buildZonesFromDir(loadedZonesDir)
+	return zd, loadedZonesDir, err
+}
+
+// rrSet returns the presentation form of every record in zd
+func rrSet(zd *ZoneData) map[string]bool {
+	set := make(map[string]bool, zd.RecordCount())
+	zd.Each(func(_ string, rrs []dns.RR) {
+		for _, rr := range rrs {
+			set[rr.String()] = true
+		}
+	})
+	return set
+}
+
+// setDiff returns the sorted keys of a missing from b, capped at verifyMaxItems
+func setDiff(a, b map[string]bool) []string {
+	var out []string
+	for k := range a {
+		if !b[k] {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	if len(out) > verifyMaxItems {
+		out = out[:verifyMaxItems]
+	}
+	return out
+}
+
+// compareZones diffs the live snapshot against one rebuilt from the source
+func compareZones() VerifyResult {
+	res := VerifyResult{CheckedAt: time.Now()}
+
+	fresh, source, err := buildZonesFromSource()
+	res.Source = source
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	live := zoneStore.Load()
+
+	freshZones := make(map[string]bool)
+	for _, z := range fresh.ZoneNames() {
+		freshZones[z] = true
+	}
+	liveZones := make(map[string]bool)
+	for _, z := range live.ZoneNames() {
+		liveZones[z] = true
+	}
+	freshRRs, liveRRs := rrSet(fresh), rrSet(live)
+
+	res.Zones = len(freshZones)
+	res.Records = len(freshRRs)
+	res.MissingZones = setDiff(freshZones, liveZones)
+	res.UnexpectedZones = setDiff(liveZones, freshZones)
+	res.MissingRRs = setDiff(freshRRs, liveRRs)
+	res.UnexpectedRRs = setDiff(liveRRs, freshRRs)
+	res.Consistent = len(res.MissingZones)+len(res.UnexpectedZones)+len(res.MissingRRs)+len(res.UnexpectedRRs) == 0
+	return res
+}
+
+// verifyZones compares the live zones with the source of truth. A change
+// may be written to the source just before its reload, so a divergence is
+// only reported if it is still there a moment later.
+func verifyZones() VerifyResult {
+	res := compareZones()
+	if !res.Consistent && res.Error == "" {
+		time.Sleep(2 * time.Second)
+		res = compareZones()
+	}
+
+	switch {
+	case res.Error != "":
+		slog.Warn("zone verification failed", "source", res.Source, "error", res.Error)
+	case !res.Consistent:
+		slog.Error("live zones diverge from source", "source", res.Source,
+			"missing_zones", len(res.MissingZones), "unexpected_zones", len(res.UnexpectedZones),
+			"missing_rrs", len(res.MissingRRs), "unexpected_rrs", len(res.UnexpectedRRs))
+	default:
+		slog.Debug("Zones verified", "source", res.Source, "zones", res.Zones, "records", res.Records)
+	}
+
+	lastVerifyMu.Lock()
+	lastVerify = &res
+	lastVerifyMu.Unlock()
+	return res
+}
+
+// verifyWarning returns a health warning when the last verification found
+// a divergence
+func verifyWarning() string {
+	lastVerifyMu.RLock()
+	defer lastVerifyMu.RUnlock()
+	if lastVerify != nil && lastVerify.Error == "" && !lastVerify.Consistent {
+		return "live zones diverge from source (see POST /api/verify)"
+	}
+	return ""
+}
+
+// startZoneVerifier runs verifyZones periodically
+func startZoneVerifier(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			verifyZones()
+		}
+	}()
+}
+
+func handleAPIVerify(c *gin.Context) {
+	c.JSON(http.StatusOK, verifyZones())
+}
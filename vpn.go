@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// VPNConfig publishes the nodes of a Tailscale tailnet and the peers of a
+// WireGuard interface as records, <hostname>.<zone>
+type VPNConfig struct {
+	Zone string `yaml:"zone" json:"zone,omitempty"` // default vpn.lan
+	// Tailscale publishes the nodes of `tailscale status --json`
+	Tailscale        bool   `yaml:"tailscale" json:"tailscale,omitempty"`
+	TailscaleCommand string `yaml:"tailscale_command" json:"tailscale_command,omitempty"`
+	// WireGuardConfig is a wg-quick configuration whose peers are named by
+	// a "# Name = <name>" comment, or the comment line above [Peer]
+	WireGuardConfig string `yaml:"wireguard_config" json:"wireguard_config,omitempty"`
+	IntervalSec     int    `yaml:"interval_seconds" json:"interval_seconds,omitempty"` // default 60
+	TTL             int    `yaml:"ttl" json:"ttl,omitempty"`                           // default 60
+}
+
+// defaultTailscaleCommand prints the status of the tailnet
+const defaultTailscaleCommand = "tailscale status --json"
+
+// vpnPeer is a named node and its addresses on the VPN
+type vpnPeer struct {
+	name string
+	ips  []net.IP
+}
+
+// tailscaleNode is the part of a node of `tailscale status --json` used
+type tailscaleNode struct {
+	HostName     string   `json:"HostName"`
+	DNSName      string   `json:"DNSName"` // MagicDNS name
+	TailscaleIPs []string `json:"TailscaleIPs"`
+}
+
+// parseTailscaleStatus returns this node and its peers. They are named by
+// their MagicDNS name, which Tailscale already made unique in the tailnet.
+func parseTailscaleStatus(data []byte) ([]vpnPeer, error) {
+	var status struct {
+		Self *tailscaleNode           `json:"Self"`
+		Peer map[string]tailscaleNode `json:"Peer"`
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("tailscale status: %w", err)
+	}
+	nodes := make([]tailscaleNode, 0, len(status.Peer)+1)
+	if status.Self != nil {
+		nodes = append(nodes, *status.Self)
+	}
+	for _, n := range status.Peer {
+		nodes = append(nodes, n)
+	}
+	var peers []vpnPeer
+	for _, n := range nodes {
+		name := n.DNSName
+		if name == "" {
+			name = n.HostName
+		}
+		p := vpnPeer{name: name}
+		for _, s := range n.TailscaleIPs {
+			if ip := net.ParseIP(s); ip != nil {
+				p.ips = append(p.ips, ip)
+			}
+		}
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+// tailscalePeers runs the status command
+func tailscalePeers(command string) ([]vpnPeer, error) {
+	parts := strings.Fields(command)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty tailscale_command")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, parts[0], parts[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s", parts[0], msg)
+		}
+		return nil, fmt.Errorf("%s: %w", parts[0], err)
+	}
+	return parseTailscaleStatus(out)
+}
+
+// parseWireGuardPeers reads the [Peer] sections of a wg-quick
+// configuration. A peer is named by a "# Name = <name>" comment in its
+// section (wg-easy, wireguard-ui) or else by the comment line right above
+// it; its addresses are the single hosts of AllowedIPs. Unnamed peers are
+// skipped.
+func parseWireGuardPeers(data []byte) []vpnPeer {
+	var peers []vpnPeer
+	var cur *vpnPeer
+	var lastComment string
+	flush := func() {
+		if cur != nil && cur.name != "" {
+			peers = append(peers, *cur)
+		}
+		cur = nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "["):
+			flush()
+			if strings.EqualFold(line, "[Peer]") {
+				cur = &vpnPeer{name: lastComment}
+			}
+			lastComment = ""
+		case strings.HasPrefix(line, "#"):
+			comment := strings.TrimSpace(strings.TrimLeft(line, "#"))
+			if key, value, ok := strings.Cut(comment, "="); ok && strings.EqualFold(strings.TrimSpace(key), "name") {
+				if cur != nil {
+					cur.name = strings.TrimSpace(value)
+					continue
+				}
+				comment = strings.TrimSpace(value)
+			}
+			lastComment = comment
+		case cur == nil:
+			lastComment = ""
+		default:
+			key, value, ok := strings.Cut(line, "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), "AllowedIPs") {
+				continue
+			}
+			for _, s := range strings.Split(value, ",") {
+				ip, ipnet, err := net.ParseCIDR(strings.TrimSpace(s))
+				if err != nil {
+					continue
+				}
+				if ones, bits := ipnet.Mask.Size(); ones == bits {
+					cur.ips = append(cur.ips, ip)
+				}
+			}
+		}
+	}
+	flush()
+	return peers
+}
+
+// vpnRecords returns the A and AAAA records of the peers
+func vpnRecords(zone string, ttl uint32, peers []vpnPeer) []dns.RR {
+	seen := make(map[string]bool)
+	var rrs []dns.RR
+	for _, p := range peers {
+		label := hostLabel(p.name)
+		if label == "" {
+			continue
+		}
+		name := label + "." + zone
+		for _, ip := range p.ips {
+			var rr dns.RR
+			hdr := dns.RR_Header{Name: name, Class: dns.ClassINET, Ttl: ttl}
+			if ip4 := ip.To4(); ip4 != nil {
+				hdr.Rrtype = dns.TypeA
+				rr = &dns.A{Hdr: hdr, A: ip4}
+			} else {
+				hdr.Rrtype = dns.TypeAAAA
+				rr = &dns.AAAA{Hdr: hdr, AAAA: ip}
+			}
+			if key := rr.String(); !seen[key] {
+				seen[key] = true
+				rrs = append(rrs, rr)
+			}
+		}
+	}
+	sort.Slice(rrs, func(i, j int) bool { return rrs[i].String() < rrs[j].String() })
+	return rrs
+}
+
+// startVPNPeers publishes the Tailscale nodes and WireGuard peers and
+// refreshes them periodically
+func startVPNPeers(cfg VPNConfig) {
+	if !cfg.Tailscale && cfg.WireGuardConfig == "" {
+		return
+	}
+	zone := cfg.Zone
+	if zone == "" {
+		zone = "vpn.lan"
+	}
+	zone = strings.ToLower(dns.Fqdn(zone))
+	ttl := uint32(60)
+	if cfg.TTL > 0 {
+		ttl = uint32(cfg.TTL)
+	}
+	interval := time.Minute
+	if cfg.IntervalSec > 0 {
+		interval = time.Duration(cfg.IntervalSec) * time.Second
+	}
+	command := cfg.TailscaleCommand
+	if command == "" {
+		command = defaultTailscaleCommand
+	}
+
+	// A source that fails keeps its records until it answers again
+	refresh := func() {
+		if cfg.Tailscale {
+			if peers, err := tailscalePeers(command); err != nil {
+				slog.Warn("failed to read the Tailscale status", "error", err)
+			} else {
+				setDynamicRecords("tailscale", zone, vpnRecords(zone, ttl, peers))
+			}
+		}
+		if cfg.WireGuardConfig != "" {
+			if data, err := os.ReadFile(cfg.WireGuardConfig); err != nil {
+				slog.Warn("failed to read the WireGuard configuration", "file", cfg.WireGuardConfig, "error", err)
+			} else {
+				setDynamicRecords("wireguard", zone, vpnRecords(zone, ttl, parseWireGuardPeers(data)))
+			}
+		}
+	}
+
+	slog.Info("Publishing VPN peers", "zone", zone, "tailscale", cfg.Tailscale, "wireguard", cfg.WireGuardConfig)
+	refresh()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			refresh()
+		}
+	}()
+}
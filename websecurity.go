@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebSecurityConfig hardens the web interface and the API
+type WebSecurityConfig struct {
+	// LoginMaxFailures failed logins (or invalid API tokens) from one client
+	// address lock it out for LoginLockoutSeconds; defaults 5 and 900, -1
+	// disables the lockout
+	LoginMaxFailures    int `yaml:"login_max_failures" json:"login_max_failures,omitempty"`
+	LoginLockoutSeconds int `yaml:"login_lockout_seconds" json:"login_lockout_seconds,omitempty"`
+	// APIRateLimit is the requests per second allowed to each API token,
+	// in bursts of up to APIRateBurst (default twice the rate); 0 for none
+	APIRateLimit float64 `yaml:"api_rate_limit" json:"api_rate_limit,omitempty"`
+	APIRateBurst int     `yaml:"api_rate_burst" json:"api_rate_burst,omitempty"`
+	// CORSOrigins are the origins (scheme://host[:port]) of the web pages
+	// allowed to call the API, "*" for any; none by default
+	CORSOrigins []string `yaml:"cors_origins" json:"cors_origins,omitempty"`
+	// TrustedProxies are the addresses or CIDRs of the reverse proxies
+	// whose X-Forwarded-For gives the client address; none by default
+	TrustedProxies []string `yaml:"trusted_proxies" json:"trusted_proxies,omitempty"`
+	// Headers are added to every response, replacing the default security
+	// headers of the same name; an empty value removes a default
+	Headers map[string]string `yaml:"headers" json:"headers,omitempty"`
+}
+
+const (
+	defaultLoginMaxFailures = 5
+	defaultLoginLockout     = 15 * time.Minute
+	// loginFailureDelay slows down each failed login
+	loginFailureDelay = time.Second
+)
+
+// defaultSecurityHeaders are sent with every response of the web server
+var defaultSecurityHeaders = map[string]string{
+	"X-Content-Type-Options": "nosniff",
+	"X-Frame-Options":        "DENY",
+	"Referrer-Policy":        "same-origin",
+}
+
+// webSecurity is the protection in effect, set before the web server
+// starts
+var webSecurity = newWebGuard(WebSecurityConfig{})
+
+// webGuard throttles the logins and API tokens
+type webGuard struct {
+	cfg         WebSecurityConfig
+	maxFailures int
+	lockout     time.Duration
+	headers     map[string]string
+
+	mu       sync.Mutex
+	failures map[string]*loginFailures // by client address
+	buckets  map[string]*tokenBucket   // by API token hash
+}
+
+type loginFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// validateWebSecurity checks the settings of web_security
+func validateWebSecurity(cfg WebSecurityConfig) error {
+	if cfg.LoginMaxFailures < -1 {
+		return fmt.Errorf("login_max_failures must be positive, or -1 to disable the lockout")
+	}
+	if cfg.LoginLockoutSeconds < 0 {
+		return fmt.Errorf("login_lockout_seconds must be positive")
+	}
+	if cfg.APIRateLimit < 0 || cfg.APIRateBurst < 0 {
+		return fmt.Errorf("api_rate_limit and api_rate_burst must be positive")
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("trusted proxy %q is not an address or CIDR", proxy)
+		}
+	}
+	for _, origin := range cfg.CORSOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("cors origin %q must be scheme://host[:port] or *", origin)
+		}
+	}
+	return nil
+}
+
+func newWebGuard(cfg WebSecurityConfig) *webGuard {
+	g := &webGuard{
+		cfg:         cfg,
+		maxFailures: cfg.LoginMaxFailures,
+		lockout:     time.Duration(cfg.LoginLockoutSeconds) * time.Second,
+		headers:     make(map[string]string),
+		failures:    make(map[string]*loginFailures),
+		buckets:     make(map[string]*tokenBucket),
+	}
+	if g.maxFailures == 0 {
+		g.maxFailures = defaultLoginMaxFailures
+	}
+	if g.lockout == 0 {
+		g.lockout = defaultLoginLockout
+	}
+	if g.cfg.APIRateLimit > 0 && g.cfg.APIRateBurst == 0 {
+		g.cfg.APIRateBurst = int(math.Ceil(2 * g.cfg.APIRateLimit))
+	}
+	for name, value := range defaultSecurityHeaders {
+		g.headers[name] = value
+	}
+	for name, value := range cfg.Headers {
+		name = http.CanonicalHeaderKey(name)
+		if value == "" {
+			delete(g.headers, name)
+			continue
+		}
+		g.headers[name] = value
+	}
+	for i, origin := range g.cfg.CORSOrigins {
+		g.cfg.CORSOrigins[i] = strings.TrimSuffix(origin, "/")
+	}
+	return g
+}
+
+// lockedOut returns how long the client address is still locked out
+func (g *webGuard) lockedOut(addr string) time.Duration {
+	if g.maxFailures < 0 {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	f := g.failures[addr]
+	if f == nil {
+		return 0
+	}
+	return time.Until(f.lockedUntil)
+}
+
+// fail counts a failed login from addr, locking it out after too many
+func (g *webGuard) fail(addr, reason string) {
+	if g.maxFailures < 0 {
+		return
+	}
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.failures) > 1024 {
+		for a, f := range g.failures {
+			if now.Sub(f.last) > g.lockout {
+				delete(g.failures, a)
+			}
+		}
+	}
+	f := g.failures[addr]
+	if f == nil || now.Sub(f.last) > g.lockout {
+		f = &loginFailures{}
+		g.failures[addr] = f
+	}
+	f.count++
+	f.last = now
+	if f.count >= g.maxFailures {
+		f.lockedUntil = now.Add(g.lockout)
+		f.count = 0
+		slog.Warn("client locked out after failed logins", "client", addr, "reason", reason, "until", f.lockedUntil.Format(time.RFC3339))
+	}
+}
+
+// succeed clears the failures of addr after a valid login
+func (g *webGuard) succeed(addr string) {
+	g.mu.Lock()
+	delete(g.failures, addr)
+	g.mu.Unlock()
+}
+
+// allowToken takes a request from the bucket of an API token, returning
+// false when the token exceeds its rate
+func (g *webGuard) allowToken(tokenHash string) bool {
+	if g.cfg.APIRateLimit <= 0 {
+		return true
+	}
+	now := time.Now()
+	burst := float64(g.cfg.APIRateBurst)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	b := g.buckets[tokenHash]
+	if b == nil {
+		b = &tokenBucket{tokens: burst}
+		g.buckets[tokenHash] = b
+	} else {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*g.cfg.APIRateLimit)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// retryAfter sets Retry-After to d rounded up to the second
+func retryAfter(c *gin.Context, d time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
+
+// SecurityHeadersMiddleware sets the security headers and answers the
+// CORS requests of the allowed origins
+func SecurityHeadersMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		g := webSecurity
+		for name, value := range g.headers {
+			c.Header(name, value)
+		}
+
+		origin := c.GetHeader("Origin")
+		if origin == "" || len(g.cfg.CORSOrigins) == 0 || !strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			c.Next()
+			return
+		}
+		c.Header("Vary", "Origin")
+		if !slices.Contains(g.cfg.CORSOrigins, "*") && !slices.Contains(g.cfg.CORSOrigins, origin) {
+			c.Next()
+			return
+		}
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Expose-Headers", "ETag, X-Total-Count, Retry-After")
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			c.Header("Access-Control-Allow-Headers", "Authorization, X-API-Key, Content-Type, If-Match")
+			c.Header("Access-Control-Max-Age", "600")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
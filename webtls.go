@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	selfSignedCertName = "self_signed"
+	selfSignedValidity = 365 * 24 * time.Hour
+	// acmeHTTPChallengePath is served over plain HTTP even when redirecting
+	// to HTTPS, as required by HTTP-01
+	acmeHTTPChallengePath = "/.well-known/acme-challenge/"
+)
+
+var (
+	// webHTTPSRedirect sends plain HTTP requests of the web UI to the
+	// HTTPS listener
+	webHTTPSRedirect bool
+	// webSecureCookie marks the session cookie Secure even on plain HTTP,
+	// for a reverse proxy terminating TLS
+	webSecureCookie bool
+)
+
+// selfSignedNames are the names and addresses of this host put in the
+// self-signed certificate, with the extra names given
+func selfSignedNames(extra []string) []string {
+	names := []string{"localhost", "127.0.0.1", "::1"}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		names = append(names, strings.ToLower(host))
+	}
+	if addr := getOutboundIP(); addr != "127.0.0.1" {
+		names = append(names, addr)
+	}
+	for _, name := range extra {
+		if name = strings.ToLower(strings.TrimSuffix(name, ".")); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// startSelfSignedCertificate serves a self-signed certificate for names
+// until a certificate is loaded. In sqlite mode it is kept in the database
+// so browsers that accepted it keep trusting it across restarts.
+func startSelfSignedCertificate(names []string) {
+	if database != nil {
+		if stored, err := database.GetCertificate(selfSignedCertName); err == nil {
+			if cert, err := parseCertificatePEM([]byte(stored.CertPEM), []byte(stored.KeyPEM)); err == nil &&
+				time.Until(cert.Leaf.NotAfter) > certExpiryWarning && coversNames(cert.Leaf, names) {
+				serverCert.SetFallback(cert)
+				slog.Warn("Serving the self-signed certificate until a certificate is loaded", "names", names, "not_after", cert.Leaf.NotAfter)
+				return
+			}
+		}
+	}
+
+	certPEM, keyPEM, err := generateSelfSigned(names)
+	if err != nil {
+		slog.Error("failed to generate a self-signed certificate", "error", err)
+		return
+	}
+	cert, err := parseCertificatePEM(certPEM, keyPEM)
+	if err != nil {
+		slog.Error("failed to generate a self-signed certificate", "error", err)
+		return
+	}
+	if database != nil {
+		if err := database.SaveCertificate(&DBCertificate{
+			Name:     selfSignedCertName,
+			CertPEM:  string(certPEM),
+			KeyPEM:   string(keyPEM),
+			NotAfter: cert.Leaf.NotAfter,
+		}); err != nil {
+			slog.Error("failed to store the self-signed certificate", "error", err)
+		}
+	}
+	serverCert.SetFallback(cert)
+	slog.Warn("Serving a new self-signed certificate until a certificate is loaded", "names", names, "not_after", cert.Leaf.NotAfter)
+}
+
+// coversNames reports whether the certificate lists all names
+func coversNames(leaf *x509.Certificate, names []string) bool {
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			if !slices.ContainsFunc(leaf.IPAddresses, ip.Equal) {
+				return false
+			}
+		} else if !slices.Contains(leaf.DNSNames, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// generateSelfSigned creates a PEM certificate and key for names, which
+// may be host names or addresses
+func generateSelfSigned(names []string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "SimpleDNS self-signed"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, name)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// httpsRedirect sends the requests of the plain HTTP listener to the HTTPS
+// one on tlsPort, except the ACME HTTP-01 challenges
+func httpsRedirect(next http.Handler, tlsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, acmeHTTPChallengePath) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if tlsPort != 443 {
+			host += ":" + strconv.Itoa(tlsPort)
+		}
+		code := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, fmt.Sprintf("https://%s%s", host, r.URL.RequestURI()), code)
+	})
+}
+
+// setSessionCookie sets the session cookie, Secure when the request came
+// over HTTPS; an empty token with maxAge -1 clears it
+func setSessionCookie(c *gin.Context, token string, maxAge int) {
+	secure := webSecureCookie || c.Request.TLS != nil
+	c.SetCookie(sessionCookieName, token, maxAge, "/", "", secure, true)
+}
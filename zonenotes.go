@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Zones shared by several teams carry notes: who owns them, how to reach
+// that owner and when the zone must be reviewed (or expires). Reminders
+// go to a webhook and by email as the review date approaches.
+
+const (
+	maxZoneOwner       = 100
+	maxZoneContact     = 200
+	maxZoneDescription = 2000
+)
+
+// Reminders about the review date of a zone, sent once each
+const (
+	reviewDue     = "due"     // within zone_reminders.days_before of the date
+	reviewOverdue = "overdue" // the date has passed
+)
+
+// defaultZoneReviewDays is the default of zone_reminders.days_before
+const defaultZoneReviewDays = 14
+
+// zoneReminderInterval is how often the review dates are checked
+const zoneReminderInterval = time.Hour
+
+// ZoneNotes document a zone for the operators; they are never served
+type ZoneNotes struct {
+	Owner       string `json:"owner,omitempty"`
+	Contact     string `json:"contact,omitempty"` // an email address gets the reminders
+	Description string `json:"description,omitempty"`
+	// ReviewAt is the day the zone must be reviewed, at 00:00 UTC
+	ReviewAt *time.Time `json:"review_at,omitempty"`
+}
+
+func (n ZoneNotes) empty() bool {
+	return n.Owner == "" && n.Contact == "" && n.Description == "" && n.ReviewAt == nil
+}
+
+// normalizeZoneNotes trims the notes, checks their lengths and truncates
+// the review date to its day
+func normalizeZoneNotes(n ZoneNotes) (ZoneNotes, error) {
+	out := ZoneNotes{
+		Owner:       strings.TrimSpace(n.Owner),
+		Contact:     strings.TrimSpace(n.Contact),
+		Description: strings.TrimSpace(n.Description),
+	}
+	for _, f := range []struct {
+		name, value string
+		max         int
+	}{{"owner", out.Owner, maxZoneOwner}, {"contact", out.Contact, maxZoneContact}, {"description", out.Description, maxZoneDescription}} {
+		if utf8.RuneCountInString(f.value) > f.max {
+			return out, fmt.Errorf("%s is longer than %d characters", f.name, f.max)
+		}
+	}
+	if strings.ContainsAny(out.Owner+out.Contact, "\r\n") {
+		return out, fmt.Errorf("owner and contact must fit on one line")
+	}
+	if n.ReviewAt != nil {
+		day := n.ReviewAt.UTC().Truncate(24 * time.Hour)
+		out.ReviewAt = &day
+	}
+	return out, nil
+}
+
+// zoneReviewDays is how many days before its review date a zone is due
+var zoneReviewDays = defaultZoneReviewDays
+
+// reviewStage returns whether the review of a zone is due or overdue at
+// now, empty when it is not yet or the zone has no review date
+func reviewStage(n ZoneNotes, now time.Time) string {
+	switch {
+	case n.ReviewAt == nil:
+		return ""
+	case !now.Before(*n.ReviewAt):
+		return reviewOverdue
+	case !now.Before(n.ReviewAt.AddDate(0, 0, -zoneReviewDays)):
+		return reviewDue
+	}
+	return ""
+}
+
+// ZoneRemindersConfig configures the reminders sent when the review date
+// of a zone approaches
+type ZoneRemindersConfig struct {
+	DaysBefore int `yaml:"days_before" json:"days_before,omitempty"` // default 14
+	// WebhookURL receives a JSON POST per reminder, with a "text" field
+	// for Slack or Mattermost incoming webhooks
+	WebhookURL string `yaml:"webhook_url" json:"webhook_url,omitempty"`
+	// EmailTo get the reminders through the smtp server, with the contact
+	// of the zone when it is an email address
+	EmailTo []string `yaml:"email_to" json:"email_to,omitempty"`
+}
+
+// validZoneReminders checks the zone_reminders settings
+func validZoneReminders(cfg ZoneRemindersConfig) error {
+	if cfg.DaysBefore < 0 {
+		return fmt.Errorf("days_before cannot be negative")
+	}
+	if cfg.WebhookURL != "" {
+		u, err := url.Parse(cfg.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook_url must be an http or https URL")
+		}
+	}
+	if err := validEmailAddresses(cfg.EmailTo); err != nil {
+		return fmt.Errorf("email_to %v", err)
+	}
+	return nil
+}
+
+func initZoneReminders(cfg ZoneRemindersConfig) {
+	if cfg.DaysBefore > 0 {
+		zoneReviewDays = cfg.DaysBefore
+	}
+}
+
+// zoneReminder is the body of a reminder webhook
+type zoneReminder struct {
+	Event       string    `json:"event"` // zone_review_due or zone_review_overdue
+	Zone        string    `json:"zone"`
+	Owner       string    `json:"owner,omitempty"`
+	Contact     string    `json:"contact,omitempty"`
+	Description string    `json:"description,omitempty"`
+	ReviewAt    time.Time `json:"review_at"`
+	Instance    string    `json:"instance,omitempty"`
+	Text        string    `json:"text"`
+}
+
+func newZoneReminder(n DBZoneNotes, stage string) zoneReminder {
+	r := zoneReminder{
+		Event:       "zone_review_" + stage,
+		Zone:        n.ZoneName,
+		Owner:       n.Owner,
+		Contact:     n.Contact,
+		Description: n.Description,
+		ReviewAt:    *n.ReviewAt,
+		Instance:    instanceName,
+	}
+	day := n.ReviewAt.Format(time.DateOnly)
+	if stage == reviewOverdue {
+		r.Text = fmt.Sprintf("The review of zone %s was due on %s", n.ZoneName, day)
+	} else {
+		r.Text = fmt.Sprintf("The review of zone %s is due on %s", n.ZoneName, day)
+	}
+	if n.Owner != "" {
+		r.Text += " (owner: " + n.Owner + ")"
+	}
+	return r
+}
+
+// sendReminderWebhook posts a reminder to the webhook
+func sendReminderWebhook(ctx context.Context, webhook string, r zoneReminder) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// reminderRecipients returns the configured recipients and the zone
+// contact when it is an email address
+func reminderRecipients(cfg ZoneRemindersConfig, contact string) []string {
+	var to []string
+	for _, v := range append(slices.Clone(cfg.EmailTo), contact) {
+		if a, err := mail.ParseAddress(v); err == nil && !slices.Contains(to, a.Address) {
+			to = append(to, a.Address)
+		}
+	}
+	return to
+}
+
+// sendReminderEmail emails a reminder
+func sendReminderEmail(r zoneReminder, to []string) error {
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s.\n\n", r.Text)
+	fmt.Fprintf(&body, "Zone: %s\n", r.Zone)
+	if r.Owner != "" {
+		fmt.Fprintf(&body, "Owner: %s\n", r.Owner)
+	}
+	if r.Contact != "" {
+		fmt.Fprintf(&body, "Contact: %s\n", r.Contact)
+	}
+	fmt.Fprintf(&body, "Review date: %s\n", r.ReviewAt.Format(time.DateOnly))
+	if r.Description != "" {
+		fmt.Fprintf(&body, "\n%s\n", r.Description)
+	}
+	return sendMail(to, "[simpledns] "+r.Text, body.String())
+}
+
+// sendZoneReminders sends the reminders that are due at now. A reminder
+// that fails is sent again at the next check.
+func sendZoneReminders(ctx context.Context, cfg ZoneRemindersConfig, now time.Time) error {
+	notes, err := database.ListZoneNotes()
+	if err != nil {
+		return err
+	}
+	for _, n := range notes {
+		stage := reviewStage(n.ZoneNotes, now)
+		if stage == "" || stage == n.Reminder || n.Reminder == reviewOverdue {
+			continue
+		}
+		r := newZoneReminder(n, stage)
+		var errs []error
+		if cfg.WebhookURL != "" {
+			errs = append(errs, sendReminderWebhook(ctx, cfg.WebhookURL, r))
+		}
+		if smtpConfig.Address != "" {
+			if to := reminderRecipients(cfg, n.Contact); len(to) > 0 {
+				errs = append(errs, sendReminderEmail(r, to))
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			slog.Warn("failed to send zone review reminder", "zone", n.ZoneName, "reminder", stage, "error", err)
+			continue
+		}
+		if err := database.SetZoneReminder(n.ZoneID, stage, now); err != nil {
+			return err
+		}
+		slog.Info("Zone review reminder sent", "zone", n.ZoneName, "reminder", stage, "review_at", n.ReviewAt.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// startZoneReminders checks the review dates of the zones every
+// zoneReminderInterval. Does nothing without a webhook or an smtp server.
+// Slaves leave the reminders to the master.
+func startZoneReminders(cfg ZoneRemindersConfig) {
+	if cfg.WebhookURL == "" && smtpConfig.Address == "" {
+		return
+	}
+	if err := validZoneReminders(cfg); err != nil {
+		slog.Error("invalid zone_reminders, reminders disabled", "error", err)
+		return
+	}
+	slog.Info("Sending zone review reminders", "days_before", zoneReviewDays, "webhook", cfg.WebhookURL != "", "email", smtpConfig.Address != "")
+	go func() {
+		ticker := time.NewTicker(zoneReminderInterval)
+		defer ticker.Stop()
+		for {
+			if currentServerRole() != roleSlave {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				if err := sendZoneReminders(ctx, cfg, time.Now()); err != nil {
+					slog.Error("failed to check zone review dates", "error", err)
+				}
+				cancel()
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// handleAPIGetZoneNotes handles GET /api/zones/:id/notes
+func handleAPIGetZoneNotes(c *gin.Context) {
+	zone, ok := notesZone(c)
+	if !ok {
+		return
+	}
+	notes, err := database.GetZoneNotes(zone.ID)
+	if err != nil {
+		slog.Error("failed to get zone notes", "zone", zone.Name, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get notes"})
+		return
+	}
+	c.JSON(http.StatusOK, notes)
+}
+
+// handleAPIPutZoneNotes handles PUT /api/zones/:id/notes. Empty notes
+// delete them.
+func handleAPIPutZoneNotes(c *gin.Context) {
+	zone, ok := notesZone(c)
+	if !ok {
+		return
+	}
+	var in ZoneNotes
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	notes, err := normalizeZoneNotes(in)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.SetZoneNotes(zone.ID, notes); err != nil {
+		slog.Error("failed to save zone notes", "zone", zone.Name, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save notes"})
+		return
+	}
+	slog.Info("Zone notes updated", "zone", zone.Name, "owner", notes.Owner, "user", c.GetString("username"))
+	handleAPIGetZoneNotes(c)
+}
+
+// handleAPIListZoneReviews handles GET /api/zone-reviews: the zones with a
+// review date, soonest first, with whether their review is due
+func handleAPIListZoneReviews(c *gin.Context) {
+	notes, err := database.ListZoneNotes()
+	if err != nil {
+		slog.Error("failed to list zone notes", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list zone reviews"})
+		return
+	}
+	type zoneReview struct {
+		DBZoneNotes
+		Review string `json:"review,omitempty"` // due or overdue
+	}
+	now := time.Now()
+	reviews := []zoneReview{}
+	for _, n := range notes {
+		if n.ReviewAt != nil {
+			reviews = append(reviews, zoneReview{DBZoneNotes: n, Review: reviewStage(n.ZoneNotes, now)})
+		}
+	}
+	slices.SortStableFunc(reviews, func(a, b zoneReview) int { return a.ReviewAt.Compare(*b.ReviewAt) })
+	c.JSON(http.StatusOK, reviews)
+}
+
+// notesZone returns the zone of a notes route
+func notesZone(c *gin.Context) (*DBZone, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone id"})
+		return nil, false
+	}
+	zone, err := database.GetZone(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return nil, false
+	}
+	return zone, true
+}
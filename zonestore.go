@@ -0,0 +1,479 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+// zoneNode is one label in the domain tree. Children are keyed by
+// lowercase label so lookups are case-insensitive.
+type zoneNode struct {
+	children map[string]*zoneNode
+	rrs      []dns.RR
+	apex     string // zone name when this node is a zone apex
+	// forward lists the upstreams of a forward zone at this node
+	forward []string
+	// filter is the address type hidden in the answers for the zone at
+	// this node (A or AAAA), 0 for none
+	filter uint16
+	// disabled is the zone name when a disabled zone is at this node
+	disabled string
+	// noCache is set when the answers for the name must not be cached
+	noCache bool
+	// answers holds the records answering each type, compiled when the
+	// snapshot is published
+	answers map[uint16][]dns.RR
+}
+
+func (n *zoneNode) child(label string) *zoneNode {
+	if n.children == nil {
+		return nil
+	}
+	return n.children[label]
+}
+
+// ZoneData is a snapshot of the zones served by the resolver, stored as a
+// domain tree so the enclosing zone and any delegation are found in a
+// single walk from the root. Once published through a ZoneStore it must
+// not be modified.
+type ZoneData struct {
+	root         zoneNode
+	zoneNames    []string
+	forwardZones []string
+	count        int
+}
+
+// NewZoneData returns an empty zone snapshot ready to be filled
+func NewZoneData() *ZoneData {
+	return &ZoneData{}
+}
+
+// treeLabels returns the lowercase labels of name from the root down
+func treeLabels(name string) []string {
+	labels := dns.SplitDomainName(strings.ToLower(name))
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return labels
+}
+
+// node returns the tree node for name, creating it if needed
+func (z *ZoneData) node(name string) *zoneNode {
+	n := &z.root
+	for _, label := range treeLabels(name) {
+		next := n.child(label)
+		if next == nil {
+			if n.children == nil {
+				n.children = make(map[string]*zoneNode)
+			}
+			next = &zoneNode{}
+			n.children[label] = next
+		}
+		n = next
+	}
+	return n
+}
+
+// find returns the tree node for name, or nil if it does not exist
+func (z *ZoneData) find(name string) *zoneNode {
+	var labels nameLabels
+	if !labels.split(name) {
+		return nil
+	}
+	n := &z.root
+	for i := 0; i < labels.n; i++ {
+		if n = n.childLabel(labels.label(i)); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// ofType returns the records of the node of the given type
+func (n *zoneNode) ofType(rrtype uint16) []dns.RR {
+	if n.answers != nil {
+		return n.answers[rrtype]
+	}
+	return filterRRs(n.rrs, rrtype)
+}
+
+// AddZone registers a zone apex name
+func (z *ZoneData) AddZone(name string) {
+	name = dns.Fqdn(name)
+	z.node(name).apex = name
+	z.zoneNames = append(z.zoneNames, name)
+}
+
+// AddForwardZone registers a zone whose names are answered by the given
+// upstreams instead of the global forwarders
+func (z *ZoneData) AddForwardZone(name string, upstreams []string) {
+	name = dns.Fqdn(name)
+	z.node(name).forward = upstreams
+	z.forwardZones = append(z.forwardZones, name)
+}
+
+// SetNoCache keeps the answers forwarded for name out of the cache
+func (z *ZoneData) SetNoCache(name string) {
+	z.node(dns.Fqdn(name)).noCache = true
+}
+
+// NoCache reports whether the answers for name must not be cached
+func (z *ZoneData) NoCache(name string) bool {
+	n := z.find(name)
+	return n != nil && n.noCache
+}
+
+// AddDisabledZone marks the zone named name as disabled, for queries to
+// be answered as disabled_zone_response sets
+func (z *ZoneData) AddDisabledZone(name string) {
+	name = dns.Fqdn(name)
+	z.node(name).disabled = name
+}
+
+// ForwardZone returns the upstreams of the forward zone named name
+func (z *ZoneData) ForwardZone(name string) ([]string, bool) {
+	n := z.find(name)
+	if n == nil || len(n.forward) == 0 {
+		return nil, false
+	}
+	return n.forward, true
+}
+
+// SetAddressFilter hides the qtype addresses (A or AAAA) in the answers
+// for the zone named name
+func (z *ZoneData) SetAddressFilter(name string, qtype uint16) {
+	z.node(dns.Fqdn(name)).filter = qtype
+}
+
+// AddressFilter returns the address type hidden for name by its closest
+// enclosing zone, 0 for none
+func (z *ZoneData) AddressFilter(name string) uint16 {
+	filter := z.root.filter
+	n := &z.root
+	for _, label := range treeLabels(name) {
+		if n = n.child(label); n == nil {
+			break
+		}
+		if n.apex != "" || len(n.forward) > 0 {
+			filter = n.filter
+		}
+	}
+	return filter
+}
+
+// ForwardZoneNames returns the loaded forward zone names
+func (z *ZoneData) ForwardZoneNames() []string {
+	return z.forwardZones
+}
+
+// AddRR adds a resource record, indexed by its owner name
+func (z *ZoneData) AddRR(rr dns.RR) {
+	n := z.node(dns.Fqdn(rr.Header().Name))
+	n.rrs = append(n.rrs, rr)
+	z.count++
+}
+
+// Lookup returns the records owned by name
+func (z *ZoneData) Lookup(name string) ([]dns.RR, bool) {
+	n := z.find(name)
+	if n == nil || len(n.rrs) == 0 {
+		return nil, false
+	}
+	return n.rrs, true
+}
+
+// ZoneNames returns the loaded zone apex names
+func (z *ZoneData) ZoneNames() []string {
+	return z.zoneNames
+}
+
+// RecordCount returns the number of records in the snapshot
+func (z *ZoneData) RecordCount() int {
+	return z.count
+}
+
+// FindZone returns the closest loaded zone enclosing name, or "" if none does
+func (z *ZoneData) FindZone(name string) string {
+	var labels nameLabels
+	if !labels.split(name) {
+		return ""
+	}
+	zone := z.root.apex
+	n := &z.root
+	for i := 0; i < labels.n; i++ {
+		if n = n.childLabel(labels.label(i)); n == nil {
+			break
+		}
+		if n.apex != "" {
+			zone = n.apex
+		}
+	}
+	return zone
+}
+
+// LookupResult describes where a name falls in the loaded data
+type LookupResult struct {
+	Zone    string   // closest enclosing zone apex, "" if not authoritative
+	Records []dns.RR // records owned by the exact name
+	Exists  bool     // the name exists (has records or descendants)
+	// Delegation holds the NS records of the zone cut at or above the
+	// name, below the enclosing apex; the query must be answered with a
+	// referral when it is set
+	Delegation []dns.RR
+	// Forward holds the upstreams of the closest forward zone enclosing
+	// the name, when no local zone is closer
+	Forward []string
+	// Disabled is the closest disabled zone enclosing the name, when no
+	// local or forward zone is closer
+	Disabled string
+
+	answers map[uint16][]dns.RR // compiled answer sets of the name
+}
+
+// Resolve walks the tree for name, tracking the enclosing zone, any
+// delegation (NS records below a zone apex) and any forward zone on the
+// way down
+func (z *ZoneData) Resolve(name string) LookupResult {
+	var res LookupResult
+	var labels nameLabels
+	if !labels.split(name) {
+		return res
+	}
+	res.Zone = z.root.apex
+	res.Forward = z.root.forward
+	n := &z.root
+	for i := 0; i < labels.n; i++ {
+		if n = n.childLabel(labels.label(i)); n == nil {
+			return res
+		}
+		if n.disabled != "" {
+			res.Disabled = n.disabled
+		}
+		if n.apex != "" {
+			// A locally hosted child zone takes over from any cut above it
+			res.Zone = n.apex
+			res.Delegation = nil
+			res.Forward = nil
+			res.Disabled = ""
+			continue
+		}
+		if len(n.forward) > 0 {
+			// So does a forward zone: its names are not answered locally
+			res.Zone = ""
+			res.Delegation = nil
+			res.Forward = n.forward
+			res.Disabled = ""
+			continue
+		}
+		if res.Zone != "" && res.Delegation == nil {
+			if ns := n.ofType(dns.TypeNS); len(ns) > 0 {
+				res.Delegation = ns
+			}
+		}
+	}
+	if len(res.Forward) > 0 {
+		return res
+	}
+	res.Records = n.rrs
+	res.answers = n.answers
+	res.Exists = len(n.rrs) > 0 || len(n.children) > 0
+	return res
+}
+
+// Glue returns the address records held for the targets of NS records
+func (z *ZoneData) Glue(ns []dns.RR) []dns.RR {
+	var glue []dns.RR
+	for _, rr := range ns {
+		target, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		if n := z.find(target.Ns); n != nil {
+			for _, a := range n.rrs {
+				if t := a.Header().Rrtype; t == dns.TypeA || t == dns.TypeAAAA {
+					glue = append(glue, a)
+				}
+			}
+		}
+	}
+	return glue
+}
+
+// Each calls fn for every owner name and its records
+func (z *ZoneData) Each(fn func(name string, rrs []dns.RR)) {
+	var walk func(n *zoneNode)
+	walk = func(n *zoneNode) {
+		if len(n.rrs) > 0 {
+			fn(dns.Fqdn(n.rrs[0].Header().Name), n.rrs)
+		}
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	walk(&z.root)
+}
+
+// ZoneRRs returns every record of the zone at apex, SOA first, including
+// delegations and glue but not the zones hosted below it. ok is false when
+// apex is not a loaded zone.
+func (z *ZoneData) ZoneRRs(apex string) (rrs []dns.RR, ok bool) {
+	top := z.find(apex)
+	if top == nil || top.apex == "" {
+		return nil, false
+	}
+	var walk func(n *zoneNode)
+	walk = func(n *zoneNode) {
+		rrs = append(rrs, n.rrs...)
+		for _, c := range n.children {
+			if c.apex == "" {
+				walk(c)
+			}
+		}
+	}
+	walk(top)
+	for i, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeSOA && i > 0 {
+			rrs[0], rrs[i] = rrs[i], rrs[0]
+			break
+		}
+	}
+	return rrs, true
+}
+
+// ZoneCut is a hosted zone, forward zone or delegation of the loaded data,
+// as shown in the delegation tree
+type ZoneCut struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`  // zone, forward or delegation
+	Depth int    `json:"depth"` // number of cuts enclosing it
+	// NS are the name servers of a zone apex or delegation, Glue the
+	// addresses held for them
+	NS   []string `json:"ns,omitempty"`
+	Glue []string `json:"glue,omitempty"`
+	// MissingGlue are the name servers of a delegation inside the
+	// delegated name that have no address: the child cannot be reached
+	MissingGlue []string `json:"missing_glue,omitempty"`
+	Forwarders  []string `json:"forwarders,omitempty"`
+}
+
+// Cuts returns the zones, forward zones and delegations of the data, each
+// one before the cuts below it
+func (z *ZoneData) Cuts() []ZoneCut {
+	var cuts []ZoneCut
+	var walk func(n *zoneNode, name string, depth int, inZone bool)
+	walk = func(n *zoneNode, name string, depth int, inZone bool) {
+		cut := ZoneCut{Name: name, Depth: depth}
+		ns := filterRRs(n.rrs, dns.TypeNS)
+		switch {
+		case n.apex != "":
+			cut.Kind = "zone"
+			inZone = true
+		case len(n.forward) > 0:
+			cut.Kind = "forward"
+			cut.Forwarders = n.forward
+			inZone = false
+		case inZone && len(ns) > 0:
+			cut.Kind = "delegation"
+			// Below a cut the names belong to the child zone
+			inZone = false
+		}
+		if cut.Kind != "" {
+			for _, rr := range ns {
+				target := rr.(*dns.NS).Ns
+				cut.NS = append(cut.NS, target)
+				glue := z.Glue([]dns.RR{rr})
+				for _, a := range glue {
+					cut.Glue = append(cut.Glue, a.String())
+				}
+				if cut.Kind == "delegation" && len(glue) == 0 && dns.IsSubDomain(name, target) {
+					cut.MissingGlue = append(cut.MissingGlue, target)
+				}
+			}
+			cuts = append(cuts, cut)
+			depth++
+		}
+		labels := make([]string, 0, len(n.children))
+		for label := range n.children {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			child := label + "."
+			if name != "." {
+				child += name
+			}
+			walk(n.children[label], child, depth, inZone)
+		}
+	}
+	walk(&z.root, ".", 0, false)
+	return cuts
+}
+
+// filterRRs returns the records of the given type
+func filterRRs(rrs []dns.RR, rrtype uint16) []dns.RR {
+	var out []dns.RR
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == rrtype {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+// ZoneStore holds the live zone data. Readers get a consistent snapshot
+// without locking; writers build a complete new ZoneData and swap it in
+// atomically (copy-on-write), so queries never see a half-loaded zone.
+type ZoneStore struct {
+	current atomic.Pointer[ZoneData]
+	writeMu sync.Mutex // serializes rebuilds so the last one started wins
+	// loaded is set once a snapshot of the zone source is published, the
+	// empty snapshot of the start does not count
+	loaded atomic.Bool
+}
+
+// NewZoneStore returns a store holding an empty snapshot
+func NewZoneStore() *ZoneStore {
+	s := &ZoneStore{}
+	s.current.Store(NewZoneData())
+	return s
+}
+
+// Load returns the current snapshot
+func (s *ZoneStore) Load() *ZoneData {
+	return s.current.Load()
+}
+
+// Replace publishes a new snapshot, with its answers compiled
+func (s *ZoneStore) Replace(z *ZoneData) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	z.compileAnswers()
+	s.current.Store(z)
+	s.loaded.Store(true)
+}
+
+// Rebuild builds a new snapshot and publishes it if build succeeds.
+// On error the current snapshot is kept.
+func (s *ZoneStore) Rebuild(build func() (*ZoneData, error)) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	z, err := build()
+	if err != nil {
+		return err
+	}
+	z.compileAnswers()
+	s.current.Store(z)
+	s.loaded.Store(true)
+	return nil
+}
+
+// Loaded reports whether the zones of the source were published
+func (s *ZoneStore) Loaded() bool {
+	return s.loaded.Load()
+}
+
+var zoneStore = NewZoneStore()
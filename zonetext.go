@@ -0,0 +1,481 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// maxZoneText bounds the zone file accepted by the text editor
+const maxZoneText = 8 << 20
+
+// ZoneTextError is a problem on a line of an edited zone file
+type ZoneTextError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// zoneTextRecord is a record parsed from a zone file, with its first line
+type zoneTextRecord struct {
+	DBRecord
+	line int
+	rr   dns.RR
+}
+
+// zoneText renders a zone as a master file: the records the way they are
+// served, their schedule and notes as comments. The SOA and apex NS come
+// from the zone settings and are only shown as comments.
+func zoneText(zone *DBZone, records []DBRecord) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "; Zone %s, serial %d\n", zone.Name, zone.Serial)
+	fmt.Fprintf(&b, "; The SOA and apex NS are set in the zone settings:\n")
+	fmt.Fprintf(&b, ";   %s %d IN SOA %s %s %d %d %d %d %d\n", dns.Fqdn(zone.Name), zone.TTL, zone.NS, zone.Admin, zone.Serial, zone.Refresh, zone.Retry, zone.Expire, zone.Minimum)
+	fmt.Fprintf(&b, "$ORIGIN %s\n$TTL %d\n\n", dns.Fqdn(zone.Name), zone.TTL)
+	for _, r := range records {
+		b.WriteString(recordLine(zone.Name, r))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// zoneTextEntry is a directive or a record of a zone file, which may span
+// lines between parentheses
+type zoneTextEntry struct {
+	line int
+	text string
+}
+
+// zoneTextEntries splits a zone file into its entries, returning the line
+// of a parenthesis left open at the end
+func zoneTextEntries(text string) ([]zoneTextEntry, int) {
+	var entries []zoneTextEntry
+	var current strings.Builder
+	depth, start := 0, 0
+	for i, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if depth == 0 {
+			if strings.TrimSpace(stripZoneComment(line)) == "" {
+				continue
+			}
+			start = i + 1
+			current.Reset()
+		} else {
+			current.WriteByte('\n')
+		}
+		current.WriteString(line)
+		depth += parenDepth(line)
+		if depth <= 0 {
+			entries = append(entries, zoneTextEntry{line: start, text: current.String()})
+			depth = 0
+		}
+	}
+	if depth > 0 {
+		return entries, start
+	}
+	return entries, 0
+}
+
+// stripZoneComment removes the ; comment of a zone file line, outside
+// quoted strings
+func stripZoneComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// parenDepth returns the parentheses opened minus those closed on a line
+func parenDepth(line string) int {
+	depth := 0
+	for _, c := range stripZoneComment(line) {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+	}
+	return depth
+}
+
+// parseZoneText parses an edited zone file into records of zone, checking
+// each entry on its own so every faulty line is reported
+func parseZoneText(zone *DBZone, text string) ([]zoneTextRecord, []ZoneTextError) {
+	apex := strings.ToLower(dns.Fqdn(zone.Name))
+	origin := apex
+	ttl := uint32(zone.TTL)
+	owner := ""
+	var records []zoneTextRecord
+	var problems []ZoneTextError
+	fail := func(line int, format string, args ...any) {
+		problems = append(problems, ZoneTextError{Line: line, Error: fmt.Sprintf(format, args...)})
+	}
+
+	entries, unclosed := zoneTextEntries(text)
+	if unclosed > 0 {
+		fail(unclosed, "unclosed parenthesis")
+	}
+	for _, entry := range entries {
+		code := strings.TrimSpace(stripZoneComment(entry.text))
+		if strings.HasPrefix(code, "$") {
+			fields := strings.Fields(code)
+			switch strings.ToUpper(fields[0]) {
+			case "$ORIGIN":
+				if len(fields) != 2 {
+					fail(entry.line, "$ORIGIN takes one name")
+					continue
+				}
+				name := fields[1]
+				if !dns.IsFqdn(name) {
+					name += "." + origin
+				}
+				if _, ok := dns.IsDomainName(name); !ok {
+					fail(entry.line, "invalid $ORIGIN %s", fields[1])
+					continue
+				}
+				origin = strings.ToLower(name)
+			case "$TTL":
+				// Let the parser read the TTL units (1h, 1d...)
+				zp := dns.NewZoneParser(strings.NewReader(code+"\n@ IN TXT \"\"\n"), origin, "")
+				rr, ok := zp.Next()
+				if !ok || len(fields) != 2 {
+					fail(entry.line, "invalid $TTL")
+					continue
+				}
+				ttl = rr.Header().Ttl
+			default:
+				fail(entry.line, "%s is not supported", fields[0])
+			}
+			continue
+		}
+
+		input := entry.text
+		if input[0] == ' ' || input[0] == '\t' {
+			if owner == "" {
+				fail(entry.line, "no owner name")
+				continue
+			}
+			input = owner + input
+		}
+		zp := dns.NewZoneParser(strings.NewReader(input), origin, "")
+		zp.SetDefaultTTL(ttl)
+		rr, ok := zp.Next()
+		if !ok {
+			msg := "invalid record"
+			if err := zp.Err(); err != nil {
+				msg, _, _ = strings.Cut(strings.TrimPrefix(err.Error(), "dns: "), " at line: ")
+			}
+			fail(entry.line, "%s", msg)
+			continue
+		}
+		h := rr.Header()
+		owner = h.Name
+		name := strings.ToLower(h.Name)
+		switch {
+		case h.Class != dns.ClassINET:
+			fail(entry.line, "only the IN class is served")
+			continue
+		case !dns.IsSubDomain(apex, name):
+			fail(entry.line, "%s is outside the zone", h.Name)
+			continue
+		case h.Rrtype == dns.TypeSOA:
+			fail(entry.line, "the SOA is set in the zone settings")
+			continue
+		case h.Rrtype == dns.TypeNS && name == apex:
+			fail(entry.line, "the apex NS is set in the zone settings")
+			continue
+		}
+
+		record := rrToRecord(apex, rr)
+		record.ZoneID = zone.ID
+		schedule, notes, caching, err := parseZoneTextComment(zp.Comment())
+		if err != nil {
+			fail(entry.line, "%v", err)
+			continue
+		}
+		record.RecordSchedule, record.RecordNotes, record.RecordCaching = schedule, notes, caching
+		records = append(records, zoneTextRecord{DBRecord: record, line: entry.line, rr: rr})
+	}
+	return records, problems
+}
+
+// parseZoneTextComment reads the schedule, notes and cache control written
+// by recordLine from the comment of a record: "; active <from>..<until> ;
+// <comment> ; tags <a,b> ; no-cache", each part optional
+func parseZoneTextComment(comment string) (RecordSchedule, RecordNotes, RecordCaching, error) {
+	var schedule RecordSchedule
+	var notes RecordNotes
+	var caching RecordCaching
+	var text []string
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimSpace(comment), ";"), ";") {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "":
+		case strings.HasPrefix(part, "active "):
+			from, until, ok := strings.Cut(strings.TrimPrefix(part, "active "), "..")
+			if !ok {
+				return schedule, notes, caching, fmt.Errorf("schedule must be \"active <from>..<until>\"")
+			}
+			for _, t := range []struct {
+				value string
+				dst   **time.Time
+			}{{from, &schedule.ActivateAt}, {until, &schedule.ExpireAt}} {
+				if t.value = strings.TrimSpace(t.value); t.value == "" {
+					continue
+				}
+				at, err := time.Parse(time.RFC3339, t.value)
+				if err != nil {
+					return schedule, notes, caching, fmt.Errorf("invalid schedule time %q, use RFC 3339", t.value)
+				}
+				*t.dst = &at
+			}
+		case strings.HasPrefix(part, "tags "):
+			notes.Tags = append(notes.Tags, strings.Split(strings.TrimPrefix(part, "tags "), ",")...)
+		case part == "no-cache":
+			caching.NoCache = true
+		default:
+			text = append(text, part)
+		}
+	}
+	notes.Comment = strings.Join(text, "; ")
+	notes, err := normalizeRecordNotes(notes)
+	return schedule, notes, caching, err
+}
+
+// zoneTextKey identifies a record by owner, type and rdata
+func zoneTextKey(rr dns.RR) string {
+	h := rr.Header()
+	return strings.ToLower(h.Name) + " " + dns.TypeToString[h.Rrtype] + " " + rdataString(rr)
+}
+
+// sameRecordDetails reports whether a and b only differ in name and value
+func sameRecordDetails(a, b DBRecord) bool {
+	aFrom, aUntil := a.columns()
+	bFrom, bUntil := b.columns()
+	return a.TTL == b.TTL && a.Priority == b.Priority && aFrom == bFrom && aUntil == bUntil &&
+		a.Comment == b.Comment && a.tagsColumn() == b.tagsColumn() && a.NoCache == b.NoCache
+}
+
+// diffZoneText returns the changes turning the records of a zone into the
+// edited ones, keeping the records found unchanged, the records after the
+// changes, and the new schedules that are not valid
+func diffZoneText(zone *DBZone, current []DBRecord, edited []zoneTextRecord) ([]DBChange, []ChangesetDiff, []DBRecord, []ZoneTextError) {
+	keys := make([]string, len(current))
+	for i, r := range current {
+		if rr, err := recordToRR(zone.Name, r); err == nil {
+			keys[i] = zoneTextKey(rr)
+		}
+	}
+	used := make([]bool, len(current))
+	match := make([]int, len(edited))
+	for j, e := range edited {
+		match[j] = -1
+		key := zoneTextKey(e.rr)
+		for i := range current {
+			if !used[i] && keys[i] == key {
+				used[i], match[j] = true, i
+				break
+			}
+		}
+	}
+	// A record of the same owner and type is an edit of its value
+	for j, e := range edited {
+		if match[j] >= 0 {
+			continue
+		}
+		owner, _, _ := strings.Cut(zoneTextKey(e.rr), " "+e.Type+" ")
+		for i := range current {
+			if !used[i] && keys[i] != "" && strings.HasPrefix(keys[i], owner+" "+e.Type+" ") {
+				used[i], match[j] = true, i
+				break
+			}
+		}
+	}
+
+	var changes []DBChange
+	diff := []ChangesetDiff{}
+	var after []DBRecord
+	var invalid []ZoneTextError
+	checkSchedule := func(e zoneTextRecord, old *DBRecord) {
+		if old != nil {
+			oldFrom, oldUntil := old.columns()
+			from, until := e.columns()
+			if from == oldFrom && until == oldUntil {
+				return
+			}
+		}
+		if err := validRecordSchedule(e.RecordSchedule); err != nil {
+			invalid = append(invalid, ZoneTextError{Line: e.line, Error: err.Error()})
+		}
+	}
+	change := func(action string, r DBRecord) DBChange {
+		return DBChange{Action: action, RecordID: r.ID, Name: r.Name, Type: r.Type, Value: r.Value, TTL: r.TTL, Priority: r.Priority, RecordSchedule: r.RecordSchedule, RecordNotes: r.RecordNotes, RecordCaching: r.RecordCaching}
+	}
+	for i, r := range current {
+		if !used[i] {
+			changes = append(changes, change("delete", r))
+			diff = append(diff, ChangesetDiff{Action: "delete", Before: recordLine(zone.Name, r)})
+		}
+	}
+	for j, e := range edited {
+		if match[j] < 0 {
+			checkSchedule(e, nil)
+			changes = append(changes, change("create", e.DBRecord))
+			diff = append(diff, ChangesetDiff{Action: "create", After: recordLine(zone.Name, e.DBRecord)})
+			after = append(after, e.DBRecord)
+			continue
+		}
+		old := current[match[j]]
+		updated := e.DBRecord
+		updated.ID, updated.Version = old.ID, old.Version
+		if zoneTextKey(e.rr) == keys[match[j]] {
+			// Same data, kept as it was typed
+			updated.Name, updated.Value, updated.Priority = old.Name, old.Value, old.Priority
+			if sameRecordDetails(old, updated) {
+				after = append(after, old)
+				continue
+			}
+		}
+		checkSchedule(e, &old)
+		changes = append(changes, change("update", updated))
+		diff = append(diff, ChangesetDiff{Action: "update", Before: recordLine(zone.Name, old), After: recordLine(zone.Name, updated)})
+		after = append(after, updated)
+	}
+	return changes, diff, after, invalid
+}
+
+// Zone text API handlers
+
+// handleAPIGetZoneText handles GET /api/zones/:id/text, the zone as a
+// master file, with the zone serial as ETag
+func handleAPIGetZoneText(c *gin.Context) {
+	zone, records, ok := loadPrimaryZone(c)
+	if !ok {
+		return
+	}
+	setETag(c, int64(zone.Serial))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(zoneText(zone, records)))
+}
+
+// handleAPIPutZoneText handles PUT /api/zones/:id/text: the edited master
+// file in the body replaces the records of the zone. The lines in error,
+// the diff and the problems of the resulting zone are returned; with
+// ?dry_run=true nothing is applied.
+func handleAPIPutZoneText(c *gin.Context) {
+	zone, records, ok := loadPrimaryZone(c)
+	if !ok {
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+	serial := 0
+	if !dryRun {
+		expected, ok := checkIfMatch(c, int64(zone.Serial))
+		if !ok {
+			return
+		}
+		serial = int(expected)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxZoneText+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read the zone file"})
+		return
+	}
+	if len(body) > maxZoneText {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("zone file is larger than %d MB", maxZoneText>>20)})
+		return
+	}
+
+	edited, lineErrors := parseZoneText(zone, string(body))
+	if len(lineErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "the zone file has errors", "errors": lineErrors})
+		return
+	}
+	changes, diff, after, lineErrors := diffZoneText(zone, records, edited)
+	if len(lineErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "the zone file has errors", "errors": lineErrors})
+		return
+	}
+	problems := checkZoneRecords(zone, after)
+	result := gin.H{"diff": diff, "problems": problems, "valid": !hasErrors(problems), "serial": zone.Serial}
+	if hasErrors(problems) {
+		result["error"] = "the zone would have errors"
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+	if dryRun || len(changes) == 0 {
+		setETag(c, int64(zone.Serial))
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	next, err := database.ApplyZoneChanges(zone.ID, serial, changes)
+	if err != nil {
+		if errors.Is(err, errVersionConflict) {
+			if current, err := database.GetZone(zone.ID); err == nil {
+				versionConflict(c, int64(current.Serial))
+				return
+			}
+		}
+		if errors.Is(err, errChangesetConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		slog.Error("failed to apply zone file", "zone", zone.Name, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply zone file"})
+		return
+	}
+
+	// Reload zones into memory
+	if err := LoadZonesFromDB(); err != nil {
+		slog.Error("failed to reload zones", "error", err)
+	}
+
+	slog.Info("Zone file applied", "zone", zone.Name, "changes", len(changes), "serial", next)
+	result["serial"] = next
+	setETag(c, int64(next))
+	c.JSON(http.StatusOK, result)
+}
+
+// loadPrimaryZone returns the primary zone of the :id parameter and its
+// records, or answers the request with an error
+func loadPrimaryZone(c *gin.Context) (*DBZone, []DBRecord, bool) {
+	zoneID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone id"})
+		return nil, nil, false
+	}
+	zone, err := database.GetZone(zoneID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return nil, nil, false
+	}
+	if msg := zoneRecordsError(zone); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return nil, nil, false
+	}
+	records, err := database.ListRecordsByZone(zoneID)
+	if err != nil {
+		slog.Error("failed to list records", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list records"})
+		return nil, nil, false
+	}
+	return zone, records, true
+}